@@ -10,11 +10,13 @@ import (
 
 	"github.com/gorilla/mux"
 	golog "github.com/ipfs/go-log"
+	"github.com/qri-io/qri/api/graphql"
 	apiutil "github.com/qri-io/qri/api/util"
 	"github.com/qri-io/qri/auth/token"
 	"github.com/qri-io/qri/lib"
 	qhttp "github.com/qri-io/qri/lib/http"
 	"github.com/qri-io/qri/lib/websocket"
+	"github.com/qri-io/qri/trace"
 	"github.com/qri-io/qri/version"
 )
 
@@ -221,6 +223,7 @@ func NewServerRoutes(s Server) *mux.Router {
 	m.Use(muxVarsToQueryParamMiddleware)
 	m.Use(refStringMiddleware)
 	m.Use(token.OAuthTokenMiddleware)
+	m.Use(trace.Middleware)
 
 	var routeParams refRouteParams
 
@@ -228,9 +231,13 @@ func NewServerRoutes(s Server) *mux.Router {
 	m.Handle(AEHome.String(), s.NoLogMiddleware(s.HomeHandler))
 	m.Handle(AEHealth.String(), s.NoLogMiddleware(HealthCheckHandler))
 	m.Handle(AEIPFS.String(), s.Middleware(s.HandleIPFSPath))
+	m.Handle(AEGraphQL.String(), s.Middleware(graphql.NewHandler(s.Instance))).Methods(http.MethodGet, http.MethodPost, http.MethodOptions)
 	if cfg.API.Webui {
 		m.Handle(AEWebUI.String(), s.Middleware(WebuiHandler))
 	}
+	if cfg.API.Metrics {
+		m.Handle(AEMetrics.String(), s.Middleware(s.Instance.MetricsHandler().ServeHTTP)).Methods(http.MethodGet)
+	}
 
 	// auth endpoints
 	m.Handle(AEToken.String(), s.Middleware(TokenHandler(s.Instance))).Methods(http.MethodPost, http.MethodOptions)
@@ -250,6 +257,9 @@ func NewServerRoutes(s Server) *mux.Router {
 		m.Handle(qhttp.AERemoteDSync.String(), s.Middleware(s.Instance.RemoteServer().DsyncHTTPHandler()))
 		m.Handle(qhttp.AERemoteLogSync.String(), s.Middleware(s.Instance.RemoteServer().LogsyncHTTPHandler()))
 		m.Handle(qhttp.AERemoteRefs.String(), s.Middleware(s.Instance.RemoteServer().RefsHTTPHandler()))
+		if s.Instance.RemoteServer().Previews != nil {
+			m.Handle(qhttp.AERemoteBody.String()+"{path:.*}", s.Middleware(s.Instance.RemoteServer().BodyHTTPHandler(qhttp.AERemoteBody.String())))
+		}
 	}
 
 	return m
@@ -223,6 +223,30 @@ func TestHealthCheck(t *testing.T) {
 	runHandlerTestCases(t, "health check", HealthCheckHandler, healthCheckCases, true)
 }
 
+func TestMetricsRouteDisabledByDefault(t *testing.T) {
+	run := NewAPITestRunner(t)
+	defer run.Delete()
+
+	getMetrics := func() int {
+		res := httptest.NewRecorder()
+		NewServerRoutes(New(run.Inst)).ServeHTTP(res, httptest.NewRequest(http.MethodGet, AEMetrics.String(), nil))
+		return res.Code
+	}
+
+	if code := getMetrics(); code != http.StatusNotFound {
+		t.Errorf("expected metrics to 404 by default, got status %d", code)
+	}
+
+	cfg := run.Inst.GetConfig().Copy()
+	cfg.API.Metrics = true
+	if err := run.Inst.ChangeConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if code := getMetrics(); code != http.StatusOK {
+		t.Errorf("expected enabled metrics to respond OK, got status %d", code)
+	}
+}
+
 type handlerMimeMultipartTestCase struct {
 	method    string
 	endpoint  string
@@ -11,6 +11,10 @@ const (
 	AEHome qhttp.APIEndpoint = "/"
 	// AEHealth is the service health check endpoint
 	AEHealth qhttp.APIEndpoint = "/health"
+	// AEMetrics serves prometheus metrics
+	AEMetrics qhttp.APIEndpoint = "/metrics"
+	// AEGraphQL executes GraphQL queries
+	AEGraphQL qhttp.APIEndpoint = "/graphql"
 	// AEIPFS is the IPFS endpoint
 	AEIPFS qhttp.APIEndpoint = "/qfs/ipfs/{path:.*}"
 	// AEWebUI serves the remote WebUI
@@ -0,0 +1,146 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/lib"
+	repotest "github.com/qri-io/qri/repo/test"
+)
+
+func TestGraphQLHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tr, err := repotest.NewTempRepo("peer", "graphql_handler", repotest.NewTestCrypto())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Delete()
+
+	inst, err := lib.NewInstance(ctx, tr.QriPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bodyPath := filepath.Join(tr.RootPath, "body.csv")
+	if err := ioutil.WriteFile(bodyPath, []byte("a,1\nb,2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"first", "second"} {
+		_, err := inst.Dataset().Save(ctx, &lib.SaveParams{
+			Ref:      "me/graphql_ds",
+			Dataset:  &dataset.Dataset{Meta: &dataset.Meta{Title: title}},
+			BodyPath: bodyPath,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewHandler(inst)
+	query := `{
+	profile { peername }
+	dataset(ref: "peer/graphql_ds") {
+		name
+		metaTitle
+		meta
+		commit
+		structure
+		body(limit: 1)
+		history { commitTitle }
+	}
+}`
+
+	res := struct {
+		Data struct {
+			Profile struct {
+				Peername string
+			}
+			Dataset struct {
+				Name      string
+				MetaTitle string
+				Meta      map[string]interface{}
+				Commit    map[string]interface{}
+				Structure map[string]interface{}
+				Body      []interface{}
+				History   []struct{ CommitTitle string }
+			}
+		}
+		Errors []interface{}
+	}{}
+
+	body, _ := json.Marshal(map[string]string{"query": query})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", res.Errors)
+	}
+
+	ds := res.Data.Dataset
+	if res.Data.Profile.Peername != "peer" {
+		t.Errorf("expected profile peername %q, got %q", "peer", res.Data.Profile.Peername)
+	}
+	if ds.Name != "graphql_ds" || ds.MetaTitle != "second" {
+		t.Errorf("unexpected dataset name or title: %q %q", ds.Name, ds.MetaTitle)
+	}
+	if ds.Meta["title"] != "second" {
+		t.Errorf("expected meta component title %q, got %v", "second", ds.Meta["title"])
+	}
+	if ds.Commit["title"] == nil || ds.Structure["format"] != "csv" {
+		t.Errorf("expected commit & structure components, got %v %v", ds.Commit, ds.Structure)
+	}
+	if len(ds.Body) != 1 {
+		t.Errorf("expected 1 body entry, got %d", len(ds.Body))
+	}
+	if len(ds.History) != 2 {
+		t.Errorf("expected 2 versions in history, got %d", len(ds.History))
+	}
+
+	// GET requests read the query from the URL
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(`{ dataset(ref: "peer/not_a_dataset") { name } }`), nil))
+	res.Errors = nil
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Errors) == 0 {
+		t.Error("expected querying a missing dataset to return errors")
+	}
+
+	limited := map[string]string{
+		"too deep":   `{ dataset(ref: "peer/graphql_ds") { history { history { history { history { history { history { history { history { name } } } } } } } } } }`,
+		"too costly": `{ datasets(limit: 100) { history(limit: 100) { body(limit: 1000) } } }`,
+	}
+	for name, q := range limited {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(q), nil))
+		res.Errors = nil
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Errors) == 0 {
+			t.Errorf("%s: expected query limits to reject the request", name)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected request without a query to return status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
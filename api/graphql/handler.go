@@ -0,0 +1,102 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	golog "github.com/ipfs/go-log"
+	apiutil "github.com/qri-io/qri/api/util"
+	"github.com/qri-io/qri/lib"
+)
+
+var log = golog.Logger("graphql")
+
+// Request is a GraphQL request, sent as a JSON POST body or as GET query
+// parameters
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// NewHandler creates an HTTP handler that executes GraphQL requests against
+// an instance. Responses follow the GraphQL spec, holding "data" & "errors"
+// fields. Requests that nest too deeply or could resolve too many fields are
+// rejected before executing
+func NewHandler(inst *lib.Instance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseRequest(r)
+		if err != nil {
+			apiutil.WriteErrResponse(w, http.StatusBadRequest, err)
+			return
+		}
+
+		res := execute(r.Context(), inst, req)
+		if res.HasErrors() {
+			log.Debugw("graphql request", "errors", res.Errors)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			log.Debugw("writing graphql response", "err", err)
+		}
+	}
+}
+
+// execute parses, validates & runs a request. unlike gql.Do, execute checks
+// the request against query limits before resolving any fields
+func execute(ctx context.Context, inst *lib.Instance, req *Request) *gql.Result {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return &gql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	if vr := gql.ValidateDocument(&schema, doc, nil); !vr.IsValid {
+		return &gql.Result{Errors: vr.Errors}
+	}
+	if err := checkQueryLimits(doc, req.Variables); err != nil {
+		return &gql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	return gql.Execute(gql.ExecuteParams{
+		Schema:        schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       withLoader(ctx, newVersionLoader(inst)),
+	})
+}
+
+func parseRequest(r *http.Request) (*Request, error) {
+	req := &Request{}
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				return nil, fmt.Errorf("invalid variables: %w", err)
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, fmt.Errorf("invalid request body: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("graphql only accepts GET & POST requests")
+	}
+
+	if req.Query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	return req, nil
+}
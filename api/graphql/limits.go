@@ -0,0 +1,147 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	// maxListLimit caps the page size of dataset, history & run list fields
+	maxListLimit = 100
+	// maxBodyLimit caps the number of body entries a body field returns
+	maxBodyLimit = 1000
+	// maxQueryDepth is the deepest a request can nest selections
+	maxQueryDepth = 8
+	// maxQueryCost bounds the estimated number of fields a request resolves.
+	// fields in a list count once for each item the list can hold
+	maxQueryCost = 10000
+)
+
+// fieldLimits maps fields that accept a limit argument to the largest limit
+// each field accepts
+var fieldLimits = map[string]int{
+	"datasets": maxListLimit,
+	"history":  maxListLimit,
+	"runs":     maxListLimit,
+	"body":     maxBodyLimit,
+}
+
+// limitArg returns the clamped limit argument of a field. negative & overly
+// large limits are replaced with the largest limit the field accepts
+func limitArg(p gql.ResolveParams) int {
+	return clampLimit(intArg(p, "limit"), fieldLimits[p.Info.FieldName])
+}
+
+func clampLimit(limit, max int) int {
+	if limit < 0 || limit > max {
+		return max
+	}
+	return limit
+}
+
+// checkQueryLimits rejects requests that nest deeper than maxQueryDepth or
+// that could resolve more than maxQueryCost fields. doc must be validated,
+// validation rejects fragment cycles
+func checkQueryLimits(doc *ast.Document, vars map[string]interface{}) error {
+	w := &costWalker{frags: map[string]*ast.FragmentDefinition{}, vars: vars}
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok {
+			w.frags[frag.Name.Value] = frag
+		}
+	}
+
+	cost := 0
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			c, err := w.cost(op.SelectionSet, 1)
+			if err != nil {
+				return err
+			}
+			if cost += c; cost > maxQueryCost {
+				return errQueryCost
+			}
+		}
+	}
+	return nil
+}
+
+var errQueryCost = fmt.Errorf("query exceeds the maximum cost of %d fields, request fewer fields or smaller pages", maxQueryCost)
+
+// costWalker estimates the cost of resolving selections
+type costWalker struct {
+	frags map[string]*ast.FragmentDefinition
+	vars  map[string]interface{}
+}
+
+// cost sums the cost of a selection set at depth, returning an error as soon
+// as the depth or cost limit is exceeded
+func (w *costWalker) cost(set *ast.SelectionSet, depth int) (int, error) {
+	if set == nil {
+		return 0, nil
+	}
+	if depth > maxQueryDepth {
+		return 0, fmt.Errorf("query exceeds the maximum depth of %d", maxQueryDepth)
+	}
+
+	cost := 0
+	for _, sel := range set.Selections {
+		var (
+			c   int
+			err error
+		)
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if c, err = w.cost(sel.SelectionSet, depth+1); err != nil {
+				return 0, err
+			}
+			if max, ok := fieldLimits[sel.Name.Value]; ok {
+				if c < 1 {
+					c = 1
+				}
+				c *= w.limit(sel, max)
+			}
+			c++
+		case *ast.InlineFragment:
+			c, err = w.cost(sel.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			if frag, ok := w.frags[sel.Name.Value]; ok {
+				c, err = w.cost(frag.SelectionSet, depth)
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		if cost += c; cost > maxQueryCost {
+			return 0, errQueryCost
+		}
+	}
+	return cost, nil
+}
+
+// limit returns the number of items a list field can resolve, matching the
+// limit the field's resolver will use
+func (w *costWalker) limit(f *ast.Field, max int) int {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				return clampLimit(n, max)
+			}
+		case *ast.Variable:
+			switch n := w.vars[v.Name.Value].(type) {
+			case int:
+				return clampLimit(n, max)
+			case float64:
+				return clampLimit(int(n), max)
+			}
+		}
+		return max
+	}
+	return clampLimit(defaultLimit, max)
+}
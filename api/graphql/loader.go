@@ -0,0 +1,119 @@
+package graphql
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/lib"
+)
+
+// versionLoader caches dataset versions loaded while resolving a request.
+// Each version is loaded once no matter how many component fields select it
+type versionLoader struct {
+	inst *lib.Instance
+
+	mu   sync.Mutex
+	vals map[loadKey]*loadResult
+}
+
+type loadKey struct {
+	ref      string
+	selector string
+}
+
+type loadResult struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+func newVersionLoader(inst *lib.Instance) *versionLoader {
+	return &versionLoader{inst: inst, vals: map[loadKey]*loadResult{}}
+}
+
+// loaderCtxKey is a private type for storing a versionLoader in a context
+type loaderCtxKey struct{}
+
+func withLoader(ctx context.Context, l *versionLoader) context.Context {
+	return context.WithValue(ctx, loaderCtxKey{}, l)
+}
+
+// loaderFromCtx returns the loader of the request being resolved. execute
+// sets a loader on every request
+func loaderFromCtx(ctx context.Context) *versionLoader {
+	return ctx.Value(loaderCtxKey{}).(*versionLoader)
+}
+
+// instance returns the instance the request being resolved runs against
+func instance(ctx context.Context) *lib.Instance {
+	return loaderFromCtx(ctx).inst
+}
+
+// component resolves a component of a dataset version. components are read
+// from the version preview, loaded once per version. readme & transform
+// previews hold abbreviated scripts, they're loaded with their own selector
+func (l *versionLoader) component(ctx context.Context, ref, selector string) (interface{}, error) {
+	if selector == "readme" || selector == "transform" {
+		return l.get(ctx, ref, selector)
+	}
+	v, err := l.get(ctx, ref, "")
+	if err != nil {
+		return nil, err
+	}
+	ds, ok := v.(*dataset.Dataset)
+	if !ok {
+		return l.get(ctx, ref, selector)
+	}
+
+	switch selector {
+	case "":
+		return ds, nil
+	case "commit":
+		return nilIfEmpty(ds.Commit), nil
+	case "meta":
+		return nilIfEmpty(ds.Meta), nil
+	case "structure":
+		return nilIfEmpty(ds.Structure), nil
+	case "viz":
+		return nilIfEmpty(ds.Viz), nil
+	case "stats":
+		if ds.Stats != nil {
+			return ds.Stats, nil
+		}
+	}
+	return l.get(ctx, ref, selector)
+}
+
+// get fetches a selector of a dataset version, calling lib at most once for
+// each ref & selector pair
+func (l *versionLoader) get(ctx context.Context, ref, selector string) (interface{}, error) {
+	key := loadKey{ref: ref, selector: selector}
+	l.mu.Lock()
+	res, ok := l.vals[key]
+	if !ok {
+		res = &loadResult{}
+		l.vals[key] = res
+	}
+	l.mu.Unlock()
+
+	res.once.Do(func() {
+		got, err := l.inst.Dataset().Get(ctx, &lib.GetParams{Ref: ref, Selector: selector})
+		if err != nil {
+			res.err = err
+			return
+		}
+		res.value = got.Value
+	})
+	return res.value, res.err
+}
+
+// nilIfEmpty converts nil pointers to untyped nil, resolving absent components
+// to null
+func nilIfEmpty(v interface{}) interface{} {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	return v
+}
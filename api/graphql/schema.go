@@ -0,0 +1,367 @@
+// Package graphql serves a GraphQL API over the datasets, version history,
+// workflows, runs & profiles of a qri instance. Resolvers call through lib
+// method sets, so lib access control & scopes apply to every field
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/qri-io/qri/automation/run"
+	"github.com/qri-io/qri/automation/workflow"
+	"github.com/qri-io/qri/base/params"
+	"github.com/qri-io/qri/config"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/lib"
+)
+
+// defaultLimit is the page size for list fields that don't specify a limit.
+// limits are capped per field, see fieldLimits
+const defaultLimit = 25
+
+// schema is static & built once, resolvers read the instance a request runs
+// against from the request context
+var schema = mustNewSchema()
+
+func mustNewSchema() gql.Schema {
+	s, err := newSchema()
+	if err != nil {
+		// the schema is static, failing to build it is a programming error
+		panic(fmt.Errorf("building graphql schema: %w", err))
+	}
+	return s
+}
+
+func newSchema() (gql.Schema, error) {
+	r := resolver{}
+
+	profileType := gql.NewObject(gql.ObjectConfig{
+		Name:        "Profile",
+		Description: "a qri user or organization",
+		Fields: gql.Fields{
+			"id":          &gql.Field{Type: gql.String},
+			"peername":    &gql.Field{Type: gql.String},
+			"type":        &gql.Field{Type: gql.String},
+			"name":        &gql.Field{Type: gql.String},
+			"email":       &gql.Field{Type: gql.String},
+			"description": &gql.Field{Type: gql.String},
+			"homeURL":     &gql.Field{Type: gql.String, Resolve: func(p gql.ResolveParams) (interface{}, error) { return p.Source.(*config.ProfilePod).HomeURL, nil }},
+			"color":       &gql.Field{Type: gql.String},
+			"photo":       &gql.Field{Type: gql.String},
+			"poster":      &gql.Field{Type: gql.String},
+			"twitter":     &gql.Field{Type: gql.String},
+			"created":     &gql.Field{Type: gql.DateTime, Resolve: timeField(func(src interface{}) time.Time { return src.(*config.ProfilePod).Created })},
+			"updated":     &gql.Field{Type: gql.DateTime, Resolve: timeField(func(src interface{}) time.Time { return src.(*config.ProfilePod).Updated })},
+		},
+	})
+
+	runType := gql.NewObject(gql.ObjectConfig{
+		Name:        "Run",
+		Description: "a single execution of a workflow",
+		Fields: gql.Fields{
+			"id":         &gql.Field{Type: gql.String},
+			"workflowID": &gql.Field{Type: gql.String},
+			"number":     &gql.Field{Type: gql.Int},
+			"status":     &gql.Field{Type: gql.String},
+			"message":    &gql.Field{Type: gql.String},
+			"startTime":  &gql.Field{Type: gql.DateTime},
+			"stopTime":   &gql.Field{Type: gql.DateTime},
+			"duration":   &gql.Field{Type: gql.Float, Description: "run duration in nanoseconds", Resolve: func(p gql.ResolveParams) (interface{}, error) { return float64(p.Source.(*run.State).Duration), nil }},
+			"steps":      &gql.Field{Type: JSON},
+			"params":     &gql.Field{Type: JSON},
+		},
+	})
+
+	workflowType := gql.NewObject(gql.ObjectConfig{
+		Name:        "Workflow",
+		Description: "the automation configuration of a dataset",
+		Fields: gql.Fields{
+			"id":     &gql.Field{Type: gql.String},
+			"initID": &gql.Field{Type: gql.String},
+			"ownerID": &gql.Field{Type: gql.String, Resolve: func(p gql.ResolveParams) (interface{}, error) {
+				return p.Source.(*workflow.Workflow).OwnerID.Encode(), nil
+			}},
+			"created":   &gql.Field{Type: gql.DateTime},
+			"active":    &gql.Field{Type: gql.Boolean},
+			"triggers":  &gql.Field{Type: JSON},
+			"hooks":     &gql.Field{Type: JSON},
+			"retention": &gql.Field{Type: JSON},
+			"freshness": &gql.Field{Type: JSON},
+		},
+	})
+
+	pageArgs := gql.FieldConfigArgument{
+		"limit":  &gql.ArgumentConfig{Type: gql.Int, DefaultValue: defaultLimit},
+		"offset": &gql.ArgumentConfig{Type: gql.Int, DefaultValue: 0},
+	}
+
+	versionType := gql.NewObject(gql.ObjectConfig{
+		Name:        "VersionInfo",
+		Description: "a single version of a dataset",
+		Fields: gql.Fields{
+			"ref": &gql.Field{Type: gql.String, Description: "reference to this version", Resolve: func(p gql.ResolveParams) (interface{}, error) {
+				return versionRef(p.Source), nil
+			}},
+			"initID":        &gql.Field{Type: gql.String},
+			"username":      &gql.Field{Type: gql.String},
+			"profileID":     &gql.Field{Type: gql.String},
+			"name":          &gql.Field{Type: gql.String},
+			"path":          &gql.Field{Type: gql.String},
+			"published":     &gql.Field{Type: gql.Boolean},
+			"foreign":       &gql.Field{Type: gql.Boolean},
+			"metaTitle":     &gql.Field{Type: gql.String},
+			"themeList":     &gql.Field{Type: gql.String},
+			"bodySize":      &gql.Field{Type: gql.Int},
+			"bodyRows":      &gql.Field{Type: gql.Int},
+			"bodyFormat":    &gql.Field{Type: gql.String},
+			"numErrors":     &gql.Field{Type: gql.Int},
+			"commitTime":    &gql.Field{Type: gql.DateTime, Resolve: timeField(func(src interface{}) time.Time { return src.(*dsref.VersionInfo).CommitTime })},
+			"commitTitle":   &gql.Field{Type: gql.String},
+			"commitMessage": &gql.Field{Type: gql.String},
+			"runID":         &gql.Field{Type: gql.String},
+			"runStatus":     &gql.Field{Type: gql.String},
+			"runStart":      &gql.Field{Type: gql.DateTime},
+
+			"dataset":   r.componentField("", "the full dataset document, excluding the body"),
+			"commit":    r.componentField("commit", "commit component"),
+			"meta":      r.componentField("meta", "meta component"),
+			"structure": r.componentField("structure", "structure component"),
+			"readme":    r.componentField("readme", "readme component"),
+			"transform": r.componentField("transform", "transform component"),
+			"viz":       r.componentField("viz", "viz component"),
+			"stats":     r.componentField("stats", "statistics about the dataset body"),
+			"body": &gql.Field{
+				Type:        JSON,
+				Description: "a page of dataset body entries",
+				Args:        pageArgs,
+				Resolve:     r.body,
+			},
+			"workflow": &gql.Field{
+				Type:        workflowType,
+				Description: "the workflow that automates this dataset, null if the dataset has no workflow",
+				Resolve:     r.workflow,
+			},
+			"runs": &gql.Field{
+				Type:        gql.NewList(runType),
+				Description: "runs of the dataset workflow, newest first",
+				Args:        pageArgs,
+				Resolve:     r.runs,
+			},
+		},
+	})
+	versionType.AddFieldConfig("history", &gql.Field{
+		Type:        gql.NewList(versionType),
+		Description: "version history of the dataset from logbook, newest first",
+		Args:        pageArgs,
+		Resolve:     r.history,
+	})
+
+	query := gql.NewObject(gql.ObjectConfig{
+		Name: "Query",
+		Fields: gql.Fields{
+			"profile": &gql.Field{
+				Type:        profileType,
+				Description: "the profile of the caller",
+				Resolve:     r.profile,
+			},
+			"datasets": &gql.Field{
+				Type:        gql.NewList(versionType),
+				Description: "the latest version of each dataset in a collection",
+				Args: gql.FieldConfigArgument{
+					"username": &gql.ArgumentConfig{Type: gql.String, Description: "list another user's collection"},
+					"term":     &gql.ArgumentConfig{Type: gql.String, Description: "filter datasets by name"},
+					"limit":    &gql.ArgumentConfig{Type: gql.Int, DefaultValue: defaultLimit},
+					"offset":   &gql.ArgumentConfig{Type: gql.Int, DefaultValue: 0},
+				},
+				Resolve: r.datasets,
+			},
+			"dataset": &gql.Field{
+				Type:        versionType,
+				Description: "the latest version of a dataset",
+				Args: gql.FieldConfigArgument{
+					"ref": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.String), Description: "dataset reference, eg: me/dataset"},
+				},
+				Resolve: r.dataset,
+			},
+		},
+	})
+
+	return gql.NewSchema(gql.SchemaConfig{Query: query})
+}
+
+// JSON is a scalar for values without a fixed schema, like dataset
+// components & body entries
+var JSON = gql.NewScalar(gql.ScalarConfig{
+	Name:        "JSON",
+	Description: "an arbitrary JSON value",
+	Serialize: func(value interface{}) interface{} {
+		return value
+	},
+	ParseValue: func(value interface{}) interface{} {
+		return value
+	},
+	ParseLiteral: parseJSONLiteral,
+})
+
+func parseJSONLiteral(v ast.Value) interface{} {
+	switch v := v.(type) {
+	case *ast.ObjectValue:
+		obj := map[string]interface{}{}
+		for _, f := range v.Fields {
+			obj[f.Name.Value] = parseJSONLiteral(f.Value)
+		}
+		return obj
+	case *ast.ListValue:
+		list := make([]interface{}, len(v.Values))
+		for i, item := range v.Values {
+			list[i] = parseJSONLiteral(item)
+		}
+		return list
+	default:
+		return v.GetValue()
+	}
+}
+
+// resolver resolves fields by calling lib methods of the request instance
+type resolver struct{}
+
+func (r resolver) profile(p gql.ResolveParams) (interface{}, error) {
+	return instance(p.Context).Profile().GetProfile(p.Context, &lib.ProfileParams{})
+}
+
+func (r resolver) datasets(p gql.ResolveParams) (interface{}, error) {
+	lp := &lib.CollectionListParams{
+		List: params.List{Limit: limitArg(p), Offset: intArg(p, "offset")},
+	}
+	lp.Username, _ = p.Args["username"].(string)
+	lp.Term, _ = p.Args["term"].(string)
+	lp.SetNonZeroDefaults()
+
+	infos, _, err := instance(p.Context).Collection().List(p.Context, lp)
+	if err != nil {
+		return nil, err
+	}
+	return versionInfoPtrs(infos), nil
+}
+
+func (r resolver) dataset(p gql.ResolveParams) (interface{}, error) {
+	ref, _ := p.Args["ref"].(string)
+	return instance(p.Context).Collection().Get(p.Context, &lib.CollectionGetParams{Ref: ref})
+}
+
+func (r resolver) history(p gql.ResolveParams) (interface{}, error) {
+	vi := p.Source.(*dsref.VersionInfo)
+	ap := &lib.ActivityParams{
+		Ref:  vi.SimpleRef().Alias(),
+		List: params.List{Limit: limitArg(p), Offset: intArg(p, "offset")},
+	}
+	infos, err := instance(p.Context).Dataset().Activity(p.Context, ap)
+	if err != nil {
+		return nil, err
+	}
+	return versionInfoPtrs(infos), nil
+}
+
+// componentField creates a field that resolves a component of the version
+// using the dataset get selector. versions are loaded through the request
+// loader, selecting many components of a version loads it once
+func (r resolver) componentField(selector, description string) *gql.Field {
+	return &gql.Field{
+		Type:        JSON,
+		Description: description,
+		Resolve: func(p gql.ResolveParams) (interface{}, error) {
+			return loaderFromCtx(p.Context).component(p.Context, versionRef(p.Source), selector)
+		},
+	}
+}
+
+func (r resolver) body(p gql.ResolveParams) (interface{}, error) {
+	gp := &lib.GetParams{
+		Ref:      versionRef(p.Source),
+		Selector: "body",
+		List:     params.List{Limit: limitArg(p), Offset: intArg(p, "offset")},
+	}
+	gp.SetNonZeroDefaults()
+	res, err := instance(p.Context).Dataset().Get(p.Context, gp)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+func (r resolver) workflow(p gql.ResolveParams) (interface{}, error) {
+	vi := p.Source.(*dsref.VersionInfo)
+	if vi.InitID == "" {
+		return nil, nil
+	}
+	wf, err := instance(p.Context).Automation().Workflow(p.Context, &lib.WorkflowParams{InitID: vi.InitID})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return wf, nil
+}
+
+func (r resolver) runs(p gql.ResolveParams) (interface{}, error) {
+	vi := p.Source.(*dsref.VersionInfo)
+	if vi.InitID == "" {
+		return []*run.State{}, nil
+	}
+	runs, err := instance(p.Context).Automation().Runs(p.Context, &lib.RunListParams{
+		InitID: vi.InitID,
+		List:   params.List{Limit: limitArg(p), Offset: intArg(p, "offset")},
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return []*run.State{}, nil
+		}
+		return nil, err
+	}
+	return runs, nil
+}
+
+// versionRef returns a reference to the exact version a VersionInfo describes
+func versionRef(src interface{}) string {
+	vi := src.(*dsref.VersionInfo)
+	ref := vi.SimpleRef()
+	if ref.Path == "" {
+		return ref.Alias()
+	}
+	return ref.String()
+}
+
+// versionInfoPtrs converts a slice of values so fields resolve against the
+// same type everywhere
+func versionInfoPtrs(infos []dsref.VersionInfo) []*dsref.VersionInfo {
+	res := make([]*dsref.VersionInfo, len(infos))
+	for i := range infos {
+		res[i] = &infos[i]
+	}
+	return res
+}
+
+func intArg(p gql.ResolveParams, name string) int {
+	v, _ := p.Args[name].(int)
+	return v
+}
+
+// timeField resolves a time, returning null for the zero time
+func timeField(get func(src interface{}) time.Time) gql.FieldResolveFn {
+	return func(p gql.ResolveParams) (interface{}, error) {
+		t := get(p.Source)
+		if t.IsZero() {
+			return nil, nil
+		}
+		return t, nil
+	}
+}
+
+// isNotFound returns true if err indicates a dataset has no workflow
+func isNotFound(err error) bool {
+	return errors.Is(err, workflow.ErrNotFound)
+}
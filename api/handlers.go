@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,8 +11,10 @@ import (
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/qri/api/util"
 	"github.com/qri-io/qri/base/archive"
+	qrierr "github.com/qri-io/qri/errors"
 	"github.com/qri-io/qri/event"
 	"github.com/qri-io/qri/lib"
+	qhttp "github.com/qri-io/qri/lib/http"
 )
 
 const (
@@ -67,6 +70,26 @@ func GetHandler(inst *lib.Instance, routePrefix string) http.HandlerFunc {
 		format := r.FormValue("format")
 
 		switch {
+		case format == "ndjson", arrayContains(r.Header["Accept"], "application/x-ndjson"):
+			// Examples:
+			// curl http://localhost:2503/ds/get/b5/world_bank_population/body?format=ndjson&where=year>2000
+			if p.Selector != "body" {
+				util.WriteErrResponse(w, http.StatusBadRequest, fmt.Errorf("can only get ndjson of the body component, selector must be 'body'"))
+				return
+			}
+			streamBodyResponse(w, r, inst, p, "ndjson")
+			return
+
+		case (format == "csv" || arrayContains(r.Header["Accept"], "text/csv")) && p.HasBodyQuery():
+			// Examples:
+			// curl "http://localhost:2503/ds/get/b5/world_bank_population/body?format=csv&columns=country,pop"
+			if err := validateCSVRequest(r, p); err != nil {
+				util.WriteErrResponse(w, http.StatusBadRequest, err)
+				return
+			}
+			streamBodyResponse(w, r, inst, p, "csv")
+			return
+
 		case format == "csv", arrayContains(r.Header["Accept"], "text/csv"):
 			// Examples:
 			// curl http://localhost:2503/ds/get/b5/world_bank_population/body?format=csv
@@ -102,10 +125,28 @@ func GetHandler(inst *lib.Instance, routePrefix string) http.HandlerFunc {
 			writeFileResponse(w, zipResults.Bytes, zipResults.GeneratedName, "zip")
 			return
 
+		case p.Selector == "body" && p.HasBodyQuery():
+			// queried body reads include a link to the next page
+			res, cur, err := inst.Dataset().QueryBody(r.Context(), p)
+			if err != nil {
+				respondWithGetError(w, err)
+				return
+			}
+			if cur != nil {
+				nextParams, err := cur.ToParams()
+				if err != nil {
+					util.RespondWithError(w, err)
+					return
+				}
+				util.WriteResponseWithNextPage(w, res.Value, r.URL.Path, nextParams)
+				return
+			}
+			util.WriteResponse(w, res.Value)
+
 		default:
 			res, err := inst.Dataset().Get(r.Context(), p)
 			if err != nil {
-				util.RespondWithError(w, err)
+				respondWithGetError(w, err)
 				return
 			}
 
@@ -119,6 +160,79 @@ func GetHandler(inst *lib.Instance, routePrefix string) http.HandlerFunc {
 	}
 }
 
+// streamBodyResponse writes body entries to the response as they're read,
+// encoded as format. Streams can't include the continuation token in the
+// response body, it's sent as an HTTP trailer once all entries are written
+func streamBodyResponse(w http.ResponseWriter, r *http.Request, inst *lib.Instance, p *lib.GetParams, format string) {
+	contentType := "application/x-ndjson"
+	if format == "csv" {
+		contentType = "text/csv"
+	}
+	w.Header().Set("Trailer", qhttp.NextTokenTrailer)
+
+	sw := &streamWriter{w: w, contentType: contentType}
+	p.Output = sw
+	p.OutputFormat = format
+	_, cur, err := inst.Dataset().QueryBody(r.Context(), p)
+	if err != nil {
+		if !sw.wrote {
+			respondWithGetError(w, err)
+			return
+		}
+		// headers are sent, the best we can do is stop the stream early
+		log.Debugw("streaming body", "ref", p.Ref, "err", err)
+		return
+	}
+	if !sw.wrote {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if cur != nil {
+		nextParams, err := cur.ToParams()
+		if err != nil {
+			log.Debugw("streaming body cursor", "err", err)
+			return
+		}
+		w.Header().Set(qhttp.NextTokenTrailer, nextParams["token"])
+	}
+	publishDownloadEvent(r.Context(), inst, p.Ref)
+}
+
+// respondWithGetError writes a get error to the response. Bad arguments,
+// like a where expression that refers to a missing column, are client errors
+func respondWithGetError(w http.ResponseWriter, err error) {
+	if errors.Is(err, lib.ErrBadArgs) {
+		var qerr qrierr.Error
+		if errors.As(err, &qerr) && qerr.Message() != "" {
+			err = fmt.Errorf("%w: %s", lib.ErrBadArgs, qerr.Message())
+		}
+		util.WriteErrResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	util.RespondWithError(w, err)
+}
+
+// streamWriter flushes each write to the client, setting the content type
+// header on first write
+type streamWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	wrote       bool
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if !sw.wrote {
+		sw.w.Header().Set("Content-Type", sw.contentType)
+		sw.wrote = true
+	}
+	n, err := sw.w.Write(p)
+	if f, ok := sw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
 func validateCSVRequest(r *http.Request, p *lib.GetParams) error {
 	format := r.FormValue("format")
 	if p.Selector != "body" {
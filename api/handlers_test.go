@@ -23,6 +23,7 @@ import (
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/dataset/dstest"
 	"github.com/qri-io/qri/lib"
+	qhttp "github.com/qri-io/qri/lib/http"
 )
 
 func TestGetZip(t *testing.T) {
@@ -51,6 +52,71 @@ func TestGetZip(t *testing.T) {
 	}
 }
 
+func TestGetBodyQuery(t *testing.T) {
+	run := NewAPITestRunner(t)
+	defer run.Delete()
+
+	ds := run.BuildDataset("test_ds")
+	run.SaveDataset(ds, "testdata/cities/data.csv")
+	muxVars := map[string]string{"username": "peer", "name": "test_ds", "selector": "body"}
+
+	// stream ndjson, continuing from the token sent as a trailer
+	params := map[string]string{"format": "ndjson", "where": "in_usa = true", "columns": "city", "limit": "2"}
+	status, body, trailer := bodyQueryCall(t, run.Inst, params, muxVars)
+	assertStatusCode(t, "get body ndjson", status, 200)
+	if diff := cmp.Diff("[\"new york\"]\n[\"chicago\"]\n", body); diff != "" {
+		t.Errorf("first page mismatch (-want +got):\n%s", diff)
+	}
+	token := trailer.Get(qhttp.NextTokenTrailer)
+	if token == "" {
+		t.Fatal("expected a continuation token trailer")
+	}
+
+	params["token"] = token
+	status, body, trailer = bodyQueryCall(t, run.Inst, params, muxVars)
+	assertStatusCode(t, "get body ndjson next page", status, 200)
+	if diff := cmp.Diff("[\"chatham\"]\n[\"raleigh\"]\n", body); diff != "" {
+		t.Errorf("second page mismatch (-want +got):\n%s", diff)
+	}
+	if token := trailer.Get(qhttp.NextTokenTrailer); token != "" {
+		t.Errorf("expected no token after the last page, got %q", token)
+	}
+
+	// stream csv
+	params = map[string]string{"format": "csv", "sort": "-pop", "columns": "city,pop"}
+	status, body, _ = bodyQueryCall(t, run.Inst, params, muxVars)
+	assertStatusCode(t, "get body csv", status, 200)
+	expect := "city,pop\ntoronto,40000000\nnew york,8500000\nchicago,300000\nraleigh,250000\nchatham,35000\n"
+	if diff := cmp.Diff(expect, body); diff != "" {
+		t.Errorf("csv mismatch (-want +got):\n%s", diff)
+	}
+
+	params = map[string]string{"format": "ndjson", "where": "not_a_column = 1"}
+	status, _, _ = bodyQueryCall(t, run.Inst, params, muxVars)
+	assertStatusCode(t, "get body with unknown column", status, 400)
+}
+
+func bodyQueryCall(t *testing.T, inst *lib.Instance, params, muxVars map[string]string) (int, string, http.Header) {
+	q := url.Values{}
+	for k, v := range params {
+		q.Set(k, v)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/get/peer/test_ds/body?"+q.Encode(), nil)
+	req = mux.SetURLVars(req, muxVars)
+	setRefStringFromMuxVars(req)
+	if err := setMuxVarsToQueryParams(req); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	GetHandler(inst, "")(w, req)
+	res := w.Result()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(body), res.Trailer
+}
+
 func TestGetBodyCSVHandler(t *testing.T) {
 	run := NewAPITestRunner(t)
 	defer run.Delete()
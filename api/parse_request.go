@@ -32,11 +32,15 @@ func parseGetParamsFromRequest(r *http.Request, p *lib.GetParams) error {
 	}
 
 	p.Selector = r.FormValue("selector")
+	p.Where = r.FormValue("where")
+	p.Columns = r.FormValue("columns")
+	p.Sort = r.FormValue("sort")
+	p.Token = r.FormValue("token")
 
 	p.All = util.ReqParamBool(r, "all", true)
 	p.Limit = util.ReqParamInt(r, "limit", 0)
 	p.Offset = util.ReqParamInt(r, "offset", 0)
-	if !(p.Offset == 0 && p.Limit == 0) {
+	if !(p.Offset == 0 && p.Limit == 0) || p.Token != "" {
 		p.All = false
 	}
 
@@ -0,0 +1,343 @@
+// Package audit records method calls made to a qri instance: who called
+// which method on which dataset, how long the call took & how it ended
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	golog "github.com/ipfs/go-log"
+	"github.com/qri-io/qri/base/params"
+)
+
+var log = golog.Logger("audit")
+
+// Entry is a single audited method call
+type Entry struct {
+	Time time.Time `json:"time"`
+	// ProfileID is the caller
+	ProfileID string `json:"profileID,omitempty"`
+	Method    string `json:"method"`
+	// Ref is the dataset reference the call was made with, if any
+	Ref      string        `json:"ref,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// Error is the error the call returned, empty for successful calls
+	Error string `json:"error,omitempty"`
+	// TraceID links the entry to the trace the call was made in
+	TraceID string `json:"traceID,omitempty"`
+}
+
+// Query filters entries. Zero-valued fields match all entries
+type Query struct {
+	params.List
+	ProfileID string
+	Method    string
+	Ref       string
+	// Since excludes entries made before this time
+	Since time.Time
+	// Failed only matches calls that returned an error
+	Failed bool
+}
+
+// Match returns true if the entry satisfies all query filters
+func (q Query) Match(e Entry) bool {
+	return (q.ProfileID == "" || e.ProfileID == q.ProfileID) &&
+		(q.Method == "" || e.Method == q.Method) &&
+		(q.Ref == "" || e.Ref == q.Ref) &&
+		(q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(!q.Failed || e.Error != "")
+}
+
+// Store persists audit entries
+type Store interface {
+	// Put records an entry
+	Put(ctx context.Context, e Entry) error
+	// List returns entries matching the query, newest first
+	List(ctx context.Context, q Query) ([]Entry, error)
+}
+
+// MemStore is an in-memory audit log. MemStore is safe for concurrent use
+type MemStore struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+var _ Store = (*MemStore)(nil)
+
+// NewMemStore creates an in-memory audit log
+func NewMemStore() *MemStore {
+	return &MemStore{}
+}
+
+// Put records an entry
+func (s *MemStore) Put(ctx context.Context, e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+// List returns entries matching the query, newest first
+func (s *MemStore) List(ctx context.Context, q Query) ([]Entry, error) {
+	if err := q.List.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return page(s.entries, q), nil
+}
+
+const (
+	// DefaultMaxFileSize is the size a FileStore log file grows to before it's
+	// rotated
+	DefaultMaxFileSize = 10 * 1024 * 1024
+	// DefaultMaxFiles is the number of rotated log files a FileStore keeps
+	DefaultMaxFiles = 4
+	// maxEntrySize bounds the length of a single encoded entry
+	maxEntrySize = 1024 * 1024
+)
+
+// readChunkSize is the number of bytes List reads from a log file at a time
+var readChunkSize int64 = 64 * 1024
+
+// FileStore is an append-only audit log stored as a file of newline-delimited
+// JSON entries. Once the file grows past MaxFileSize it's rotated to
+// "path.1", shifting older files along. only MaxFiles rotated files are kept,
+// older entries are dropped. FileStore is safe for concurrent use
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+	// MaxFileSize is the size in bytes a log file can grow to before rotating
+	MaxFileSize int64
+	// MaxFiles is the number of rotated log files to keep
+	MaxFiles int
+}
+
+var _ Store = (*FileStore)(nil)
+
+// FileStoreOption configures a FileStore
+type FileStoreOption func(s *FileStore)
+
+// OptMaxFileSize sets the size a log file grows to before rotating
+func OptMaxFileSize(size int64) FileStoreOption {
+	return func(s *FileStore) {
+		s.MaxFileSize = size
+	}
+}
+
+// OptMaxFiles sets the number of rotated log files to retain
+func OptMaxFiles(n int) FileStoreOption {
+	return func(s *FileStore) {
+		s.MaxFiles = n
+	}
+}
+
+// NewFileStore creates an audit log stored at path
+func NewFileStore(path string, opts ...FileStoreOption) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	s := &FileStore{
+		path:        path,
+		MaxFileSize: DefaultMaxFileSize,
+		MaxFiles:    DefaultMaxFiles,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.MaxFileSize <= 0 {
+		return nil, fmt.Errorf("audit: max file size must be positive")
+	}
+	if s.MaxFiles < 0 {
+		return nil, fmt.Errorf("audit: max files can't be negative")
+	}
+	return s, nil
+}
+
+// Put appends an entry to the log file, rotating the file first if the entry
+// would grow it past MaxFileSize
+func (s *FileStore) Put(ctx context.Context, e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if len(data) > maxEntrySize {
+		return fmt.Errorf("audit: entry exceeds %d bytes", maxEntrySize)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fi, err := os.Stat(s.path); err == nil && fi.Size() > 0 && fi.Size()+int64(len(data)) > s.MaxFileSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// filePath returns the path of the i-th log file, 0 being the live file
+func (s *FileStore) filePath(i int) string {
+	if i == 0 {
+		return s.path
+	}
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
+
+// rotate shifts each log file to the next-oldest position, dropping the
+// oldest. callers must hold the lock
+func (s *FileStore) rotate() error {
+	if err := os.Remove(s.filePath(s.MaxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := s.MaxFiles - 1; i >= 0; i-- {
+		if err := os.Rename(s.filePath(i), s.filePath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns entries matching the query, newest first. Log files are read
+// backwards from the newest entry, stopping once the requested page is full.
+// Lines that can't be decoded are skipped
+func (s *FileStore) List(ctx context.Context, q Query) ([]Entry, error) {
+	if err := q.List.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pg := &pager{q: q, res: []Entry{}}
+	for i := 0; i <= s.MaxFiles; i++ {
+		done, err := s.listFile(ctx, s.filePath(i), pg)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+	}
+	return pg.res, nil
+}
+
+// listFile adds entries in a log file to the pager, newest first. returns
+// true once the pager is full
+func (s *FileStore) listFile(ctx context.Context, path string, pg *pager) (done bool, err error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	err = eachLineReverse(f, func(line []byte) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		e := Entry{}
+		if err := json.Unmarshal(line, &e); err != nil {
+			log.Debugw("skipping invalid audit entry", "err", err)
+			return true
+		}
+		done = pg.add(e)
+		return !done
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+	return done, err
+}
+
+// eachLineReverse calls fn with each non-empty line in f, last line first,
+// reading the file from the end in chunks. iteration stops when fn returns
+// false
+func eachLineReverse(f *os.File, fn func(line []byte) bool) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	pos := fi.Size()
+	// rest holds the start of a line that continues past pos
+	var rest []byte
+	for pos > 0 {
+		n := readChunkSize
+		if pos < n {
+			n = pos
+		}
+		pos -= n
+		chunk := make([]byte, n, int(n)+len(rest))
+		if _, err := f.ReadAt(chunk, pos); err != nil {
+			return err
+		}
+		data := append(chunk, rest...)
+		for {
+			i := bytes.LastIndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			if line := data[i+1:]; len(line) > 0 && !fn(line) {
+				return nil
+			}
+			data = data[:i]
+		}
+		if len(data) > maxEntrySize {
+			return fmt.Errorf("audit: entry exceeds %d bytes", maxEntrySize)
+		}
+		rest = data
+	}
+	if len(rest) > 0 {
+		fn(rest)
+	}
+	return nil
+}
+
+// pager collects a page of entries that match a query, given entries
+// newest first
+type pager struct {
+	q       Query
+	skipped int
+	res     []Entry
+}
+
+// add considers an entry for the page, returning true once the page is full
+func (p *pager) add(e Entry) bool {
+	if !p.q.All() && len(p.res) == p.q.Limit {
+		return true
+	}
+	if !p.q.Match(e) {
+		return false
+	}
+	if p.skipped < p.q.Offset {
+		p.skipped++
+		return false
+	}
+	p.res = append(p.res, e)
+	return !p.q.All() && len(p.res) == p.q.Limit
+}
+
+// page filters entries stored oldest first, returning the requested page
+// newest first
+func page(entries []Entry, q Query) []Entry {
+	pg := &pager{q: q, res: []Entry{}}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if pg.add(entries[i]) {
+			break
+		}
+	}
+	return pg.res
+}
@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/qri/base/params"
+)
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFileStore(filepath.Join(dir, "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, s := range map[string]Store{"mem": NewMemStore(), "file": fs} {
+		t.Run(name, func(t *testing.T) {
+			assertStore(t, s)
+		})
+	}
+}
+
+func assertStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: start, ProfileID: "a", Method: "dataset.get", Ref: "a/movies", Duration: time.Millisecond},
+		{Time: start.Add(time.Minute), ProfileID: "b", Method: "dataset.save", Ref: "b/movies", Error: "oh noes"},
+		{Time: start.Add(2 * time.Minute), ProfileID: "a", Method: "dataset.save", Ref: "a/movies"},
+	}
+
+	got, err := s.List(ctx, Query{List: params.ListAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected empty log, got %d entries", len(got))
+	}
+
+	for _, e := range entries {
+		if err := s.Put(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		description string
+		q           Query
+		expect      []Entry
+	}{
+		{"all, newest first", Query{List: params.ListAll}, []Entry{entries[2], entries[1], entries[0]}},
+		{"limit & offset", Query{List: params.List{Limit: 1, Offset: 1}}, []Entry{entries[1]}},
+		{"profile", Query{List: params.ListAll, ProfileID: "a"}, []Entry{entries[2], entries[0]}},
+		{"method & ref", Query{List: params.ListAll, Method: "dataset.save", Ref: "a/movies"}, []Entry{entries[2]}},
+		{"since", Query{List: params.ListAll, Since: start.Add(time.Minute)}, []Entry{entries[2], entries[1]}},
+		{"failed", Query{List: params.ListAll, Failed: true}, []Entry{entries[1]}},
+	}
+	for _, c := range cases {
+		got, err := s.List(ctx, c.q)
+		if err != nil {
+			t.Fatalf("%s: %s", c.description, err)
+		}
+		if diff := cmp.Diff(c.expect, got); diff != "" {
+			t.Errorf("%s: result mismatch (-want +got):\n%s", c.description, diff)
+		}
+	}
+
+	if _, err := s.List(ctx, Query{List: params.List{Limit: -2}}); err == nil {
+		t.Error("expected invalid list params to error")
+	}
+}
+
+func TestFileStoreRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	prevChunkSize := readChunkSize
+	readChunkSize = 16
+	defer func() { readChunkSize = prevChunkSize }()
+
+	path := filepath.Join(dir, "audit.jsonl")
+	s, err := NewFileStore(path, OptMaxFileSize(400), OptMaxFiles(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := make([]Entry, 40)
+	for i := range entries {
+		entries[i] = Entry{Time: start.Add(time.Duration(i) * time.Minute), ProfileID: "a", Method: "dataset.get"}
+		if err := s.Put(ctx, entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i <= 2; i++ {
+		fi, err := os.Stat(s.filePath(i))
+		if err != nil {
+			t.Fatalf("expected log file %d to exist: %s", i, err)
+		}
+		if fi.Size() > 400 {
+			t.Errorf("log file %d is %d bytes, larger than the max file size", i, fi.Size())
+		}
+	}
+	if _, err := os.Stat(s.filePath(3)); !os.IsNotExist(err) {
+		t.Errorf("expected rotated files past MaxFiles to be removed, got: %v", err)
+	}
+
+	all, err := s.List(ctx, Query{List: params.ListAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 || len(all) >= len(entries) {
+		t.Fatalf("expected retention to drop the oldest entries, got %d of %d", len(all), len(entries))
+	}
+	for i, e := range all {
+		if diff := cmp.Diff(entries[len(entries)-1-i], e); diff != "" {
+			t.Fatalf("entry %d mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+
+	got, err := s.List(ctx, Query{List: params.List{Limit: 3, Offset: len(all) - 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(all[len(all)-2:], got); diff != "" {
+		t.Errorf("page across rotated files mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -31,7 +31,7 @@ func NewStore(cfg *config.Config) (Store, error) {
 	}
 
 	switch cfg.Repo.Type {
-	case "fs":
+	case "fs", "sqlite":
 		// Don't create a localstore with the empty path, this will use the current directory
 		if cfg.Path() == "" {
 			return nil, fmt.Errorf("new key.LocalStore requires non-empty path")
@@ -0,0 +1,107 @@
+// Package freshness checks datasets against expectations of how often they
+// get new versions
+package freshness
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/qri-io/qri/automation/retention"
+	"github.com/qri-io/qri/dsref"
+)
+
+// SLA is an expectation of how often a dataset gets a new version. A dataset
+// that updates daily, with a few hours of slack looks like:
+//
+//	{"maxAge": "30h"}
+type SLA struct {
+	// MaxAge is the longest a dataset can go without a new version before
+	// it's stale
+	MaxAge retention.Duration `json:"maxAge"`
+}
+
+// Validate errors if the SLA is not valid
+func (s *SLA) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.MaxAge <= 0 {
+		return fmt.Errorf("freshness: maxAge must be greater than zero")
+	}
+	return nil
+}
+
+// Reason describes why a dataset is stale
+type Reason string
+
+const (
+	// ReasonNone is the reason of a dataset that isn't stale
+	ReasonNone = Reason("")
+	// ReasonOverdue means the dataset is stale, but the latest run didn't
+	// fail or find the source unchanged
+	ReasonOverdue = Reason("overdue")
+	// ReasonRunFailed means the latest workflow run failed
+	ReasonRunFailed = Reason("workflow failed")
+	// ReasonUnchanged means the latest workflow run found no changes in the
+	// source data
+	ReasonUnchanged = Reason("source unchanged")
+	// ReasonAutomationOff means the dataset workflow isn't deployed, so no
+	// runs are triggered
+	ReasonAutomationOff = Reason("automation off")
+)
+
+// Status is the result of checking a dataset against its SLA
+type Status struct {
+	InitID     string             `json:"initID"`
+	WorkflowID string             `json:"workflowID"`
+	Username   string             `json:"username,omitempty"`
+	Name       string             `json:"name,omitempty"`
+	CommitTime time.Time          `json:"commitTime,omitempty"`
+	MaxAge     retention.Duration `json:"maxAge"`
+	// Age is the time since the latest commit, in nanoseconds
+	Age       int64  `json:"age"`
+	RunStatus string `json:"runStatus,omitempty"`
+	Stale     bool   `json:"stale"`
+	Reason    Reason `json:"reason,omitempty"`
+}
+
+// Alias returns the human-readable reference of the checked dataset
+func (s Status) Alias() string {
+	if s.Name == "" {
+		return s.InitID
+	}
+	return fmt.Sprintf("%s/%s", s.Username, s.Name)
+}
+
+// Check compares the latest version of a dataset to an SLA. active is the
+// deployed status of the dataset workflow
+func Check(sla SLA, active bool, vi dsref.VersionInfo, now time.Time) Status {
+	s := Status{
+		InitID:     vi.InitID,
+		WorkflowID: vi.WorkflowID,
+		Username:   vi.Username,
+		Name:       vi.Name,
+		CommitTime: vi.CommitTime,
+		MaxAge:     sla.MaxAge,
+		RunStatus:  vi.RunStatus,
+	}
+	if !vi.CommitTime.IsZero() {
+		s.Age = int64(now.Sub(vi.CommitTime))
+	}
+	if !vi.CommitTime.IsZero() && now.Sub(vi.CommitTime) <= time.Duration(sla.MaxAge) {
+		return s
+	}
+
+	s.Stale = true
+	switch {
+	case !active:
+		s.Reason = ReasonAutomationOff
+	case vi.RunStatus == "failed":
+		s.Reason = ReasonRunFailed
+	case vi.RunStatus == "unchanged":
+		s.Reason = ReasonUnchanged
+	default:
+		s.Reason = ReasonOverdue
+	}
+	return s
+}
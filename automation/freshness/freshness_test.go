@@ -0,0 +1,59 @@
+package freshness
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/qri/automation/retention"
+	"github.com/qri-io/qri/dsref"
+)
+
+func TestCheck(t *testing.T) {
+	now := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+	sla := SLA{MaxAge: retention.Day}
+
+	cases := []struct {
+		description string
+		active      bool
+		vi          dsref.VersionInfo
+		stale       bool
+		reason      Reason
+	}{
+		{"recent commit", true, dsref.VersionInfo{CommitTime: now.Add(-time.Hour), RunStatus: "failed"}, false, ReasonNone},
+		{"commit at max age", true, dsref.VersionInfo{CommitTime: now.Add(-24 * time.Hour)}, false, ReasonNone},
+		{"overdue", true, dsref.VersionInfo{CommitTime: now.Add(-25 * time.Hour), RunStatus: "succeeded"}, true, ReasonOverdue},
+		{"failed run", true, dsref.VersionInfo{CommitTime: now.Add(-25 * time.Hour), RunStatus: "failed"}, true, ReasonRunFailed},
+		{"unchanged source", true, dsref.VersionInfo{CommitTime: now.Add(-25 * time.Hour), RunStatus: "unchanged"}, true, ReasonUnchanged},
+		{"automation off", false, dsref.VersionInfo{CommitTime: now.Add(-25 * time.Hour), RunStatus: "failed"}, true, ReasonAutomationOff},
+		{"no versions", true, dsref.VersionInfo{}, true, ReasonOverdue},
+	}
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			got := Check(sla, c.active, c.vi, now)
+			if got.Stale != c.stale {
+				t.Errorf("stale mismatch. want %t, got %t", c.stale, got.Stale)
+			}
+			if got.Reason != c.reason {
+				t.Errorf("reason mismatch. want %q, got %q", c.reason, got.Reason)
+			}
+		})
+	}
+}
+
+func TestSLAJSON(t *testing.T) {
+	sla := &SLA{}
+	if err := json.Unmarshal([]byte(`{"maxAge":"30h"}`), sla); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&SLA{MaxAge: retention.Duration(30 * time.Hour)}, sla); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+	if err := sla.Validate(); err != nil {
+		t.Errorf("expected valid SLA, got: %s", err)
+	}
+	if err := (&SLA{}).Validate(); err == nil {
+		t.Error("expected SLA without a max age to be invalid")
+	}
+}
@@ -29,3 +29,32 @@ type Hook interface {
 	// the payload that should be emitted along with the event
 	Event() (event.Type, interface{})
 }
+
+// New constructs a Hook from a configuration object, like the hooks of a
+// workflow
+func New(cfg map[string]interface{}) (Hook, error) {
+	switch cfg["type"] {
+	case RuntimeType:
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return nil, err
+		}
+		rh := &RuntimeHook{}
+		if err := rh.UnmarshalJSON(data); err != nil {
+			return nil, err
+		}
+		return rh, nil
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnexpectedType, cfg["type"])
+}
+
+// ToMap converts a Hook to a configuration object
+func ToMap(h Hook) (map[string]interface{}, error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	cfg := map[string]interface{}{}
+	err = json.Unmarshal(data, &cfg)
+	return cfg, err
+}
@@ -1,6 +1,7 @@
 package hook_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/qri-io/qri/automation/hook"
@@ -11,3 +12,27 @@ func TestRuntimeHook(t *testing.T) {
 	rh := hook.NewRuntimeHook("testing payload")
 	spec.AssertHook(t, rh)
 }
+
+func TestNew(t *testing.T) {
+	rh := hook.NewRuntimeHook("testing payload")
+	rh.Advance()
+	cfg, err := hook.ToMap(rh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := hook.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := h.(*hook.RuntimeHook)
+	if !ok {
+		t.Fatalf("expected a *hook.RuntimeHook, got %T", h)
+	}
+	if !got.Enabled() || got.AdvanceCount != 1 {
+		t.Errorf("hook mismatch. enabled: %t, advance count: %d", got.Enabled(), got.AdvanceCount)
+	}
+
+	if _, err := hook.New(map[string]interface{}{"type": "unknown"}); !errors.Is(err, hook.ErrUnexpectedType) {
+		t.Errorf("expected ErrUnexpectedType, got: %v", err)
+	}
+}
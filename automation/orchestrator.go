@@ -5,17 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	golog "github.com/ipfs/go-log"
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/automation/freshness"
+	"github.com/qri-io/qri/automation/hook"
 	"github.com/qri-io/qri/automation/run"
 	"github.com/qri-io/qri/automation/trigger"
 	"github.com/qri-io/qri/automation/workflow"
 	"github.com/qri-io/qri/base/dsfs"
 	"github.com/qri-io/qri/base/params"
+	"github.com/qri-io/qri/dsref"
 	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/profile"
 )
 
 var (
@@ -29,11 +34,25 @@ var NowFunc = func() *time.Time {
 	return &now
 }
 
+// DefaultRetentionInterval is the default period between passes that enforce
+// workflow retention policies
+const DefaultRetentionInterval = time.Hour
+
+// DefaultFreshnessInterval is the default period between checks of workflow
+// freshness SLAs
+const DefaultFreshnessInterval = 10 * time.Minute
+
 // OrchestratorOptions encapsulate runtime configuration for NewOrchestrator
 type OrchestratorOptions struct {
 	WorkflowStore workflow.Store
 	Listeners     []trigger.Listener
 	RunStore      run.Store
+	// RetentionInterval sets how often retention policies are enforced.
+	// Defaults to DefaultRetentionInterval
+	RetentionInterval time.Duration
+	// FreshnessInterval sets how often freshness SLAs are checked. Defaults
+	// to DefaultFreshnessInterval
+	FreshnessInterval time.Duration
 }
 
 // WorkflowRunner is for running workflows using some execution engine
@@ -44,11 +63,39 @@ type WorkflowRunner interface {
 	RunAndCommit(ctx context.Context, runID string, wf *workflow.Workflow, streams ioes.IOStreams, params WorkflowRunParams) error
 }
 
+// VersionPruner removes the versions of a workflow's dataset that the
+// workflow retention policy doesn't keep. When the WorkflowRunner passed to
+// NewOrchestrator is also a VersionPruner, the orchestrator enforces
+// retention policies in the background
+type VersionPruner interface {
+	PruneVersions(ctx context.Context, wf *workflow.Workflow) (removed int, err error)
+}
+
+// VersionInfoSource gets the latest version of a workflow's dataset. When the
+// WorkflowRunner passed to NewOrchestrator is also a VersionInfoSource, the
+// orchestrator checks freshness SLAs in the background
+type VersionInfoSource interface {
+	WorkflowVersionInfo(ctx context.Context, wf *workflow.Workflow) (*dsref.VersionInfo, error)
+}
+
 // WorkflowRunParams are additional parameters for a workflow run
 type WorkflowRunParams struct {
 	Secrets      map[string]string
 	OutputWidth  int
 	OutputHeight int
+	// Debug runs the transform with a debugger, pausing at Breakpoints, or
+	// on error when BreakOnError is set
+	Debug        bool
+	Breakpoints  []int
+	BreakOnError bool
+	// DebugPrompt answers each debugger pause with a command. Without a
+	// prompt, debug commands are read from the event bus
+	DebugPrompt func(state event.TransformDebugState) (action string)
+	// NoCache runs every transform step, ignoring cached step results
+	NoCache bool
+	// Params set run parameter values, overriding defaults declared in
+	// transform config
+	Params map[string]string
 }
 
 // Orchestrator manages automation in qri
@@ -58,10 +105,17 @@ type Orchestrator struct {
 	listeners map[string]trigger.Listener
 	runs      run.Store
 	runner    WorkflowRunner
+	pruner    VersionPruner
+	versions  VersionInfoSource
 	bus       event.Bus
 	cancel    context.CancelFunc
 	doneCh    chan struct{}
 	running   bool
+
+	retentionInterval time.Duration
+	freshnessInterval time.Duration
+	staleLk           sync.Mutex
+	stale             map[workflow.ID]bool
 }
 
 // NewOrchestrator constructs an orchestrator
@@ -93,6 +147,22 @@ func NewOrchestrator(ctx context.Context, bus event.Bus, runner WorkflowRunner,
 		workflows: opts.WorkflowStore,
 		runs:      opts.RunStore,
 		runQueue:  NewRunQueue(ctx, bus, 50*time.Millisecond, 1),
+
+		retentionInterval: opts.RetentionInterval,
+		freshnessInterval: opts.FreshnessInterval,
+		stale:             map[workflow.ID]bool{},
+	}
+	if pruner, ok := runner.(VersionPruner); ok {
+		o.pruner = pruner
+	}
+	if versions, ok := runner.(VersionInfoSource); ok {
+		o.versions = versions
+	}
+	if o.retentionInterval == 0 {
+		o.retentionInterval = DefaultRetentionInterval
+	}
+	if o.freshnessInterval == 0 {
+		o.freshnessInterval = DefaultFreshnessInterval
 	}
 
 	for _, l := range opts.Listeners {
@@ -174,6 +244,12 @@ func (o *Orchestrator) Start(ctx context.Context) error {
 	// TODO(ramfox): when hooks and completors are set up, start them here
 	o.running = true
 	o.bus.SubscribeTypes(o.handleTrigger, event.ETAutomationWorkflowTrigger)
+	if o.pruner != nil {
+		go o.enforceRetentionPeriodically(ctx)
+	}
+	if o.versions != nil {
+		go o.checkFreshnessPeriodically(ctx)
+	}
 	return o.startListeners(ctx)
 }
 
@@ -208,6 +284,176 @@ func (o *Orchestrator) handleContextClose(ctx context.Context) {
 	close(o.doneCh)
 }
 
+// enforceRetentionPeriodically calls EnforceRetention once per retention
+// interval until the context is cancelled
+func (o *Orchestrator) enforceRetentionPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(o.retentionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := o.EnforceRetention(ctx); err != nil {
+				log.Debugw("enforcing retention", "error", err)
+			}
+		}
+	}
+}
+
+// EnforceRetention prunes the version history of each dataset whose workflow
+// has a retention policy
+func (o *Orchestrator) EnforceRetention(ctx context.Context) error {
+	if o.pruner == nil {
+		return fmt.Errorf("orchestrator has no version pruner")
+	}
+	wfs, err := o.workflows.List(ctx, "", params.ListAll)
+	if err != nil {
+		return fmt.Errorf("error getting workflows from the store: %w", err)
+	}
+	for _, wf := range wfs {
+		if wf.Retention == nil {
+			continue
+		}
+		removed, err := o.pruner.PruneVersions(ctx, wf)
+		if err != nil {
+			log.Debugw("EnforceRetention: pruning versions", "workflow id", wf.ID, "error", err)
+			continue
+		}
+		if removed == 0 {
+			continue
+		}
+		if err := o.bus.PublishID(ctx, event.ETAutomationVersionsPruned, wf.ID.String(), event.VersionsPrunedEvent{
+			InitID:     wf.InitID,
+			OwnerID:    wf.OwnerID,
+			WorkflowID: wf.WorkflowID(),
+			Removed:    removed,
+		}); err != nil {
+			log.Debug(err)
+		}
+	}
+	return nil
+}
+
+// checkFreshnessPeriodically calls CheckFreshness once per freshness interval
+// until the context is cancelled
+func (o *Orchestrator) checkFreshnessPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(o.freshnessInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := o.CheckFreshness(ctx, ""); err != nil {
+				log.Debugw("checking freshness", "error", err)
+			}
+		}
+	}
+}
+
+// CheckFreshness compares the latest version of each dataset whose workflow
+// has a freshness SLA against the SLA. An empty ownerID checks the workflows
+// of all owners. Datasets that become stale publish an
+// ETAutomationDatasetStale event, and stale datasets that get a new version
+// publish an ETAutomationDatasetFresh event
+func (o *Orchestrator) CheckFreshness(ctx context.Context, ownerID profile.ID) ([]freshness.Status, error) {
+	if o.versions == nil {
+		return nil, fmt.Errorf("orchestrator has no version info source")
+	}
+	wfs, err := o.workflows.List(ctx, ownerID, params.ListAll)
+	if err != nil {
+		return nil, fmt.Errorf("error getting workflows from the store: %w", err)
+	}
+	now := NowFunc()
+	statuses := []freshness.Status{}
+	for _, wf := range wfs {
+		if wf.Freshness == nil {
+			continue
+		}
+		vi, err := o.versions.WorkflowVersionInfo(ctx, wf)
+		if err != nil {
+			log.Debugw("CheckFreshness: getting version info", "workflow id", wf.ID, "error", err)
+			continue
+		}
+		status := freshness.Check(*wf.Freshness, wf.Active, *vi, *now)
+		status.WorkflowID = wf.WorkflowID()
+		statuses = append(statuses, status)
+
+		o.staleLk.Lock()
+		wasStale := o.stale[wf.ID]
+		o.stale[wf.ID] = status.Stale
+		o.staleLk.Unlock()
+		if status.Stale == wasStale {
+			continue
+		}
+		et := event.ETAutomationDatasetFresh
+		if status.Stale {
+			et = event.ETAutomationDatasetStale
+		}
+		pubCtx := profile.AddIDToContext(ctx, wf.OwnerID.Encode())
+		fe := event.FreshnessEvent{
+			InitID:     wf.InitID,
+			OwnerID:    wf.OwnerID,
+			WorkflowID: wf.WorkflowID(),
+			Ref:        status.Alias(),
+			CommitTime: status.CommitTime,
+			MaxAge:     status.MaxAge.String(),
+			Reason:     string(status.Reason),
+		}
+		if err := o.bus.PublishID(pubCtx, et, wf.ID.String(), fe); err != nil {
+			log.Debug(err)
+		}
+		if status.Stale && len(wf.Hooks) > 0 {
+			if hooked, changed := o.deliverHooks(pubCtx, wf, et, fe); changed {
+				if _, err := o.workflows.Put(ctx, hooked); err != nil {
+					log.Debugw("CheckFreshness: saving workflow hooks", "workflow id", wf.ID, "error", err)
+				}
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// deliverHooks publishes the event of each enabled hook on a workflow, in
+// response to an event about the workflow. Hooks advance each time they're
+// delivered, deliverHooks returns a copy of the workflow with advanced hooks
+func (o *Orchestrator) deliverHooks(ctx context.Context, wf *workflow.Workflow, trigger event.Type, payload interface{}) (w *workflow.Workflow, changed bool) {
+	w = wf.Copy()
+	w.Hooks = append([]map[string]interface{}(nil), wf.Hooks...)
+	for i, cfg := range wf.Hooks {
+		h, err := hook.New(cfg)
+		if err != nil {
+			log.Debugw("deliverHooks: constructing hook", "workflow id", wf.ID, "error", err)
+			continue
+		}
+		if !h.Enabled() {
+			continue
+		}
+		et, hookPayload := h.Event()
+		if err := o.bus.PublishID(ctx, et, wf.ID.String(), event.HookEvent{
+			WorkflowID: wf.WorkflowID(),
+			OwnerID:    wf.OwnerID,
+			Trigger:    trigger,
+			Event:      payload,
+			Payload:    hookPayload,
+		}); err != nil {
+			log.Debugw("deliverHooks: publishing hook event", "workflow id", wf.ID, "error", err)
+		}
+		if err := h.Advance(); err != nil {
+			log.Debugw("deliverHooks: advancing hook", "workflow id", wf.ID, "error", err)
+			continue
+		}
+		if w.Hooks[i], err = hook.ToMap(h); err != nil {
+			log.Debugw("deliverHooks: saving hook", "workflow id", wf.ID, "error", err)
+			w.Hooks[i] = cfg
+			continue
+		}
+		changed = true
+	}
+	return w, changed
+}
+
 // startListeners passes a list of deployed Workflows to configured trigger
 // Listeners
 func (o *Orchestrator) startListeners(ctx context.Context) error {
@@ -292,7 +538,7 @@ func (o *Orchestrator) handleTrigger(ctx context.Context, e event.Event) error {
 				log.Debugw("handleTrigger: error saving workflow", "id", wtp.WorkflowID, "err", err)
 			}
 			runID := run.NewID()
-			runFunc := o.runWorkflowFactory(wf, runID)
+			runFunc := o.runWorkflowFactory(wf, runID, WorkflowRunParams{})
 			if err := o.runQueue.Push(ctx, wf.OwnerID.Encode(), runID, "run", runFunc); err != nil {
 
 				log.Debugw("handleTrigger: error queuing workflow", "err", err)
@@ -302,14 +548,14 @@ func (o *Orchestrator) handleTrigger(ctx context.Context, e event.Event) error {
 	return nil
 }
 
-func (o *Orchestrator) runWorkflowFactory(wf *workflow.Workflow, runID string) runQueueFunc {
+func (o *Orchestrator) runWorkflowFactory(wf *workflow.Workflow, runID string, params WorkflowRunParams) runQueueFunc {
 	return func(ctx context.Context) error {
-		return o.runWorkflow(ctx, wf, runID)
+		return o.runWorkflow(ctx, wf, runID, params)
 	}
 }
 
 // RunWorkflow runs the given workflow
-func (o *Orchestrator) RunWorkflow(ctx context.Context, wid workflow.ID, runID string) (string, error) {
+func (o *Orchestrator) RunWorkflow(ctx context.Context, wid workflow.ID, runID string, params WorkflowRunParams) (string, error) {
 	if runID == "" {
 		runID = run.NewID()
 	}
@@ -318,11 +564,67 @@ func (o *Orchestrator) RunWorkflow(ctx context.Context, wid workflow.ID, runID s
 		return "", err
 	}
 
-	runFunc := o.runWorkflowFactory(wf, runID)
+	runFunc := o.runWorkflowFactory(wf, runID, params)
 	return runID, o.runQueue.Push(ctx, wf.OwnerID.Encode(), runID, "run", runFunc)
 }
 
-func (o *Orchestrator) runWorkflow(ctx context.Context, wf *workflow.Workflow, runID string) error {
+// Backfill enqueues one run of a workflow for each set of run parameters.
+// Runs share a group ID, and are recorded as waiting until the run queue
+// starts them
+func (o *Orchestrator) Backfill(ctx context.Context, wid workflow.ID, paramSets []map[string]string) (groupID string, runIDs []string, err error) {
+	if len(paramSets) == 0 {
+		return "", nil, fmt.Errorf("backfill requires at least one set of params")
+	}
+	wf, err := o.GetWorkflow(ctx, wid)
+	if err != nil {
+		return "", nil, err
+	}
+
+	groupID = run.NewID()
+	for _, p := range paramSets {
+		runID := run.NewID()
+		if o.runs != nil {
+			r := &run.State{
+				ID:         runID,
+				WorkflowID: wf.ID,
+				Status:     run.RSWaiting,
+				Params:     p,
+				GroupID:    groupID,
+			}
+			if _, err := o.runs.Create(ctx, r); err != nil {
+				return groupID, runIDs, err
+			}
+		}
+		runFunc := o.runWorkflowFactory(wf, runID, WorkflowRunParams{Params: p})
+		if err := o.runQueue.Push(ctx, wf.OwnerID.Encode(), runID, "run", runFunc); err != nil {
+			return groupID, runIDs, err
+		}
+		runIDs = append(runIDs, runID)
+	}
+	return groupID, runIDs, nil
+}
+
+// GroupRuns lists the runs of a workflow that belong to a group, in the
+// order they were enqueued
+func (o *Orchestrator) GroupRuns(ctx context.Context, wid workflow.ID, groupID string) ([]*run.State, error) {
+	runs, err := o.runs.List(ctx, wid, params.ListAll)
+	if err != nil {
+		return nil, err
+	}
+	group := []*run.State{}
+	// runs are listed newest first
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].GroupID == groupID {
+			group = append(group, runs[i])
+		}
+	}
+	if len(group) == 0 {
+		return nil, fmt.Errorf("%w: no runs in group %q", run.ErrNotFound, groupID)
+	}
+	return group, nil
+}
+
+func (o *Orchestrator) runWorkflow(ctx context.Context, wf *workflow.Workflow, runID string, params WorkflowRunParams) error {
 	wid := wf.ID
 	log.Debugw("runWorkflow, workflow", "id", wid)
 
@@ -338,8 +640,13 @@ func (o *Orchestrator) runWorkflow(ctx context.Context, wf *workflow.Workflow, r
 	}(wf)
 
 	if o.runs != nil {
-		r := &run.State{ID: runID, WorkflowID: wid}
-		if _, err := o.runs.Create(ctx, r); err != nil {
+		// backfills create runs when they're enqueued
+		if _, err := o.runs.Get(ctx, runID); errors.Is(err, run.ErrNotFound) {
+			r := &run.State{ID: runID, WorkflowID: wid, Params: params.Params}
+			if _, err := o.runs.Create(ctx, r); err != nil {
+				return err
+			}
+		} else if err != nil {
 			return err
 		}
 
@@ -352,16 +659,18 @@ func (o *Orchestrator) runWorkflow(ctx context.Context, wf *workflow.Workflow, r
 	// need to replace w/ log collector
 	streams := ioes.NewDiscardIOStreams()
 
-	// TODO(dustmop): Retrieve params from enqueued run, pass them into RunAndCommit
-	err := o.runner.RunAndCommit(ctx, runID, wf, streams, WorkflowRunParams{})
+	err := o.runner.RunAndCommit(ctx, runID, wf, streams, params)
+	runStatus := run.RSFailed
+	if err == nil {
+		runStatus = run.RSSucceeded
+	}
+	if errors.Is(err, dsfs.ErrNoChanges) {
+		runStatus = run.RSUnchanged
+	}
+	if o.runs != nil {
+		o.finishRun(ctx, runID, runStatus, err)
+	}
 	go func(wf *workflow.Workflow) {
-		runStatus := run.RSFailed
-		if err == nil {
-			runStatus = run.RSSucceeded
-		}
-		if errors.Is(err, dsfs.ErrNoChanges) {
-			runStatus = run.RSUnchanged
-		}
 		if err := o.bus.PublishID(ctx, event.ETAutomationWorkflowStopped, wf.ID.String(), event.WorkflowStoppedEvent{
 			InitID:     wf.InitID,
 			OwnerID:    wf.OwnerID,
@@ -378,6 +687,27 @@ func (o *Orchestrator) runWorkflow(ctx context.Context, wf *workflow.Workflow, r
 	return err
 }
 
+// finishRun records the outcome of runs that stopped before a transform
+// started, like runs with invalid params. Transform events set the status of
+// every other run
+func (o *Orchestrator) finishRun(ctx context.Context, runID string, status run.Status, runErr error) {
+	r, err := o.runs.Get(ctx, runID)
+	if err != nil {
+		log.Debugw("finishRun: getting run", "runID", runID, "err", err)
+		return
+	}
+	if r.Status != "" && r.Status != run.RSWaiting {
+		return
+	}
+	r.Status = status
+	if runErr != nil {
+		r.Message = runErr.Error()
+	}
+	if _, err := o.runs.Put(ctx, r); err != nil {
+		log.Debugw("finishRun: updating run", "runID", runID, "err", err)
+	}
+}
+
 // ApplyWorkflow runs the given workflow, but does not record the output
 func (o *Orchestrator) ApplyWorkflow(ctx context.Context, wait bool, scriptOutput io.Writer, wf *workflow.Workflow, ds *dataset.Dataset, params WorkflowRunParams) (string, error) {
 	runID := run.NewID()
@@ -392,6 +722,41 @@ func (o *Orchestrator) ApplyWorkflow(ctx context.Context, wait bool, scriptOutpu
 	return runID, o.runQueue.Push(ctx, wf.OwnerID.Encode(), runID, "apply", runFunc)
 }
 
+// QueueApply runs f on the run queue alongside applied workflows, so it is
+// held to the same worker limits, blocking until f returns. f is canceled if
+// ctx is canceled or the run is canceled
+func (o *Orchestrator) QueueApply(ctx context.Context, ownerID profile.ID, runID string, f func(ctx context.Context) error) error {
+	errs := make(chan error, 1)
+	runFunc := func(runCtx context.Context) error {
+		if err := ctx.Err(); err != nil {
+			errs <- err
+			return err
+		}
+		// keep the values of the caller's context, canceling with either
+		fctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-runCtx.Done():
+				cancel()
+			case <-fctx.Done():
+			}
+		}()
+		err := f(fctx)
+		errs <- err
+		return err
+	}
+	if err := o.runQueue.Push(ctx, ownerID.Encode(), runID, "apply", runFunc); err != nil {
+		return err
+	}
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (o *Orchestrator) applyWorkflow(ctx context.Context, scriptOutput io.Writer, wf *workflow.Workflow, ds *dataset.Dataset, runID string, params WorkflowRunParams) error {
 	log.Debugw("ApplyWorkflow", "workflow id", wf.ID, "run id", runID)
 	if scriptOutput != nil {
@@ -510,11 +875,21 @@ func (o *Orchestrator) RemoveWorkflow(ctx context.Context, id workflow.ID) error
 	return nil
 }
 
+// ListWorkflows lists workflows in the WorkflowStore, newest first
+func (o *Orchestrator) ListWorkflows(ctx context.Context, pid profile.ID, lp params.List) ([]*workflow.Workflow, error) {
+	return o.workflows.List(ctx, pid, lp)
+}
+
 // RunInfo returns the run info for the given runID from the run.Store
 func (o *Orchestrator) RunInfo(ctx context.Context, id string) (*run.State, error) {
 	return o.runs.Get(ctx, id)
 }
 
+// ListRuns lists the runs of a workflow, newest first
+func (o *Orchestrator) ListRuns(ctx context.Context, wid workflow.ID, lp params.List) ([]*run.State, error) {
+	return o.runs.List(ctx, wid, lp)
+}
+
 // runEventsHandler returns a handler that writes run events to a run store
 func runEventsHandler(store run.Store) event.Handler {
 	return func(ctx context.Context, e event.Event) error {
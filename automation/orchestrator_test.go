@@ -2,6 +2,8 @@ package automation
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"testing"
 	"time"
 
@@ -9,9 +11,13 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/automation/freshness"
+	"github.com/qri-io/qri/automation/hook"
+	"github.com/qri-io/qri/automation/retention"
 	"github.com/qri-io/qri/automation/run"
 	"github.com/qri-io/qri/automation/trigger"
 	"github.com/qri-io/qri/automation/workflow"
+	"github.com/qri-io/qri/dsref"
 	"github.com/qri-io/qri/event"
 )
 
@@ -160,7 +166,7 @@ func TestIntegration(t *testing.T) {
 
 	bus.SubscribeTypes(workflowEventsHandler, event.ETAutomationWorkflowStarted, event.ETAutomationWorkflowStopped)
 	done := errOnTimeout(t, workflowStoppedEventFired, "o.RunWorkflow error: timed out before `ETAutomationWorkflowStopped` event fired")
-	_, err = o.RunWorkflow(ctx, got.ID, runID)
+	_, err = o.RunWorkflow(ctx, got.ID, runID, WorkflowRunParams{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -423,12 +429,180 @@ func TestRunStoreEvents(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer o.Stop()
-	if _, err := o.RunWorkflow(ctx, wf.ID, runID); err != nil {
+	if _, err := o.RunWorkflow(ctx, wf.ID, runID, WorkflowRunParams{}); err != nil {
 		t.Fatal(err)
 	}
 	<-transformStopped
 }
 
+func TestEnforceRetention(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := event.NewBus(ctx)
+	workflowStore := workflow.NewMemStore()
+
+	for _, wf := range []*workflow.Workflow{
+		{InitID: "no_policy", OwnerID: "profile_id", Created: NowFunc()},
+		{InitID: "with_policy", OwnerID: "profile_id", Created: NowFunc(), Retention: &retention.Policy{
+			Rules: []retention.Rule{{Within: retention.Week}},
+		}},
+	} {
+		if _, err := workflowStore.Put(ctx, wf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned := make(chan event.VersionsPrunedEvent, 1)
+	bus.SubscribeTypes(func(ctx context.Context, e event.Event) error {
+		select {
+		case pruned <- e.Payload.(event.VersionsPrunedEvent):
+		default:
+		}
+		return nil
+	}, event.ETAutomationVersionsPruned)
+
+	runner := &testVersionPruner{testWorkflowRunner: newTestWorkflowRunner(run.NewMemStore(), nil)}
+	o, err := NewOrchestrator(ctx, bus, runner, OrchestratorOptions{
+		WorkflowStore:     workflowStore,
+		RunStore:          run.NewMemStore(),
+		RetentionInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Stop()
+	if err := o.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-pruned:
+		if e.InitID != "with_policy" || e.Removed != 2 {
+			t.Errorf("unexpected pruned event: %#v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for versions to be pruned")
+	}
+}
+
+func TestCheckFreshness(t *testing.T) {
+	prevNow := NowFunc
+	defer func() {
+		NowFunc = prevNow
+	}()
+	now := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+	NowFunc = func() *time.Time { return &now }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := event.NewBus(ctx)
+	workflowStore := workflow.NewMemStore()
+
+	daily := &freshness.SLA{MaxAge: retention.Day}
+	staleHook, err := hook.ToMap(hook.NewRuntimeHook("page the data team"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, wf := range []*workflow.Workflow{
+		{InitID: "no_sla", OwnerID: "profile_id", Created: NowFunc(), Active: true},
+		{InitID: "fresh", OwnerID: "profile_id", Created: NowFunc(), Active: true, Freshness: daily},
+		{InitID: "failing", OwnerID: "profile_id", Created: NowFunc(), Active: true, Freshness: daily, Hooks: []map[string]interface{}{staleHook}},
+		{InitID: "undeployed", OwnerID: "profile_id", Created: NowFunc(), Freshness: daily},
+	} {
+		if _, err := workflowStore.Put(ctx, wf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner := &testVersionInfoSource{
+		testWorkflowRunner: newTestWorkflowRunner(run.NewMemStore(), nil),
+		versions: map[string]dsref.VersionInfo{
+			"no_sla":     {InitID: "no_sla", CommitTime: now.Add(-72 * time.Hour)},
+			"fresh":      {InitID: "fresh", Username: "me", Name: "fresh", CommitTime: now.Add(-time.Hour), RunStatus: "succeeded"},
+			"failing":    {InitID: "failing", Username: "me", Name: "failing", CommitTime: now.Add(-48 * time.Hour), RunStatus: "failed"},
+			"undeployed": {InitID: "undeployed", Username: "me", Name: "undeployed", CommitTime: now.Add(-48 * time.Hour)},
+		},
+	}
+
+	published := []string{}
+	bus.SubscribeTypes(func(ctx context.Context, e event.Event) error {
+		fe := e.Payload.(event.FreshnessEvent)
+		published = append(published, fmt.Sprintf("%s %s %s", e.Type, fe.Ref, fe.Reason))
+		return nil
+	}, event.ETAutomationDatasetStale, event.ETAutomationDatasetFresh)
+
+	// stale datasets are delivered to the hooks of their workflow
+	delivered := []event.HookEvent{}
+	bus.SubscribeTypes(func(ctx context.Context, e event.Event) error {
+		delivered = append(delivered, e.Payload.(event.HookEvent))
+		return nil
+	}, hook.ETRuntimeHook)
+
+	o, err := NewOrchestrator(ctx, bus, runner, OrchestratorOptions{
+		WorkflowStore: workflowStore,
+		RunStore:      run.NewMemStore(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Stop()
+
+	statuses, err := o.CheckFreshness(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]freshness.Reason{}
+	for _, s := range statuses {
+		got[s.InitID] = s.Reason
+	}
+	expect := map[string]freshness.Reason{
+		"fresh":      freshness.ReasonNone,
+		"failing":    freshness.ReasonRunFailed,
+		"undeployed": freshness.ReasonAutomationOff,
+	}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("status reasons mismatch (-want +got):\n%s", diff)
+	}
+
+	// a new version makes the failing dataset fresh, stale datasets only
+	// publish an event when they become stale
+	runner.versions["failing"] = dsref.VersionInfo{InitID: "failing", Username: "me", Name: "failing", CommitTime: now, RunStatus: "succeeded"}
+	if _, err := o.CheckFreshness(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(published[:2])
+	expectPublished := []string{
+		"automation:DatasetStale me/failing workflow failed",
+		"automation:DatasetStale me/undeployed automation off",
+		"automation:DatasetFresh me/failing ",
+	}
+	if diff := cmp.Diff(expectPublished, published); diff != "" {
+		t.Errorf("published events mismatch (-want +got):\n%s", diff)
+	}
+
+	if len(delivered) != 1 {
+		t.Fatalf("expected one hook delivery, got %d", len(delivered))
+	}
+	if fe, ok := delivered[0].Event.(event.FreshnessEvent); !ok || delivered[0].Trigger != event.ETAutomationDatasetStale || fe.Ref != "me/failing" {
+		t.Errorf("unexpected hook delivery: %#v", delivered[0])
+	}
+	if delivered[0].Payload != "page the data team" {
+		t.Errorf("expected hook payload to be delivered, got: %v", delivered[0].Payload)
+	}
+	wf, err := workflowStore.GetByInitID(ctx, "failing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := hook.New(wf.Hooks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := h.(*hook.RuntimeHook).AdvanceCount; count != 1 {
+		t.Errorf("expected delivered hook to advance once, got %d", count)
+	}
+}
+
 func confirmStoredRun(ctx context.Context, t *testing.T, s run.Store, expect *run.State) {
 	t.Helper()
 	got, err := s.Get(ctx, expect.ID)
@@ -472,6 +646,32 @@ func (r *testWorkflowRunner) RunAndCommit(ctx context.Context, runID string, wf
 	return nil
 }
 
+// a workflow runner that removes two versions from each dataset it prunes
+type testVersionPruner struct {
+	*testWorkflowRunner
+}
+
+func (r *testVersionPruner) PruneVersions(ctx context.Context, wf *workflow.Workflow) (int, error) {
+	if wf.Retention == nil {
+		return 0, fmt.Errorf("workflow %q has no retention policy", wf.ID)
+	}
+	return 2, nil
+}
+
+// a workflow runner that gets version info from a map of init IDs to versions
+type testVersionInfoSource struct {
+	*testWorkflowRunner
+	versions map[string]dsref.VersionInfo
+}
+
+func (r *testVersionInfoSource) WorkflowVersionInfo(ctx context.Context, wf *workflow.Workflow) (*dsref.VersionInfo, error) {
+	vi, ok := r.versions[wf.InitID]
+	if !ok {
+		return nil, fmt.Errorf("no version info for %q", wf.InitID)
+	}
+	return &vi, nil
+}
+
 // a simulated event and run state
 type simulatedRunEvent struct {
 	state   *run.State
@@ -508,3 +708,53 @@ func (r *workflowRunSimulator) RunAndCommit(ctx context.Context, runID string, w
 func (r *workflowRunSimulator) RunEphemeral(ctx context.Context, runID string, wf *workflow.Workflow, ds *dataset.Dataset, wait bool, params WorkflowRunParams) error {
 	return nil
 }
+
+func TestQueueApply(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := event.NewBus(ctx)
+
+	pushed := make(chan string, 1)
+	bus.SubscribeTypes(func(ctx context.Context, e event.Event) error {
+		pushed <- *e.Payload.(*string)
+		return nil
+	}, event.ETAutomationApplyQueuePush)
+
+	o, err := NewOrchestrator(ctx, bus, newTestWorkflowRunner(run.NewMemStore(), nil), OrchestratorOptions{
+		WorkflowStore: workflow.NewMemStore(),
+		RunStore:      run.NewMemStore(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Stop()
+
+	errBoom := fmt.Errorf("boom")
+	if err := o.QueueApply(ctx, "profile_id", "run_id", func(ctx context.Context) error {
+		return errBoom
+	}); err != errBoom {
+		t.Errorf("expected QueueApply to return the error of the queued func, got: %v", err)
+	}
+	select {
+	case runID := <-pushed:
+		if runID != "run_id" {
+			t.Errorf("expected run_id to be pushed to the apply queue, got %q", runID)
+		}
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for apply queue push event")
+	}
+
+	canceled, cancelRun := context.WithCancel(ctx)
+	cancelRun()
+	called := false
+	if err := o.QueueApply(canceled, "profile_id", "canceled_run", func(ctx context.Context) error {
+		called = true
+		return nil
+	}); err != context.Canceled {
+		t.Errorf("expected a canceled context to return context.Canceled, got: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if called {
+		t.Error("expected a canceled context to skip the queued func")
+	}
+}
@@ -0,0 +1,230 @@
+// Package retention defines policies for thinning out the version history of
+// a dataset over time
+package retention
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Day is a 24 hour duration
+	Day = Duration(24 * time.Hour)
+	// Week is seven days
+	Week = 7 * Day
+	// Month is a 30 day duration
+	Month = 30 * Day
+	// Year is a 365 day duration
+	Year = 365 * Day
+)
+
+// Policy describes which versions of a dataset's history to keep. Rules are
+// checked in order, the first rule that covers the age of a version decides
+// if it's kept. Versions no rule covers are dropped. The latest version is
+// always kept. A policy that keeps all versions for 7 days, then one per day
+// for 90 days, then one per month forever looks like:
+//
+//	{"rules": [
+//	  {"within": "7d"},
+//	  {"within": "90d", "every": "1d"},
+//	  {"every": "1mo"}
+//	]}
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule keeps versions younger than a maximum age
+type Rule struct {
+	// Within is the maximum age of a version this rule covers. The zero value
+	// covers versions of any age
+	Within Duration `json:"within,omitempty"`
+	// Every keeps at most one version per interval, preferring the latest
+	// version in each interval. The zero value keeps all versions
+	Every Duration `json:"every,omitempty"`
+}
+
+// ParsePolicy parses a policy from a comma-separated list of rules. Each rule
+// is a maximum age, optionally followed by a slash and the interval to keep
+// one version per. "forever" is a rule with no maximum age. The policy in the
+// Policy example is written as:
+//
+//	7d,90d/1d,forever/1mo
+func ParsePolicy(s string) (*Policy, error) {
+	p := &Policy{}
+	for _, str := range strings.Split(s, ",") {
+		str = strings.TrimSpace(str)
+		within, every := str, ""
+		hasEvery := false
+		if i := strings.Index(str, "/"); i != -1 {
+			within, every, hasEvery = str[:i], str[i+1:], true
+		}
+
+		r := Rule{}
+		var err error
+		if within != "forever" {
+			if r.Within, err = ParseDuration(within); err != nil {
+				return nil, fmt.Errorf("retention policy: %w", err)
+			}
+		}
+		if hasEvery {
+			if r.Every, err = ParseDuration(every); err != nil {
+				return nil, fmt.Errorf("retention policy: %w", err)
+			}
+		}
+		p.Rules = append(p.Rules, r)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// String formats the policy in the syntax ParsePolicy reads
+func (p *Policy) String() string {
+	if p == nil {
+		return ""
+	}
+	rules := make([]string, len(p.Rules))
+	for i, r := range p.Rules {
+		rules[i] = "forever"
+		if r.Within != 0 {
+			rules[i] = r.Within.String()
+		}
+		if r.Every != 0 {
+			rules[i] += "/" + r.Every.String()
+		}
+	}
+	return strings.Join(rules, ",")
+}
+
+// Validate errors if the policy is not valid
+func (p *Policy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if len(p.Rules) == 0 {
+		return fmt.Errorf("retention policy: at least one rule is required")
+	}
+	var prev Duration
+	for i, r := range p.Rules {
+		if r.Within < 0 || r.Every < 0 {
+			return fmt.Errorf("retention policy: rule %d: durations cannot be negative", i)
+		}
+		if r.Within == 0 && i != len(p.Rules)-1 {
+			return fmt.Errorf("retention policy: rule %d: only the last rule can omit \"within\"", i)
+		}
+		if r.Within != 0 && r.Within <= prev {
+			return fmt.Errorf("retention policy: rule %d: \"within\" must be longer than the rule before it", i)
+		}
+		prev = r.Within
+	}
+	return nil
+}
+
+// Keep decides which versions of a history to keep. times are commit
+// timestamps of the history, ordered newest to oldest. The returned slice is
+// the same length as times, with true for each version to keep
+func (p *Policy) Keep(times []time.Time, now time.Time) []bool {
+	keep := make([]bool, len(times))
+	if p == nil {
+		for i := range keep {
+			keep[i] = true
+		}
+		return keep
+	}
+
+	type bucket struct {
+		rule int
+		n    int64
+	}
+	seen := map[bucket]bool{}
+
+	for i, t := range times {
+		if i == 0 {
+			keep[i] = true
+		}
+		age := now.Sub(t)
+		for j, r := range p.Rules {
+			if r.Within != 0 && age >= time.Duration(r.Within) {
+				continue
+			}
+			if r.Every == 0 {
+				keep[i] = true
+				break
+			}
+			b := bucket{rule: j, n: t.UnixNano() / int64(r.Every)}
+			if !seen[b] {
+				seen[b] = true
+				keep[i] = true
+			}
+			break
+		}
+	}
+	return keep
+}
+
+// Duration is a time.Duration that encodes as a human-readable string.
+// In addition to the units understood by time.ParseDuration, Duration
+// accepts d (day), w (week), mo (month) and y (year) units
+type Duration time.Duration
+
+// ParseDuration parses a duration string, eg: "36h", "7d", "1mo"
+func ParseDuration(s string) (Duration, error) {
+	for _, u := range []struct {
+		suffix string
+		unit   Duration
+	}{
+		{"mo", Month},
+		{"d", Day},
+		{"w", Week},
+		{"y", Year},
+	} {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return Duration(n * float64(u.unit)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return Duration(d), nil
+}
+
+// String formats whole years & days with y & d units, falling back to
+// time.Duration formatting
+func (d Duration) String() string {
+	if d != 0 && d%Year == 0 {
+		return fmt.Sprintf("%dy", d/Year)
+	}
+	if d != 0 && d%Day == 0 {
+		return fmt.Sprintf("%dd", d/Day)
+	}
+	return time.Duration(d).String()
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,124 @@
+package retention
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPolicyKeep(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	hours := func(hs ...int) []time.Time {
+		times := make([]time.Time, len(hs))
+		for i, h := range hs {
+			times[i] = now.Add(-time.Duration(h) * time.Hour)
+		}
+		return times
+	}
+
+	policy := &Policy{Rules: []Rule{
+		{Within: 7 * Day},
+		{Within: 90 * Day, Every: Day},
+		{Every: Month},
+	}}
+
+	cases := []struct {
+		description string
+		policy      *Policy
+		times       []time.Time
+		expect      []bool
+	}{
+		{"nil policy keeps everything", nil, hours(1, 2, 3), []bool{true, true, true}},
+		{"recent versions are kept", policy, hours(1, 2, 3, 24*6), []bool{true, true, true, true}},
+		{"one version per day after a week",
+			policy,
+			hours(1, 24*8, 24*8+1, 24*8+2, 24*10),
+			[]bool{true, true, false, false, true},
+		},
+		{"latest version is always kept",
+			&Policy{Rules: []Rule{{Within: Day}}},
+			hours(48, 72),
+			[]bool{true, false},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			got := c.policy.Keep(c.times, now)
+			if diff := cmp.Diff(c.expect, got); diff != "" {
+				t.Errorf("result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	bad := []*Policy{
+		{},
+		{Rules: []Rule{{Within: -Day}}},
+		{Rules: []Rule{{}, {Within: Day}}},
+		{Rules: []Rule{{Within: Week}, {Within: Day}}},
+	}
+	for i, p := range bad {
+		if err := p.Validate(); err == nil {
+			t.Errorf("case %d: expected error, got nil", i)
+		}
+	}
+
+	good := &Policy{Rules: []Rule{{Within: Week}, {Within: 90 * Day, Every: Day}, {Every: Month}}}
+	if err := good.Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	data := []byte(`{"rules":[{"within":"7d"},{"within":"90d","every":"1d"},{"every":"1mo"},{"within":"36h"}]}`)
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		t.Fatal(err)
+	}
+	expect := &Policy{Rules: []Rule{
+		{Within: Week},
+		{Within: 90 * Day, Every: Day},
+		{Every: Month},
+		{Within: Duration(36 * time.Hour)},
+	}}
+	if diff := cmp.Diff(expect, p); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStr := `{"rules":[{"within":"7d"},{"within":"90d","every":"1d"},{"every":"30d"},{"within":"36h0m0s"}]}`
+	if string(got) != expectStr {
+		t.Errorf("encoding mismatch.\nwant: %s\ngot:  %s", expectStr, got)
+	}
+
+	if _, err := ParseDuration("seven days"); err == nil {
+		t.Error("expected error parsing invalid duration")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("7d, 90d/1d, forever/1mo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &Policy{Rules: []Rule{{Within: Week}, {Within: 90 * Day, Every: Day}, {Every: Month}}}
+	if diff := cmp.Diff(expect, p); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+	if got := p.String(); got != "7d,90d/1d,forever/30d" {
+		t.Errorf("string mismatch, got: %q", got)
+	}
+
+	for _, bad := range []string{"", "7d/", "forever,7d", "week"} {
+		if _, err := ParsePolicy(bad); err == nil {
+			t.Errorf("%q: expected error, got nil", bad)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package run
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/event"
+)
+
+// LogEventTypes are the transform events that make up the log of a run
+var LogEventTypes = []event.Type{
+	event.ETTransformStart,
+	event.ETTransformStop,
+	event.ETTransformStepStart,
+	event.ETTransformStepStop,
+	event.ETTransformStepSkip,
+	event.ETTransformPrint,
+	event.ETTransformError,
+}
+
+// IsLogEvent reports if an event type is part of the log of a run
+func IsLogEvent(t event.Type) bool {
+	for _, lt := range LogEventTypes {
+		if t == lt {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeEventPayload decodes the JSON payload of a transform event into the
+// payload type the event carries on the bus
+func DecodeEventPayload(t event.Type, data json.RawMessage) (interface{}, error) {
+	switch t {
+	case event.ETTransformStart, event.ETTransformStop:
+		p := event.TransformLifecycle{}
+		err := json.Unmarshal(data, &p)
+		return p, err
+	case event.ETTransformStepStart, event.ETTransformStepStop, event.ETTransformStepSkip:
+		p := event.TransformStepLifecycle{}
+		err := json.Unmarshal(data, &p)
+		return p, err
+	case event.ETTransformPrint, event.ETTransformError:
+		p := event.TransformMessage{}
+		err := json.Unmarshal(data, &p)
+		return p, err
+	case event.ETTransformDatasetPreview:
+		p := &dataset.Dataset{}
+		err := json.Unmarshal(data, p)
+		return p, err
+	}
+	var p interface{}
+	err := json.Unmarshal(data, &p)
+	return p, err
+}
+
+// Events reconstructs the log events of a run from recorded state, in the
+// order they occurred. Runs record step lifecycle & step output, so events
+// replayed from a run in progress end with the latest recorded event
+func (rs *State) Events() []event.Event {
+	evts := []event.Event{}
+	add := func(t event.Type, ts *time.Time, payload interface{}) {
+		e := event.Event{Type: t, SessionID: rs.ID, Payload: payload}
+		if ts != nil {
+			e.Timestamp = ts.UnixNano()
+		}
+		evts = append(evts, e)
+	}
+
+	if rs.StartTime == nil {
+		return evts
+	}
+	add(event.ETTransformStart, rs.StartTime, event.TransformLifecycle{RunID: rs.ID})
+
+	for _, s := range rs.Steps {
+		lifecycle := event.TransformStepLifecycle{
+			Name:     s.Name,
+			Category: s.Category,
+			Status:   string(s.Status),
+			Cached:   s.Cached,
+		}
+		if s.Status == RSSkipped {
+			add(event.ETTransformStepSkip, s.StartTime, lifecycle)
+			continue
+		}
+		start := lifecycle
+		start.Status = ""
+		start.Cached = false
+		add(event.ETTransformStepStart, s.StartTime, start)
+		evts = append(evts, s.Output...)
+		if s.StopTime != nil {
+			add(event.ETTransformStepStop, s.StopTime, lifecycle)
+		}
+	}
+
+	if rs.StopTime != nil {
+		add(event.ETTransformStop, rs.StopTime, event.TransformLifecycle{
+			RunID:  rs.ID,
+			Status: string(rs.Status),
+		})
+	}
+	return evts
+}
+
+// Finished reports if a run has stopped
+func (rs *State) Finished() bool {
+	switch rs.Status {
+	case RSSucceeded, RSFailed, RSUnchanged, RSSkipped:
+		return true
+	}
+	return false
+}
@@ -10,7 +10,6 @@ import (
 
 	"github.com/google/uuid"
 	golog "github.com/ipfs/go-log"
-	"github.com/qri-io/dataset"
 	"github.com/qri-io/qri/automation/workflow"
 	"github.com/qri-io/qri/event"
 )
@@ -76,6 +75,10 @@ type State struct {
 	StopTime   *time.Time   `json:"stopTime"`
 	Duration   int64        `json:"duration"`
 	Steps      []*StepState `json:"steps"`
+	// Params are the run parameter values set for this run
+	Params map[string]string `json:"params,omitempty"`
+	// GroupID identifies a set of runs enqueued together, like a backfill
+	GroupID string `json:"groupID,omitempty"`
 }
 
 // NewState returns a new *State with the given runID
@@ -109,6 +112,8 @@ func (rs *State) Copy() *State {
 		StopTime:   rs.StopTime,
 		Duration:   rs.Duration,
 		Steps:      rs.Steps,
+		Params:     rs.Params,
+		GroupID:    rs.GroupID,
 	}
 	return run
 }
@@ -151,6 +156,7 @@ func (rs *State) AddTransformEvent(e event.Event) error {
 		step.StopTime = toTimePointer(e.Timestamp)
 		if tsl, ok := e.Payload.(event.TransformStepLifecycle); ok {
 			step.Status = Status(tsl.Status)
+			step.Cached = tsl.Cached
 		} else {
 			step.Status = RSFailed
 		}
@@ -202,6 +208,8 @@ type StepState struct {
 	StopTime  *time.Time    `json:"stopTime"`
 	Duration  int64         `json:"duration"`
 	Output    []event.Event `json:"output"`
+	// Cached is true when the step results were restored from the step cache
+	Cached bool `json:"cached,omitempty"`
 }
 
 // Copy returns a shallow copy of the receiver
@@ -214,6 +222,7 @@ func (ss *StepState) Copy() *StepState {
 		StopTime:  ss.StopTime,
 		Duration:  ss.Duration,
 		Output:    ss.Output,
+		Cached:    ss.Cached,
 	}
 }
 
@@ -237,6 +246,7 @@ type _stepState struct {
 	StopTime  *time.Time `json:"stopTime"`
 	Duration  int64      `json:"duration"`
 	Output    []_event   `json:"output"`
+	Cached    bool       `json:"cached,omitempty"`
 }
 
 type _event struct {
@@ -259,41 +269,18 @@ func (ss *StepState) UnmarshalJSON(data []byte) error {
 	tmpSS.StartTime = rs.StartTime
 	tmpSS.StopTime = rs.StopTime
 	tmpSS.Duration = rs.Duration
+	tmpSS.Cached = rs.Cached
 	for _, re := range rs.Output {
 		e := event.Event{
 			Type:      re.Type,
 			Timestamp: re.Timestamp,
 			SessionID: re.SessionID,
 		}
-		switch e.Type {
-		case event.ETTransformStart, event.ETTransformStop:
-			p := event.TransformLifecycle{}
-			if err := json.Unmarshal(re.Payload, &p); err != nil {
-				return err
-			}
-			e.Payload = p
-		case event.ETTransformStepStart, event.ETTransformStepStop, event.ETTransformStepSkip:
-			p := event.TransformStepLifecycle{}
-			if err := json.Unmarshal(re.Payload, &p); err != nil {
-				return err
-			}
-			e.Payload = p
-		case event.ETTransformPrint, event.ETTransformError:
-			p := event.TransformMessage{}
-			if err := json.Unmarshal(re.Payload, &p); err != nil {
-				return err
-			}
-			e.Payload = p
-		case event.ETTransformDatasetPreview:
-			e.Payload = &dataset.Dataset{}
-			if err := json.Unmarshal(re.Payload, e.Payload); err != nil {
-				return err
-			}
-		default:
-			if err := json.Unmarshal(re.Payload, e.Payload); err != nil {
-				return err
-			}
+		p, err := DecodeEventPayload(e.Type, re.Payload)
+		if err != nil {
+			return err
 		}
+		e.Payload = p
 		tmpSS.Output = append(tmpSS.Output, e)
 	}
 	*ss = *tmpSS
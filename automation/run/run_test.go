@@ -170,3 +170,60 @@ func TestRunStateMarshaling(t *testing.T) {
 		})
 	}
 }
+
+func TestStateEvents(t *testing.T) {
+	runID := NewID()
+	states := getStates(runID)
+	rs := states[len(states)-1].r
+
+	got := rs.Events()
+	expect := []event.Event{
+		{Type: event.ETTransformStart, Timestamp: 1609460600090, SessionID: runID, Payload: event.TransformLifecycle{RunID: runID}},
+		{Type: event.ETTransformStepStart, Timestamp: 1609460700090, SessionID: runID, Payload: event.TransformStepLifecycle{Name: "setup"}},
+		{Type: event.ETTransformStepStop, Timestamp: 1609460900090, SessionID: runID, Payload: event.TransformStepLifecycle{Name: "setup", Status: "succeeded"}},
+		{Type: event.ETTransformStepStart, Timestamp: 1609461000090, SessionID: runID, Payload: event.TransformStepLifecycle{Name: "download"}},
+		{Type: event.ETTransformPrint, Timestamp: 1609461100090, SessionID: runID, Payload: event.TransformMessage{Msg: "oh hai there"}},
+		{Type: event.ETTransformStepStop, Timestamp: 1609461400090, SessionID: runID, Payload: event.TransformStepLifecycle{Name: "download", Status: "succeeded"}},
+		{Type: event.ETTransformStepStart, Timestamp: 1609461500090, SessionID: runID, Payload: event.TransformStepLifecycle{Name: "transform"}},
+		{Type: event.ETTransformStepStop, Timestamp: 1609461600090, SessionID: runID, Payload: event.TransformStepLifecycle{Name: "transform", Status: "succeeded"}},
+		{Type: event.ETTransformStop, Timestamp: 1609461900090, SessionID: runID, Payload: event.TransformLifecycle{RunID: runID, Status: "failed"}},
+	}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+	if !rs.Finished() {
+		t.Errorf("expected run to be finished")
+	}
+
+	// replaying a run in progress ends with the latest recorded event
+	running := states[4].r
+	got = running.Events()
+	if diff := cmp.Diff(expect[:5], got); diff != "" {
+		t.Errorf("in progress events mismatch (-want +got):\n%s", diff)
+	}
+	if running.Finished() {
+		t.Errorf("expected run in progress not to be finished")
+	}
+}
+
+func TestDecodeEventPayload(t *testing.T) {
+	got, err := DecodeEventPayload(event.ETTransformPrint, json.RawMessage(`{"msg":"hello"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(event.TransformMessage{Msg: "hello"}, got); diff != "" {
+		t.Errorf("print payload mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err = DecodeEventPayload(event.ETTransformStepStop, json.RawMessage(`{"name":"setup","status":"succeeded"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(event.TransformStepLifecycle{Name: "setup", Status: "succeeded"}, got); diff != "" {
+		t.Errorf("step payload mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := DecodeEventPayload(event.ETTransformStart, json.RawMessage(`[`)); err == nil {
+		t.Error("expected error decoding invalid json")
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/google/uuid"
 	golog "github.com/ipfs/go-log"
+	"github.com/qri-io/qri/automation/freshness"
+	"github.com/qri-io/qri/automation/retention"
 	"github.com/qri-io/qri/profile"
 )
 
@@ -58,6 +60,11 @@ type Workflow struct {
 	Active   bool                     `json:"active"`
 	Triggers []map[string]interface{} `json:"triggers"`
 	Hooks    []map[string]interface{} `json:"hooks"`
+	// Retention optionally limits the version history of the dataset
+	Retention *retention.Policy `json:"retention,omitempty"`
+	// Freshness optionally sets how often the dataset is expected to get a new
+	// version
+	Freshness *freshness.SLA `json:"freshness,omitempty"`
 }
 
 // Validate errors if the workflow is not valid
@@ -77,7 +84,10 @@ func (w *Workflow) Validate() error {
 	if w.Created == nil {
 		return ErrNilCreated
 	}
-	return nil
+	if err := w.Retention.Validate(); err != nil {
+		return err
+	}
+	return w.Freshness.Validate()
 }
 
 // Copy returns a shallow copy of the receiver
@@ -86,13 +96,15 @@ func (w *Workflow) Copy() *Workflow {
 		return nil
 	}
 	workflow := &Workflow{
-		ID:       w.ID,
-		InitID:   w.InitID,
-		OwnerID:  w.OwnerID,
-		Created:  w.Created,
-		Active:   w.Active,
-		Triggers: w.Triggers,
-		Hooks:    w.Hooks,
+		ID:        w.ID,
+		InitID:    w.InitID,
+		OwnerID:   w.OwnerID,
+		Created:   w.Created,
+		Active:    w.Active,
+		Triggers:  w.Triggers,
+		Hooks:     w.Hooks,
+		Retention: w.Retention,
+		Freshness: w.Freshness,
 	}
 	return workflow
 }
@@ -0,0 +1,333 @@
+package base
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+	"github.com/qri-io/dataset/tabular"
+	"github.com/qri-io/qri/base/dsfs"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/repo"
+)
+
+// BlameOptions configures how far back blame walks a dataset's history, and
+// how rows are matched between versions
+type BlameOptions struct {
+	// Key is the column or field that identifies a row across versions. When
+	// empty rows are identified by key for object bodies, index otherwise
+	Key string
+	// Cells reports the version that last changed each cell of a row
+	Cells bool
+	// Since skips versions committed before this time
+	Since time.Time
+	// Limit is the maximum number of versions to walk, values < 1 walk the
+	// entire history
+	Limit int
+}
+
+// BlameVersion describes the version that last changed a row or cell
+type BlameVersion struct {
+	Path        string    `json:"path"`
+	Author      string    `json:"author,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	RunID       string    `json:"runID,omitempty"`
+	CommitTitle string    `json:"commitTitle,omitempty"`
+}
+
+// RowBlame reports the version that last changed a row of a dataset body
+type RowBlame struct {
+	// Key identifies the row, either the value of the key column, the object
+	// key, or the row index
+	Key     string       `json:"key"`
+	Version BlameVersion `json:"version"`
+	// Bounded is true when the row didn't change in any version blame walked.
+	// When history was cut short by Since or Limit, an older version may
+	// have last changed the row
+	Bounded bool        `json:"bounded,omitempty"`
+	Cells   []CellBlame `json:"cells,omitempty"`
+}
+
+// CellBlame reports the version that last changed a single cell of a row
+type CellBlame struct {
+	Column  string       `json:"column"`
+	Version BlameVersion `json:"version"`
+	Bounded bool         `json:"bounded,omitempty"`
+}
+
+// blameRow tracks a row across versions by hash, keeping only the index of
+// the version that last changed it, so memory is bounded by the size of a
+// single version
+type blameRow struct {
+	hash    uint64
+	version int
+	// cell state, in column order
+	cols  []string
+	cells map[string]*blameCell
+}
+
+type blameCell struct {
+	hash    uint64
+	version int
+}
+
+// Blame walks the history of a dataset oldest to newest, diffing bodies of
+// adjacent versions, and calls emit with the version that last changed each
+// row in the version ref points to. ref must be resolved. Rows are emitted in
+// body order. Versions that aren't stored locally end the walk
+func Blame(ctx context.Context, r repo.Repo, ref dsref.Ref, opts BlameOptions, emit func(RowBlame) error) error {
+	items, err := DatasetLog(ctx, r, ref, -1, 0, "", false)
+	if err != nil {
+		return err
+	}
+
+	// trim history to the window blame will walk, newest first
+	start := 0
+	if ref.Path != "" {
+		start = -1
+		for i, item := range items {
+			if item.Path == ref.Path {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			return fmt.Errorf("version %s is not in the history of %s", ref.Path, ref.Alias())
+		}
+	}
+	var window []dsref.VersionInfo
+	complete := true
+	for _, item := range items[start:] {
+		if item.Path == "" {
+			continue
+		}
+		if item.Foreign || (opts.Limit > 0 && len(window) == opts.Limit) || (!opts.Since.IsZero() && item.CommitTime.Before(opts.Since)) {
+			complete = false
+			break
+		}
+		window = append(window, item)
+	}
+	if len(window) == 0 {
+		return fmt.Errorf("no stored versions of %s to blame", ref.Alias())
+	}
+
+	versions := make([]BlameVersion, len(window))
+	rows := map[string]*blameRow{}
+	var order []string
+	for i := range window {
+		item := window[len(window)-1-i]
+		ds, err := dsfs.LoadDataset(ctx, r.Filesystem(), item.Path)
+		if err != nil {
+			return fmt.Errorf("loading version %s: %w", item.Path, err)
+		}
+		versions[i] = blameVersion(item, ds)
+
+		next := make(map[string]*blameRow, len(rows))
+		order = order[:0]
+		err = eachBlameRow(ctx, r, ds, opts.Key, func(key string, value interface{}, titles []string) error {
+			if _, dup := next[key]; dup {
+				return fmt.Errorf("version %s has more than one row with key %q", item.Path, key)
+			}
+			order = append(order, key)
+			next[key] = diffBlameRow(rows[key], i, value, titles, opts.Cells)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		rows = next
+	}
+
+	for _, key := range order {
+		row := rows[key]
+		rb := RowBlame{
+			Key:     key,
+			Version: versions[row.version],
+			Bounded: row.version == 0 && !complete,
+		}
+		if opts.Cells {
+			for _, col := range row.cols {
+				c := row.cells[col]
+				rb.Cells = append(rb.Cells, CellBlame{
+					Column:  col,
+					Version: versions[c.version],
+					Bounded: c.version == 0 && !complete,
+				})
+			}
+		}
+		if err := emit(rb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func blameVersion(item dsref.VersionInfo, ds *dataset.Dataset) BlameVersion {
+	v := BlameVersion{
+		Path:      item.Path,
+		Author:    item.Username,
+		Timestamp: item.CommitTime,
+		RunID:     item.RunID,
+	}
+	if ds.Commit != nil {
+		v.CommitTitle = ds.Commit.Title
+		if v.Timestamp.IsZero() {
+			v.Timestamp = ds.Commit.Timestamp
+		}
+		if v.RunID == "" {
+			v.RunID = ds.Commit.RunID
+		}
+		if v.Author == "" && ds.Commit.Author != nil {
+			v.Author = ds.Commit.Author.ID
+		}
+	}
+	return v
+}
+
+// diffBlameRow compares a row to its state in the previous version, returning
+// the row's new state
+func diffBlameRow(prev *blameRow, version int, value interface{}, titles []string, cells bool) *blameRow {
+	row := &blameRow{hash: blameHash(value), version: version}
+	if prev != nil && prev.hash == row.hash {
+		row.version = prev.version
+	}
+	if !cells {
+		return row
+	}
+
+	row.cols, row.cells = nil, map[string]*blameCell{}
+	cols, vals := rowCells(value, titles)
+	for i, col := range cols {
+		c := &blameCell{hash: blameHash(vals[i]), version: version}
+		if prev != nil {
+			if pc, ok := prev.cells[col]; ok && pc.hash == c.hash {
+				c.version = pc.version
+			}
+		}
+		row.cols = append(row.cols, col)
+		row.cells[col] = c
+	}
+	return row
+}
+
+// eachBlameRow streams the rows of a version's body, identifying each row by
+// key. titles are the column names of tabular bodies
+func eachBlameRow(ctx context.Context, r repo.Repo, ds *dataset.Dataset, keyCol string, fn func(key string, value interface{}, titles []string) error) error {
+	if err := ds.OpenBodyFile(ctx, r.Filesystem()); err != nil {
+		return fmt.Errorf("opening body file: %w", err)
+	}
+	file := ds.BodyFile()
+	if file == nil {
+		return nil
+	}
+	defer file.Close()
+
+	rr, err := dsio.NewEntryReader(ds.Structure, file)
+	if err != nil {
+		return fmt.Errorf("reading body: %w", err)
+	}
+
+	// tabular rows are arrays, find the position of the key column
+	var titles []string
+	if ds.Structure != nil {
+		if cols, _, err := tabular.ColumnsFromJSONSchema(ds.Structure.Schema); err == nil {
+			titles = cols.Titles()
+		}
+	}
+	keyIdx := -1
+	for i, title := range titles {
+		if title == keyCol {
+			keyIdx = i
+			break
+		}
+	}
+
+	for {
+		ent, err := rr.ReadEntry()
+		if err != nil {
+			if err.Error() == "EOF" {
+				return nil
+			}
+			return fmt.Errorf("reading body: %w", err)
+		}
+
+		key := ent.Key
+		if key == "" {
+			key = strconv.Itoa(ent.Index)
+		}
+		if keyCol != "" {
+			val, ok := rowKeyValue(ent.Value, keyCol, keyIdx)
+			if !ok {
+				return fmt.Errorf("row %s has no key column %q", key, keyCol)
+			}
+			key = val
+		}
+		if err := fn(key, ent.Value, titles); err != nil {
+			return err
+		}
+	}
+}
+
+// rowKeyValue gets the value of the key column of a row
+func rowKeyValue(row interface{}, keyCol string, keyIdx int) (string, bool) {
+	switch r := row.(type) {
+	case map[string]interface{}:
+		v, ok := r[keyCol]
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprint(v), true
+	case []interface{}:
+		if keyIdx < 0 || keyIdx >= len(r) {
+			return "", false
+		}
+		return fmt.Sprint(r[keyIdx]), true
+	}
+	return "", false
+}
+
+// rowCells breaks a row into named cells. array rows are named by column
+// title, falling back to index. object rows are sorted by field name, scalar
+// rows are a single cell named "value"
+func rowCells(row interface{}, titles []string) (cols []string, vals []interface{}) {
+	switch r := row.(type) {
+	case map[string]interface{}:
+		for col := range r {
+			cols = append(cols, col)
+		}
+		sort.Strings(cols)
+		for _, col := range cols {
+			vals = append(vals, r[col])
+		}
+		return cols, vals
+	case []interface{}:
+		for i, v := range r {
+			col := strconv.Itoa(i)
+			if i < len(titles) {
+				col = titles[i]
+			}
+			cols = append(cols, col)
+			vals = append(vals, v)
+		}
+		return cols, vals
+	}
+	return []string{"value"}, []interface{}{row}
+}
+
+// blameHash is a fast, non-cryptographic hash of a row or cell value, used to
+// detect changes between versions
+func blameHash(v interface{}) uint64 {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data = []byte(fmt.Sprint(v))
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
@@ -0,0 +1,126 @@
+package base
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qri/dsref"
+)
+
+func TestBlame(t *testing.T) {
+	ctx := context.Background()
+	run := newTestRunner(t)
+	defer run.Delete()
+
+	var paths []string
+	for i, body := range []string{
+		`[["a",1],["b",2]]`,
+		`[["a",1],["b",3],["c",4]]`,
+		`[["b",3],["a",5],["c",4]]`,
+	} {
+		ds := run.BuildDataset("pops", "json")
+		ds.Structure.Schema = map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "array",
+				"items": []interface{}{
+					map[string]interface{}{"title": "city", "type": "string"},
+					map[string]interface{}{"title": "pop", "type": "integer"},
+				},
+			},
+		}
+		ds.Commit = &dataset.Commit{Title: []string{"first", "second", "third"}[i]}
+		ds.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte(body)))
+		ref, err := run.SaveDataset(ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, ref.Path)
+	}
+	ref := dsref.Ref{Username: "peer", Name: "pops"}
+	if _, err := run.Repo.ResolveRef(ctx, &ref); err != nil {
+		t.Fatal(err)
+	}
+
+	blame := func(opts BlameOptions) []RowBlame {
+		t.Helper()
+		var rows []RowBlame
+		if err := Blame(ctx, run.Repo, ref, opts, func(rb RowBlame) error {
+			rows = append(rows, rb)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+	type row struct {
+		Key     string
+		Path    string
+		Bounded bool
+		Cells   []string
+	}
+	summarize := func(rbs []RowBlame) []row {
+		res := make([]row, len(rbs))
+		for i, rb := range rbs {
+			res[i] = row{Key: rb.Key, Path: rb.Version.Path, Bounded: rb.Bounded}
+			for _, c := range rb.Cells {
+				res[i].Cells = append(res[i].Cells, c.Column+"@"+c.Version.Path)
+			}
+		}
+		return res
+	}
+
+	got := blame(BlameOptions{Key: "city", Cells: true})
+	expect := []row{
+		{Key: "b", Path: paths[1], Cells: []string{"city@" + paths[0], "pop@" + paths[1]}},
+		{Key: "a", Path: paths[2], Cells: []string{"city@" + paths[0], "pop@" + paths[2]}},
+		{Key: "c", Path: paths[1], Cells: []string{"city@" + paths[1], "pop@" + paths[1]}},
+	}
+	if diff := cmp.Diff(expect, summarize(got)); diff != "" {
+		t.Errorf("blame by key mismatch (-want +got):\n%s", diff)
+	}
+	if got[1].Version.CommitTitle != "third" || got[1].Version.Author != "peer" {
+		t.Errorf("expected version details of the third commit, got: %#v", got[1].Version)
+	}
+
+	// history is cut short, rows unchanged across the window are bounded
+	expect = []row{
+		{Key: "b", Path: paths[1], Bounded: true},
+		{Key: "a", Path: paths[2]},
+		{Key: "c", Path: paths[1], Bounded: true},
+	}
+	if diff := cmp.Diff(expect, summarize(blame(BlameOptions{Key: "city", Limit: 2}))); diff != "" {
+		t.Errorf("blame with limit mismatch (-want +got):\n%s", diff)
+	}
+
+	// without a key rows are matched by index
+	expect = []row{
+		{Key: "0", Path: paths[2]},
+		{Key: "1", Path: paths[2]},
+		{Key: "2", Path: paths[1]},
+	}
+	if diff := cmp.Diff(expect, summarize(blame(BlameOptions{}))); diff != "" {
+		t.Errorf("blame by index mismatch (-want +got):\n%s", diff)
+	}
+
+	// blame an earlier version
+	prev := ref
+	prev.Path = paths[1]
+	var rows []RowBlame
+	if err := Blame(ctx, run.Repo, prev, BlameOptions{Key: "city"}, func(rb RowBlame) error {
+		rows = append(rows, rb)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].Version.Path != paths[0] {
+		t.Errorf("expected blame of the second version to attribute row a to the first version, got: %v", summarize(rows))
+	}
+
+	if err := Blame(ctx, run.Repo, ref, BlameOptions{Key: "country"}, func(RowBlame) error { return nil }); err == nil {
+		t.Error("expected blame with a missing key column to error")
+	}
+}
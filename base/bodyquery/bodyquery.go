@@ -0,0 +1,507 @@
+// Package bodyquery filters, projects & sorts the entries of a dataset body.
+// Queries are applied while entries are read, so large bodies can be
+// streamed without holding them in memory. Sorted queries are the exception,
+// scanning all matching entries before returning the first one. Pages of a
+// sorted query only hold the entries the page needs, and resume after the
+// last entry of the previous page instead of re-sorting from the start
+package bodyquery
+
+import (
+	"container/heap"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+	"github.com/qri-io/dataset/tabular"
+)
+
+var (
+	// ErrInvalidWhere is the base error for predicate expressions that can't
+	// be parsed
+	ErrInvalidWhere = errors.New("invalid where expression")
+	// ErrUnknownColumn indicates a query refers to a column the body doesn't
+	// have
+	ErrUnknownColumn = errors.New("unknown column")
+	// ErrInvalidToken indicates a continuation token can't be decoded
+	ErrInvalidToken = errors.New("invalid continuation token")
+)
+
+// Query describes the entries to read from a body
+type Query struct {
+	// Where is a predicate expression entries must match, see ParseWhere
+	Where string
+	// Columns lists columns to include in each entry, in order. An empty list
+	// includes all columns
+	Columns []string
+	// Sort is the column to sort entries by. Prefix with "-" to sort in
+	// descending order
+	Sort string
+}
+
+// IsEmpty returns true if the query has no effect on the entries it reads
+func (q Query) IsEmpty() bool {
+	return q.Where == "" && len(q.Columns) == 0 && q.Sort == ""
+}
+
+// ParseColumns splits a comma-separated list of column names
+func ParseColumns(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	cols := strings.Split(s, ",")
+	for i, c := range cols {
+		cols[i] = strings.TrimSpace(c)
+	}
+	return cols
+}
+
+// hash returns a digest of the query, used to check a continuation token is
+// resumed with the query that created it
+func (q Query) hash() string {
+	data, _ := json.Marshal(q)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Position is a point in the results of a query to resume reading from
+type Position struct {
+	// Pos is the number of body entries read before the position. unsorted
+	// queries resume by skipping Pos entries
+	Pos int `json:"pos"`
+	// After is the last entry returned by a sorted query, sorted queries
+	// resume with the entries that sort after it
+	After *SortKey `json:"after,omitempty"`
+}
+
+// SortKey places an entry in the results of a sorted query. entries are
+// ordered by Value, entries with equal values by Row
+type SortKey struct {
+	// Value is the value of the sort column
+	Value interface{} `json:"value"`
+	// Row is the position of the entry in the body
+	Row int `json:"row"`
+}
+
+// Reader applies a query to entries read from an underlying EntryReader.
+// Reader is itself an EntryReader, with a structure describing the projected
+// entries
+type Reader struct {
+	r     dsio.EntryReader
+	q     Query
+	st    *dataset.Structure
+	where Expr
+
+	index   map[string]int
+	project []string
+	projIdx []int
+
+	sortCol  string
+	sortDesc bool
+	// sortCap bounds the number of sorted entries held, zero holds all
+	sortCap int
+	sorted  []sortedEntry
+	sortIdx int
+	last    *SortKey
+
+	start int
+	pos   int
+}
+
+var _ dsio.EntryReader = (*Reader)(nil)
+
+// sortedEntry is an entry of a sorted query & its sort key
+type sortedEntry struct {
+	ent dsio.Entry
+	key SortKey
+}
+
+// NewReader creates a Reader that reads entries matching q from r. start is a
+// position returned by a previous call to Reader.Position with the same query
+// & body, and resumes reading from there. Resuming an unsorted query skips
+// already-read entries without evaluating them
+func NewReader(r dsio.EntryReader, q Query, start Position) (*Reader, error) {
+	if start.Pos < 0 {
+		return nil, fmt.Errorf("invalid start position %d", start.Pos)
+	}
+
+	qr := &Reader{
+		r:       r,
+		q:       q,
+		st:      r.Structure(),
+		project: q.Columns,
+		sortCol: strings.TrimPrefix(q.Sort, "-"),
+		start:   start.Pos,
+		last:    start.After,
+	}
+	qr.sortDesc = qr.sortCol != q.Sort
+
+	var refs []string
+	if q.Where != "" {
+		where, err := ParseWhere(q.Where)
+		if err != nil {
+			return nil, err
+		}
+		qr.where = where
+		refs = where.Columns()
+	}
+	refs = append(refs, q.Columns...)
+	if qr.sortCol != "" {
+		refs = append(refs, qr.sortCol)
+	}
+
+	// tabular bodies refer to columns by the titles in their schema, other
+	// bodies by object keys
+	if st := r.Structure(); st != nil && st.Schema != nil {
+		if cols, _, err := tabular.ColumnsFromJSONSchema(st.Schema); err == nil {
+			qr.index = make(map[string]int, len(cols))
+			for i, c := range cols {
+				qr.index[c.Title] = i
+			}
+			for _, ref := range refs {
+				if _, ok := qr.index[ref]; !ok {
+					return nil, fmt.Errorf("%w %q", ErrUnknownColumn, ref)
+				}
+			}
+			if len(q.Columns) > 0 {
+				qr.projIdx = make([]int, len(q.Columns))
+				for i, c := range q.Columns {
+					qr.projIdx[i] = qr.index[c]
+				}
+				qr.st = projectStructure(st, qr.projIdx)
+			}
+		}
+	}
+
+	return qr, nil
+}
+
+// Open creates a Reader for the body of ds. A non-empty token resumes reading
+// where a previous page of the same query ended, and must have been created
+// for the same dataset version
+func Open(ds *dataset.Dataset, q Query, token string) (*Reader, error) {
+	file := ds.BodyFile()
+	if file == nil {
+		return nil, fmt.Errorf("no body file to read")
+	}
+
+	start := Position{}
+	if token != "" {
+		path, pos, err := DecodeToken(token, q)
+		if err != nil {
+			return nil, err
+		}
+		if path != ds.Path {
+			return nil, fmt.Errorf("%w: token is for a different dataset version", ErrInvalidToken)
+		}
+		start = pos
+	}
+
+	er, err := dsio.NewEntryReader(ds.Structure, file)
+	if err != nil {
+		return nil, fmt.Errorf("allocating data reader: %w", err)
+	}
+	qr, err := NewReader(er, q, start)
+	if err != nil {
+		er.Close()
+		return nil, err
+	}
+	return qr, nil
+}
+
+// ReadPage skips offset entries, then calls fn with up to limit entries. A
+// negative limit reads all remaining entries. If entries remain after the
+// page, ReadPage returns a continuation token for the body at path that
+// resumes reading after the last entry passed to fn. Sorted queries only hold
+// the entries of the page in memory
+func (qr *Reader) ReadPage(path string, offset, limit int, fn func(dsio.Entry) error) (string, error) {
+	if qr.sortCol != "" && qr.sorted == nil && limit >= 0 {
+		// the page & the peeked entry after it
+		qr.sortCap = offset + limit + 1
+	}
+	for i := 0; i < offset; i++ {
+		if _, err := qr.ReadEntry(); errors.Is(err, io.EOF) {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	read, pos := 0, qr.Position()
+	for limit < 0 || read < limit {
+		ent, err := qr.ReadEntry()
+		if errors.Is(err, io.EOF) {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		read++
+		pos = qr.Position()
+		if err := fn(ent); err != nil {
+			return "", err
+		}
+	}
+
+	// peek for remaining entries. the token records the position before the
+	// peek, so the next page starts with the peeked entry
+	if _, err := qr.ReadEntry(); errors.Is(err, io.EOF) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return EncodeToken(path, qr.q, pos), nil
+}
+
+// Structure gives the structure of entries returned by the reader
+func (qr *Reader) Structure() *dataset.Structure {
+	return qr.st
+}
+
+// ReadEntry reads the next entry that matches the query
+func (qr *Reader) ReadEntry() (dsio.Entry, error) {
+	if qr.sortCol != "" {
+		if qr.sorted == nil {
+			if err := qr.sortEntries(); err != nil {
+				return dsio.Entry{}, err
+			}
+		}
+		if qr.sortIdx >= len(qr.sorted) {
+			return dsio.Entry{}, io.EOF
+		}
+		se := qr.sorted[qr.sortIdx]
+		qr.sortIdx++
+		qr.last = &se.key
+		return se.ent, nil
+	}
+
+	for ; qr.pos < qr.start; qr.pos++ {
+		if _, err := qr.r.ReadEntry(); err != nil {
+			return dsio.Entry{}, err
+		}
+	}
+	ent, err := qr.nextMatch()
+	if err != nil {
+		return dsio.Entry{}, err
+	}
+	return qr.projectEntry(ent), nil
+}
+
+// Position returns the position to resume reading from to continue after the
+// last entry returned by ReadEntry
+func (qr *Reader) Position() Position {
+	if qr.sortCol != "" {
+		return Position{After: qr.last}
+	}
+	return Position{Pos: qr.pos}
+}
+
+// Close closes the underlying reader
+func (qr *Reader) Close() error {
+	return qr.r.Close()
+}
+
+// nextMatch reads from the underlying reader until an entry matches
+func (qr *Reader) nextMatch() (dsio.Entry, error) {
+	for {
+		ent, err := qr.r.ReadEntry()
+		if err != nil {
+			return dsio.Entry{}, err
+		}
+		qr.pos++
+		if qr.where == nil || qr.where.Match(qr.getter(ent.Value)) {
+			return ent, nil
+		}
+	}
+}
+
+// sortEntries reads all matching entries that sort after the resume position,
+// keeping the first sortCap entries in sort order
+func (qr *Reader) sortEntries() error {
+	h := &sortHeap{less: qr.less}
+	for {
+		ent, err := qr.nextMatch()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		se := sortedEntry{
+			ent: ent,
+			key: SortKey{Value: qr.getter(ent.Value)(qr.sortCol), Row: qr.pos - 1},
+		}
+		if qr.last != nil && !qr.less(*qr.last, se.key) {
+			continue
+		}
+		if qr.sortCap <= 0 || h.Len() < qr.sortCap {
+			heap.Push(h, se)
+		} else if qr.less(se.key, h.entries[0].key) {
+			// replace the entry that sorts last
+			h.entries[0] = se
+			heap.Fix(h, 0)
+		}
+	}
+
+	qr.sorted = h.entries
+	if qr.sorted == nil {
+		qr.sorted = []sortedEntry{}
+	}
+	sort.Slice(qr.sorted, func(i, j int) bool {
+		return qr.less(qr.sorted[i].key, qr.sorted[j].key)
+	})
+
+	// project after sorting, the sort column may not be in the output
+	for i, se := range qr.sorted {
+		qr.sorted[i].ent = qr.projectEntry(se.ent)
+	}
+	return nil
+}
+
+// less orders sort keys by value in the query sort direction, then by row
+func (qr *Reader) less(a, b SortKey) bool {
+	x, y := a.Value, b.Value
+	if qr.sortDesc {
+		x, y = y, x
+	}
+	if c, ok := compare(x, y); ok && c != 0 {
+		return c < 0
+	} else if !ok {
+		// null & incomparable values sort last
+		if y == nil && x != nil {
+			return true
+		} else if x == nil && y != nil {
+			return false
+		}
+	}
+	return a.Row < b.Row
+}
+
+// sortHeap is a max-heap of sorted entries, the root sorts last
+type sortHeap struct {
+	entries []sortedEntry
+	less    func(a, b SortKey) bool
+}
+
+func (h sortHeap) Len() int { return len(h.entries) }
+func (h sortHeap) Less(i, j int) bool {
+	return h.less(h.entries[j].key, h.entries[i].key)
+}
+func (h sortHeap) Swap(i, j int) { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *sortHeap) Push(x interface{}) {
+	h.entries = append(h.entries, x.(sortedEntry))
+}
+func (h *sortHeap) Pop() interface{} {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
+
+// getter returns a function for looking up column values of an entry value
+func (qr *Reader) getter(v interface{}) func(string) interface{} {
+	return func(col string) interface{} {
+		switch x := v.(type) {
+		case []interface{}:
+			if i, ok := qr.index[col]; ok && i < len(x) {
+				return x[i]
+			}
+		case map[string]interface{}:
+			return x[col]
+		}
+		return nil
+	}
+}
+
+func (qr *Reader) projectEntry(ent dsio.Entry) dsio.Entry {
+	if len(qr.project) == 0 {
+		return ent
+	}
+	switch x := ent.Value.(type) {
+	case []interface{}:
+		if qr.projIdx == nil {
+			return ent
+		}
+		row := make([]interface{}, len(qr.projIdx))
+		for i, idx := range qr.projIdx {
+			if idx < len(x) {
+				row[i] = x[idx]
+			}
+		}
+		ent.Value = row
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(qr.project))
+		for _, col := range qr.project {
+			if v, ok := x[col]; ok {
+				obj[col] = v
+			}
+		}
+		ent.Value = obj
+	}
+	return ent
+}
+
+// projectStructure creates a structure for tabular entries that only
+// include the columns at indexes
+func projectStructure(st *dataset.Structure, indexes []int) *dataset.Structure {
+	items, _ := st.Schema["items"].(map[string]interface{})
+	cols, _ := items["items"].([]interface{})
+
+	projCols := make([]interface{}, len(indexes))
+	for i, idx := range indexes {
+		if idx < len(cols) {
+			projCols[i] = cols[idx]
+		}
+	}
+
+	projItems := map[string]interface{}{}
+	for k, v := range items {
+		projItems[k] = v
+	}
+	projItems["items"] = projCols
+
+	sch := map[string]interface{}{}
+	for k, v := range st.Schema {
+		sch[k] = v
+	}
+	sch["items"] = projItems
+
+	proj := &dataset.Structure{}
+	proj.Assign(st)
+	proj.Schema = sch
+	return proj
+}
+
+type tokenData struct {
+	Path  string `json:"path"`
+	Query string `json:"query"`
+	Position
+}
+
+// EncodeToken creates an opaque continuation token for resuming query q at
+// pos in the body of the dataset version at path
+func EncodeToken(path string, q Query, pos Position) string {
+	data, _ := json.Marshal(tokenData{Path: path, Query: q.hash(), Position: pos})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeToken reads the dataset version path & position from a continuation
+// token, checking the token was created for query q
+func DecodeToken(token string, q Query) (path string, pos Position, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", pos, ErrInvalidToken
+	}
+	td := tokenData{}
+	if err := json.Unmarshal(data, &td); err != nil || td.Pos < 0 {
+		return "", pos, ErrInvalidToken
+	}
+	if td.Query != q.hash() {
+		return "", pos, fmt.Errorf("%w: token is for a different query", ErrInvalidToken)
+	}
+	return td.Path, td.Position, nil
+}
@@ -0,0 +1,308 @@
+package bodyquery
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+	"github.com/qri-io/qfs"
+)
+
+const citiesCSV = `toronto,40000000,55.5,false
+new york,8500000,44.4,true
+chicago,300000,44.4,true
+chatham,35000,65.25,true
+raleigh,250000,50.65,true
+`
+
+var citiesStructure = &dataset.Structure{
+	Format: "csv",
+	Schema: map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"type": "array",
+			"items": []interface{}{
+				map[string]interface{}{"title": "city", "type": "string"},
+				map[string]interface{}{"title": "pop", "type": "integer"},
+				map[string]interface{}{"title": "avg_age", "type": "number"},
+				map[string]interface{}{"title": "in_usa", "type": "boolean"},
+			},
+		},
+	},
+}
+
+func citiesReader(t *testing.T) dsio.EntryReader {
+	r, err := dsio.NewEntryReader(citiesStructure, bytes.NewBufferString(citiesCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func readAll(t *testing.T, r *Reader, limit int) []interface{} {
+	vals := []interface{}{}
+	for i := 0; limit < 0 || i < limit; i++ {
+		ent, err := r.ReadEntry()
+		if err != nil {
+			break
+		}
+		vals = append(vals, ent.Value)
+	}
+	return vals
+}
+
+func TestReader(t *testing.T) {
+	cases := []struct {
+		description string
+		q           Query
+		expect      []interface{}
+	}{
+		{"empty query", Query{}, []interface{}{
+			[]interface{}{"toronto", int64(40000000), 55.5, false},
+			[]interface{}{"new york", int64(8500000), 44.4, true},
+			[]interface{}{"chicago", int64(300000), 44.4, true},
+			[]interface{}{"chatham", int64(35000), 65.25, true},
+			[]interface{}{"raleigh", int64(250000), 50.65, true},
+		}},
+		{"where & columns", Query{Where: `pop > 250000 and in_usa = true`, Columns: []string{"city", "pop"}}, []interface{}{
+			[]interface{}{"new york", int64(8500000)},
+			[]interface{}{"chicago", int64(300000)},
+		}},
+		{"or & not", Query{Where: `not (city ~ "ch") or avg_age >= 65`, Columns: []string{"city"}}, []interface{}{
+			[]interface{}{"toronto"},
+			[]interface{}{"new york"},
+			[]interface{}{"chatham"},
+			[]interface{}{"raleigh"},
+		}},
+		{"sort descending", Query{Sort: "-avg_age", Columns: []string{"city"}}, []interface{}{
+			[]interface{}{"chatham"},
+			[]interface{}{"toronto"},
+			[]interface{}{"raleigh"},
+			[]interface{}{"new york"},
+			[]interface{}{"chicago"},
+		}},
+		{"sort & where", Query{Where: `city != 'toronto'`, Sort: "pop", Columns: []string{"pop"}}, []interface{}{
+			[]interface{}{int64(35000)},
+			[]interface{}{int64(250000)},
+			[]interface{}{int64(300000)},
+			[]interface{}{int64(8500000)},
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			r, err := NewReader(citiesReader(t), c.q, Position{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.expect, readAll(t, r, -1)); diff != "" {
+				t.Errorf("result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReaderResume(t *testing.T) {
+	for _, q := range []Query{
+		{Where: `in_usa = true`, Columns: []string{"city"}},
+		{Where: `in_usa = true`, Columns: []string{"city"}, Sort: "city"},
+	} {
+		r, err := NewReader(citiesReader(t), q, Position{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := readAll(t, r, 2)
+		pos := r.Position()
+
+		if r, err = NewReader(citiesReader(t), q, pos); err != nil {
+			t.Fatal(err)
+		}
+		rest := readAll(t, r, -1)
+
+		all, err := NewReader(citiesReader(t), q, Position{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(readAll(t, all, -1), append(first, rest...)); diff != "" {
+			t.Errorf("sort %q: resumed result mismatch (-want +got):\n%s", q.Sort, diff)
+		}
+	}
+}
+
+func TestReadPage(t *testing.T) {
+	ds := &dataset.Dataset{Path: "/mem/QmCities", Structure: citiesStructure}
+	open := func(token string) *Reader {
+		ds.SetBodyFile(qfs.NewMemfileBytes("body.csv", []byte(citiesCSV)))
+		r, err := Open(ds, Query{Where: `in_usa = true`, Columns: []string{"city"}}, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	vals := []interface{}{}
+	collect := func(ent dsio.Entry) error {
+		vals = append(vals, ent.Value)
+		return nil
+	}
+
+	first, err := open("").ReadPage(ds.Path, 1, 2, collect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == "" {
+		t.Fatal("expected a continuation token")
+	}
+	token, err := open(first).ReadPage(ds.Path, 0, 2, collect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		t.Errorf("expected no token after the last page, got %q", token)
+	}
+	expect := []interface{}{
+		[]interface{}{"chicago"},
+		[]interface{}{"chatham"},
+		[]interface{}{"raleigh"},
+	}
+	if diff := cmp.Diff(expect, vals); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+
+	ds.SetBodyFile(qfs.NewMemfileBytes("body.csv", []byte(citiesCSV)))
+	if _, err := Open(ds, Query{}, EncodeToken("/mem/QmOther", Query{}, Position{Pos: 1})); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for a token from another version, got %v", err)
+	}
+	ds.SetBodyFile(qfs.NewMemfileBytes("body.csv", []byte(citiesCSV)))
+	if _, err := Open(ds, Query{Sort: "city"}, first); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for a token from another query, got %v", err)
+	}
+}
+
+func TestReadPageSorted(t *testing.T) {
+	ds := &dataset.Dataset{Path: "/mem/QmCities", Structure: citiesStructure}
+	for _, q := range []Query{
+		{Sort: "avg_age", Columns: []string{"city"}},
+		{Sort: "-pop", Columns: []string{"city"}},
+	} {
+		open := func(token string) *Reader {
+			ds.SetBodyFile(qfs.NewMemfileBytes("body.csv", []byte(citiesCSV)))
+			r, err := Open(ds, q, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return r
+		}
+
+		expect := readAll(t, open(""), -1)
+		vals := []interface{}{}
+		token := ""
+		for pages := 0; pages == 0 || token != ""; pages++ {
+			if pages > len(expect) {
+				t.Fatalf("sort %q: expected paging to end", q.Sort)
+			}
+			r := open(token)
+			var err error
+			if token, err = r.ReadPage(ds.Path, 0, 1, func(ent dsio.Entry) error {
+				vals = append(vals, ent.Value)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if len(r.sorted) > 2 {
+				t.Errorf("sort %q: expected a page of 1 to hold at most 2 entries, held %d", q.Sort, len(r.sorted))
+			}
+		}
+		if diff := cmp.Diff(expect, vals); diff != "" {
+			t.Errorf("sort %q: paged result mismatch (-want +got):\n%s", q.Sort, diff)
+		}
+	}
+}
+
+func TestReaderObjectEntries(t *testing.T) {
+	st := &dataset.Structure{
+		Format: "json",
+		Schema: dataset.BaseSchemaArray,
+	}
+	body := `[{"a":1,"b":"x"},{"a":2,"b":"y"},{"a":3}]`
+	er, err := dsio.NewEntryReader(st, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(er, Query{Where: `a >= 2`, Columns: []string{"b"}}, Position{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []interface{}{
+		map[string]interface{}{"b": "y"},
+		map[string]interface{}{},
+	}
+	if diff := cmp.Diff(expect, readAll(t, r, -1)); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	if _, err := NewReader(citiesReader(t), Query{Columns: []string{"nope"}}, Position{}); !errors.Is(err, ErrUnknownColumn) {
+		t.Errorf("expected unknown column error, got %v", err)
+	}
+	if _, err := NewReader(citiesReader(t), Query{Where: "nope = 1"}, Position{}); !errors.Is(err, ErrUnknownColumn) {
+		t.Errorf("expected unknown column error, got %v", err)
+	}
+	if _, err := NewReader(citiesReader(t), Query{Where: "city = "}, Position{}); !errors.Is(err, ErrInvalidWhere) {
+		t.Errorf("expected invalid where error, got %v", err)
+	}
+}
+
+func TestParseWhere(t *testing.T) {
+	bad := []string{
+		``,
+		`a`,
+		`a =`,
+		`a = b`,
+		`a = 1 and`,
+		`(a = 1`,
+		`a = 1)`,
+		`a =! 1`,
+		`a ~ 1`,
+		`a = "unterminated`,
+	}
+	for _, s := range bad {
+		if _, err := ParseWhere(s); !errors.Is(err, ErrInvalidWhere) {
+			t.Errorf("%q: expected ErrInvalidWhere, got %v", s, err)
+		}
+	}
+
+	e, err := ParseWhere(`a = 1 AND (b != "two" OR NOT c < -3.5) and ` + "`d e`" + ` = null`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"a", "b", "c", "d e"}, e.Columns()); diff != "" {
+		t.Errorf("columns mismatch (-want +got):\n%s", diff)
+	}
+	row := map[string]interface{}{"a": int64(1), "b": "two", "c": 4.0}
+	if !e.Match(func(col string) interface{} { return row[col] }) {
+		t.Error("expected row to match")
+	}
+}
+
+func TestToken(t *testing.T) {
+	q := Query{Where: "pop > 1", Sort: "city"}
+	tok := EncodeToken("/mem/QmFoo", q, Position{After: &SortKey{Value: "chicago", Row: 2}})
+	path, pos, err := DecodeToken(tok, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/mem/QmFoo" || pos.After == nil || pos.After.Value != "chicago" || pos.After.Row != 2 {
+		t.Errorf("token mismatch, got path %q pos %#v", path, pos)
+	}
+	if _, _, err := DecodeToken(tok, Query{Where: "pop > 2", Sort: "city"}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for a different query, got %v", err)
+	}
+	if _, _, err := DecodeToken("not a token", q); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+}
@@ -0,0 +1,371 @@
+package bodyquery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a parsed predicate expression that body entries are matched
+// against
+type Expr interface {
+	// Match reports whether the values returned by get satisfy the
+	// expression. get returns the value of a column in an entry
+	Match(get func(col string) interface{}) bool
+	// Columns lists the columns the expression refers to
+	Columns() []string
+}
+
+// ParseWhere parses a predicate expression. Expressions compare columns to
+// literal values, and combine comparisons with "and", "or", "not" &
+// parentheses, eg: `population > 1000 and (country = "CA" or country = "US")`.
+// Comparison operators are =, !=, <, <=, >, >=, ~ (contains) & !~ (does not
+// contain). Literals are numbers, quoted strings, true, false & null. Column
+// names that aren't identifiers can be quoted with backticks
+func ParseWhere(s string) (Expr, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("%w: unexpected %q at position %d", ErrInvalidWhere, t.text, t.pos)
+	}
+	return e, nil
+}
+
+type andExpr struct{ left, right Expr }
+
+func (e andExpr) Match(get func(string) interface{}) bool {
+	return e.left.Match(get) && e.right.Match(get)
+}
+
+func (e andExpr) Columns() []string { return append(e.left.Columns(), e.right.Columns()...) }
+
+type orExpr struct{ left, right Expr }
+
+func (e orExpr) Match(get func(string) interface{}) bool {
+	return e.left.Match(get) || e.right.Match(get)
+}
+
+func (e orExpr) Columns() []string { return append(e.left.Columns(), e.right.Columns()...) }
+
+type notExpr struct{ expr Expr }
+
+func (e notExpr) Match(get func(string) interface{}) bool { return !e.expr.Match(get) }
+
+func (e notExpr) Columns() []string { return e.expr.Columns() }
+
+type cmpExpr struct {
+	col string
+	op  string
+	val interface{}
+}
+
+func (e cmpExpr) Columns() []string { return []string{e.col} }
+
+func (e cmpExpr) Match(get func(string) interface{}) bool {
+	v := get(e.col)
+	switch e.op {
+	case "~", "!~":
+		str, ok := v.(string)
+		contains := ok && strings.Contains(str, e.val.(string))
+		return contains == (e.op == "~")
+	case "!=":
+		c, ok := compare(v, e.val)
+		return !ok || c != 0
+	}
+
+	c, ok := compare(v, e.val)
+	if !ok {
+		return false
+	}
+	switch e.op {
+	case "=":
+		return c == 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// compare orders two values, returning false if the values are of types that
+// can't be compared
+func compare(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, a == nil && b == nil
+	}
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+		return 0, true
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x == y:
+			return 0, true
+		case y:
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	}
+	return 0, false
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case r == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			var b strings.Builder
+			for i++; i < len(rs) && rs[i] != r; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+				}
+				b.WriteRune(rs[i])
+			}
+			if i == len(rs) {
+				return nil, fmt.Errorf("%w: unterminated string at position %d", ErrInvalidWhere, start)
+			}
+			i++
+			toks = append(toks, token{tokString, b.String(), start})
+		case strings.ContainsRune("=!<>~", r):
+			start := i
+			for i < len(rs) && strings.ContainsRune("=!<>~", rs[i]) {
+				i++
+			}
+			op := string(rs[start:i])
+			switch op {
+			case "==":
+				op = "="
+			case "<>":
+				op = "!="
+			case "=", "!=", "<", "<=", ">", ">=", "~", "!~":
+			default:
+				return nil, fmt.Errorf("%w: unknown operator %q at position %d", ErrInvalidWhere, op, start)
+			}
+			toks = append(toks, token{tokOp, op, start})
+		case r == '-' || r == '.' || unicode.IsDigit(r):
+			start := i
+			for i++; i < len(rs) && (unicode.IsDigit(rs[i]) || strings.ContainsRune(".eE+-", rs[i])); i++ {
+			}
+			toks = append(toks, token{tokNumber, string(rs[start:i]), start})
+		case r == '_' || r == '$' || unicode.IsLetter(r):
+			start := i
+			for i < len(rs) && (rs[i] == '_' || rs[i] == '$' || unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i])) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, string(rs[start:i]), start})
+		case r == '`':
+			// backticks quote column names that aren't valid identifiers
+			start := i
+			for i++; i < len(rs) && rs[i] != '`'; i++ {
+			}
+			if i == len(rs) {
+				return nil, fmt.Errorf("%w: unterminated column name at position %d", ErrInvalidWhere, start)
+			}
+			i++
+			toks = append(toks, token{tokIdent, string(rs[start+1 : i-1]), start})
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q at position %d", ErrInvalidWhere, r, i)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(rs)}), nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) keyword(kw string) bool {
+	t := p.peek()
+	if t.kind == tokIdent && strings.EqualFold(t.text, kw) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.keyword("not") {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{e}, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, fmt.Errorf("%w: expected \")\" at position %d", ErrInvalidWhere, t.pos)
+		}
+		return e, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	col := p.next()
+	if col.kind != tokIdent {
+		return nil, fmt.Errorf("%w: expected column name at position %d", ErrInvalidWhere, col.pos)
+	}
+	op := p.next()
+	if op.kind != tokOp {
+		return nil, fmt.Errorf("%w: expected comparison operator after %q at position %d", ErrInvalidWhere, col.text, op.pos)
+	}
+
+	lit := p.next()
+	var val interface{}
+	switch lit.kind {
+	case tokString:
+		val = lit.text
+	case tokNumber:
+		f, err := strconv.ParseFloat(lit.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid number %q at position %d", ErrInvalidWhere, lit.text, lit.pos)
+		}
+		val = f
+	case tokIdent:
+		switch strings.ToLower(lit.text) {
+		case "true":
+			val = true
+		case "false":
+			val = false
+		case "null":
+			val = nil
+		default:
+			return nil, fmt.Errorf("%w: expected a value at position %d, quote strings to compare them", ErrInvalidWhere, lit.pos)
+		}
+	default:
+		return nil, fmt.Errorf("%w: expected a value at position %d", ErrInvalidWhere, lit.pos)
+	}
+
+	if op.text == "~" || op.text == "!~" {
+		if _, ok := val.(string); !ok {
+			return nil, fmt.Errorf("%w: %q operator requires a string at position %d", ErrInvalidWhere, op.text, lit.pos)
+		}
+	}
+	return cmpExpr{col: col.text, op: op.text, val: val}, nil
+}
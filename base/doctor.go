@@ -0,0 +1,496 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/qri-io/qri/base/params"
+	"github.com/qri-io/qri/collection"
+	"github.com/qri-io/qri/dscache"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/logbook"
+	"github.com/qri-io/qri/logbook/oplog"
+	"github.com/qri-io/qri/profile"
+	"github.com/qri-io/qri/repo"
+	reporef "github.com/qri-io/qri/repo/ref"
+)
+
+// DoctorCategory names the store a discrepancy was found in
+type DoctorCategory string
+
+const (
+	// DoctorRefstore is a refstore entry that disagrees with the logbook
+	DoctorRefstore DoctorCategory = "refstore"
+	// DoctorDscache is a dscache entry that disagrees with the logbook
+	DoctorDscache DoctorCategory = "dscache"
+	// DoctorCollection is an item in the owner's collection that disagrees
+	// with the logbook
+	DoctorCollection DoctorCategory = "collection"
+	// DoctorBlockstore is a referenced dataset version that isn't stored
+	// locally. Missing blocks can't be rebuilt from the logbook
+	DoctorBlockstore DoctorCategory = "blockstore"
+)
+
+// Discrepancy is a single disagreement between a repo store and the logbook
+type Discrepancy struct {
+	Category DoctorCategory `json:"category"`
+	// human-readable reference to the dataset, username/name
+	Ref string `json:"ref"`
+	// InitID of the dataset, if known
+	InitID string `json:"initID,omitempty"`
+	// Path the discrepancy concerns, if any
+	Path string `json:"path,omitempty"`
+	// Problem describes the disagreement
+	Problem string `json:"problem"`
+}
+
+func (d Discrepancy) String() string {
+	if d.Path != "" {
+		return fmt.Sprintf("%s: %s@%s %s", d.Category, d.Ref, d.Path, d.Problem)
+	}
+	return fmt.Sprintf("%s: %s %s", d.Category, d.Ref, d.Problem)
+}
+
+// DoctorReport is the result of checking a repo for consistency
+type DoctorReport struct {
+	// number of datasets recorded in the logbook
+	Datasets int `json:"datasets"`
+	// number of distinct dataset paths checked for local storage
+	Paths int `json:"paths"`
+	// Discrepancies lists every disagreement found, ordered by category
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Categories counts discrepancies in the report by category
+func (r *DoctorReport) Categories() map[DoctorCategory]int {
+	counts := map[DoctorCategory]int{}
+	for _, d := range r.Discrepancies {
+		counts[d.Category]++
+	}
+	return counts
+}
+
+// repoState is a snapshot of each store's view of the datasets in a repo
+type repoState struct {
+	owner profile.ID
+	// every dataset recorded in the logbook, keyed by initID
+	logbook map[string]dsref.Ref
+	// logbook datasets the refstore & collection are expected to hold,
+	// keyed by initID
+	local map[string]dsref.Ref
+	refs  []reporef.DatasetRef
+	// dscache entries, nil if the dscache isn't in use
+	dscache []reporef.DatasetRef
+	// items in the owner's collection, nil if there is no collection set
+	collection []dsref.VersionInfo
+}
+
+// CheckRepo cross-checks the refstore, dscache & the repo owner's collection
+// against the logbook, and checks the head version of every referenced
+// dataset is stored locally. dc and cs may be nil.
+//
+// Logbooks also hold history fetched from remotes for datasets that were never
+// pulled. Datasets authored by another peer whose head version isn't stored
+// locally are treated as fetched history, and aren't expected in the refstore
+// or collection
+func CheckRepo(ctx context.Context, r repo.Repo, dc *dscache.Dscache, cs collection.Set) (*DoctorReport, error) {
+	st, err := loadRepoState(ctx, r, dc, cs)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &DoctorReport{
+		Datasets:      len(st.logbook),
+		Discrepancies: []Discrepancy{},
+	}
+	res.Discrepancies = append(res.Discrepancies, checkRefs(DoctorRefstore, st.local, st.checkedRefs())...)
+	if st.dscache != nil {
+		res.Discrepancies = append(res.Discrepancies, checkRefs(DoctorDscache, st.logbook, st.dscache)...)
+	}
+	if st.collection != nil {
+		res.Discrepancies = append(res.Discrepancies, checkCollection(st.local, st.collection)...)
+	}
+
+	missing, checked := checkBlockstore(ctx, r, st)
+	res.Paths = checked
+	res.Discrepancies = append(res.Discrepancies, missing...)
+	return res, nil
+}
+
+// RepairRepo rebuilds the refstore, dscache & the repo owner's collection from
+// the logbook. Refstore entries keep their FSI link & published flag, FSI
+// links to datasets without versions & references to other peers' datasets
+// are left in place. Collection items keep counts the logbook doesn't track.
+// Missing blocks are not repaired. dc and cs may be nil
+func RepairRepo(ctx context.Context, r repo.Repo, dc *dscache.Dscache, cs collection.Set) error {
+	st, err := loadRepoState(ctx, r, dc, cs)
+	if err != nil {
+		return err
+	}
+
+	if err := repairRefs(r, st); err != nil {
+		return fmt.Errorf("repairing refstore: %w", err)
+	}
+	if st.dscache != nil {
+		if err := repairDscache(ctx, r, dc); err != nil {
+			return fmt.Errorf("repairing dscache: %w", err)
+		}
+	}
+	if st.collection != nil {
+		if err := repairCollection(ctx, r, cs, st); err != nil {
+			return fmt.Errorf("repairing collection: %w", err)
+		}
+	}
+	return nil
+}
+
+func loadRepoState(ctx context.Context, r repo.Repo, dc *dscache.Dscache, cs collection.Set) (*repoState, error) {
+	st := &repoState{owner: r.Profiles().Owner(ctx).ID}
+
+	var err error
+	if st.logbook, err = logbookRefs(ctx, r.Logbook()); err != nil {
+		return nil, fmt.Errorf("reading logbook: %w", err)
+	}
+	st.local = map[string]dsref.Ref{}
+	for id, ref := range st.logbook {
+		if ref.ProfileID != st.owner.Encode() {
+			if has, err := r.Filesystem().Has(ctx, ref.Path); err != nil || !has {
+				continue
+			}
+		}
+		st.local[id] = ref
+	}
+
+	count, err := r.RefCount()
+	if err != nil {
+		return nil, fmt.Errorf("reading refstore: %w", err)
+	}
+	if st.refs, err = r.References(0, count); err != nil {
+		return nil, fmt.Errorf("reading refstore: %w", err)
+	}
+
+	if !dc.IsEmpty() {
+		if st.dscache, err = dc.ListRefs(); err != nil {
+			return nil, fmt.Errorf("reading dscache: %w", err)
+		}
+	}
+
+	if cs != nil {
+		st.collection, err = cs.List(ctx, st.owner, params.ListAll)
+		if errors.Is(err, collection.ErrNotFound) {
+			st.collection = []dsref.VersionInfo{}
+		} else if err != nil {
+			return nil, fmt.Errorf("reading collection: %w", err)
+		}
+	}
+	return st, nil
+}
+
+// logbookRefs lists a reference to the head of every dataset in the logbook
+// that hasn't been deleted and has at least one version
+func logbookRefs(ctx context.Context, book *logbook.Book) (map[string]dsref.Ref, error) {
+	refs := map[string]dsref.Ref{}
+	if book == nil {
+		return refs, nil
+	}
+	userLogs, err := book.ListAllLogs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, userLog := range userLogs {
+		for _, dsLog := range userLog.Logs {
+			if isDeletedDatasetLog(dsLog) {
+				continue
+			}
+			ref, err := book.Ref(ctx, dsLog.ID())
+			if err != nil {
+				if errors.Is(err, dsref.ErrRefNotFound) {
+					continue
+				}
+				return nil, err
+			}
+			if ref.Path == "" {
+				continue
+			}
+			refs[ref.InitID] = ref
+		}
+	}
+	return refs, nil
+}
+
+func isDeletedDatasetLog(l *oplog.Log) bool {
+	for _, op := range l.Ops {
+		if op.Model == logbook.DatasetModel && op.Type == oplog.OpTypeRemove {
+			return true
+		}
+	}
+	return false
+}
+
+// refKey identifies a reference by owner & name
+func refKey(profileID, name string) string {
+	return profileID + "/" + name
+}
+
+// checkRefs compares a list of references against the logbook
+func checkRefs(cat DoctorCategory, expect map[string]dsref.Ref, refs []reporef.DatasetRef) []Discrepancy {
+	byKey := map[string]dsref.Ref{}
+	for _, ref := range expect {
+		byKey[refKey(ref.ProfileID, ref.Name)] = ref
+	}
+
+	found := map[string]bool{}
+	var res []Discrepancy
+	for _, r := range refs {
+		key := refKey(r.ProfileID.Encode(), r.Name)
+		ref, ok := byKey[key]
+		if !ok {
+			res = append(res, Discrepancy{Category: cat, Ref: r.AliasString(), Path: r.Path, Problem: "isn't in the logbook"})
+			continue
+		}
+		if found[key] {
+			res = append(res, Discrepancy{Category: cat, Ref: r.AliasString(), InitID: ref.InitID, Path: r.Path, Problem: "is a duplicate entry"})
+			continue
+		}
+		found[key] = true
+		if r.Path != ref.Path {
+			res = append(res, Discrepancy{Category: cat, Ref: ref.Alias(), InitID: ref.InitID, Path: r.Path, Problem: fmt.Sprintf("has head %s, logbook head is %s", r.Path, ref.Path)})
+		}
+		if r.Peername != ref.Username {
+			res = append(res, Discrepancy{Category: cat, Ref: ref.Alias(), InitID: ref.InitID, Problem: fmt.Sprintf("has username %q, logbook username is %q", r.Peername, ref.Username)})
+		}
+	}
+	for _, key := range sortedIDs(byKey) {
+		if !found[key] {
+			ref := byKey[key]
+			res = append(res, Discrepancy{Category: cat, Ref: ref.Alias(), InitID: ref.InitID, Path: ref.Path, Problem: "is missing"})
+		}
+	}
+	return res
+}
+
+// checkCollection compares collection items against the logbook
+func checkCollection(expect map[string]dsref.Ref, items []dsref.VersionInfo) []Discrepancy {
+	found := map[string]bool{}
+	var res []Discrepancy
+	for _, item := range items {
+		ref, ok := expect[item.InitID]
+		if !ok {
+			res = append(res, Discrepancy{Category: DoctorCollection, Ref: item.Alias(), InitID: item.InitID, Path: item.Path, Problem: "isn't in the logbook"})
+			continue
+		}
+		found[item.InitID] = true
+		if item.Path != ref.Path {
+			res = append(res, Discrepancy{Category: DoctorCollection, Ref: ref.Alias(), InitID: ref.InitID, Path: item.Path, Problem: fmt.Sprintf("has head %s, logbook head is %s", item.Path, ref.Path)})
+		}
+		if item.Username != ref.Username || item.Name != ref.Name {
+			res = append(res, Discrepancy{Category: DoctorCollection, Ref: ref.Alias(), InitID: ref.InitID, Problem: fmt.Sprintf("is named %s, logbook name is %s", item.Alias(), ref.Alias())})
+		}
+	}
+	for _, id := range sortedIDs(expect) {
+		if !found[id] {
+			ref := expect[id]
+			res = append(res, Discrepancy{Category: DoctorCollection, Ref: ref.Alias(), InitID: ref.InitID, Path: ref.Path, Problem: "is missing"})
+		}
+	}
+	return res
+}
+
+// checkBlockstore checks the head version of every dataset referenced by any
+// store is stored locally, returning discrepancies & the number of distinct
+// paths checked
+func checkBlockstore(ctx context.Context, r repo.Repo, st *repoState) ([]Discrepancy, int) {
+	paths := map[string]string{}
+	add := func(alias, p string) {
+		if _, ok := paths[p]; !ok && p != "" {
+			paths[p] = alias
+		}
+	}
+	for _, ref := range st.local {
+		add(ref.Alias(), ref.Path)
+	}
+	for _, ref := range st.refs {
+		add(ref.AliasString(), ref.Path)
+	}
+	for _, ref := range st.dscache {
+		add(ref.AliasString(), ref.Path)
+	}
+	for _, item := range st.collection {
+		add(item.Alias(), item.Path)
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	var res []Discrepancy
+	for _, p := range sorted {
+		has, err := r.Filesystem().Has(ctx, p)
+		if err != nil {
+			log.Debugw("checking path", "path", p, "err", err)
+		}
+		if !has {
+			res = append(res, Discrepancy{Category: DoctorBlockstore, Ref: paths[p], Path: p, Problem: "isn't stored locally"})
+		}
+	}
+	return res, len(paths)
+}
+
+// checkedRefs lists the refstore entries repairs would keep in line with the
+// logbook, leaving out entries kept as is
+func (st *repoState) checkedRefs() []reporef.DatasetRef {
+	expect := map[string]bool{}
+	for _, ref := range st.local {
+		expect[refKey(ref.ProfileID, ref.Name)] = true
+	}
+	refs := make([]reporef.DatasetRef, 0, len(st.refs))
+	for _, ref := range st.refs {
+		if expect[refKey(ref.ProfileID.Encode(), ref.Name)] || !keepUnloggedRef(ref, st.owner) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// keepUnloggedRef reports whether a refstore entry the logbook doesn't expect
+// is left in place. FSI links to datasets without versions and references to
+// other peers' datasets aren't local logbook datasets, but are still valid
+func keepUnloggedRef(ref reporef.DatasetRef, owner profile.ID) bool {
+	return ref.FSIPath != "" || ref.ProfileID != owner
+}
+
+// repairRefs brings the refstore in line with the logbook, removing & putting
+// only the entries that differ. Each change is written on its own, a failure
+// part way through leaves the refstore partially repaired
+func repairRefs(r repo.Repo, st *repoState) error {
+	byKey := map[string]dsref.Ref{}
+	for _, ref := range st.local {
+		byKey[refKey(ref.ProfileID, ref.Name)] = ref
+	}
+
+	for _, ref := range st.refs {
+		if _, ok := byKey[refKey(ref.ProfileID.Encode(), ref.Name)]; ok || keepUnloggedRef(ref, st.owner) {
+			continue
+		}
+		if err := r.DeleteRef(ref); err != nil && !errors.Is(err, repo.ErrNotFound) {
+			return fmt.Errorf("removing %s: %w", ref.AliasString(), err)
+		}
+	}
+
+	// removals match by path as well as name, re-read what's left
+	count, err := r.RefCount()
+	if err != nil {
+		return err
+	}
+	refs, err := r.References(0, count)
+	if err != nil {
+		return err
+	}
+	prev := map[string]reporef.DatasetRef{}
+	entries := map[string]int{}
+	for _, ref := range refs {
+		key := refKey(ref.ProfileID.Encode(), ref.Name)
+		if _, ok := prev[key]; !ok {
+			prev[key] = ref
+		}
+		entries[key]++
+	}
+
+	for _, key := range sortedIDs(byKey) {
+		ref := byKey[key]
+		p, ok := prev[key]
+		if ok && entries[key] == 1 && p.Path == ref.Path && p.Peername == ref.Username {
+			continue
+		}
+		pid, err := profile.IDB58Decode(ref.ProfileID)
+		if err != nil {
+			return fmt.Errorf("decoding profile ID of %s: %w", ref.Alias(), err)
+		}
+		put := reporef.DatasetRef{
+			Peername:  ref.Username,
+			ProfileID: pid,
+			Name:      ref.Name,
+			Path:      ref.Path,
+		}
+		if ok {
+			put.FSIPath = p.FSIPath
+			put.Published = p.Published
+		}
+		if err := r.PutRef(put); err != nil {
+			return fmt.Errorf("putting %s: %w", ref.Alias(), err)
+		}
+		// putting replaces every matching entry, drop the duplicates
+		for i := 1; i < entries[key]; i++ {
+			if err := r.DeleteRef(put); err != nil {
+				return fmt.Errorf("removing duplicate %s: %w", ref.Alias(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func repairDscache(ctx context.Context, r repo.Repo, dc *dscache.Dscache) error {
+	count, err := r.RefCount()
+	if err != nil {
+		return err
+	}
+	refs, err := r.References(0, count)
+	if err != nil {
+		return err
+	}
+	built, err := dscache.BuildDscacheFromLogbookAndProfilesAndDsref(ctx, refs, r.Profiles(), r.Logbook(), r.Filesystem())
+	if err != nil {
+		return err
+	}
+	return dc.Assign(built)
+}
+
+func repairCollection(ctx context.Context, r repo.Repo, cs collection.Set, st *repoState) error {
+	prev := map[string]dsref.VersionInfo{}
+	for _, item := range st.collection {
+		if _, ok := st.local[item.InitID]; !ok {
+			if err := cs.Delete(ctx, st.owner, item.InitID); err != nil && !errors.Is(err, collection.ErrNotFound) {
+				return err
+			}
+			continue
+		}
+		prev[item.InitID] = item
+	}
+
+	for _, id := range sortedIDs(st.local) {
+		ref := st.local[id]
+		p, ok := prev[id]
+		if ok && p.Path == ref.Path && p.Username == ref.Username && p.Name == ref.Name {
+			continue
+		}
+		vi := ref.VersionInfo()
+		if err := collection.FillVersionInfo(ctx, r, &vi); err != nil {
+			return err
+		}
+		if ok {
+			// preserve fields the logbook doesn't track
+			vi.WorkflowID = p.WorkflowID
+			vi.DownloadCount = p.DownloadCount
+			vi.FollowerCount = p.FollowerCount
+			vi.OpenIssueCount = p.OpenIssueCount
+		}
+		if err := cs.Add(ctx, st.owner, vi); err != nil {
+			return fmt.Errorf("adding %s: %w", ref.Alias(), err)
+		}
+	}
+	return nil
+}
+
+// sortedIDs returns the keys of a reference map in sorted order
+func sortedIDs(refs map[string]dsref.Ref) []string {
+	keys := make([]string, 0, len(refs))
+	for k := range refs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
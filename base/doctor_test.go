@@ -0,0 +1,82 @@
+package base
+
+import (
+	"context"
+	"testing"
+
+	"github.com/qri-io/qri/collection"
+	"github.com/qri-io/qri/profile"
+	reporef "github.com/qri-io/qri/repo/ref"
+)
+
+func TestCheckAndRepairRepo(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepo(t)
+	ref := saveLineageDataset(t, r, "cities")
+
+	cs, err := collection.NewLocalSet(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := CheckRepo(ctx, r, nil, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Datasets != 1 {
+		t.Errorf("expected 1 logbook dataset, got %d", res.Datasets)
+	}
+	if len(res.Discrepancies) != 1 || res.Discrepancies[0].Category != DoctorCollection {
+		t.Fatalf("expected a single collection discrepancy, got: %v", res.Discrepancies)
+	}
+
+	// drop the dataset from the refstore, and add a ref the logbook doesn't know
+	if err := r.DeleteRef(reporef.DatasetRef{Peername: ref.Username, Name: ref.Name}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.PutRef(reporef.DatasetRef{Peername: "peer", ProfileID: testPeerProfile.ID, Name: "ghost", Path: "/mem/QmGhost"}); err != nil {
+		t.Fatal(err)
+	}
+	// refs the logbook doesn't record as local datasets are left in place
+	linked := reporef.DatasetRef{Peername: "peer", ProfileID: testPeerProfile.ID, Name: "linked", FSIPath: "/path/to/linked"}
+	if err := r.PutRef(linked); err != nil {
+		t.Fatal(err)
+	}
+	foreign := reporef.DatasetRef{Peername: "other", ProfileID: profile.IDB58MustDecode("QmeL2mdVka1eahKENjehK6tBxkkpk5dNQ1qMcgWi7Hrb4B"), Name: "theirs", Path: "/mem/QmTheirs"}
+	if err := r.PutRef(foreign); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err = CheckRepo(ctx, r, nil, cs); err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Categories(); got[DoctorRefstore] != 2 || got[DoctorBlockstore] != 2 {
+		t.Errorf("expected 2 refstore & 2 blockstore discrepancies, got: %v", res.Discrepancies)
+	}
+
+	if err := RepairRepo(ctx, r, nil, cs); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = CheckRepo(ctx, r, nil, cs); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Discrepancies) != 1 || res.Discrepancies[0].Path != foreign.Path {
+		t.Errorf("expected only the foreign ref's missing blocks after repair, got: %v", res.Discrepancies)
+	}
+	for _, keep := range []reporef.DatasetRef{linked, foreign} {
+		if _, err := r.GetRef(reporef.DatasetRef{Peername: keep.Peername, Name: keep.Name}); err != nil {
+			t.Errorf("expected repair to keep %s. got: %s", keep.AliasString(), err)
+		}
+	}
+	if _, err := r.GetRef(reporef.DatasetRef{Peername: "peer", Name: "ghost"}); err == nil {
+		t.Error("expected repair to remove the ref the logbook doesn't know")
+	}
+
+	vi, err := cs.Get(ctx, testPeerProfile.ID, ref.InitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vi.Path != ref.Path || vi.CommitCount != 1 {
+		t.Errorf("expected repaired collection item at %s with 1 commit, got %s with %d", ref.Path, vi.Path, vi.CommitCount)
+	}
+}
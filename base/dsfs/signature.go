@@ -0,0 +1,58 @@
+package dsfs
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/auth/key"
+)
+
+var (
+	// ErrUnsigned indicates a dataset commit has no signature
+	ErrUnsigned = errors.New("commit is not signed")
+	// ErrInvalidSignature indicates a commit signature doesn't match the
+	// contents of a dataset
+	ErrInvalidSignature = errors.New("commit signature is invalid")
+	// ErrKeyMismatch indicates a commit was checked against a key that doesn't
+	// belong to the commit author
+	ErrKeyMismatch = errors.New("key does not belong to commit author")
+)
+
+// VerifyCommitSignature checks the commit signature of a dataset against the
+// public key of the author. The dataset must be loaded from the store, so
+// component paths match those that were signed. Returned errors wrap
+// ErrUnsigned, ErrInvalidSignature or ErrKeyMismatch
+func VerifyCommitSignature(ds *dataset.Dataset, pub crypto.PubKey) error {
+	if ds == nil || ds.Commit == nil || ds.Commit.Signature == "" {
+		return ErrUnsigned
+	}
+	if pub == nil {
+		return fmt.Errorf("public key is required")
+	}
+
+	if ds.Commit.Author != nil && ds.Commit.Author.ID != "" {
+		keyID, err := key.IDFromPubKey(pub)
+		if err != nil {
+			return err
+		}
+		if keyID != ds.Commit.Author.ID {
+			return fmt.Errorf("%w: commit author is %s, key is %s", ErrKeyMismatch, ds.Commit.Author.ID, keyID)
+		}
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(ds.Commit.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: decoding signature: %s", ErrInvalidSignature, err)
+	}
+	ok, err := pub.Verify(ds.SigningBytes(), sig)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	if !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package dsfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	testkeys "github.com/qri-io/qri/auth/key/test"
+	"github.com/qri-io/qri/event"
+)
+
+func TestVerifyCommitSignature(t *testing.T) {
+	ctx := context.Background()
+	fs := qfs.NewMemFS()
+	author := testkeys.GetKeyData(10)
+	other := testkeys.GetKeyData(11)
+
+	ds := &dataset.Dataset{
+		Commit:    &dataset.Commit{Author: &dataset.User{ID: author.EncodedPeerID}},
+		Structure: &dataset.Structure{Format: "json", Schema: dataset.BaseSchemaArray},
+	}
+	ds.SetBodyFile(qfs.NewMemfileBytes("/body.json", []byte(`[]`)))
+
+	path, err := CreateDataset(ctx, fs, fs, event.NilBus, ds, nil, author.PrivKey, SaveSwitches{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadDataset(ctx, fs, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyCommitSignature(got, author.PrivKey.GetPublic()); err != nil {
+		t.Errorf("expected valid signature, got: %s", err)
+	}
+
+	if err := VerifyCommitSignature(got, other.PrivKey.GetPublic()); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("expected key mismatch error, got: %v", err)
+	}
+
+	got.Commit.Author = nil
+	if err := VerifyCommitSignature(got, other.PrivKey.GetPublic()); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected invalid signature error checking against another key, got: %v", err)
+	}
+
+	got.Commit.Author = &dataset.User{ID: author.EncodedPeerID}
+	got.Commit.Timestamp = got.Commit.Timestamp.AddDate(0, 0, 1)
+	if err := VerifyCommitSignature(got, author.PrivKey.GetPublic()); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected invalid signature error for altered commit, got: %v", err)
+	}
+
+	got.Commit.Signature = ""
+	if err := VerifyCommitSignature(got, author.PrivKey.GetPublic()); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("expected unsigned error, got: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	blockservice "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-ipfs/core/corerepo"
+	"github.com/ipfs/go-ipfs/gc"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	"github.com/qri-io/qfs/qipfs"
+	"github.com/qri-io/qri/dscache"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/repo"
+)
+
+// ErrGCUnsupported indicates the repo's storage does not support garbage
+// collection
+var ErrGCUnsupported = errors.New("garbage collection requires a local IPFS filesystem")
+
+// ipfsInitPaths are paths auto-added on IPFS init that garbage collection
+// always leaves in place
+var ipfsInitPaths = []string{
+	"/ipfs/QmQPeNsJPyVWPFDVHb77w8G42Fvo15z4bG2X8D2GhfbSXc",
+	"/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn",
+	"/ipfs/QmS4ustL54uo8FzR9455qaxZwuMiUhyvMcX9Ba8nUH4uVv",
+}
+
+// GCResult summarizes a garbage collection pass
+type GCResult struct {
+	// DryRun is true if no data was removed
+	DryRun bool `json:"dryRun"`
+	// number of dataset paths referenced by logbook, refstore & dscache
+	LivePaths int `json:"livePaths"`
+	// pinned paths that no qri store references. these are unpinned by
+	// garbage collection
+	Unreferenced []string `json:"unreferenced"`
+	// number of blocks collection removes, or would remove in a dry run
+	Blocks int `json:"blocks"`
+	// number of bytes collection frees, or would free in a dry run
+	Size int64 `json:"size"`
+	// number of runs with recorded http responses collection removes, or
+	// would remove in a dry run. Responses are removed with the version the
+	// run created
+	Responses int `json:"responses"`
+}
+
+// LiveDatasetPaths collects the set of dataset version paths referenced by any
+// of logbook, refstore or dscache. Paths in the returned set are reachable
+// and must not be garbage collected
+func LiveDatasetPaths(ctx context.Context, r repo.Repo, dc *dscache.Dscache) (map[string]struct{}, error) {
+	live, err := r.Logbook().AllReferencedDatasetPaths(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading logbook: %w", err)
+	}
+
+	count, err := r.RefCount()
+	if err != nil {
+		return nil, fmt.Errorf("reading refstore: %w", err)
+	}
+	refs, err := r.References(0, count)
+	if err != nil {
+		return nil, fmt.Errorf("reading refstore: %w", err)
+	}
+	for _, ref := range refs {
+		if ref.Path != "" {
+			live[ref.Path] = struct{}{}
+		}
+	}
+
+	if !dc.IsEmpty() {
+		refs, err := dc.ListRefs()
+		if err != nil {
+			return nil, fmt.Errorf("reading dscache: %w", err)
+		}
+		for _, ref := range refs {
+			if ref.Path != "" {
+				live[ref.Path] = struct{}{}
+			}
+		}
+	}
+
+	return live, nil
+}
+
+// GarbageCollect unpins every pinned root in the repo's IPFS store that isn't
+// in the live set of paths, then removes all unreachable blocks from the
+// blockstore. When dryRun is true GarbageCollect only reports what would be
+// removed. Progress is published on the repo's event bus
+func GarbageCollect(ctx context.Context, r repo.Repo, live map[string]struct{}, dryRun bool) (*GCResult, error) {
+	ipfs, ok := r.Filesystem().Filesystem(qipfs.FilestoreType).(*qipfs.Filestore)
+	if !ok || ipfs.Node() == nil {
+		return nil, ErrGCUnsupported
+	}
+	node := ipfs.Node()
+	bus := r.Bus()
+
+	keep := map[string]struct{}{}
+	for _, p := range ipfsInitPaths {
+		keep[pathCid(p)] = struct{}{}
+	}
+	// dataset versions aren't always pinned, so live paths are also treated
+	// as roots. roots that aren't stored locally are skipped
+	roots := []cid.Cid{}
+	for p := range live {
+		id, err := cid.Decode(pathCid(p))
+		if err != nil {
+			continue
+		}
+		keep[id.String()] = struct{}{}
+		roots = append(roots, id)
+	}
+	if mfsRoots, err := corerepo.BestEffortRoots(node.FilesRoot); err == nil {
+		roots = append(roots, mfsRoots...)
+	}
+
+	res := &GCResult{
+		DryRun:       dryRun,
+		LivePaths:    len(live),
+		Unreferenced: []string{},
+	}
+	progress := event.RepoGCEvent{DryRun: dryRun}
+	publishGCEvent(ctx, bus, event.ETRepoGCStarted, progress)
+
+	pinned, err := node.Pinning.RecursiveKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range pinned {
+		if _, ok := keep[id.String()]; ok {
+			roots = append(roots, id)
+			continue
+		}
+		res.Unreferenced = append(res.Unreferenced, fmt.Sprintf("/ipfs/%s", id))
+	}
+
+	if dryRun {
+		// everything reachable from a root survives collection
+		reachable := cid.NewSet()
+		ng := merkledag.NewDAGService(blockservice.New(node.Blockstore, offline.Exchange(node.Blockstore)))
+		getLinks := func(ctx context.Context, id cid.Cid) ([]*ipld.Link, error) {
+			links, err := ipld.GetLinks(ctx, ng, id)
+			if errors.Is(err, ipld.ErrNotFound) {
+				return nil, nil
+			}
+			return links, err
+		}
+		for _, id := range roots {
+			if err := merkledag.Walk(ctx, getLinks, id, reachable.Visit); err != nil {
+				return nil, err
+			}
+		}
+		direct, err := node.Pinning.DirectKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range direct {
+			reachable.Add(id)
+		}
+
+		keys, err := node.Blockstore.AllKeysChan(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for id := range keys {
+			if reachable.Has(id) {
+				continue
+			}
+			size, err := node.Blockstore.GetSize(id)
+			if err != nil {
+				continue
+			}
+			res.Blocks++
+			res.Size += int64(size)
+		}
+		progress.Unpinned = len(res.Unreferenced)
+		progress.BlocksRemoved = res.Blocks
+		progress.Size = res.Size
+		err = bus.Publish(ctx, event.ETRepoGCCompleted, progress)
+		return res, err
+	}
+
+	before, _ := node.Repo.GetStorageUsage()
+	for _, p := range res.Unreferenced {
+		if err := ipfs.Unpin(ctx, p, true); err != nil {
+			log.Debugf("unpinning %q: %s", p, err)
+			continue
+		}
+		progress.Unpinned++
+		publishGCEvent(ctx, bus, event.ETRepoGCProgress, progress)
+	}
+
+	removed := gc.GC(ctx, node.Blockstore, node.Repo.Datastore(), node.Pinning, roots)
+	gcErr := corerepo.CollectResult(ctx, removed, func(id cid.Cid) {
+		res.Blocks++
+		progress.BlocksRemoved = res.Blocks
+		publishGCEvent(ctx, bus, event.ETRepoGCProgress, progress)
+	})
+	if after, err := node.Repo.GetStorageUsage(); err == nil && after < before {
+		res.Size = int64(before - after)
+	}
+	progress.Size = res.Size
+	progress.Error = gcErr
+	publishGCEvent(ctx, bus, event.ETRepoGCCompleted, progress)
+	return res, gcErr
+}
+
+// publishGCEvent publishes garbage collection progress. Publishing errors
+// shouldn't interrupt collection
+func publishGCEvent(ctx context.Context, bus event.Publisher, typ event.Type, e event.RepoGCEvent) {
+	if err := bus.Publish(ctx, typ, e); err != nil {
+		log.Debugf("publishing %s: %s", typ, err)
+	}
+}
+
+// pathCid returns the root content identifier of an IPFS path string
+func pathCid(p string) string {
+	p = strings.TrimPrefix(p, "/ipfs/")
+	p = strings.TrimPrefix(p, "/ipld/")
+	return strings.SplitN(p, "/", 2)[0]
+}
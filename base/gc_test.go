@@ -0,0 +1,24 @@
+package base
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLiveDatasetPaths(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepo(t)
+	ref := addCitiesDataset(t, r)
+
+	live, err := LiveDatasetPaths(ctx, r, r.Dscache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := live[ref.Path]; !ok {
+		t.Errorf("expected live paths to include saved version %q", ref.Path)
+	}
+
+	if _, err := GarbageCollect(ctx, r, live, true); err != ErrGCUnsupported {
+		t.Errorf("expected garbage collecting a memory repo to return ErrGCUnsupported, got: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/repo"
+)
+
+// Lineage is a graph of dataset versions connected by transforms. An edge
+// connects an input version loaded by a transform to the version the
+// transform produced
+type Lineage struct {
+	// Root is the dataset lineage was traced from
+	Root dsref.Ref `json:"root"`
+	// Nodes are dataset versions in the graph, sorted by path
+	Nodes []dsref.Ref `json:"nodes"`
+	// Edges connect inputs to outputs, sorted by input then output path
+	Edges []LineageEdge `json:"edges"`
+}
+
+// LineageEdge connects an input dataset version to a dataset version built
+// from it. Both ends are version paths
+type LineageEdge struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// LineageOptions configures which parts of a lineage graph to trace
+type LineageOptions struct {
+	// trace the datasets a version was built from
+	Upstream bool
+	// trace the datasets built from a dataset
+	Downstream bool
+	// number of steps to trace in each direction. values < 1 trace the entire
+	// graph
+	Depth int
+	// AllVersions traces downstream datasets built from any version of the
+	// root dataset, not just the version at the root path
+	AllVersions bool
+}
+
+// TransformInputs lists the dataset versions a transform loaded while running,
+// sorted by path. Transforms record inputs as transform resources
+func TransformInputs(tf *dataset.Transform) []dsref.Ref {
+	if tf == nil {
+		return nil
+	}
+	inputs := make([]dsref.Ref, 0, len(tf.Resources))
+	for key, res := range tf.Resources {
+		if res == nil {
+			continue
+		}
+		ref, err := dsref.Parse(res.Path)
+		if err != nil {
+			ref = dsref.Ref{}
+		}
+		if ref.Path == "" {
+			ref.Path = key
+		}
+		inputs = append(inputs, ref)
+	}
+	sort.Slice(inputs, func(i, j int) bool { return inputs[i].Path < inputs[j].Path })
+	return inputs
+}
+
+// DatasetLineage traces the lineage of a dataset through the transforms of
+// datasets in a repo. ref must be resolved, with a path for upstream tracing.
+// Upstream tracing only follows versions that are stored locally, downstream
+// tracing follows the versions recorded in idx
+func DatasetLineage(ctx context.Context, r repo.Repo, idx *LineageIndex, ref dsref.Ref, opts LineageOptions) (*Lineage, error) {
+	g := newLineageGraph(ref)
+
+	if opts.Upstream {
+		if ref.Path == "" {
+			return nil, fmt.Errorf("tracing upstream lineage: %w", dsref.ErrPathRequired)
+		}
+		if err := g.traceUpstream(ctx, r, ref, opts.Depth); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Downstream {
+		if idx == nil {
+			return nil, fmt.Errorf("tracing downstream lineage: no lineage index")
+		}
+		roots := []dsref.Ref{ref}
+		if opts.AllVersions {
+			items, err := r.Logbook().Items(ctx, ref, 0, -1, "history")
+			if err != nil {
+				return nil, err
+			}
+			roots = make([]dsref.Ref, 0, len(items))
+			for _, item := range items {
+				roots = append(roots, dsref.Ref{InitID: ref.InitID, Username: ref.Username, Name: ref.Name, Path: item.Path})
+			}
+		}
+		for _, root := range roots {
+			g.traceDownstream(idx, root, opts.Depth)
+		}
+	}
+
+	return g.lineage(), nil
+}
+
+type lineageGraph struct {
+	root  dsref.Ref
+	nodes map[string]dsref.Ref
+	edges map[LineageEdge]struct{}
+}
+
+func newLineageGraph(root dsref.Ref) *lineageGraph {
+	g := &lineageGraph{
+		root:  root,
+		nodes: map[string]dsref.Ref{},
+		edges: map[LineageEdge]struct{}{},
+	}
+	if root.Path != "" {
+		g.nodes[root.Path] = root
+	}
+	return g
+}
+
+func (g *lineageGraph) addEdge(input, output dsref.Ref) (added bool) {
+	e := LineageEdge{Input: input.Path, Output: output.Path}
+	if _, ok := g.edges[e]; ok {
+		return false
+	}
+	g.edges[e] = struct{}{}
+	g.nodes[input.Path] = input
+	g.nodes[output.Path] = output
+	return true
+}
+
+func (g *lineageGraph) traceUpstream(ctx context.Context, r repo.Repo, ref dsref.Ref, depth int) error {
+	inputs, err := versionInputs(ctx, r, ref.Path)
+	if err != nil {
+		return err
+	}
+	for _, input := range inputs {
+		if g.addEdge(input, ref) && depth != 1 {
+			if err := g.traceUpstream(ctx, r, input, depth-1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *lineageGraph) traceDownstream(idx *LineageIndex, ref dsref.Ref, depth int) {
+	for _, output := range idx.Dependents(ref.Path) {
+		if g.addEdge(ref, output) && depth != 1 {
+			g.traceDownstream(idx, output, depth-1)
+		}
+	}
+}
+
+func (g *lineageGraph) lineage() *Lineage {
+	l := &Lineage{
+		Root:  g.root,
+		Nodes: make([]dsref.Ref, 0, len(g.nodes)),
+		Edges: make([]LineageEdge, 0, len(g.edges)),
+	}
+	for _, n := range g.nodes {
+		l.Nodes = append(l.Nodes, n)
+	}
+	sort.Slice(l.Nodes, func(i, j int) bool { return l.Nodes[i].Path < l.Nodes[j].Path })
+	for e := range g.edges {
+		l.Edges = append(l.Edges, e)
+	}
+	sort.Slice(l.Edges, func(i, j int) bool {
+		if l.Edges[i].Input == l.Edges[j].Input {
+			return l.Edges[i].Output < l.Edges[j].Output
+		}
+		return l.Edges[i].Input < l.Edges[j].Input
+	})
+	return l
+}
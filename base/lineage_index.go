@@ -0,0 +1,215 @@
+package base
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/qri-io/qri/base/dsfs"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/repo"
+	reporef "github.com/qri-io/qri/repo/ref"
+)
+
+// DefaultLineageIndexFilename is the name of the file a lineage index is kept
+// in, within the repo directory
+const DefaultLineageIndexFilename = "lineage.json"
+
+// LineageIndex maps dataset versions to the versions transforms built from
+// them, so downstream lineage can be traced without loading every version in
+// a repo. The index is kept up to date by listening for commits on the repo
+// event bus. LineageIndex is safe for concurrent use
+type LineageIndex struct {
+	mu   sync.Mutex
+	r    repo.Repo
+	path string
+	// dependents maps input version paths to the versions built from them
+	dependents map[string][]dsref.Ref
+}
+
+// NewLineageIndex creates a lineage index for a repo. An index with a path is
+// read from & written to a file. When no index file exists, the index is
+// built once from the history of every dataset in the repo
+func NewLineageIndex(ctx context.Context, r repo.Repo, path string) (*LineageIndex, error) {
+	idx := &LineageIndex{
+		r:          r,
+		path:       path,
+		dependents: map[string][]dsref.Ref{},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if path != "" && err == nil {
+		if err := json.Unmarshal(data, &idx.dependents); err != nil {
+			return nil, fmt.Errorf("reading lineage index: %w", err)
+		}
+	} else if path == "" || os.IsNotExist(err) {
+		if err := idx.build(ctx); err != nil {
+			return nil, err
+		}
+		if err := idx.save(); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	r.Bus().SubscribeTypes(idx.handler,
+		event.ETLogbookWriteCommit,
+		event.ETDatasetDeleteAll,
+	)
+	return idx, nil
+}
+
+// Dependents lists the dataset versions built from the version at path
+func (idx *LineageIndex) Dependents(path string) []dsref.Ref {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	deps := idx.dependents[path]
+	res := make([]dsref.Ref, len(deps))
+	copy(res, deps)
+	return res
+}
+
+func (idx *LineageIndex) handler(ctx context.Context, e event.Event) error {
+	switch e.Type {
+	case event.ETLogbookWriteCommit:
+		vi, ok := e.Payload.(dsref.VersionInfo)
+		if !ok {
+			log.Debugw("lineage index: unexpected payload", "type", e.Type)
+			return nil
+		}
+		output := dsref.Ref{InitID: vi.InitID, Username: vi.Username, Name: vi.Name, Path: vi.Path}
+		inputs, err := versionInputs(ctx, idx.r, output.Path)
+		if err != nil {
+			log.Debugw("lineage index: reading inputs", "path", output.Path, "err", err)
+			return nil
+		}
+		if len(inputs) == 0 {
+			return nil
+		}
+		idx.mu.Lock()
+		defer idx.mu.Unlock()
+		for _, input := range inputs {
+			idx.add(input.Path, output)
+		}
+		if err := idx.save(); err != nil {
+			log.Debugw("lineage index: saving", "err", err)
+		}
+	case event.ETDatasetDeleteAll:
+		initID, ok := e.Payload.(string)
+		if !ok {
+			log.Debugw("lineage index: unexpected payload", "type", e.Type)
+			return nil
+		}
+		idx.mu.Lock()
+		defer idx.mu.Unlock()
+		for input, deps := range idx.dependents {
+			kept := deps[:0]
+			for _, d := range deps {
+				if d.InitID != initID {
+					kept = append(kept, d)
+				}
+			}
+			if len(kept) == 0 {
+				delete(idx.dependents, input)
+			} else {
+				idx.dependents[input] = kept
+			}
+		}
+		if err := idx.save(); err != nil {
+			log.Debugw("lineage index: saving", "err", err)
+		}
+	}
+	return nil
+}
+
+// build fills the index from the history of every dataset in the repo
+func (idx *LineageIndex) build(ctx context.Context) error {
+	count, err := idx.r.RefCount()
+	if err != nil {
+		return err
+	}
+	refs, err := idx.r.References(0, count)
+	if err != nil {
+		return err
+	}
+
+	for _, rr := range refs {
+		ref := reporef.ConvertToDsref(rr)
+		if ref.InitID, err = idx.r.Logbook().RefToInitID(ref); err != nil {
+			log.Debugw("building lineage index: resolving initID", "ref", ref.Human(), "err", err)
+			continue
+		}
+		history, err := idx.r.Logbook().Items(ctx, ref, 0, -1, "history")
+		if err != nil {
+			log.Debugw("building lineage index: reading history", "ref", ref.Human(), "err", err)
+			continue
+		}
+		for _, item := range history {
+			inputs, err := versionInputs(ctx, idx.r, item.Path)
+			if err != nil {
+				continue
+			}
+			output := dsref.Ref{InitID: ref.InitID, Username: ref.Username, Name: ref.Name, Path: item.Path}
+			for _, input := range inputs {
+				idx.add(input.Path, output)
+			}
+		}
+	}
+	return nil
+}
+
+// add records a version built from an input, ignoring duplicates. callers
+// must hold the lock
+func (idx *LineageIndex) add(input string, output dsref.Ref) {
+	for _, d := range idx.dependents[input] {
+		if d.Path == output.Path {
+			return
+		}
+	}
+	idx.dependents[input] = append(idx.dependents[input], output)
+}
+
+// save writes the index to disk if it has a path. callers must hold the lock
+func (idx *LineageIndex) save() error {
+	if idx.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(idx.dependents)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := idx.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.path)
+}
+
+// versionInputs lists the inputs of the transform that built a version.
+// Versions that aren't stored locally have no known inputs
+func versionInputs(ctx context.Context, r repo.Repo, path string) ([]dsref.Ref, error) {
+	fs := r.Filesystem()
+	if local, err := fs.Has(ctx, path); err != nil || !local {
+		return nil, err
+	}
+	ds, err := dsfs.LoadDatasetRefs(ctx, fs, path)
+	if err != nil {
+		return nil, err
+	}
+	if ds.Transform == nil {
+		return nil, nil
+	}
+	if err := dsfs.DerefTransform(ctx, fs, ds); err != nil {
+		return nil, err
+	}
+	return TransformInputs(ds.Transform), nil
+}
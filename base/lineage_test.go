@@ -0,0 +1,178 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qfs/muxfs"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/repo"
+)
+
+func TestTransformInputs(t *testing.T) {
+	tf := &dataset.Transform{Resources: map[string]*dataset.TransformResource{
+		"/mem/QmB": {Path: "peer/b@/mem/QmB"},
+		"/mem/QmA": {Path: "/mem/QmA"},
+		"/mem/QmC": nil,
+	}}
+	expect := []dsref.Ref{
+		{Path: "/mem/QmA"},
+		{Username: "peer", Name: "b", Path: "/mem/QmB"},
+	}
+	if diff := cmp.Diff(expect, TransformInputs(tf)); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+	if TransformInputs(nil) != nil {
+		t.Error("expected nil transform to have no inputs")
+	}
+}
+
+func TestDatasetLineage(t *testing.T) {
+	ctx := context.Background()
+	r := newLineageTestRepo(t)
+
+	// a <- b <- c, with d built from both a & c
+	a := saveLineageDataset(t, r, "lineage_a")
+	b := saveLineageDataset(t, r, "lineage_b", a)
+	c := saveLineageDataset(t, r, "lineage_c", b)
+	d := saveLineageDataset(t, r, "lineage_d", a, c)
+
+	// build an index from the existing history, then check new commits are
+	// added to the index as they're written
+	idx, err := NewLineageIndex(ctx, r, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := saveLineageDataset(t, r, "lineage_e", d)
+
+	cases := []struct {
+		description string
+		ref         dsref.Ref
+		opts        LineageOptions
+		expect      []LineageEdge
+	}{
+		{"upstream of d", d, LineageOptions{Upstream: true}, []LineageEdge{
+			{a.Path, b.Path}, {a.Path, d.Path}, {b.Path, c.Path}, {c.Path, d.Path},
+		}},
+		{"upstream of d, depth 1", d, LineageOptions{Upstream: true, Depth: 1}, []LineageEdge{
+			{a.Path, d.Path}, {c.Path, d.Path},
+		}},
+		{"downstream of a", a, LineageOptions{Downstream: true}, []LineageEdge{
+			{a.Path, b.Path}, {a.Path, d.Path}, {b.Path, c.Path}, {c.Path, d.Path}, {d.Path, e.Path},
+		}},
+		{"downstream of c, depth 1", c, LineageOptions{Downstream: true, Depth: 1}, []LineageEdge{
+			{c.Path, d.Path},
+		}},
+		{"both directions from b, depth 1", b, LineageOptions{Upstream: true, Downstream: true, Depth: 1}, []LineageEdge{
+			{a.Path, b.Path}, {b.Path, c.Path},
+		}},
+		{"no lineage", a, LineageOptions{Upstream: true}, []LineageEdge{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			l, err := DatasetLineage(ctx, r, idx, c.ref, c.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(sortEdges(c.expect), l.Edges); diff != "" {
+				t.Errorf("edges mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := DatasetLineage(ctx, r, idx, dsref.Ref{InitID: a.InitID}, LineageOptions{Upstream: true}); err == nil {
+		t.Error("expected tracing upstream without a path to error")
+	}
+}
+
+// newLineageTestRepo creates a test repo with an event bus, so lineage indexes
+// see new commits
+func newLineageTestRepo(t *testing.T) repo.Repo {
+	t.Helper()
+	ctx := context.Background()
+	mux, err := muxfs.New(ctx, []qfs.Config{{Type: "mem"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := repo.NewMemRepoWithProfile(ctx, testPeerProfile, mux, event.NewBus(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// saveLineageDataset saves a dataset with a transform that records inputs as
+// loaded datasets
+func saveLineageDataset(t *testing.T, r repo.Repo, name string, inputs ...dsref.Ref) dsref.Ref {
+	t.Helper()
+	ctx := context.Background()
+	author := r.Profiles().Owner(ctx)
+	initID, err := r.Logbook().WriteDatasetInit(ctx, author, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds := &dataset.Dataset{
+		Peername:  author.Peername,
+		Name:      name,
+		Commit:    &dataset.Commit{Title: "initial commit"},
+		Structure: &dataset.Structure{Format: "json", Schema: dataset.BaseSchemaArray},
+	}
+	if len(inputs) > 0 {
+		ds.Transform = &dataset.Transform{Syntax: "starlark", Resources: map[string]*dataset.TransformResource{}}
+		for _, in := range inputs {
+			ds.Transform.Resources[in.Path] = &dataset.TransformResource{Path: fmt.Sprintf("%s/%s@%s", in.Username, in.Name, in.Path)}
+		}
+	}
+	ds.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte(`["`+name+`"]`)))
+
+	res, err := SaveDataset(ctx, r, r.Filesystem().DefaultWriteFS(), author, initID, "", ds, nil, SaveSwitches{Pin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dsref.Ref{InitID: initID, Username: author.Peername, Name: name, Path: res.Path}
+}
+
+func TestLineageIndexFile(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepo(t)
+	a := saveLineageDataset(t, r, "lineage_a")
+	b := saveLineageDataset(t, r, "lineage_b", a)
+
+	dir, err := ioutil.TempDir("", "TestLineageIndexFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, DefaultLineageIndexFilename)
+
+	if _, err := NewLineageIndex(ctx, r, path); err != nil {
+		t.Fatal(err)
+	}
+	// a second index reads the file instead of scanning the repo
+	idx, err := NewLineageIndex(ctx, r, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []dsref.Ref{b}
+	if diff := cmp.Diff(expect, idx.Dependents(a.Path)); diff != "" {
+		t.Errorf("dependents mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func sortEdges(edges []LineageEdge) []LineageEdge {
+	g := newLineageGraph(dsref.Ref{})
+	for _, e := range edges {
+		g.edges[e] = struct{}{}
+	}
+	return g.lineage().Edges
+}
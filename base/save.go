@@ -87,6 +87,11 @@ func SaveDataset(
 	}
 
 	if !sw.Replace {
+		// transform resources list the inputs of a single run. a new run
+		// replaces the resources of the previous version instead of adding to them
+		if runState != nil && mutable.Transform != nil {
+			mutable.Transform.Resources = nil
+		}
 		// Treat the changes as a set of patches applied to the previous dataset
 		mutable.Assign(changes)
 		changes = mutable
@@ -0,0 +1,183 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/base/dsfs"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/profile"
+	"github.com/qri-io/qri/repo"
+)
+
+// SignatureStatus is the outcome of checking a commit signature
+type SignatureStatus string
+
+const (
+	// SignatureValid means the commit was signed by the key of its author
+	SignatureValid SignatureStatus = "valid"
+	// SignatureUnsigned means the commit has no signature
+	SignatureUnsigned SignatureStatus = "unsigned"
+	// SignatureInvalid means the signature doesn't match the contents of the
+	// version
+	SignatureInvalid SignatureStatus = "invalid"
+	// SignatureKeyMismatch means the known key for the commit author doesn't
+	// belong to the author, or the commit author isn't the dataset author
+	SignatureKeyMismatch SignatureStatus = "key-mismatch"
+	// SignatureUnknownKey means no public key is known for the commit author,
+	// so the signature can't be checked
+	SignatureUnknownKey SignatureStatus = "unknown-key"
+	// SignatureNotStored means the version isn't stored locally, so it can't
+	// be checked
+	SignatureNotStored SignatureStatus = "not-stored"
+)
+
+// SignatureCheck is the result of checking the commit signature of a single
+// dataset version
+type SignatureCheck struct {
+	Path      string          `json:"path"`
+	Author    string          `json:"author,omitempty"`
+	Timestamp time.Time       `json:"timestamp,omitempty"`
+	Status    SignatureStatus `json:"status"`
+	Message   string          `json:"message,omitempty"`
+}
+
+// Err returns an error describing a failed check, nil if the signature is
+// valid
+func (c SignatureCheck) Err() error {
+	if c.Status == SignatureValid {
+		return nil
+	}
+	return fmt.Errorf("version %s: %s", c.Path, c.Message)
+}
+
+// SignaturePolicy determines what happens to dataset versions that fail a
+// signature check when they're fetched from other peers
+type SignaturePolicy string
+
+const (
+	// SignaturePolicyWarn logs failed signature checks and keeps the version
+	SignaturePolicyWarn SignaturePolicy = "warn"
+	// SignaturePolicyReject refuses versions that aren't signed by a known key
+	// of their author
+	SignaturePolicyReject SignaturePolicy = "reject"
+)
+
+// ParseSignaturePolicy reads a policy from a string. the empty string is the
+// default "warn" policy
+func ParseSignaturePolicy(s string) (SignaturePolicy, error) {
+	switch SignaturePolicy(s) {
+	case "", SignaturePolicyWarn:
+		return SignaturePolicyWarn, nil
+	case SignaturePolicyReject:
+		return SignaturePolicyReject, nil
+	}
+	return "", fmt.Errorf("invalid signature policy %q, must be one of %q or %q", s, SignaturePolicyWarn, SignaturePolicyReject)
+}
+
+// Enforce applies a policy to a signature check, returning an error if the
+// version should be refused
+func (p SignaturePolicy) Enforce(c SignatureCheck) error {
+	if c.Status == SignatureValid {
+		return nil
+	}
+	if p == SignaturePolicyReject {
+		return fmt.Errorf("rejecting dataset: %w", c.Err())
+	}
+	log.Warnw("signature check failed", "path", c.Path, "status", c.Status, "message", c.Message)
+	return nil
+}
+
+// CheckCommitSignature verifies the commit signature of a version loaded from
+// the store against the public key of the commit author. keys are looked up
+// in the profile store. ref identifies the dataset the version belongs to,
+// using ref.ProfileID as the dataset author when set
+func CheckCommitSignature(ctx context.Context, profiles profile.Store, ref dsref.Ref, ds *dataset.Dataset) SignatureCheck {
+	c := SignatureCheck{Path: ds.Path, Author: ref.ProfileID}
+	if c.Path == "" {
+		c.Path = ref.Path
+	}
+	if ds.Commit != nil {
+		c.Timestamp = ds.Commit.Timestamp
+		if ds.Commit.Author != nil && ds.Commit.Author.ID != "" {
+			c.Author = ds.Commit.Author.ID
+		}
+	}
+
+	if ds.Commit == nil || ds.Commit.Signature == "" {
+		c.Status = SignatureUnsigned
+		c.Message = "commit is not signed"
+		return c
+	}
+	if ref.ProfileID != "" && c.Author != ref.ProfileID {
+		c.Status = SignatureKeyMismatch
+		c.Message = fmt.Sprintf("commit author %s is not the dataset author %s", c.Author, ref.ProfileID)
+		return c
+	}
+
+	pid, err := profile.IDB58Decode(c.Author)
+	if err != nil {
+		c.Status = SignatureUnknownKey
+		c.Message = fmt.Sprintf("invalid commit author %q", c.Author)
+		return c
+	}
+	pro, err := profiles.GetProfile(ctx, pid)
+	if err != nil || pro.PubKey == nil {
+		c.Status = SignatureUnknownKey
+		c.Message = fmt.Sprintf("no public key is known for author %s", c.Author)
+		return c
+	}
+
+	if err := dsfs.VerifyCommitSignature(ds, pro.PubKey); err != nil {
+		switch {
+		case errors.Is(err, dsfs.ErrKeyMismatch):
+			c.Status = SignatureKeyMismatch
+		case errors.Is(err, dsfs.ErrUnsigned):
+			c.Status = SignatureUnsigned
+		default:
+			c.Status = SignatureInvalid
+		}
+		c.Message = err.Error()
+		return c
+	}
+
+	c.Status = SignatureValid
+	return c
+}
+
+// CheckSignatureHistory checks the commit signature of every version in the
+// history of a dataset, newest first. Versions that aren't stored locally
+// are reported as SignatureNotStored
+func CheckSignatureHistory(ctx context.Context, r repo.Repo, ref dsref.Ref) ([]SignatureCheck, error) {
+	items, err := DatasetLog(ctx, r, ref, -1, 0, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := make([]SignatureCheck, 0, len(items))
+	for _, item := range items {
+		if item.Path == "" {
+			continue
+		}
+		if item.Foreign {
+			checks = append(checks, SignatureCheck{
+				Path:      item.Path,
+				Author:    ref.ProfileID,
+				Timestamp: item.CommitTime,
+				Status:    SignatureNotStored,
+				Message:   "version isn't stored locally",
+			})
+			continue
+		}
+		ds, err := dsfs.LoadDataset(ctx, r.Filesystem(), item.Path)
+		if err != nil {
+			return nil, fmt.Errorf("loading version %s: %w", item.Path, err)
+		}
+		ds.Path = item.Path
+		checks = append(checks, CheckCommitSignature(ctx, r.Profiles(), ref, ds))
+	}
+	return checks, nil
+}
@@ -0,0 +1,77 @@
+package base
+
+import (
+	"context"
+	"testing"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/base/dsfs"
+	"github.com/qri-io/qri/dsref"
+)
+
+func TestCheckSignatureHistory(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepo(t)
+	addCitiesDataset(t, r)
+	ref := updateCitiesDataset(t, r, "")
+
+	checks, err := CheckSignatureHistory(ctx, r, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 2 {
+		t.Fatalf("expected 2 checks, got %d", len(checks))
+	}
+	for _, c := range checks {
+		if c.Status != SignatureValid {
+			t.Errorf("version %s: expected valid signature, got %s: %s", c.Path, c.Status, c.Message)
+		}
+	}
+
+	ds, err := dsfs.LoadDataset(ctx, r.Filesystem(), ref.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds.Commit.Author = &dataset.User{ID: ref.ProfileID}
+	other := ref
+	other.ProfileID = "QmeL2mdVka1eahKENjehK6tBxkkpk5dNQ1qMcgWi7Hrb4B"
+	if c := CheckCommitSignature(ctx, r.Profiles(), other, ds); c.Status != SignatureKeyMismatch {
+		t.Errorf("expected key mismatch checking against another dataset author, got %s", c.Status)
+	}
+
+	ds.Commit.Title = "changing titles doesn't change signing bytes"
+	ds.Commit.Timestamp = ds.Commit.Timestamp.AddDate(1, 0, 0)
+	c := CheckCommitSignature(ctx, r.Profiles(), ref, ds)
+	if c.Status != SignatureInvalid {
+		t.Errorf("expected invalid signature for altered version, got %s", c.Status)
+	}
+	if err := SignaturePolicyWarn.Enforce(c); err != nil {
+		t.Errorf("warn policy shouldn't error, got: %s", err)
+	}
+	if err := SignaturePolicyReject.Enforce(c); err == nil {
+		t.Error("expected reject policy to error")
+	}
+
+	ds.Commit.Author.ID = "QmeL2mdVka1eahKENjehK6tBxkkpk5dNQ1qMcgWi7Hrb4B"
+	unknown := dsref.Ref{Path: ref.Path}
+	if c := CheckCommitSignature(ctx, r.Profiles(), unknown, ds); c.Status != SignatureUnknownKey {
+		t.Errorf("expected unknown key for unknown author, got %s: %s", c.Status, c.Message)
+	}
+
+	ds.Commit.Signature = ""
+	if c := CheckCommitSignature(ctx, r.Profiles(), ref, ds); c.Status != SignatureUnsigned {
+		t.Errorf("expected unsigned, got %s", c.Status)
+	}
+}
+
+func TestParseSignaturePolicy(t *testing.T) {
+	for _, s := range []string{"", "warn", "reject"} {
+		if _, err := ParseSignaturePolicy(s); err != nil {
+			t.Errorf("parsing %q: %s", s, err)
+		}
+	}
+	if _, err := ParseSignaturePolicy("ignore"); err == nil {
+		t.Error("expected invalid policy to error")
+	}
+}
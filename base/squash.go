@@ -0,0 +1,109 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/qri-io/qri/automation/retention"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/profile"
+	"github.com/qri-io/qri/repo"
+)
+
+// DropVersions removes a set of versions, keyed by path, from the history of
+// a dataset. Versions are removed from logbook history only, kept versions
+// aren't re-written: their paths, authors & commit signatures are unchanged.
+// A kept version's previous path can refer to a dropped version. The latest
+// version can't be dropped. DropVersions returns the latest version of the
+// dataset. Removed versions stay in storage until garbage collection
+func DropVersions(ctx context.Context, r repo.Repo, author *profile.Profile, ref dsref.Ref, drop map[string]struct{}) (*dsref.VersionInfo, error) {
+	if ref.InitID == "" {
+		return nil, fmt.Errorf("dropping versions requires a reference with an initID")
+	}
+
+	book := r.Logbook()
+	log.Debugw("DropVersions", "initID", ref.InitID, "dropping", len(drop))
+	// the latest version is kept, leaving the refstore unchanged
+	if err := book.WriteVersionDrop(ctx, author, ref.InitID, drop); err != nil {
+		return nil, err
+	}
+
+	history, err := book.Items(ctx, ref, 0, -1, "history")
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, repo.ErrNoHistory
+	}
+	vi := history[0]
+	vi.InitID = ref.InitID
+	vi.CommitCount = len(history)
+	return &vi, nil
+}
+
+// SquashVersions collapses a range of dataset history into a single version.
+// from and to are version paths, from must be older than to. Every version
+// from up to but not including to is dropped, leaving to with the contents
+// of the range
+func SquashVersions(ctx context.Context, r repo.Repo, author *profile.Profile, ref dsref.Ref, from, to string) (*dsref.VersionInfo, int, error) {
+	history, err := r.Logbook().Items(ctx, ref, 0, -1, "history")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fromIdx, toIdx := -1, -1
+	for i, vi := range history {
+		switch vi.Path {
+		case from:
+			fromIdx = i
+		case to:
+			toIdx = i
+		}
+	}
+	if fromIdx == -1 {
+		return nil, 0, fmt.Errorf("%w: version %q", dsref.ErrRefNotFound, from)
+	}
+	if toIdx == -1 {
+		return nil, 0, fmt.Errorf("%w: version %q", dsref.ErrRefNotFound, to)
+	}
+	if fromIdx <= toIdx {
+		return nil, 0, fmt.Errorf("squash: %q must be an older version than %q", from, to)
+	}
+
+	drop := map[string]struct{}{}
+	for i := toIdx + 1; i <= fromIdx; i++ {
+		drop[history[i].Path] = struct{}{}
+	}
+	head, err := DropVersions(ctx, r, author, ref, drop)
+	return head, len(drop), err
+}
+
+// PruneVersions drops all versions of a dataset that a retention policy
+// doesn't keep, returning the number of versions removed
+func PruneVersions(ctx context.Context, r repo.Repo, author *profile.Profile, ref dsref.Ref, policy *retention.Policy, now time.Time) (int, error) {
+	history, err := r.Logbook().Items(ctx, ref, 0, -1, "history")
+	if err != nil {
+		return 0, err
+	}
+
+	times := make([]time.Time, len(history))
+	for i, vi := range history {
+		times[i] = vi.CommitTime
+	}
+
+	drop := map[string]struct{}{}
+	for i, keep := range policy.Keep(times, now) {
+		if !keep {
+			drop[history[i].Path] = struct{}{}
+		}
+	}
+	if len(drop) == 0 {
+		return 0, nil
+	}
+
+	if _, err := DropVersions(ctx, r, author, ref, drop); err != nil {
+		return 0, err
+	}
+	return len(drop), nil
+}
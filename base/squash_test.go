@@ -0,0 +1,178 @@
+package base
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qri/automation/retention"
+	"github.com/qri-io/qri/base/dsfs"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/repo"
+)
+
+func TestSquashVersions(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepo(t)
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	ref, paths := saveHourlyVersions(t, r, "squash_me", start, 5)
+
+	if _, _, err := SquashVersions(ctx, r, r.Profiles().Owner(ctx), ref, paths[3], paths[1]); err == nil {
+		t.Error("expected error squashing from a newer version to an older one")
+	}
+
+	head, n, err := SquashVersions(ctx, r, r.Profiles().Owner(ctx), ref, paths[1], paths[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 squashed versions, got %d", n)
+	}
+
+	history := historyTitles(t, r, ref)
+	expect := "version 4, version 3, version 0"
+	if history != expect {
+		t.Errorf("history mismatch.\nwant: %s\ngot:  %s", expect, history)
+	}
+	// kept versions aren't re-written
+	if diff := cmp.Diff([]string{paths[4], paths[3], paths[0]}, historyPaths(t, r, ref)); diff != "" {
+		t.Errorf("kept version paths mismatch (-want +got):\n%s", diff)
+	}
+	if head.Path != paths[4] {
+		t.Errorf("expected head to stay at %q, got %q", paths[4], head.Path)
+	}
+	assertSignedChain(t, r, head.Path, paths[0])
+}
+
+func TestPruneVersions(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepo(t)
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	ref, paths := saveHourlyVersions(t, r, "prune_me", start, 6)
+
+	// keep everything for two hours, then one version every three hours
+	policy := &retention.Policy{Rules: []retention.Rule{
+		{Within: retention.Duration(2 * time.Hour)},
+		{Every: retention.Duration(3 * time.Hour)},
+	}}
+	now := start.Add(6 * time.Hour)
+	removed, err := PruneVersions(ctx, r, r.Profiles().Owner(ctx), ref, policy, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Errorf("expected 3 versions to be removed, got %d", removed)
+	}
+
+	history := historyTitles(t, r, ref)
+	expect := "version 5, version 4, version 2"
+	if history != expect {
+		t.Errorf("history mismatch.\nwant: %s\ngot:  %s", expect, history)
+	}
+	if diff := cmp.Diff([]string{paths[5], paths[4], paths[2]}, historyPaths(t, r, ref)); diff != "" {
+		t.Errorf("kept version paths mismatch (-want +got):\n%s", diff)
+	}
+
+	removed, err = PruneVersions(ctx, r, r.Profiles().Owner(ctx), ref, policy, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 0 {
+		t.Errorf("expected pruning twice to be a no-op, removed %d versions", removed)
+	}
+}
+
+// saveHourlyVersions writes n versions of a dataset, one hour apart, returning
+// a reference and version paths ordered oldest-first
+func saveHourlyVersions(t *testing.T, r repo.Repo, name string, start time.Time, n int) (dsref.Ref, []string) {
+	t.Helper()
+	ctx := context.Background()
+	author := r.Profiles().Owner(ctx)
+	initID, err := r.Logbook().WriteDatasetInit(ctx, author, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := make([]string, 0, n)
+	prevPath := ""
+	for i := 0; i < n; i++ {
+		ds := &dataset.Dataset{
+			Peername: author.Peername,
+			Name:     name,
+			Commit: &dataset.Commit{
+				Title:     fmt.Sprintf("version %d", i),
+				Message:   fmt.Sprintf("version %d", i),
+				Timestamp: start.Add(time.Duration(i) * time.Hour),
+			},
+			Structure: &dataset.Structure{Format: "json", Schema: dataset.BaseSchemaArray},
+		}
+		ds.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte(fmt.Sprintf("[%d]", i))))
+		res, err := SaveDataset(ctx, r, r.Filesystem().DefaultWriteFS(), author, initID, prevPath, ds, nil, SaveSwitches{Pin: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		prevPath = res.Path
+		paths = append(paths, res.Path)
+	}
+
+	return dsref.Ref{InitID: initID, Username: author.Peername, Name: name, Path: prevPath}, paths
+}
+
+func historyPaths(t *testing.T, r repo.Repo, ref dsref.Ref) []string {
+	t.Helper()
+	items, err := r.Logbook().Items(context.Background(), ref, 0, -1, "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, len(items))
+	for i, item := range items {
+		paths[i] = item.Path
+	}
+	return paths
+}
+
+func historyTitles(t *testing.T, r repo.Repo, ref dsref.Ref) string {
+	t.Helper()
+	items, err := r.Logbook().Items(context.Background(), ref, 0, -1, "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := ""
+	for i, item := range items {
+		if i > 0 {
+			titles += ", "
+		}
+		titles += item.CommitTitle
+	}
+	return titles
+}
+
+// assertSignedChain walks history back from path, checking each commit
+// signature is valid, and that history ends at root
+func assertSignedChain(t *testing.T, r repo.Repo, path, root string) {
+	t.Helper()
+	ctx := context.Background()
+	pub := r.Profiles().Owner(ctx).PrivKey.GetPublic()
+	for path != root {
+		ds, err := dsfs.LoadDataset(ctx, r.Filesystem(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := base64.StdEncoding.DecodeString(ds.Commit.Signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := pub.Verify(ds.SigningBytes(), sig); !ok || err != nil {
+			t.Errorf("invalid commit signature for version %q: %v", path, err)
+		}
+		if ds.PreviousPath == "" {
+			t.Fatalf("history of %q doesn't include %q", path, root)
+		}
+		path = ds.PreviousPath
+	}
+}
@@ -3,11 +3,13 @@ package cmd
 import (
 	"context"
 	"errors"
+	"fmt"
 	"path/filepath"
 	"strings"
 
 	"github.com/qri-io/ioes"
 	"github.com/qri-io/qri/lib"
+	"github.com/qri-io/qri/transform/staticlark"
 	"github.com/spf13/cobra"
 )
 
@@ -17,6 +19,12 @@ func NewAnalyzeTransformCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Comm
 	cmd := &cobra.Command{
 		Use:   "analyze_transform",
 		Short: "analyze a transform script",
+		Long: `Analyze transform reports problems in a transform script without running it:
+unused functions, network use outside of the download step, secrets that
+reach print or dataset output, and calls that make transform output change
+between runs, like time.now() or iterating over dict.items().
+
+Use ` + "`qri apply --strict`" + ` to refuse to apply a transform that has errors.`,
 		Annotations: map[string]string{
 			"group": "dataset",
 		},
@@ -71,8 +79,16 @@ func (o *AnalyzeTransformOptions) Run() (err error) {
 	for _, msg := range res.Diagnostics {
 		if msg.Category == "unused" {
 			printWarning(o.Out, "Function unused: %s", msg.Message)
-		} else {
-			printWarning(o.Out, "Unknown warning: %s", msg.Message)
+			continue
+		}
+		line := fmt.Sprintf("%d:%d: %s: %s", msg.Pos.Line, msg.Pos.Col, msg.Category, msg.Message)
+		switch msg.Severity {
+		case staticlark.SeverityError:
+			printErr(o.Out, errors.New("error: "+line))
+		case staticlark.SeverityWarning:
+			printWarning(o.Out, "warning: %s", line)
+		default:
+			printInfo(o.Out, "%s", line)
 		}
 	}
 	return nil
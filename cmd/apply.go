@@ -1,15 +1,21 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/event"
 	"github.com/qri-io/qri/lib"
+	qhttp "github.com/qri-io/qri/lib/http"
 	"github.com/qri-io/qri/repo"
 	"github.com/spf13/cobra"
 )
@@ -24,12 +30,37 @@ func NewApplyCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
 the command completes.
 
 The apply command itself does not commit results to the repository. Use
-the --apply flag on the save command to commit results from transforms.`,
+the --apply flag on the save command to commit results from transforms.
+
+The --debug flag runs the transform with an interactive debugger. Execution
+pauses before the first line of the script, and at each line given with
+--break. When paused, the debugger shows the line and local variables,
+and reads commands from stdin:
+
+  s, step      run to the next line
+  n, next      run to the next line, stepping over function calls
+  c, continue  run to the next breakpoint
+  l, locals    print local variables
+  g, globals   print global variables
+  d, dataset   print the dataset the transform is bound to
+  q, quit      stop the transform`,
 		Example: ` # Apply a transform and display the output:
  $ qri apply --file transform.star
 
  # Apply a transform using an existing dataset version:
- $ qri apply --file transform.star me/my_dataset`,
+ $ qri apply --file transform.star me/my_dataset
+
+ # Set the "date" run parameter declared in transform config:
+ $ qri apply --param date=2021-03-01 --file transform.star me/my_dataset
+
+ # Step through a transform with the debugger, pausing before each line:
+ $ qri apply --debug --file transform.star
+
+ # Pause at lines 4 & 10 of the script, and when the script fails:
+ $ qri apply --break 4,10 --break-on-error --file transform.star
+
+ # Refuse to run a transform if analysis finds errors, like leaked secrets:
+ $ qri apply --strict --file transform.star`,
 		Annotations: map[string]string{
 			"group": "dataset",
 		},
@@ -45,6 +76,12 @@ the --apply flag on the save command to commit results from transforms.`,
 	cmd.MarkFlagRequired("file")
 	cmd.Flags().StringSliceVar(&o.Secrets, "secrets", nil, "transform secrets as comma separated key,value,key,value,... sequence")
 	cmd.Flags().BoolVar(&o.Quiet, "quiet", false, "whether to suppress output from the application")
+	cmd.Flags().StringArrayVar(&o.Params, "param", nil, "set a transform run parameter as name=value. may be repeated")
+	cmd.Flags().BoolVar(&o.NoCache, "no-cache", false, "run every transform step, ignoring cached step results")
+	cmd.Flags().BoolVar(&o.Strict, "strict", false, "fail before running if transform analysis finds errors")
+	cmd.Flags().BoolVar(&o.Debug, "debug", false, "run the transform with an interactive debugger")
+	cmd.Flags().IntSliceVar(&o.Breakpoints, "break", nil, "script line numbers to pause the debugger at")
+	cmd.Flags().BoolVar(&o.BreakOnError, "break-on-error", false, "pause the debugger when the transform fails")
 
 	return cmd
 }
@@ -59,6 +96,14 @@ type ApplyOptions struct {
 	FilePath string
 	Quiet    bool
 	Secrets  []string
+	Params   []string
+	NoCache  bool
+	Strict   bool
+
+	Debug        bool
+	Breakpoints  []int
+	BreakOnError bool
+	UsingRPC     bool
 }
 
 // Complete adds any missing configuration that can only be added just before calling Run
@@ -77,6 +122,8 @@ func (o *ApplyOptions) Complete(f Factory, args []string) (err error) {
 	if err != nil {
 		return err
 	}
+	o.Debug = o.Debug || len(o.Breakpoints) > 0 || o.BreakOnError
+	o.UsingRPC = f.HTTPClient() != nil
 	return nil
 }
 
@@ -101,11 +148,22 @@ func (o *ApplyOptions) Run() (err error) {
 		}
 	}
 
+	runParams, err := parseRunParams(o.Params...)
+	if err != nil {
+		return err
+	}
+
 	params := lib.ApplyParams{
 		Ref:          o.Refs.Ref(),
 		Transform:    &tf,
 		ScriptOutput: o.Out,
 		Wait:         true,
+		NoCache:      o.NoCache,
+		Strict:       o.Strict,
+		Params:       runParams,
+		Debug:        o.Debug,
+		Breakpoints:  o.Breakpoints,
+		BreakOnError: o.BreakOnError,
 	}
 
 	terminalWidth, terminalHeight := sizeOfTerminal()
@@ -114,7 +172,12 @@ func (o *ApplyOptions) Run() (err error) {
 		params.OutputHeight = terminalHeight
 	}
 
-	res, err := inst.Automation().Apply(ctx, &params)
+	var res *lib.ApplyResult
+	if o.Debug {
+		res, err = o.debugApply(ctx, &params)
+	} else {
+		res, err = inst.Automation().Apply(ctx, &params)
+	}
 	if err != nil {
 		return err
 	}
@@ -128,3 +191,77 @@ func (o *ApplyOptions) Run() (err error) {
 	}
 	return nil
 }
+
+// debugApply runs a transform, prompting for debugger commands each time the
+// transform pauses
+func (o *ApplyOptions) debugApply(ctx context.Context, p *lib.ApplyParams) (*lib.ApplyResult, error) {
+	if o.UsingRPC {
+		return nil, fmt.Errorf("%w - the transform debugger can't run while qri connect is running in another terminal or application", qhttp.ErrUnsupportedRPC)
+	}
+	lines := bufio.NewScanner(o.In)
+	p.DebugPrompt = func(state event.TransformDebugState) string {
+		return o.debugPrompt(state, lines)
+	}
+	return o.Instance.Automation().Apply(ctx, p)
+}
+
+// debugPrompt prints the state of a paused transform and reads commands until
+// one resumes execution
+func (o *ApplyOptions) debugPrompt(state event.TransformDebugState, lines *bufio.Scanner) (action string) {
+	if state.Error != "" {
+		printWarning(o.ErrOut, "error: %s", state.Error)
+	}
+	printInfo(o.ErrOut, "paused at line %d in %s (%s)", state.Line, state.Function, state.Reason)
+	printDebugVars(o.ErrOut, "locals", state.Locals)
+
+	for {
+		printInfoNoEndline(o.ErrOut, "(debug) ")
+		if !lines.Scan() {
+			// stop the transform when there's no more input
+			printInfo(o.ErrOut, "")
+			return event.TransformDebugStop
+		}
+		switch strings.TrimSpace(lines.Text()) {
+		case "s", "step":
+			return event.TransformDebugStep
+		case "n", "next":
+			return event.TransformDebugNext
+		case "c", "continue":
+			return event.TransformDebugContinue
+		case "q", "quit":
+			return event.TransformDebugStop
+		case "l", "locals":
+			printDebugVars(o.ErrOut, "locals", state.Locals)
+		case "g", "globals":
+			printDebugVars(o.ErrOut, "globals", state.Globals)
+		case "d", "dataset":
+			data, err := json.MarshalIndent(state.Dataset, "", " ")
+			if err != nil {
+				printErr(o.ErrOut, err)
+				continue
+			}
+			printInfo(o.ErrOut, "%s", data)
+			if !state.Committed {
+				printInfo(o.ErrOut, "dataset.commit has not been called")
+			}
+		default:
+			printInfo(o.ErrOut, "commands: (s)tep, (n)ext, (c)ontinue, (l)ocals, (g)lobals, (d)ataset, (q)uit")
+		}
+	}
+}
+
+func printDebugVars(w io.Writer, title string, vars map[string]string) {
+	if len(vars) == 0 {
+		printInfo(w, "no %s", title)
+		return
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	printInfo(w, "%s:", title)
+	for _, name := range names {
+		printInfo(w, "  %s = %s", name, vars[name])
+	}
+}
@@ -86,3 +86,56 @@ func TestApplyModifyBody(t *testing.T) {
 		t.Errorf("contents mismatch, want: %s, got: %s", expectContains, output)
 	}
 }
+
+func TestApplyDebug(t *testing.T) {
+	run := NewTestRunner(t, "test_peer_apply_debug", "qri_test_apply_debug")
+	defer run.Delete()
+
+	// step to the second line, print globals & continue to the end
+	err := run.ExecCommandWithStdin(run.Context, "qri apply --debug --file testdata/movies/tf_one_movie.star", "s\ng\nc\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	debugOutput := run.ErrStream.String()
+	for _, expect := range []string{
+		"paused at line 1 in <toplevel> (step)",
+		"paused at line 2 in <toplevel> (step)",
+		"globals:\n  ds = ",
+	} {
+		if !strings.Contains(debugOutput, expect) {
+			t.Errorf("expected debug output to contain %q, got: %s", expect, debugOutput)
+		}
+	}
+	if output := run.GetCommandOutput(); !strings.Contains(output, "Spectre") {
+		t.Errorf("expected applied dataset output, got: %s", output)
+	}
+
+	// quitting the debugger stops the transform
+	err = run.ExecCommandWithStdin(run.Context, "qri apply --break 2 --file testdata/movies/tf_one_movie.star", "q\n")
+	if err == nil {
+		t.Fatal("expected quitting the debugger to return an error")
+	}
+	if !strings.Contains(err.Error(), "stopped by debugger") {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestApplyDatasetModule(t *testing.T) {
+	run := NewTestRunner(t, "test_peer_apply_module", "qri_test_apply_module")
+	defer run.Delete()
+
+	// Save a dataset with a transform that defines shared functions
+	run.MustExec(t, "qri save --file testdata/movies/module_minutes.star --no-apply me/movie_helpers")
+
+	// Apply a transform that loads functions from the module dataset
+	output := run.MustExec(t, "qri apply --file testdata/movies/tf_load_module.star")
+	expectContains := `"2h28m"`
+	if !strings.Contains(output, expectContains) {
+		t.Errorf("contents mismatch, want: %s, got: %s", expectContains, output)
+	}
+	// the resolved module version is pinned in the transform
+	expectContains = `"module:me/movie_helpers": "test_peer_apply_module/movie_helpers@`
+	if !strings.Contains(output, expectContains) {
+		t.Errorf("expected module pin, want: %s, got: %s", expectContains, output)
+	}
+}
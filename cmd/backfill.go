@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/automation/run"
+	qerr "github.com/qri-io/qri/errors"
+	"github.com/qri-io/qri/lib"
+	"github.com/qri-io/qri/repo"
+	"github.com/spf13/cobra"
+)
+
+// backfillPollInterval is how often backfill checks the status of runs while
+// waiting for them to finish
+var backfillPollInterval = 250 * time.Millisecond
+
+// NewBackfillCommand creates a new `qri backfill` cobra command for running a
+// workflow over a range of run parameter values
+func NewBackfillCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &BackfillOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "backfill WORKFLOW --param NAME --from VALUE --to VALUE",
+		Short: "run a workflow once for each value in a range of run parameters",
+		Long: `Backfill runs the workflow of a dataset once for each value of a run parameter,
+from --from to --to inclusive. Each run saves a new version of the dataset.
+
+Run parameters are declared in the "params" section of transform config, and
+read in transform scripts with config.get. Only date & int parameters can be
+backfilled. Dates are formatted YYYY-MM-DD, and increment one day per run.
+Other parameters use their default value unless set with --set.
+
+Runs are enqueued in order & tracked as a group. When qri connect is running,
+backfill enqueues runs & exits, printing the group ID. Use --group to check
+the status of a group's runs. Otherwise backfill waits for every run to
+finish.`,
+		Example: `  # run a workflow for every day in March 2021:
+  $ qri backfill me/daily_weather --param date --from 2021-03-01 --to 2021-03-31
+
+  # set another parameter for every run:
+  $ qri backfill me/daily_weather --param date --from 2021-03-01 --to 2021-03-07 --set city=Berlin
+
+  # show the status of runs in a backfill group:
+  $ qri backfill me/daily_weather --group 4f1b1e7a-...`,
+		Annotations: map[string]string{
+			"group": "automation",
+		},
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Param, "param", "", "name of the run parameter to backfill")
+	cmd.Flags().StringVar(&o.From, "from", "", "first parameter value")
+	cmd.Flags().StringVar(&o.To, "to", "", "last parameter value")
+	cmd.Flags().StringArrayVar(&o.Set, "set", nil, "set another run parameter as name=value for every run. may be repeated")
+	cmd.Flags().StringVar(&o.Group, "group", "", "show the status of runs in a backfill group")
+
+	return cmd
+}
+
+// BackfillOptions encapsulates state for the backfill command
+type BackfillOptions struct {
+	ioes.IOStreams
+
+	Refs  *RefSelect
+	Param string
+	From  string
+	To    string
+	Set   []string
+	Group string
+
+	UsingRPC bool
+	inst     *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *BackfillOptions) Complete(f Factory, args []string) (err error) {
+	if o.inst, err = f.Instance(); err != nil {
+		return
+	}
+	if o.Refs, err = GetCurrentRefSelect(f, args, 1); err != nil {
+		// This error will be handled during validation
+		if err != repo.ErrEmptyRef {
+			return
+		}
+		err = nil
+	}
+	o.UsingRPC = f.HTTPClient() != nil
+	return
+}
+
+// Validate checks that all user input is valid
+func (o *BackfillOptions) Validate() error {
+	if o.Refs.Ref() == "" {
+		return qerr.New(lib.ErrBadArgs, "please specify a dataset workflow to backfill")
+	}
+	if o.Group != "" {
+		return nil
+	}
+	if o.Param == "" || o.From == "" || o.To == "" {
+		return qerr.New(lib.ErrBadArgs, "need --param, --from, and --to to specify the values to backfill")
+	}
+	return nil
+}
+
+// Run executes the backfill command
+func (o *BackfillOptions) Run() error {
+	ctx := context.TODO()
+	if o.Group != "" {
+		wf, err := o.inst.Automation().Workflow(ctx, &lib.WorkflowParams{Ref: o.Refs.Ref()})
+		if err != nil {
+			return err
+		}
+		runs, err := o.inst.Automation().BackfillGroup(ctx, &lib.BackfillGroupParams{
+			WorkflowID: wf.WorkflowID(),
+			GroupID:    o.Group,
+		})
+		if err != nil {
+			return err
+		}
+		printBackfillRuns(o, runs)
+		return nil
+	}
+
+	set, err := parseRunParams(o.Set...)
+	if err != nil {
+		return err
+	}
+	res, err := o.inst.Automation().Backfill(ctx, &lib.BackfillParams{
+		Ref:    o.Refs.Ref(),
+		Param:  o.Param,
+		From:   o.From,
+		To:     o.To,
+		Params: set,
+	})
+	if err != nil {
+		return err
+	}
+	printSuccess(o.ErrOut, "enqueued %d runs in backfill group %s", len(res.RunIDs), res.GroupID)
+	if o.UsingRPC {
+		return nil
+	}
+
+	// runs execute in this process, wait for them to finish before exiting
+	for {
+		runs, err := o.inst.Automation().BackfillGroup(ctx, &lib.BackfillGroupParams{
+			WorkflowID: res.WorkflowID,
+			GroupID:    res.GroupID,
+		})
+		if err != nil {
+			return err
+		}
+		if backfillDone(runs) {
+			printBackfillRuns(o, runs)
+			return nil
+		}
+		time.Sleep(backfillPollInterval)
+	}
+}
+
+func backfillDone(runs []*run.State) bool {
+	for _, r := range runs {
+		if r.Status == run.RSWaiting || r.Status == run.RSRunning {
+			return false
+		}
+	}
+	return true
+}
+
+// printBackfillRuns prints one line per run
+func printBackfillRuns(o *BackfillOptions, runs []*run.State) {
+	for _, r := range runs {
+		names := make([]string, 0, len(r.Params))
+		for name := range r.Params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		params := make([]string, len(names))
+		for j, name := range names {
+			params[j] = name + "=" + r.Params[name]
+		}
+		printInfo(o.Out, "%s\t%s\t%s", strings.Join(params, " "), r.Status, r.ID)
+	}
+}
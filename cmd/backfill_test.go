@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunParamsFlag(t *testing.T) {
+	run := NewTestRunner(t, "test_peer_run_params", "qri_test_run_params")
+	defer run.Delete()
+
+	run.MustExec(t, "qri save --apply --file testdata/movies/tf_params.json me/daily")
+	body := run.MustExec(t, "qri get body me/daily")
+	if !strings.Contains(body, "2021-01-01") {
+		t.Errorf("expected body to use default param, got: %q", body)
+	}
+
+	run.MustExec(t, "qri save --apply --param day=2021-03-02 --param count=3 me/daily")
+	body = run.MustExec(t, "qri get body me/daily")
+	if !strings.Contains(body, `["2021-03-02",3]`) {
+		t.Errorf("expected body to use set params, got: %q", body)
+	}
+
+	if err := run.ExecCommand("qri save --apply --param day=tuesday me/daily"); err == nil {
+		t.Error("expected saving with an invalid date param to fail")
+	}
+	if err := run.ExecCommand("qri save --apply --param missing=1 me/daily"); err == nil {
+		t.Error("expected saving with an undeclared param to fail")
+	}
+}
+
+func TestBackfillValidate(t *testing.T) {
+	run := NewTestRunner(t, "test_peer_backfill", "qri_test_backfill")
+	defer run.Delete()
+
+	run.MustExec(t, "qri save --apply --file testdata/movies/tf_params.json me/daily")
+
+	if err := run.ExecCommand("qri backfill me/daily --from 2021-03-01 --to 2021-03-02"); err == nil {
+		t.Error("expected backfill without --param to fail")
+	}
+	// datasets need a workflow to backfill
+	if err := run.ExecCommand("qri backfill me/daily --param day --from 2021-03-01 --to 2021-03-02"); err == nil {
+		t.Error("expected backfilling a dataset without a workflow to fail")
+	}
+}
+
+func TestParseRunParams(t *testing.T) {
+	got, err := parseRunParams("day=2021-03-01", "filter=a=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{"day": "2021-03-01", "filter": "a=b"}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := parseRunParams("day"); err == nil {
+		t.Error("expected error parsing a param without a value")
+	}
+	if _, err := parseRunParams("=1"); err == nil {
+		t.Error("expected error parsing a param without a name")
+	}
+}
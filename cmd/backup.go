@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/dustin/go-humanize"
+	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/lib"
+	"github.com/spf13/cobra"
+)
+
+// NewBackupCommand creates a `qri backup` subcommand for archiving & restoring
+// an entire repo
+func NewBackupCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &BackupOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "create & restore archives of your entire repo",
+		Long: `Backup writes your whole repo to a single archive file: the logbook, config,
+keys, collections, workflows, run history and every version of every dataset.
+Each archive includes a manifest listing a checksum for every file it holds,
+restore refuses archives that don't match their manifest.
+
+Keys are left out of the archive by default, restoring will then require your
+private key. Use --keys encrypt to protect keys with a passphrase, or
+--keys include to store them unprotected.
+
+Backups can be incremental. Pass a previous archive as --base to only store
+dataset data the previous archive doesn't already hold. Restoring an
+incremental archive requires every archive it builds on.`,
+		Annotations: map[string]string{
+			"group": "other",
+		},
+	}
+
+	create := &cobra.Command{
+		Use:   "create FILE",
+		Short: "write an archive of your repo",
+		Example: `  # back up everything but your private keys
+  $ qri backup create qri_backup.zip
+
+  # encrypt keys, only storing the latest version of each dataset
+  $ qri backup create qri_backup.zip --keys encrypt --passphrase "…" --latest-only
+
+  # store only data added since the last backup
+  $ qri backup create qri_backup_2.zip --base qri_backup.zip`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			return o.Create()
+		},
+	}
+	create.Flags().StringVar(&o.Keys, "keys", "exclude", "how to store private keys [include|exclude|encrypt]")
+	create.Flags().StringVar(&o.Passphrase, "passphrase", "", "passphrase for encrypting keys")
+	create.Flags().BoolVar(&o.LatestOnly, "latest-only", false, "only store the latest version of each dataset")
+	create.Flags().StringVar(&o.Base, "base", "", "previous archive to make an incremental backup against")
+
+	restore := &cobra.Command{
+		Use:   "restore FILE",
+		Short: "create a repo from an archive",
+		Long: `Restore creates a new repo from a backup archive. Restore won't overwrite an
+existing repo, use --repo to restore to a different location.`,
+		Example: `  # restore a backup
+  $ qri backup restore qri_backup.zip
+
+  # restore an incremental backup
+  $ qri backup restore qri_backup_2.zip --base qri_backup.zip`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.CompleteRestore(f, args); err != nil {
+				return err
+			}
+			return o.Restore()
+		},
+	}
+	restore.Flags().StringSliceVar(&o.Bases, "base", nil, "archives the backup is incremental against")
+	restore.Flags().StringVar(&o.Passphrase, "passphrase", "", "passphrase for encrypted keys")
+	restore.Flags().StringVar(&o.PrivateKey, "private-key", "", "base64-encoded private key, required if keys were excluded")
+
+	cmd.AddCommand(create, restore)
+	return cmd
+}
+
+// BackupOptions encapsulates state for the backup command
+type BackupOptions struct {
+	ioes.IOStreams
+
+	File       string
+	Keys       string
+	Passphrase string
+	LatestOnly bool
+	Base       string
+	Bases      []string
+	PrivateKey string
+
+	repoPath string
+	ctors    Constructors
+	inst     *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *BackupOptions) Complete(f Factory, args []string) (err error) {
+	if o.File, err = filepath.Abs(args[0]); err != nil {
+		return err
+	}
+	if o.Base != "" {
+		if o.Base, err = filepath.Abs(o.Base); err != nil {
+			return err
+		}
+	}
+	o.inst, err = f.Instance()
+	return err
+}
+
+// CompleteRestore configures restoring, which doesn't require an instance
+func (o *BackupOptions) CompleteRestore(f Factory, args []string) (err error) {
+	if o.File, err = filepath.Abs(args[0]); err != nil {
+		return err
+	}
+	o.repoPath = f.RepoPath()
+	o.ctors = f.Constructors()
+	return nil
+}
+
+// Create writes a backup archive
+func (o *BackupOptions) Create() error {
+	ctx := context.TODO()
+	p := &lib.BackupParams{
+		File:       o.File,
+		Keys:       o.Keys,
+		Passphrase: o.Passphrase,
+		LatestOnly: o.LatestOnly,
+		Base:       o.Base,
+	}
+	res, err := o.inst.Maintenance().Backup(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	printSuccess(o.Out, "backed up %d dataset versions to %s", len(res.Roots), res.File)
+	printInfo(o.Out, "%d files, %d blocks, %s", len(res.Files), len(res.Blocks), humanize.Bytes(uint64(res.Size())))
+	if res.Base != "" {
+		printInfo(o.Out, "%d blocks are stored in the base archive", len(res.Inherited))
+	}
+	return nil
+}
+
+// Restore creates a repo from a backup archive
+func (o *BackupOptions) Restore() error {
+	ctx := context.TODO()
+	res, err := lib.Restore(ctx, lib.RestoreParams{
+		RepoPath:     o.repoPath,
+		File:         o.File,
+		Bases:        o.Bases,
+		Passphrase:   o.Passphrase,
+		PrivateKey:   o.PrivateKey,
+		InitIPFSFunc: o.ctors.InitIPFS,
+		Generator:    o.ctors.CryptoGenerator,
+	})
+	if err != nil {
+		return err
+	}
+	printSuccess(o.Out, "restored %d dataset versions (%d blocks) to %s", res.Datasets, res.Blocks, o.repoPath)
+	return nil
+}
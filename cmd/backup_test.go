@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupCreateAndRestore(t *testing.T) {
+	run := NewTestRunner(t, "peer", "qri_test_backup")
+	defer run.Delete()
+
+	tmp := run.MakeTmpDir(t, "qri_test_backup_archives")
+	full := filepath.Join(tmp, "full.zip")
+	incremental := filepath.Join(tmp, "incremental.zip")
+	keyless := filepath.Join(tmp, "keyless.zip")
+
+	run.MustExec(t, "qri save --body testdata/movies/body_ten.csv me/movies")
+	output := run.MustExec(t, "qri backup create "+full+" --keys include")
+	if !strings.Contains(output, "backed up 1 dataset versions") {
+		t.Errorf("unexpected backup output: %q", output)
+	}
+
+	run.MustExec(t, "qri save --body testdata/movies/body_twenty.csv me/movies")
+	output = run.MustExec(t, "qri backup create "+incremental+" --base "+full+" --keys include")
+	if !strings.Contains(output, "blocks are stored in the base archive") {
+		t.Errorf("expected an incremental backup, got: %q", output)
+	}
+	expect := run.MustExec(t, "qri get body me/movies")
+	run.MustExec(t, "qri backup create "+keyless)
+
+	if err := run.ExecCommand("qri backup restore " + full); err == nil {
+		t.Error("expected restoring over an existing repo to fail")
+	}
+
+	if err := os.RemoveAll(run.RepoPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := run.ExecCommand("qri backup restore " + incremental); err == nil {
+		t.Error("expected restoring an incremental backup without its base to fail")
+	}
+	if err := run.ExecCommand("qri backup restore " + keyless); err == nil {
+		t.Error("expected restoring a backup without keys to require a private key")
+	}
+	if err := os.RemoveAll(run.RepoPath); err != nil {
+		t.Fatal(err)
+	}
+	run.MustExec(t, "qri backup restore "+incremental+" --base "+full)
+
+	if got := run.MustExec(t, "qri get body me/movies"); got != expect {
+		t.Errorf("restored body mismatch.\nwant: %q\ngot:  %q", expect, got)
+	}
+	if got := run.MustExec(t, "qri log me/movies"); strings.Count(got, "Commit:") != 2 {
+		t.Errorf("expected 2 restored versions, got: %q", got)
+	}
+}
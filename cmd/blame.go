@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/qri-io/ioes"
+	qerr "github.com/qri-io/qri/errors"
+	"github.com/qri-io/qri/lib"
+	"github.com/qri-io/qri/repo"
+	"github.com/spf13/cobra"
+)
+
+// NewBlameCommand creates a new `qri blame` cobra command for showing which
+// version last changed each row of a dataset
+func NewBlameCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &BlameOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "blame DATASET",
+		Short: "show which version last changed each row of a dataset",
+		Long: `Blame walks the history of a dataset, comparing the body of each version to
+the one before it, and reports the version that last changed each row: the
+commit, author, timestamp and run ID. With --cells blame reports each cell of
+a row as well.
+
+Rows are matched across versions by their position in the body, or by the
+value of a column when --key is set. Matching by key keeps inserted and
+removed rows from shifting the blame of every row after them.
+
+Blame reads every version it walks, walking at most 100 versions unless
+--limit is set. Use --since and --limit to walk a smaller part of a long
+history. Rows that didn't change in any version blame walked are marked
+with ^, an older version may have changed them.`,
+		Example: `  # blame each row of the latest version of a dataset
+  $ qri blame b5/world_bank_population
+
+  # match rows by country code, reporting each cell
+  $ qri blame b5/world_bank_population --key country_code --cells
+
+  # only walk versions from the last 30 days
+  $ qri blame b5/world_bank_population --since 720h
+
+  # blame a specific version, walking at most 10 versions
+  $ qri blame b5/world_bank_population@/ipfs/QmFoo --limit 10`,
+		Annotations: map[string]string{
+			"group": "dataset",
+		},
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Key, "key", "", "column that identifies rows across versions")
+	cmd.Flags().BoolVar(&o.Cells, "cells", false, "report the version that last changed each cell")
+	cmd.Flags().StringVar(&o.Since, "since", "", "only walk versions committed after a timestamp, date or duration ago")
+	cmd.Flags().IntVar(&o.Limit, "limit", lib.DefaultBlameVersions, "maximum number of versions to walk")
+	cmd.Flags().StringVar(&o.Format, "format", "text", "set output format [text|json]")
+
+	return cmd
+}
+
+// BlameOptions encapsulates state for the blame command
+type BlameOptions struct {
+	ioes.IOStreams
+
+	Refs   *RefSelect
+	Key    string
+	Cells  bool
+	Since  string
+	Limit  int
+	Format string
+
+	inst *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *BlameOptions) Complete(f Factory, args []string) (err error) {
+	if o.inst, err = f.Instance(); err != nil {
+		return
+	}
+	if o.Refs, err = GetCurrentRefSelect(f, args, 1); err != nil {
+		// This error will be handled during validation
+		if err != repo.ErrEmptyRef {
+			return
+		}
+		err = nil
+	}
+	return
+}
+
+// Validate checks that all user input is valid
+func (o *BlameOptions) Validate() error {
+	if o.Refs.Ref() == "" {
+		return qerr.New(lib.ErrBadArgs, "please specify a dataset")
+	}
+	switch o.Format {
+	case "text", "json":
+		return nil
+	default:
+		return qerr.New(lib.ErrBadArgs, fmt.Sprintf("unrecognized format %q, must be one of text or json", o.Format))
+	}
+}
+
+// Run executes the blame command
+func (o *BlameOptions) Run() error {
+	ctx := context.TODO()
+	p := &lib.BlameParams{
+		Ref:   o.Refs.Ref(),
+		Key:   o.Key,
+		Cells: o.Cells,
+		Since: o.Since,
+		Limit: o.Limit,
+	}
+	// rows are printed a page at a time
+	if o.Format == "json" {
+		printInfo(o.Out, "[")
+	}
+	first := true
+	for {
+		rows, cur, err := o.inst.Dataset().Blame(ctx, p)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := o.printRow(row, first); err != nil {
+				return err
+			}
+			first = false
+		}
+		if cur == nil {
+			break
+		}
+		p.Offset += len(rows)
+	}
+	if o.Format == "json" {
+		printInfo(o.Out, "]")
+	}
+	return nil
+}
+
+func (o *BlameOptions) printRow(row lib.RowBlame, first bool) error {
+	if o.Format == "json" {
+		data, err := json.MarshalIndent(row, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		sep := ","
+		if first {
+			sep = ""
+		}
+		printInfo(o.Out, "%s  %s", sep, data)
+		return nil
+	}
+
+	printInfo(o.Out, "%s  %s", blameVersionLine(row.Version, row.Bounded), row.Key)
+	for _, c := range row.Cells {
+		printInfo(o.Out, "    %s  %s", blameVersionLine(c.Version, c.Bounded), c.Column)
+	}
+	return nil
+}
+
+// blameVersionLine formats a version on a single line, marking versions that
+// are at the boundary of the walked history with ^
+func blameVersionLine(v lib.BlameVersion, bounded bool) string {
+	marker := " "
+	if bounded {
+		marker = "^"
+	}
+	line := fmt.Sprintf("%s%s  %s  %s", marker, shortBlamePath(v.Path), v.Timestamp.Format("2006-01-02 15:04:05"), v.Author)
+	if v.RunID != "" {
+		line += "  run:" + v.RunID
+	}
+	return line
+}
+
+// shortBlamePath trims a version path to the last 8 characters of its hash
+func shortBlamePath(path string) string {
+	if len(path) > 8 {
+		return path[len(path)-8:]
+	}
+	return path
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBlame(t *testing.T) {
+	run := NewTestRunner(t, "peer", "qri_test_blame")
+	defer run.Delete()
+
+	run.MustExec(t, "qri save --body testdata/movies/body_ten.csv me/movies")
+	run.MustExec(t, "qri save --body testdata/movies/body_twenty.csv me/movies")
+
+	output := run.MustExec(t, "qri blame me/movies --key movie_title")
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 18 {
+		t.Fatalf("expected a line for each of 18 rows, got %d:\n%s", len(lines), output)
+	}
+	if !strings.Contains(output, "peer") {
+		t.Errorf("expected blame to include the author, got: %q", output)
+	}
+
+	output = run.MustExec(t, "qri blame me/movies --key movie_title --limit 1 --cells")
+	if !strings.Contains(output, "^") || !strings.Contains(output, "duration") {
+		t.Errorf("expected bounded cell blame, got: %q", output)
+	}
+
+	output = run.MustExec(t, "qri blame me/movies --key movie_title --format json")
+	rows := []map[string]interface{}{}
+	if err := json.Unmarshal([]byte(output), &rows); err != nil {
+		t.Fatalf("expected json output to be an array of rows: %s\n%s", err, output)
+	}
+	if len(rows) != 18 {
+		t.Errorf("expected 18 json rows, got %d", len(rows))
+	}
+
+	if err := run.ExecCommand("qri blame me/movies --key not_a_column"); err == nil {
+		t.Error("expected blame with an unknown key column to error")
+	}
+	if err := run.ExecCommand("qri blame"); err == nil {
+		t.Error("expected blame without a dataset to error")
+	}
+}
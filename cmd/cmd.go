@@ -14,6 +14,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	golog "github.com/ipfs/go-log"
 	"github.com/qri-io/ioes"
@@ -137,3 +138,19 @@ func parseSecrets(secrets ...string) (map[string]string, error) {
 	}
 	return s, nil
 }
+
+// parseRunParams converts a list of name=value strings to run parameters
+func parseRunParams(params ...string) (map[string]string, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+	p := map[string]string{}
+	for _, param := range params {
+		i := strings.Index(param, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("expected param as name=value, got %q", param)
+		}
+		p[param[:i]] = param[i+1:]
+	}
+	return p, nil
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/base"
+	qerr "github.com/qri-io/qri/errors"
+	"github.com/qri-io/qri/lib"
+	"github.com/spf13/cobra"
+)
+
+// NewDoctorCommand creates a new `qri doctor` cobra command for checking the
+// repo's stores agree with each other
+func NewDoctorCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &DoctorOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "check your repo for inconsistencies",
+		Long: `Doctor checks the stores that track which datasets are in your repo agree
+with each other. The logbook is the source of truth. Doctor compares it with
+the refstore, the dataset cache & your collection, and checks the latest
+version of every referenced dataset is stored locally.
+
+Discrepancies are reported by category:
+  refstore     a reference disagrees with the logbook
+  dscache      a dataset cache entry disagrees with the logbook
+  collection   a collection item disagrees with the logbook
+  blockstore   a referenced version isn't stored locally
+
+Use --fix to rebuild the refstore, dataset cache & collection from the
+logbook. Missing blocks can't be rebuilt, pull the dataset again to restore
+them.`,
+		Example: `  # check your repo
+  $ qri doctor
+
+  # rebuild stores that disagree with the logbook
+  $ qri doctor --fix`,
+		Annotations: map[string]string{
+			"group": "other",
+		},
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().BoolVar(&o.Fix, "fix", false, "rebuild stores from the logbook")
+	cmd.Flags().StringVar(&o.Format, "format", "text", "set output format [text|json]")
+
+	return cmd
+}
+
+// DoctorOptions encapsulates state for the doctor command
+type DoctorOptions struct {
+	ioes.IOStreams
+
+	Fix    bool
+	Format string
+
+	inst *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *DoctorOptions) Complete(f Factory, args []string) (err error) {
+	o.inst, err = f.Instance()
+	return err
+}
+
+// Validate checks that all user input is valid
+func (o *DoctorOptions) Validate() error {
+	switch o.Format {
+	case "text", "json":
+		return nil
+	default:
+		return qerr.New(lib.ErrBadArgs, fmt.Sprintf("unrecognized format %q, must be one of text or json", o.Format))
+	}
+}
+
+// Run executes the doctor command
+func (o *DoctorOptions) Run() error {
+	ctx := context.TODO()
+	res, err := o.inst.Maintenance().Doctor(ctx, &lib.DoctorParams{Fix: o.Fix})
+	if err != nil {
+		return err
+	}
+
+	if o.Format == "json" {
+		data, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return err
+		}
+		printInfo(o.Out, "%s", data)
+	} else {
+		printDoctorResult(o, res)
+	}
+
+	if res.Fixed {
+		if len(res.Remaining) > 0 {
+			return fmt.Errorf("%d discrepancies remain", len(res.Remaining))
+		}
+		return nil
+	}
+	if len(res.Discrepancies) > 0 {
+		return fmt.Errorf("found %d discrepancies", len(res.Discrepancies))
+	}
+	return nil
+}
+
+func printDoctorResult(o *DoctorOptions, res *lib.DoctorResult) {
+	printInfo(o.Out, "checked %d datasets & %d paths", res.Datasets, res.Paths)
+	if len(res.Discrepancies) == 0 {
+		printSuccess(o.Out, "no discrepancies found")
+		return
+	}
+
+	counts := res.Categories()
+	for _, cat := range []base.DoctorCategory{base.DoctorRefstore, base.DoctorDscache, base.DoctorCollection, base.DoctorBlockstore} {
+		if counts[cat] == 0 {
+			continue
+		}
+		printWarning(o.Out, "%s: %d discrepancies", cat, counts[cat])
+		for _, d := range res.Discrepancies {
+			if d.Category == cat {
+				printInfo(o.Out, "  %s", d)
+			}
+		}
+	}
+
+	if !res.Fixed {
+		printInfo(o.Out, "\nrun `qri doctor --fix` to rebuild stores from the logbook")
+		return
+	}
+	if len(res.Remaining) == 0 {
+		printSuccess(o.Out, "fixed %d discrepancies", len(res.Discrepancies))
+		return
+	}
+	printWarning(o.Out, "%d discrepancies remain after fixing:", len(res.Remaining))
+	for _, d := range res.Remaining {
+		printInfo(o.Out, "  %s", d)
+	}
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	run := NewTestRunner(t, "peer", "qri_test_doctor")
+	defer run.Delete()
+
+	run.MustExec(t, "qri save --body testdata/movies/body_ten.csv me/movies")
+
+	output := run.MustExec(t, "qri doctor")
+	if !strings.Contains(output, "no discrepancies found") {
+		t.Errorf("expected a consistent repo, got: %q", output)
+	}
+
+	if err := run.ExecCommand("qri doctor --format yaml"); err == nil {
+		t.Error("expected unrecognized format to error")
+	}
+}
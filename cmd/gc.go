@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/dustin/go-humanize"
+	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/lib"
+	"github.com/spf13/cobra"
+)
+
+// NewGCCommand creates a new `qri gc` cobra command for removing unreferenced
+// data from the repo
+func NewGCCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &GCOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "remove unreferenced data from your repo",
+		Long: `GC (garbage collection) frees storage space used by data qri no longer
+references.
+
+Removing datasets or versions only marks their data as unused. GC collects the
+set of dataset versions referenced by your logbook, refstore & dataset cache,
+unpins everything else, and deletes unreachable blocks from storage.
+
+Use --dry-run to see how much space garbage collection would reclaim without
+removing anything.`,
+		Example: `  # show how much space gc would free
+  $ qri gc --dry-run
+
+  # remove unreferenced data
+  $ qri gc`,
+		Annotations: map[string]string{
+			"group": "other",
+		},
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", false, "report reclaimable space without removing data")
+
+	return cmd
+}
+
+// GCOptions encapsulates state for the gc command
+type GCOptions struct {
+	ioes.IOStreams
+
+	DryRun bool
+
+	inst *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *GCOptions) Complete(f Factory, args []string) (err error) {
+	o.inst, err = f.Instance()
+	return err
+}
+
+// Run executes the gc command
+func (o *GCOptions) Run() error {
+	ctx := context.TODO()
+	res, err := o.inst.Maintenance().GC(ctx, &lib.GCParams{DryRun: o.DryRun})
+	if err != nil {
+		return err
+	}
+
+	if res.DryRun {
+		printInfo(o.Out, "%d referenced versions", res.LivePaths)
+		printInfo(o.Out, "%d unreferenced pins", len(res.Unreferenced))
+		printInfo(o.Out, "%d runs with recorded responses of removed versions", res.Responses)
+		printSuccess(o.Out, "gc would remove %d blocks, reclaiming %s", res.Blocks, humanize.Bytes(uint64(res.Size)))
+		return nil
+	}
+	printSuccess(o.Out, "unpinned %d paths, removed %d blocks, reclaimed %s", len(res.Unreferenced), res.Blocks, humanize.Bytes(uint64(res.Size)))
+	if res.Responses > 0 {
+		printInfo(o.Out, "removed recorded responses of %d runs", res.Responses)
+	}
+	return nil
+}
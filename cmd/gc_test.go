@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGC(t *testing.T) {
+	run := NewTestRunner(t, "peer", "qri_test_gc")
+	defer run.Delete()
+
+	run.MustExec(t, "qri save --body testdata/movies/body_ten.csv me/movies")
+	run.MustExec(t, "qri save --body testdata/movies/body_twenty.csv me/movies")
+	run.MustExec(t, "qri remove --revisions 1 me/movies")
+
+	output := run.MustExec(t, "qri gc --dry-run")
+	if !strings.Contains(output, "gc would remove") {
+		t.Errorf("expected dry run output, got: %q", output)
+	}
+
+	output = run.MustExec(t, "qri gc")
+	if !strings.Contains(output, "reclaimed") || strings.Contains(output, "removed 0 blocks") {
+		t.Errorf("expected gc to remove blocks, got: %q", output)
+	}
+
+	// everything unreferenced is gone, another pass has nothing to remove
+	output = run.MustExec(t, "qri gc --dry-run")
+	if !strings.Contains(output, "0 unreferenced pins") || !strings.Contains(output, "gc would remove 0 blocks") {
+		t.Errorf("expected unreferenced blocks to be removed, got: %q", output)
+	}
+
+	// the remaining version must survive collection
+	run.MustExec(t, "qri get body me/movies")
+}
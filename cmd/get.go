@@ -35,7 +35,16 @@ dataset and its fields.`,
   $ qri get meta me/annual_pop
 
   # Print the dataset body size to the console:
-  $ qri get structure.length me/annual_pop`,
+  $ qri get structure.length me/annual_pop
+
+  # Print the name & population of body rows where population is over a million:
+  $ qri get body --where "population > 1000000" --columns name,population me/annual_pop
+
+  # Print the 10 most populous body rows as csv:
+  $ qri get body --sort -population --limit 10 --format csv me/annual_pop
+
+  # Print 100 body rows of a dataset stored on a remote, without pulling it:
+  $ qri get body --remote my_remote --offset 1000000 --limit 100 them/big_dataset`,
 		Annotations: map[string]string{
 			"group": "dataset",
 		},
@@ -53,6 +62,9 @@ dataset and its fields.`,
 	cmd.Flags().IntVar(&o.Limit, "limit", -1, "for body, limit how many entries to get per request")
 	cmd.Flags().IntVar(&o.Offset, "offset", -1, "for body, offset amount at which to get entries")
 	cmd.Flags().BoolVarP(&o.All, "all", "a", true, "for body, whether to get all entries")
+	cmd.Flags().StringVar(&o.Where, "where", "", "for body, only get entries that match a predicate, eg: \"pop > 1000 and country = 'CA'\"")
+	cmd.Flags().StringVar(&o.Columns, "columns", "", "for body, comma-separated list of columns to get")
+	cmd.Flags().StringVar(&o.Sort, "sort", "", "for body, column to sort entries by, prefix with '-' to sort descending")
 	cmd.Flags().StringVarP(&o.Outfile, "outfile", "o", "", "file to write output to")
 
 	cmd.Flags().BoolVar(&o.Offline, "offline", false, "prevent network access")
@@ -73,6 +85,10 @@ type GetOptions struct {
 	Offset int
 	All    bool
 
+	Where   string
+	Columns string
+	Sort    string
+
 	Pretty  bool
 	Outfile string
 
@@ -118,6 +134,9 @@ func (o *GetOptions) Complete(f Factory, args []string) (err error) {
 		if !o.All {
 			return fmt.Errorf("can only use --all flag when getting body")
 		}
+		if o.Where != "" || o.Columns != "" || o.Sort != "" {
+			return fmt.Errorf("can only use --where, --columns & --sort flags when getting body")
+		}
 	}
 
 	return
@@ -142,6 +161,9 @@ func (o *GetOptions) Run() (err error) {
 		Ref:      o.Refs.Ref(),
 		Selector: o.Selector,
 		All:      o.All,
+		Where:    o.Where,
+		Columns:  o.Columns,
+		Sort:     o.Sort,
 		List: params.List{
 			Offset: o.Offset,
 			Limit:  o.Limit,
@@ -159,7 +181,7 @@ func (o *GetOptions) Run() (err error) {
 			o.Outfile = zipResults.GeneratedName
 		}
 	case o.Format == "csv":
-		outBytes, err = o.inst.Dataset().GetCSV(ctx, p)
+		outBytes, err = o.inst.WithSource(o.Remote).Dataset().GetCSV(ctx, p)
 		if err != nil {
 			return err
 		}
@@ -438,6 +438,17 @@ func TestGetDatasetFromRepo(t *testing.T) {
 		t.Errorf("unexpected (-want +got):\n%s", diff)
 	}
 
+	// Filter, project & sort the body
+	output = run.MustExec(t, fmt.Sprintf(`qri get body %s --where duration>=160 --columns movie_title --sort -duration`, ref))
+	expect = `[["Avatar "],["Pirates of the Caribbean: At World's End "],["The Dark Knight Rises "]]
+`
+	if diff := cmp.Diff(expect, output); diff != "" {
+		t.Errorf("unexpected (-want +got):\n%s", diff)
+	}
+
+	if err := run.ExecCommand("qri get meta me/my_ds --where duration>1"); err == nil {
+		t.Error("expected --where to fail when not getting body")
+	}
 }
 
 func TestGetDatasetUsingDscache(t *testing.T) {
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/base/params"
+	"github.com/qri-io/qri/lib"
+	"github.com/spf13/cobra"
+)
+
+// NewJobsCommand creates a `qri jobs` subcommand for inspecting & canceling
+// background jobs
+func NewJobsCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &JobsOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "show & cancel background jobs",
+		Long: `Jobs are long-running commands like save, pull, push, render & apply that run
+in the background on a qri node. API clients start a job by adding ?async=true
+to the request. Jobs only exist while the node that runs them is running, use
+jobs with a node started by 'qri connect'.
+
+With no subcommand, jobs lists jobs you've started, newest first.`,
+		Example: `  # list running jobs
+  $ qri jobs --status running
+
+  # show a job's progress & result
+  $ qri jobs get 6b9a4f5e-6c3b-4f2a-9d0e-1c2b3a4d5e6f
+
+  # stop a job
+  $ qri jobs cancel 6b9a4f5e-6c3b-4f2a-9d0e-1c2b3a4d5e6f`,
+		Annotations: map[string]string{
+			"group": "other",
+		},
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f); err != nil {
+				return err
+			}
+			return o.List()
+		},
+	}
+	cmd.Flags().StringVar(&o.Status, "status", "", "only list jobs with status [running|succeeded|failed|canceled]")
+	cmd.Flags().IntVar(&o.Limit, "limit", 25, "maximum number of jobs to list")
+	cmd.Flags().IntVar(&o.Offset, "offset", 0, "number of jobs to skip")
+
+	get := &cobra.Command{
+		Use:   "get ID",
+		Short: "show a job",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f); err != nil {
+				return err
+			}
+			return o.Get(args[0])
+		},
+	}
+
+	cancel := &cobra.Command{
+		Use:   "cancel ID",
+		Short: "stop a running job",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f); err != nil {
+				return err
+			}
+			return o.Cancel(args[0])
+		},
+	}
+
+	cmd.AddCommand(get, cancel)
+	return cmd
+}
+
+// JobsOptions encapsulates state for the jobs command
+type JobsOptions struct {
+	ioes.IOStreams
+
+	Status string
+	Limit  int
+	Offset int
+
+	inst *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *JobsOptions) Complete(f Factory) (err error) {
+	o.inst, err = f.Instance()
+	return err
+}
+
+// List prints jobs
+func (o *JobsOptions) List() error {
+	ctx := context.TODO()
+	p := &lib.ListJobsParams{
+		List:   params.List{Limit: o.Limit, Offset: o.Offset},
+		Status: lib.JobStatus(o.Status),
+	}
+	jobs, err := o.inst.Job().List(ctx, p)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		printInfo(o.Out, "no jobs")
+		return nil
+	}
+
+	data := make([][]string, len(jobs))
+	for i, j := range jobs {
+		data[i] = []string{j.ID, j.Method, string(j.Status), humanize.Time(j.Started), jobDuration(j)}
+	}
+	buf := &bytes.Buffer{}
+	renderTable(buf, []string{"id", "method", "status", "started", "duration"}, data)
+	return printToPager(o.Out, buf)
+}
+
+// Get prints a single job
+func (o *JobsOptions) Get(id string) error {
+	ctx := context.TODO()
+	job, err := o.inst.Job().Get(ctx, &lib.JobParams{ID: id})
+	if err != nil {
+		return err
+	}
+	return o.printJob(job)
+}
+
+// Cancel stops a job
+func (o *JobsOptions) Cancel(id string) error {
+	ctx := context.TODO()
+	job, err := o.inst.Job().Cancel(ctx, &lib.JobParams{ID: id})
+	if err != nil {
+		return err
+	}
+	if job.Status == lib.JobStatusCanceled {
+		printSuccess(o.Out, "canceled job %s", job.ID)
+	} else {
+		printWarning(o.Out, "job %s already %s", job.ID, job.Status)
+	}
+	return nil
+}
+
+func (o *JobsOptions) printJob(job *lib.Job) error {
+	fmt.Fprintf(o.Out, "id:       %s\n", job.ID)
+	fmt.Fprintf(o.Out, "method:   %s\n", job.Method)
+	fmt.Fprintf(o.Out, "status:   %s\n", job.Status)
+	fmt.Fprintf(o.Out, "started:  %s\n", job.Started.Format(time.RFC3339))
+	fmt.Fprintf(o.Out, "duration: %s\n", jobDuration(job))
+	if job.Error != "" {
+		fmt.Fprintf(o.Out, "error:    %s\n", job.Error)
+	}
+	if n := len(job.Progress); n > 0 {
+		last, err := json.Marshal(job.Progress[n-1].Payload)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(o.Out, "progress: %s %s\n", job.Progress[n-1].Type, last)
+	}
+	if job.Result != nil {
+		data, err := json.MarshalIndent(job.Result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(o.Out, "result:\n%s\n", data)
+	}
+	return nil
+}
+
+// jobDuration is the time a job ran for, or has been running
+func jobDuration(j *lib.Job) string {
+	end := j.Finished
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return end.Sub(j.Started).Round(time.Millisecond).String()
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJobsCommand(t *testing.T) {
+	run := NewTestRunner(t, "peer", "qri_test_jobs")
+	defer run.Delete()
+
+	if output := run.MustExec(t, "qri jobs"); !strings.Contains(output, "no jobs") {
+		t.Errorf("expected no jobs, got: %q", output)
+	}
+	if err := run.ExecCommand("qri jobs get not-a-job"); err == nil || !strings.Contains(err.Error(), "job not found") {
+		t.Errorf("expected job not found error, got: %v", err)
+	}
+	if err := run.ExecCommand("qri jobs cancel"); err == nil {
+		t.Error("expected cancel without a job ID to fail")
+	}
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/qri-io/ioes"
+	qerr "github.com/qri-io/qri/errors"
+	"github.com/qri-io/qri/lib"
+	"github.com/qri-io/qri/repo"
+	"github.com/spf13/cobra"
+)
+
+// NewLineageCommand creates a new `qri lineage` cobra command for showing the
+// datasets a dataset was built from, and the datasets built from it
+func NewLineageCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &LineageOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "lineage DATASET",
+		Short: "show the datasets a dataset is built from & used to build",
+		Long: `Lineage traces the datasets connected to a dataset by transforms. Each time
+a transform loads a dataset with load_dataset, the exact version it loaded is
+recorded in the transform of the version it produces.
+
+Upstream lineage lists the versions a dataset version was built from, and
+the versions those were built from in turn. Downstream lineage lists
+datasets in your repo that were built from the dataset. When DATASET doesn't
+specify a version, downstream lineage includes datasets built from any
+version.
+
+Output is a list of edges as text, a JSON graph, or a graph in the DOT
+language that tools like graphviz can render.`,
+		Example: `  # show the full lineage of a dataset
+  $ qri lineage me/annual_pop
+
+  # show only the datasets directly built from a dataset
+  $ qri lineage me/annual_pop --direction downstream --depth 1
+
+  # render lineage as an image with graphviz
+  $ qri lineage me/annual_pop --format dot | dot -Tpng > lineage.png`,
+		Annotations: map[string]string{
+			"group": "dataset",
+		},
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Format, "format", "text", "set output format [text|json|dot]")
+	cmd.Flags().StringVar(&o.Direction, "direction", lib.LineageBoth, "direction to trace [upstream|downstream|both]")
+	cmd.Flags().IntVar(&o.Depth, "depth", 0, "number of steps to trace in each direction, 0 traces everything")
+
+	return cmd
+}
+
+// LineageOptions encapsulates state for the lineage command
+type LineageOptions struct {
+	ioes.IOStreams
+
+	Refs      *RefSelect
+	Format    string
+	Direction string
+	Depth     int
+
+	inst *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *LineageOptions) Complete(f Factory, args []string) (err error) {
+	if o.inst, err = f.Instance(); err != nil {
+		return
+	}
+	if o.Refs, err = GetCurrentRefSelect(f, args, 1); err != nil {
+		// This error will be handled during validation
+		if err != repo.ErrEmptyRef {
+			return
+		}
+		err = nil
+	}
+	return
+}
+
+// Validate checks that all user input is valid
+func (o *LineageOptions) Validate() error {
+	if o.Refs.Ref() == "" {
+		return qerr.New(lib.ErrBadArgs, "please specify a dataset")
+	}
+	switch o.Format {
+	case "text", "json", "dot":
+		return nil
+	default:
+		return qerr.New(lib.ErrBadArgs, fmt.Sprintf("unrecognized format %q, must be one of text, json or dot", o.Format))
+	}
+}
+
+// Run executes the lineage command
+func (o *LineageOptions) Run() error {
+	ctx := context.TODO()
+	res, err := o.inst.Dataset().Lineage(ctx, &lib.LineageParams{
+		Ref:       o.Refs.Ref(),
+		Direction: o.Direction,
+		Depth:     o.Depth,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch o.Format {
+	case "json":
+		data, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(o.Out, string(data))
+	case "dot":
+		fmt.Fprint(o.Out, lineageDOT(res))
+	default:
+		if len(res.Edges) == 0 {
+			printInfo(o.Out, "no lineage found for dataset '%s'", o.Refs.Ref())
+			return nil
+		}
+		fmt.Fprint(o.Out, lineageText(res))
+	}
+	return nil
+}
+
+// lineageNodeLabel describes a dataset version as username/name@path
+func lineageNodeLabel(l *lib.Lineage, path string) string {
+	for _, n := range l.Nodes {
+		if n.Path == path && n.Name != "" {
+			return fmt.Sprintf("%s@%s", n.Human(), path)
+		}
+	}
+	return path
+}
+
+// lineageText writes one edge per line, input first
+func lineageText(l *lib.Lineage) string {
+	b := &strings.Builder{}
+	for _, e := range l.Edges {
+		fmt.Fprintf(b, "%s -> %s\n", lineageNodeLabel(l, e.Input), lineageNodeLabel(l, e.Output))
+	}
+	return b.String()
+}
+
+// lineageDOT writes a lineage graph in the graphviz DOT language. Nodes are
+// identified by path, and labeled with the dataset name
+func lineageDOT(l *lib.Lineage) string {
+	b := &strings.Builder{}
+	b.WriteString("digraph lineage {\n")
+	for _, n := range l.Nodes {
+		label := n.Path
+		if n.Name != "" {
+			label = n.Human() + "\n" + n.Path
+		}
+		attrs := fmt.Sprintf("label=%q", label)
+		if n.Path == l.Root.Path {
+			attrs += ", style=bold"
+		}
+		fmt.Fprintf(b, "  %q [%s];\n", n.Path, attrs)
+	}
+	for _, e := range l.Edges {
+		fmt.Fprintf(b, "  %q -> %q;\n", e.Input, e.Output)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLineage(t *testing.T) {
+	run := NewTestRunner(t, "peer", "qri_test_lineage")
+	defer run.Delete()
+
+	run.MustExec(t, "qri save --body testdata/movies/body_ten.csv me/movies")
+	run.MustExec(t, "qri save --file testdata/movies/tf_load_movies.star --apply me/movie_copy")
+
+	output := run.MustExec(t, "qri lineage me/movie_copy --direction upstream")
+	if !strings.Contains(output, "peer/movies@") || !strings.Contains(output, "-> peer/movie_copy@") {
+		t.Errorf("expected upstream lineage edge from movies to movie_copy, got: %q", output)
+	}
+
+	output = run.MustExec(t, "qri lineage me/movies --direction downstream --format dot")
+	if !strings.HasPrefix(output, "digraph lineage {") || strings.Count(output, " -> ") != 1 {
+		t.Errorf("unexpected dot output: %q", output)
+	}
+
+	output = run.MustExec(t, "qri lineage me/movies --direction upstream")
+	if !strings.Contains(output, "no lineage found") {
+		t.Errorf("expected no upstream lineage for movies, got: %q", output)
+	}
+
+	if err := run.ExecCommand("qri lineage me/movies --format svg"); err == nil {
+		t.Error("expected unrecognized format to error")
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/qri-io/qri/p2p"
 	"github.com/qri-io/qri/remote"
 	"github.com/qri-io/qri/remote/access"
+	"github.com/qri-io/qri/remote/quota"
 	"github.com/spf13/cobra"
 )
 
@@ -53,11 +54,18 @@ https://github.com/qri-io/qri/issues`,
 		NewAnalyzeTransformCommand(opt, ioStreams),
 		NewApplyCommand(opt, ioStreams),
 		NewAutocompleteCommand(opt, ioStreams),
+		NewBackupCommand(opt, ioStreams),
+		NewBackfillCommand(opt, ioStreams),
+		NewBlameCommand(opt, ioStreams),
 		NewConfigCommand(opt, ioStreams),
 		NewConnectCommand(opt, ioStreams),
 		NewDAGCommand(opt, ioStreams),
 		NewDiffCommand(opt, ioStreams),
+		NewDoctorCommand(opt, ioStreams),
+		NewGCCommand(opt, ioStreams),
 		NewGetCommand(opt, ioStreams),
+		NewJobsCommand(opt, ioStreams),
+		NewLineageCommand(opt, ioStreams),
 		NewListCommand(opt, ioStreams),
 		NewLogCommand(opt, ioStreams),
 		NewLogbookCommand(opt, ioStreams),
@@ -65,14 +73,22 @@ https://github.com/qri-io/qri/issues`,
 		NewPullCommand(opt, ioStreams),
 		NewPeersCommand(opt, ioStreams),
 		NewPreviewCommand(opt, ioStreams),
+		NewQuotaCommand(opt, ioStreams),
 		NewRegistryCommand(opt, ioStreams),
 		NewRemoveCommand(opt, ioStreams),
 		NewRenameCommand(opt, ioStreams),
 		NewRenderCommand(opt, ioStreams),
+		NewRetentionCommand(opt, ioStreams),
+		NewRunsCommand(opt, ioStreams),
 		NewSaveCommand(opt, ioStreams),
 		NewSearchCommand(opt, ioStreams),
 		NewSetupCommand(opt, ioStreams),
+		NewSquashCommand(opt, ioStreams),
+		NewStatusCommand(opt, ioStreams),
+		NewTestCommand(opt, ioStreams),
 		NewValidateCommand(opt, ioStreams),
+		NewVerifyCommand(opt, ioStreams),
+		NewVerifySignaturesCommand(opt, ioStreams),
 		NewVersionCommand(opt, ioStreams),
 		NewWhatChangedCommand(opt, ioStreams),
 	)
@@ -144,6 +160,8 @@ func (o *QriOptions) Init() (err error) {
 		lib.OptRemoteServerOptions([]remote.OptionsFunc{
 			// look for a remote policy
 			remote.OptLoadPolicyFileIfExists(filepath.Join(o.repoPath, access.DefaultAccessControlPolicyFilename)),
+			// keep storage usage alongside the repo
+			remote.OptLoadLedgerFile(filepath.Join(o.repoPath, quota.DefaultLedgerFilename)),
 		}),
 	}
 
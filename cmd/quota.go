@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+
+	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/lib"
+	"github.com/qri-io/qri/remote/quota"
+	"github.com/spf13/cobra"
+)
+
+// NewQuotaCommand creates a `qri quota` subcommand for inspecting storage
+// usage & adjusting quotas on a remote
+func NewQuotaCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &QuotaOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "quota",
+		Short: "show storage usage & set quotas on a remote",
+		Long: `A node running in remote mode keeps track of the storage each profile uses
+with the datasets they push. Blocks shared between versions only count once.
+Pushes that would take a profile over its quota are rejected. The default
+quota for all profiles is set with the remote.defaultquota config field, and
+can be overridden for a single profile with 'qri quota set'.
+
+With no subcommand, quota lists usage for every profile that stores data on
+the remote. Quotas apply to the remote the node runs, use quota with a node
+started by 'qri connect'.`,
+		Example: `  # list storage usage for all profiles
+  $ qri quota
+
+  # show storage usage for one profile
+  $ qri quota get QmZePf5LeXow3RW5U1AgEiNbW46YnRGhZ7HPvm1UmPFPwt
+
+  # give a profile 10 gigabytes of storage
+  $ qri quota set QmZePf5LeXow3RW5U1AgEiNbW46YnRGhZ7HPvm1UmPFPwt 10GB
+
+  # return a profile to the default quota
+  $ qri quota set QmZePf5LeXow3RW5U1AgEiNbW46YnRGhZ7HPvm1UmPFPwt default`,
+		Annotations: map[string]string{
+			"group": "network",
+		},
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f); err != nil {
+				return err
+			}
+			return o.List("")
+		},
+	}
+
+	get := &cobra.Command{
+		Use:   "get PROFILE_ID",
+		Short: "show storage usage for a profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f); err != nil {
+				return err
+			}
+			return o.List(args[0])
+		},
+	}
+
+	set := &cobra.Command{
+		Use:   "set PROFILE_ID SIZE",
+		Short: "set the storage quota for a profile",
+		Long: `Set the storage quota for a profile. SIZE is a number of bytes with an
+optional unit like 500MB or 10GB, "unlimited" to remove the limit, or
+"default" to use the remote's default quota.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f); err != nil {
+				return err
+			}
+			return o.Set(args[0], args[1])
+		},
+	}
+
+	cmd.AddCommand(get, set)
+	return cmd
+}
+
+// QuotaOptions encapsulates state for the quota command
+type QuotaOptions struct {
+	ioes.IOStreams
+
+	inst *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *QuotaOptions) Complete(f Factory) (err error) {
+	o.inst, err = f.Instance()
+	return err
+}
+
+// List prints storage usage, limited to a single profile if pid is set
+func (o *QuotaOptions) List(pid string) error {
+	ctx := context.TODO()
+	usage, err := o.inst.Remote().Usage(ctx, &lib.UsageParams{ProfileID: pid})
+	if err != nil {
+		return err
+	}
+	if len(usage) == 0 {
+		printInfo(o.Out, "no profiles store data on this remote")
+		return nil
+	}
+
+	data := make([][]string, len(usage))
+	for i, u := range usage {
+		q := quota.FormatSize(u.Quota)
+		if !u.CustomQuota {
+			q += " (default)"
+		}
+		data[i] = []string{u.ProfileID, strconv.Itoa(u.Versions), quota.FormatSize(u.Bytes), q, quota.FormatSize(u.Remaining())}
+	}
+	buf := &bytes.Buffer{}
+	renderTable(buf, []string{"profile", "versions", "used", "quota", "remaining"}, data)
+	return printToPager(o.Out, buf)
+}
+
+// Set changes the storage quota of a profile
+func (o *QuotaOptions) Set(pid, size string) error {
+	ctx := context.TODO()
+	u, err := o.inst.Remote().SetQuota(ctx, &lib.SetQuotaParams{ProfileID: pid, Quota: size})
+	if err != nil {
+		return err
+	}
+	if u.CustomQuota {
+		printSuccess(o.Out, "set quota for %s to %s", u.ProfileID, quota.FormatSize(u.Quota))
+	} else {
+		printSuccess(o.Out, "%s now uses the default quota of %s", u.ProfileID, quota.FormatSize(u.Quota))
+	}
+	if u.Remaining() == 0 {
+		printWarning(o.Out, "%s uses %s, further pushes will be rejected", u.ProfileID, quota.FormatSize(u.Bytes))
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuotaCommand(t *testing.T) {
+	run := NewTestRunner(t, "peer", "qri_test_quota")
+	defer run.Delete()
+
+	if err := run.ExecCommand("qri quota"); err == nil || !strings.Contains(err.Error(), "remote mode") {
+		t.Errorf("expected quota to require remote mode, got: %v", err)
+	}
+	if err := run.ExecCommand("qri quota set QmZePf5LeXow3RW5U1AgEiNbW46YnRGhZ7HPvm1UmPFPwt"); err == nil {
+		t.Error("expected set without a size to fail")
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/automation/retention"
+	qerr "github.com/qri-io/qri/errors"
+	"github.com/qri-io/qri/lib"
+	"github.com/qri-io/qri/repo"
+	"github.com/spf13/cobra"
+)
+
+// NewRetentionCommand creates a `qri retention` subcommand for showing &
+// setting the version retention policy of an automated dataset
+func NewRetentionCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &RetentionOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "retention DATASET",
+		Short: "show & set how long automated datasets keep versions",
+		Long: `A retention policy thins out the version history of a dataset that has a
+workflow. qri connect enforces retention policies in the background, dropping
+versions the policy doesn't keep. Versions that remain keep their paths &
+commit signatures.
+
+A policy is a comma-separated list of rules, checked in order. Each rule is a
+maximum version age, optionally followed by a slash and an interval to keep
+one version per. "forever" is a rule with no maximum age. Versions no rule
+covers are dropped, the latest version is always kept. Durations use the
+units s, m, h, d (day), w (week), mo (month) and y (year).
+
+With no subcommand, retention shows the policy of a dataset.`,
+		Example: `  # show the retention policy of a dataset
+  $ qri retention me/hourly_readings
+
+  # keep all versions for 7 days, then one per day for 90 days, then one per
+  # month forever
+  $ qri retention set me/hourly_readings 7d,90d/1d,forever/1mo
+
+  # set a policy & drop versions it doesn't keep right away
+  $ qri retention set me/hourly_readings 30d --prune
+
+  # keep every version
+  $ qri retention clear me/hourly_readings`,
+		Annotations: map[string]string{
+			"group": "automation",
+		},
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			return o.Get()
+		},
+	}
+
+	set := &cobra.Command{
+		Use:   "set DATASET POLICY",
+		Short: "set the retention policy of a dataset",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args[:1]); err != nil {
+				return err
+			}
+			return o.Set(args[1])
+		},
+	}
+	set.Flags().BoolVar(&o.Prune, "prune", false, "drop versions the policy doesn't keep now")
+
+	clearCmd := &cobra.Command{
+		Use:   "clear DATASET",
+		Short: "remove the retention policy of a dataset, keeping all versions",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			return o.Clear()
+		},
+	}
+
+	cmd.AddCommand(set, clearCmd)
+	return cmd
+}
+
+// RetentionOptions encapsulates state for the retention command
+type RetentionOptions struct {
+	ioes.IOStreams
+
+	Refs  *RefSelect
+	Prune bool
+
+	inst *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *RetentionOptions) Complete(f Factory, args []string) (err error) {
+	if o.inst, err = f.Instance(); err != nil {
+		return
+	}
+	if o.Refs, err = GetCurrentRefSelect(f, args, 1); err != nil {
+		if err == repo.ErrEmptyRef {
+			return qerr.New(lib.ErrBadArgs, "please specify a dataset")
+		}
+		return
+	}
+	return
+}
+
+// Get prints the retention policy of a dataset
+func (o *RetentionOptions) Get() error {
+	ctx := context.TODO()
+	wf, err := o.inst.Automation().Workflow(ctx, &lib.WorkflowParams{Ref: o.Refs.Ref()})
+	if err != nil {
+		return err
+	}
+	if wf.Retention == nil {
+		printInfo(o.Out, "'%s' keeps every version", o.Refs.Ref())
+		return nil
+	}
+	printInfo(o.Out, "%s", wf.Retention)
+	return nil
+}
+
+// Set changes the retention policy of a dataset
+func (o *RetentionOptions) Set(policy string) error {
+	p, err := retention.ParsePolicy(policy)
+	if err != nil {
+		return qerr.New(lib.ErrBadArgs, err.Error())
+	}
+	res, err := o.inst.Automation().Retention(context.TODO(), &lib.RetentionParams{
+		Ref:    o.Refs.Ref(),
+		Policy: p,
+		Prune:  o.Prune,
+	})
+	if err != nil {
+		return err
+	}
+	printSuccess(o.Out, "set retention policy of '%s' to %s", o.Refs.Ref(), res.Workflow.Retention)
+	if o.Prune {
+		printInfo(o.Out, "dropped %d versions", res.Pruned)
+	}
+	return nil
+}
+
+// Clear removes the retention policy of a dataset
+func (o *RetentionOptions) Clear() error {
+	if _, err := o.inst.Automation().Retention(context.TODO(), &lib.RetentionParams{Ref: o.Refs.Ref()}); err != nil {
+		return err
+	}
+	printSuccess(o.Out, "'%s' keeps every version", o.Refs.Ref())
+	return nil
+}
@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/automation/run"
+	qerr "github.com/qri-io/qri/errors"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/lib"
+	"github.com/qri-io/qri/repo"
+	"github.com/spf13/cobra"
+)
+
+// NewRunsCommand creates a `qri runs` subcommand for browsing the runs of
+// workflows
+func NewRunsCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &RunsOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "list, inspect & follow workflow runs",
+		Long: `Runs are executions of a dataset workflow. Every run records the status of
+each transform step, along with anything the transform prints.
+
+Use ` + "`qri runs logs --follow`" + ` to watch a run as it happens. When qri connect
+is running, runs stream from the connected node.`,
+		Annotations: map[string]string{
+			"group": "automation",
+		},
+	}
+
+	list := &cobra.Command{
+		Use:   "list WORKFLOW",
+		Short: "list the runs of a dataset workflow, newest first",
+		Example: `  # list recent runs of a workflow:
+  $ qri runs list me/daily_weather`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.CompleteList(f, args); err != nil {
+				return err
+			}
+			return o.List()
+		},
+	}
+	list.Flags().IntVar(&o.Offset, "offset", 0, "skip this number of records from the results, default 0")
+	list.Flags().IntVar(&o.Limit, "limit", 25, "size of results, default 25")
+
+	show := &cobra.Command{
+		Use:   "show RUN_ID",
+		Short: "show the status & steps of a run",
+		Example: `  # show a run:
+  $ qri runs show 1e6c3a8f-1f4d-4b7e-9a0d-4f6a3d0a7c21
+
+  # show a run as json, including step output:
+  $ qri runs show --format json 1e6c3a8f-1f4d-4b7e-9a0d-4f6a3d0a7c21`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			return o.Show()
+		},
+	}
+	show.Flags().StringVarP(&o.Format, "format", "f", "", "set output format [json]")
+
+	logs := &cobra.Command{
+		Use:   "logs RUN_ID",
+		Short: "print the log of a run",
+		Long: `Logs prints step progress, errors, and anything the transform prints during a
+run. With --follow, logs keeps printing events as the run happens, exiting
+when the run stops.`,
+		Example: `  # print the log of a run:
+  $ qri runs logs 1e6c3a8f-1f4d-4b7e-9a0d-4f6a3d0a7c21
+
+  # follow a run in progress:
+  $ qri runs logs --follow 1e6c3a8f-1f4d-4b7e-9a0d-4f6a3d0a7c21`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			return o.Logs()
+		},
+	}
+	logs.Flags().BoolVar(&o.Follow, "follow", false, "keep printing events until the run stops")
+
+	cmd.AddCommand(list, show, logs)
+	return cmd
+}
+
+// RunsOptions encapsulates state for the runs command & subcommands
+type RunsOptions struct {
+	ioes.IOStreams
+
+	Refs   *RefSelect
+	RunID  string
+	Offset int
+	Limit  int
+	Format string
+	Follow bool
+
+	inst *lib.Instance
+}
+
+// CompleteList adds any missing configuration for listing runs
+func (o *RunsOptions) CompleteList(f Factory, args []string) (err error) {
+	if o.inst, err = f.Instance(); err != nil {
+		return
+	}
+	if o.Refs, err = GetCurrentRefSelect(f, args, 1); err != nil {
+		if err == repo.ErrEmptyRef {
+			return qerr.New(lib.ErrBadArgs, "please specify a dataset workflow")
+		}
+		return
+	}
+	return
+}
+
+// Complete adds any missing configuration for commands that take a run ID
+func (o *RunsOptions) Complete(f Factory, args []string) (err error) {
+	if o.inst, err = f.Instance(); err != nil {
+		return
+	}
+	o.RunID = args[0]
+	return
+}
+
+// List prints the runs of a workflow
+func (o *RunsOptions) List() error {
+	ctx := context.TODO()
+	p := &lib.RunListParams{Ref: o.Refs.Ref()}
+	p.Offset = o.Offset
+	p.Limit = o.Limit
+	runs, err := o.inst.Automation().Runs(ctx, p)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		printInfo(o.Out, "no runs")
+		return nil
+	}
+	for _, r := range runs {
+		printInfo(o.Out, "%s\t%s\t%s\t%s", r.ID, statusOrWaiting(r.Status), formatRunTime(r.StartTime), formatRunDuration(r.Duration))
+	}
+	return nil
+}
+
+// Show prints the status & steps of a run
+func (o *RunsOptions) Show() error {
+	ctx := context.TODO()
+	r, err := o.inst.Automation().RunInfo(ctx, &lib.RunInfoParams{ID: o.RunID})
+	if err != nil {
+		return err
+	}
+	if o.Format == "json" {
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		printInfo(o.Out, "%s", data)
+		return nil
+	}
+	printRunState(o.Out, r)
+	return nil
+}
+
+// Logs prints the log of a run
+func (o *RunsOptions) Logs() error {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	if !o.Follow {
+		r, err := o.inst.Automation().RunInfo(ctx, &lib.RunInfoParams{ID: o.RunID})
+		if err != nil {
+			return err
+		}
+		for _, e := range r.Events() {
+			printRunEvent(o.Out, e)
+		}
+		return nil
+	}
+
+	events, err := o.inst.FollowRun(ctx, o.RunID)
+	if err != nil {
+		return err
+	}
+	for e := range events {
+		printRunEvent(o.Out, e)
+	}
+	return nil
+}
+
+func printRunState(w io.Writer, r *run.State) {
+	printInfo(w, "run:      %s", r.ID)
+	printInfo(w, "workflow: %s", r.WorkflowID)
+	printInfo(w, "status:   %s", statusOrWaiting(r.Status))
+	printInfo(w, "started:  %s", formatRunTime(r.StartTime))
+	printInfo(w, "duration: %s", formatRunDuration(r.Duration))
+	if r.Message != "" {
+		printInfo(w, "message:  %s", r.Message)
+	}
+	if len(r.Params) > 0 {
+		names := make([]string, 0, len(r.Params))
+		for name := range r.Params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		params := make([]string, len(names))
+		for i, name := range names {
+			params[i] = name + "=" + r.Params[name]
+		}
+		printInfo(w, "params:   %s", strings.Join(params, " "))
+	}
+	if r.GroupID != "" {
+		printInfo(w, "group:    %s", r.GroupID)
+	}
+	if len(r.Steps) == 0 {
+		return
+	}
+	printInfo(w, "steps:")
+	for i, s := range r.Steps {
+		status := string(s.Status)
+		if s.Cached {
+			status += " (cached)"
+		}
+		printInfo(w, "  %d. %s\t%s\t%s", i+1, s.Name, status, formatRunDuration(s.Duration))
+	}
+}
+
+// printRunEvent writes a line for each event in the log of a run
+func printRunEvent(w io.Writer, e event.Event) {
+	switch e.Type {
+	case event.ETTransformStart:
+		printInfo(w, "run started")
+	case event.ETTransformStop:
+		if tl, ok := e.Payload.(event.TransformLifecycle); ok {
+			printInfo(w, "run %s", tl.Status)
+		}
+	case event.ETTransformStepStart:
+		if step, ok := e.Payload.(event.TransformStepLifecycle); ok {
+			printInfo(w, "--- step %s", step.Name)
+		}
+	case event.ETTransformStepStop:
+		if step, ok := e.Payload.(event.TransformStepLifecycle); ok {
+			status := step.Status
+			if step.Cached {
+				status += " (cached)"
+			}
+			printInfo(w, "--- step %s %s", step.Name, status)
+		}
+	case event.ETTransformStepSkip:
+		if step, ok := e.Payload.(event.TransformStepLifecycle); ok {
+			printInfo(w, "--- step %s skipped", step.Name)
+		}
+	case event.ETTransformPrint:
+		if msg, ok := e.Payload.(event.TransformMessage); ok {
+			printInfo(w, "%s", msg.Msg)
+		}
+	case event.ETTransformError:
+		if msg, ok := e.Payload.(event.TransformMessage); ok {
+			printInfo(w, "error: %s", msg.Msg)
+		}
+	}
+}
+
+func statusOrWaiting(s run.Status) run.Status {
+	if s == "" {
+		return run.RSWaiting
+	}
+	return s
+}
+
+func formatRunTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatRunDuration(d int64) string {
+	if d == 0 {
+		return "-"
+	}
+	return time.Duration(d).Round(time.Millisecond).String()
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/qri/event"
+)
+
+func TestRunsCommand(t *testing.T) {
+	run := NewTestRunner(t, "test_peer_runs", "qri_test_runs")
+	defer run.Delete()
+
+	run.MustExec(t, "qri save --file testdata/movies/ds_ten.yaml me/movies")
+
+	// datasets need a workflow to have runs
+	if err := run.ExecCommand("qri runs list me/movies"); err == nil {
+		t.Error("expected listing runs of a dataset without a workflow to fail")
+	}
+
+	if err := run.ExecCommand("qri runs show not_a_run_id"); err == nil {
+		t.Error("expected showing an unknown run to fail")
+	}
+	if err := run.ExecCommand("qri runs logs not_a_run_id"); err == nil {
+		t.Error("expected printing the log of an unknown run to fail")
+	}
+}
+
+func TestPrintRunEvent(t *testing.T) {
+	events := []event.Event{
+		{Type: event.ETTransformStart, Payload: event.TransformLifecycle{}},
+		{Type: event.ETTransformStepStart, Payload: event.TransformStepLifecycle{Name: "setup"}},
+		{Type: event.ETTransformPrint, Payload: event.TransformMessage{Msg: "oh hai there"}},
+		{Type: event.ETTransformStepStop, Payload: event.TransformStepLifecycle{Name: "setup", Status: "succeeded", Cached: true}},
+		{Type: event.ETTransformStepSkip, Payload: event.TransformStepLifecycle{Name: "download"}},
+		{Type: event.ETTransformError, Payload: event.TransformMessage{Msg: "oh no"}},
+		{Type: event.ETTransformDatasetPreview, Payload: nil},
+		{Type: event.ETTransformStop, Payload: event.TransformLifecycle{Status: "failed"}},
+	}
+	buf := &bytes.Buffer{}
+	for _, e := range events {
+		printRunEvent(buf, e)
+	}
+	expect := `run started
+--- step setup
+oh hai there
+--- step setup succeeded (cached)
+--- step download skipped
+error: oh no
+run failed
+`
+	if diff := cmp.Diff(expect, buf.String()); diff != "" {
+		t.Errorf("output mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -73,6 +73,9 @@ different peer, the dataset gets renamed from ` + "`peers_name/dataset_name`" +
 	cmd.Flags().BoolVar(&o.Apply, "apply", false, "apply a transformation and save the result")
 	cmd.Flags().BoolVar(&o.NoApply, "no-apply", false, "don't apply any transforms that are added")
 	cmd.Flags().StringSliceVar(&o.Secrets, "secrets", nil, "transform secrets as comma separated key,value,key,value,... sequence")
+	cmd.Flags().StringArrayVar(&o.Params, "param", nil, "set a transform run parameter as name=value when applying. may be repeated")
+	cmd.Flags().BoolVar(&o.NoCache, "no-cache", false, "run every transform step, ignoring cached step results")
+	cmd.Flags().BoolVar(&o.RecordResponses, "record-responses", false, "record http responses the transform reads, so the version can be verified")
 	cmd.Flags().BoolVar(&o.DeprecatedDryRun, "dry-run", false, "deprecated: use `qri apply` instead")
 	cmd.Flags().BoolVar(&o.Force, "force", false, "force a new commit, even if no changes are detected")
 	cmd.Flags().BoolVarP(&o.KeepFormat, "keep-format", "k", false, "convert incoming data to stored data format")
@@ -98,8 +101,11 @@ type SaveOptions struct {
 
 	Apply            bool
 	NoApply          bool
+	NoCache          bool
+	RecordResponses  bool
 	DeprecatedDryRun bool
 	Secrets          []string
+	Params           []string
 
 	Replace        bool
 	ShowValidation bool
@@ -145,11 +151,13 @@ func (o *SaveOptions) Run() (err error) {
 		Title:    o.Title,
 		Message:  o.Message,
 
-		ScriptOutput: o.ErrOut,
-		FilePaths:    o.FilePaths,
-		Private:      false,
-		Apply:        o.Apply,
-		Drop:         o.Drop,
+		ScriptOutput:    o.ErrOut,
+		FilePaths:       o.FilePaths,
+		Private:         false,
+		Apply:           o.Apply,
+		NoCache:         o.NoCache,
+		RecordResponses: o.RecordResponses,
+		Drop:            o.Drop,
 
 		ConvertFormatToPrev: o.KeepFormat,
 		Force:               o.Force,
@@ -186,6 +194,10 @@ continue?`, true) {
 		}
 	}
 
+	if p.Params, err = parseRunParams(o.Params...); err != nil {
+		return err
+	}
+
 	ctx := context.TODO()
 	res, err := o.inst.Dataset().Save(ctx, p)
 	if err != nil {
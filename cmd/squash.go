@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/qri-io/ioes"
+	qerr "github.com/qri-io/qri/errors"
+	"github.com/qri-io/qri/lib"
+	"github.com/qri-io/qri/repo"
+	"github.com/spf13/cobra"
+)
+
+// NewSquashCommand creates a new `qri squash` cobra command for collapsing a
+// range of dataset history into a single version
+func NewSquashCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &SquashOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "squash DATASET --from REV --to REV",
+		Short: "collapse a range of dataset versions into one",
+		Long: `Squash rewrites the history of a dataset, collapsing every version from
+--from up to --to into a single version that has the contents of --to.
+
+Revisions are either a version path, or the number of versions back from the
+latest version, where 0 is the latest. --from must be older than --to. Use
+'qri log' to list versions.
+
+Squashing only changes the history qri lists, versions that remain keep their
+paths & commit signatures. Squashed versions stay in storage until you run
+'qri gc'.`,
+		Example: `  # collapse the 3rd, 4th & 5th most recent versions into one
+  $ qri squash me/annual_pop --from 4 --to 2
+
+  # squash using version paths from qri log
+  $ qri squash me/annual_pop --from /ipfs/QmFrom... --to /ipfs/QmTo...`,
+		Annotations: map[string]string{
+			"group": "dataset",
+		},
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.From, "from", "", "oldest version to squash")
+	cmd.Flags().StringVar(&o.To, "to", "", "newest version to squash")
+
+	return cmd
+}
+
+// SquashOptions encapsulates state for the squash command
+type SquashOptions struct {
+	ioes.IOStreams
+
+	Refs *RefSelect
+	From string
+	To   string
+
+	inst *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *SquashOptions) Complete(f Factory, args []string) (err error) {
+	if o.inst, err = f.Instance(); err != nil {
+		return
+	}
+	if o.Refs, err = GetCurrentRefSelect(f, args, 1); err != nil {
+		// This error will be handled during validation
+		if err != repo.ErrEmptyRef {
+			return
+		}
+		err = nil
+	}
+	return
+}
+
+// Validate checks that all user input is valid
+func (o *SquashOptions) Validate() error {
+	if o.Refs.Ref() == "" {
+		return qerr.New(lib.ErrBadArgs, "please specify a dataset to squash")
+	}
+	if o.From == "" || o.To == "" {
+		return qerr.New(lib.ErrBadArgs, "need both --from and --to to specify the versions to squash")
+	}
+	return nil
+}
+
+// Run executes the squash command
+func (o *SquashOptions) Run() error {
+	ctx := context.TODO()
+	res, err := o.inst.Dataset().Squash(ctx, &lib.SquashParams{
+		Ref:  o.Refs.Ref(),
+		From: o.From,
+		To:   o.To,
+	})
+	if err != nil {
+		return err
+	}
+	printSuccess(o.Out, "squashed %d versions of dataset '%s'", res.NumSquashed, res.Ref)
+	return nil
+}
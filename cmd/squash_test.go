@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSquash(t *testing.T) {
+	run := NewTestRunner(t, "peer", "qri_test_squash")
+	defer run.Delete()
+
+	run.MustExec(t, "qri save --body testdata/movies/body_ten.csv me/movies")
+	run.MustExec(t, "qri save --body testdata/movies/body_twenty.csv me/movies")
+	run.MustExec(t, "qri save --body testdata/movies/body_thirty.csv me/movies")
+	run.MustExec(t, "qri save --body testdata/movies/TenMoviesAndLengths.csv me/movies")
+
+	if err := run.ExecCommand("qri squash me/movies --from 1 --to 2"); err == nil {
+		t.Error("expected squashing from a newer to an older version to fail")
+	}
+
+	output := run.MustExec(t, "qri squash me/movies --from 2 --to 1")
+	if !strings.Contains(output, "squashed 1 versions") {
+		t.Errorf("unexpected squash output: %q", output)
+	}
+
+	history := run.MustExec(t, "qri log me/movies")
+	if count := strings.Count(history, "Commit:"); count != 3 {
+		t.Errorf("expected 3 versions after squashing, got %d:\n%s", count, history)
+	}
+	body := run.MustExec(t, "qri get body me/movies")
+	if !strings.Contains(body, "Avatar") {
+		t.Errorf("expected latest version body to survive squashing, got: %q", body)
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/dustin/go-humanize"
+	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/automation/freshness"
+	"github.com/qri-io/qri/lib"
+	"github.com/spf13/cobra"
+)
+
+// NewStatusCommand creates a new `qri status` cobra command for listing
+// datasets that have gone stale
+func NewStatusCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &StatusOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "list datasets that haven't updated as often as expected",
+		Long: `Status checks your datasets against the freshness SLA of their workflows.
+A freshness SLA sets the longest a dataset can go without a new version, for
+example a workflow with:
+
+  "freshness": {"maxAge": "30h"}
+
+expects a new version at least every 30 hours. Stale datasets list the likely
+reason they're stale: the latest workflow run failed, the source data didn't
+change, or the workflow isn't deployed.
+
+qri connect checks freshness SLAs in the background, publishing an event when
+a dataset goes stale.`,
+		Example: `  # list stale datasets:
+  $ qri status
+
+  # list all datasets with a freshness SLA:
+  $ qri status --all`,
+		Annotations: map[string]string{
+			"group": "automation",
+		},
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().BoolVar(&o.All, "all", false, "include datasets that meet their freshness SLA")
+
+	return cmd
+}
+
+// StatusOptions encapsulates state for the status command
+type StatusOptions struct {
+	ioes.IOStreams
+
+	All bool
+
+	inst *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *StatusOptions) Complete(f Factory, args []string) (err error) {
+	o.inst, err = f.Instance()
+	return err
+}
+
+// Run executes the status command
+func (o *StatusOptions) Run() error {
+	ctx := context.TODO()
+	statuses, err := o.inst.Automation().Freshness(ctx, &lib.FreshnessParams{All: o.All})
+	if err != nil {
+		return err
+	}
+	if len(statuses) == 0 {
+		printSuccess(o.Out, "all datasets are fresh")
+		return nil
+	}
+	for _, s := range statuses {
+		printInfo(o.Out, "%s\t%s\t%s", s.Alias(), freshnessState(s), freshnessAge(s))
+	}
+	return nil
+}
+
+func freshnessState(s freshness.Status) string {
+	if !s.Stale {
+		return "fresh"
+	}
+	return "stale: " + string(s.Reason)
+}
+
+func freshnessAge(s freshness.Status) string {
+	if s.CommitTime.IsZero() {
+		return "no versions, max age " + s.MaxAge.String()
+	}
+	return "updated " + humanize.Time(s.CommitTime) + ", max age " + s.MaxAge.String()
+}
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestStatusCommand(t *testing.T) {
+	run := NewTestRunner(t, "test_peer_status", "qri_test_status")
+	defer run.Delete()
+
+	got := run.MustExec(t, "qri status")
+	if got != "all datasets are fresh\n" {
+		t.Errorf("output mismatch. got: %q", got)
+	}
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/lib"
+	"github.com/spf13/cobra"
+)
+
+// NewTestCommand creates a new `qri test` cobra command for running transform
+// tests
+func NewTestCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &TestOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "test [PATH]",
+		Short: "run transform tests against fixture datasets",
+		Long: `Test runs transform scripts against fixture datasets & checks the results.
+
+Tests are starlark files ending in _test.star that sit next to the transform
+they test, so population_test.star tests population.star. PATH is a test file,
+or a directory to search for test files, and defaults to the current
+directory.
+
+Test files can call three functions:
+
+  fixture(ref, body=None, meta=None, structure=None)
+    declare a dataset the transform can load with load_dataset
+  expect(body=None, meta=None, structure=None)
+    declare components the transform must produce. meta & structure only
+    check the fields the test specifies
+  transform(path)
+    test a transform script other than the default
+
+Transforms only have access to fixtures, and network access is disabled.
+Test exits with a non-zero status if any test fails.`,
+		Example: `  # run all transform tests in the current directory
+  $ qri test
+
+  # population_test.star:
+  fixture("me/population", body=[["usa", 331], ["mexico", 126]])
+  expect(body=[["usa", 331]], meta={"title": "north american population"})`,
+		Annotations: map[string]string{
+			"group": "automation",
+		},
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().BoolVarP(&o.Verbose, "verbose", "v", false, "show transform print output for passing tests")
+
+	return cmd
+}
+
+// TestOptions encapsulates state for the test command
+type TestOptions struct {
+	ioes.IOStreams
+
+	Path    string
+	Verbose bool
+
+	inst *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *TestOptions) Complete(f Factory, args []string) (err error) {
+	if o.inst, err = f.Instance(); err != nil {
+		return err
+	}
+	o.Path = "."
+	if len(args) > 0 {
+		o.Path = args[0]
+	}
+	o.Path, err = filepath.Abs(o.Path)
+	return err
+}
+
+// Run executes the test command
+func (o *TestOptions) Run() error {
+	ctx := context.TODO()
+	results, err := o.inst.Automation().Test(ctx, &lib.TestParams{Path: o.Path})
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		printWarning(o.Out, "no transform tests found")
+		return nil
+	}
+
+	failed := 0
+	for _, res := range results {
+		name := o.relPath(res.Path)
+		if res.Passed {
+			printSuccess(o.Out, "PASS %s", name)
+			if o.Verbose {
+				printInfoNoEndline(o.Out, "%s", indent(res.Output))
+			}
+			continue
+		}
+
+		failed++
+		printErr(o.Out, fmt.Errorf("FAIL %s", name))
+		if res.Error != "" {
+			printInfo(o.Out, "%s", indent(res.Error))
+		}
+		for _, fail := range res.Failures {
+			printInfo(o.Out, "  %s mismatch (-want +got):", fail.Component)
+			printInfoNoEndline(o.Out, "%s", indent(indent(fail.Diff)))
+		}
+		if res.Output != "" {
+			printInfo(o.Out, "  output:")
+			printInfoNoEndline(o.Out, "%s", indent(indent(res.Output)))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d transform tests failed", failed, len(results))
+	}
+	printSuccess(o.Out, "%d transform tests passed", len(results))
+	return nil
+}
+
+// relPath shows a path relative to the working directory when possible
+func (o *TestOptions) relPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// indent prefixes every line of s with two spaces
+func indent(s string) string {
+	if s == "" {
+		return s
+	}
+	lines := strings.SplitAfter(s, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = "  " + l
+		}
+	}
+	return strings.Join(lines, "")
+}
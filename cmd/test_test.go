@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransformTest(t *testing.T) {
+	run := NewTestRunner(t, "peer", "qri_test_transform_test")
+	defer run.Delete()
+
+	output := run.MustExec(t, "qri test ../transform/tftest/testdata/population_test.star")
+	if !strings.Contains(output, "PASS") || !strings.Contains(output, "1 transform tests passed") {
+		t.Errorf("unexpected output: %q", output)
+	}
+
+	err := run.ExecCommand("qri test ../transform/tftest/testdata")
+	if err == nil {
+		t.Fatal("expected failing transform tests to error")
+	}
+	if !strings.Contains(err.Error(), "2 of 3 transform tests failed") {
+		t.Errorf("unexpected error: %q", err)
+	}
+	output = run.GetCommandOutput()
+	if !strings.Contains(output, "FAIL") || !strings.Contains(output, "body mismatch") {
+		t.Errorf("expected failure output with a body diff, got: %q", output)
+	}
+}
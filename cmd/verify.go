@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/qri-io/ioes"
+	qerr "github.com/qri-io/qri/errors"
+	"github.com/qri-io/qri/lib"
+	"github.com/qri-io/qri/repo"
+	"github.com/qri-io/qri/transform/verify"
+	"github.com/spf13/cobra"
+)
+
+// NewVerifyCommand creates a new `qri verify` cobra command for checking that
+// a dataset version can be reproduced by re-running its transform
+func NewVerifyCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &VerifyOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "verify DATASET",
+		Short: "check a dataset version is reproducible from its transform",
+		Long: `Verify re-runs the transform recorded in a dataset version and checks the
+result matches the version. The transform runs against the versions of
+datasets it loaded when the version was created, with the network disabled.
+HTTP requests are answered with responses recorded when the version was
+saved with --record-responses.
+
+Verification reports one of:
+  reproducible   the re-run produced the same body & structure
+  diverged       the re-run produced a different body or structure
+  unverifiable   the transform couldn't be re-run with its original inputs
+
+Verify exits with an error if the version isn't reproducible. When DATASET
+doesn't specify a version, verify checks the latest version.`,
+		Example: `  # verify the latest version of a dataset
+  $ qri verify me/annual_pop
+
+  # verify a specific version
+  $ qri verify me/annual_pop@/ipfs/QmZfwmhbcgSDGqGaoMMYx8jxBGauZw75zPjnZAyfwPso7H`,
+		Annotations: map[string]string{
+			"group": "dataset",
+		},
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Format, "format", "text", "set output format [text|json]")
+
+	return cmd
+}
+
+// VerifyOptions encapsulates state for the verify command
+type VerifyOptions struct {
+	ioes.IOStreams
+
+	Refs   *RefSelect
+	Format string
+
+	inst *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *VerifyOptions) Complete(f Factory, args []string) (err error) {
+	if o.inst, err = f.Instance(); err != nil {
+		return
+	}
+	if o.Refs, err = GetCurrentRefSelect(f, args, 1); err != nil {
+		// This error will be handled during validation
+		if err != repo.ErrEmptyRef {
+			return
+		}
+		err = nil
+	}
+	return
+}
+
+// Validate checks that all user input is valid
+func (o *VerifyOptions) Validate() error {
+	if o.Refs.Ref() == "" {
+		return qerr.New(lib.ErrBadArgs, "please specify a dataset")
+	}
+	switch o.Format {
+	case "text", "json":
+		return nil
+	default:
+		return qerr.New(lib.ErrBadArgs, fmt.Sprintf("unrecognized format %q, must be one of text or json", o.Format))
+	}
+}
+
+// Run executes the verify command
+func (o *VerifyOptions) Run() error {
+	ctx := context.TODO()
+	res, err := o.inst.Dataset().Verify(ctx, &lib.VerifyParams{Ref: o.Refs.Ref()})
+	if err != nil {
+		return err
+	}
+
+	if o.Format == "json" {
+		data, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return err
+		}
+		printInfo(o.Out, "%s", data)
+	} else {
+		printVerifyResult(o, res)
+	}
+
+	if res.Status != verify.StatusReproducible {
+		return fmt.Errorf("%s is %s", res.Ref, res.Status)
+	}
+	return nil
+}
+
+func printVerifyResult(o *VerifyOptions, res *lib.VerifyResult) {
+	switch res.Status {
+	case verify.StatusReproducible:
+		printSuccess(o.Out, "%s is reproducible", res.Ref)
+	case verify.StatusDiverged:
+		printWarning(o.Out, "%s diverged", res.Ref)
+		printInfo(o.Out, "body hash:      %s\nre-run:         %s", res.BodyHash, res.RerunBodyHash)
+		printInfo(o.Out, "structure hash: %s\nre-run:         %s", res.StructureHash, res.RerunStructureHash)
+		if res.Diff != "" {
+			printInfo(o.Out, "\n%s", res.Diff)
+		}
+	case verify.StatusUnverifiable:
+		printWarning(o.Out, "%s is unverifiable: %s", res.Ref, res.Reason)
+	}
+	for _, w := range res.Warnings {
+		printWarning(o.Out, "warning: %s", w)
+	}
+}
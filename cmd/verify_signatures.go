@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/qri-io/ioes"
+	"github.com/qri-io/qri/base"
+	qerr "github.com/qri-io/qri/errors"
+	"github.com/qri-io/qri/lib"
+	"github.com/qri-io/qri/repo"
+	"github.com/spf13/cobra"
+)
+
+// NewVerifySignaturesCommand creates a new `qri verify-signatures` cobra
+// command for checking the commit signatures of a dataset's history
+func NewVerifySignaturesCommand(f Factory, ioStreams ioes.IOStreams) *cobra.Command {
+	o := &VerifySignaturesOptions{IOStreams: ioStreams}
+	cmd := &cobra.Command{
+		Use:   "verify-signatures DATASET",
+		Short: "check the commit signatures of a dataset's history",
+		Long: `Verify signatures walks the full history of a dataset, checking each version
+was signed by its author. Signatures are checked against the public keys of
+profiles this peer knows about.
+
+Each version is reported as one of:
+  valid          signed by the key of the commit author
+  unsigned       the commit has no signature
+  invalid        the signature doesn't match the contents of the version
+  key-mismatch   the signing key doesn't belong to the commit author, or the
+                 commit author isn't the dataset author
+  unknown-key    no public key is known for the commit author
+  not-stored     the version isn't stored locally
+
+Verify signatures exits with an error if any stored version fails its check.
+
+Pulls check the signature of each version they fetch. By default a failed
+check prints a warning. To refuse versions that fail, set the signature
+policy to reject:
+
+  $ qri config set p2p.signaturepolicy reject`,
+		Example: `  # check every version of a dataset
+  $ qri verify-signatures b5/world_bank_population`,
+		Annotations: map[string]string{
+			"group": "dataset",
+		},
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(f, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Format, "format", "text", "set output format [text|json]")
+
+	return cmd
+}
+
+// VerifySignaturesOptions encapsulates state for the verify-signatures command
+type VerifySignaturesOptions struct {
+	ioes.IOStreams
+
+	Refs   *RefSelect
+	Format string
+
+	inst *lib.Instance
+}
+
+// Complete adds any missing configuration that can only be added just before calling Run
+func (o *VerifySignaturesOptions) Complete(f Factory, args []string) (err error) {
+	if o.inst, err = f.Instance(); err != nil {
+		return
+	}
+	if o.Refs, err = GetCurrentRefSelect(f, args, 1); err != nil {
+		// This error will be handled during validation
+		if err != repo.ErrEmptyRef {
+			return
+		}
+		err = nil
+	}
+	return
+}
+
+// Validate checks that all user input is valid
+func (o *VerifySignaturesOptions) Validate() error {
+	if o.Refs.Ref() == "" {
+		return qerr.New(lib.ErrBadArgs, "please specify a dataset")
+	}
+	switch o.Format {
+	case "text", "json":
+		return nil
+	default:
+		return qerr.New(lib.ErrBadArgs, fmt.Sprintf("unrecognized format %q, must be one of text or json", o.Format))
+	}
+}
+
+// Run executes the verify-signatures command
+func (o *VerifySignaturesOptions) Run() error {
+	ctx := context.TODO()
+	checks, err := o.inst.Dataset().VerifySignatures(ctx, &lib.VerifySignaturesParams{Ref: o.Refs.Ref()})
+	if err != nil {
+		return err
+	}
+
+	if o.Format == "json" {
+		data, err := json.MarshalIndent(checks, "", "  ")
+		if err != nil {
+			return err
+		}
+		printInfo(o.Out, "%s", data)
+	}
+
+	failed := 0
+	for _, c := range checks {
+		switch c.Status {
+		case base.SignatureValid, base.SignatureNotStored:
+		default:
+			failed++
+		}
+		if o.Format == "text" {
+			printSignatureCheck(o, c)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d versions failed signature checks", failed, len(checks))
+	}
+	if o.Format == "text" {
+		printSuccess(o.Out, "all stored versions of %s are signed by their author", o.Refs.Ref())
+	}
+	return nil
+}
+
+func printSignatureCheck(o *VerifySignaturesOptions, c lib.SignatureCheck) {
+	line := fmt.Sprintf("%s  %s  %s", c.Timestamp.Format("2006-01-02 15:04:05"), c.Path, c.Status)
+	switch c.Status {
+	case base.SignatureValid:
+		printInfo(o.Out, "%s", line)
+	case base.SignatureNotStored:
+		printInfo(o.Out, "%s: %s", line, c.Message)
+	default:
+		printWarning(o.Out, "%s: %s", line, c.Message)
+	}
+}
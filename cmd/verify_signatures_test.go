@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifySignatures(t *testing.T) {
+	run := NewTestRunner(t, "peer", "qri_test_verify_signatures")
+	defer run.Delete()
+
+	run.MustExec(t, "qri save --body testdata/movies/body_ten.csv me/movies")
+	run.MustExec(t, "qri save --body testdata/movies/body_thirty.csv me/movies")
+
+	output := run.MustExec(t, "qri verify-signatures me/movies")
+	if strings.Count(output, "valid") != 2 {
+		t.Errorf("expected two valid versions, got: %q", output)
+	}
+	if !strings.Contains(output, "all stored versions of me/movies are signed by their author") {
+		t.Errorf("expected success message, got: %q", output)
+	}
+
+	run.MustExec(t, "qri config set p2p.signaturepolicy reject")
+	if output := run.MustExec(t, "qri config get p2p.signaturepolicy"); !strings.Contains(output, "reject") {
+		t.Errorf("expected signature policy to be set, got: %q", output)
+	}
+	if err := run.ExecCommand("qri config set p2p.signaturepolicy ignore"); err == nil {
+		t.Error("expected setting an invalid signature policy to error")
+	}
+
+	if err := run.ExecCommand("qri verify-signatures"); err == nil {
+		t.Error("expected verifying signatures without a dataset to error")
+	}
+}
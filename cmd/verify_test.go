@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	run := NewTestRunner(t, "peer", "qri_test_verify")
+	defer run.Delete()
+
+	run.MustExec(t, "qri save --body testdata/movies/body_ten.csv me/movies")
+	run.MustExec(t, "qri save --file testdata/movies/tf_load_movies.star --apply me/movie_copy")
+
+	output := run.MustExec(t, "qri verify me/movie_copy")
+	if !strings.Contains(output, "peer/movie_copy@") || !strings.Contains(output, "is reproducible") {
+		t.Errorf("expected movie_copy to be reproducible, got: %q", output)
+	}
+
+	if err := run.ExecCommand("qri verify me/movies"); err == nil {
+		t.Error("expected verifying a version without a transform to error")
+	}
+	if output := run.GetCommandOutput(); !strings.Contains(output, "unverifiable: version has no transform") {
+		t.Errorf("expected unverifiable output, got: %q", output)
+	}
+
+	if err := run.ExecCommand("qri verify me/movie_copy --format yaml"); err == nil {
+		t.Error("expected unrecognized format to error")
+	}
+}
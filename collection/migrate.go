@@ -35,18 +35,8 @@ func MigrateRepoStoreToLocalCollectionSet(ctx context.Context, s Set, r repo.Rep
 			continue
 		}
 		datasets[i].InitID = ref.InitID
-		if ds, loadErr := dsfs.LoadDataset(ctx, r.Filesystem(), ref.Path); loadErr == nil {
-			datasets[i].CommitTime = ds.Commit.Timestamp
-			datasets[i].CommitTitle = ds.Commit.Title
-			datasets[i].BodyRows = ds.Structure.Entries
-			datasets[i].BodySize = ds.Structure.Length
-			datasets[i].NumErrors = ds.Structure.ErrCount
-			if ds.Meta != nil {
-				datasets[i].MetaTitle = ds.Meta.Title
-			}
-		}
-
-		if err := addRunAndCommitInfo(ctx, book, &datasets[i]); err != nil {
+		datasets[i].Path = ref.Path
+		if err := FillVersionInfo(ctx, r, &datasets[i]); err != nil {
 			log.Error(err)
 			continue
 		}
@@ -62,6 +52,23 @@ func MigrateRepoStoreToLocalCollectionSet(ctx context.Context, s Set, r repo.Rep
 	return s.Add(ctx, ownerID, datasets...)
 }
 
+// FillVersionInfo populates a collection item with details of the dataset
+// version at vi.Path and run & commit counts from the logbook. vi.InitID must
+// be set. Details of versions that aren't stored locally are left unset
+func FillVersionInfo(ctx context.Context, r repo.Repo, vi *dsref.VersionInfo) error {
+	if ds, err := dsfs.LoadDataset(ctx, r.Filesystem(), vi.Path); err == nil {
+		vi.CommitTime = ds.Commit.Timestamp
+		vi.CommitTitle = ds.Commit.Title
+		vi.BodyRows = ds.Structure.Entries
+		vi.BodySize = ds.Structure.Length
+		vi.NumErrors = ds.Structure.ErrCount
+		if ds.Meta != nil {
+			vi.MetaTitle = ds.Meta.Title
+		}
+	}
+	return addRunAndCommitInfo(ctx, r.Logbook(), vi)
+}
+
 func addRunAndCommitInfo(ctx context.Context, book *logbook.Book, vi *dsref.VersionInfo) error {
 	ulog, err := book.UserDatasetBranchesLog(ctx, vi.InitID)
 	if err != nil {
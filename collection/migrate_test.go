@@ -1,4 +1,4 @@
-package collection
+package collection_test
 
 import (
 	"context"
@@ -10,6 +10,7 @@ import (
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/qri/automation/run"
 	"github.com/qri-io/qri/base/params"
+	"github.com/qri-io/qri/collection"
 	"github.com/qri-io/qri/dsref"
 	"github.com/qri-io/qri/repo"
 	repotest "github.com/qri-io/qri/repo/test"
@@ -64,7 +65,7 @@ func TestMigrateRepoStoreToLocalCollectionSet(t *testing.T) {
 	}
 
 	// migrate
-	set, err := NewLocalSet(ctx, "", func(o *LocalSetOptions) {
+	set, err := collection.NewLocalSet(ctx, "", func(o *collection.LocalSetOptions) {
 		o.MigrateRepo = r
 	})
 	if err != nil {
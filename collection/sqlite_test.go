@@ -0,0 +1,40 @@
+//go:build sqlite
+// +build sqlite
+
+package collection_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qri-io/qri/collection"
+	sqliterepo "github.com/qri-io/qri/repo/sqlite"
+)
+
+func TestSQLiteCollection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qri_test_sqlite_collection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newSet := func(ctx context.Context) (collection.Set, error) {
+		db, err := sqliterepo.Open(filepath.Join(dir, fmt.Sprintf("%d.sqlite", time.Now().UnixNano())))
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			<-ctx.Done()
+			db.Close()
+		}()
+		return db.CollectionSet(), nil
+	}
+
+	AssertSetSpec(t, newSet)
+	AssertCollectionEventListenerSpec(t, newSet)
+}
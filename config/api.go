@@ -26,6 +26,9 @@ type API struct {
 	ServeRemoteTraffic bool `json:"serveremotetraffic"`
 	// should the api provide the /webui endpoint? default is true
 	Webui bool `json:"webui"`
+	// should the api provide the /metrics endpoint? metrics count requests per
+	// method & profile. default is false
+	Metrics bool `json:"metrics,omitempty"`
 }
 
 // SetArbitrary is an interface implementation of base/fill/struct in order to
@@ -56,6 +59,10 @@ func (a API) Validate() error {
         "description": "when true the /webui endpoint will serve a frontend app",
         "type": "boolean"
       },
+      "metrics": {
+        "description": "when true the /metrics endpoint will serve prometheus metrics",
+        "type": "boolean"
+      },
       "serveremotetraffic": {
         "description": "whether to allow requests from addresses other than localhost",
         "type": "boolean"
@@ -91,6 +98,7 @@ func (a *API) Copy() *API {
 		Address:            a.Address,
 		ServeRemoteTraffic: a.ServeRemoteTraffic,
 		Webui:              a.Webui,
+		Metrics:            a.Metrics,
 	}
 	if a.AllowedOrigins != nil {
 		res.AllowedOrigins = make([]string, len(a.AllowedOrigins))
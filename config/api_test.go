@@ -19,6 +19,7 @@ func TestAPICopy(t *testing.T) {
 	a.Enabled = !a.Enabled
 	a.Address = "foo"
 	a.Webui = !a.Webui
+	a.Metrics = !a.Metrics
 	a.ServeRemoteTraffic = !a.ServeRemoteTraffic
 	a.AllowedOrigins = []string{"bar"}
 
@@ -31,6 +32,9 @@ func TestAPICopy(t *testing.T) {
 	if a.Webui == b.Webui {
 		t.Errorf("Webui fields should not match")
 	}
+	if a.Metrics == b.Metrics {
+		t.Errorf("Metrics fields should not match")
+	}
 	if a.ServeRemoteTraffic == b.ServeRemoteTraffic {
 		t.Errorf("ServeRemoteTraffic fields should not match")
 	}
@@ -36,6 +36,11 @@ type P2P struct {
 
 	// Enable AutoNAT service. unless you're hosting a server, leave this as false
 	AutoNAT bool `json:"autoNAT"`
+
+	// SignaturePolicy sets how to treat pulled dataset versions that aren't
+	// signed by a known key of their author. One of "warn" or "reject",
+	// defaults to "warn"
+	SignaturePolicy string `json:"signaturepolicy,omitempty"`
 }
 
 // SetArbitrary is an interface implementation of base/fill/struct in order to safely
@@ -128,6 +133,11 @@ func (cfg P2P) Validate() error {
         "items": {
           "type": "string"
         }
+      },
+      "signaturepolicy": {
+        "description": "How to treat pulled versions that fail signature checks",
+        "type": "string",
+        "enum": ["", "warn", "reject"]
       }
     }
   }`)
@@ -141,6 +151,8 @@ func (cfg *P2P) Copy() *P2P {
 		PeerID:  cfg.PeerID,
 		PrivKey: cfg.PrivKey,
 		Port:    cfg.Port,
+
+		SignaturePolicy: cfg.SignaturePolicy,
 	}
 
 	if cfg.QriBootstrapAddrs != nil {
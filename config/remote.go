@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/qri-io/jsonschema"
 )
 
@@ -52,6 +53,9 @@ type RemoteServer struct {
 	RequireAllBlocks bool `json:"requireallblocks"`
 	// allow clients to request unpins for their own pushes
 	AllowRemoves bool `json:"allowremoves"`
+	// storage quota for each profile, as a human-readable size like "10GB".
+	// empty or "unlimited" places no limit on storage
+	DefaultQuota string `json:"defaultquota,omitempty"`
 }
 
 // SetArbitrary is an interface implementation of base/fill/struct in order to safely
@@ -79,7 +83,15 @@ func (cfg RemoteServer) Validate() error {
       }
     }
   }`)
-	return validate(schema, &cfg)
+	if err := validate(schema, &cfg); err != nil {
+		return err
+	}
+	if cfg.DefaultQuota != "" && cfg.DefaultQuota != "unlimited" {
+		if _, err := humanize.ParseBytes(cfg.DefaultQuota); err != nil {
+			return fmt.Errorf("invalid DefaultQuota: %w", err)
+		}
+	}
+	return nil
 }
 
 // Copy returns a deep copy of the RemoteServer struct
@@ -90,6 +102,7 @@ func (cfg *RemoteServer) Copy() *RemoteServer {
 		AcceptTimeoutMs:  cfg.AcceptTimeoutMs,
 		RequireAllBlocks: cfg.RequireAllBlocks,
 		AllowRemoves:     cfg.AllowRemoves,
+		DefaultQuota:     cfg.DefaultQuota,
 	}
 
 	return res
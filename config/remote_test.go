@@ -11,6 +11,15 @@ func TestRemoteServerValidate(t *testing.T) {
 	if err != nil {
 		t.Errorf("error validating remote: %s", err)
 	}
+
+	rem.DefaultQuota = "10GB"
+	if err := rem.Validate(); err != nil {
+		t.Errorf("error validating remote with quota: %s", err)
+	}
+	rem.DefaultQuota = "lots"
+	if err := rem.Validate(); err == nil {
+		t.Error("expected invalid quota to error")
+	}
 }
 
 func TestRemoteServerCopy(t *testing.T) {
@@ -18,6 +27,7 @@ func TestRemoteServerCopy(t *testing.T) {
 		remote *RemoteServer
 	}{
 		{&RemoteServer{}},
+		{&RemoteServer{AllowRemoves: true, DefaultQuota: "1GB"}},
 	}
 	for i, c := range cases {
 		cpy := c.remote.Copy()
@@ -6,8 +6,16 @@ import (
 
 // Repo configures a qri repo
 type Repo struct {
+	// Type is the kind of repo. "fs" stores state in files on disk, "sqlite"
+	// stores references, logbook, automation & collection state in a single
+	// SQLite database & requires building with the "sqlite" tag, "mem" keeps
+	// everything in memory
 	Type string `json:"type"`
 	Path string `json:"path,omitempty"`
+	// Logstore selects how fs repos persist the logbook. "journal" (the default)
+	// writes the entire logbook to a single file on every change, "segments"
+	// appends changes to a directory of segments
+	Logstore string `json:"logstore,omitempty"`
 }
 
 // SetArbitrary is an interface implementation of base/fill/struct in order to safely
@@ -38,7 +46,17 @@ func (cfg Repo) Validate() error {
         "type": "string",
         "enum": [
           "fs",
-          "mem"
+          "mem",
+          "sqlite"
+        ]
+      },
+      "logstore": {
+        "description": "Storage format of the logbook",
+        "type": "string",
+        "enum": [
+          "",
+          "journal",
+          "segments"
         ]
       }
     }
@@ -49,7 +67,8 @@ func (cfg Repo) Validate() error {
 // Copy returns a deep copy of the Repo struct
 func (cfg *Repo) Copy() *Repo {
 	res := &Repo{
-		Type: cfg.Type,
+		Type:     cfg.Type,
+		Logstore: cfg.Logstore,
 	}
 
 	return res
@@ -1,6 +1,8 @@
 package event
 
 import (
+	"time"
+
 	"github.com/qri-io/qri/profile"
 )
 
@@ -73,6 +75,18 @@ const (
 	// Payload will be a runID
 	// This event should not block
 	ETAutomationApplyQueuePop = Type("automation:ApplyQueuePop")
+	// ETAutomationVersionsPruned signals that versions of a dataset have been
+	// removed to enforce the retention policy of a workflow
+	// Payload will be a VersionsPrunedEvent
+	ETAutomationVersionsPruned = Type("automation:VersionsPruned")
+	// ETAutomationDatasetStale signals that a dataset has gone longer without
+	// a new version than the freshness SLA of its workflow allows
+	// Payload will be a FreshnessEvent
+	ETAutomationDatasetStale = Type("automation:DatasetStale")
+	// ETAutomationDatasetFresh signals that a stale dataset has a new version
+	// that meets the freshness SLA of its workflow
+	// Payload will be a FreshnessEvent
+	ETAutomationDatasetFresh = Type("automation:DatasetFresh")
 )
 
 // WorkflowTriggerEvent is the expected payload of the `ETAutomationWorkflowTrigger`
@@ -99,6 +113,38 @@ type WorkflowStoppedEvent struct {
 	Status     string     `json:"status"`
 }
 
+// VersionsPrunedEvent is the expected payload of the `ETAutomationVersionsPruned`
+type VersionsPrunedEvent struct {
+	InitID     string     `json:"InitID"`
+	OwnerID    profile.ID `json:"ownerID"`
+	WorkflowID string     `json:"workflowID"`
+	Removed    int        `json:"removed"`
+}
+
+// FreshnessEvent is the expected payload of the `ETAutomationDatasetStale`
+// and `ETAutomationDatasetFresh` events
+type FreshnessEvent struct {
+	InitID     string     `json:"InitID"`
+	OwnerID    profile.ID `json:"ownerID"`
+	WorkflowID string     `json:"workflowID"`
+	Ref        string     `json:"ref"`
+	CommitTime time.Time  `json:"commitTime"`
+	MaxAge     string     `json:"maxAge"`
+	Reason     string     `json:"reason,omitempty"`
+}
+
+// HookEvent is the payload of events emitted by workflow hooks
+type HookEvent struct {
+	WorkflowID string     `json:"workflowID"`
+	OwnerID    profile.ID `json:"ownerID"`
+	// Trigger is the type of event that fired the hook
+	Trigger Type `json:"trigger"`
+	// Event is the payload of the event that fired the hook
+	Event interface{} `json:"event"`
+	// Payload is the payload configured on the hook
+	Payload interface{} `json:"payload,omitempty"`
+}
+
 // DeployEvent is the expected payload for deploy events
 type DeployEvent struct {
 	Ref        string `json:"ref"`
@@ -0,0 +1,29 @@
+package event
+
+const (
+	// ETRepoGCStarted occurs when a repo garbage collection pass begins
+	// payload will be a RepoGCEvent
+	ETRepoGCStarted = Type("repo:GCStarted")
+	// ETRepoGCProgress occurs as garbage collection unpins & removes data.
+	// Progress can fire as much as once-per-block.
+	// subscriptions do not block the publisher
+	// payload will be a RepoGCEvent
+	ETRepoGCProgress = Type("repo:GCProgress")
+	// ETRepoGCCompleted occurs when a garbage collection pass finishes
+	// payload will be a RepoGCEvent
+	ETRepoGCCompleted = Type("repo:GCCompleted")
+)
+
+// RepoGCEvent represents a change in garbage collection progress
+type RepoGCEvent struct {
+	// DryRun is true when no data is being removed
+	DryRun bool `json:"dryRun"`
+	// number of pinned roots that are unpinned
+	Unpinned int `json:"unpinned"`
+	// number of blocks removed so far
+	BlocksRemoved int `json:"blocksRemoved"`
+	// number of bytes reclaimed, or reclaimable in a dry run
+	Size int64 `json:"size"`
+	// only populated on a failed ETRepoGCCompleted event
+	Error error `json:"error,omitempty"`
+}
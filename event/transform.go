@@ -1,5 +1,7 @@
 package event
 
+import "github.com/qri-io/dataset"
+
 const (
 	// ETTransformStart signals the start a transform execution
 	// Payload will be a TransformLifecycle
@@ -32,6 +34,15 @@ const (
 	// it can complete its run
 	// Payload will be a TransformLifecycle
 	ETTransformCanceled = Type("tf:Canceled")
+
+	// ETTransformDebugPaused is sent when a transform running in debug mode
+	// pauses execution, waiting for a debug command
+	// Payload will be a TransformDebugState
+	ETTransformDebugPaused = Type("tf:DebugPaused")
+	// ETTransformDebugCommand resumes a paused transform. Debug commands are
+	// published by clients like the websocket connection & command line
+	// Payload will be a TransformDebugCommand
+	ETTransformDebugCommand = Type("tf:DebugCommand")
 )
 
 // TransformLifecycle captures state about the execution of an entire transform
@@ -53,6 +64,9 @@ type TransformStepLifecycle struct {
 	Category string `json:"category"`
 	Status   string `json:"status,omitempty"`
 	Mode     string `json:"mode,omitempty"`
+	// Cached is true when step results were restored from the step cache
+	// instead of running the step
+	Cached bool `json:"cached,omitempty"`
 }
 
 // TransformMsgLvl is an enumeration of all possible degrees of message
@@ -78,3 +92,49 @@ type TransformMessage struct {
 	Msg  string          `json:"msg"`
 	Mode string          `json:"mode,omitempty"`
 }
+
+const (
+	// TransformDebugStep resumes execution, pausing at the next statement
+	TransformDebugStep = "step"
+	// TransformDebugNext resumes execution, pausing at the next statement in
+	// the current function or one of its callers
+	TransformDebugNext = "next"
+	// TransformDebugContinue resumes execution until the next breakpoint
+	TransformDebugContinue = "continue"
+	// TransformDebugStop halts execution, failing the transform
+	TransformDebugStop = "stop"
+)
+
+// TransformDebugState describes a paused transform
+// payload for ETTransformDebugPaused
+type TransformDebugState struct {
+	RunID string `json:"runID"`
+	// Reason is why execution paused, one of "breakpoint", "step" or "error"
+	Reason string `json:"reason"`
+	// Step is the index of the transform step that paused
+	Step int `json:"step"`
+	// Line is the line of the transform script execution paused before
+	Line int `json:"line"`
+	// Function is the name of the starlark function execution paused in
+	Function string `json:"function"`
+	// Error is set when execution paused on an error
+	Error string `json:"error,omitempty"`
+	// Locals & Globals are string representations of variables in scope
+	Locals  map[string]string `json:"locals"`
+	Globals map[string]string `json:"globals"`
+	// Dataset is the state of the dataset bound to the transform, which
+	// dataset.latest() returns & dataset.commit() updates
+	Dataset *dataset.Dataset `json:"dataset,omitempty"`
+	// Committed is true once the transform has called dataset.commit
+	Committed bool `json:"committed"`
+}
+
+// TransformDebugCommand resumes a paused transform
+// payload for ETTransformDebugCommand
+type TransformDebugCommand struct {
+	RunID string `json:"runID"`
+	// Action is one of "step", "next", "continue" or "stop"
+	Action string `json:"action"`
+	// Breakpoints replaces the set of line breakpoints when non-nil
+	Breakpoints []int `json:"breakpoints,omitempty"`
+}
@@ -14,12 +14,18 @@ require (
 	github.com/google/uuid v1.2.0
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/schema v1.2.0
+	github.com/graphql-go/graphql v0.8.1
+	github.com/ipfs/go-block-format v0.0.3
+	github.com/ipfs/go-blockservice v0.1.4
 	github.com/ipfs/go-cid v0.0.7
 	github.com/ipfs/go-datastore v0.4.5
 	github.com/ipfs/go-ipfs v0.9.1
+	github.com/ipfs/go-ipfs-blockstore v0.1.6
 	github.com/ipfs/go-ipfs-config v0.14.0
+	github.com/ipfs/go-ipfs-exchange-offline v0.0.1
 	github.com/ipfs/go-ipld-format v0.2.0
 	github.com/ipfs/go-log v1.0.5
+	github.com/ipfs/go-merkledag v0.3.2
 	github.com/ipfs/interface-go-ipfs-core v0.4.0
 	github.com/jinzhu/copier v0.0.0-20190924061706-b57f9002281a
 	github.com/libp2p/go-libp2p v0.14.3
@@ -30,6 +36,7 @@ require (
 	github.com/libp2p/go-libp2p-peerstore v0.2.7
 	github.com/libp2p/go-libp2p-swarm v0.5.0
 	github.com/libp2p/go-msgio v0.0.6
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/mgutz/ansi v0.0.0-20200706080929-d51e80ef957d // indirect
 	github.com/microcosm-cc/bluemonday v1.0.5
 	github.com/mitchellh/go-homedir v1.1.0
@@ -37,6 +44,7 @@ require (
 	github.com/multiformats/go-multiaddr v0.3.3
 	github.com/multiformats/go-multihash v0.0.15
 	github.com/olekukonko/tablewriter v0.0.4
+	github.com/prometheus/client_golang v1.10.0
 	github.com/qri-io/dag v0.2.3-0.20210628012720-e8a2affbb114
 	github.com/qri-io/dataset v0.3.1-0.20210924020641-0b920e8e8b2f
 	github.com/qri-io/deepdiff v0.2.1
@@ -1,23 +1,41 @@
 package lib
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/dataset/preview"
+	"github.com/qri-io/dataset/stepfile"
 	"github.com/qri-io/ioes"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qri/auth/token"
 	"github.com/qri-io/qri/automation"
+	"github.com/qri-io/qri/automation/freshness"
+	"github.com/qri-io/qri/automation/retention"
 	"github.com/qri-io/qri/automation/run"
 	"github.com/qri-io/qri/automation/workflow"
+	"github.com/qri-io/qri/base"
 	"github.com/qri-io/qri/base/dsfs"
+	"github.com/qri-io/qri/base/params"
 	"github.com/qri-io/qri/dsref"
+	qerr "github.com/qri-io/qri/errors"
 	"github.com/qri-io/qri/event"
 	qhttp "github.com/qri-io/qri/lib/http"
+	"github.com/qri-io/qri/lib/websocket"
 	"github.com/qri-io/qri/transform"
+	"github.com/qri-io/qri/transform/startf"
 	"github.com/qri-io/qri/transform/staticlark"
+	"github.com/qri-io/qri/transform/tfstate"
+	"github.com/qri-io/qri/transform/tftest"
 )
 
 // AutomationMethods groups together methods for automations
@@ -33,16 +51,28 @@ func (m AutomationMethods) Name() string {
 // Attributes defines attributes for each method
 func (m AutomationMethods) Attributes() map[string]AttributeSet {
 	return map[string]AttributeSet{
-		"apply":    {Endpoint: qhttp.AEApply, HTTPVerb: "POST"},
+		"apply":    {Endpoint: qhttp.AEApply, HTTPVerb: "POST", Async: true},
 		"deploy":   {Endpoint: qhttp.AEDeploy, HTTPVerb: "POST", DefaultSource: "local"},
 		"run":      {Endpoint: qhttp.AERun, HTTPVerb: "POST"},
 		"runinfo":  {Endpoint: qhttp.AERunInfo, HTTPVerb: "POST"},
+		"runs":     {Endpoint: qhttp.AERuns, HTTPVerb: "POST"},
 		"workflow": {Endpoint: qhttp.AEWorkflow, HTTPVerb: "POST"},
 		"remove":   {Endpoint: qhttp.AERemoveWorkflow, HTTPVerb: "POST"},
 		"cancel":   {Endpoint: qhttp.AECancel, HTTPVerb: "POST"},
 
+		"freshness": {Endpoint: qhttp.AEFreshness, HTTPVerb: "POST"},
+		"retention": {Endpoint: qhttp.AERetention, HTTPVerb: "POST"},
+
+		"backfill":      {Endpoint: qhttp.AEBackfill, HTTPVerb: "POST"},
+		"backfillgroup": {Endpoint: qhttp.AEBackfillGroup, HTTPVerb: "POST"},
+
+		"state":      {Endpoint: qhttp.DenyHTTP},
+		"resetstate": {Endpoint: qhttp.DenyHTTP},
+
 		// NOTE: Temporary undocumented command for using the static analyzer
 		"analyzetransform": {Endpoint: qhttp.DenyHTTP},
+		// test reads transform & test scripts from the local filesystem
+		"test": {Endpoint: qhttp.DenyHTTP},
 	}
 }
 
@@ -58,6 +88,27 @@ type ApplyParams struct {
 	// size of the output area that the results will display on
 	OutputWidth  int `json:"outputWidth"`
 	OutputHeight int `json:"outputHeight"`
+	// Debug runs the transform with a debugger. Execution pauses at each
+	// breakpoint, emitting a tf:DebugPaused event. Resume execution by
+	// publishing a tf:DebugCommand event, for example over a websocket
+	// connection. With no breakpoints execution pauses before the first
+	// statement
+	Debug bool `json:"debug"`
+	// Breakpoints are transform script line numbers to pause before
+	Breakpoints []int `json:"breakpoints"`
+	// BreakOnError pauses execution when the transform fails
+	BreakOnError bool `json:"breakOnError"`
+	// DebugPrompt is called each time a debugged transform pauses, returning
+	// the debug action to resume with. Only available to local callers
+	DebugPrompt func(state event.TransformDebugState) (action string) `json:"-"`
+	// NoCache runs every transform step, ignoring cached step results
+	NoCache bool `json:"noCache"`
+	// Params set run parameter values, overriding the defaults declared in
+	// transform config
+	Params map[string]string `json:"params"`
+	// Strict runs static analysis on the transform before applying, failing
+	// if analysis finds errors
+	Strict bool `json:"strict"`
 }
 
 // Validate returns an error if ApplyParams fields are in an invalid state
@@ -115,15 +166,24 @@ type RunParams struct {
 	Ref        string `json:"ref"`
 	InitID     string `json:"initID"`
 	WorkflowID string `json:"workflowID"`
+	// Params set run parameter values, overriding the defaults declared in
+	// transform config
+	Params map[string]string `json:"params"`
 }
 
 // Validate returns an error if RunParams fields are in an invalid state
 func (p *RunParams) Validate() error {
-	if p.WorkflowID == "" && p.InitID == "" && p.Ref == "" {
-		return fmt.Errorf("run params: workflow id, init id, or ref required")
+	return validateWorkflowSelector("run params", p.Ref, p.InitID, p.WorkflowID)
+}
+
+// validateWorkflowSelector errors unless exactly one of a dataset reference,
+// dataset initID, or workflow ID is set
+func validateWorkflowSelector(name, ref, initID, workflowID string) error {
+	if workflowID == "" && initID == "" && ref == "" {
+		return fmt.Errorf("%s: workflow id, init id, or ref required", name)
 	}
-	if (p.WorkflowID != "" && p.InitID != "") || (p.WorkflowID != "" && p.Ref != "") || (p.InitID != "" && p.Ref != "") {
-		return fmt.Errorf("run params: only one of workflow id, init id, or ref needed")
+	if (workflowID != "" && initID != "") || (workflowID != "" && ref != "") || (initID != "" && ref != "") {
+		return fmt.Errorf("%s: only one of workflow id, init id, or ref needed", name)
 	}
 	return nil
 }
@@ -137,6 +197,79 @@ func (m AutomationMethods) Run(ctx context.Context, p *RunParams) (string, error
 	return "", dispatchReturnError(got, err)
 }
 
+// BackfillParams are parameters for the backfill command
+type BackfillParams struct {
+	Ref        string `json:"ref"`
+	InitID     string `json:"initID"`
+	WorkflowID string `json:"workflowID"`
+	// Param is the name of the run parameter to backfill. Only date & int
+	// parameters can be backfilled
+	Param string `json:"param"`
+	// From & To are the first & last values of Param, inclusive
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Params set values of other run parameters for every run
+	Params map[string]string `json:"params"`
+}
+
+// Validate returns an error if BackfillParams fields are in an invalid state
+func (p *BackfillParams) Validate() error {
+	if err := validateWorkflowSelector("backfill params", p.Ref, p.InitID, p.WorkflowID); err != nil {
+		return err
+	}
+	if p.Param == "" {
+		return fmt.Errorf("backfill params: param is required")
+	}
+	if p.From == "" || p.To == "" {
+		return fmt.Errorf("backfill params: from and to are required")
+	}
+	if _, ok := p.Params[p.Param]; ok {
+		return fmt.Errorf("backfill params: param %q can't also be set in params", p.Param)
+	}
+	return nil
+}
+
+// BackfillResult describes the runs a backfill enqueues
+type BackfillResult struct {
+	GroupID    string   `json:"groupID"`
+	WorkflowID string   `json:"workflowID"`
+	RunIDs     []string `json:"runIDs"`
+}
+
+// Backfill enqueues one run of a workflow for each value in a range of run
+// parameter values. Runs are tracked as a group
+func (m AutomationMethods) Backfill(ctx context.Context, p *BackfillParams) (*BackfillResult, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "backfill"), p)
+	if res, ok := got.(*BackfillResult); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// BackfillGroupParams are parameters for fetching the runs of a backfill
+type BackfillGroupParams struct {
+	WorkflowID string `json:"workflowID"`
+	GroupID    string `json:"groupID"`
+}
+
+// Validate returns an error if BackfillGroupParams fields are in an invalid
+// state
+func (p *BackfillGroupParams) Validate() error {
+	if p.WorkflowID == "" || p.GroupID == "" {
+		return fmt.Errorf("backfill group params: workflow id and group id required")
+	}
+	return nil
+}
+
+// BackfillGroup lists the runs enqueued by a backfill
+func (m AutomationMethods) BackfillGroup(ctx context.Context, p *BackfillGroupParams) ([]*run.State, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "backfillgroup"), p)
+	if res, ok := got.([]*run.State); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
 // RunInfoParams are parameters for the run info command
 type RunInfoParams struct {
 	ID string `json:"id"`
@@ -151,6 +284,47 @@ func (m AutomationMethods) RunInfo(ctx context.Context, p *RunInfoParams) (*run.
 	return nil, dispatchReturnError(got, err)
 }
 
+// RunListParams are parameters for listing the runs of a workflow
+type RunListParams struct {
+	params.List
+	Ref        string `json:"ref"`
+	InitID     string `json:"initID"`
+	WorkflowID string `json:"workflowID"`
+}
+
+// Validate returns an error if RunListParams fields are in an invalid state
+func (p *RunListParams) Validate() error {
+	if err := validateWorkflowSelector("run list params", p.Ref, p.InitID, p.WorkflowID); err != nil {
+		return err
+	}
+	return p.List.Validate()
+}
+
+// Runs lists the runs of a workflow, newest first
+func (m AutomationMethods) Runs(ctx context.Context, p *RunListParams) ([]*run.State, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "runs"), p)
+	if res, ok := got.([]*run.State); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// FreshnessParams are parameters for checking dataset freshness
+type FreshnessParams struct {
+	// All includes datasets that meet their freshness SLA
+	All bool `json:"all"`
+}
+
+// Freshness checks the datasets of the active profile against the freshness
+// SLAs of their workflows, listing stale datasets
+func (m AutomationMethods) Freshness(ctx context.Context, p *FreshnessParams) ([]freshness.Status, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "freshness"), p)
+	if res, ok := got.([]freshness.Status); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
 // CancelParams are parameters for the cancel command
 type CancelParams struct {
 	RunID string `json:"runID"`
@@ -204,6 +378,76 @@ func (m AutomationMethods) Remove(ctx context.Context, p *WorkflowParams) error
 	return dispatchReturnError(nil, err)
 }
 
+// RetentionParams are parameters for setting the retention policy of a
+// dataset's workflow
+type RetentionParams struct {
+	Ref string `json:"ref"`
+	// Policy replaces the workflow retention policy. A nil policy keeps every
+	// version
+	Policy *retention.Policy `json:"policy"`
+	// Prune removes the versions the policy doesn't keep right away, instead
+	// of waiting for the next background pass
+	Prune bool `json:"prune"`
+}
+
+// Validate returns an error if RetentionParams fields are in an invalid state
+func (p *RetentionParams) Validate() error {
+	if p.Ref == "" {
+		return fmt.Errorf("retention: ref required")
+	}
+	if err := p.Policy.Validate(); err != nil {
+		return qerr.New(ErrBadArgs, err.Error())
+	}
+	return nil
+}
+
+// RetentionResult is the result of setting a retention policy
+type RetentionResult struct {
+	Workflow *workflow.Workflow `json:"workflow"`
+	// Pruned is the number of versions removed
+	Pruned int `json:"pruned"`
+}
+
+// Retention sets the retention policy of a dataset's workflow
+func (m AutomationMethods) Retention(ctx context.Context, p *RetentionParams) (*RetentionResult, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "retention"), p)
+	if res, ok := got.(*RetentionResult); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// TransformStateParams are parameters for reading & resetting transform state
+type TransformStateParams struct {
+	Ref string `json:"ref"`
+}
+
+// Validate returns an error if TransformStateParams fields are in an invalid
+// state
+func (p *TransformStateParams) Validate() error {
+	if p.Ref == "" {
+		return fmt.Errorf("ref is required")
+	}
+	return nil
+}
+
+// State fetches the values a dataset's transform persists between runs with
+// the starlark "state" object
+func (m AutomationMethods) State(ctx context.Context, p *TransformStateParams) (tfstate.State, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "state"), p)
+	if res, ok := got.(tfstate.State); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// ResetState removes persisted transform state, the next run of the
+// transform starts with empty state
+func (m AutomationMethods) ResetState(ctx context.Context, p *TransformStateParams) error {
+	_, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "resetstate"), p)
+	return dispatchReturnError(nil, err)
+}
+
 // AnalyzeTransformParams are parameters for the analyzetransform command
 type AnalyzeTransformParams struct {
 	ScriptFileName string `json:"scriptFileName"`
@@ -231,6 +475,32 @@ func (m AutomationMethods) AnalyzeTransform(ctx context.Context, p *AnalyzeTrans
 	return nil, dispatchReturnError(got, err)
 }
 
+// TestParams are parameters for the test command
+type TestParams struct {
+	// Path is a transform test file, or a directory to search for test files
+	Path string `json:"path"`
+}
+
+// Validate returns an error if TestParams fields are in an invalid state
+func (p *TestParams) Validate() error {
+	if p.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	return nil
+}
+
+// TestResult is the outcome of a single transform test file
+type TestResult = tftest.Result
+
+// Test runs transform test files against fixture datasets
+func (m AutomationMethods) Test(ctx context.Context, p *TestParams) ([]*TestResult, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "test"), p)
+	if res, ok := got.([]*TestResult); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
 // Implementations for automation methods follow
 
 // automationImpl holds the method implementations for automations
@@ -259,6 +529,13 @@ func (automationImpl) Apply(scope scope, p *ApplyParams) (*ApplyResult, error) {
 	if p.Transform != nil {
 		ds.Transform = p.Transform
 		ds.Transform.OpenScriptFile(scope.Context(), scope.Filesystem())
+	} else if ds.Transform, err = headTransform(scope, ref); err != nil {
+		return nil, err
+	}
+	if p.Strict {
+		if err := analyzeTransformStrict(ds.Transform); err != nil {
+			return nil, err
+		}
 	}
 
 	wf := &workflow.Workflow{
@@ -277,6 +554,12 @@ func (automationImpl) Apply(scope scope, p *ApplyParams) (*ApplyResult, error) {
 		Secrets:      p.Secrets,
 		OutputWidth:  p.OutputWidth,
 		OutputHeight: p.OutputHeight,
+		Debug:        p.Debug || len(p.Breakpoints) > 0 || p.BreakOnError,
+		Breakpoints:  p.Breakpoints,
+		BreakOnError: p.BreakOnError,
+		DebugPrompt:  p.DebugPrompt,
+		NoCache:      p.NoCache,
+		Params:       p.Params,
 	}
 
 	runID, err := scope.AutomationOrchestrator().ApplyWorkflow(ctx, p.Wait, p.ScriptOutput, wf, ds, params)
@@ -414,7 +697,7 @@ func deploy(scope scope, p *DeployParams) {
 		deployPayload.RunID = runID
 		go scope.sendEvent(event.ETAutomationDeployRun, ref, deployPayload)
 
-		_, err := scope.AutomationOrchestrator().RunWorkflow(scope.Context(), wf.ID, runID)
+		_, err := scope.AutomationOrchestrator().RunWorkflow(scope.Context(), wf.ID, runID, automation.WorkflowRunParams{})
 		if err != nil && !errors.Is(err, dsfs.ErrNoChanges) {
 			log.Debugw("deploy run workflow", "error", err)
 			deployPayload.Error = err.Error()
@@ -430,31 +713,130 @@ func deploy(scope scope, p *DeployParams) {
 
 // Run manually runs a workflow
 func (automationImpl) Run(scope scope, p *RunParams) (string, error) {
-	if p.WorkflowID == "" {
-		if p.Ref != "" && p.InitID == "" {
-			ref, err := dsref.Parse(p.Ref)
-			if err != nil {
-				return "", err
-			}
-			if _, err := scope.ResolveReference(scope.Context(), &ref); err != nil {
-				return "", err
-			}
-			p.InitID = ref.InitID
-		}
-		wf, err := scope.AutomationOrchestrator().GetWorkflowByInitID(scope.Context(), p.InitID)
+	wf, err := resolveWorkflow(scope, p.Ref, p.InitID, p.WorkflowID)
+	if err != nil {
+		return "", err
+	}
+	if err := scope.Logbook().ProfileCanWrite(scope.Context(), wf.InitID, scope.ActiveProfile()); err != nil {
+		return "", fmt.Errorf("profile %s can not write to dataset %s", scope.ActiveProfile().ID.Encode(), wf.InitID)
+	}
+	if len(p.Params) > 0 {
+		cfg, err := workflowTransformConfig(scope, wf)
 		if err != nil {
 			return "", err
 		}
-		p.WorkflowID = wf.WorkflowID()
-	}
-	if err := scope.Logbook().ProfileCanWrite(scope.Context(), p.InitID, scope.ActiveProfile()); err != nil {
-		return "", fmt.Errorf("profile %s can not write to dataset %s", scope.ActiveProfile().ID.Encode(), p.InitID)
+		if _, err := transform.ResolveParams(cfg, p.Params); err != nil {
+			return "", err
+		}
 	}
 	runID := run.NewID()
-	go scope.AutomationOrchestrator().RunWorkflow(scope.AppContext(), workflow.ID(p.WorkflowID), runID)
+	go scope.AutomationOrchestrator().RunWorkflow(scope.AppContext(), wf.ID, runID, automation.WorkflowRunParams{Params: p.Params})
 	return runID, nil
 }
 
+// Backfill enqueues a run for each value in a range of run parameter values
+func (automationImpl) Backfill(scope scope, p *BackfillParams) (*BackfillResult, error) {
+	wf, err := resolveWorkflow(scope, p.Ref, p.InitID, p.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	if err := scope.Logbook().ProfileCanWrite(scope.Context(), wf.InitID, scope.ActiveProfile()); err != nil {
+		return nil, fmt.Errorf("profile %s can not write to dataset %s", scope.ActiveProfile().ID.Encode(), wf.InitID)
+	}
+	cfg, err := workflowTransformConfig(scope, wf)
+	if err != nil {
+		return nil, err
+	}
+	specs, err := transform.ParamSpecs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var spec *transform.ParamSpec
+	for i := range specs {
+		if specs[i].Name == p.Param {
+			spec = &specs[i]
+		}
+	}
+	if spec == nil {
+		return nil, fmt.Errorf("param %q is not declared in transform config", p.Param)
+	}
+	values, err := spec.Range(p.From, p.To)
+	if err != nil {
+		return nil, err
+	}
+
+	paramSets := make([]map[string]string, len(values))
+	for i, v := range values {
+		set := map[string]string{p.Param: v}
+		for k, val := range p.Params {
+			set[k] = val
+		}
+		// check every run has valid params before enqueuing any
+		if _, err := transform.ResolveParams(cfg, set); err != nil {
+			return nil, err
+		}
+		paramSets[i] = set
+	}
+
+	groupID, runIDs, err := scope.AutomationOrchestrator().Backfill(scope.AppContext(), wf.ID, paramSets)
+	if err != nil {
+		return nil, err
+	}
+	return &BackfillResult{
+		GroupID:    groupID,
+		WorkflowID: wf.ID.String(),
+		RunIDs:     runIDs,
+	}, nil
+}
+
+// BackfillGroup lists the runs enqueued by a backfill
+func (automationImpl) BackfillGroup(scope scope, p *BackfillGroupParams) ([]*run.State, error) {
+	wf, err := scope.AutomationOrchestrator().GetWorkflow(scope.Context(), workflow.ID(p.WorkflowID))
+	if err != nil {
+		return nil, err
+	}
+	if err := scope.Logbook().ProfileCanWrite(scope.Context(), wf.InitID, scope.ActiveProfile()); err != nil {
+		return nil, fmt.Errorf("profile %s can not write to dataset %s", scope.ActiveProfile().ID.Encode(), wf.InitID)
+	}
+	return scope.AutomationOrchestrator().GroupRuns(scope.Context(), wf.ID, p.GroupID)
+}
+
+// resolveWorkflow fetches a workflow by workflow ID, or by the reference or
+// initID of the workflow dataset
+func resolveWorkflow(scope scope, refStr, initID, workflowID string) (*workflow.Workflow, error) {
+	if workflowID != "" {
+		return scope.AutomationOrchestrator().GetWorkflow(scope.Context(), workflow.ID(workflowID))
+	}
+	if refStr != "" && initID == "" {
+		ref, err := dsref.Parse(refStr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := scope.ResolveReference(scope.Context(), &ref); err != nil {
+			return nil, err
+		}
+		initID = ref.InitID
+	}
+	return scope.AutomationOrchestrator().GetWorkflowByInitID(scope.Context(), initID)
+}
+
+// workflowTransformConfig loads the transform config of the latest version
+// of a workflow dataset
+func workflowTransformConfig(scope scope, wf *workflow.Workflow) (map[string]interface{}, error) {
+	ref := &dsref.Ref{InitID: wf.InitID}
+	if _, err := scope.ResolveReference(scope.Context(), ref); err != nil {
+		return nil, err
+	}
+	ds, err := dsfs.LoadDataset(scope.Context(), scope.Filesystem(), ref.Path)
+	if err != nil {
+		return nil, err
+	}
+	if ds.Transform == nil {
+		return nil, nil
+	}
+	return ds.Transform.Config, nil
+}
+
 // Fetches the full run info for a workflow run
 func (automationImpl) RunInfo(scope scope, p *RunInfoParams) (*run.State, error) {
 	if p.ID == "" {
@@ -463,6 +845,46 @@ func (automationImpl) RunInfo(scope scope, p *RunInfoParams) (*run.State, error)
 	return scope.AutomationOrchestrator().RunInfo(scope.Context(), p.ID)
 }
 
+// Runs lists the runs of a workflow, newest first
+func (automationImpl) Runs(scope scope, p *RunListParams) ([]*run.State, error) {
+	wf, err := resolveWorkflow(scope, p.Ref, p.InitID, p.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	lp := p.List
+	if lp.Limit == 0 {
+		lp.Limit = params.DefaultListLimit
+	}
+	runs, err := scope.AutomationOrchestrator().ListRuns(scope.Context(), wf.ID, lp)
+	if errors.Is(err, run.ErrUnknownWorkflowID) {
+		// workflows that have never run have no runs
+		return []*run.State{}, nil
+	}
+	return runs, err
+}
+
+// Freshness checks datasets against the freshness SLAs of their workflows,
+// stalest first
+func (automationImpl) Freshness(scope scope, p *FreshnessParams) ([]freshness.Status, error) {
+	statuses, err := scope.AutomationOrchestrator().CheckFreshness(scope.Context(), scope.ActiveProfile().ID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]freshness.Status, 0, len(statuses))
+	for _, s := range statuses {
+		if s.Stale || p.All {
+			res = append(res, s)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Stale != res[j].Stale {
+			return res[i].Stale
+		}
+		return res[i].Age > res[j].Age
+	})
+	return res, nil
+}
+
 // Cancel cancels a run
 func (automationImpl) Cancel(scope scope, p *CancelParams) error {
 	scope.AutomationOrchestrator().CancelRun(scope.Context(), p.RunID)
@@ -513,6 +935,68 @@ func (automationImpl) Remove(scope scope, p *WorkflowParams) error {
 	return scope.AutomationOrchestrator().RemoveWorkflow(scope.Context(), workflow.ID(p.WorkflowID))
 }
 
+// Retention sets the retention policy of a dataset's workflow
+func (automationImpl) Retention(scope scope, p *RetentionParams) (*RetentionResult, error) {
+	wf, err := resolveWorkflow(scope, p.Ref, "", "")
+	if err != nil {
+		return nil, err
+	}
+	if err := scope.Logbook().ProfileCanWrite(scope.Context(), wf.InitID, scope.ActiveProfile()); err != nil {
+		return nil, fmt.Errorf("profile %s can not write to dataset %s", scope.ActiveProfile().ID.Encode(), wf.InitID)
+	}
+
+	wf = wf.Copy()
+	wf.Retention = p.Policy
+	if wf, err = scope.AutomationOrchestrator().SaveWorkflow(scope.Context(), wf); err != nil {
+		return nil, err
+	}
+
+	res := &RetentionResult{Workflow: wf}
+	if p.Prune && wf.Retention != nil {
+		ref := &dsref.Ref{InitID: wf.InitID}
+		if _, err := scope.ResolveReference(scope.Context(), ref); err != nil {
+			return nil, err
+		}
+		if res.Pruned, err = base.PruneVersions(scope.Context(), scope.Repo(), scope.ActiveProfile(), *ref, wf.Retention, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// State fetches persisted transform state. Datasets without state return an
+// empty state
+func (automationImpl) State(scope scope, p *TransformStateParams) (tfstate.State, error) {
+	ref, _, err := scope.ParseAndResolveRef(scope.Context(), p.Ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := scope.Logbook().ProfileCanWrite(scope.Context(), ref.InitID, scope.ActiveProfile()); err != nil {
+		return nil, fmt.Errorf("profile %s can not write to dataset %s", scope.ActiveProfile().ID.Encode(), ref.InitID)
+	}
+	st, err := scope.TransformState().Get(scope.Context(), ref.InitID)
+	if errors.Is(err, tfstate.ErrNotFound) {
+		return tfstate.State{}, nil
+	}
+	return st, err
+}
+
+// ResetState removes persisted transform state
+func (automationImpl) ResetState(scope scope, p *TransformStateParams) error {
+	ref, _, err := scope.ParseAndResolveRef(scope.Context(), p.Ref)
+	if err != nil {
+		return err
+	}
+	if err := scope.Logbook().ProfileCanWrite(scope.Context(), ref.InitID, scope.ActiveProfile()); err != nil {
+		return fmt.Errorf("profile %s can not write to dataset %s", scope.ActiveProfile().ID.Encode(), ref.InitID)
+	}
+	err = scope.TransformState().Delete(scope.Context(), ref.InitID)
+	if errors.Is(err, tfstate.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
 func (inst *Instance) run(ctx context.Context, streams ioes.IOStreams, w *workflow.Workflow, runID string, params automation.WorkflowRunParams) error {
 	scope, err := newScopeFromWorkflow(ctx, inst, w)
 	if err != nil {
@@ -531,13 +1015,34 @@ func (inst *Instance) run(ctx context.Context, streams ioes.IOStreams, w *workfl
 				RunID: runID,
 			},
 		},
-		Apply: true,
+		Apply:   true,
+		NoCache: params.NoCache,
+		Params:  params.Params,
 	}
 	dImpl := &datasetImpl{}
 	_, err = dImpl.Save(scope, p)
 	return err
 }
 
+func (inst *Instance) pruneVersions(ctx context.Context, wf *workflow.Workflow) (int, error) {
+	scope, err := newScopeFromWorkflow(ctx, inst, wf)
+	if err != nil {
+		return 0, err
+	}
+	ref := &dsref.Ref{InitID: wf.InitID}
+	if _, err = scope.ResolveReference(ctx, ref); err != nil {
+		return 0, fmt.Errorf("prune versions error: %w", err)
+	}
+	return base.PruneVersions(scope.Context(), scope.Repo(), scope.ActiveProfile(), *ref, wf.Retention, time.Now())
+}
+
+func (inst *Instance) workflowVersionInfo(ctx context.Context, wf *workflow.Workflow) (*dsref.VersionInfo, error) {
+	if inst.collections == nil {
+		return nil, fmt.Errorf("dataset collection is not available")
+	}
+	return inst.collections.Get(ctx, wf.OwnerID, wf.InitID)
+}
+
 func (inst *Instance) apply(ctx context.Context, wait bool, runID string, wf *workflow.Workflow, ds *dataset.Dataset, params automation.WorkflowRunParams) error {
 	scope, err := newScopeFromWorkflow(ctx, inst, wf)
 	if err != nil {
@@ -550,9 +1055,79 @@ func (inst *Instance) apply(ctx context.Context, wait bool, runID string, wf *wo
 	}
 
 	transformer := transform.NewTransformer(ctx, scope.Filesystem(), scope.Loader(), scope.Bus(), sizeInfo)
+	if params.Debug {
+		d, done := inst.debugger(runID, wf, params)
+		defer done()
+		transformer.SetDebugger(d)
+	}
+	if cache := scope.StepCache(); cache != nil {
+		transformer.SetStepCache(cache, params.NoCache)
+	}
+	transformer.SetParams(params.Params)
+	// apply reads transform state, but never persists changes
+	if err := loadTransformState(scope, ds.ID, transformer); err != nil {
+		return err
+	}
 	return transformer.Apply(scope.Context(), ds, runID, wait, params.Secrets)
 }
 
+// loadTransformState provides a transformer with the state persisted by the
+// last successful run of a dataset's transform
+func loadTransformState(scope scope, initID string, t *transform.Transformer) error {
+	store := scope.TransformState()
+	if store == nil || initID == "" {
+		return nil
+	}
+	st, err := store.Get(scope.Context(), initID)
+	if errors.Is(err, tfstate.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("loading transform state: %w", err)
+	}
+	t.SetState(st)
+	return nil
+}
+
+// debugger creates a transform debugger for a run. Commands come from the
+// params debug prompt when one is set, otherwise from debug command events
+// sent by the owner of the workflow. Call done once the run is over
+func (inst *Instance) debugger(runID string, wf *workflow.Workflow, params automation.WorkflowRunParams) (d *startf.Debugger, done func()) {
+	d = startf.NewDebugger(runID, params.Breakpoints, params.BreakOnError)
+	ownerID := wf.OwnerID.Encode()
+	send := func(cmd event.TransformDebugCommand) {
+		if err := d.Send(cmd); err != nil {
+			log.Debugw("sending debug command", "runID", runID, "err", err)
+		}
+	}
+
+	done = inst.runEvents.add(runID, func(ctx context.Context, e event.Event) error {
+		switch e.Type {
+		case event.ETTransformDebugPaused:
+			state, ok := e.Payload.(event.TransformDebugState)
+			if !ok || params.DebugPrompt == nil {
+				return nil
+			}
+			// prompt without blocking the bus. the debugger waits for a
+			// command before pausing again
+			go func() {
+				send(event.TransformDebugCommand{RunID: runID, Action: params.DebugPrompt(state)})
+			}()
+		case event.ETTransformDebugCommand:
+			cmd, ok := e.Payload.(event.TransformDebugCommand)
+			if !ok || params.DebugPrompt != nil {
+				return nil
+			}
+			if e.ProfileID != ownerID {
+				log.Debugw("ignoring debug command from non-owner", "runID", runID, "profileID", e.ProfileID)
+				return nil
+			}
+			send(cmd)
+		}
+		return nil
+	})
+	return d, done
+}
+
 // AnalyzeTransform runs analysis on a transform script
 func (automationImpl) AnalyzeTransform(scope scope, p *AnalyzeTransformParams) (*AnalyzeTransformResult, error) {
 	ctx := scope.Context()
@@ -569,6 +1144,80 @@ func (automationImpl) AnalyzeTransform(scope scope, p *AnalyzeTransformParams) (
 	}, nil
 }
 
+// headTransform loads the transform of the latest version of a dataset, with
+// the script file opened
+func headTransform(scope scope, ref dsref.Ref) (*dataset.Transform, error) {
+	ds, err := dsfs.LoadDataset(scope.Context(), scope.Filesystem(), ref.Path)
+	if err != nil {
+		return nil, err
+	}
+	if ds.Transform == nil {
+		return nil, fmt.Errorf("dataset %s has no transform to apply", ref.Human())
+	}
+	if err := ds.Transform.OpenScriptFile(scope.Context(), scope.Filesystem()); err != nil {
+		return nil, err
+	}
+	return ds.Transform, nil
+}
+
+// analyzeTransformStrict errors if static analysis of a transform finds any
+// errors. Script files are read & replaced so the transform can still run
+func analyzeTransformStrict(t *dataset.Transform) error {
+	steps := t.Steps
+	if len(steps) == 0 && t.ScriptFile() != nil {
+		f := t.ScriptFile()
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		t.SetScriptFile(qfs.NewMemfileBytes(f.FileName(), data))
+		if steps, err = stepfile.Read(bytes.NewReader(data)); err != nil {
+			return err
+		}
+		if len(steps) == 1 {
+			steps[0].Name = f.FileName()
+		}
+	}
+
+	var errs []string
+	for i, step := range steps {
+		if step.Syntax != "" && step.Syntax != "starlark" {
+			continue
+		}
+		var src []byte
+		switch v := step.Script.(type) {
+		case string:
+			src = []byte(v)
+		case []byte:
+			src = v
+		default:
+			continue
+		}
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("step %d", i+1)
+		}
+		diags, err := staticlark.AnalyzeScriptStrict(name, src, step.Category)
+		if err != nil {
+			return err
+		}
+		for _, d := range diags {
+			if d.Severity == staticlark.SeverityError {
+				errs = append(errs, d.String())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return qerr.New(ErrBadArgs, fmt.Sprintf("transform analysis found %d errors:\n%s", len(errs), strings.Join(errs, "\n")))
+	}
+	return nil
+}
+
+// Test runs transform test files against fixture datasets
+func (automationImpl) Test(scope scope, p *TestParams) ([]*TestResult, error) {
+	return tftest.Run(scope.Context(), p.Path)
+}
+
 // methods that run workflows, used by the automation orchestrator via
 // dependency injection
 type runner struct {
@@ -585,3 +1234,163 @@ func (r *runner) RunEphemeral(ctx context.Context, runID string, wf *workflow.Wo
 func (r *runner) RunAndCommit(ctx context.Context, runID string, wf *workflow.Workflow, streams ioes.IOStreams, params automation.WorkflowRunParams) error {
 	return r.owner.run(ctx, streams, wf, runID, params)
 }
+
+// PruneVersions removes the versions of a workflow's dataset that the workflow
+// retention policy doesn't keep
+func (r *runner) PruneVersions(ctx context.Context, wf *workflow.Workflow) (int, error) {
+	return r.owner.pruneVersions(ctx, wf)
+}
+
+// WorkflowVersionInfo gets the latest version of a workflow's dataset from
+// the collection
+func (r *runner) WorkflowVersionInfo(ctx context.Context, wf *workflow.Workflow) (*dsref.VersionInfo, error) {
+	return r.owner.workflowVersionInfo(ctx, wf)
+}
+
+// runLogBufferSize is the number of published run events FollowRun buffers
+// while replaying recorded events
+const runLogBufferSize = 1024
+
+// FollowRun streams the log of a run. Events the run store has already
+// recorded are replayed first, followed by events as they're published,
+// until the run stops or ctx is cancelled. When the instance is connected to
+// a qri node over http, published events stream over the node's websocket
+// API
+func (inst *Instance) FollowRun(ctx context.Context, runID string) (<-chan event.Event, error) {
+	if runID == "" {
+		return nil, errors.New("run id is required")
+	}
+	// the subscription ends when following stops
+	ctx, cancel := context.WithCancel(ctx)
+	// subscribe before fetching recorded events, so no events are published
+	// between the two without being seen
+	live, err := inst.subscribeRun(ctx, runID)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	rs, err := inst.Automation().RunInfo(ctx, &RunInfoParams{ID: runID})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	events := make(chan event.Event)
+	go func() {
+		defer close(events)
+		defer cancel()
+		send := func(e event.Event) bool {
+			select {
+			case events <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var last int64
+		for _, e := range rs.Events() {
+			if !run.IsLogEvent(e.Type) {
+				continue
+			}
+			if !send(e) {
+				return
+			}
+			last = e.Timestamp
+		}
+		if rs.Finished() {
+			return
+		}
+
+		for e := range live {
+			if e.Type == event.ETAutomationWorkflowStopped {
+				// workflows stop without a transform stop event when they fail
+				// before the transform starts
+				return
+			}
+			if e.Timestamp <= last {
+				// already replayed
+				continue
+			}
+			if !send(e) || e.Type == event.ETTransformStop {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// subscribeRun sends the log events of a run on the returned channel, as
+// they're published, until ctx is cancelled. The workflow stopped event for
+// the run marks the end of the run
+func (inst *Instance) subscribeRun(ctx context.Context, runID string) (<-chan event.Event, error) {
+	if inst.http != nil {
+		return inst.subscribeRunRPC(ctx, runID)
+	}
+
+	events := make(chan event.Event, runLogBufferSize)
+	handler := func(_ context.Context, e event.Event) error {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if e.Type != event.ETAutomationWorkflowStopped && !run.IsLogEvent(e.Type) {
+			return nil
+		}
+		select {
+		case events <- e:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+	remove := inst.runEvents.add(runID, handler)
+	go func() {
+		<-ctx.Done()
+		remove()
+	}()
+	return events, nil
+}
+
+// subscribeRunRPC streams the log events of a run over the websocket API of
+// the node the instance makes http calls to
+func (inst *Instance) subscribeRunRPC(ctx context.Context, runID string) (<-chan event.Event, error) {
+	ctx, err := inst.withRPCToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all, err := websocket.Subscribe(ctx, inst.http.WebsocketURL(), token.FromCtx(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan event.Event, runLogBufferSize)
+	go func() {
+		defer close(events)
+		for e := range all {
+			raw, ok := e.Payload.(json.RawMessage)
+			if !ok {
+				continue
+			}
+			if e.Type == event.ETAutomationWorkflowStopped {
+				wse := event.WorkflowStoppedEvent{}
+				if err := json.Unmarshal(raw, &wse); err != nil || wse.RunID != runID {
+					continue
+				}
+				e.Payload = wse
+			} else {
+				if e.SessionID != runID || !run.IsLogEvent(e.Type) {
+					continue
+				}
+				if e.Payload, err = run.DecodeEventPayload(e.Type, raw); err != nil {
+					log.Debugw("decoding run event", "type", e.Type, "err", err)
+					continue
+				}
+			}
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
@@ -11,9 +11,14 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/automation"
+	"github.com/qri-io/qri/automation/freshness"
+	"github.com/qri-io/qri/automation/retention"
 	"github.com/qri-io/qri/automation/run"
 	"github.com/qri-io/qri/automation/workflow"
+	qerr "github.com/qri-io/qri/errors"
 	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/profile"
 )
 
 func TestApplyTransform(t *testing.T) {
@@ -99,6 +104,66 @@ func TestApplyTransformValidationFailure(t *testing.T) {
 	}
 }
 
+func TestApplyTransformStrict(t *testing.T) {
+	tr := newTestRunner(t)
+	defer tr.Delete()
+
+	script := `
+load("dataframe.star", "dataframe")
+ds = dataset.latest()
+ds.body = dataframe.parse_csv("a,b\n1,2\n")
+dataset.commit(ds)
+`
+	res, err := tr.ApplyWithParams(tr.Ctx, &ApplyParams{
+		Wait:      true,
+		Strict:    true,
+		Transform: &dataset.Transform{Text: script},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Body == nil {
+		t.Error("expected strict apply of a clean transform to produce a body")
+	}
+
+	_, err = tr.Instance.Automation().Apply(tr.Ctx, &ApplyParams{
+		Wait:   true,
+		Strict: true,
+		Transform: &dataset.Transform{
+			Text: `
+print(secrets.get("token"))
+`,
+		},
+	})
+	if !errors.Is(err, ErrBadArgs) {
+		t.Fatalf("expected strict apply of a transform that prints a secret to fail with ErrBadArgs, got: %v", err)
+	}
+	expect := "transform analysis found 1 errors:\ntransform.star:2:1: error: secret: secret value reaches print"
+	var qe qerr.Error
+	if !errors.As(err, &qe) || qe.Message() != expect {
+		t.Errorf("error message mismatch.\nwant: %q\ngot:  %v", expect, err)
+	}
+
+	// applying a saved transform analyzes the transform of the latest version
+	if _, err := tr.SaveWithParams(&SaveParams{
+		Ref:      "me/leaky",
+		BodyPath: "testdata/cities_2/body.csv",
+		Dataset: &dataset.Dataset{Transform: &dataset.Transform{
+			Text: "s = secrets\nprint(s)\n",
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = tr.Instance.Automation().Apply(tr.Ctx, &ApplyParams{
+		Wait:   true,
+		Strict: true,
+		Ref:    "me/leaky",
+	})
+	if !errors.Is(err, ErrBadArgs) {
+		t.Errorf("expected strict apply of a saved transform that prints secrets to fail with ErrBadArgs, got: %v", err)
+	}
+}
+
 func TestAutomation(t *testing.T) {
 	tr := newTestRunner(t)
 	ds := &dataset.Dataset{
@@ -292,3 +357,436 @@ func errOnTimeout(t *testing.T, c chan string) <-chan string {
 	}()
 	return done
 }
+
+func TestTransformState(t *testing.T) {
+	tr := newTestRunner(t)
+	defer tr.Delete()
+
+	script := `page = state.get("page", 0) + 1
+state.set("page", page)
+if config.get("fail"):
+  error("oh no")
+ds = dataset.latest()
+ds.body = [["page", page]]
+dataset.commit(ds)`
+
+	save := func(config map[string]interface{}) error {
+		_, err := tr.SaveWithParams(&SaveParams{
+			Ref: "me/paged",
+			Dataset: &dataset.Dataset{Transform: &dataset.Transform{
+				Text:   script,
+				Config: config,
+			}},
+			Apply: true,
+		})
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := save(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := tr.Instance.Automation()
+	p := &TransformStateParams{Ref: "me/paged"}
+	got, err := m.State(tr.Ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(json.Number("2"), got["page"]); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+
+	// failed runs don't change state
+	if err := save(map[string]interface{}{"fail": true}); err == nil {
+		t.Fatal("expected error")
+	}
+	got, err = m.State(tr.Ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(json.Number("2"), got["page"]); diff != "" {
+		t.Errorf("state mismatch after failed run (-want +got):\n%s", diff)
+	}
+
+	if err := m.ResetState(tr.Ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	got, err = m.State(tr.Ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected reset state to be empty, got: %v", got)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	tr := newTestRunner(t)
+	defer tr.Delete()
+
+	ref, err := tr.SaveWithParams(&SaveParams{
+		Ref: "me/daily",
+		Dataset: &dataset.Dataset{Transform: &dataset.Transform{
+			Text: `ds = dataset.latest()
+ds.body = [[config.get("day"), config.get("scale")]]
+dataset.commit(ds)`,
+			Config: map[string]interface{}{
+				"params": map[string]interface{}{
+					"day":   map[string]interface{}{"type": "date", "default": "2021-01-01"},
+					"scale": map[string]interface{}{"type": "int", "default": 1},
+				},
+			},
+		}},
+		Apply: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wf, err := tr.Instance.automation.SaveWorkflow(tr.Ctx, &workflow.Workflow{
+		InitID:  ref.InitID,
+		OwnerID: tr.MustOwner(t).ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := tr.Instance.WithSource("local").Automation()
+	res, err := m.Backfill(tr.Ctx, &BackfillParams{
+		Ref:    "me/daily",
+		Param:  "day",
+		From:   "2021-03-01",
+		To:     "2021-03-03",
+		Params: map[string]string{"scale": "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.RunIDs) != 3 {
+		t.Fatalf("expected 3 runs, got %d", len(res.RunIDs))
+	}
+
+	var runs []*run.State
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		runs, err = m.BackfillGroup(tr.Ctx, &BackfillGroupParams{WorkflowID: wf.WorkflowID(), GroupID: res.GroupID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		finished := 0
+		for _, r := range runs {
+			if r.Status == run.RSSucceeded {
+				finished++
+			}
+		}
+		if finished == len(runs) {
+			break
+		}
+	}
+	gotDays := []string{}
+	for i, r := range runs {
+		if r.ID != res.RunIDs[i] {
+			t.Errorf("run %d id mismatch. want %s, got %s", i, res.RunIDs[i], r.ID)
+		}
+		if r.Status != run.RSSucceeded {
+			t.Errorf("run %d status: %s %s", i, r.Status, r.Message)
+		}
+		gotDays = append(gotDays, r.Params["day"]+"x"+r.Params["scale"])
+	}
+	if diff := cmp.Diff([]string{"2021-03-01x2", "2021-03-02x2", "2021-03-03x2"}, gotDays); diff != "" {
+		t.Errorf("run params mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err := tr.Instance.Dataset().Get(tr.Ctx, &GetParams{Ref: "me/daily", Selector: "body", All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]interface{}{[]interface{}{"2021-03-03", int64(2)}}, got.Value); diff != "" {
+		t.Errorf("body mismatch (-want +got):\n%s", diff)
+	}
+
+	bad := []struct {
+		p   *BackfillParams
+		err string
+	}{
+		{&BackfillParams{Ref: "me/daily", Param: "month", From: "1", To: "2"}, `param "month" is not declared in transform config`},
+		{&BackfillParams{Ref: "me/daily", Param: "scale", From: "3", To: "1"}, `range stop 1 is before start 3`},
+		{&BackfillParams{Ref: "me/daily", Param: "day", From: "2021-03-01", To: "2021-03-02", Params: map[string]string{"scale": "big"}}, `param "scale": strconv.ParseInt: parsing "big": invalid syntax`},
+	}
+	for _, c := range bad {
+		if _, err := m.Backfill(tr.Ctx, c.p); err == nil || err.Error() != c.err {
+			t.Errorf("error mismatch. want %q, got: %v", c.err, err)
+		}
+	}
+}
+
+func TestRunsAndFollowRun(t *testing.T) {
+	tr := newTestRunner(t)
+	defer tr.Delete()
+
+	ref, err := tr.SaveWithParams(&SaveParams{
+		Ref: "me/chatty",
+		Dataset: &dataset.Dataset{Transform: &dataset.Transform{
+			Text: `print("hello from the transform")
+ds = dataset.latest()
+ds.body = [[1]]
+dataset.commit(ds)`,
+		}},
+		Apply: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wf, err := tr.Instance.automation.SaveWorkflow(tr.Ctx, &workflow.Workflow{
+		InitID:  ref.InitID,
+		OwnerID: tr.MustOwner(t).ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := tr.Instance.WithSource("local").Automation()
+	runs, err := m.Runs(tr.Ctx, &RunListParams{Ref: "me/chatty"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 0 {
+		t.Fatalf("expected no runs before running the workflow, got %d", len(runs))
+	}
+
+	runID, err := m.Run(tr.Ctx, &RunParams{Ref: "me/chatty"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// wait for the run to be recorded before following it
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err = m.RunInfo(tr.Ctx, &RunInfoParams{ID: runID}); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscribers := tr.Instance.bus.NumSubscribers()
+	ctx, cancel := context.WithTimeout(tr.Ctx, 5*time.Second)
+	defer cancel()
+	events, err := tr.Instance.FollowRun(ctx, runID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var printed []string
+	var last event.Type
+	for e := range events {
+		if e.Type == event.ETTransformPrint {
+			printed = append(printed, e.Payload.(event.TransformMessage).Msg)
+		}
+		last = e.Type
+	}
+	if ctx.Err() != nil {
+		t.Fatal("timed out following run")
+	}
+	if diff := cmp.Diff([]string{"hello from the transform"}, printed); diff != "" {
+		t.Errorf("printed output mismatch (-want +got):\n%s", diff)
+	}
+	if last != event.ETTransformStop {
+		t.Errorf("expected the last event to be %q, got %q", event.ETTransformStop, last)
+	}
+
+	runs, err = m.Runs(tr.Ctx, &RunListParams{WorkflowID: wf.WorkflowID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != runID {
+		t.Fatalf("expected run list to contain run %s, got %d runs", runID, len(runs))
+	}
+	if runs[0].Status != run.RSSucceeded {
+		t.Errorf("expected run status %q, got %q", run.RSSucceeded, runs[0].Status)
+	}
+
+	// following a finished run replays its log & closes
+	events, err = tr.Instance.FollowRun(ctx, runID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for range events {
+		count++
+	}
+	if count == 0 {
+		t.Error("expected replayed events for a finished run")
+	}
+
+	// following doesn't leave handlers behind
+	if n := tr.Instance.bus.NumSubscribers(); n != subscribers {
+		t.Errorf("expected following to add no bus subscribers, had %d, got %d", subscribers, n)
+	}
+	for deadline := time.Now().Add(time.Second); tr.Instance.runEvents.len() > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := tr.Instance.runEvents.len(); n != 0 {
+		t.Errorf("expected run event handlers to be removed, got %d", n)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	tr := newTestRunner(t)
+	defer tr.Delete()
+
+	ref, err := tr.SaveWithParams(&SaveParams{
+		Ref:      "me/daily_numbers",
+		BodyPath: "testdata/cities_2/body.csv",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.Instance.automation.SaveWorkflow(tr.Ctx, &workflow.Workflow{
+		InitID:    ref.InitID,
+		OwnerID:   tr.MustOwner(t).ID,
+		Active:    true,
+		Freshness: &freshness.SLA{MaxAge: retention.Day},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// test runner commits are timestamped in 2001
+	m := tr.Instance.WithSource("local").Automation()
+	stale, err := m.Freshness(tr.Ctx, &FreshnessParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 {
+		t.Fatalf("expected 1 stale dataset, got %d", len(stale))
+	}
+	if stale[0].Alias() != "default_profile_for_testing/daily_numbers" || stale[0].Reason != freshness.ReasonOverdue {
+		t.Errorf("unexpected status: %#v", stale[0])
+	}
+
+	prevNow := automation.NowFunc
+	defer func() { automation.NowFunc = prevNow }()
+	now := stale[0].CommitTime.Add(time.Hour)
+	automation.NowFunc = func() *time.Time { return &now }
+	stale, err = m.Freshness(tr.Ctx, &FreshnessParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("expected no stale datasets, got %d", len(stale))
+	}
+	all, err := m.Freshness(tr.Ctx, &FreshnessParams{All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Stale {
+		t.Errorf("expected 1 fresh dataset, got: %#v", all)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	tr := newTestRunner(t)
+	defer tr.Delete()
+
+	ref, err := tr.SaveWithParams(&SaveParams{
+		Ref:      "me/hourly_numbers",
+		BodyPath: "testdata/cities_2/body.csv",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := tr.Instance.WithSource("local").Automation()
+	policy, err := retention.ParsePolicy("forever/1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Retention(tr.Ctx, &RetentionParams{Ref: "me/hourly_numbers", Policy: policy}); err == nil {
+		t.Error("expected setting retention on a dataset without a workflow to error")
+	}
+
+	if _, err := tr.Instance.automation.SaveWorkflow(tr.Ctx, &workflow.Workflow{
+		InitID:  ref.InitID,
+		OwnerID: tr.MustOwner(t).ID,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := m.Retention(tr.Ctx, &RetentionParams{Ref: "me/hourly_numbers", Policy: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Workflow.Retention.String() != "forever/1d" {
+		t.Errorf("expected policy forever/1d, got %s", res.Workflow.Retention)
+	}
+	wf, err := m.Workflow(tr.Ctx, &WorkflowParams{Ref: "me/hourly_numbers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wf.Retention == nil {
+		t.Fatal("expected retention policy to be saved")
+	}
+
+	if res, err = m.Retention(tr.Ctx, &RetentionParams{Ref: "me/hourly_numbers", Prune: true}); err != nil {
+		t.Fatal(err)
+	}
+	if res.Workflow.Retention != nil || res.Pruned != 0 {
+		t.Errorf("expected clearing retention to keep every version, got %#v", res)
+	}
+}
+
+func TestApplyDebug(t *testing.T) {
+	tr := newTestRunner(t)
+	defer tr.Delete()
+
+	script := `ds = dataset.latest()
+ds.body = [[1, 2]]
+dataset.commit(ds)
+`
+	bus := tr.Instance.Bus()
+	subscribers := bus.NumSubscribers()
+
+	// answer pauses with the params prompt
+	var paused []int
+	_, err := tr.Instance.Automation().Apply(tr.Ctx, &ApplyParams{
+		Transform: &dataset.Transform{Text: script},
+		Wait:      true,
+		Debug:     true,
+		DebugPrompt: func(state event.TransformDebugState) string {
+			paused = append(paused, state.Line)
+			return event.TransformDebugStep
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{1, 2, 3}, paused); diff != "" {
+		t.Errorf("paused lines mismatch (-want +got):\n%s", diff)
+	}
+
+	// answer pauses with debug commands sent over the bus by the owner
+	ownerCtx := profile.AddIDToContext(tr.Ctx, tr.MustOwner(t).ID.Encode())
+	bus.SubscribeTypes(func(ctx context.Context, e event.Event) error {
+		state := e.Payload.(event.TransformDebugState)
+		go bus.PublishID(ownerCtx, event.ETTransformDebugCommand, state.RunID, event.TransformDebugCommand{
+			RunID:  state.RunID,
+			Action: event.TransformDebugContinue,
+		})
+		return nil
+	}, event.ETTransformDebugPaused)
+	subscribers++
+
+	if _, err := tr.Instance.Automation().Apply(tr.Ctx, &ApplyParams{
+		Transform: &dataset.Transform{Text: script},
+		Wait:      true,
+		Debug:     true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// debugging a run doesn't leave handlers behind
+	if got := bus.NumSubscribers(); got != subscribers {
+		t.Errorf("expected %d bus subscribers, got %d", subscribers, got)
+	}
+	if n := tr.Instance.runEvents.len(); n != 0 {
+		t.Errorf("expected run handlers to be removed, got %d", n)
+	}
+}
@@ -0,0 +1,400 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qfs/qipfs"
+	"github.com/qri-io/qri/auth/key"
+	"github.com/qri-io/qri/automation/run"
+	"github.com/qri-io/qri/automation/workflow"
+	"github.com/qri-io/qri/base"
+	"github.com/qri-io/qri/base/params"
+	"github.com/qri-io/qri/config"
+	"github.com/qri-io/qri/remote/access"
+	"github.com/qri-io/qri/remote/quota"
+	"github.com/qri-io/qri/repo/backup"
+	sqliterepo "github.com/qri-io/qri/repo/sqlite"
+)
+
+// ErrBackupUnsupported indicates the repo's storage can't be backed up
+var ErrBackupUnsupported = errors.New("backup requires a local IPFS filesystem")
+
+// backupPaths are repo files & directories copied into a backup as-is
+var backupPaths = []string{
+	"logbook.qfb",
+	"logbook",
+	"refs.fbs",
+	"dscache.qfb",
+	"collections",
+	"peers.json",
+	"selected_refs.json",
+	"change_requests.json",
+	"transform_state.json",
+	access.DefaultAccessControlPolicyFilename,
+	quota.DefaultLedgerFilename,
+}
+
+// writeBackup gathers repo state & writes it to a backup archive
+func writeBackup(scope scope, p *BackupParams) (*BackupResult, error) {
+	ctx := scope.Context()
+	repoPath := scope.RepoPath()
+	if repoPath == "" {
+		return nil, fmt.Errorf("backup requires a repo stored on disk")
+	}
+	mode := backup.KeyMode(p.Keys)
+	if mode == "" {
+		mode = backup.KeysExclude
+	}
+
+	cfg := scope.Config().Copy()
+	// the IPFS repo is recreated within the repo directory on restore
+	for i, fsCfg := range cfg.Filesystems {
+		if fsCfg.Type == qipfs.FilestoreType {
+			opts := map[string]interface{}{}
+			for k, v := range fsCfg.Config {
+				opts[k] = v
+			}
+			opts["path"] = filepath.Join(".", "ipfs")
+			cfg.Filesystems[i].Config = opts
+		}
+	}
+
+	src := backup.Source{
+		RepoPath: repoPath,
+		Paths:    backupPaths,
+		Files:    map[string][]byte{},
+	}
+
+	keystorePath := filepath.Join(repoPath, "keystore.json")
+	switch mode {
+	case backup.KeysInclude:
+		src.Paths = append(src.Paths, "keystore.json")
+	case backup.KeysEncrypt:
+		src.Keys = &backup.Keys{ProfileKey: cfg.Profile.PrivKey, P2PKey: cfg.P2P.PrivKey}
+		if data, err := ioutil.ReadFile(keystorePath); err == nil {
+			src.Keys.Keystore = data
+		}
+	}
+	if mode != backup.KeysInclude {
+		cfg.Profile.PrivKey = ""
+		cfg.P2P.PrivKey = ""
+	}
+	cfgData, err := configBytes(cfg)
+	if err != nil {
+		return nil, err
+	}
+	src.Files["config.yaml"] = cfgData
+
+	if sr, ok := scope.Repo().(*sqliterepo.Repo); ok {
+		data, err := sqliteSnapshot(ctx, sr.DB())
+		if err != nil {
+			return nil, fmt.Errorf("copying database: %w", err)
+		}
+		src.Files[sqliterepo.Filename] = data
+	} else if err := addAutomationFiles(scope, src.Files); err != nil {
+		return nil, err
+	}
+
+	var roots map[string]struct{}
+	if p.LatestOnly {
+		roots, err = headPaths(scope)
+	} else {
+		roots, err = base.LiveDatasetPaths(ctx, scope.Repo(), scope.Dscache())
+	}
+	if err != nil {
+		return nil, err
+	}
+	for p := range roots {
+		src.Roots = append(src.Roots, p)
+	}
+	if len(src.Roots) > 0 {
+		ipfs, ok := scope.Filesystem().Filesystem(qipfs.FilestoreType).(*qipfs.Filestore)
+		if !ok || ipfs.Node() == nil {
+			return nil, ErrBackupUnsupported
+		}
+		src.Blockstore = ipfs.Node().Blockstore
+	}
+
+	m, err := backup.Create(ctx, p.File, src, backup.Options{
+		Keys:       mode,
+		Passphrase: p.Passphrase,
+		LatestOnly: p.LatestOnly,
+		Base:       p.Base,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BackupResult{File: p.File, Manifest: m}, nil
+}
+
+// configBytes encodes a config the way it's written to disk
+func configBytes(cfg *config.Config) ([]byte, error) {
+	f, err := ioutil.TempFile("", "qri-backup-config")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	if err := cfg.WriteToFile(f.Name()); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(f.Name())
+}
+
+// sqliteSnapshot reads a consistent copy of a repo database
+func sqliteSnapshot(ctx context.Context, db *sqliterepo.DB) ([]byte, error) {
+	dir, err := ioutil.TempDir("", "qri-backup-sqlite")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, sqliterepo.Filename)
+	if err := db.Snapshot(ctx, path); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
+
+// addAutomationFiles encodes workflows & run history in the format of the
+// automation file stores, which only write to disk on shutdown
+func addAutomationFiles(scope scope, files map[string][]byte) error {
+	ctx := scope.Context()
+	o := scope.AutomationOrchestrator()
+	if o == nil {
+		return nil
+	}
+	wfs, err := o.ListWorkflows(ctx, "", params.ListAll)
+	if err != nil {
+		return fmt.Errorf("listing workflows: %w", err)
+	}
+
+	set := workflow.NewSet()
+	runs := run.NewMemStore()
+	for _, wf := range wfs {
+		set.Add(wf)
+		states, err := o.ListRuns(ctx, wf.ID, params.ListAll)
+		if errors.Is(err, run.ErrUnknownWorkflowID) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("listing runs: %w", err)
+		}
+		// runs are listed newest first, re-create them oldest first
+		for i := len(states) - 1; i >= 0; i-- {
+			if _, err := runs.Create(ctx, states[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := json.Marshal(struct {
+		Workflows *workflow.Set `json:"workflows"`
+	}{Workflows: set})
+	if err != nil {
+		return err
+	}
+	files["workflows.json"] = data
+	if files["runs.json"], err = json.Marshal(runs); err != nil {
+		return err
+	}
+	return nil
+}
+
+// headPaths collects the path of the latest version of each dataset in the
+// refstore
+func headPaths(scope scope) (map[string]struct{}, error) {
+	r := scope.Repo()
+	count, err := r.RefCount()
+	if err != nil {
+		return nil, err
+	}
+	refs, err := r.References(0, count)
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]struct{}{}
+	for _, ref := range refs {
+		if ref.Path != "" {
+			paths[ref.Path] = struct{}{}
+		}
+	}
+	return paths, nil
+}
+
+// RestoreParams encapsulates arguments for Restore
+type RestoreParams struct {
+	// where to restore the qri repository. must not already hold a repo
+	RepoPath string
+	// path to the backup archive
+	File string
+	// paths to every archive File is incremental against
+	Bases []string
+	// passphrase for encrypted keys
+	Passphrase string
+	// base64-encoded profile private key, required when keys were excluded
+	// from the backup
+	PrivateKey string
+	// InitIPFSFunc creates the IPFS repo blocks are restored into
+	InitIPFSFunc func(repoPath, configPath string) error
+	// Generator creates a new p2p identity if the backup's p2p key can't be
+	// restored
+	Generator key.CryptoGenerator
+}
+
+// RestoreResult summarizes a restore
+type RestoreResult struct {
+	// number of dataset versions restored
+	Datasets int `json:"datasets"`
+	// number of blocks added to the IPFS repo
+	Blocks int `json:"blocks"`
+}
+
+// Restore creates a repo from a backup archive. Like Setup, Restore doesn't
+// conform to the RPC function signature, there's no instance to dispatch to
+// until the repo exists
+func Restore(ctx context.Context, p RestoreParams) (res *RestoreResult, err error) {
+	if err := QriRepoExists(p.RepoPath); err == nil {
+		return nil, fmt.Errorf("repo already initialized")
+	}
+
+	chain, err := backup.OpenChain(p.File, p.Bases)
+	if err != nil {
+		return nil, err
+	}
+	defer chain.Close()
+	keys, err := chain.Keys(p.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	mode := chain.Head.Manifest.Keys
+	if mode == backup.KeysExclude && p.PrivateKey == "" {
+		return nil, fmt.Errorf("keys were excluded from this backup, a private key is required to restore it")
+	}
+
+	if _, statErr := os.Stat(p.RepoPath); os.IsNotExist(statErr) {
+		// clean up a partial restore
+		defer func() {
+			if err != nil {
+				os.RemoveAll(p.RepoPath)
+			}
+		}()
+	}
+	if err := os.MkdirAll(p.RepoPath, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := chain.ExtractFiles(p.RepoPath); err != nil {
+		return nil, err
+	}
+
+	cfgPath := filepath.Join(p.RepoPath, "config.yaml")
+	cfg, err := config.ReadFromFile(cfgPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading restored config: %w", err)
+	}
+	switch mode {
+	case backup.KeysEncrypt:
+		if keys == nil {
+			return nil, fmt.Errorf("backup is missing encrypted keys")
+		}
+		cfg.Profile.PrivKey = keys.ProfileKey
+		cfg.P2P.PrivKey = keys.P2PKey
+		if len(keys.Keystore) > 0 {
+			if err := ioutil.WriteFile(filepath.Join(p.RepoPath, "keystore.json"), keys.Keystore, 0644); err != nil {
+				return nil, err
+			}
+		}
+	case backup.KeysExclude:
+		if err := restorePrivateKey(cfg, p); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.WriteToFile(cfgPath); err != nil {
+		return nil, fmt.Errorf("error writing config: %w", err)
+	}
+
+	res = &RestoreResult{Datasets: len(chain.Roots())}
+	for _, fsCfg := range cfg.Filesystems {
+		if fsCfg.Type != qipfs.FilestoreType {
+			continue
+		}
+		if res.Blocks, err = restoreBlocks(ctx, p, chain); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// restorePrivateKey adds a private key given by the user to a config restored
+// from a backup that excluded keys
+func restorePrivateKey(cfg *config.Config, p RestoreParams) error {
+	pk, err := key.DecodeB64PrivKey(p.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+	id, err := key.IDFromPrivKey(pk)
+	if err != nil {
+		return err
+	}
+	if id != cfg.Profile.ID {
+		return fmt.Errorf("private key doesn't match backup profile %s", cfg.Profile.ID)
+	}
+	cfg.Profile.PrivKey = p.PrivateKey
+	if cfg.P2P.PeerID == cfg.Profile.ID {
+		cfg.P2P.PrivKey = p.PrivateKey
+		return nil
+	}
+	if p.Generator == nil {
+		return fmt.Errorf("a crypto generator is required to create a new p2p identity")
+	}
+	cfg.P2P.PrivKey, cfg.P2P.PeerID = p.Generator.GeneratePrivateKeyAndPeerID()
+	return nil
+}
+
+// restoreBlocks writes blocks from a backup to the repo's IPFS store, pinning
+// every dataset version
+func restoreBlocks(ctx context.Context, p RestoreParams, chain *backup.Chain) (int, error) {
+	ipfsPath := filepath.Join(p.RepoPath, "ipfs")
+	if err := qipfs.LoadIPFSPluginsOnce(ipfsPath); err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(filepath.Join(ipfsPath, "config")); os.IsNotExist(err) {
+		if p.InitIPFSFunc == nil {
+			return 0, fmt.Errorf("an IPFS init function is required to restore datasets")
+		}
+		if err := initIPFS(ipfsPath, nil, p.InitIPFSFunc); err != nil {
+			return 0, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	fs, err := qipfs.NewFilesystem(ctx, map[string]interface{}{"path": ipfsPath})
+	if err != nil {
+		cancel()
+		return 0, err
+	}
+	defer func() {
+		cancel()
+		<-fs.(qfs.ReleasingFilesystem).Done()
+	}()
+	ipfs, ok := fs.(*qipfs.Filestore)
+	if !ok || ipfs.Node() == nil {
+		return 0, ErrBackupUnsupported
+	}
+
+	added, err := chain.PutBlocks(ctx, ipfs.Node().Blockstore)
+	if err != nil {
+		return added, err
+	}
+	for _, root := range chain.Roots() {
+		if err := ipfs.Pin(ctx, root, true); err != nil {
+			log.Debugw("pinning restored dataset", "path", root, "err", err)
+		}
+	}
+	return added, nil
+}
@@ -57,7 +57,8 @@ func (c cursor) Next(ctx context.Context) (interface{}, error) {
 		return nil, err
 	}
 	if cur == nil {
-		return nil, ErrCursorComplete
+		// the final page may still have results
+		return res, ErrCursorComplete
 	}
 	return res, nil
 }
@@ -10,12 +10,14 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/qri-io/dag"
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/dataset/detect"
+	"github.com/qri-io/dataset/dsio"
 	"github.com/qri-io/dataset/preview"
 	"github.com/qri-io/dataset/stepfile"
 	"github.com/qri-io/jsonschema"
@@ -24,6 +26,7 @@ import (
 	"github.com/qri-io/qri/automation/run"
 	"github.com/qri-io/qri/base"
 	"github.com/qri-io/qri/base/archive"
+	"github.com/qri-io/qri/base/bodyquery"
 	"github.com/qri-io/qri/base/dsfs"
 	"github.com/qri-io/qri/base/fill"
 	"github.com/qri-io/qri/base/params"
@@ -35,6 +38,8 @@ import (
 	"github.com/qri-io/qri/remote"
 	"github.com/qri-io/qri/repo"
 	"github.com/qri-io/qri/transform"
+	"github.com/qri-io/qri/transform/stepcache"
+	"github.com/qri-io/qri/transform/verify"
 )
 
 // DatasetMethods work with datasets, creating new versions (save), reading
@@ -52,21 +57,27 @@ func (m DatasetMethods) Name() string {
 // Attributes defines attributes for each method
 func (m DatasetMethods) Attributes() map[string]AttributeSet {
 	return map[string]AttributeSet{
-		"get":             {Endpoint: qhttp.AEGet, HTTPVerb: "POST"},
-		"getcsv":          {Endpoint: qhttp.DenyHTTP}, // getcsv is not part of the json api, but is handled in a separate `GetBodyCSVHandler` function
-		"getzip":          {Endpoint: qhttp.DenyHTTP}, // getzip is not part of the json api, but is handled is a separate `GetHandler` function
-		"activity":        {Endpoint: qhttp.AEActivity, HTTPVerb: "POST"},
-		"rename":          {Endpoint: qhttp.AERename, HTTPVerb: "POST", DefaultSource: "local"},
-		"save":            {Endpoint: qhttp.AESave, HTTPVerb: "POST"},
-		"pull":            {Endpoint: qhttp.AEPull, HTTPVerb: "POST", DefaultSource: "network"},
-		"push":            {Endpoint: qhttp.AEPush, HTTPVerb: "POST", DefaultSource: "local"},
-		"render":          {Endpoint: qhttp.AERender, HTTPVerb: "POST"},
-		"remove":          {Endpoint: qhttp.AERemove, HTTPVerb: "POST", DefaultSource: "local"},
-		"validate":        {Endpoint: qhttp.AEValidate, HTTPVerb: "POST", DefaultSource: "local"},
-		"manifest":        {Endpoint: qhttp.AEManifest, HTTPVerb: "POST", DefaultSource: "local"},
-		"manifestmissing": {Endpoint: qhttp.AEManifestMissing, HTTPVerb: "POST", DefaultSource: "local"},
-		"daginfo":         {Endpoint: qhttp.AEDAGInfo, HTTPVerb: "POST", DefaultSource: "local"},
-		"whatchanged":     {Endpoint: qhttp.AEWhatChanged, HTTPVerb: "POST", DefaultSource: "local"},
+		"get":              {Endpoint: qhttp.AEGet, HTTPVerb: "POST"},
+		"querybody":        {Endpoint: qhttp.AEQueryBody, HTTPVerb: "POST"},
+		"getcsv":           {Endpoint: qhttp.DenyHTTP}, // getcsv is not part of the json api, but is handled in a separate `GetBodyCSVHandler` function
+		"getzip":           {Endpoint: qhttp.DenyHTTP}, // getzip is not part of the json api, but is handled is a separate `GetHandler` function
+		"activity":         {Endpoint: qhttp.AEActivity, HTTPVerb: "POST"},
+		"rename":           {Endpoint: qhttp.AERename, HTTPVerb: "POST", DefaultSource: "local"},
+		"save":             {Endpoint: qhttp.AESave, HTTPVerb: "POST", Async: true},
+		"pull":             {Endpoint: qhttp.AEPull, HTTPVerb: "POST", DefaultSource: "network", Async: true},
+		"push":             {Endpoint: qhttp.AEPush, HTTPVerb: "POST", DefaultSource: "local", Async: true},
+		"render":           {Endpoint: qhttp.AERender, HTTPVerb: "POST", Async: true},
+		"remove":           {Endpoint: qhttp.AERemove, HTTPVerb: "POST", DefaultSource: "local"},
+		"validate":         {Endpoint: qhttp.AEValidate, HTTPVerb: "POST", DefaultSource: "local"},
+		"manifest":         {Endpoint: qhttp.AEManifest, HTTPVerb: "POST", DefaultSource: "local"},
+		"manifestmissing":  {Endpoint: qhttp.AEManifestMissing, HTTPVerb: "POST", DefaultSource: "local"},
+		"daginfo":          {Endpoint: qhttp.AEDAGInfo, HTTPVerb: "POST", DefaultSource: "local"},
+		"whatchanged":      {Endpoint: qhttp.AEWhatChanged, HTTPVerb: "POST", DefaultSource: "local"},
+		"squash":           {Endpoint: qhttp.AESquash, HTTPVerb: "POST", DefaultSource: "local"},
+		"lineage":          {Endpoint: qhttp.AELineage, HTTPVerb: "POST", DefaultSource: "local"},
+		"verify":           {Endpoint: qhttp.AEVerify, HTTPVerb: "POST", DefaultSource: "local"},
+		"verifysignatures": {Endpoint: qhttp.AEVerifySignatures, HTTPVerb: "POST", DefaultSource: "local"},
+		"blame":            {Endpoint: qhttp.AEBlame, HTTPVerb: "POST", DefaultSource: "local"},
 	}
 }
 
@@ -81,6 +92,27 @@ type GetParams struct {
 	// loop over their `Cursor` in order to get all rows.
 	// TODO(ramfox): are we in a place to remove All?
 	All bool `json:"all" docs:"hidden"`
+
+	// Where is a predicate body entries must match, eg:
+	// `population > 1000 and country = "CA"`. Where, Columns, Sort & Token
+	// only apply to the body selector
+	Where string `json:"where"`
+	// Columns is a comma-separated list of columns to include in each body
+	// entry, in order
+	Columns string `json:"columns"`
+	// Sort is the column to sort body entries by. Prefix with "-" to sort in
+	// descending order
+	Sort string `json:"sort"`
+	// Token continues reading the body from where a previous page ended.
+	// Tokens are set on the params of the cursor returned by Get
+	Token string `json:"token"`
+
+	// Output, when set, receives body entries as they're read, encoded as
+	// OutputFormat, instead of returning them in the result
+	Output io.Writer `json:"-"`
+	// OutputFormat is the format of entries written to Output, one of
+	// "json", "ndjson" or "csv"
+	OutputFormat string `json:"-"`
 }
 
 // SetNonZeroDefaults assigns default values
@@ -108,11 +140,63 @@ func (p *GetParams) Validate() error {
 		if !p.All && (p.Limit < 0 || p.Offset < 0) {
 			return fmt.Errorf("invalid limit / offset settings")
 		}
+	} else if p.HasBodyQuery() || p.Output != nil {
+		return fmt.Errorf("where, columns, sort, token & output only apply to the body")
+	}
+	if p.Token != "" && (p.All || p.Offset > 0) {
+		return fmt.Errorf("token cannot be combined with all or offset")
+	}
+	if p.Where != "" {
+		if _, err := bodyquery.ParseWhere(p.Where); err != nil {
+			return err
+		}
+	}
+	if p.Output != nil {
+		switch p.OutputFormat {
+		case "json", "ndjson", "csv":
+		default:
+			return fmt.Errorf("invalid output format %q, must be one of json, ndjson or csv", p.OutputFormat)
+		}
 	}
 
 	return nil
 }
 
+// HasBodyQuery returns true if the params filter, project, sort or continue
+// reading a body
+func (p *GetParams) HasBodyQuery() bool {
+	return p.Where != "" || p.Columns != "" || p.Sort != "" || p.Token != ""
+}
+
+// isBodyQuery returns true if reading the body requires a query, rather than
+// loading the entire body
+func (p *GetParams) isBodyQuery() bool {
+	return p.HasBodyQuery() || p.Output != nil
+}
+
+// outputFormat gives the encoding for entries written to Output
+func (p *GetParams) outputFormat() (dataset.DataFormat, dataset.FormatConfig, error) {
+	if p.Output == nil {
+		return dataset.UnknownDataFormat, nil, nil
+	}
+	format, err := dataset.ParseDataFormatString(p.OutputFormat)
+	if err != nil {
+		return format, nil, err
+	}
+	if format == dataset.CSVDataFormat {
+		return format, &dataset.CSVOptions{HeaderRow: true}, nil
+	}
+	return format, nil, nil
+}
+
+func (p *GetParams) bodyQuery() bodyquery.Query {
+	return bodyquery.Query{
+		Where:   p.Where,
+		Columns: bodyquery.ParseColumns(p.Columns),
+		Sort:    p.Sort,
+	}
+}
+
 func isValidSelector(selector string) bool {
 	return validSelector.MatchString(selector)
 }
@@ -143,6 +227,8 @@ type DataResponse struct {
 // a blank selector, will also fill the entire dataset at res.Value. If the selector contains ".script"
 // then res.Bytes is loaded with the script contents as bytes. If the selector is "stats", then res.Value is loaded
 // with the generated stats.
+// Body reads are filtered, projected & sorted by p.Where, p.Columns & p.Sort.
+// Use QueryBody to continue reading a body across pages
 func (m DatasetMethods) Get(ctx context.Context, p *GetParams) (*GetResult, error) {
 	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "get"), p)
 	if res, ok := got.(*GetResult); ok {
@@ -151,6 +237,17 @@ func (m DatasetMethods) Get(ctx context.Context, p *GetParams) (*GetResult, erro
 	return nil, dispatchReturnError(got, err)
 }
 
+// QueryBody reads a page of body entries from the dataset at p.Ref, filtered,
+// projected & sorted by p.Where, p.Columns & p.Sort. When more entries remain
+// after the page, QueryBody returns a cursor for the next page
+func (m DatasetMethods) QueryBody(ctx context.Context, p *GetParams) (*GetResult, Cursor, error) {
+	got, cur, err := m.d.Dispatch(ctx, dispatchMethodName(m, "querybody"), p)
+	if res, ok := got.(*GetResult); ok {
+		return res, cur, err
+	}
+	return nil, nil, dispatchReturnError(got, err)
+}
+
 // GetCSV fetches the body as a csv encoded byte slice, it recognizes Limit, Offset, and All list params
 func (m DatasetMethods) GetCSV(ctx context.Context, p *GetParams) ([]byte, error) {
 	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "getcsv"), p)
@@ -266,11 +363,17 @@ type SaveParams struct {
 	// note: this won't work over RPC, only on local calls
 	ScriptOutput io.Writer `json:"-"`
 
-	// TODO(dustmop): add `Wait bool`, if false, run the save asynchronously
-	// and return events on the bus that provide the progress of the save operation
-
 	// Apply runs a transform script to create the next version to save
 	Apply bool `json:"apply"`
+	// NoCache runs every transform step when applying a transform, ignoring
+	// cached step results
+	NoCache bool `json:"noCache"`
+	// RecordResponses records the http responses a transform reads when
+	// applying, so the saved version can be verified without network access
+	RecordResponses bool `json:"recordResponses"`
+	// Params set run parameter values when applying a transform, overriding
+	// the defaults declared in transform config
+	Params map[string]string `json:"params"`
 	// Replace writes the entire given dataset as a new snapshot instead of
 	// applying save params as augmentations to the existing history
 	Replace bool `json:"replace"`
@@ -516,11 +619,248 @@ func (m DatasetMethods) WhatChanged(ctx context.Context, p *WhatChangedParams) (
 	return nil, dispatchReturnError(got, err)
 }
 
+// SquashParams are parameters for the squash command
+type SquashParams struct {
+	Ref string `json:"ref"`
+	// From is the oldest version in the range to squash, either a version
+	// path or a number of versions back from the latest version, where 0 is
+	// the latest version
+	From string `json:"from"`
+	// To is the newest version in the range to squash, in the same form as From
+	To string `json:"to"`
+}
+
+// Validate returns an error if SquashParams fields are in an invalid state
+func (p *SquashParams) Validate() error {
+	if p.Ref == "" {
+		return fmt.Errorf("squash: reference required")
+	}
+	if p.From == "" || p.To == "" {
+		return fmt.Errorf("squash: both 'from' and 'to' versions are required")
+	}
+	return nil
+}
+
+// SquashResponse gives the results of a squash
+type SquashResponse struct {
+	// reference to the latest version after squashing
+	Ref string `json:"ref"`
+	// number of versions removed from history
+	NumSquashed int `json:"numSquashed"`
+}
+
+// Squash collapses a range of dataset history into a single version. Versions
+// that remain aren't re-written
+func (m DatasetMethods) Squash(ctx context.Context, p *SquashParams) (*SquashResponse, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "squash"), p)
+	if res, ok := got.(*SquashResponse); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+const (
+	// LineageUpstream traces the datasets a dataset was built from
+	LineageUpstream = "upstream"
+	// LineageDownstream traces the datasets built from a dataset
+	LineageDownstream = "downstream"
+	// LineageBoth traces both upstream & downstream
+	LineageBoth = "both"
+)
+
+// LineageParams are parameters for the lineage command
+type LineageParams struct {
+	Ref string `json:"ref"`
+	// Direction is one of "upstream", "downstream" or "both". default is both
+	Direction string `json:"direction"`
+	// Depth limits the number of steps traced in each direction. values < 1
+	// trace the entire graph
+	Depth int `json:"depth"`
+}
+
+// Validate returns an error if LineageParams fields are in an invalid state
+func (p *LineageParams) Validate() error {
+	if p.Ref == "" {
+		return fmt.Errorf("lineage: reference required")
+	}
+	switch p.Direction {
+	case "", LineageUpstream, LineageDownstream, LineageBoth:
+		return nil
+	default:
+		return fmt.Errorf("lineage: invalid direction %q, must be one of %q, %q or %q", p.Direction, LineageUpstream, LineageDownstream, LineageBoth)
+	}
+}
+
+// Lineage is a graph of dataset versions connected by the transforms that
+// load them
+type Lineage = base.Lineage
+
+// Lineage traces the datasets a dataset was built from and the datasets built
+// from it, using the inputs transforms record when they run
+func (m DatasetMethods) Lineage(ctx context.Context, p *LineageParams) (*Lineage, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "lineage"), p)
+	if res, ok := got.(*Lineage); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// VerifyParams are parameters for the verify command
+type VerifyParams struct {
+	// Ref is the dataset version to verify, the latest version if the ref
+	// has no path
+	Ref string `json:"ref"`
+}
+
+// Validate returns an error if VerifyParams fields are in an invalid state
+func (p *VerifyParams) Validate() error {
+	if p.Ref == "" {
+		return fmt.Errorf("verify: reference required")
+	}
+	return nil
+}
+
+// VerifyResult is the outcome of verifying a dataset version
+type VerifyResult = verify.Result
+
+// Verify re-runs the transform recorded in a dataset version against the
+// inputs it originally read, checking the result matches the version. Only
+// profiles that can write to the dataset can verify it, transforms run on the
+// same queue as applied transforms
+func (m DatasetMethods) Verify(ctx context.Context, p *VerifyParams) (*VerifyResult, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "verify"), p)
+	if res, ok := got.(*VerifyResult); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// VerifySignaturesParams are parameters for the verify-signatures command
+type VerifySignaturesParams struct {
+	Ref string `json:"ref"`
+}
+
+// Validate returns an error if VerifySignaturesParams fields are in an
+// invalid state
+func (p *VerifySignaturesParams) Validate() error {
+	if p.Ref == "" {
+		return fmt.Errorf("verify-signatures: reference required")
+	}
+	return nil
+}
+
+// SignatureCheck is the result of checking the commit signature of a dataset
+// version
+type SignatureCheck = base.SignatureCheck
+
+// VerifySignatures checks the commit signature of every version in a
+// dataset's history against the known key of its author, newest first
+func (m DatasetMethods) VerifySignatures(ctx context.Context, p *VerifySignaturesParams) ([]SignatureCheck, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "verifysignatures"), p)
+	if res, ok := got.([]SignatureCheck); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// DefaultBlameVersions is the number of versions blame walks when no limit
+// is given
+const DefaultBlameVersions = 100
+
+// DefaultBlameRows is the number of rows in a page of blame results when no
+// page size is given
+const DefaultBlameRows = 1000
+
+// BlameParams are parameters for the blame command
+type BlameParams struct {
+	Ref string `json:"ref"`
+	// Key is the column or field that identifies rows across versions. rows
+	// are identified by index when empty
+	Key string `json:"key"`
+	// Cells reports the version that last changed each cell
+	Cells bool `json:"cells"`
+	// Since skips versions committed before a point in time, either an
+	// RFC3339 timestamp, a date like 2021-01-30, or a duration before now like
+	// 720h
+	Since string `json:"since"`
+	// Limit is the maximum number of versions to walk, defaults to
+	// DefaultBlameVersions
+	Limit int `json:"limit"`
+	// Offset is the number of rows to skip
+	Offset int `json:"offset"`
+	// PageSize is the maximum number of rows to return, defaults to
+	// DefaultBlameRows. Blame returns a cursor for the next page of rows
+	PageSize int `json:"pageSize"`
+}
+
+// SetNonZeroDefaults bounds the number of versions walked & rows returned
+func (p *BlameParams) SetNonZeroDefaults() {
+	if p.Limit < 1 {
+		p.Limit = DefaultBlameVersions
+	}
+	if p.Offset < 0 {
+		p.Offset = 0
+	}
+	if p.PageSize < 1 {
+		p.PageSize = DefaultBlameRows
+	}
+}
+
+// Validate returns an error if BlameParams fields are in an invalid state
+func (p *BlameParams) Validate() error {
+	if p.Ref == "" {
+		return fmt.Errorf("blame: reference required")
+	}
+	if _, err := p.sinceTime(time.Now()); err != nil {
+		return qrierr.New(ErrBadArgs, err.Error())
+	}
+	return nil
+}
+
+func (p *BlameParams) sinceTime(now time.Time) (time.Time, error) {
+	if p.Since == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, p.Since); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", p.Since); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(p.Since); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since value %q, must be a timestamp, date, or duration", p.Since)
+}
+
+// RowBlame reports the version that last changed a row
+type RowBlame = base.RowBlame
+
+// BlameVersion describes the version that last changed a row or cell
+type BlameVersion = base.BlameVersion
+
+// Blame reports the version that last changed each row of a dataset,
+// walking the dataset's history
+func (m DatasetMethods) Blame(ctx context.Context, p *BlameParams) ([]RowBlame, Cursor, error) {
+	got, cur, err := m.d.Dispatch(ctx, dispatchMethodName(m, "blame"), p)
+	if res, ok := got.([]RowBlame); ok {
+		return res, cur, err
+	}
+	return nil, nil, dispatchReturnError(got, err)
+}
+
 // datasetImpl holds the method implementations for DatasetMethods
 type datasetImpl struct{}
 
 // Get retrieves datasets and components for a given reference.t
 func (datasetImpl) Get(scope scope, p *GetParams) (*GetResult, error) {
+	// queried body reads from a remote fetch only the requested entries,
+	// instead of pulling the dataset version
+	if addr, ok := scope.Config().Remotes.Get(scope.SourceName()); ok && p.Selector == "body" && p.isBodyQuery() {
+		res, _, err := queryRemoteBody(scope, addr, p)
+		return res, err
+	}
+
 	_, ds, err := openAndLoadDataset(scope, p)
 	if err != nil {
 		return nil, err
@@ -541,6 +881,13 @@ func (datasetImpl) Get(scope scope, p *GetParams) (*GetResult, error) {
 		if !p.All && (p.Limit < 0 || p.Offset < 0) {
 			return nil, fmt.Errorf("invalid limit / offset settings")
 		}
+		if p.isBodyQuery() {
+			res, _, err = getBodyPage(scope, ds, p)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
 		if err := ensureValidGetSize(ds, p.Limit, p.All); err != nil {
 			return nil, err
 		}
@@ -575,6 +922,44 @@ func (datasetImpl) Get(scope scope, p *GetParams) (*GetResult, error) {
 	return res, nil
 }
 
+// QueryBody reads a page of body entries, returning a cursor for the next page
+func (datasetImpl) QueryBody(scope scope, p *GetParams) (*GetResult, Cursor, error) {
+	if p.Selector != "body" {
+		return nil, nil, qrierr.New(ErrBadArgs, "can only query the body component, selector must be 'body'")
+	}
+	if !p.All && (p.Limit < 0 || p.Offset < 0) {
+		return nil, nil, fmt.Errorf("invalid limit / offset settings")
+	}
+	if addr, ok := scope.Config().Remotes.Get(scope.SourceName()); ok {
+		return queryRemoteBody(scope, addr, p)
+	}
+
+	_, ds, err := openAndLoadDataset(scope, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return getBodyPage(scope, ds, p)
+}
+
+// getBodyPage reads a page of body entries that match the query in p,
+// writing entries to p.Output if it's set
+func getBodyPage(scope scope, ds *dataset.Dataset, p *GetParams) (*GetResult, Cursor, error) {
+	format, fc, err := p.outputFormat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.Output == nil {
+		if err := ensureValidGetSize(ds, p.Limit, p.All); err != nil {
+			return nil, nil, err
+		}
+	}
+	val, cur, err := queryBody(scope, ds, p, p.Output, format, fc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &GetResult{Value: val}, cur, nil
+}
+
 // TODO(b5): pretty sure this can be factored away completely
 func openAndLoadDataset(scope scope, p *GetParams) (*dsref.Ref, *dataset.Dataset, error) {
 	ds, err := scope.Loader().LoadDataset(scope.Context(), p.Ref)
@@ -611,6 +996,17 @@ func inlineAllScriptFiles(ctx context.Context, ds *dataset.Dataset, resolver qfs
 }
 
 func (datasetImpl) GetCSV(scope scope, p *GetParams) ([]byte, error) {
+	if addr, ok := scope.Config().Remotes.Get(scope.SourceName()); ok && p.isBodyQuery() {
+		buf := &bytes.Buffer{}
+		rp := *p
+		rp.Output = buf
+		rp.OutputFormat = "csv"
+		if _, _, err := queryRemoteBody(scope, addr, &rp); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
 	_, ds, err := openAndLoadDataset(scope, p)
 	if err != nil {
 		return nil, err
@@ -629,6 +1025,17 @@ func (datasetImpl) GetCSV(scope scope, p *GetParams) ([]byte, error) {
 		}
 	}
 
+	if p.HasBodyQuery() {
+		buf := &bytes.Buffer{}
+		if fc == nil {
+			fc = &dataset.CSVOptions{HeaderRow: true}
+		}
+		if _, _, err := queryBody(scope, ds, p, buf, dataset.CSVDataFormat, fc); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
 	if err := ensureValidGetSize(ds, p.Limit, p.All); err != nil {
 		return nil, err
 	}
@@ -641,6 +1048,181 @@ func (datasetImpl) GetCSV(scope scope, p *GetParams) ([]byte, error) {
 	return bodyBytes, nil
 }
 
+// queryBody reads a page of body entries that match the body query in p. If
+// w is non-nil entries are written to w as they're read, encoded as format,
+// instead of being returned. When entries remain after the page, queryBody
+// returns a cursor with a continuation token for the next page
+func queryBody(scope scope, ds *dataset.Dataset, p *GetParams, w io.Writer, format dataset.DataFormat, fc dataset.FormatConfig) (interface{}, Cursor, error) {
+	qr, err := bodyquery.Open(ds, p.bodyQuery(), p.Token)
+	if err != nil {
+		if errors.Is(err, bodyquery.ErrInvalidToken) || errors.Is(err, bodyquery.ErrUnknownColumn) || errors.Is(err, bodyquery.ErrInvalidWhere) {
+			return nil, nil, qrierr.New(ErrBadArgs, err.Error())
+		}
+		return nil, nil, err
+	}
+	defer qr.Close()
+
+	pw, err := newBodyPageWriter(qr.Structure(), w, format, fc)
+	if err != nil {
+		return nil, nil, err
+	}
+	limit := p.Limit
+	if p.All {
+		limit = -1
+	}
+	token, err := qr.ReadPage(ds.Path, p.Offset, limit, pw.WriteEntry)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := pw.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	// the next page reads the exact version this page did
+	var cur Cursor
+	if token != "" {
+		cur = nextBodyPageCursor(scope, p, dsref.ConvertDatasetToVersionInfo(ds).SimpleRef().String(), token, pw.read)
+	}
+	return pw.Value(), cur, nil
+}
+
+// queryRemoteBody reads a page of body entries from a dataset version stored
+// on the remote at addr, without pulling the version
+func queryRemoteBody(scope scope, addr string, p *GetParams) (*GetResult, Cursor, error) {
+	ref, err := dsref.Parse(p.Ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	// resolve the version up front so continuation tokens & the next page
+	// refer to the same version
+	if _, err := scope.RemoteClient().NewRemoteRefResolver(addr).ResolveRef(scope.Context(), &ref); err != nil {
+		return nil, nil, err
+	}
+
+	format, fc, err := p.outputFormat()
+	if err != nil {
+		return nil, nil, err
+	}
+	limit := p.Limit
+	if p.All {
+		limit = -1
+	}
+	br, err := scope.RemoteClient().QueryBody(scope.Context(), ref, remote.BodyQuery{
+		Where:   p.Where,
+		Columns: p.Columns,
+		Sort:    p.Sort,
+		Token:   p.Token,
+		Offset:  p.Offset,
+		Limit:   limit,
+	}, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer br.Close()
+
+	pw, err := newBodyPageWriter(br.Structure(), p.Output, format, fc)
+	if err != nil {
+		return nil, nil, err
+	}
+	for {
+		ent, err := br.ReadEntry()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if err := pw.WriteEntry(ent); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := pw.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	var cur Cursor
+	if token := br.NextToken(); token != "" {
+		cur = nextBodyPageCursor(scope, p, ref.String(), token, pw.read)
+	}
+	return &GetResult{Value: pw.Value()}, cur, nil
+}
+
+// nextBodyPageCursor creates a cursor for reading the page of body entries
+// after a page that read n entries
+func nextBodyPageCursor(scope scope, p *GetParams, ref, token string, n int) Cursor {
+	next := *p
+	next.Ref = ref
+	next.List = params.List{Limit: p.Limit}
+	next.Token = token
+	next.Output = nil
+	return scope.MakeCursor(n, &next)
+}
+
+// bodyPageWriter collects a page of body entries, or writes them to an
+// io.Writer as they're read
+type bodyPageWriter struct {
+	ew   dsio.EntryWriter
+	tlt  string
+	obj  map[string]interface{}
+	arr  []interface{}
+	read int
+}
+
+func newBodyPageWriter(st *dataset.Structure, w io.Writer, format dataset.DataFormat, fc dataset.FormatConfig) (*bodyPageWriter, error) {
+	tlt, err := dsio.GetTopLevelType(st)
+	if err != nil {
+		return nil, err
+	}
+	pw := &bodyPageWriter{
+		tlt: tlt,
+		obj: map[string]interface{}{},
+		arr: []interface{}{},
+	}
+	if w != nil {
+		wst := &dataset.Structure{
+			Format: format.String(),
+			Schema: st.Schema,
+		}
+		if fc != nil {
+			wst.FormatConfig = fc.Map()
+		}
+		if pw.ew, err = dsio.NewEntryWriter(wst, w); err != nil {
+			return nil, err
+		}
+	}
+	return pw, nil
+}
+
+func (pw *bodyPageWriter) WriteEntry(ent dsio.Entry) error {
+	pw.read++
+	switch {
+	case pw.ew != nil:
+		return pw.ew.WriteEntry(ent)
+	case pw.tlt == "object":
+		pw.obj[ent.Key] = ent.Value
+	default:
+		pw.arr = append(pw.arr, ent.Value)
+	}
+	return nil
+}
+
+func (pw *bodyPageWriter) Close() error {
+	if pw.ew != nil {
+		return pw.ew.Close()
+	}
+	return nil
+}
+
+// Value returns collected entries, or nil if entries were written out
+func (pw *bodyPageWriter) Value() interface{} {
+	switch {
+	case pw.ew != nil:
+		return nil
+	case pw.tlt == "object":
+		return pw.obj
+	}
+	return pw.arr
+}
+
 func (datasetImpl) GetZip(scope scope, p *GetParams) (*GetZipResults, error) {
 	ref, ds, err := openAndLoadDataset(scope, p)
 	if err != nil {
@@ -779,6 +1361,8 @@ func (datasetImpl) Save(scope scope, p *SaveParams) (*dataset.Dataset, error) {
 		// runState holds the results of transform application. will be non-nil if a
 		// transform is applied while saving
 		runState *run.State
+		// transformer applies the transform, set if applying while saving
+		transformer *transform.Transformer
 	)
 
 	if p.Private {
@@ -916,7 +1500,17 @@ func (datasetImpl) Save(scope scope, p *SaveParams) (*dataset.Dataset, error) {
 
 		// apply the transform
 		shouldWait := true
-		transformer := transform.NewTransformer(scope.AppContext(), scope.Filesystem(), scope.Loader(), scope.Bus(), sizeInfo)
+		transformer = transform.NewTransformer(scope.AppContext(), scope.Filesystem(), scope.Loader(), scope.Bus(), sizeInfo)
+		if cache := scope.StepCache(); cache != nil {
+			transformer.SetStepCache(cache, p.NoCache)
+			if store, ok := cache.(stepcache.ResponseStore); ok && p.RecordResponses {
+				transformer.SetRecordResponses(store)
+			}
+		}
+		transformer.SetParams(p.Params)
+		if err := loadTransformState(scope, ref.InitID, transformer); err != nil {
+			return nil, err
+		}
 		if err := transformer.Commit(scope.Context(), ref.InitID, ds, runID, shouldWait, secrets); err != nil {
 			log.Errorw("transform run error", "err", err.Error())
 			runState.Message = err.Error()
@@ -977,6 +1571,17 @@ func (datasetImpl) Save(scope scope, p *SaveParams) (*dataset.Dataset, error) {
 	success = true
 	*res = *savedDs
 
+	// transform state is only persisted once the version it produced is saved,
+	// a failed run leaves state unchanged
+	if transformer != nil {
+		if st, changed := transformer.State(); changed {
+			if err := scope.TransformState().Put(scope.Context(), ref.InitID, st); err != nil {
+				log.Errorw("saving transform state", "initID", ref.InitID, "err", err)
+				return nil, fmt.Errorf("dataset saved, but saving transform state failed: %w", err)
+			}
+		}
+	}
+
 	return res, nil
 }
 
@@ -1369,3 +1974,175 @@ func (datasetImpl) WhatChanged(scope scope, p *WhatChangedParams) ([]base.Status
 	}
 	return scope.ComponentStatus().WhatChanged(scope.Context(), ref)
 }
+
+// Squash collapses a range of dataset history into a single version
+func (datasetImpl) Squash(scope scope, p *SquashParams) (*SquashResponse, error) {
+	if scope.SourceName() != "local" {
+		return nil, fmt.Errorf("squash requires the 'local' source")
+	}
+	ref, _, err := scope.ParseAndResolveRef(scope.Context(), p.Ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := scope.Logbook().ProfileCanWrite(scope.Context(), ref.InitID, scope.ActiveProfile()); err != nil {
+		return nil, fmt.Errorf("profile %s can not write to dataset %s", scope.ActiveProfile().ID.Encode(), ref.InitID)
+	}
+
+	history, err := base.DatasetLog(scope.Context(), scope.Repo(), ref, -1, 0, "history", false)
+	if err != nil {
+		return nil, err
+	}
+	from, err := squashVersionPath(history, p.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := squashVersionPath(history, p.To)
+	if err != nil {
+		return nil, err
+	}
+
+	head, n, err := base.SquashVersions(scope.Context(), scope.Repo(), scope.ActiveProfile(), ref, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &SquashResponse{
+		Ref:         head.SimpleRef().String(),
+		NumSquashed: n,
+	}, nil
+}
+
+// Lineage traces the transform lineage of a dataset
+func (datasetImpl) Lineage(scope scope, p *LineageParams) (*Lineage, error) {
+	if scope.SourceName() != "local" {
+		return nil, fmt.Errorf("lineage requires the 'local' source")
+	}
+	parsed, err := dsref.Parse(p.Ref)
+	if err != nil {
+		return nil, err
+	}
+	ref, _, err := scope.ParseAndResolveRef(scope.Context(), p.Ref)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := base.LineageOptions{
+		Upstream:   p.Direction != LineageDownstream,
+		Downstream: p.Direction != LineageUpstream,
+		Depth:      p.Depth,
+		// without an explicit version, show datasets built from any version
+		AllVersions: parsed.Path == "",
+	}
+	return base.DatasetLineage(scope.Context(), scope.Repo(), scope.LineageIndex(), ref, opts)
+}
+
+// Verify re-runs the transform of a dataset version, comparing the result to
+// the version
+func (datasetImpl) Verify(scope scope, p *VerifyParams) (*VerifyResult, error) {
+	ctx := scope.Context()
+	ref, _, err := scope.ParseAndResolveRef(ctx, p.Ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := scope.Logbook().ProfileCanWrite(ctx, ref.InitID, scope.ActiveProfile()); err != nil {
+		return nil, fmt.Errorf("profile %s can not write to dataset %s", scope.ActiveProfile().ID.Encode(), ref.InitID)
+	}
+	responses, _ := scope.StepCache().(stepcache.ResponseStore)
+
+	// re-run with the parameters of the run that created the version
+	var runParams map[string]string
+	if ds, err := dsfs.LoadDataset(ctx, scope.Filesystem(), ref.Path); err == nil && ds.Commit != nil && ds.Commit.RunID != "" {
+		if rs, err := scope.AutomationOrchestrator().RunInfo(ctx, ds.Commit.RunID); err == nil {
+			runParams = rs.Params
+		}
+	}
+
+	// verifying executes the transform, queue it with applied transforms
+	var res *VerifyResult
+	v := verify.New(scope.AppContext(), scope.Filesystem(), scope.Loader(), scopeResolver{scope}, scope.Bus(), responses)
+	runID := run.NewID()
+	err = scope.AutomationOrchestrator().QueueApply(ctx, scope.ActiveProfile().ID, runID, func(ctx context.Context) (err error) {
+		res, err = v.Verify(ctx, ref, runID, runParams)
+		return err
+	})
+	return res, err
+}
+
+// VerifySignatures checks the commit signatures of a dataset's history
+func (datasetImpl) VerifySignatures(scope scope, p *VerifySignaturesParams) ([]SignatureCheck, error) {
+	ref, _, err := scope.ParseAndResolveRef(scope.Context(), p.Ref)
+	if err != nil {
+		return nil, err
+	}
+	return base.CheckSignatureHistory(scope.Context(), scope.Repo(), ref)
+}
+
+// errBlamePageFull stops walking blame rows once a page is full
+var errBlamePageFull = errors.New("blame page is full")
+
+// Blame reports the version that last changed each row of a dataset, a page
+// of rows at a time
+func (datasetImpl) Blame(scope scope, p *BlameParams) ([]RowBlame, Cursor, error) {
+	ref, _, err := scope.ParseAndResolveRef(scope.Context(), p.Ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	since, err := p.sinceTime(time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	p.SetNonZeroDefaults()
+	opts := base.BlameOptions{
+		Key:   p.Key,
+		Cells: p.Cells,
+		Since: since,
+		Limit: p.Limit,
+	}
+	rows := make([]RowBlame, 0, p.PageSize)
+	skip := p.Offset
+	more := false
+	err = base.Blame(scope.Context(), scope.Repo(), ref, opts, func(rb RowBlame) error {
+		if skip > 0 {
+			skip--
+			return nil
+		}
+		if len(rows) == p.PageSize {
+			more = true
+			return errBlamePageFull
+		}
+		rows = append(rows, rb)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBlamePageFull) {
+		return nil, nil, err
+	}
+	if !more {
+		return rows, nil, nil
+	}
+	next := *p
+	next.Offset += len(rows)
+	return rows, scope.MakeCursor(len(rows), &next), nil
+}
+
+// scopeResolver adapts a scope to the dsref.Resolver interface, resolving
+// references including the "me" shortcut
+type scopeResolver struct {
+	scope scope
+}
+
+// ResolveRef implements the dsref.Resolver interface
+func (r scopeResolver) ResolveRef(ctx context.Context, ref *dsref.Ref) (string, error) {
+	return r.scope.ResolveReference(ctx, ref)
+}
+
+// squashVersionPath resolves a squash revision string to a version path.
+// history must be ordered newest-first
+func squashVersionPath(history []dsref.VersionInfo, rev string) (string, error) {
+	n, err := strconv.Atoi(rev)
+	if err != nil {
+		return rev, nil
+	}
+	if n < 0 || n >= len(history) {
+		return "", fmt.Errorf("version %d is out of range, dataset has %d versions", n, len(history))
+	}
+	return history[n].Path, nil
+}
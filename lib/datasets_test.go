@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -34,6 +35,8 @@ import (
 	p2ptest "github.com/qri-io/qri/p2p/test"
 	reporef "github.com/qri-io/qri/repo/ref"
 	testrepo "github.com/qri-io/qri/repo/test"
+	"github.com/qri-io/qri/transform/stepcache"
+	"github.com/qri-io/qri/transform/verify"
 )
 
 func TestDatasetRequestsSave(t *testing.T) {
@@ -407,6 +410,92 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestGetBodyQuery(t *testing.T) {
+	tr := newTestRunner(t)
+	defer tr.Delete()
+	ctx := tr.Ctx
+
+	ds := tr.MustSaveFromBody(t, "query_cities", "testdata/cities_2/body.csv")
+	ref := fmt.Sprintf("%s/query_cities@%s", ds.Peername, ds.Path)
+
+	p := &GetParams{
+		Ref:      "me/query_cities",
+		Selector: "body",
+		Where:    "in_usa = true",
+		Columns:  "city",
+		Sort:     "city",
+		List:     params.List{Limit: 3},
+	}
+	res, cur, err := tr.Instance.Dataset().QueryBody(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []interface{}{[]interface{}{"chatham"}, []interface{}{"chicago"}, []interface{}{"new york"}}
+	if diff := cmp.Diff(expect, res.Value); diff != "" {
+		t.Errorf("first page mismatch (-want +got):\n%s", diff)
+	}
+	if cur == nil {
+		t.Fatal("expected a cursor for the next page")
+	}
+
+	// the second page is the last, completing the cursor
+	next, err := cur.Next(ctx)
+	if !errors.Is(err, ErrCursorComplete) {
+		t.Fatalf("expected ErrCursorComplete, got %v", err)
+	}
+	expect = []interface{}{[]interface{}{"raleigh"}}
+	if diff := cmp.Diff(expect, next.(*GetResult).Value); diff != "" {
+		t.Errorf("second page mismatch (-want +got):\n%s", diff)
+	}
+	nextParams, err := cur.ToParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(nextParams["ref"], ds.Path) {
+		t.Errorf("expected next page to read version %q, got %q", ds.Path, nextParams["ref"])
+	}
+
+	// a token for one version can't be used to read another
+	tr.MustSaveFromBody(t, "query_cities", "testdata/cities_2/body_more.csv")
+	p = &GetParams{Ref: "me/query_cities", Selector: "body", Token: nextParams["token"], List: params.List{Limit: 3}}
+	if _, _, err := tr.Instance.Dataset().QueryBody(ctx, p); !errors.Is(err, ErrBadArgs) {
+		t.Errorf("expected using a token for another version to fail with ErrBadArgs, got %v", err)
+	}
+
+	// entries stream to an output writer
+	buf := &bytes.Buffer{}
+	p = &GetParams{
+		Ref:          ref,
+		Selector:     "body",
+		Where:        "pop > 1000000",
+		Columns:      "city,pop",
+		All:          true,
+		Output:       buf,
+		OutputFormat: "csv",
+	}
+	if res, cur, err = tr.Instance.Dataset().QueryBody(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != nil || cur != nil {
+		t.Errorf("expected streamed read to return no value or cursor, got %v %v", res.Value, cur)
+	}
+	if diff := cmp.Diff("city,pop\ntoronto,50000000\nnew york,8500000\n", buf.String()); diff != "" {
+		t.Errorf("streamed csv mismatch (-want +got):\n%s", diff)
+	}
+
+	bad := []*GetParams{
+		{Ref: ref, Selector: "body", Where: "pop >", All: true},
+		{Ref: ref, Selector: "body", Columns: "not_a_column", All: true},
+		{Ref: ref, Selector: "meta", Where: "pop > 1"},
+		{Ref: ref, Selector: "body", Token: "abc", All: true},
+	}
+	for _, p := range bad {
+		if _, err := tr.Instance.Dataset().Get(ctx, p); err == nil {
+			t.Errorf("expected error for params %#v", p)
+		}
+	}
+}
+
 func TestGetParamsValidate(t *testing.T) {
 	p := &GetParams{}
 	p.Selector = "test+selector"
@@ -1159,6 +1248,245 @@ func TestDatasetWhatChanged(t *testing.T) {
 	}
 }
 
+func TestDatasetSquash(t *testing.T) {
+	run := newTestRunner(t)
+	defer run.Delete()
+
+	first := run.MustSaveFromBody(t, "cities_ds", "testdata/cities_2/body.csv")
+	var head dsref.Ref
+	for _, title := range []string{"city data", "city data 2"} {
+		var err error
+		if head, err = run.SaveWithParams(&SaveParams{
+			Ref:     "me/cities_ds",
+			Dataset: &dataset.Dataset{Meta: &dataset.Meta{Title: title}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := run.Instance.Dataset().Squash(ctx, &SquashParams{Ref: "me/cities_ds", From: "0", To: "3"}); err == nil {
+		t.Error("expected out of range revision to error")
+	}
+
+	res, err := run.Instance.Dataset().Squash(ctx, &SquashParams{Ref: "me/cities_ds", From: first.Path, To: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.NumSquashed != 1 {
+		t.Errorf("expected 1 squashed version, got %d", res.NumSquashed)
+	}
+	// squashing doesn't re-write the versions that remain
+	if !strings.HasSuffix(res.Ref, head.Path) {
+		t.Errorf("expected squashed head to stay at %q, got %q", head.Path, res.Ref)
+	}
+
+	items, err := run.Instance.Dataset().Activity(ctx, &ActivityParams{Ref: "me/cities_ds"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Errorf("expected 2 versions after squashing, got %d", len(items))
+	}
+}
+
+func TestDatasetLineage(t *testing.T) {
+	run := newTestRunner(t)
+	defer run.Delete()
+
+	cities := run.MustSaveFromBody(t, "cities_ds", "testdata/cities_2/body.csv")
+	script := run.MustWriteTmpFile(t, "transform.star", `
+cities = load_dataset("me/cities_ds")
+ds = dataset.latest()
+ds.body = cities.body
+dataset.commit(ds)
+`)
+	derived, err := run.SaveWithParams(&SaveParams{
+		Ref:       "me/derived_cities",
+		FilePaths: []string{script},
+		Apply:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	expect := []base.LineageEdge{{Input: cities.Path, Output: derived.Path}}
+
+	up, err := run.Instance.Dataset().Lineage(ctx, &LineageParams{Ref: "me/derived_cities", Direction: LineageUpstream})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expect, up.Edges); diff != "" {
+		t.Errorf("upstream edges mismatch (-want +got):\n%s", diff)
+	}
+
+	down, err := run.Instance.Dataset().Lineage(ctx, &LineageParams{Ref: "me/cities_ds", Direction: LineageDownstream})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expect, down.Edges); diff != "" {
+		t.Errorf("downstream edges mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := run.Instance.Dataset().Lineage(ctx, &LineageParams{Ref: "me/cities_ds", Direction: "sideways"}); err == nil {
+		t.Error("expected invalid direction to error")
+	}
+}
+
+func TestDatasetVerify(t *testing.T) {
+	run := newTestRunner(t)
+	defer run.Delete()
+	ctx := context.Background()
+
+	run.MustSaveFromBody(t, "cities_ds", "testdata/cities_2/body.csv")
+	res, err := run.Instance.Dataset().Verify(ctx, &VerifyParams{Ref: "me/cities_ds"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != verify.StatusUnverifiable || res.Reason != "version has no transform" {
+		t.Errorf("expected a version without a transform to be unverifiable, got %q: %q", res.Status, res.Reason)
+	}
+
+	script := run.MustWriteTmpFile(t, "transform.star", `
+cities = load_dataset("me/cities_ds")
+ds = dataset.latest()
+ds.body = cities.body
+dataset.commit(ds)
+`)
+	if _, err := run.SaveWithParams(&SaveParams{Ref: "me/derived_cities", FilePaths: []string{script}, Apply: true}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = run.Instance.Dataset().Verify(ctx, &VerifyParams{Ref: "me/derived_cities"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != verify.StatusReproducible {
+		t.Fatalf("expected derived dataset to be reproducible, got %q: %s%s", res.Status, res.Reason, res.Diff)
+	}
+
+	// inputs are pinned to the version the transform originally loaded
+	if _, err := run.SaveWithParams(&SaveParams{Ref: "me/cities_ds", BodyPath: "testdata/cities_2/body_more.csv"}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = run.Instance.Dataset().Verify(ctx, &VerifyParams{Ref: "me/derived_cities"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != verify.StatusReproducible {
+		t.Errorf("expected derived dataset to be reproducible after input changed, got %q: %s%s", res.Status, res.Reason, res.Diff)
+	}
+
+	script = run.MustWriteTmpFile(t, "now.star", `
+load("time.star", "time")
+ds = dataset.latest()
+ds.body = [[str(time.now())]]
+dataset.commit(ds)
+`)
+	if _, err := run.SaveWithParams(&SaveParams{Ref: "me/clock", FilePaths: []string{script}, Apply: true}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = run.Instance.Dataset().Verify(ctx, &VerifyParams{Ref: "me/clock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != verify.StatusDiverged {
+		t.Errorf("expected transform that reads the time to diverge, got %q: %s", res.Status, res.Reason)
+	}
+	if res.Diff == "" {
+		t.Error("expected diverged result to have a diff")
+	}
+	if len(res.Warnings) != 1 {
+		t.Errorf("expected one nondeterminism warning, got: %v", res.Warnings)
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[["a",1]]`))
+	}))
+	defer s.Close()
+	script = run.MustWriteTmpFile(t, "fetch.star", fmt.Sprintf(`
+load("http.star", "http")
+ds = dataset.latest()
+ds.body = http.get("%s").json()
+dataset.commit(ds)
+`, s.URL))
+	if _, err := run.SaveWithParams(&SaveParams{Ref: "me/fetched", FilePaths: []string{script}, Apply: true}); err != nil {
+		t.Fatal(err)
+	}
+	// responses are only recorded when asked for
+	res, err = run.Instance.Dataset().Verify(ctx, &VerifyParams{Ref: "me/fetched"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectReason := fmt.Sprintf("no recorded http response for GET %s", s.URL)
+	if res.Status != verify.StatusUnverifiable || res.Reason != expectReason {
+		t.Errorf("expected unrecorded http response to be unverifiable with reason %q, got %q: %q", expectReason, res.Status, res.Reason)
+	}
+
+	if _, err := run.SaveWithParams(&SaveParams{Ref: "me/recorded", FilePaths: []string{script}, Apply: true, RecordResponses: true}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = run.Instance.Dataset().Verify(ctx, &VerifyParams{Ref: "me/recorded"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != verify.StatusReproducible {
+		t.Errorf("expected version with recorded responses to be reproducible, got %q: %q", res.Status, res.Reason)
+	}
+
+	// responses are collected with the version that recorded them
+	if _, err := run.SaveWithParams(&SaveParams{Ref: "me/recorded", FilePaths: []string{script}, Apply: true, RecordResponses: true, Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run.Instance.Dataset().Remove(ctx, &RemoveParams{Ref: "me/recorded", Revision: &dsref.Rev{Field: "ds", Gen: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	store := run.Instance.stepCache.(stepcache.ResponseStore)
+	runIDs, err := store.ResponseRuns(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, err := run.Instance.Repo().Logbook().AllReferencedRunIDs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := stepcache.CollectResponses(ctx, store, live, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runIDs) != 2 || removed != 1 {
+		t.Errorf("expected responses of the removed version to be collected, recorded runs: %v, removed: %d", runIDs, removed)
+	}
+}
+
+func TestDatasetVerifySignatures(t *testing.T) {
+	run := newTestRunner(t)
+	defer run.Delete()
+	ctx := context.Background()
+
+	run.MustSaveFromBody(t, "cities_ds", "testdata/cities_2/body.csv")
+	if _, err := run.SaveWithParams(&SaveParams{Ref: "me/cities_ds", BodyPath: "testdata/cities_2/body_more.csv"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := run.Instance.Dataset().VerifySignatures(ctx, &VerifySignaturesParams{}); err == nil {
+		t.Error("expected verifying signatures without a reference to fail")
+	}
+
+	checks, err := run.Instance.Dataset().VerifySignatures(ctx, &VerifySignaturesParams{Ref: "me/cities_ds"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 2 {
+		t.Fatalf("expected 2 checks, got %d", len(checks))
+	}
+	for _, c := range checks {
+		if c.Status != base.SignatureValid {
+			t.Errorf("version %s: expected valid signature, got %q: %s", c.Path, c.Status, c.Message)
+		}
+	}
+}
+
 // Convert the interface value into an array, or panic if not possible
 func mustBeArray(i interface{}, err error) []interface{} {
 	if err != nil {
@@ -1166,3 +1494,79 @@ func mustBeArray(i interface{}, err error) []interface{} {
 	}
 	return i.([]interface{})
 }
+
+func TestDatasetBlame(t *testing.T) {
+	run := newTestRunner(t)
+	defer run.Delete()
+	ctx := context.Background()
+
+	first := run.MustSaveFromBody(t, "cities_ds", "testdata/cities_2/body.csv")
+	second, err := run.SaveWithParams(&SaveParams{Ref: "me/cities_ds", BodyPath: "testdata/cities_2/body_more.csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := run.Instance.Dataset().Blame(ctx, &BlameParams{Ref: "me/cities_ds", Since: "last tuesday"}); err == nil {
+		t.Error("expected an invalid since value to error")
+	}
+
+	rows, cur, err := run.Instance.Dataset().Blame(ctx, &BlameParams{Ref: "me/cities_ds", Key: "city", Cells: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, row := range rows {
+		got[row.Key] = row.Version.Path
+		if len(row.Cells) != 4 {
+			t.Errorf("row %q: expected 4 cells, got %d", row.Key, len(row.Cells))
+		}
+	}
+	expect := map[string]string{
+		"toronto":     first.Path,
+		"new york":    first.Path,
+		"los angeles": second.Path,
+		"chicago":     first.Path,
+		"chatham":     first.Path,
+		"mexico city": second.Path,
+		"raleigh":     first.Path,
+	}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+	if cur != nil {
+		t.Error("expected no cursor when every row fits in a page")
+	}
+
+	// rows are returned a page at a time
+	keys := []string{}
+	pageParams := &BlameParams{Ref: "me/cities_ds", Key: "city", PageSize: 3}
+	for {
+		rows, cur, err = run.Instance.Dataset().Blame(ctx, pageParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) > 3 {
+			t.Errorf("expected pages of at most 3 rows, got %d", len(rows))
+		}
+		for _, row := range rows {
+			keys = append(keys, row.Key)
+		}
+		if cur == nil {
+			break
+		}
+		pageParams.Offset += len(rows)
+	}
+	if len(keys) != len(expect) {
+		t.Errorf("expected paging to return all %d rows, got: %v", len(expect), keys)
+	}
+
+	rows, _, err = run.Instance.Dataset().Blame(ctx, &BlameParams{Ref: "me/cities_ds", Key: "city", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if !row.Bounded || row.Version.Path != second.Path {
+			t.Errorf("row %q: expected blame bounded to the latest version, got %s bounded=%t", row.Key, row.Version.Path, row.Bounded)
+		}
+	}
+}
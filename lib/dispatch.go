@@ -53,6 +53,8 @@ type AttributeSet struct {
 	DefaultSource string
 	// whether to deny RPC for this endpoint, normal HTTP may still be allowed
 	DenyRPC bool
+	// whether the method can run in the background as a job
+	Async bool
 }
 
 // Dispatch is a system for handling calls to lib. Should only be called by top-level lib methods.
@@ -81,6 +83,27 @@ func (isw *InstanceSourceWrap) Dispatch(ctx context.Context, method string, para
 	return isw.inst.dispatchMethodCall(ctx, method, param, isw.source)
 }
 
+// withRPCToken adds an auth token for making calls over the http rpc layer to
+// a context, if the context doesn't have one
+func (inst *Instance) withRPCToken(ctx context.Context) (context.Context, error) {
+	if tok := token.FromCtx(ctx); tok != "" {
+		return ctx, nil
+	}
+	// If no token exists, create one from configured profile private key &
+	// add it to the request context
+	// TODO(b5): we're falling back to the configured user to make requests,
+	// is this the right default?
+	p, err := profile.NewProfile(inst.cfg.Profile)
+	if err != nil {
+		return nil, err
+	}
+	tokstr, err := token.NewPrivKeyAuthToken(p.PrivKey, p.ID.Encode(), time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	return token.AddToContext(ctx, tokstr), nil
+}
+
 func (inst *Instance) dispatchMethodCall(ctx context.Context, method string, param interface{}, source string) (res interface{}, cur Cursor, err error) {
 	if inst == nil {
 		return nil, nil, ErrDispatchNilInstance
@@ -89,6 +112,24 @@ func (inst *Instance) dispatchMethodCall(ctx context.Context, method string, par
 		return nil, nil, ErrDispatchNilParam
 	}
 
+	call := &DispatchCall{Method: method, Param: param, Source: source, RPC: inst.http != nil}
+	return inst.dispatchCall(ctx, call)
+}
+
+// dispatchCall passes a call through the dispatch middleware chain
+func (inst *Instance) dispatchCall(ctx context.Context, call *DispatchCall) (interface{}, Cursor, error) {
+	if inst.dispatch == nil {
+		return inst.callMethod(ctx, call)
+	}
+	return inst.dispatch(ctx, call)
+}
+
+// callMethod validates params & executes a method call, either by forwarding
+// it over RPC or calling the registered implementation. callMethod is the
+// innermost function of the dispatch middleware chain
+func (inst *Instance) callMethod(ctx context.Context, call *DispatchCall) (res interface{}, cur Cursor, err error) {
+	method, param, source := call.Method, call.Param, call.Source
+
 	// If the input parameters has a Validate method, call it
 	if validator, ok := param.(ParamValidator); ok {
 		err = validator.Validate()
@@ -100,20 +141,8 @@ func (inst *Instance) dispatchMethodCall(ctx context.Context, method string, par
 	// If the http rpc layer is engaged, use it to dispatch methods
 	// This happens when another process is running `qri connect`
 	if inst.http != nil {
-		if tok := token.FromCtx(ctx); tok == "" {
-			// If no token exists, create one from configured profile private key &
-			// add it to the request context
-			// TODO(b5): we're falling back to the configured user to make requests,
-			// is this the right default?
-			p, err := profile.NewProfile(inst.cfg.Profile)
-			if err != nil {
-				return nil, nil, err
-			}
-			tokstr, err := token.NewPrivKeyAuthToken(p.PrivKey, p.ID.Encode(), time.Minute)
-			if err != nil {
-				return nil, nil, err
-			}
-			ctx = token.AddToContext(ctx, tokstr)
+		if ctx, err = inst.withRPCToken(ctx); err != nil {
+			return nil, nil, err
 		}
 
 		if c, ok := inst.regMethods.lookup(method); ok {
@@ -255,6 +284,7 @@ type callable struct {
 	Verb      string
 	Source    string
 	DenyRPC   bool
+	Async     bool
 }
 
 // AllMethods returns a method set for documentation purposes
@@ -268,10 +298,12 @@ func (inst *Instance) AllMethods() []MethodSet {
 		inst.Dataset(),
 		inst.Diff(),
 		inst.Log(),
+		inst.Maintenance(),
 		inst.Peer(),
 		inst.Profile(),
 		inst.Registry(),
 		inst.Follow(),
+		inst.Job(),
 		inst.Remote(),
 		inst.Search(),
 		inst.Automation(),
@@ -288,10 +320,12 @@ func (inst *Instance) RegisterMethods() {
 	inst.registerOne("dataset", inst.Dataset(), datasetImpl{}, reg)
 	inst.registerOne("diff", inst.Diff(), diffImpl{}, reg)
 	inst.registerOne("log", inst.Log(), logImpl{}, reg)
+	inst.registerOne("maintenance", inst.Maintenance(), maintenanceImpl{}, reg)
 	inst.registerOne("peer", inst.Peer(), peerImpl{}, reg)
 	inst.registerOne("profile", inst.Profile(), profileImpl{}, reg)
 	inst.registerOne("registry", inst.Registry(), registryImpl{}, reg)
 	inst.registerOne("follow", inst.Follow(), followImpl{}, reg)
+	inst.registerOne("job", inst.Job(), jobImpl{}, reg)
 	inst.registerOne("remote", inst.Remote(), remoteImpl{}, reg)
 	inst.registerOne("search", inst.Search(), searchImpl{}, reg)
 	inst.regMethods = &regMethodSet{reg: reg}
@@ -441,6 +475,7 @@ func (inst *Instance) registerOne(ourName string, methods MethodSet, impl interf
 			Verb:      methodAttrs.HTTPVerb,
 			Source:    methodAttrs.DefaultSource,
 			DenyRPC:   methodAttrs.DenyRPC,
+			Async:     methodAttrs.Async,
 		}
 	}
 
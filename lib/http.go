@@ -35,8 +35,17 @@ func NewHTTPRequestHandler(inst *Instance, libMethod string) http.HandlerFunc {
 			return
 		}
 
+		method := libMethod
+		// methods that support it run as a background job when requested,
+		// responding with the job instead of the method result. decoded params
+		// are handed to the job as-is, keeping fields that don't serialize
+		if r.URL.Query().Get("async") == "true" {
+			method = "job.start"
+			p = &StartJobParams{Method: libMethod, input: p}
+		}
+
 		source := SourceFromRequest(r)
-		res, cursor, err := inst.WithSource(source).Dispatch(r.Context(), libMethod, p)
+		res, cursor, err := inst.WithSource(source).Dispatch(r.Context(), method, p)
 		if err != nil {
 			log.Debugw("http request: dispatch", "err", err)
 			apiutil.RespondWithError(w, err)
@@ -56,12 +56,23 @@ const (
 	AERun APIEndpoint = "/auto/run"
 	// AERunInfo fetches the full run info for a workflow run
 	AERunInfo APIEndpoint = "/auto/runinfo"
+	// AEBackfill enqueues a run of a workflow for each value in a range of
+	// run parameter values
+	AEBackfill APIEndpoint = "/auto/backfill"
+	// AEBackfillGroup lists the runs enqueued by a backfill
+	AEBackfillGroup APIEndpoint = "/auto/backfill-group"
+	// AERuns lists the runs of a workflow
+	AERuns APIEndpoint = "/auto/runs"
+	// AEFreshness checks datasets against the freshness SLAs of their workflows
+	AEFreshness APIEndpoint = "/auto/freshness"
 	// AECancel cancels a run
 	AECancel APIEndpoint = "/auto/cancel"
 	// AEWorkflow fetches a workflow
 	AEWorkflow APIEndpoint = "/auto/workflow"
 	// AERemoveWorkflow removes a workflow
 	AERemoveWorkflow APIEndpoint = "/auto/remove"
+	// AERetention sets the retention policy of a workflow
+	AERetention APIEndpoint = "/auto/retention"
 	// AEAnalyzeTransform performs static analysis on a starlark transform script
 	AEAnalyzeTransform APIEndpoint = "/auto/analyze-transform"
 
@@ -69,6 +80,8 @@ const (
 
 	// AEGet is an endpoint for fetch individual dataset components
 	AEGet APIEndpoint = "/ds/get"
+	// AEQueryBody reads a page of filtered, projected & sorted body entries
+	AEQueryBody APIEndpoint = "/ds/querybody"
 	// AEActivity is an endpoint that returns a dataset activity list
 	AEActivity APIEndpoint = "/ds/activity"
 	// AERename is an endpoint for renaming datasets
@@ -93,6 +106,17 @@ const (
 	AEDAGInfo APIEndpoint = "/ds/daginfo"
 	// AEWhatChanged gets what changed at a specific version in history
 	AEWhatChanged APIEndpoint = "/ds/whatchanged"
+	// AESquash collapses a range of dataset history into a single version
+	AESquash APIEndpoint = "/ds/squash"
+	// AELineage traces the datasets a dataset was built from & is used to build
+	AELineage APIEndpoint = "/ds/lineage"
+	// AEVerify re-runs the transform of a dataset version, checking the
+	// version is reproducible
+	AEVerify APIEndpoint = "/ds/verify"
+	// AEBlame reports the version that last changed each row of a dataset
+	AEBlame APIEndpoint = "/ds/blame"
+	// AEVerifySignatures checks the commit signatures of a dataset's history
+	AEVerifySignatures APIEndpoint = "/ds/verifysignatures"
 
 	// peer endpoints
 
@@ -124,6 +148,10 @@ const (
 	AEPreview APIEndpoint = "/remote/preview"
 	// AERemoteRemove removes a dataset from a given remote
 	AERemoteRemove APIEndpoint = "/remote/remove"
+	// AERemoteUsage lists storage usage of profiles on a remote
+	AERemoteUsage APIEndpoint = "/remote/usage"
+	// AERemoteSetQuota sets the storage quota of a profile on a remote
+	AERemoteSetQuota APIEndpoint = "/remote/quota"
 	// AERegistryNew creates a new user on the registry
 	AERegistryNew APIEndpoint = "/remote/registry/profile/new"
 	// AERegistryProve links an the current peer with an existing
@@ -136,6 +164,22 @@ const (
 	// AERegistryFollow updates the follow status of the current user for a given dataset
 	AERegistryFollow APIEndpoint = "/registry/follow"
 
+	// maintenance endpoints
+
+	// AEAudit lists audited method calls
+	AEAudit APIEndpoint = "/maintenance/audit"
+
+	// job endpoints
+
+	// AEJobStart runs a method in the background
+	AEJobStart APIEndpoint = "/jobs/start"
+	// AEJobList lists background jobs
+	AEJobList APIEndpoint = "/jobs/list"
+	// AEJobGet fetches a background job
+	AEJobGet APIEndpoint = "/jobs/get"
+	// AEJobCancel stops a background job
+	AEJobCancel APIEndpoint = "/jobs/cancel"
+
 	// sync endpoints
 
 	// AERemoteDSync exposes the dsync mechanics
@@ -144,6 +188,8 @@ const (
 	AERemoteLogSync APIEndpoint = "/remote/logsync"
 	// AERemoteRefs exposes the remote ref resolution mechanics
 	AERemoteRefs APIEndpoint = "/remote/refs"
+	// AERemoteBody streams a range of entries from a dataset body
+	AERemoteBody APIEndpoint = "/remote/dataset/body/"
 
 	// other endpoints
 
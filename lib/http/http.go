@@ -15,6 +15,7 @@ import (
 	manet "github.com/multiformats/go-multiaddr/net"
 	apiutil "github.com/qri-io/qri/api/util"
 	"github.com/qri-io/qri/auth/token"
+	"github.com/qri-io/qri/trace"
 )
 
 const (
@@ -22,6 +23,9 @@ const (
 	JSONMimeType = "application/json"
 	// SourceResolver header name
 	SourceResolver = "SourceResolver"
+	// NextTokenTrailer is the HTTP trailer streamed body responses use to
+	// send the continuation token for the next page of entries
+	NextTokenTrailer = "Next-Token"
 )
 
 var (
@@ -77,6 +81,15 @@ func NewClientWithProtocol(multiaddrStr, protocol string) (*Client, error) {
 	}, nil
 }
 
+// WebsocketURL is the address of the websocket API of the node the client
+// makes calls to
+func (c Client) WebsocketURL() string {
+	if c.Protocol == "https" {
+		return fmt.Sprintf("wss://%s", c.Address)
+	}
+	return fmt.Sprintf("ws://%s", c.Address)
+}
+
 // Call calls API endpoint and passes on parameters, context info
 func (c Client) Call(ctx context.Context, apiEndpoint APIEndpoint, source string, params interface{}, result interface{}) error {
 	return c.CallMethod(ctx, apiEndpoint, http.MethodPost, source, params, result)
@@ -146,6 +159,7 @@ func (c Client) do(ctx context.Context, addr string, httpMethod string, mimeType
 		req.Header.Set(SourceResolver, source)
 	}
 
+	req, _ = trace.AddContextSpanToRequest(ctx, req)
 	req, added := token.AddContextTokenToRequest(ctx, req)
 	if !added {
 		log.Debugw("No token was set on an http client request. Unauthenticated requests may fail", "httpMethod", httpMethod, "addr", addr)
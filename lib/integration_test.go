@@ -2,10 +2,12 @@ package lib
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/ioes"
 	"github.com/qri-io/qri/auth/key"
@@ -168,6 +170,48 @@ dataset.commit(ds)
 	}
 }
 
+func TestRemoteBodyQuery(t *testing.T) {
+	tr := NewNetworkIntegrationTestRunner(t, "integration_remote_body_query")
+	defer tr.Cleanup()
+
+	nasim := tr.InitNasim(t)
+	ref := Commit2WorldBank(tr.Ctx, t, nasim)
+	PushToRegistry(tr.Ctx, t, nasim, ref.Alias())
+
+	hinshun := tr.InitHinshun(t)
+	cfg := hinshun.GetConfig().Copy()
+	cfg.Remotes = &config.Remotes{"reg": tr.RegistryHTTPServer.URL}
+	if err := hinshun.ChangeConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// - hinshun reads a page of rows without pulling the dataset
+	p := &GetParams{Ref: ref.Alias(), Selector: "body", List: params.List{Offset: 1, Limit: 1}}
+	res, cur, err := hinshun.WithSource("reg").Dataset().QueryBody(tr.Ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []interface{}{[]interface{}{"d", "e", "f", false, float64(3)}}
+	if diff := cmp.Diff(expect, res.Value); diff != "" {
+		t.Errorf("body mismatch (-want +got):\n%s", diff)
+	}
+	if cur == nil {
+		t.Fatal("expected a cursor for the remaining rows")
+	}
+	next, err := cur.Next(tr.Ctx)
+	if !errors.Is(err, ErrCursorComplete) {
+		t.Fatalf("expected cursor to complete after the last page, got %v", err)
+	}
+	expect = []interface{}{[]interface{}{"g", "g", "i", true, float64(4)}}
+	if diff := cmp.Diff(expect, next.(*GetResult).Value); diff != "" {
+		t.Errorf("next page mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := hinshun.WithSource("local").Dataset().Get(tr.Ctx, &GetParams{Ref: ref.Alias()}); err == nil {
+		t.Error("expected the dataset not to be pulled by a remote body query")
+	}
+}
+
 type NetworkIntegrationTestRunner struct {
 	Ctx        context.Context
 	prefix     string
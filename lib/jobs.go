@@ -0,0 +1,450 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/qri-io/qri/base/params"
+	qerr "github.com/qri-io/qri/errors"
+	"github.com/qri-io/qri/event"
+	qhttp "github.com/qri-io/qri/lib/http"
+	"github.com/qri-io/qri/profile"
+	"github.com/qri-io/qri/trace"
+)
+
+// ErrJobNotFound indicates a job ID doesn't match a known job
+var ErrJobNotFound = fmt.Errorf("job not found")
+
+const (
+	// maxJobProgress caps the number of progress events kept per job, only the
+	// most recent events are kept
+	maxJobProgress = 100
+	// maxFinishedJobs caps the number of finished jobs kept, the oldest
+	// finished jobs are dropped first
+	maxFinishedJobs = 1000
+)
+
+// jobCancelTimeout bounds how long canceling a job waits for the job to stop.
+// jobs that don't stop in time are reported as still running
+var jobCancelTimeout = 5 * time.Second
+
+// jobProgressEvents are the event types recorded as job progress
+var jobProgressEvents = []event.Type{
+	event.ETDatasetSaveProgress,
+	event.ETRemoteClientPushVersionProgress,
+	event.ETRemoteClientPullVersionProgress,
+}
+
+// JobStatus is the state of a job
+type JobStatus string
+
+const (
+	// JobStatusRunning indicates a job is in progress
+	JobStatusRunning = JobStatus("running")
+	// JobStatusSucceeded indicates a job finished without error
+	JobStatusSucceeded = JobStatus("succeeded")
+	// JobStatusFailed indicates a job finished with an error
+	JobStatusFailed = JobStatus("failed")
+	// JobStatusCanceled indicates a job was canceled before finishing
+	JobStatusCanceled = JobStatus("canceled")
+)
+
+// Finished returns true if the status is final
+func (s JobStatus) Finished() bool {
+	return s != JobStatusRunning
+}
+
+// JobProgress is a progress event published while a job runs
+type JobProgress struct {
+	Type      event.Type  `json:"type"`
+	Timestamp int64       `json:"timestamp"`
+	Payload   interface{} `json:"payload"`
+}
+
+// Job is a method call running in the background
+type Job struct {
+	ID        string    `json:"id"`
+	ProfileID string    `json:"profileID"`
+	Method    string    `json:"method"`
+	Status    JobStatus `json:"status"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished,omitempty"`
+	// Progress holds the most recent progress events published by the job
+	Progress []JobProgress `json:"progress,omitempty"`
+	// Result is the method result, set when the job succeeds
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// JobMethods encapsulates business logic for running lib methods in the
+// background
+type JobMethods struct {
+	d dispatcher
+}
+
+// Name returns the name of this method group
+func (m JobMethods) Name() string {
+	return "job"
+}
+
+// Attributes defines attributes for each method
+func (m JobMethods) Attributes() map[string]AttributeSet {
+	return map[string]AttributeSet{
+		"start":  {Endpoint: qhttp.AEJobStart, HTTPVerb: "POST"},
+		"list":   {Endpoint: qhttp.AEJobList, HTTPVerb: "POST"},
+		"get":    {Endpoint: qhttp.AEJobGet, HTTPVerb: "POST"},
+		"cancel": {Endpoint: qhttp.AEJobCancel, HTTPVerb: "POST"},
+	}
+}
+
+// StartJobParams are input parameters for Job().Start
+type StartJobParams struct {
+	// Method is the name of the method to run, eg: "dataset.save". The method
+	// must support running asynchronously
+	Method string `json:"method"`
+	// Params are the JSON-encoded input parameters to the method
+	Params json.RawMessage `json:"params"`
+	// input is an already-decoded input parameter for the method, used in
+	// place of Params when set. input isn't serialized, it's only set by
+	// callers in this package
+	input interface{}
+}
+
+// Validate checks StartJobParams are valid
+func (p *StartJobParams) Validate() error {
+	if p.Method == "" {
+		return qerr.New(ErrBadArgs, "method is required")
+	}
+	return nil
+}
+
+// Start runs a method in the background, returning immediately with a job
+// that can be polled for progress & results
+func (m JobMethods) Start(ctx context.Context, p *StartJobParams) (*Job, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "start"), p)
+	if res, ok := got.(*Job); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// ListJobsParams are input parameters for Job().List
+type ListJobsParams struct {
+	params.List
+	// Status only lists jobs with this status
+	Status JobStatus `json:"status,omitempty"`
+}
+
+// List shows jobs started by the caller, newest first. The repo owner can see
+// all jobs
+func (m JobMethods) List(ctx context.Context, p *ListJobsParams) ([]*Job, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "list"), p)
+	if res, ok := got.([]*Job); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// JobParams identify a single job
+type JobParams struct {
+	ID string `json:"id"`
+}
+
+// Validate checks JobParams are valid
+func (p *JobParams) Validate() error {
+	if p.ID == "" {
+		return qerr.New(ErrBadArgs, "id is required")
+	}
+	return nil
+}
+
+// Get fetches a job
+func (m JobMethods) Get(ctx context.Context, p *JobParams) (*Job, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "get"), p)
+	if res, ok := got.(*Job); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// Cancel stops a running job. Canceling a finished job has no effect. Cancel
+// waits a short time for the job to stop, a job that's still winding down is
+// returned with a running status
+func (m JobMethods) Cancel(ctx context.Context, p *JobParams) (*Job, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "cancel"), p)
+	if res, ok := got.(*Job); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// jobImpl holds the method implementations for JobMethods
+type jobImpl struct{}
+
+// Start runs a method in the background
+func (jobImpl) Start(scope scope, p *StartJobParams) (*Job, error) {
+	c, ok := scope.inst.regMethods.lookup(p.Method)
+	if !ok {
+		return nil, qerr.New(ErrBadArgs, fmt.Sprintf("method %q not found", p.Method))
+	}
+	if !c.Async {
+		return nil, qerr.New(ErrBadArgs, fmt.Sprintf("method %q can't run asynchronously", p.Method))
+	}
+
+	param := scope.inst.NewInputParam(p.Method)
+	if p.input != nil {
+		if reflect.TypeOf(p.input) != reflect.TypeOf(param) {
+			return nil, qerr.New(ErrBadArgs, fmt.Sprintf("invalid params for method %q", p.Method))
+		}
+		param = p.input
+	} else if len(p.Params) > 0 {
+		if err := json.Unmarshal(p.Params, param); err != nil {
+			return nil, qerr.New(ErrBadArgs, fmt.Sprintf("decoding %s params: %s", p.Method, err))
+		}
+	}
+	if defSetter, ok := param.(NZDefaultSetter); ok {
+		defSetter.SetNonZeroDefaults()
+	}
+	// validate before starting to fail bad calls immediately
+	if validator, ok := param.(ParamValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return scope.Jobs().start(scope, p.Method, param)
+}
+
+// List shows jobs, newest first
+func (jobImpl) List(scope scope, p *ListJobsParams) ([]*Job, error) {
+	if err := p.List.Validate(); err != nil {
+		return nil, qerr.New(ErrBadArgs, err.Error())
+	}
+	return scope.Jobs().list(scope.ActiveProfile(), callerIsOwner(scope), p), nil
+}
+
+// Get fetches a job
+func (jobImpl) Get(scope scope, p *JobParams) (*Job, error) {
+	return scope.Jobs().get(scope.ActiveProfile(), callerIsOwner(scope), p.ID, false)
+}
+
+// Cancel stops a running job
+func (jobImpl) Cancel(scope scope, p *JobParams) (*Job, error) {
+	return scope.Jobs().get(scope.ActiveProfile(), callerIsOwner(scope), p.ID, true)
+}
+
+// callerIsOwner returns true if the active profile owns the repo
+func callerIsOwner(scope scope) bool {
+	return scope.ActiveProfile().ID == scope.Profiles().Owner(scope.Context()).ID
+}
+
+// jobCtxKey is a private type for storing a job ID in a context.Context
+type jobCtxKey struct{}
+
+// jobIDFromCtx returns the ID of the job a context belongs to, if any
+func jobIDFromCtx(ctx context.Context) string {
+	id, _ := ctx.Value(jobCtxKey{}).(string)
+	return id
+}
+
+// jobManager runs & tracks jobs. jobManager is safe for concurrent use
+type jobManager struct {
+	inst *Instance
+
+	mu   sync.Mutex
+	jobs map[string]*runningJob
+}
+
+type runningJob struct {
+	job    Job
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newJobManager(inst *Instance, bus event.Bus) *jobManager {
+	jm := &jobManager{
+		inst: inst,
+		jobs: map[string]*runningJob{},
+	}
+	if bus != nil {
+		bus.SubscribeTypes(jm.handleProgress, jobProgressEvents...)
+	}
+	return jm
+}
+
+// start runs method in the background. Jobs outlive the call that starts
+// them, running until the instance context is canceled
+func (jm *jobManager) start(scope scope, method string, param interface{}) (*Job, error) {
+	ctx, cancel := context.WithCancel(jm.inst.appCtx)
+	ctx = profile.AddIDToContext(ctx, scope.ActiveProfile().ID.Encode())
+	if sc, ok := trace.FromCtx(scope.Context()); ok {
+		ctx = trace.AddToContext(ctx, sc)
+	}
+
+	rj := &runningJob{
+		job: Job{
+			ID:        uuid.New().String(),
+			ProfileID: scope.ActiveProfile().ID.Encode(),
+			Method:    method,
+			Status:    JobStatusRunning,
+			Started:   time.Now(),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	ctx = context.WithValue(ctx, jobCtxKey{}, rj.job.ID)
+
+	jm.mu.Lock()
+	jm.jobs[rj.job.ID] = rj
+	jm.prune()
+	job := rj.job
+	jm.mu.Unlock()
+
+	call := &DispatchCall{Method: method, Param: param, Source: scope.source}
+	go func() {
+		defer close(rj.done)
+		defer cancel()
+		res, _, err := jm.inst.dispatchCall(ctx, call)
+
+		jm.mu.Lock()
+		defer jm.mu.Unlock()
+		rj.job.Finished = time.Now()
+		switch {
+		case err == nil:
+			rj.job.Status = JobStatusSucceeded
+			rj.job.Result = res
+		case ctx.Err() == context.Canceled && jm.inst.appCtx.Err() == nil:
+			rj.job.Status = JobStatusCanceled
+			rj.job.Error = err.Error()
+		default:
+			rj.job.Status = JobStatusFailed
+			rj.job.Error = err.Error()
+		}
+		log.Debugw("job finished", "id", rj.job.ID, "method", method, "status", rj.job.Status)
+	}()
+
+	return &job, nil
+}
+
+// list returns a snapshot of jobs visible to pro, newest first
+func (jm *jobManager) list(pro *profile.Profile, all bool, p *ListJobsParams) []*Job {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	jobs := []*Job{}
+	for _, rj := range jm.jobs {
+		if !all && rj.job.ProfileID != pro.ID.Encode() {
+			continue
+		}
+		if p.Status != "" && rj.job.Status != p.Status {
+			continue
+		}
+		jobs = append(jobs, rj.snapshot())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Started.After(jobs[j].Started)
+	})
+
+	if p.Offset >= len(jobs) {
+		return []*Job{}
+	}
+	jobs = jobs[p.Offset:]
+	if p.Limit > 0 && p.Limit < len(jobs) {
+		jobs = jobs[:p.Limit]
+	}
+	return jobs
+}
+
+// get fetches a job visible to pro, optionally canceling it. canceling waits
+// up to jobCancelTimeout for the job to stop
+func (jm *jobManager) get(pro *profile.Profile, all bool, id string, cancel bool) (*Job, error) {
+	jm.mu.Lock()
+	rj, ok := jm.jobs[id]
+	if !ok || (!all && rj.job.ProfileID != pro.ID.Encode()) {
+		jm.mu.Unlock()
+		return nil, ErrJobNotFound
+	}
+	if !cancel || rj.job.Status.Finished() {
+		defer jm.mu.Unlock()
+		return rj.snapshot(), nil
+	}
+	jm.mu.Unlock()
+
+	rj.cancel()
+	t := time.NewTimer(jobCancelTimeout)
+	defer t.Stop()
+	select {
+	case <-rj.done:
+	case <-t.C:
+		log.Debugw("job didn't stop before the cancel timeout", "id", id)
+	}
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	return rj.snapshot(), nil
+}
+
+// wait blocks until a job finishes
+func (jm *jobManager) wait(id string) {
+	jm.mu.Lock()
+	rj, ok := jm.jobs[id]
+	jm.mu.Unlock()
+	if ok {
+		<-rj.done
+	}
+}
+
+// handleProgress records progress events published from within a job
+func (jm *jobManager) handleProgress(ctx context.Context, e event.Event) error {
+	id := jobIDFromCtx(ctx)
+	if id == "" {
+		return nil
+	}
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	if rj, ok := jm.jobs[id]; ok {
+		rj.job.Progress = append(rj.job.Progress, JobProgress{
+			Type:      e.Type,
+			Timestamp: e.Timestamp,
+			Payload:   e.Payload,
+		})
+		if len(rj.job.Progress) > maxJobProgress {
+			rj.job.Progress = rj.job.Progress[len(rj.job.Progress)-maxJobProgress:]
+		}
+	}
+	return nil
+}
+
+// prune drops the oldest finished jobs beyond maxFinishedJobs. callers must
+// hold the lock
+func (jm *jobManager) prune() {
+	finished := []*runningJob{}
+	for _, rj := range jm.jobs {
+		if rj.job.Status.Finished() {
+			finished = append(finished, rj)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].job.Finished.Before(finished[j].job.Finished)
+	})
+	for _, rj := range finished[:len(finished)-maxFinishedJobs] {
+		delete(jm.jobs, rj.job.ID)
+	}
+}
+
+// snapshot copies the job. callers must hold the lock
+func (rj *runningJob) snapshot() *Job {
+	job := rj.job
+	job.Progress = append([]JobProgress(nil), rj.job.Progress...)
+	return &job
+}
@@ -0,0 +1,205 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qri-io/qri/event"
+)
+
+func TestJobs(t *testing.T) {
+	tr := newTestRunner(t)
+	defer tr.Delete()
+	ctx := tr.Ctx
+
+	params, err := json.Marshal(&SaveParams{
+		Ref:      "me/cities_ds",
+		BodyPath: "testdata/cities_2/body.csv",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := tr.Instance.Job().Start(ctx, &StartJobParams{Method: "dataset.save", Params: params})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID == "" || job.Status != JobStatusRunning {
+		t.Errorf("expected a running job, got %#v", job)
+	}
+
+	tr.Instance.jobs.wait(job.ID)
+	job, err = tr.Instance.Job().Get(ctx, &JobParams{ID: job.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobStatusSucceeded {
+		t.Fatalf("expected job to succeed, got status %q error %q", job.Status, job.Error)
+	}
+	if job.Result == nil {
+		t.Error("expected job result")
+	}
+	if len(job.Progress) == 0 || job.Progress[0].Type != event.ETDatasetSaveProgress {
+		t.Errorf("expected save progress, got %v", job.Progress)
+	}
+	tr.MustGet(t, "me/cities_ds")
+
+	jobs, err := tr.Instance.Job().List(ctx, &ListJobsParams{Status: JobStatusSucceeded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Errorf("expected list to contain job %q, got %v", job.ID, jobs)
+	}
+
+	// canceling a finished job has no effect
+	if job, err = tr.Instance.Job().Cancel(ctx, &JobParams{ID: job.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobStatusSucceeded {
+		t.Errorf("expected canceled finished job to keep status %q, got %q", JobStatusSucceeded, job.Status)
+	}
+
+	if _, err := tr.Instance.Job().Get(ctx, &JobParams{ID: "nope"}); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound, got %v", err)
+	}
+	if _, err := tr.Instance.Job().Start(ctx, &StartJobParams{Method: "dataset.get"}); !errors.Is(err, ErrBadArgs) {
+		t.Errorf("expected starting a synchronous method to fail with ErrBadArgs, got %v", err)
+	}
+	if _, err := tr.Instance.Job().Start(ctx, &StartJobParams{Method: "dataset.save", Params: []byte(`{"ref":5}`)}); !errors.Is(err, ErrBadArgs) {
+		t.Errorf("expected starting a job with undecodable params to fail with ErrBadArgs, got %v", err)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	ctx := context.Background()
+	inst, cleanup := NewMemTestInstance(ctx, t)
+	defer cleanup()
+
+	reg := make(map[string]callable)
+	inst.registerOne("sloth", &slothMethods{d: inst}, slothImpl{}, reg)
+	inst.registerOne("job", inst.Job(), jobImpl{}, reg)
+	inst.regMethods = &regMethodSet{reg: reg}
+
+	job, err := inst.Job().Start(ctx, &StartJobParams{Method: "sloth.nap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, err = inst.Job().Cancel(ctx, &JobParams{ID: job.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobStatusCanceled {
+		t.Errorf("expected status %q, got %q", JobStatusCanceled, job.Status)
+	}
+}
+
+func TestCancelJobTimeout(t *testing.T) {
+	ctx := context.Background()
+	inst, cleanup := NewMemTestInstance(ctx, t)
+	defer cleanup()
+
+	prevTimeout := jobCancelTimeout
+	jobCancelTimeout = 10 * time.Millisecond
+	defer func() { jobCancelTimeout = prevTimeout }()
+
+	reg := make(map[string]callable)
+	inst.registerOne("sloth", &slothMethods{d: inst}, slothImpl{}, reg)
+	inst.registerOne("job", inst.Job(), jobImpl{}, reg)
+	inst.regMethods = &regMethodSet{reg: reg}
+
+	wake := make(chan struct{})
+	job, err := inst.Job().Start(ctx, &StartJobParams{Method: "sloth.doze", input: &slothParams{wake: wake}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, err = inst.Job().Cancel(ctx, &JobParams{ID: job.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobStatusRunning {
+		t.Errorf("expected a job ignoring cancelation to still be running, got %q", job.Status)
+	}
+
+	close(wake)
+	inst.jobs.wait(job.ID)
+	if job, err = inst.Job().Get(ctx, &JobParams{ID: job.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobStatusCanceled {
+		t.Errorf("expected status %q, got %q", JobStatusCanceled, job.Status)
+	}
+}
+
+func TestAsyncHTTPRequest(t *testing.T) {
+	ctx := context.Background()
+	inst, cleanup := NewMemTestInstance(ctx, t)
+	defer cleanup()
+
+	reg := make(map[string]callable)
+	inst.registerOne("sloth", &slothMethods{d: inst}, slothImpl{}, reg)
+	inst.registerOne("job", inst.Job(), jobImpl{}, reg)
+	inst.regMethods = &regMethodSet{reg: reg}
+
+	handler := NewHTTPRequestHandler(inst, "sloth.nap")
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/nap?async=true", strings.NewReader(`{}`)))
+
+	res := struct{ Data *Job }{}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Data == nil || res.Data.Method != "sloth.nap" || res.Data.Status != JobStatusRunning {
+		t.Fatalf("expected running job in response, got %#v", res.Data)
+	}
+	if _, err := inst.Job().Cancel(ctx, &JobParams{ID: res.Data.ID}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sloth methods block until canceled
+type slothMethods struct {
+	d dispatcher
+}
+
+func (m *slothMethods) Name() string {
+	return "sloth"
+}
+
+func (m *slothMethods) Attributes() map[string]AttributeSet {
+	return map[string]AttributeSet{
+		"nap":  {Endpoint: "/nap", HTTPVerb: "POST", Async: true},
+		"doze": {Endpoint: "/doze", HTTPVerb: "POST", Async: true},
+	}
+}
+
+type slothParams struct {
+	// wake is closed to end a doze
+	wake chan struct{}
+}
+
+func (m *slothMethods) Nap(ctx context.Context, p *slothParams) error {
+	_, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "nap"), p)
+	return err
+}
+
+type slothImpl struct{}
+
+func (slothImpl) Nap(scp scope, p *slothParams) error {
+	<-scp.Context().Done()
+	return scp.Context().Err()
+}
+
+func (m *slothMethods) Doze(ctx context.Context, p *slothParams) error {
+	_, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "doze"), p)
+	return err
+}
+
+// Doze ignores cancelation until woken
+func (slothImpl) Doze(scp scope, p *slothParams) error {
+	<-p.wake
+	return scp.Context().Err()
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/qri-io/qfs"
 	"github.com/qri-io/qfs/muxfs"
 	"github.com/qri-io/qfs/qipfs"
+	"github.com/qri-io/qri/audit"
 	"github.com/qri-io/qri/auth/key"
 	"github.com/qri-io/qri/auth/token"
 	"github.com/qri-io/qri/automation"
@@ -30,6 +31,7 @@ import (
 	"github.com/qri-io/qri/base"
 	"github.com/qri-io/qri/base/dsfs"
 	"github.com/qri-io/qri/base/hiddenfile"
+	"github.com/qri-io/qri/base/params"
 	"github.com/qri-io/qri/collection"
 	"github.com/qri-io/qri/config"
 	"github.com/qri-io/qri/config/migrate"
@@ -45,7 +47,10 @@ import (
 	"github.com/qri-io/qri/remote"
 	"github.com/qri-io/qri/repo"
 	"github.com/qri-io/qri/repo/buildrepo"
+	sqliterepo "github.com/qri-io/qri/repo/sqlite"
 	"github.com/qri-io/qri/stats"
+	"github.com/qri-io/qri/transform/stepcache"
+	"github.com/qri-io/qri/transform/tfstate"
 )
 
 var (
@@ -98,6 +103,8 @@ type InstanceOptions struct {
 
 	eventHandler event.Handler
 	events       []event.Type
+
+	dispatchMiddleware []DispatchMiddleware
 }
 
 // Option is a function that manipulates config details when fed to New(). Fields on
@@ -426,7 +433,7 @@ func NewInstance(ctx context.Context, repoPath string, opts ...Option) (qri *Ins
 
 	// If configuration does not have a path assigned, but the repo has a path and
 	// is stored on the filesystem, add that path to the configuration.
-	if cfg.Repo.Type == "fs" && cfg.Path() == "" {
+	if (cfg.Repo.Type == "fs" || cfg.Repo.Type == "sqlite") && cfg.Path() == "" {
 		cfg.SetPath(filepath.Join(repoPath, "config.yaml"))
 	}
 
@@ -470,6 +477,7 @@ func NewInstance(ctx context.Context, repoPath string, opts ...Option) (qri *Ins
 	}
 
 	inst.RegisterMethods()
+	inst.useDispatchMiddleware(o.dispatchMiddleware...)
 
 	if cfg.API != nil && cfg.API.Enabled {
 		// check if we're operating over RPC by dialing API.Address to check for a connection
@@ -496,6 +504,8 @@ func NewInstance(ctx context.Context, repoPath string, opts ...Option) (qri *Ins
 	if o.eventHandler != nil && o.events != nil {
 		inst.bus.SubscribeTypes(o.eventHandler, o.events...)
 	}
+	inst.jobs = newJobManager(inst, inst.bus)
+	inst.runEvents = newRunEvents(inst.bus)
 
 	if inst.qfs == nil {
 		inst.qfs, err = buildrepo.NewFilesystem(ctx, cfg)
@@ -533,11 +543,22 @@ func NewInstance(ctx context.Context, repoPath string, opts ...Option) (qri *Ins
 
 	pro := inst.profiles.Owner(ctx)
 
-	if inst.logbook == nil {
+	// sqlite repos keep the logbook in the repo database, buildrepo creates it
+	if inst.logbook == nil && cfg.Repo.Type != "sqlite" {
 		inst.logbook, err = newLogbook(inst.qfs, cfg, inst.bus, pro, inst.repoPath)
 		if err != nil {
 			return nil, fmt.Errorf("intializing logbook: %w", err)
 		}
+
+		book := inst.logbook
+		inst.releasers.Add(1)
+		go func() {
+			<-ctx.Done()
+			if err := book.Close(); err != nil {
+				log.Debugw("closing logbook", "err", err)
+			}
+			inst.releasers.Done()
+		}()
 	}
 
 	if inst.registry == nil {
@@ -565,6 +586,19 @@ func NewInstance(ctx context.Context, repoPath string, opts ...Option) (qri *Ins
 			return nil, fmt.Errorf("newRepo: %w", err)
 		}
 	}
+	if inst.logbook == nil {
+		inst.logbook = inst.repo.Logbook()
+	}
+	// merged logs are checked against the known keys of their authors
+	if inst.logbook != nil {
+		policy := base.SignaturePolicyWarn
+		if cfg.P2P != nil {
+			if policy, err = base.ParseSignaturePolicy(cfg.P2P.SignaturePolicy); err != nil {
+				return nil, err
+			}
+		}
+		inst.logbook.SetAuthorKeys(inst.profiles, policy == base.SignaturePolicyReject)
+	}
 
 	if inst.compStat == nil {
 		inst.compStat = base.NewComponentStatus(ctx, inst.qfs)
@@ -633,9 +667,7 @@ func NewInstance(ctx context.Context, repoPath string, opts ...Option) (qri *Ins
 	}
 
 	if o.collectionSet == nil && inst.repo != nil {
-		set, err := collection.NewLocalSet(ctx, repoPath, func(o *collection.LocalSetOptions) {
-			o.MigrateRepo = inst.repo
-		})
+		set, err := newCollectionSet(ctx, repoPath, inst.repo)
 		if err != nil {
 			return nil, err
 		}
@@ -657,6 +689,10 @@ func NewInstance(ctx context.Context, repoPath string, opts ...Option) (qri *Ins
 		if err != nil {
 			return nil, err
 		}
+		if sr, ok := inst.repo.(*sqliterepo.Repo); ok {
+			orchestratorOpts.WorkflowStore = sr.DB().WorkflowStore()
+			orchestratorOpts.RunStore = sr.DB().RunStore()
+		}
 		o.automationOptions = &orchestratorOpts
 	}
 	inst.automation, err = automation.NewOrchestrator(ctx, inst.bus, &runner{owner: inst}, *o.automationOptions)
@@ -664,6 +700,21 @@ func NewInstance(ctx context.Context, repoPath string, opts ...Option) (qri *Ins
 		return nil, err
 	}
 
+	if inst.stepCache, err = newStepCache(cfg, inst.repoPath); err != nil {
+		return nil, err
+	}
+	if inst.tfState, err = newTransformState(cfg, inst.repoPath); err != nil {
+		return nil, err
+	}
+	if inst.audit, err = newAuditStore(cfg, inst.repoPath); err != nil {
+		return nil, err
+	}
+	if inst.repo != nil {
+		if inst.lineage, err = newLineageIndex(ctx, cfg, inst.repo, inst.repoPath); err != nil {
+			return nil, err
+		}
+	}
+
 	go inst.waitForAllDone()
 	go func() {
 		if err := inst.bus.Publish(ctx, event.ETInstanceConstructed, nil); err != nil {
@@ -704,6 +755,9 @@ func newRegClient(ctx context.Context, cfg *config.Config) (rc *regclient.Client
 
 func newLogbook(fs qfs.Filesystem, cfg *config.Config, bus event.Bus, pro *profile.Profile, repoPath string) (book *logbook.Book, err error) {
 	logbookPath := filepath.Join(repoPath, "logbook.qfb")
+	if cfg.Repo != nil && cfg.Repo.Logstore == "segments" {
+		return logbook.NewSegmentJournal(*pro, bus, fs, logbookPath, filepath.Join(repoPath, "logbook"))
+	}
 	return logbook.NewJournal(*pro, bus, fs, logbookPath)
 }
 
@@ -716,6 +770,56 @@ func newEventBus(ctx context.Context) event.Bus {
 	return event.NewBus(ctx)
 }
 
+// newCollectionSet creates the collection set for a repo. sqlite repos store
+// collections in the repo database, creating the owner's collection from the
+// repo if it doesn't exist
+func newCollectionSet(ctx context.Context, repoPath string, r repo.Repo) (collection.Set, error) {
+	sr, ok := r.(*sqliterepo.Repo)
+	if !ok {
+		return collection.NewLocalSet(ctx, repoPath, func(o *collection.LocalSetOptions) {
+			o.MigrateRepo = r
+		})
+	}
+
+	set := sr.DB().CollectionSet()
+	ownerID := r.Profiles().Owner(ctx).ID
+	if _, err := set.List(ctx, ownerID, params.List{Limit: 1}); errors.Is(err, collection.ErrNotFound) {
+		if err := collection.MigrateRepoStoreToLocalCollectionSet(ctx, set, r); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// newStepCache creates a transform step cache, stored in repoPath/stepcache
+// for repos on the filesystem
+func newStepCache(cfg *config.Config, repoPath string) (stepcache.Store, error) {
+	if cfg.Repo == nil || cfg.Repo.Type == "mem" {
+		return stepcache.NewMemStore(), nil
+	}
+	return stepcache.NewFileStore(filepath.Join(repoPath, "stepcache"))
+}
+
+// newTransformState creates a store for state transforms persist between
+// runs, stored in repoPath/transform_state.json for repos on the filesystem
+func newTransformState(cfg *config.Config, repoPath string) (tfstate.Store, error) {
+	if cfg.Repo == nil || cfg.Repo.Type == "mem" {
+		return tfstate.NewMemStore(), nil
+	}
+	return tfstate.NewFileStore(repoPath)
+}
+
+// newLineageIndex creates an index of the datasets transforms build from each
+// other, stored in repoPath/lineage.json for repos on the filesystem
+func newLineageIndex(ctx context.Context, cfg *config.Config, r repo.Repo, repoPath string) (*base.LineageIndex, error) {
+	if cfg.Repo == nil || cfg.Repo.Type == "mem" {
+		return base.NewLineageIndex(ctx, r, "")
+	}
+	return base.NewLineageIndex(ctx, r, filepath.Join(repoPath, base.DefaultLineageIndexFilename))
+}
+
 func newStats(cfg *config.Config, repoPath string) (*stats.Service, error) {
 	// The stats cache default location is repoPath/stats
 	// can be overridden in the config: cfg.Stats.Path
@@ -782,9 +886,12 @@ func NewInstanceFromConfigAndNodeAndBusAndOrchestratorOpts(ctx context.Context,
 		dscache:  dc,
 		logbook:  r.Logbook(),
 		profiles: r.Profiles(),
+		tfState:  tfstate.NewMemStore(),
+		audit:    audit.NewMemStore(),
 		appCtx:   ctx,
 	}
 	inst.RegisterMethods()
+	inst.useDispatchMiddleware()
 
 	inst.stats = stats.New(nil)
 
@@ -793,6 +900,8 @@ func NewInstanceFromConfigAndNodeAndBusAndOrchestratorOpts(ctx context.Context,
 		inst.bus = bus
 		inst.qfs = r.Filesystem()
 	}
+	inst.jobs = newJobManager(inst, bus)
+	inst.runEvents = newRunEvents(bus)
 
 	var err error
 	// TODO(ramfox): using `DefaultOrchestratorOptions` func for now to generate
@@ -819,6 +928,13 @@ func NewInstanceFromConfigAndNodeAndBusAndOrchestratorOpts(ctx context.Context,
 		panic(err)
 	}
 
+	if inst.repo != nil {
+		if inst.lineage, err = base.NewLineageIndex(ctx, inst.repo, ""); err != nil {
+			cancel()
+			panic(err)
+		}
+	}
+
 	set, err := collection.NewLocalSet(ctx, "", func(o *collection.LocalSetOptions) {
 		o.MigrateRepo = inst.repo
 	})
@@ -853,6 +969,12 @@ type Instance struct {
 	cfg      *config.Config
 
 	regMethods *regMethodSet
+	dispatch   DispatchFunc
+	metrics    *dispatchMetrics
+	audit      audit.Store
+	lineage    *base.LineageIndex
+	jobs       *jobManager
+	runEvents  *runEvents
 
 	streams       ioes.IOStreams
 	repo          repo.Repo
@@ -866,6 +988,8 @@ type Instance struct {
 	dscache       *dscache.Dscache
 	collections   *collection.SetMaintainer
 	automation    *automation.Orchestrator
+	stepCache     stepcache.Store
+	tfState       tfstate.Store
 	compStat      *base.ComponentStatus
 	tokenProvider token.Provider
 	bus           event.Bus
@@ -997,6 +1121,11 @@ func (inst *Instance) Log() LogMethods {
 	return LogMethods{d: inst}
 }
 
+// Maintenance returns the MaintenanceMethods that Instance has registered
+func (inst *Instance) Maintenance() MaintenanceMethods {
+	return MaintenanceMethods{d: inst}
+}
+
 // Peer returns the PeerMethods that Instance has registered
 func (inst *Instance) Peer() PeerMethods {
 	return PeerMethods{d: inst}
@@ -1017,6 +1146,11 @@ func (inst *Instance) Follow() FollowMethods {
 	return FollowMethods{d: inst}
 }
 
+// Job returns the JobMethods that Instance has registered
+func (inst *Instance) Job() JobMethods {
+	return JobMethods{d: inst}
+}
+
 // Remote returns the RemoteMethods that Instance has registered
 func (inst *Instance) Remote() RemoteMethods {
 	return RemoteMethods{d: inst}
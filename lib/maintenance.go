@@ -0,0 +1,256 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/qri-io/qri/audit"
+	"github.com/qri-io/qri/base"
+	"github.com/qri-io/qri/base/params"
+	qerr "github.com/qri-io/qri/errors"
+	qhttp "github.com/qri-io/qri/lib/http"
+	"github.com/qri-io/qri/repo/backup"
+	"github.com/qri-io/qri/transform/stepcache"
+)
+
+// MaintenanceMethods encapsulates business logic for maintaining the qri
+// repository as a whole, rather than individual datasets
+type MaintenanceMethods struct {
+	d dispatcher
+}
+
+// Name returns the name of this method group
+func (m MaintenanceMethods) Name() string {
+	return "maintenance"
+}
+
+// Attributes defines attributes for each method
+func (m MaintenanceMethods) Attributes() map[string]AttributeSet {
+	return map[string]AttributeSet{
+		// gc deletes data from the repo, doctor can rewrite repo stores & backup
+		// writes repo secrets to a local file, they're only available to local
+		// callers
+		"gc":     {Endpoint: qhttp.DenyHTTP},
+		"doctor": {Endpoint: qhttp.DenyHTTP},
+		"backup": {Endpoint: qhttp.DenyHTTP},
+		"audit":  {Endpoint: qhttp.AEAudit, HTTPVerb: "POST"},
+	}
+}
+
+// GCParams are input parameters for Maintenance().GC
+type GCParams struct {
+	// DryRun reports what garbage collection would remove without removing it
+	DryRun bool `json:"dryRun"`
+}
+
+// GCResult is an alias for the result of a garbage collection pass
+type GCResult = base.GCResult
+
+// GC reconciles the repo's block storage against the set of dataset versions
+// referenced by logbook, refstore and dscache, unpinning & removing all other
+// data. Progress events are published on the instance bus
+func (m MaintenanceMethods) GC(ctx context.Context, p *GCParams) (*GCResult, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "gc"), p)
+	if res, ok := got.(*GCResult); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// DoctorParams are input parameters for Maintenance().Doctor
+type DoctorParams struct {
+	// Fix rebuilds stores that disagree with the logbook
+	Fix bool `json:"fix"`
+}
+
+// DoctorResult is the result of checking repo consistency
+type DoctorResult struct {
+	*base.DoctorReport
+	// Fixed is true if stores were rebuilt from the logbook
+	Fixed bool `json:"fixed"`
+	// Remaining lists discrepancies left after fixing. Missing blocks can't be
+	// fixed
+	Remaining []base.Discrepancy `json:"remaining,omitempty"`
+}
+
+// Doctor cross-checks the refstore, dscache & collection against the logbook
+// and checks every referenced dataset version is stored locally, reporting
+// discrepancies. With Fix set, stores that disagree are rebuilt using the
+// logbook as the source of truth
+func (m MaintenanceMethods) Doctor(ctx context.Context, p *DoctorParams) (*DoctorResult, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "doctor"), p)
+	if res, ok := got.(*DoctorResult); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// BackupParams are input parameters for Maintenance().Backup
+type BackupParams struct {
+	// File is the path to write the archive to. backups can't be requested
+	// over HTTP, File is always chosen by a local caller
+	File string `json:"file"`
+	// Keys sets how private keys are stored, one of "include", "exclude" or
+	// "encrypt". defaults to "exclude"
+	Keys string `json:"keys"`
+	// Passphrase encrypts keys when Keys is "encrypt"
+	Passphrase string `json:"passphrase"`
+	// LatestOnly stores only the latest version of each dataset
+	LatestOnly bool `json:"latestOnly"`
+	// Base is the path to a previous archive. When set only blocks the base
+	// archive chain doesn't already hold are written
+	Base string `json:"base"`
+}
+
+// Validate checks BackupParams are valid
+func (p *BackupParams) Validate() error {
+	if p.File == "" {
+		return qerr.New(ErrBadArgs, "file is required")
+	}
+	if p.Keys != "" {
+		if err := backup.KeyMode(p.Keys).Validate(); err != nil {
+			return qerr.New(ErrBadArgs, err.Error())
+		}
+	}
+	return nil
+}
+
+// BackupResult describes a written backup archive
+type BackupResult struct {
+	File string `json:"file"`
+	*backup.Manifest
+}
+
+// Backup writes an archive of the repo holding the logbook, config, keys,
+// collections, workflows, run history & the blocks of every referenced
+// dataset version. The archive includes a manifest of checksums for every
+// file it stores
+func (m MaintenanceMethods) Backup(ctx context.Context, p *BackupParams) (*BackupResult, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "backup"), p)
+	if res, ok := got.(*BackupResult); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// AuditParams are input parameters for Maintenance().Audit. Zero-valued
+// filters match all entries
+type AuditParams struct {
+	params.List
+	// ProfileID only lists calls made by this profile
+	ProfileID string `json:"profileID,omitempty"`
+	// Method only lists calls to this method, eg: "dataset.get"
+	Method string `json:"method,omitempty"`
+	// Ref only lists calls made with this dataset reference
+	Ref string `json:"ref,omitempty"`
+	// Since excludes calls made before this time
+	Since time.Time `json:"since,omitempty"`
+	// Failed only lists calls that returned an error
+	Failed bool `json:"failed,omitempty"`
+}
+
+// SetNonZeroDefaults sets a default limit & offset
+func (p *AuditParams) SetNonZeroDefaults() {
+	if p.Offset < 0 {
+		p.Offset = 0
+	}
+	if p.Limit == 0 {
+		p.Limit = params.DefaultListLimit
+	}
+}
+
+// Audit lists method calls this instance has executed, newest first. Each
+// entry records the caller, method, dataset reference, duration & error of a
+// call. Only the repo owner can list calls made by other profiles
+func (m MaintenanceMethods) Audit(ctx context.Context, p *AuditParams) ([]audit.Entry, Cursor, error) {
+	got, cur, err := m.d.Dispatch(ctx, dispatchMethodName(m, "audit"), p)
+	if res, ok := got.([]audit.Entry); ok {
+		return res, cur, err
+	}
+	return nil, nil, dispatchReturnError(got, err)
+}
+
+// maintenanceImpl holds the method implementations for MaintenanceMethods
+type maintenanceImpl struct{}
+
+// GC reconciles the repo's block storage against referenced dataset versions
+func (maintenanceImpl) GC(scope scope, p *GCParams) (*GCResult, error) {
+	ctx := scope.Context()
+	live, err := base.LiveDatasetPaths(ctx, scope.Repo(), scope.Dscache())
+	if err != nil {
+		return nil, err
+	}
+	res, err := base.GarbageCollect(ctx, scope.Repo(), live, p.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	if store, ok := scope.StepCache().(stepcache.ResponseStore); ok {
+		runIDs, err := scope.Logbook().AllReferencedRunIDs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if res.Responses, err = stepcache.CollectResponses(ctx, store, runIDs, p.DryRun); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Doctor checks repo stores agree with the logbook, optionally repairing them
+func (maintenanceImpl) Doctor(scope scope, p *DoctorParams) (*DoctorResult, error) {
+	ctx := scope.Context()
+	report, err := base.CheckRepo(ctx, scope.Repo(), scope.Dscache(), scope.CollectionSet())
+	if err != nil {
+		return nil, err
+	}
+	res := &DoctorResult{DoctorReport: report}
+	if !p.Fix || len(report.Discrepancies) == 0 {
+		return res, nil
+	}
+
+	if err := base.RepairRepo(ctx, scope.Repo(), scope.Dscache(), scope.CollectionSet()); err != nil {
+		return nil, err
+	}
+	res.Fixed = true
+	after, err := base.CheckRepo(ctx, scope.Repo(), scope.Dscache(), scope.CollectionSet())
+	if err != nil {
+		return nil, err
+	}
+	res.Remaining = after.Discrepancies
+	return res, nil
+}
+
+// Backup writes an archive of the repo
+func (maintenanceImpl) Backup(scope scope, p *BackupParams) (*BackupResult, error) {
+	return writeBackup(scope, p)
+}
+
+// Audit lists audited method calls
+func (maintenanceImpl) Audit(scope scope, p *AuditParams) ([]audit.Entry, Cursor, error) {
+	if scope.AuditLog() == nil {
+		return nil, nil, fmt.Errorf("audit log not found")
+	}
+	p.SetNonZeroDefaults()
+	pid := p.ProfileID
+	if pro := scope.ActiveProfile(); pro != nil && pro.ID != scope.Profiles().Owner(scope.Context()).ID {
+		pid = pro.ID.Encode()
+	}
+
+	entries, err := scope.AuditLog().List(scope.Context(), audit.Query{
+		List:      p.List,
+		ProfileID: pid,
+		Method:    p.Method,
+		Ref:       p.Ref,
+		Since:     p.Since,
+		Failed:    p.Failed,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.Limit < 0 {
+		return entries, nil, nil
+	}
+	p.Offset += p.Limit
+	return entries, scope.MakeCursor(len(entries), p), nil
+}
@@ -0,0 +1,174 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/qri-io/qri/audit"
+	"github.com/qri-io/qri/config"
+	"github.com/qri-io/qri/trace"
+)
+
+// DispatchCall is a single method call passing through dispatch
+type DispatchCall struct {
+	// Method is the registered method name, eg: "dataset.get"
+	Method string
+	// Param is the input parameter to the method
+	Param interface{}
+	// Source overrides the default ref resolution source
+	Source string
+	// RPC is true if the call will be forwarded to another process over HTTP
+	// instead of executing in this instance
+	RPC bool
+}
+
+// DispatchFunc executes a method call
+type DispatchFunc func(ctx context.Context, call *DispatchCall) (res interface{}, cur Cursor, err error)
+
+// DispatchMiddleware wraps a DispatchFunc, observing or altering calls before
+// handing them to next. Middleware runs for every method call, both calls
+// executed by the instance & calls forwarded over RPC
+type DispatchMiddleware func(next DispatchFunc) DispatchFunc
+
+// OptDispatchMiddleware adds middleware to the dispatch chain. Middleware
+// runs in the order given, after the built-in tracing, metrics & audit
+// middleware
+func OptDispatchMiddleware(mw ...DispatchMiddleware) Option {
+	return func(o *InstanceOptions) error {
+		o.dispatchMiddleware = append(o.dispatchMiddleware, mw...)
+		return nil
+	}
+}
+
+// useDispatchMiddleware composes the dispatch chain from the built-in
+// middleware followed by mw
+func (inst *Instance) useDispatchMiddleware(mw ...DispatchMiddleware) {
+	inst.metrics = newDispatchMetrics()
+	chain := append([]DispatchMiddleware{
+		traceMiddleware,
+		inst.metrics.middleware,
+		inst.auditMiddleware,
+	}, mw...)
+
+	inst.dispatch = inst.callMethod
+	for i := len(chain) - 1; i >= 0; i-- {
+		inst.dispatch = chain[i](inst.dispatch)
+	}
+}
+
+// traceMiddleware starts a span for each call. Calls forwarded over RPC carry
+// the span to the remote process in a request header
+func traceMiddleware(next DispatchFunc) DispatchFunc {
+	return func(ctx context.Context, call *DispatchCall) (interface{}, Cursor, error) {
+		ctx, span := trace.Start(ctx, call.Method)
+		res, cur, err := next(ctx, call)
+		span.End(err)
+		log.Debugw("span", "name", span.Name, "traceID", span.TraceID, "spanID", span.SpanID, "parentID", span.ParentID, "duration", span.Duration, "err", span.Error)
+		return res, cur, err
+	}
+}
+
+// dispatchMetrics tracks per-method call latency & errors
+type dispatchMetrics struct {
+	registry *prometheus.Registry
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+func newDispatchMetrics() *dispatchMetrics {
+	m := &dispatchMetrics{
+		registry: prometheus.NewRegistry(),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "qri",
+			Subsystem: "dispatch",
+			Name:      "call_duration_seconds",
+			Help:      "duration of lib method calls",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "qri",
+			Subsystem: "dispatch",
+			Name:      "call_errors_total",
+			Help:      "count of lib method calls that returned an error",
+		}, []string{"method"}),
+	}
+	m.registry.MustRegister(m.duration, m.errors)
+	return m
+}
+
+func (m *dispatchMetrics) middleware(next DispatchFunc) DispatchFunc {
+	return func(ctx context.Context, call *DispatchCall) (interface{}, Cursor, error) {
+		start := time.Now()
+		res, cur, err := next(ctx, call)
+		m.duration.WithLabelValues(call.Method).Observe(time.Since(start).Seconds())
+		if err != nil {
+			m.errors.WithLabelValues(call.Method).Inc()
+		}
+		return res, cur, err
+	}
+}
+
+// MetricsHandler serves dispatch metrics in the prometheus exposition format.
+// The API serves metrics when the api.metrics config field is true
+func (inst *Instance) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(inst.metrics.registry, promhttp.HandlerOpts{})
+}
+
+// auditMiddleware records calls this instance executes to the audit log.
+// Params are never recorded, they may contain secrets
+func (inst *Instance) auditMiddleware(next DispatchFunc) DispatchFunc {
+	return func(ctx context.Context, call *DispatchCall) (interface{}, Cursor, error) {
+		if call.RPC || inst.audit == nil {
+			return next(ctx, call)
+		}
+
+		start := time.Now()
+		res, cur, err := next(ctx, call)
+
+		e := audit.Entry{
+			Time:     start,
+			Method:   call.Method,
+			Ref:      paramRef(call.Param),
+			Duration: time.Since(start),
+		}
+		if pro, perr := inst.activeProfile(ctx); perr == nil && pro != nil {
+			e.ProfileID = pro.ID.Encode()
+		}
+		if sc, ok := trace.FromCtx(ctx); ok {
+			e.TraceID = sc.TraceID
+		}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		if perr := inst.audit.Put(ctx, e); perr != nil {
+			log.Debugw("recording audit entry", "method", call.Method, "err", perr)
+		}
+		return res, cur, err
+	}
+}
+
+// paramRef returns the string "Ref" field of a param struct, if one exists
+func paramRef(param interface{}) string {
+	v := reflect.Indirect(reflect.ValueOf(param))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	if f := v.FieldByName("Ref"); f.IsValid() && f.Kind() == reflect.String {
+		return f.String()
+	}
+	return ""
+}
+
+// newAuditStore creates the audit log, stored in repoPath/audit.jsonl for repos
+// on the filesystem
+func newAuditStore(cfg *config.Config, repoPath string) (audit.Store, error) {
+	if cfg.Repo == nil || cfg.Repo.Type == "mem" {
+		return audit.NewMemStore(), nil
+	}
+	return audit.NewFileStore(filepath.Join(repoPath, "audit.jsonl"))
+}
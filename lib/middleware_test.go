@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/qri/trace"
+)
+
+func TestDispatchMiddleware(t *testing.T) {
+	ctx := context.Background()
+	inst, cleanup := NewMemTestInstance(ctx, t)
+	defer cleanup()
+
+	fruit := &fruitMethods{d: inst}
+	reg := make(map[string]callable)
+	inst.registerOne("fruit", fruit, fruitImpl{}, reg)
+	inst.registerOne("maintenance", inst.Maintenance(), maintenanceImpl{}, reg)
+	inst.regMethods = &regMethodSet{reg: reg}
+
+	called := []string{}
+	inst.useDispatchMiddleware(func(next DispatchFunc) DispatchFunc {
+		return func(ctx context.Context, call *DispatchCall) (interface{}, Cursor, error) {
+			if _, ok := trace.FromCtx(ctx); !ok {
+				t.Errorf("expected %q call to carry a span", call.Method)
+			}
+			called = append(called, call.Method)
+			return next(ctx, call)
+		}
+	})
+
+	if err := fruit.Apple(ctx, &fruitParams{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := fruit.Cherry(ctx, &fruitParams{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(called, ",") != "fruit.apple,fruit.cherry" {
+		t.Errorf("unexpected middleware calls: %v", called)
+	}
+
+	entries, _, err := inst.Maintenance().Audit(ctx, &AuditParams{Failed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 failed call, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Method != "fruit.apple" || e.Error != "no more apples" || e.TraceID == "" || e.ProfileID == "" {
+		t.Errorf("unexpected audit entry: %#v", e)
+	}
+
+	rec := httptest.NewRecorder()
+	inst.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	data, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		`qri_dispatch_call_errors_total{method="fruit.apple"} 1`,
+		`qri_dispatch_call_duration_seconds_count{method="fruit.cherry"} 1`,
+	} {
+		if !strings.Contains(string(data), expect) {
+			t.Errorf("expected metrics to contain %q", expect)
+		}
+	}
+}
+
+func TestParamRef(t *testing.T) {
+	if got := paramRef(&GetParams{Ref: "me/movies"}); got != "me/movies" {
+		t.Errorf("expected ref %q, got %q", "me/movies", got)
+	}
+	if got := paramRef(&fruitParams{Name: "apple"}); got != "" {
+		t.Errorf("expected empty ref, got %q", got)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/qri-io/qri/logbook/oplog"
 	"github.com/qri-io/qri/profile"
 	"github.com/qri-io/qri/registry"
+	sqliterepo "github.com/qri-io/qri/repo/sqlite"
 )
 
 // RegistryClientMethods defines business logic for working with registries
@@ -153,13 +154,31 @@ func (registryImpl) ProveProfileKey(scope scope, p *RegistryProfileParams) error
 	} else {
 		// Otherwise, nothing was ever pushed. Create new logbook data using the
 		// profileID we got back.
-		logbookPath := filepath.Join(scope.RepoPath(), "logbook.qfb")
-		logbook, err := logbook.NewJournalOverwriteWithProfile(*pro, scope.Bus(),
-			scope.Filesystem(), logbookPath)
+		var book *logbook.Book
+		if sr, ok := scope.Repo().(*sqliterepo.Repo); ok {
+			var store *sqliterepo.Logstore
+			if store, err = sr.DB().Logstore(scope.Context(), pro.PrivKey); err != nil {
+				return err
+			}
+			if err := store.Clear(scope.Context()); err != nil {
+				return err
+			}
+			book, err = logbook.NewBookWithStore(*pro, scope.Bus(), store)
+		} else if cfg.Repo != nil && cfg.Repo.Logstore == "segments" {
+			if err := scope.Logbook().Close(); err != nil {
+				return err
+			}
+			book, err = logbook.NewSegmentJournalOverwriteWithProfile(*pro, scope.Bus(),
+				filepath.Join(scope.RepoPath(), "logbook"))
+		} else {
+			logbookPath := filepath.Join(scope.RepoPath(), "logbook.qfb")
+			book, err = logbook.NewJournalOverwriteWithProfile(*pro, scope.Bus(),
+				scope.Filesystem(), logbookPath)
+		}
 		if err != nil {
 			return err
 		}
-		scope.SetLogbook(logbook)
+		scope.SetLogbook(book)
 	}
 
 	// Save the modified config
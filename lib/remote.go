@@ -7,8 +7,12 @@ import (
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/qri/base"
 	"github.com/qri-io/qri/dsref"
+	qrierr "github.com/qri-io/qri/errors"
 	qhttp "github.com/qri-io/qri/lib/http"
+	"github.com/qri-io/qri/profile"
 	"github.com/qri-io/qri/remote"
+	"github.com/qri-io/qri/remote/access"
+	"github.com/qri-io/qri/remote/quota"
 )
 
 const allowedDagInfoSize uint64 = 10 * 1024 * 1024
@@ -27,9 +31,11 @@ func (m RemoteMethods) Name() string {
 // Attributes defines attributes for each method
 func (m RemoteMethods) Attributes() map[string]AttributeSet {
 	return map[string]AttributeSet{
-		"feeds":   {Endpoint: qhttp.AEFeeds, HTTPVerb: "POST"},
-		"preview": {Endpoint: qhttp.AEPreview, HTTPVerb: "POST"},
-		"remove":  {Endpoint: qhttp.AERemoteRemove, HTTPVerb: "POST", DefaultSource: "network"},
+		"feeds":    {Endpoint: qhttp.AEFeeds, HTTPVerb: "POST"},
+		"preview":  {Endpoint: qhttp.AEPreview, HTTPVerb: "POST"},
+		"remove":   {Endpoint: qhttp.AERemoteRemove, HTTPVerb: "POST", DefaultSource: "network"},
+		"usage":    {Endpoint: qhttp.AERemoteUsage, HTTPVerb: "POST", DefaultSource: "local"},
+		"setquota": {Endpoint: qhttp.AERemoteSetQuota, HTTPVerb: "POST", DefaultSource: "local"},
 	}
 }
 
@@ -66,6 +72,40 @@ func (m RemoteMethods) Remove(ctx context.Context, p *PushParams) (*dsref.Ref, e
 	return nil, dispatchReturnError(got, err)
 }
 
+// UsageParams provides arguments to the usage method
+type UsageParams struct {
+	// ProfileID limits usage to a single profile, default lists all profiles
+	ProfileID string `json:"profileID"`
+}
+
+// Usage lists the storage profiles use on this remote. Only the owner of the
+// remote can see usage of other profiles
+func (m RemoteMethods) Usage(ctx context.Context, p *UsageParams) ([]quota.Usage, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "usage"), p)
+	if res, ok := got.([]quota.Usage); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
+// SetQuotaParams provides arguments to the setquota method
+type SetQuotaParams struct {
+	ProfileID string `json:"profileID"`
+	// Quota is a human-readable size like "10GB", "unlimited", or "default" to
+	// use the remote's default quota
+	Quota string `json:"quota"`
+}
+
+// SetQuota sets the storage quota of a profile on this remote. Only the
+// owner of the remote can set quotas
+func (m RemoteMethods) SetQuota(ctx context.Context, p *SetQuotaParams) (*quota.Usage, error) {
+	got, _, err := m.d.Dispatch(ctx, dispatchMethodName(m, "setquota"), p)
+	if res, ok := got.(*quota.Usage); ok {
+		return res, err
+	}
+	return nil, dispatchReturnError(got, err)
+}
+
 // remoteImpl holds the method implementations for RemoteMethods
 type remoteImpl struct{}
 
@@ -135,3 +175,63 @@ func (remoteImpl) Remove(scope scope, p *PushParams) (*dsref.Ref, error) {
 
 	return &ref, nil
 }
+
+// Usage lists the storage profiles use on this remote
+func (remoteImpl) Usage(scope scope, p *UsageParams) ([]quota.Usage, error) {
+	ledger, err := remoteLedger(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	pid := p.ProfileID
+	if !callerIsOwner(scope) {
+		pid = scope.ActiveProfile().ID.Encode()
+	}
+	if pid != "" {
+		return []quota.Usage{ledger.Usage(pid)}, nil
+	}
+	return ledger.List(), nil
+}
+
+// SetQuota sets the storage quota of a profile on this remote
+func (remoteImpl) SetQuota(scope scope, p *SetQuotaParams) (*quota.Usage, error) {
+	ledger, err := remoteLedger(scope)
+	if err != nil {
+		return nil, err
+	}
+	if !callerIsOwner(scope) {
+		return nil, fmt.Errorf("%w: only the owner of a remote can set quotas", access.ErrAccessDenied)
+	}
+	if p.ProfileID == "" {
+		return nil, qrierr.New(ErrBadArgs, "profile ID is required")
+	}
+	if _, err := profile.IDB58Decode(p.ProfileID); err != nil {
+		return nil, qrierr.New(ErrBadArgs, fmt.Sprintf("invalid profile ID %q", p.ProfileID))
+	}
+
+	if p.Quota == "default" {
+		err = ledger.ResetQuota(p.ProfileID)
+	} else {
+		var size int64
+		if size, err = quota.ParseSize(p.Quota); err != nil {
+			return nil, qrierr.New(ErrBadArgs, err.Error())
+		}
+		err = ledger.SetQuota(p.ProfileID, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u := ledger.Usage(p.ProfileID)
+	return &u, nil
+}
+
+// remoteLedger gets the storage usage ledger of the remote this instance
+// runs
+func remoteLedger(scope scope) (*quota.Ledger, error) {
+	rs := scope.RemoteServer()
+	if rs == nil {
+		return nil, fmt.Errorf("storage quotas require a node running in remote mode")
+	}
+	return rs.Ledger(), nil
+}
@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"context"
+	"sync"
+
+	"github.com/qri-io/qri/event"
+)
+
+// runEvents routes bus events to handlers registered for a single run. The
+// event bus has no way to unsubscribe, so an instance subscribes one handler
+// for its lifetime & per-run handlers are added & removed as runs come & go
+type runEvents struct {
+	mu       sync.Mutex
+	next     int
+	handlers map[string]map[int]event.Handler
+}
+
+func newRunEvents(bus event.Bus) *runEvents {
+	re := &runEvents{handlers: map[string]map[int]event.Handler{}}
+	if bus != nil {
+		bus.SubscribeAll(re.handle)
+	}
+	return re
+}
+
+// add registers a handler for the events of a run, returning a function that
+// removes the handler. remove is safe to call more than once
+func (re *runEvents) add(runID string, h event.Handler) (remove func()) {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	id := re.next
+	re.next++
+	if re.handlers[runID] == nil {
+		re.handlers[runID] = map[int]event.Handler{}
+	}
+	re.handlers[runID][id] = h
+
+	return func() {
+		re.mu.Lock()
+		defer re.mu.Unlock()
+		delete(re.handlers[runID], id)
+		if len(re.handlers[runID]) == 0 {
+			delete(re.handlers, runID)
+		}
+	}
+}
+
+// len returns the number of registered handlers
+func (re *runEvents) len() int {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	n := 0
+	for _, hs := range re.handlers {
+		n += len(hs)
+	}
+	return n
+}
+
+func (re *runEvents) handle(ctx context.Context, e event.Event) error {
+	runID := eventRunID(e)
+	if runID == "" {
+		return nil
+	}
+	re.mu.Lock()
+	hs := make([]event.Handler, 0, len(re.handlers[runID]))
+	for _, h := range re.handlers[runID] {
+		hs = append(hs, h)
+	}
+	re.mu.Unlock()
+
+	for _, h := range hs {
+		if err := h(ctx, e); err != nil {
+			log.Debugw("handling run event", "runID", runID, "type", e.Type, "err", err)
+		}
+	}
+	return nil
+}
+
+// eventRunID gets the ID of the run an event belongs to. Payloads that name a
+// run take precedence over the event session ID
+func eventRunID(e event.Event) string {
+	switch p := e.Payload.(type) {
+	case event.TransformDebugCommand:
+		return p.RunID
+	case event.TransformDebugState:
+		return p.RunID
+	case event.WorkflowStoppedEvent:
+		return p.RunID
+	}
+	return e.SessionID
+}
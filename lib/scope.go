@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/qri-io/qfs/muxfs"
+	"github.com/qri-io/qri/audit"
 	"github.com/qri-io/qri/automation"
 	"github.com/qri-io/qri/automation/workflow"
 	"github.com/qri-io/qri/base"
@@ -19,6 +20,8 @@ import (
 	"github.com/qri-io/qri/remote"
 	"github.com/qri-io/qri/repo"
 	"github.com/qri-io/qri/stats"
+	"github.com/qri-io/qri/transform/stepcache"
+	"github.com/qri-io/qri/transform/tfstate"
 )
 
 // scope represents the lifetime of a method call, abstractly connected to the
@@ -77,6 +80,31 @@ func (s *scope) AutomationOrchestrator() *automation.Orchestrator {
 	return s.inst.automation
 }
 
+// StepCache returns the transform step cache
+func (s *scope) StepCache() stepcache.Store {
+	return s.inst.stepCache
+}
+
+// AuditLog returns the store of audited method calls
+func (s *scope) AuditLog() audit.Store {
+	return s.inst.audit
+}
+
+// TransformState returns the store of state transforms persist between runs
+func (s *scope) TransformState() tfstate.Store {
+	return s.inst.tfState
+}
+
+// LineageIndex returns the index of datasets built from each version
+func (s *scope) LineageIndex() *base.LineageIndex {
+	return s.inst.lineage
+}
+
+// Jobs returns the manager of background jobs
+func (s *scope) Jobs() *jobManager {
+	return s.inst.jobs
+}
+
 // Bus returns the event bus
 func (s *scope) Bus() event.Bus {
 	// TODO(dustmop): Filter only events for this scope.
@@ -177,6 +205,10 @@ func (s *scope) MakeCursor(numReturned int, nextPage interface{}) Cursor {
 	if numReturned < 1 {
 		return nil
 	}
+	// later pages must be read from the same source
+	if s.source != "" {
+		return cursor{s.inst.WithSource(s.source), s.method, nextPage}
+	}
 	return cursor{s.inst, s.method, nextPage}
 }
 
@@ -205,6 +237,12 @@ func (s *scope) RemoteClient() remote.Client {
 	return s.inst.remoteClient
 }
 
+// RemoteServer returns the remote server, nil unless the instance is running
+// in remote mode
+func (s *scope) RemoteServer() *remote.Server {
+	return s.inst.remoteServer
+}
+
 // Repo returns the repo store
 func (s *scope) Repo() repo.Repo {
 	return s.inst.repo
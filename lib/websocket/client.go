@@ -0,0 +1,89 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/qri-io/qri/event"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+// clientReadLimit is the largest message a subscription reads. Events with
+// large payloads like dataset previews exceed the default limit
+const clientReadLimit = 16 << 20
+
+// wireMessage is the union of messages a qri node writes to a websocket
+// connection: responses to requests, and published events
+type wireMessage struct {
+	Type      string          `json:"type"`
+	Timestamp int64           `json:"ts"`
+	SessionID string          `json:"sessionID"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Subscribe connects to the websocket API of a qri node at url, for example
+// "ws://127.0.0.1:2503", authenticating with a token. Events the node
+// publishes for the token's profile are sent on the returned channel, with
+// payloads left as JSON in a json.RawMessage. The channel closes when ctx is
+// cancelled or the connection fails
+func Subscribe(ctx context.Context, url, tokenString string) (<-chan event.Event, error) {
+	c, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{
+		Subprotocols: []string{qriWebsocketProtocol},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to websocket: %w", err)
+	}
+	c.SetReadLimit(clientReadLimit)
+
+	payload, err := json.Marshal(subscribeMessage{Token: tokenString})
+	if err != nil {
+		c.Close(websocket.StatusInternalError, "")
+		return nil, err
+	}
+	if err := wsjson.Write(ctx, c, &message{Type: subscribeRequest, Payload: payload}); err != nil {
+		c.Close(websocket.StatusInternalError, "")
+		return nil, err
+	}
+
+	// the first response to a subscribe request is success or failure
+	for {
+		msg := wireMessage{}
+		if err := wsjson.Read(ctx, c, &msg); err != nil {
+			return nil, err
+		}
+		if msg.Type == string(subscribeFailure) {
+			c.Close(websocket.StatusNormalClosure, "")
+			return nil, fmt.Errorf("websocket subscription failed")
+		}
+		if msg.Type == string(subscribeSuccess) {
+			break
+		}
+	}
+
+	events := make(chan event.Event)
+	go func() {
+		defer close(events)
+		defer c.Close(websocket.StatusNormalClosure, "")
+		for {
+			msg := wireMessage{}
+			if err := wsjson.Read(ctx, c, &msg); err != nil {
+				log.Debugw("websocket subscription closed", "err", err)
+				return
+			}
+			e := event.Event{
+				Type:      event.Type(msg.Type),
+				Timestamp: msg.Timestamp,
+				SessionID: msg.SessionID,
+				Payload:   msg.Data,
+			}
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
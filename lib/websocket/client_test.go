@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qri-io/qri/auth/key"
+	testkeys "github.com/qri-io/qri/auth/key/test"
+	"github.com/qri-io/qri/auth/token"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/profile"
+)
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// other tests set a fixed source of connection ids
+	setIDRand(nil)
+
+	kd := testkeys.GetKeyData(0)
+	ks, err := key.NewMemStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.AddPubKey(ctx, kd.KeyID, kd.PrivKey.GetPublic()); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := event.NewBus(ctx)
+	handler, err := NewHandler(ctx, bus, ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(http.HandlerFunc(handler.ConnectionHandler))
+	defer s.Close()
+	url := "ws" + strings.TrimPrefix(s.URL, "http")
+
+	if _, err := Subscribe(ctx, url, "not_a_token"); err == nil {
+		t.Error("expected subscribing with an invalid token to fail")
+	}
+
+	tokenStr, err := token.NewPrivKeyAuthToken(kd.PrivKey, kd.KeyID.String(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := Subscribe(ctx, url, tokenStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubCtx := profile.AddIDToContext(ctx, kd.KeyID.String())
+	if err := bus.PublishID(pubCtx, event.ETTransformPrint, "run_id", event.TransformMessage{Msg: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != event.ETTransformPrint {
+			t.Errorf("event type mismatch. want %q, got %q", event.ETTransformPrint, e.Type)
+		}
+		if e.SessionID != "run_id" {
+			t.Errorf("session id mismatch. want %q, got %q", "run_id", e.SessionID)
+		}
+		msg := event.TransformMessage{}
+		if err := json.Unmarshal(e.Payload.(json.RawMessage), &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Msg != "hello" {
+			t.Errorf("payload mismatch. want %q, got %q", "hello", msg.Msg)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for event")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/qri-io/qri/auth/key"
 	"github.com/qri-io/qri/auth/token"
 	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/profile"
 	"nhooyr.io/websocket"
 	"nhooyr.io/websocket/wsjson"
 )
@@ -52,6 +53,7 @@ type connectionSet map[string]struct{}
 // connections maintains the set of active websocket connections & associated
 // connection metadata
 type connections struct {
+	bus           event.Bus
 	conns         map[string]*conn
 	connsLock     sync.Mutex
 	keystore      key.Store
@@ -71,6 +73,7 @@ var _ Handler = (*connections)(nil)
 // can connect to in order to get realtime events
 func NewHandler(ctx context.Context, bus event.Bus, keystore key.Store) (Handler, error) {
 	ws := &connections{
+		bus:           bus,
 		conns:         map[string]*conn{},
 		connsLock:     sync.Mutex{},
 		keystore:      keystore,
@@ -294,11 +297,34 @@ func (h *connections) handleMessage(ctx context.Context, c *conn, msg *message)
 		h.write(ctx, c, &message{Type: subscribeSuccess})
 	case unsubscribeRequest:
 		h.unsubscribeConn(c.profileID, c.id)
+	case debugCommandRequest:
+		if err := h.publishDebugCommand(ctx, c, msg.Payload); err != nil {
+			log.Debugw("debug command", "error", err, "connection id", c.id, "msg", msg)
+			h.write(ctx, c, &message{Type: debugCommandFailure, Error: err})
+		}
 	default:
 		log.Debug("unknown message type over websocket %s: %q", c.id, msg.Type)
 	}
 }
 
+// publishDebugCommand forwards a command for a paused transform to the event
+// bus. Only subscribed connections can send debug commands, which are sent
+// on behalf of the connection's profile
+func (h *connections) publishDebugCommand(ctx context.Context, c *conn, payload json.RawMessage) error {
+	if c.profileID == "" {
+		return fmt.Errorf("debug commands require a subscribed connection")
+	}
+	cmd := event.TransformDebugCommand{}
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return err
+	}
+	if cmd.RunID == "" {
+		return fmt.Errorf("debug command requires a runID")
+	}
+	ctx = profile.AddIDToContext(ctx, c.profileID)
+	return h.bus.PublishID(ctx, event.ETTransformDebugCommand, cmd.RunID, cmd)
+}
+
 // write sends a json message over the connection
 func (h *connections) write(ctx context.Context, c *conn, msg *message) {
 	log.Debugf("sending message %q to websocket conns %q", msg.Type, c.id)
@@ -331,6 +357,13 @@ const (
 	// to be authenticated
 	// payload is nil
 	unsubscribeRequest = msgType("unsubscribe:request")
+	// debugCommandRequest resumes a transform paused by a debugger, the
+	// connection must be subscribed as the owner of the transform run
+	// payload is an `event.TransformDebugCommand`
+	debugCommandRequest = msgType("debug:command")
+	// debugCommandFailure indicates a debug command could not be sent
+	// payload is nil
+	debugCommandFailure = msgType("debug:failure")
 )
 
 // message is the expected structure of an incoming websocket message
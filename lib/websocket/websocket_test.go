@@ -4,12 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/qri-io/qri/auth/key"
 	testkeys "github.com/qri-io/qri/auth/key/test"
 	"github.com/qri-io/qri/auth/token"
@@ -162,6 +164,68 @@ func TestWebsocketUnsubscribe(t *testing.T) {
 	}
 }
 
+func TestWebsocketDebugCommand(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kd := testkeys.GetKeyData(0)
+	ks, err := key.NewMemStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.AddPubKey(context.Background(), kd.KeyID, kd.PrivKey.GetPublic()); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := event.NewBus(ctx)
+	got := []event.Event{}
+	bus.SubscribeTypes(func(_ context.Context, e event.Event) error {
+		got = append(got, e)
+		return nil
+	}, event.ETTransformDebugCommand)
+
+	websocketHandler, err := NewHandler(ctx, bus, ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsh := websocketHandler.(*connections)
+
+	randIDStr := "test_connection_id_str"
+	setIDRand(strings.NewReader(randIDStr))
+	connID := newID()
+	setIDRand(strings.NewReader(randIDStr))
+	wsh.ConnectionHandler(mockWriterAndRequest())
+	c, err := wsh.getConn(connID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := json.RawMessage(`{"runID":"run_id","action":"step"}`)
+	if err := wsh.publishDebugCommand(ctx, c, payload); err == nil {
+		t.Error("expected unsubscribed connection to fail sending debug commands")
+	}
+
+	tokenStr, err := token.NewPrivKeyAuthToken(kd.PrivKey, kd.KeyID.String(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wsh.subscribeConn(connID, tokenStr); err != nil {
+		t.Fatal(err)
+	}
+
+	wsh.handleMessage(ctx, c, &message{Type: debugCommandRequest, Payload: payload})
+	if len(got) != 1 {
+		t.Fatalf("expected 1 debug command event, got: %d", len(got))
+	}
+	if got[0].ProfileID != kd.KeyID.String() || got[0].SessionID != "run_id" {
+		t.Errorf("unexpected event profileID: %q sessionID: %q", got[0].ProfileID, got[0].SessionID)
+	}
+	expect := event.TransformDebugCommand{RunID: "run_id", Action: event.TransformDebugStep}
+	if diff := cmp.Diff(expect, got[0].Payload); diff != "" {
+		t.Errorf("payload mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func mockWriterAndRequest() (http.ResponseWriter, *http.Request) {
 	w := mockHijacker{
 		ResponseWriter: httptest.NewRecorder(),
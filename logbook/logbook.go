@@ -11,7 +11,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -20,6 +22,7 @@ import (
 	crypto "github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/qfs"
+	"github.com/qri-io/qri/auth/key"
 	"github.com/qri-io/qri/automation/run"
 	"github.com/qri-io/qri/dsref"
 	"github.com/qri-io/qri/event"
@@ -104,6 +107,13 @@ type Book struct {
 	publisher  event.Publisher
 	fs         qfs.Filesystem
 	fsLocation string
+
+	// authorKeys are known public keys of log authors. when set, merged logs
+	// are checked against the key of their author
+	authorKeys profile.Store
+	// rejectUnverified refuses to merge logs that fail author checks instead
+	// of logging a warning
+	rejectUnverified bool
 }
 
 // NewBook creates a book with a user-provided logstore
@@ -185,6 +195,116 @@ func NewJournalOverwriteWithProfile(owner profile.Profile, bus event.Publisher,
 	return book, err
 }
 
+// NewSegmentJournal initializes a logbook owned by a single author that
+// persists changes to a directory of append-only segments, see
+// oplog.SegmentStore. If dir holds no logs and a journal exists at fsLocation
+// on fs, the journal is imported
+func NewSegmentJournal(owner profile.Profile, bus event.Publisher, fs qfs.Filesystem, fsLocation, dir string, opts ...func(o *oplog.SegmentStoreOptions)) (*Book, error) {
+	ctx := context.Background()
+	if owner.PrivKey == nil {
+		return nil, fmt.Errorf("logbook: private key is required")
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("logbook: directory is required")
+	}
+	if bus == nil {
+		return nil, fmt.Errorf("logbook: event.Bus is required")
+	}
+
+	store, err := oplog.OpenSegmentStore(dir, owner.PrivKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if store.Empty() && fs != nil && fsLocation != "" {
+		journal := &oplog.Journal{}
+		legacy := &Book{store: journal, fs: fs, owner: &owner, fsLocation: fsLocation}
+		if err := legacy.load(ctx); err == nil {
+			log.Debugw("importing journal into segments", "location", fsLocation, "dir", dir)
+			if err := store.Import(ctx, journal); err != nil {
+				store.Close()
+				return nil, err
+			}
+		} else if err != ErrNotFound {
+			store.Close()
+			return nil, err
+		}
+	}
+
+	book := &Book{
+		store:     store,
+		owner:     &owner,
+		publisher: bus,
+	}
+
+	if store.Empty() {
+		if err := book.initialize(ctx); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+	return book, nil
+}
+
+// NewSegmentJournalOverwriteWithProfile initializes a new segmented logbook
+// using the given profile. Any existing logbook data in dir is removed
+func NewSegmentJournalOverwriteWithProfile(owner profile.Profile, bus event.Publisher, dir string) (*Book, error) {
+	log.Debugw("NewSegmentJournalOverwriteWithProfile", "owner", owner)
+	if owner.ID.Encode() == "" {
+		return nil, fmt.Errorf("logbook: profileID is required")
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("logbook: directory is required")
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	return NewSegmentJournal(owner, bus, nil, "", dir)
+}
+
+// NewBookWithStore creates a logbook backed by an open logstore, writing an
+// initial log for the owner if the store is empty
+func NewBookWithStore(owner profile.Profile, bus event.Publisher, store oplog.Logstore) (*Book, error) {
+	ctx := context.Background()
+	if owner.PrivKey == nil {
+		return nil, fmt.Errorf("logbook: private key is required")
+	}
+	if store == nil {
+		return nil, fmt.Errorf("logbook: store is required")
+	}
+	if bus == nil {
+		return nil, fmt.Errorf("logbook: event.Bus is required")
+	}
+
+	book := &Book{
+		store:     store,
+		owner:     &owner,
+		publisher: bus,
+	}
+
+	logs, err := store.Logs(ctx, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	if len(logs) == 0 {
+		if err := book.initialize(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return book, nil
+}
+
+// Close releases resources held by the book's logstore
+func (book *Book) Close() error {
+	if book == nil {
+		return nil
+	}
+	if c, ok := book.store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 // Owner provides the profile that owns the logbook
 func (book *Book) Owner() *profile.Profile {
 	return book.owner
@@ -205,7 +325,7 @@ func (book *Book) initialize(ctx context.Context) error {
 		return err
 	}
 
-	return book.save(ctx, &UserLog{l: ownerOplog}, nil)
+	return book.save(ctx, nil)
 }
 
 // ReplaceAll replaces the contents of the logbook with the provided log data
@@ -215,33 +335,42 @@ func (book *Book) ReplaceAll(ctx context.Context, lg *oplog.Log) error {
 	if err != nil {
 		return err
 	}
-	return book.save(ctx, nil, nil)
+	return book.save(ctx, nil)
 }
 
-// logPutter is an interface for transactional log updates. updates provided
-// to PutLog should always be complete, rooted log hierarchies
+// logPutter is an interface for transactional log updates. PutLog records the
+// current state of a log already in the store, along with all descendants
 type logPutter interface {
 	PutLog(ctx context.Context, l *oplog.Log) error
 }
 
-// save writes the book to book.fsLocation, if a non-nil authorLog is provided
-// save tries to write a transactional update
-func (book *Book) save(ctx context.Context, authorLog *UserLog, blog *BranchLog) (err error) {
-	if authorLog != nil {
+// opsPutter is an interface for transactional updates to a single log.
+// PutOps records the current operations of a log already in the store,
+// without its descendants
+type opsPutter interface {
+	PutOps(ctx context.Context, l *oplog.Log) error
+}
+
+// saveOps persists changes that only append operations to l. stores that
+// support it write l without descendants, all others fall back to save
+func (book *Book) saveOps(ctx context.Context, l *oplog.Log) error {
+	if op, ok := book.store.(opsPutter); ok {
+		return op.PutOps(ctx, l)
+	}
+	return book.save(ctx, l)
+}
+
+// save persists changes to the book. changed is the log that was modified in
+// place, nil if the change was made through a store method. stores that
+// support transactional updates only write the changed log, journals write
+// the entire book to book.fsLocation
+func (book *Book) save(ctx context.Context, changed *oplog.Log) (err error) {
+	if changed != nil {
 		if lp, ok := book.store.(logPutter); ok {
-			if err := lp.PutLog(ctx, authorLog.l); err != nil {
+			if err := lp.PutLog(ctx, changed); err != nil {
 				return err
 			}
 		}
-	} else {
-		if blog != nil {
-			if lp, ok := book.store.(logPutter); ok {
-
-				if err := lp.PutLog(ctx, blog.l); err != nil {
-					return err
-				}
-			}
-		}
 	}
 
 	if al, ok := book.store.(oplog.AuthorLogstore); ok {
@@ -305,7 +434,7 @@ func (book *Book) WriteAuthorRename(ctx context.Context, author *profile.Profile
 		Timestamp: NewTimestamp(),
 	})
 
-	if err := book.save(ctx, authorLog, nil); err != nil {
+	if err := book.saveOps(ctx, authorLog.l); err != nil {
 		return err
 	}
 
@@ -378,7 +507,7 @@ func (book *Book) WriteDatasetInit(ctx context.Context, author *profile.Profile,
 		log.Error(err)
 	}
 
-	return initID, book.save(ctx, authorLog, nil)
+	return initID, book.save(ctx, dsLog)
 }
 
 // WriteDatasetRename marks renaming a dataset
@@ -423,9 +552,12 @@ func (book *Book) WriteDatasetRename(ctx context.Context, author *profile.Profil
 		return err
 	}
 
-	authorLog.AddChild(dsLog.l)
-
-	return book.save(ctx, authorLog, nil)
+	if dsLog.l.ParentID != authorLog.l.ID() {
+		authorLog.AddChild(dsLog.l)
+		return book.save(ctx, dsLog.l)
+	}
+	// only the dataset log gained an operation
+	return book.saveOps(ctx, dsLog.l)
 }
 
 // RefToInitID converts a dsref to an initID by iterating the entire logbook looking for a match.
@@ -546,7 +678,7 @@ func (book *Book) WriteDatasetDeleteAll(ctx context.Context, pro *profile.Profil
 		log.Error(err)
 	}
 
-	return book.save(ctx, nil, nil)
+	return book.save(ctx, dsLog.l)
 }
 
 // WriteVersionSave adds 1 or 2 operations marking the creation of a dataset
@@ -579,7 +711,7 @@ func (book *Book) WriteVersionSave(ctx context.Context, author *profile.Profile,
 
 	book.appendVersionSave(branchLog, ds)
 	// TODO(dlong): Think about how to handle a failure exactly here, what needs to be rolled back?
-	err = book.save(ctx, nil, branchLog)
+	err = book.save(ctx, branchLog.l)
 	if err != nil {
 		return err
 	}
@@ -644,7 +776,7 @@ func (book *Book) WriteTransformRun(ctx context.Context, author *profile.Profile
 		log.Error(err)
 	}
 	// TODO(dlong): Think about how to handle a failure exactly here, what needs to be rolled back?
-	return book.save(ctx, nil, branchLog)
+	return book.save(ctx, branchLog.l)
 }
 
 func (book *Book) appendVersionSave(blog *BranchLog, ds *dataset.Dataset) int {
@@ -717,7 +849,7 @@ func (book *Book) WriteVersionAmend(ctx context.Context, author *profile.Profile
 		Note:      ds.Commit.Title,
 	})
 
-	return book.save(ctx, nil, branchLog)
+	return book.save(ctx, branchLog.l)
 }
 
 // WriteVersionDelete adds an operation to a log marking a number of sequential
@@ -737,12 +869,7 @@ func (book *Book) WriteVersionDelete(ctx context.Context, author *profile.Profil
 		return err
 	}
 
-	branchLog.Append(oplog.Op{
-		Type:  oplog.OpTypeRemove,
-		Model: CommitModel,
-		Size:  int64(revisions),
-		// TODO (b5) - finish
-	})
+	book.appendVersionDelete(branchLog, revisions)
 
 	// Calculate the commits after collapsing deletions found at the tail of history (most recent).
 	items := branchToVersionInfos(branchLog, dsref.Ref{}, false)
@@ -757,7 +884,102 @@ func (book *Book) WriteVersionDelete(ctx context.Context, author *profile.Profil
 		}
 	}
 
-	return book.save(ctx, nil, nil)
+	return book.save(ctx, branchLog.l)
+}
+
+// WriteVersionDrop removes versions, keyed by path, from anywhere in a
+// dataset's history. Deletes only remove versions from HEAD, so every version
+// newer than the oldest dropped version is deleted, then the operations of
+// versions that aren't dropped are appended again, unchanged. Kept versions
+// keep their paths, and the delete & re-appended versions are written in a
+// single save. Dropping the latest version is an error
+func (book *Book) WriteVersionDrop(ctx context.Context, author *profile.Profile, initID string, drop map[string]struct{}) error {
+	if book == nil {
+		return ErrNoLogbook
+	}
+	log.Debugf("WriteVersionDrop: %s, versions: %d", initID, len(drop))
+
+	branchLog, err := book.branchLog(ctx, initID)
+	if err != nil {
+		return err
+	}
+	if err := book.hasWriteAccess(ctx, branchLog.l, author); err != nil {
+		return err
+	}
+
+	// commits are ordered oldest-first
+	commits := branchCommitOps(branchLog)
+	oldest := -1
+	for i := len(commits) - 1; i >= 0; i-- {
+		if _, ok := drop[commits[i].Ref]; ok {
+			if i == len(commits)-1 {
+				return fmt.Errorf("cannot drop the latest version of a dataset")
+			}
+			oldest = i
+		}
+	}
+	if oldest == -1 {
+		return nil
+	}
+
+	book.appendVersionDelete(branchLog, len(commits)-oldest)
+	for _, op := range commits[oldest+1:] {
+		if _, ok := drop[op.Ref]; !ok {
+			// amends are re-appended as the version they describe
+			op.Type = oplog.OpTypeInit
+			branchLog.Append(op)
+		}
+	}
+	if err := book.save(ctx, branchLog.l); err != nil {
+		return err
+	}
+
+	items := branchToVersionInfos(branchLog, dsref.Ref{}, true)
+	if len(items) > 0 {
+		lastItem := items[0]
+		lastItem.InitID = initID
+		lastItem.CommitCount = len(items)
+
+		if err = book.publisher.Publish(ctx, event.ETLogbookWriteCommit, lastItem); err != nil {
+			log.Error(err)
+		}
+	}
+	return nil
+}
+
+// branchCommitOps returns the operations of versions in a branch's history,
+// ordered oldest-first, with deleted versions removed & amends applied
+func branchCommitOps(blog *BranchLog) []oplog.Op {
+	ops := []oplog.Op{}
+	for _, op := range blog.Ops() {
+		if op.Model != CommitModel {
+			continue
+		}
+		switch op.Type {
+		case oplog.OpTypeInit:
+			ops = append(ops, op)
+		case oplog.OpTypeAmend:
+			if len(ops) > 0 {
+				ops[len(ops)-1] = op
+			}
+		case oplog.OpTypeRemove:
+			if int(op.Size) < len(ops) {
+				ops = ops[:len(ops)-int(op.Size)]
+			} else {
+				ops = ops[:0]
+			}
+		}
+	}
+	return ops
+}
+
+func (book *Book) appendVersionDelete(blog *BranchLog, revisions int) {
+	blog.Append(oplog.Op{
+		Type:  oplog.OpTypeRemove,
+		Model: CommitModel,
+		Size:  int64(revisions),
+		// TODO (b5) - finish
+	})
 }
 
 // WriteRemotePush adds an operation to a log marking the publication of a
@@ -785,7 +1007,7 @@ func (book *Book) WriteRemotePush(ctx context.Context, author *profile.Profile,
 		Relations: []string{remoteAddr},
 	})
 
-	if err = book.save(ctx, nil, nil); err != nil {
+	if err = book.save(ctx, branchLog.l); err != nil {
 		return nil, nil, err
 	}
 
@@ -808,7 +1030,7 @@ func (book *Book) WriteRemotePush(ctx context.Context, author *profile.Profile,
 			// we should consider returning copies, and adding explicit methods for
 			// modification.
 			branchLog.l.Ops = branchLog.l.Ops[:len(branchLog.l.Ops)-1]
-			rollbackError = book.save(ctx, nil, nil)
+			rollbackError = book.save(ctx, branchLog.l)
 		})
 		return rollbackError
 	}
@@ -846,7 +1068,7 @@ func (book *Book) WriteRemoteDelete(ctx context.Context, author *profile.Profile
 		Relations: []string{remoteAddr},
 	})
 
-	if err = book.save(ctx, nil, nil); err != nil {
+	if err = book.save(ctx, branchLog.l); err != nil {
 		return nil, nil, err
 	}
 
@@ -863,7 +1085,7 @@ func (book *Book) WriteRemoteDelete(ctx context.Context, author *profile.Profile
 				return
 			}
 			branchLog.l.Ops = branchLog.l.Ops[:len(branchLog.l.Ops)-1]
-			rollbackError = book.save(ctx, nil, nil)
+			rollbackError = book.save(ctx, branchLog.l)
 		})
 		return rollbackError
 	}
@@ -919,6 +1141,46 @@ func addReferencedPaths(log *oplog.Log, paths map[string]struct{}) {
 	}
 }
 
+// AllReferencedRunIDs scans an entire logbook for the run IDs of dataset
+// versions that haven't been removed
+func (book *Book) AllReferencedRunIDs(ctx context.Context) (map[string]struct{}, error) {
+	ids := map[string]struct{}{}
+	logs, err := book.ListAllLogs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range logs {
+		addReferencedRunIDs(l, ids)
+	}
+	return ids, nil
+}
+
+func addReferencedRunIDs(log *oplog.Log, ids map[string]struct{}) {
+	runIDs := []string{}
+	for _, op := range log.Ops {
+		if op.Model == CommitModel {
+			switch op.Type {
+			case oplog.OpTypeInit:
+				runIDs = append(runIDs, commitOpRunID(op))
+			case oplog.OpTypeRemove:
+				runIDs = runIDs[:len(runIDs)-int(op.Size)]
+			case oplog.OpTypeAmend:
+				runIDs[len(runIDs)-1] = commitOpRunID(op)
+			}
+		}
+	}
+	for _, id := range runIDs {
+		if id != "" {
+			ids[id] = struct{}{}
+		}
+	}
+
+	for _, l := range log.Logs {
+		addReferencedRunIDs(l, ids)
+	}
+}
+
 // Log gets a log for a given ID
 func (book Book) Log(ctx context.Context, id string) (*oplog.Log, error) {
 	return book.store.Get(ctx, id)
@@ -1127,6 +1389,14 @@ func DsrefAliasForLog(log *oplog.Log) (dsref.Ref, error) {
 	return ref, nil
 }
 
+// SetAuthorKeys checks logs merged into the book against the known keys of
+// their authors. When reject is true logs that fail checks aren't merged,
+// otherwise failures are logged as warnings
+func (book *Book) SetAuthorKeys(keys profile.Store, reject bool) {
+	book.authorKeys = keys
+	book.rejectUnverified = reject
+}
+
 // MergeLog adds a log to the logbook, merging with any existing log data
 func (book *Book) MergeLog(ctx context.Context, sender crypto.PubKey, lg *oplog.Log) error {
 	if book == nil {
@@ -1139,12 +1409,92 @@ func (book *Book) MergeLog(ctx context.Context, sender crypto.PubKey, lg *oplog.
 	if err := lg.Verify(sender); err != nil {
 		return err
 	}
+	if err := book.verifyAuthor(ctx, lg); err != nil {
+		if book.rejectUnverified {
+			return fmt.Errorf("rejecting log: %w", err)
+		}
+		log.Warnw("log author check failed", "logID", lg.ID(), "err", err)
+	}
 
 	if err := book.store.MergeLog(ctx, lg); err != nil {
 		return err
 	}
 
-	return book.save(ctx, nil, nil)
+	return book.save(ctx, nil)
+}
+
+// verifyAuthor checks the author of a log has a known key, and every author
+// operation is attributed to the author. Logs are often relayed by peers that
+// didn't write them, so the versions a log lists are checked against the
+// author's key through their commit signatures once they're fetched
+func (book *Book) verifyAuthor(ctx context.Context, lg *oplog.Log) error {
+	if book.authorKeys == nil {
+		return nil
+	}
+	if lg.Model() != UserModel {
+		return fmt.Errorf("log isn't rooted as an author")
+	}
+
+	authorID := lg.FirstOpAuthorID()
+	pid, err := profile.IDB58Decode(authorID)
+	if err != nil {
+		return fmt.Errorf("invalid log author %q", authorID)
+	}
+	pro, err := book.authorKeys.GetProfile(ctx, pid)
+	if err != nil || pro.PubKey == nil {
+		return fmt.Errorf("no public key is known for log author %s", authorID)
+	}
+	if keyID, err := key.IDFromPubKey(pro.PubKey); err != nil || keyID != authorID {
+		return fmt.Errorf("known key doesn't belong to log author %s", authorID)
+	}
+
+	for i, op := range lg.Ops {
+		if op.Model == UserModel && op.AuthorID != "" && op.AuthorID != authorID {
+			return fmt.Errorf("operation %d of log %s is attributed to %s, not log author %s", i, lg.ID(), op.AuthorID, authorID)
+		}
+	}
+	return nil
+}
+
+// SnapshotLog captures the log of a dataset, returning a function that
+// restores the log to the captured state. Restoring drops a log that didn't
+// exist when the snapshot was taken. Snapshots let callers undo a merge
+func (book *Book) SnapshotLog(ctx context.Context, ref dsref.Ref) (restore func(ctx context.Context) error, err error) {
+	if book == nil {
+		return nil, ErrNoLogbook
+	}
+
+	lookup := dsref.Ref{Username: ref.Username, Name: ref.Name, InitID: ref.InitID}
+	var prev *oplog.Log
+	if _, err := book.ResolveRef(ctx, &lookup); err == nil {
+		l, err := book.UserDatasetBranchesLog(ctx, lookup.InitID)
+		if err != nil {
+			return nil, err
+		}
+		prev = l.DeepCopy()
+	} else if !errors.Is(err, dsref.ErrRefNotFound) {
+		return nil, err
+	}
+
+	return func(ctx context.Context) error {
+		// the merge may have renamed the dataset, so existing logs are found by
+		// init ID
+		current := dsref.Ref{Username: ref.Username, Name: ref.Name}
+		if prev != nil {
+			current = dsref.Ref{InitID: lookup.InitID}
+		}
+		if _, err := book.ResolveRef(ctx, &current); err == nil {
+			if err := book.store.RemoveLog(ctx, dsRefToLogPath(current)...); err != nil {
+				return err
+			}
+		}
+		if prev != nil {
+			if err := book.store.MergeLog(ctx, prev.DeepCopy()); err != nil {
+				return err
+			}
+		}
+		return book.save(ctx, nil)
+	}, nil
 }
 
 // RemoveLog removes an entire log from a logbook
@@ -1153,7 +1503,7 @@ func (book *Book) RemoveLog(ctx context.Context, ref dsref.Ref) error {
 		return ErrNoLogbook
 	}
 	book.store.RemoveLog(ctx, dsRefToLogPath(ref)...)
-	return book.save(ctx, nil, nil)
+	return book.save(ctx, nil)
 }
 
 func dsRefToLogPath(ref dsref.Ref) (path []string) {
@@ -1193,7 +1543,7 @@ func (book *Book) ConstructDatasetLog(ctx context.Context, author *profile.Profi
 	for _, ds := range history {
 		book.appendVersionSave(branchLog, ds)
 	}
-	return book.save(ctx, nil, nil)
+	return book.save(ctx, branchLog.l)
 }
 
 func commitOpRunID(op oplog.Op) string {
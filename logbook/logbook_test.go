@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 	"time"
@@ -14,6 +16,8 @@ import (
 	crypto "github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/qfs"
+	"github.com/qri-io/qfs/localfs"
+	"github.com/qri-io/qri/auth/key"
 	testkeys "github.com/qri-io/qri/auth/key/test"
 	"github.com/qri-io/qri/automation/run"
 	"github.com/qri-io/qri/dsref"
@@ -184,6 +188,73 @@ func TestNewJournal(t *testing.T) {
 	}
 }
 
+func TestNewSegmentJournal(t *testing.T) {
+	tr, cleanup := newTestRunner(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "segment_journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// write to a journal first, so the segmented book imports it
+	fs, err := localfs.NewFS(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journalPath := filepath.Join(dir, "logbook.qfb")
+	journal, err := logbook.NewJournal(*tr.Owner, tr.bus, fs, journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Book = journal
+	initID := tr.WriteWorldBankExample(t)
+	expect, err := tr.Book.PlainLogs(tr.Ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segmentsDir := filepath.Join(dir, "logbook")
+
+	if _, err := logbook.NewSegmentJournal(*tr.Owner, tr.bus, nil, "", ""); err == nil {
+		t.Errorf("expected missing directory arg to error")
+	}
+
+	book, err := logbook.NewSegmentJournal(*tr.Owner, tr.bus, fs, journalPath, segmentsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := book.PlainLogs(tr.Ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("imported logs mismatch (-want +got):\n%s", diff)
+	}
+
+	tr.Book = book
+	tr.WriteMoreWorldBankCommits(t, initID)
+	if expect, err = book.PlainLogs(tr.Ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := book.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopening reads segments, not the journal
+	book, err = logbook.NewSegmentJournal(*tr.Owner, tr.bus, nil, "", segmentsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer book.Close()
+	if got, err = book.PlainLogs(tr.Ctx); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("reopened logs mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestNilCallable(t *testing.T) {
 	var (
 		book   *logbook.Book
@@ -424,6 +495,9 @@ func TestWritePermissions(t *testing.T) {
 	if err := tr.Book.WriteVersionDelete(ctx, author, initID, 1); !errors.Is(err, logbook.ErrAccessDenied) {
 		t.Errorf("WriteVersionDelete to an oplog the book author doesn't own must return a wrap of logbook.ErrAccessDenied")
 	}
+	if err := tr.Book.WriteVersionDrop(ctx, author, initID, map[string]struct{}{"/ipld/QmExample": {}}); !errors.Is(err, logbook.ErrAccessDenied) {
+		t.Errorf("WriteVersionDrop to an oplog the book author doesn't own must return a wrap of logbook.ErrAccessDenied")
+	}
 	if _, _, err := tr.Book.WriteRemotePush(ctx, author, initID, 1, "https://registry.example.com"); !errors.Is(err, logbook.ErrAccessDenied) {
 		t.Errorf("WriteRemotePush to an oplog the book author doesn't own must return a wrap of logbook.ErrAccessDenied")
 	}
@@ -736,6 +810,75 @@ func TestLogTransfer(t *testing.T) {
 	}
 }
 
+func TestMergeLogAuthorKeys(t *testing.T) {
+	tr, cleanup := newTestRunner(t)
+	defer cleanup()
+
+	tr.WriteWorldBankExample(t)
+	lg, err := tr.Book.UserDatasetBranchesLog(tr.Ctx, tr.WorldBankRef().InitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lg.Sign(tr.Book.Owner().PrivKey); err != nil {
+		t.Fatal(err)
+	}
+
+	pro2 := mustProfileFromPrivKey("user_2", testPrivKey2(t))
+	newBook := func(reject bool) (*logbook.Book, profile.Store) {
+		ks, err := key.NewMemStore()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys, err := profile.NewMemStore(tr.Ctx, pro2, ks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		book, err := logbook.NewJournal(*pro2, tr.bus, qfs.NewMemFS(), "/mem/fs2_location.qfb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		book.SetAuthorKeys(keys, reject)
+		return book, keys
+	}
+
+	// warnings don't block merging
+	book, _ := newBook(false)
+	if err := book.MergeLog(tr.Ctx, tr.Book.Owner().PubKey, lg.DeepCopy()); err != nil {
+		t.Errorf("expected merging a log with an unknown author key to warn, got: %s", err)
+	}
+
+	book, keys := newBook(true)
+	if err := book.MergeLog(tr.Ctx, tr.Book.Owner().PubKey, lg.DeepCopy()); err == nil {
+		t.Error("expected merging a log with an unknown author key to fail")
+	}
+	if _, err := book.RefToInitID(tr.WorldBankRef()); err == nil {
+		t.Error("expected rejected log not to be merged")
+	}
+
+	author := &profile.Profile{ID: tr.Owner.ID, Peername: tr.Owner.Peername, PubKey: tr.Owner.PubKey}
+	if err := keys.PutProfile(tr.Ctx, author); err != nil {
+		t.Fatal(err)
+	}
+	// logs relayed by other peers are signed by the sender
+	relayed := lg.DeepCopy()
+	if err := relayed.Sign(pro2.PrivKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := book.MergeLog(tr.Ctx, pro2.PubKey, relayed); err != nil {
+		t.Errorf("expected merging a log with a known author key to succeed, got: %s", err)
+	}
+
+	// a known key must belong to the author
+	book, keys = newBook(true)
+	impostor := &profile.Profile{ID: tr.Owner.ID, Peername: tr.Owner.Peername, PubKey: pro2.PubKey}
+	if err := keys.PutProfile(tr.Ctx, impostor); err != nil {
+		t.Fatal(err)
+	}
+	if err := book.MergeLog(tr.Ctx, tr.Book.Owner().PubKey, lg.DeepCopy()); err == nil {
+		t.Error("expected merging a log with a known key that isn't the author's to fail")
+	}
+}
+
 // Test a particularly tricky situation: a user authored and pushed a dataset to a remote. Then,
 // they reinitialize their repository with the same profileID. This creates a new logbook entry,
 // thus they have the same profileID but a different userCreateID. Then they push again to the
@@ -928,6 +1071,52 @@ func TestItems(t *testing.T) {
 	}
 }
 
+func TestWriteVersionDrop(t *testing.T) {
+	tr, cleanup := newTestRunner(t)
+	defer cleanup()
+
+	initID := tr.WriteWorldBankExample(t)
+	tr.WriteMoreWorldBankCommits(t, initID)
+	book := tr.Book
+
+	paths := func() []string {
+		items, err := book.Items(tr.Ctx, tr.WorldBankRef(), 0, -1, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps := make([]string, len(items))
+		for i, item := range items {
+			ps[i] = item.Path
+		}
+		return ps
+	}
+	before := paths()
+	if len(before) < 3 {
+		t.Fatalf("expected at least 3 versions, got %d", len(before))
+	}
+
+	if err := book.WriteVersionDrop(tr.Ctx, tr.Owner, initID, map[string]struct{}{before[0]: {}}); err == nil {
+		t.Error("expected dropping the latest version to fail")
+	}
+
+	// dropping a version from the middle of history keeps newer versions
+	if err := book.WriteVersionDrop(tr.Ctx, tr.Owner, initID, map[string]struct{}{before[1]: {}}); err != nil {
+		t.Fatal(err)
+	}
+	expect := append([]string{before[0]}, before[2:]...)
+	if diff := cmp.Diff(expect, paths()); diff != "" {
+		t.Errorf("history mismatch (-want +got):\n%s", diff)
+	}
+
+	// dropping versions that aren't in history is a no-op
+	if err := book.WriteVersionDrop(tr.Ctx, tr.Owner, initID, map[string]struct{}{before[1]: {}}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expect, paths()); diff != "" {
+		t.Errorf("history mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestFilteredItems(t *testing.T) {
 	tr, cleanup := newTestRunner(t)
 	defer cleanup()
@@ -650,6 +650,9 @@ LOOP:
 
 // Verify confirms that the signature for a log matches
 func (lg Log) Verify(pub crypto.PubKey) error {
+	if len(lg.Signature) == 0 {
+		return fmt.Errorf("log is not signed")
+	}
 	ok, err := pub.Verify(lg.SigningBytes(), lg.Signature)
 	if err != nil {
 		return err
@@ -0,0 +1,754 @@
+package oplog
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	golog "github.com/ipfs/go-log"
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/qri-io/qri/logbook/oplog/logfb"
+)
+
+var log = golog.Logger("oplog")
+
+const (
+	segmentExt  = ".segment"
+	snapshotExt = ".snapshot"
+	tmpExt      = ".tmp"
+
+	// record header is a 4-byte big-endian ciphertext length
+	recordHeaderSize = 4
+	// records larger than this are treated as corrupt
+	maxRecordSize = 1 << 30
+)
+
+// segment record kinds
+const (
+	recordPut byte = iota + 1
+	recordMerge
+	recordRemove
+	recordReplaceAll
+	recordPutOps
+)
+
+var (
+	// ErrStoreClosed indicates a write to a closed SegmentStore
+	ErrStoreClosed = fmt.Errorf("oplog: store is closed")
+	// errPartialRecord marks a record that was cut short, or can't be read.
+	// records after a partial record are unreachable
+	errPartialRecord = errors.New("partial record")
+)
+
+// SegmentStoreOptions configures a SegmentStore
+type SegmentStoreOptions struct {
+	// MaxSegmentSize is the size in bytes a segment grows to before writes
+	// move to a new segment
+	MaxSegmentSize int64
+	// CompactAfter is the number of full segments that triggers background
+	// compaction into a snapshot. values < 1 disable background compaction
+	CompactAfter int
+}
+
+// DefaultSegmentStoreOptions returns the default SegmentStore configuration
+func DefaultSegmentStoreOptions() SegmentStoreOptions {
+	return SegmentStoreOptions{
+		MaxSegmentSize: 1 << 20,
+		CompactAfter:   8,
+	}
+}
+
+// SegmentStore is an AuthorLogstore alternative that keeps a journal in memory
+// and persists changes to a directory of append-only segments. Each change is
+// written as a single encrypted record that holds only the affected logs, so
+// the cost of a write is independent of the size of the store.
+//
+// Full segments are periodically compacted in the background into an
+// encrypted snapshot of the journal. On open the newest snapshot is loaded and
+// all later segments are replayed. A record left incomplete by a crash is
+// truncated, dropping only the change it held
+type SegmentStore struct {
+	dir  string
+	opts SegmentStoreOptions
+	gcm  cipher.AEAD
+
+	// compactLk serializes compactions
+	compactLk sync.Mutex
+	wg        sync.WaitGroup
+
+	lk         sync.Mutex
+	j          Journal
+	f          *os.File // open segment
+	seq        uint64   // sequence number of the open segment
+	size       int64    // size of the open segment in bytes
+	full       int      // count of full segments written since the last snapshot
+	compacting bool
+}
+
+// assert at compile time that a SegmentStore pointer is a Logstore
+var _ Logstore = (*SegmentStore)(nil)
+
+// OpenSegmentStore opens the segment store at dir, creating the directory if
+// it doesn't exist. records are encrypted with the given private key
+func OpenSegmentStore(dir string, pk crypto.PrivKey, opts ...func(o *SegmentStoreOptions)) (*SegmentStore, error) {
+	if pk == nil {
+		return nil, fmt.Errorf("oplog: private key is required")
+	}
+	o := DefaultSegmentStoreOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	gcm, err := Journal{}.cipher(pk)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	s := &SegmentStore{dir: dir, opts: o, gcm: gcm}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Empty is true when the store holds no logs
+func (s *SegmentStore) Empty() bool {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return len(s.j.logs) == 0
+}
+
+// Import replaces the contents of the store with the logs of a journal,
+// writing them as a snapshot
+func (s *SegmentStore) Import(ctx context.Context, j *Journal) error {
+	upTo, err := s.rotate()
+	if err != nil {
+		return err
+	}
+
+	s.compactLk.Lock()
+	defer s.compactLk.Unlock()
+	if err := s.writeSnapshot(upTo, j.flatbufferBytes()); err != nil {
+		return err
+	}
+	s.lk.Lock()
+	s.j = *j
+	s.full = int(s.seq - 1 - upTo)
+	s.lk.Unlock()
+	return s.removeCompacted(upTo)
+}
+
+// MergeLog adds a log to the store, see Journal.MergeLog
+func (s *SegmentStore) MergeLog(ctx context.Context, incoming *Log) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	// encode before merging, merging may attach incoming logs to the journal
+	data := incoming.FlatbufferBytes()
+	if err := s.j.MergeLog(ctx, incoming); err != nil {
+		return err
+	}
+	return s.append(recordMerge, data)
+}
+
+// RemoveLog removes a log from the store, see Journal.RemoveLog
+func (s *SegmentStore) RemoveLog(ctx context.Context, names ...string) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if err := s.j.RemoveLog(ctx, names...); err != nil {
+		return err
+	}
+	return s.append(recordRemove, []byte(strings.Join(names, "\x00")))
+}
+
+// ReplaceAll replaces the contents of the store
+func (s *SegmentStore) ReplaceAll(ctx context.Context, l *Log) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	data := l.FlatbufferBytes()
+	if err := s.j.ReplaceAll(ctx, l); err != nil {
+		return err
+	}
+	return s.append(recordReplaceAll, data)
+}
+
+// PutLog records the current state of a log in the store and all of its
+// descendants. The log must already be part of the store, PutLog persists
+// changes made to it in place. Ancestors of the log are written without
+// their other descendants
+func (s *SegmentStore) PutLog(ctx context.Context, l *Log) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.put(ctx, recordPut, l, l)
+}
+
+// PutOps records the current operations of a log in the store, without
+// writing any of its descendants. Use PutOps when a change only appends to a
+// log with many descendants, like renaming an author
+func (s *SegmentStore) PutOps(ctx context.Context, l *Log) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.put(ctx, recordPutOps, l, &Log{Ops: l.Ops, Signature: l.Signature})
+}
+
+// put writes a record of kind for the log l, holding target wrapped in a
+// hierarchy of l's ancestors. callers must hold s.lk
+func (s *SegmentStore) put(ctx context.Context, kind byte, l, target *Log) error {
+	id := l.ID()
+	root := target
+	for cursor := l; cursor.ParentID != ""; {
+		parent, err := s.j.Get(ctx, cursor.ParentID)
+		if err != nil {
+			return fmt.Errorf("getting parent of log %s: %w", cursor.ID(), err)
+		}
+		root = &Log{
+			Ops:       parent.Ops,
+			Signature: parent.Signature,
+			Logs:      []*Log{root},
+		}
+		cursor = parent
+	}
+
+	data := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(id))
+	data = append(data[:binary.PutUvarint(data, uint64(len(id)))], id...)
+	return s.append(kind, append(data, root.FlatbufferBytes()...))
+}
+
+// Get fetches a log for a given ID
+func (s *SegmentStore) Get(ctx context.Context, id string) (*Log, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.j.Get(ctx, id)
+}
+
+// GetAuthorID fetches the first log that matches the given model and authorID
+func (s *SegmentStore) GetAuthorID(ctx context.Context, model uint32, authorID string) (*Log, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.j.GetAuthorID(ctx, model, authorID)
+}
+
+// HeadRef traverses the log graph & pulls out a log based on named head
+// references
+func (s *SegmentStore) HeadRef(ctx context.Context, names ...string) (*Log, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.j.HeadRef(ctx, names...)
+}
+
+// Logs returns top level logs in the store
+func (s *SegmentStore) Logs(ctx context.Context, offset, limit int) ([]*Log, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.j.Logs(ctx, offset, limit)
+}
+
+// Children gets all descentants of a log
+func (s *SegmentStore) Children(ctx context.Context, l *Log) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.j.Children(ctx, l)
+}
+
+// Descendants gets all descentants of a log & assigns the results to the given
+// Log parameter, setting only the Logs field
+func (s *SegmentStore) Descendants(ctx context.Context, l *Log) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.j.Descendants(ctx, l)
+}
+
+// Compact writes a snapshot of all changes written so far and removes
+// segments the snapshot replaces
+func (s *SegmentStore) Compact(ctx context.Context) error {
+	upTo, err := s.rotate()
+	if err != nil {
+		return err
+	}
+	return s.compact(upTo)
+}
+
+// Close waits for background compaction to finish and closes the open
+// segment. Writes to a closed store fail with ErrStoreClosed
+func (s *SegmentStore) Close() error {
+	s.lk.Lock()
+	var err error
+	if s.f != nil {
+		err = s.f.Close()
+		s.f = nil
+	}
+	s.lk.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// append writes a record to the open segment, moving to a new segment when
+// the open one is full. callers must hold s.lk
+func (s *SegmentStore) append(kind byte, data []byte) error {
+	if s.f == nil {
+		return ErrStoreClosed
+	}
+
+	nonce := make([]byte, s.gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	ciphertext := s.gcm.Seal(nonce, nonce, append([]byte{kind}, data...), nil)
+
+	rec := make([]byte, recordHeaderSize+len(ciphertext))
+	binary.BigEndian.PutUint32(rec, uint32(len(ciphertext)))
+	copy(rec[recordHeaderSize:], ciphertext)
+
+	if _, err := s.f.Write(rec); err != nil {
+		// drop whatever part of the record made it to disk
+		if terr := s.f.Truncate(s.size); terr != nil {
+			log.Errorw("truncating partial record", "segment", s.f.Name(), "err", terr)
+		}
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	s.size += int64(len(rec))
+
+	if s.size >= s.opts.MaxSegmentSize {
+		if err := s.nextSegment(); err != nil {
+			return err
+		}
+		s.maybeCompact()
+	}
+	return nil
+}
+
+// nextSegment closes the open segment & opens the next one in sequence.
+// callers must hold s.lk
+func (s *SegmentStore) nextSegment() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	s.full++
+	return s.openSegment(s.seq+1, 0)
+}
+
+// rotate moves writes to a new segment if the open segment has any records,
+// so all prior records are in segments that won't be written to again.
+// returns the sequence number of the last of those segments
+func (s *SegmentStore) rotate() (uint64, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.f == nil {
+		return 0, ErrStoreClosed
+	}
+	if s.size > 0 {
+		if err := s.nextSegment(); err != nil {
+			return 0, err
+		}
+	}
+	return s.seq - 1, nil
+}
+
+// maybeCompact starts a background compaction if enough segments have filled
+// up since the last snapshot. callers must hold s.lk
+func (s *SegmentStore) maybeCompact() {
+	if s.opts.CompactAfter < 1 || s.full < s.opts.CompactAfter || s.compacting {
+		return
+	}
+	s.compacting = true
+	upTo := s.seq - 1
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.compact(upTo); err != nil {
+			log.Errorw("compacting logbook segments", "dir", s.dir, "err", err)
+		}
+		s.lk.Lock()
+		s.compacting = false
+		s.lk.Unlock()
+	}()
+}
+
+// compact writes a snapshot of the store as of the end of segment upTo,
+// removing segments & snapshots the new snapshot replaces. compaction only
+// reads segments that are no longer written to, and doesn't touch the
+// in-memory journal
+func (s *SegmentStore) compact(upTo uint64) error {
+	s.compactLk.Lock()
+	defer s.compactLk.Unlock()
+
+	files, err := s.listFiles()
+	if err != nil {
+		return err
+	}
+	j, base, err := s.loadSnapshot(files.snapshots, upTo)
+	if err != nil {
+		return err
+	}
+	if base == upTo {
+		return nil
+	}
+	for _, seq := range files.segments {
+		if seq <= base || seq > upTo {
+			continue
+		}
+		if _, err := s.replaySegment(j, seq); err != nil {
+			return err
+		}
+	}
+
+	if err := s.writeSnapshot(upTo, j.flatbufferBytes()); err != nil {
+		return err
+	}
+
+	s.lk.Lock()
+	s.full = int(s.seq - 1 - upTo)
+	s.lk.Unlock()
+	return s.removeCompacted(upTo)
+}
+
+// writeSnapshot atomically writes an encrypted snapshot covering all segments
+// up to & including seq
+func (s *SegmentStore) writeSnapshot(seq uint64, plaintext []byte) error {
+	ciphertext, err := s.encrypt(plaintext)
+	if err != nil {
+		return err
+	}
+
+	path := s.path(seq, snapshotExt)
+	f, err := os.Create(path + tmpExt)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(ciphertext); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+tmpExt, path); err != nil {
+		return err
+	}
+	s.syncDir()
+	return nil
+}
+
+// removeCompacted deletes segments a snapshot covers, and older snapshots
+func (s *SegmentStore) removeCompacted(upTo uint64) error {
+	files, err := s.listFiles()
+	if err != nil {
+		return err
+	}
+	for _, seq := range files.segments {
+		if seq <= upTo {
+			if err := os.Remove(s.path(seq, segmentExt)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	for _, seq := range files.snapshots {
+		if seq < upTo {
+			if err := os.Remove(s.path(seq, snapshotExt)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	s.syncDir()
+	return nil
+}
+
+// load reads the newest snapshot & replays all later segments, truncating a
+// partial record at the end of the last segment
+func (s *SegmentStore) load() error {
+	files, err := s.listFiles()
+	if err != nil {
+		return err
+	}
+	for _, tmp := range files.tmp {
+		os.Remove(filepath.Join(s.dir, tmp))
+	}
+
+	j, base, err := s.loadSnapshot(files.snapshots, ^uint64(0))
+	if err != nil {
+		return err
+	}
+
+	var segments []uint64
+	for _, seq := range files.segments {
+		if seq > base {
+			segments = append(segments, seq)
+		}
+	}
+
+	seq, size := base+1, int64(0)
+	for i, segSeq := range segments {
+		valid, err := s.replaySegment(j, segSeq)
+		if err != nil {
+			if !errors.Is(err, errPartialRecord) || i != len(segments)-1 {
+				return err
+			}
+			log.Warnw("truncating partial logbook segment", "segment", s.path(segSeq, segmentExt), "size", valid, "err", err)
+			if err := os.Truncate(s.path(segSeq, segmentExt), valid); err != nil {
+				return err
+			}
+		}
+		seq, size = segSeq, valid
+	}
+	if size >= s.opts.MaxSegmentSize {
+		seq, size = seq+1, 0
+	}
+	for _, segSeq := range segments {
+		if segSeq < seq {
+			s.full++
+		}
+	}
+
+	s.j = *j
+	return s.openSegment(seq, size)
+}
+
+// openSegment opens a segment for appending. callers must hold s.lk
+func (s *SegmentStore) openSegment(seq uint64, size int64) error {
+	f, err := os.OpenFile(s.path(seq, segmentExt), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.f, s.seq, s.size = f, seq, size
+	return nil
+}
+
+// loadSnapshot reads the newest readable snapshot with a sequence number no
+// greater than upTo, returning the journal it holds and the sequence of the
+// last segment it covers. A store without snapshots starts from an empty
+// journal
+func (s *SegmentStore) loadSnapshot(snapshots []uint64, upTo uint64) (*Journal, uint64, error) {
+	var lastErr error
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		seq := snapshots[i]
+		if seq > upTo {
+			continue
+		}
+		j, err := s.readSnapshot(seq)
+		if err != nil {
+			log.Warnw("reading logbook snapshot", "snapshot", s.path(seq, snapshotExt), "err", err)
+			lastErr = err
+			continue
+		}
+		return j, seq, nil
+	}
+	if lastErr != nil {
+		return nil, 0, fmt.Errorf("oplog: no readable snapshot: %w", lastErr)
+	}
+	return &Journal{}, 0, nil
+}
+
+func (s *SegmentStore) readSnapshot(seq uint64) (*Journal, error) {
+	ciphertext, err := ioutil.ReadFile(s.path(seq, snapshotExt))
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := s.decrypt(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{}
+	if err := j.unmarshalFlatbuffer(logfb.GetRootAsBook(plaintext, 0)); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// replaySegment applies all records in a segment to a journal, returning the
+// size in bytes of the complete records that were read. errors wrap
+// errPartialRecord if the segment ends with a record that can't be read
+func (s *SegmentStore) replaySegment(j *Journal, seq uint64) (int64, error) {
+	path := s.path(seq, segmentExt)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var offset int64
+	for int64(len(data)) > offset {
+		rest := data[offset:]
+		if len(rest) < recordHeaderSize {
+			return offset, fmt.Errorf("%w at offset %d of %s", errPartialRecord, offset, path)
+		}
+		length := int64(binary.BigEndian.Uint32(rest))
+		if length > maxRecordSize || int64(len(rest)) < recordHeaderSize+length {
+			return offset, fmt.Errorf("%w at offset %d of %s", errPartialRecord, offset, path)
+		}
+		plaintext, err := s.decrypt(rest[recordHeaderSize : recordHeaderSize+length])
+		if err != nil || len(plaintext) == 0 {
+			return offset, fmt.Errorf("%w at offset %d of %s", errPartialRecord, offset, path)
+		}
+		if err := applyRecord(j, plaintext[0], plaintext[1:]); err != nil {
+			return offset, fmt.Errorf("applying record at offset %d of %s: %w", offset, path, err)
+		}
+		offset += recordHeaderSize + length
+	}
+	return offset, nil
+}
+
+// applyRecord replays a single change to a journal
+func applyRecord(j *Journal, kind byte, data []byte) error {
+	ctx := context.Background()
+	switch kind {
+	case recordPut, recordPutOps:
+		idLen, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < idLen {
+			return fmt.Errorf("invalid put record")
+		}
+		id := string(data[n : n+int(idLen)])
+		l := &Log{}
+		if err := l.UnmarshalFlatbufferBytes(data[n+int(idLen):]); err != nil {
+			return err
+		}
+		j.putLog(id, l, kind == recordPutOps)
+		return nil
+	case recordMerge:
+		l := &Log{}
+		if err := l.UnmarshalFlatbufferBytes(data); err != nil {
+			return err
+		}
+		return j.MergeLog(ctx, l)
+	case recordRemove:
+		return j.RemoveLog(ctx, strings.Split(string(data), "\x00")...)
+	case recordReplaceAll:
+		l := &Log{}
+		if err := l.UnmarshalFlatbufferBytes(data); err != nil {
+			return err
+		}
+		return j.ReplaceAll(ctx, l)
+	}
+	return fmt.Errorf("unknown record kind %d", kind)
+}
+
+// putLog writes a log & all descendants to the journal. root is a hierarchy
+// of ancestors of the log with id, each with a single child. ancestor ops are
+// updated, the log with id replaces any existing log with the same id. When
+// opsOnly is true the existing log keeps its descendants and only has its ops
+// updated
+func (j *Journal) putLog(id string, root *Log, opsOnly bool) {
+	var parent *Log
+	siblings := &j.logs
+	for cursor := root; ; cursor = cursor.Logs[0] {
+		var existing *Log
+		idx := -1
+		for i, l := range *siblings {
+			if l.ID() == cursor.ID() {
+				existing, idx = l, i
+				break
+			}
+		}
+
+		if existing == nil {
+			if parent == nil {
+				j.logs = append(j.logs, cursor)
+			} else {
+				parent.AddChild(cursor)
+			}
+			return
+		}
+
+		if cursor.ID() == id && opsOnly {
+			existing.Ops = cursor.Ops
+			existing.Signature = cursor.Signature
+			existing.name = ""
+			existing.authorID = ""
+			return
+		}
+		if cursor.ID() == id || len(cursor.Logs) == 0 {
+			if parent != nil {
+				cursor.ParentID = parent.ID()
+				cursor.parent = parent
+			}
+			(*siblings)[idx] = cursor
+			return
+		}
+
+		existing.Ops = cursor.Ops
+		existing.Signature = cursor.Signature
+		existing.name = ""
+		existing.authorID = ""
+		parent = existing
+		siblings = &existing.Logs
+	}
+}
+
+func (s *SegmentStore) encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, s.gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return s.gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (s *SegmentStore) decrypt(ciphertext []byte) ([]byte, error) {
+	nonceSize := s.gcm.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	return s.gcm.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], nil)
+}
+
+func (s *SegmentStore) path(seq uint64, ext string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, ext))
+}
+
+// syncDir flushes directory entries, making renames & removals durable
+func (s *SegmentStore) syncDir() {
+	if d, err := os.Open(s.dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+type segmentFiles struct {
+	snapshots []uint64
+	segments  []uint64
+	tmp       []string
+}
+
+// listFiles reads the sequence numbers of snapshots & segments in the store
+// directory, sorted in ascending order
+func (s *SegmentStore) listFiles() (segmentFiles, error) {
+	files := segmentFiles{}
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return files, err
+	}
+	for _, fi := range infos {
+		name := fi.Name()
+		switch {
+		case strings.HasSuffix(name, tmpExt):
+			files.tmp = append(files.tmp, name)
+		case strings.HasSuffix(name, segmentExt):
+			if seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64); err == nil {
+				files.segments = append(files.segments, seq)
+			}
+		case strings.HasSuffix(name, snapshotExt):
+			if seq, err := strconv.ParseUint(strings.TrimSuffix(name, snapshotExt), 10, 64); err == nil {
+				files.snapshots = append(files.snapshots, seq)
+			}
+		}
+	}
+	sort.Slice(files.segments, func(i, j int) bool { return files.segments[i] < files.segments[j] })
+	sort.Slice(files.snapshots, func(i, j int) bool { return files.snapshots[i] < files.snapshots[j] })
+	return files, nil
+}
@@ -0,0 +1,212 @@
+package oplog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSegmentStoreRecovery(t *testing.T) {
+	tr, cleanup := newTestRunner(t)
+	defer cleanup()
+	ctx := tr.Ctx
+
+	dir, err := ioutil.TempDir("", "segment_store_recovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenSegmentStore(dir, tr.PrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := InitLog(Op{Type: OpTypeInit, Model: 0x1, AuthorID: "author", Name: "root"})
+	a := InitLog(Op{Type: OpTypeInit, Model: 0x2, AuthorID: "author", Name: "a"})
+	b := tr.RandomLog(Op{Type: OpTypeInit, Model: 0x2, AuthorID: "author", Name: "b"}, 500)
+	root.AddChild(a)
+	root.AddChild(b)
+	if err := s.MergeLog(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	// putting a child log writes only that log & sparse ancestors
+	before := s.size
+	a.Append(Op{Type: OpTypeAmend, Model: 0x2, Name: "a_renamed"})
+	a.AddChild(InitLog(Op{Type: OpTypeInit, Model: 0x3, AuthorID: "author", Name: "main"}))
+	if err := s.PutLog(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if written, siblingSize := s.size-before, int64(len(b.FlatbufferBytes())); written >= siblingSize {
+		t.Errorf("expected putting a log to write less than the size of an unchanged sibling log. wrote %d bytes, sibling is %d bytes", written, siblingSize)
+	}
+
+	// putting a log's ops doesn't write its descendants
+	before = s.size
+	root.Append(Op{Type: OpTypeAmend, Model: 0x1, Name: "root_renamed"})
+	if err := s.PutOps(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	if written, siblingSize := s.size-before, int64(len(b.FlatbufferBytes())); written >= siblingSize {
+		t.Errorf("expected putting ops to write less than the size of a descendant log. wrote %d bytes, descendant is %d bytes", written, siblingSize)
+	}
+
+	if err := s.RemoveLog(ctx, "root_renamed", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := s.j.flatbufferBytes()
+	segment := s.path(s.seq, segmentExt)
+	validSize := s.size
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a crash in the middle of writing a record
+	f, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, recordHeaderSize)
+	binary.BigEndian.PutUint32(header, 100)
+	f.Write(append(header, []byte("partial")...))
+	f.Close()
+
+	s, err = OpenSegmentStore(dir, tr.PrivKey)
+	if err != nil {
+		t.Fatalf("opening store with a partial record: %s", err)
+	}
+	if !bytes.Equal(expect, s.j.flatbufferBytes()) {
+		t.Errorf("recovered store doesn't match state before crash")
+	}
+	if fi, err := os.Stat(segment); err != nil {
+		t.Fatal(err)
+	} else if fi.Size() != validSize {
+		t.Errorf("expected partial record to be truncated. want segment size %d, got %d", validSize, fi.Size())
+	}
+
+	got, err := s.HeadRef(ctx, "root_renamed", "a_renamed", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Append(Op{Type: OpTypeInit, Model: 0x4})
+	if err := s.PutLog(ctx, got); err != nil {
+		t.Fatalf("writing after recovery: %s", err)
+	}
+	expect = s.j.flatbufferBytes()
+	s.Close()
+
+	s, err = OpenSegmentStore(dir, tr.PrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if !bytes.Equal(expect, s.j.flatbufferBytes()) {
+		t.Errorf("reopened store doesn't match state after recovery")
+	}
+}
+
+func TestSegmentStoreCompaction(t *testing.T) {
+	tr, cleanup := newTestRunner(t)
+	defer cleanup()
+	ctx := tr.Ctx
+
+	dir, err := ioutil.TempDir("", "segment_store_compaction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// every record fills a segment
+	tinySegments := func(o *SegmentStoreOptions) {
+		o.MaxSegmentSize = 1
+		o.CompactAfter = 0
+	}
+	s, err := OpenSegmentStore(dir, tr.PrivKey, tinySegments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := InitLog(Op{Type: OpTypeInit, Model: 0x1, AuthorID: "author", Name: "root"})
+	if err := s.MergeLog(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		root.Append(tr.gen.Gen())
+		if err := s.PutLog(ctx, root); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := s.listFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files.snapshots) != 0 || len(files.segments) != 7 {
+		t.Errorf("expected 0 snapshots & 7 segments before compaction, got %d & %d", len(files.snapshots), len(files.segments))
+	}
+
+	if err := s.Compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if files, err = s.listFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if len(files.snapshots) != 1 || len(files.segments) != 1 {
+		t.Errorf("expected 1 snapshot & 1 segment after compaction, got %d & %d", len(files.snapshots), len(files.segments))
+	}
+
+	expect := s.j.flatbufferBytes()
+	s.Close()
+	if s, err = OpenSegmentStore(dir, tr.PrivKey, tinySegments); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expect, s.j.flatbufferBytes()) {
+		t.Errorf("store loaded from snapshot doesn't match compacted store")
+	}
+	s.Close()
+
+	// background compaction
+	s, err = OpenSegmentStore(dir, tr.PrivKey, func(o *SegmentStoreOptions) {
+		o.MaxSegmentSize = 1
+		o.CompactAfter = 3
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err = s.Get(ctx, root.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		root.Append(tr.gen.Gen())
+		if err := s.PutLog(ctx, root); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect = s.j.flatbufferBytes()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, err = s.listFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if len(files.snapshots) != 1 || files.snapshots[0] == 0 {
+		t.Errorf("expected background compaction to write a new snapshot, got snapshots %v", files.snapshots)
+	}
+	if len(files.segments) >= 10 {
+		t.Errorf("expected background compaction to remove segments, got %d segments", len(files.segments))
+	}
+
+	if s, err = OpenSegmentStore(dir, tr.PrivKey); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if !bytes.Equal(expect, s.j.flatbufferBytes()) {
+		t.Errorf("store loaded after background compaction doesn't match")
+	}
+}
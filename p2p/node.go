@@ -132,6 +132,15 @@ func (n *QriNode) Host() host.Host {
 	return n.host
 }
 
+// SignaturePolicy returns the configured policy for datasets fetched from
+// peers that fail signature checks
+func (n *QriNode) SignaturePolicy() string {
+	if n.cfg == nil {
+		return ""
+	}
+	return n.cfg.SignaturePolicy
+}
+
 // GoOnline puts QriNode on the distributed web, ensuring there's an active peer-2-peer host
 // participating in a peer-2-peer network, and kicks off requests to connect to known bootstrap
 // peers that support the QriProtocol
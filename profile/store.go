@@ -67,7 +67,7 @@ func NewStore(ctx context.Context, cfg *config.Config, keyStore key.Store) (Stor
 	}
 
 	// Don't create a localstore with the empty path, this will use the current directory
-	if cfg.Repo.Type == "fs" && cfg.Path() == "" {
+	if (cfg.Repo.Type == "fs" || cfg.Repo.Type == "sqlite") && cfg.Path() == "" {
 		return nil, fmt.Errorf("new Profile.FilesystemStore requires non-empty path")
 	}
 
@@ -76,7 +76,7 @@ func NewStore(ctx context.Context, cfg *config.Config, keyStore key.Store) (Stor
 	}
 
 	switch cfg.Repo.Type {
-	case "fs":
+	case "fs", "sqlite":
 		return NewLocalStore(ctx, filepath.Join(filepath.Dir(cfg.Path()), "peers.json"), pro, keyStore)
 	case "mem":
 		return NewMemStore(ctx, pro, keyStore)
@@ -0,0 +1,194 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qri/base"
+	"github.com/qri-io/qri/base/bodyquery"
+	"github.com/qri-io/qri/base/dsfs"
+	"github.com/qri-io/qri/dsref"
+	qhttp "github.com/qri-io/qri/lib/http"
+)
+
+// BodyErrorTrailer is the HTTP trailer a remote sets when reading a body
+// fails after entries have been sent
+const BodyErrorTrailer = "Body-Error"
+
+// maxRemoteSortedEntries caps offset + limit of sorted body queries a remote
+// answers. paging with continuation tokens reads past the cap
+const maxRemoteSortedEntries = 1000
+
+// BodyQuery describes a range of entries to read from the body of a dataset
+// version stored on a remote
+type BodyQuery struct {
+	// Where is a predicate expression entries must match
+	Where string
+	// Columns is a comma-separated list of columns to include in each entry
+	Columns string
+	// Sort is the column to sort entries by, prefix with "-" to sort in
+	// descending order
+	Sort string
+	// Token continues reading from where a previous query ended
+	Token string
+	// Offset is the number of matching entries to skip
+	Offset int
+	// Limit is the maximum number of entries to read, -1 reads all entries
+	Limit int
+}
+
+func (q BodyQuery) values() url.Values {
+	v := url.Values{}
+	for key, val := range map[string]string{
+		"where":   q.Where,
+		"columns": q.Columns,
+		"sort":    q.Sort,
+		"token":   q.Token,
+	} {
+		if val != "" {
+			v.Set(key, val)
+		}
+	}
+	v.Set("offset", strconv.Itoa(q.Offset))
+	v.Set("limit", strconv.Itoa(q.Limit))
+	return v
+}
+
+func bodyQueryFromRequest(r *http.Request) (BodyQuery, error) {
+	q := BodyQuery{
+		Where:   r.FormValue("where"),
+		Columns: r.FormValue("columns"),
+		Sort:    r.FormValue("sort"),
+		Token:   r.FormValue("token"),
+		Limit:   -1,
+	}
+	var err error
+	if s := r.FormValue("offset"); s != "" {
+		if q.Offset, err = strconv.Atoi(s); err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("invalid offset %q", s)
+		}
+	}
+	if s := r.FormValue("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit < -1 {
+			return q, fmt.Errorf("invalid limit %q", s)
+		}
+	}
+	if q.Token != "" && q.Offset > 0 {
+		return q, fmt.Errorf("token cannot be combined with offset")
+	}
+	return q, nil
+}
+
+// bodyEntry is the wire format for a body entry. A body query response is a
+// stream of newline-delimited JSON, the first line is the structure of the
+// returned entries, followed by one bodyEntry per line
+type bodyEntry struct {
+	Key   string      `json:"key,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// queryLocalBody writes the entries of a locally-stored dataset body that
+// match q to w, returning a continuation token if entries remain. start is
+// called with the structure of the returned entries before any are written
+func queryLocalBody(ctx context.Context, fs qfs.Filesystem, resolver dsref.Resolver, refStr string, q BodyQuery, start func(st *dataset.Structure) error, write func(bodyEntry) error) (string, error) {
+	ref, err := dsref.Parse(refStr)
+	if err != nil {
+		return "", err
+	}
+	if _, err := resolver.ResolveRef(ctx, &ref); err != nil {
+		return "", err
+	}
+
+	ds, err := dsfs.LoadDataset(ctx, fs, ref.Path)
+	if err != nil {
+		return "", err
+	}
+	if err := base.OpenDataset(ctx, fs, ds); err != nil {
+		return "", err
+	}
+
+	qr, err := bodyquery.Open(ds, bodyquery.Query{
+		Where:   q.Where,
+		Columns: bodyquery.ParseColumns(q.Columns),
+		Sort:    q.Sort,
+	}, q.Token)
+	if err != nil {
+		return "", err
+	}
+	defer qr.Close()
+
+	if err := start(qr.Structure()); err != nil {
+		return "", err
+	}
+	return qr.ReadPage(ds.Path, q.Offset, q.Limit, func(ent dsio.Entry) error {
+		return write(bodyEntry{Key: ent.Key, Value: ent.Value})
+	})
+}
+
+// BodyReader reads body entries streamed from a remote. BodyReader
+// implements the dsio.EntryReader interface
+type BodyReader struct {
+	res *http.Response
+	dec *json.Decoder
+	st  *dataset.Structure
+	i   int
+}
+
+var _ dsio.EntryReader = (*BodyReader)(nil)
+
+func newBodyReader(res *http.Response) (*BodyReader, error) {
+	br := &BodyReader{
+		res: res,
+		dec: json.NewDecoder(res.Body),
+		st:  &dataset.Structure{},
+	}
+	if err := br.dec.Decode(br.st); err != nil {
+		res.Body.Close()
+		return nil, fmt.Errorf("reading body structure: %w", err)
+	}
+	return br, nil
+}
+
+// Structure gives the structure of entries returned by the remote
+func (br *BodyReader) Structure() *dataset.Structure {
+	return br.st
+}
+
+// ReadEntry reads the next entry sent by the remote, returning io.EOF once
+// all entries are read
+func (br *BodyReader) ReadEntry() (dsio.Entry, error) {
+	ent := bodyEntry{}
+	if err := br.dec.Decode(&ent); errors.Is(err, io.EOF) {
+		// trailers are only populated once the response body is fully read
+		if msg := br.res.Trailer.Get(BodyErrorTrailer); msg != "" {
+			return dsio.Entry{}, fmt.Errorf("remote error reading body: %s", msg)
+		}
+		return dsio.Entry{}, io.EOF
+	} else if err != nil {
+		return dsio.Entry{}, err
+	}
+	e := dsio.Entry{Index: br.i, Key: ent.Key, Value: ent.Value}
+	br.i++
+	return e, nil
+}
+
+// NextToken returns a continuation token for reading the entries that follow
+// the entries the remote sent. NextToken is empty if no entries remain, and
+// is only set once ReadEntry has returned io.EOF
+func (br *BodyReader) NextToken() string {
+	return br.res.Trailer.Get(qhttp.NextTokenTrailer)
+}
+
+// Close closes the connection to the remote
+func (br *BodyReader) Close() error {
+	return br.res.Body.Close()
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/qri-io/qri/base/dsfs"
 	"github.com/qri-io/qri/dsref"
 	"github.com/qri-io/qri/event"
+	qhttp "github.com/qri-io/qri/lib/http"
 	"github.com/qri-io/qri/logbook/logsync"
 	"github.com/qri-io/qri/logbook/oplog"
 	"github.com/qri-io/qri/p2p"
@@ -51,6 +52,10 @@ type Client interface {
 	// Preview fetches a size-bounded subset of a single dataset version,
 	// summarizing the contents of the dataset version
 	PreviewDatasetVersion(ctx context.Context, ref dsref.Ref, remoteAddr string) (*dataset.Dataset, error)
+	// QueryBody reads a range of entries from the body of a dataset version
+	// stored on a remote, without pulling the version. Callers must close the
+	// returned reader
+	QueryBody(ctx context.Context, ref dsref.Ref, q BodyQuery, remoteAddr string) (*BodyReader, error)
 	// FetchLogs downloads logbook data on a dataset without storing the results
 	// locally
 	FetchLogs(ctx context.Context, ref dsref.Ref, remoteAddr string) (*oplog.Log, error)
@@ -307,6 +312,54 @@ func (c *client) previewDatasetVersionHTTP(ctx context.Context, ref dsref.Ref, r
 	return env.Data, nil
 }
 
+// QueryBody streams a range of body entries from a remote
+func (c *client) QueryBody(ctx context.Context, ref dsref.Ref, q BodyQuery, remoteAddr string) (*BodyReader, error) {
+	log.Debugf("client.QueryBody ref=%q remoteAddr=%q", ref, remoteAddr)
+	if c == nil {
+		return nil, ErrNoRemoteClient
+	}
+	if at := addressType(remoteAddr); at != "http" {
+		return nil, fmt.Errorf("body queries are only supported over HTTP")
+	}
+
+	u := fmt.Sprintf("%s%s%s?%s", remoteAddr, qhttp.AERemoteBody, ref.String(), q.values().Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.signHTTPRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	req.Header.Set("subject_username", c.profile.Peername)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such host") {
+			return nil, ErrRemoteNotFound
+		}
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		env := struct {
+			Meta struct {
+				Error string
+			}
+		}{}
+		if err := json.NewDecoder(res.Body).Decode(&env); err != nil {
+			return nil, fmt.Errorf("error %d", res.StatusCode)
+		}
+		if res.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", dsref.ErrRefNotFound, env.Meta.Error)
+		}
+		return nil, fmt.Errorf("error %d: %s", res.StatusCode, env.Meta.Error)
+	}
+
+	return newBodyReader(res)
+}
+
 // NewRemoteRefResolver creates a resolver backed by a remote
 func (c *client) NewRemoteRefResolver(remoteAddr string) dsref.Resolver {
 	log.Debugf("client.NewRemoteRefResolver remoteAddr=%q", remoteAddr)
@@ -500,6 +553,13 @@ func (c *client) PullDataset(ctx context.Context, ref *dsref.Ref, remoteAddr str
 
 	node := c.node
 
+	// the merged log is restored to its prior state if pulled versions are
+	// rejected
+	restoreLog, err := node.Repo.Logbook().SnapshotLog(ctx, *ref)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := c.pullLogs(ctx, *ref, remoteAddr); err != nil {
 		log.Debugf("client.pullLogs error=%q", err)
 		return nil, err
@@ -509,6 +569,14 @@ func (c *client) PullDataset(ctx context.Context, ref *dsref.Ref, remoteAddr str
 		log.Debugf("client.pullDatasetVersion error=%q", err)
 		return nil, err
 	}
+
+	if err := c.verifyPulledHistory(ctx, *ref); err != nil {
+		log.Debugf("client.verifyPulledHistory error=%q", err)
+		if rbErr := restoreLog(ctx); rbErr != nil {
+			log.Debugf("restoring log of rejected dataset ref=%q err=%q", ref, rbErr)
+		}
+		return nil, err
+	}
 	node.LocalStreams.PrintErr(fmt.Sprintf("🗼 fetched from remote %q\n", remoteAddr))
 
 	err = c.events.Publish(ctx, event.ETRemoteClientPullDatasetCompleted, event.RemoteEvent{
@@ -572,6 +640,41 @@ func (c *client) PullDataset(ctx context.Context, ref *dsref.Ref, remoteAddr str
 	return ds, nil
 }
 
+// verifyPulledHistory checks the commit signatures of every stored version in
+// the history of a pulled dataset against the known key of its author,
+// applying the node's signature policy. Versions that aren't stored locally
+// are checked when they're pulled. When a version is rejected, the pulled
+// version is unpinned
+func (c *client) verifyPulledHistory(ctx context.Context, ref dsref.Ref) error {
+	policy, err := base.ParseSignaturePolicy(c.node.SignaturePolicy())
+	if err != nil {
+		return err
+	}
+
+	checks, err := base.CheckSignatureHistory(ctx, c.node.Repo, ref)
+	if err != nil {
+		return fmt.Errorf("checking pulled history: %w", err)
+	}
+	for _, check := range checks {
+		if check.Status == base.SignatureNotStored {
+			continue
+		}
+		if err := policy.Enforce(check); err != nil {
+			fs := c.node.Repo.Filesystem()
+			if pinner, ok := fs.Filesystem("ipfs").(qfs.PinningFS); ok {
+				if unpinErr := pinner.Unpin(ctx, ref.Path, true); unpinErr != nil {
+					log.Debugf("unpinning rejected version path=%q err=%q", ref.Path, unpinErr)
+				}
+			}
+			return err
+		}
+		if check.Status != base.SignatureValid {
+			c.node.LocalStreams.PrintErr(fmt.Sprintf("⚠️ %s version %s signature is %s: %s\n", ref.Human(), check.Path, check.Status, check.Message))
+		}
+	}
+	return nil
+}
+
 // pullLogs fetches logbook data from a remote & stores it locally
 func (c *client) pullLogs(ctx context.Context, ref dsref.Ref, remoteAddr string) error {
 	log.Debugf("client.pullLogs ref=%q remoteAddr=%q", ref, remoteAddr)
@@ -2,10 +2,13 @@ package remote
 
 import (
 	"context"
+	"errors"
+	"io"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/dataset"
 	"github.com/qri-io/dataset/dstest"
 	"github.com/qri-io/qfs"
 	"github.com/qri-io/qfs/muxfs"
@@ -18,6 +21,7 @@ import (
 	"github.com/qri-io/qri/p2p"
 	p2ptest "github.com/qri-io/qri/p2p/test"
 	"github.com/qri-io/qri/profile"
+	"github.com/qri-io/qri/remote/access"
 	"github.com/qri-io/qri/repo"
 	reporef "github.com/qri-io/qri/repo/ref"
 )
@@ -138,6 +142,119 @@ func TestClientFeedsAndPreviews(t *testing.T) {
 	dstest.CompareGoldenDatasetAndUpdateIfEnvVarSet(t, "testdata/expect/TestClientFeedsAndPreviews.json", ds)
 }
 
+func TestClientQueryBody(t *testing.T) {
+	tr, cleanup := newTestRunner(t)
+	defer cleanup()
+
+	ds := &dataset.Dataset{
+		Name:   "cities",
+		Commit: &dataset.Commit{Title: "initial commit"},
+		Structure: &dataset.Structure{
+			Format:       "csv",
+			FormatConfig: map[string]interface{}{"headerRow": true},
+			Schema: map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "array",
+					"items": []interface{}{
+						map[string]interface{}{"title": "city", "type": "string"},
+						map[string]interface{}{"title": "pop", "type": "integer"},
+					},
+				},
+			},
+		},
+	}
+	body := "city,pop\ntoronto,40000000\nnew york,8500000\nchicago,300000\nchatham,35000\nraleigh,250000\n"
+	ds.SetBodyFile(qfs.NewMemfileBytes("body.csv", []byte(body)))
+	ref := saveDataset(tr.Ctx, tr.NodeA.Repo, tr.NodeA.Repo.Profiles().Owner(tr.Ctx), ds)
+
+	rem := tr.NodeARemote(t)
+	server := tr.RemoteTestServer(rem)
+	defer server.Close()
+
+	cli := tr.NodeBClient(t)
+
+	readPage := func(q BodyQuery) ([]interface{}, string) {
+		t.Helper()
+		br, err := cli.QueryBody(tr.Ctx, ref, q, server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer br.Close()
+		vals := []interface{}{}
+		for {
+			ent, err := br.ReadEntry()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			vals = append(vals, ent.Value)
+		}
+		return vals, br.NextToken()
+	}
+
+	q := BodyQuery{Where: "pop > 100000", Columns: "city", Offset: 1, Limit: 2}
+	got, token := readPage(q)
+	expect := []interface{}{[]interface{}{"new york"}, []interface{}{"chicago"}}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("first page mismatch (-want +got):\n%s", diff)
+	}
+	if token == "" {
+		t.Fatal("expected a continuation token")
+	}
+
+	q.Offset, q.Token = 0, token
+	got, token = readPage(q)
+	expect = []interface{}{[]interface{}{"raleigh"}}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("second page mismatch (-want +got):\n%s", diff)
+	}
+	if token != "" {
+		t.Errorf("expected no token after the last page, got %q", token)
+	}
+
+	if _, err := cli.QueryBody(tr.Ctx, ref, BodyQuery{Where: "nope = 1", Limit: -1}, server.URL); err == nil {
+		t.Error("expected querying an unknown column to fail")
+	}
+
+	missing := dsref.Ref{Username: "A", Name: "not_a_dataset"}
+	if _, err := cli.QueryBody(tr.Ctx, missing, BodyQuery{Limit: -1}, server.URL); !errors.Is(err, dsref.ErrRefNotFound) {
+		t.Errorf("expected ref not found error, got %v", err)
+	}
+
+	sorted := BodyQuery{Columns: "city", Sort: "-pop", Limit: 3}
+	if got, token = readPage(sorted); token == "" {
+		t.Fatal("expected a continuation token for a sorted page")
+	}
+	sorted.Token = token
+	rest, _ := readPage(sorted)
+	expect = []interface{}{[]interface{}{"toronto"}, []interface{}{"new york"}, []interface{}{"chicago"}, []interface{}{"raleigh"}, []interface{}{"chatham"}}
+	if diff := cmp.Diff(expect, append(got, rest...)); diff != "" {
+		t.Errorf("sorted pages mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := cli.QueryBody(tr.Ctx, ref, BodyQuery{Sort: "pop", Limit: -1}, server.URL); err == nil {
+		t.Error("expected an unbounded sorted query to be rejected")
+	}
+
+	var checked dsref.Ref
+	rem.PreviewPreCheck = func(ctx context.Context, pid profile.ID, ref dsref.Ref) error {
+		checked = ref
+		return nil
+	}
+	readPage(BodyQuery{Limit: 1})
+	if checked.Username != ref.Username || checked.Name != ref.Name {
+		t.Errorf("expected preview pre check to receive the requested ref, got %#v", checked)
+	}
+	rem.PreviewPreCheck = nil
+
+	// an empty policy denies all actions
+	rem.policy = &access.Policy{}
+	if _, err := cli.QueryBody(tr.Ctx, ref, BodyQuery{Limit: -1}, server.URL); err == nil {
+		t.Error("expected query to be denied by access policy")
+	}
+}
+
 func newMemRepoTestNode(t *testing.T) *p2p.QriNode {
 	ctx := context.Background()
 	fs := qfs.NewMemFS()
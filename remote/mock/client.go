@@ -83,6 +83,11 @@ func (c *Client) PreviewDatasetVersion(ctx context.Context, ref dsref.Ref, remot
 	return nil, ErrNotImplemented
 }
 
+// QueryBody is not implemented
+func (c *Client) QueryBody(ctx context.Context, ref dsref.Ref, q remote.BodyQuery, remoteAddr string) (*remote.BodyReader, error) {
+	return nil, ErrNotImplemented
+}
+
 // FetchLogs is not implemented
 func (c *Client) FetchLogs(ctx context.Context, ref dsref.Ref, remoteAddr string) (*oplog.Log, error) {
 	return nil, ErrNotImplemented
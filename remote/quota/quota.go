@@ -0,0 +1,664 @@
+// Package quota accounts for the storage each profile uses on a remote, and
+// limits how much data a profile can store. Usage is measured in bytes of
+// blocks, counting each block a profile stores once no matter how many
+// dataset versions include it
+package quota
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/qri-io/dag"
+)
+
+const (
+	// Unlimited is the quota of a profile that can store any amount of data
+	Unlimited int64 = -1
+	// DefaultLedgerFilename is the name of the file a remote keeps its ledger
+	// in, within the repo directory
+	DefaultLedgerFilename = "remote_usage.ndjson"
+	// ReservationTTL is how long bytes reserved for a push are held if the
+	// push is never charged or released, matching the deadline dsync gives a
+	// push session
+	ReservationTTL = 5 * time.Hour
+)
+
+// ErrQuotaExceeded is the base error for pushes that would take a profile
+// over its storage quota
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// ParseSize parses a human-readable size like "10GB". The empty string &
+// "unlimited" parse to Unlimited
+func ParseSize(s string) (int64, error) {
+	if s == "" || strings.EqualFold(s, "unlimited") {
+		return Unlimited, nil
+	}
+	n, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	return int64(n), nil
+}
+
+// FormatSize formats a size in bytes for humans
+func FormatSize(n int64) string {
+	if n < 0 {
+		return "unlimited"
+	}
+	return humanize.Bytes(uint64(n))
+}
+
+// Usage describes the storage a profile uses
+type Usage struct {
+	ProfileID string `json:"profileID"`
+	// Bytes is the total size of blocks the profile stores
+	Bytes int64 `json:"bytes"`
+	// Blocks is the number of distinct blocks the profile stores
+	Blocks int `json:"blocks"`
+	// Versions is the number of dataset versions the profile has pushed
+	Versions int `json:"versions"`
+	// Reserved is the number of bytes held for pushes in progress
+	Reserved int64 `json:"reserved,omitempty"`
+	// Quota is the maximum number of bytes the profile can store
+	Quota int64 `json:"quota"`
+	// CustomQuota is true when Quota is set for this profile, overriding the
+	// default
+	CustomQuota bool `json:"customQuota"`
+}
+
+// Remaining returns the number of bytes the profile can still store, or
+// Unlimited. Reserved bytes don't count as remaining
+func (u Usage) Remaining() int64 {
+	if u.Quota == Unlimited {
+		return Unlimited
+	}
+	if u.Bytes+u.Reserved >= u.Quota {
+		return 0
+	}
+	return u.Quota - u.Bytes - u.Reserved
+}
+
+// Error is returned when storing a dataset version would take a profile over
+// its quota
+type Error struct {
+	// Need is the number of bytes the version would add
+	Need  int64
+	Usage Usage
+}
+
+// Error implements the error interface, telling the client how much space it
+// has left
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: push needs %s, %s of %s quota remaining", ErrQuotaExceeded, FormatSize(e.Need), FormatSize(e.Usage.Remaining()), FormatSize(e.Usage.Quota))
+}
+
+// Unwrap returns ErrQuotaExceeded
+func (e *Error) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// Ledger records the dataset versions each profile stores & the blocks they
+// include. Each profile's usage is kept as a running total, updated as
+// versions are charged & released. A Ledger created with a path appends a
+// record of every change to a file, replaying records when loaded. Pushes in
+// progress hold reservations, which are only kept in memory. Ledger is safe
+// for concurrent use
+type Ledger struct {
+	mu           sync.Mutex
+	path         string
+	file         *os.File
+	records      int
+	defaultQuota int64
+	accounts     map[string]*account
+	// reservations maps profile IDs to reservations keyed by root CID
+	reservations map[string]map[string]reservation
+}
+
+// reservation holds bytes for a push in progress
+type reservation struct {
+	blocks  map[string]uint64
+	expires time.Time
+}
+
+type account struct {
+	// quota overrides the default quota when set
+	quota *int64
+	// versions maps the root CID of each stored version to the version's
+	// blocks
+	versions map[string]version
+	// blocks counts the versions that include each stored block
+	blocks map[string]*storedBlock
+	// bytes is the total size of stored blocks
+	bytes int64
+}
+
+type storedBlock struct {
+	size uint64
+	refs int
+}
+
+type version struct {
+	// dataset is the username/name of the dataset the version belongs to
+	dataset string
+	// blocks maps block CIDs to sizes in bytes
+	blocks map[string]uint64
+}
+
+// record is a single change to a ledger, stored as a line of JSON. a ledger
+// file is the sequence of changes that produce the ledger
+type record struct {
+	Op      string            `json:"op"`
+	Profile string            `json:"profile,omitempty"`
+	Dataset string            `json:"dataset,omitempty"`
+	Root    string            `json:"root,omitempty"`
+	Blocks  map[string]uint64 `json:"blocks,omitempty"`
+	Quota   *int64            `json:"quota,omitempty"`
+}
+
+const (
+	opCharge         = "charge"
+	opRelease        = "release"
+	opReleaseDataset = "releaseDataset"
+	opSetQuota       = "setQuota"
+	opResetQuota     = "resetQuota"
+)
+
+// compactMinRecords is the number of records a ledger file holds before
+// loading it considers compacting
+const compactMinRecords = 1000
+
+// NewLedger creates an in-memory ledger with an unlimited default quota
+func NewLedger() *Ledger {
+	return &Ledger{
+		defaultQuota: Unlimited,
+		accounts:     map[string]*account{},
+		reservations: map[string]map[string]reservation{},
+	}
+}
+
+// LoadLedger reads a ledger from the file at path, creating an empty ledger
+// if the file doesn't exist. Changes to the ledger are appended to path. A
+// file that holds far more records than the ledger needs is compacted
+func LoadLedger(path string) (*Ledger, error) {
+	l := NewLedger()
+	l.path = path
+	size, err := l.replay()
+	if err != nil {
+		return nil, fmt.Errorf("reading usage ledger: %w", err)
+	}
+	if l.records > compactMinRecords && l.records > 2*l.liveRecords() {
+		if err := l.compact(); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	if err := l.open(size); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close closes the ledger file
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// SetDefaultQuota sets the quota of profiles that don't have one set
+func (l *Ledger) SetDefaultQuota(quota int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.defaultQuota = quota
+}
+
+// Usage gets the storage usage of a profile
+func (l *Ledger) Usage(pid string) Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.usage(pid)
+}
+
+// List gets the usage of every profile that stores data or has a quota set,
+// ordered by profile ID
+func (l *Ledger) List() []Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	res := make([]Usage, 0, len(l.accounts))
+	for pid := range l.accounts {
+		res = append(res, l.usage(pid))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ProfileID < res[j].ProfileID })
+	return res
+}
+
+// Reserve returns an *Error if storing blocks would take a profile over its
+// quota. Otherwise the bytes of blocks the profile doesn't already store are
+// held for the version with root CID until the version is charged, the
+// reservation is released, or ReservationTTL passes. Reserving a root again
+// replaces its reservation
+func (l *Ledger) Reserve(pid, root string, blocks map[string]uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dropReservation(pid, root)
+	u := l.usage(pid)
+	if u.Quota != Unlimited {
+		acct := l.accounts[pid]
+		reserved := l.reservedBlocks(pid)
+		var need int64
+		for cid, size := range blocks {
+			if acct != nil && acct.blocks[cid] != nil {
+				continue
+			}
+			if _, ok := reserved[cid]; ok {
+				continue
+			}
+			need += int64(size)
+		}
+		if u.Bytes+u.Reserved+need > u.Quota {
+			return &Error{Need: need, Usage: u}
+		}
+	}
+
+	if l.reservations[pid] == nil {
+		l.reservations[pid] = map[string]reservation{}
+	}
+	l.reservations[pid][root] = reservation{blocks: blocks, expires: time.Now().Add(ReservationTTL)}
+	return nil
+}
+
+// Unreserve releases the bytes held for the version with root CID
+func (l *Ledger) Unreserve(pid, root string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dropReservation(pid, root)
+}
+
+// Charge records a dataset version with root CID as stored by a profile,
+// settling any reservation for the version. blocks maps the CIDs of the
+// version to their stored sizes
+func (l *Ledger) Charge(pid, dataset, root string, blocks map[string]uint64) error {
+	if root == "" || len(blocks) == 0 {
+		return fmt.Errorf("charging usage: no blocks")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dropReservation(pid, root)
+	return l.commit(record{Op: opCharge, Profile: pid, Dataset: dataset, Root: root, Blocks: blocks})
+}
+
+// Release stops charging every profile for the version with root CID
+func (l *Ledger) Release(root string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.commit(record{Op: opRelease, Root: root})
+}
+
+// ReleaseDataset stops charging every profile for all versions of a dataset
+func (l *Ledger) ReleaseDataset(dataset string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.commit(record{Op: opReleaseDataset, Dataset: dataset})
+}
+
+// SetQuota sets the quota for a profile, overriding the default
+func (l *Ledger) SetQuota(pid string, quota int64) error {
+	if quota < Unlimited {
+		return fmt.Errorf("invalid quota %d", quota)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.commit(record{Op: opSetQuota, Profile: pid, Quota: &quota})
+}
+
+// ResetQuota returns a profile to the default quota
+func (l *Ledger) ResetQuota(pid string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.commit(record{Op: opResetQuota, Profile: pid})
+}
+
+// commit persists a record & applies it to the ledger. callers must hold the
+// lock
+func (l *Ledger) commit(r record) error {
+	if err := l.write(r); err != nil {
+		return err
+	}
+	l.apply(r)
+	return nil
+}
+
+// apply changes the ledger by a record. callers must hold the lock
+func (l *Ledger) apply(r record) {
+	switch r.Op {
+	case opCharge:
+		acct := l.account(r.Profile)
+		if prev, ok := acct.versions[r.Root]; ok {
+			acct.uncharge(prev)
+		}
+		v := version{dataset: r.Dataset, blocks: r.Blocks}
+		acct.versions[r.Root] = v
+		acct.charge(v)
+	case opRelease:
+		l.release(func(root string, _ version) bool { return root == r.Root })
+	case opReleaseDataset:
+		l.release(func(_ string, v version) bool { return v.dataset == r.Dataset })
+	case opSetQuota:
+		quota := *r.Quota
+		l.account(r.Profile).quota = &quota
+	case opResetQuota:
+		if acct, ok := l.accounts[r.Profile]; ok {
+			acct.quota = nil
+			l.prune(r.Profile)
+		}
+	}
+}
+
+// release uncharges every version that matches. callers must hold the lock
+func (l *Ledger) release(match func(root string, v version) bool) {
+	for pid, acct := range l.accounts {
+		for root, v := range acct.versions {
+			if match(root, v) {
+				acct.uncharge(v)
+				delete(acct.versions, root)
+			}
+		}
+		l.prune(pid)
+	}
+}
+
+// charge adds the blocks of a version to an account's running totals
+func (acct *account) charge(v version) {
+	for cid, size := range v.blocks {
+		if b, ok := acct.blocks[cid]; ok {
+			b.refs++
+			continue
+		}
+		acct.blocks[cid] = &storedBlock{size: size, refs: 1}
+		acct.bytes += int64(size)
+	}
+}
+
+// uncharge removes the blocks of a version from an account's running totals
+func (acct *account) uncharge(v version) {
+	for cid := range v.blocks {
+		b, ok := acct.blocks[cid]
+		if !ok {
+			continue
+		}
+		if b.refs--; b.refs == 0 {
+			acct.bytes -= int64(b.size)
+			delete(acct.blocks, cid)
+		}
+	}
+}
+
+// account gets the account for a profile, creating one if necessary. callers
+// must hold the lock
+func (l *Ledger) account(pid string) *account {
+	acct, ok := l.accounts[pid]
+	if !ok {
+		acct = &account{
+			versions: map[string]version{},
+			blocks:   map[string]*storedBlock{},
+		}
+		l.accounts[pid] = acct
+	}
+	return acct
+}
+
+// prune drops accounts with nothing to record. callers must hold the lock
+func (l *Ledger) prune(pid string) {
+	if acct := l.accounts[pid]; acct != nil && acct.quota == nil && len(acct.versions) == 0 {
+		delete(l.accounts, pid)
+	}
+}
+
+// dropReservation removes a reservation. callers must hold the lock
+func (l *Ledger) dropReservation(pid, root string) {
+	if res, ok := l.reservations[pid]; ok {
+		delete(res, root)
+		if len(res) == 0 {
+			delete(l.reservations, pid)
+		}
+	}
+}
+
+// reservedBlocks gets the distinct blocks reserved for a profile's pushes in
+// progress, dropping expired reservations. callers must hold the lock
+func (l *Ledger) reservedBlocks(pid string) map[string]uint64 {
+	blocks := map[string]uint64{}
+	now := time.Now()
+	for root, res := range l.reservations[pid] {
+		if now.After(res.expires) {
+			l.dropReservation(pid, root)
+			continue
+		}
+		for cid, size := range res.blocks {
+			blocks[cid] = size
+		}
+	}
+	return blocks
+}
+
+// usage gets the usage of a profile. stored totals are kept as blocks are
+// charged, only blocks reserved for pushes in progress are counted. callers
+// must hold the lock
+func (l *Ledger) usage(pid string) Usage {
+	u := Usage{ProfileID: pid, Quota: l.defaultQuota}
+	acct, ok := l.accounts[pid]
+	if ok {
+		u.Versions = len(acct.versions)
+		u.Blocks = len(acct.blocks)
+		u.Bytes = acct.bytes
+		if acct.quota != nil {
+			u.Quota = *acct.quota
+			u.CustomQuota = true
+		}
+	}
+	for cid, size := range l.reservedBlocks(pid) {
+		if ok && acct.blocks[cid] != nil {
+			continue
+		}
+		u.Reserved += int64(size)
+	}
+	return u
+}
+
+// write appends a record to the ledger file if the ledger has a path. callers
+// must hold the lock
+func (l *Ledger) write(r record) error {
+	if l.path == "" {
+		return nil
+	}
+	if l.file == nil {
+		return fmt.Errorf("usage ledger is closed")
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	// records are written with a single write, a failed write leaves at most
+	// a partial final line, which is dropped when the ledger is loaded
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.records++
+	return nil
+}
+
+// replay applies each record in the ledger file, returning the length of the
+// file up to the last complete record
+func (l *Ledger) replay() (int64, error) {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var size int64
+	rd := bufio.NewReader(f)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if err == io.EOF {
+			// an unterminated final line is a write that didn't finish. a file
+			// without complete records isn't a ledger
+			if len(line) > 0 && l.records == 0 {
+				return 0, fmt.Errorf("invalid record")
+			}
+			return size, nil
+		} else if err != nil {
+			return 0, err
+		}
+		r := record{}
+		if err := json.Unmarshal(line, &r); err != nil {
+			return 0, fmt.Errorf("record %d: %w", l.records+1, err)
+		}
+		if err := r.validate(); err != nil {
+			return 0, fmt.Errorf("record %d: %w", l.records+1, err)
+		}
+		l.apply(r)
+		l.records++
+		size += int64(len(line))
+	}
+}
+
+func (r record) validate() error {
+	switch r.Op {
+	case opCharge:
+		if r.Profile == "" || r.Root == "" {
+			return fmt.Errorf("charge requires a profile & root")
+		}
+	case opRelease, opReleaseDataset, opResetQuota:
+	case opSetQuota:
+		if r.Quota == nil {
+			return fmt.Errorf("setting a quota requires a quota")
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", r.Op)
+	}
+	return nil
+}
+
+// open opens the ledger file for appending, dropping anything after the last
+// complete record
+func (l *Ledger) open(size int64) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	l.file = f
+	return nil
+}
+
+// liveRecords is the number of records that describe the ledger. callers
+// must hold the lock
+func (l *Ledger) liveRecords() int {
+	n := 0
+	for _, acct := range l.accounts {
+		n += len(acct.versions)
+		if acct.quota != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// compact replaces the ledger file with the records that describe the ledger.
+// the new file is written to a temp file & renamed so a failed write can't
+// corrupt the ledger
+func (l *Ledger) compact() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	records := 0
+	for pid, acct := range l.accounts {
+		if acct.quota != nil {
+			if err := enc.Encode(record{Op: opSetQuota, Profile: pid, Quota: acct.quota}); err != nil {
+				f.Close()
+				return err
+			}
+			records++
+		}
+		for root, v := range acct.versions {
+			if err := enc.Encode(record{Op: opCharge, Profile: pid, Dataset: v.dataset, Root: root, Blocks: v.blocks}); err != nil {
+				f.Close()
+				return err
+			}
+			records++
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+
+	size := int64(0)
+	if fi, err := os.Stat(l.path); err == nil {
+		size = fi.Size()
+	}
+	l.records = records
+	return l.open(size)
+}
+
+// InfoBlocks maps the CIDs in a dag info manifest to their sizes. Sizes in a
+// dag info are reported by the pushing client, use them to reserve space
+// before blocks are received, never to charge for stored blocks
+func InfoBlocks(info dag.Info) map[string]uint64 {
+	blocks := map[string]uint64{}
+	if info.Manifest == nil {
+		return blocks
+	}
+	for i, cid := range info.Manifest.Nodes {
+		var size uint64
+		if i < len(info.Sizes) {
+			size = info.Sizes[i]
+		}
+		blocks[cid] = size
+	}
+	return blocks
+}
@@ -0,0 +1,364 @@
+package quota
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/dag"
+)
+
+func info(nodes []string, sizes []uint64) dag.Info {
+	return dag.Info{Manifest: &dag.Manifest{Nodes: nodes}, Sizes: sizes}
+}
+
+func charge(l *Ledger, pid, dataset string, in dag.Info) error {
+	return l.Charge(pid, dataset, in.Manifest.Nodes[0], InfoBlocks(in))
+}
+
+func TestParseSize(t *testing.T) {
+	cases := []struct {
+		in     string
+		expect int64
+	}{
+		{"", Unlimited},
+		{"unlimited", Unlimited},
+		{"100", 100},
+		{"1KB", 1000},
+		{"2 MiB", 2 << 20},
+	}
+	for _, c := range cases {
+		got, err := ParseSize(c.in)
+		if err != nil {
+			t.Errorf("%q unexpected error: %s", c.in, err)
+			continue
+		}
+		if got != c.expect {
+			t.Errorf("%q expected %d, got %d", c.in, c.expect, got)
+		}
+	}
+
+	if _, err := ParseSize("lots"); err == nil {
+		t.Error("expected invalid size to error")
+	}
+}
+
+func TestLedgerUsage(t *testing.T) {
+	l := NewLedger()
+	l.SetDefaultQuota(100)
+
+	if err := charge(l, "alice", "alice/ds", info([]string{"a", "b", "c"}, []uint64{10, 20, 30})); err != nil {
+		t.Fatal(err)
+	}
+	// second version shares block "b"
+	if err := charge(l, "alice", "alice/ds", info([]string{"d", "b"}, []uint64{5, 20})); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := Usage{ProfileID: "alice", Bytes: 65, Blocks: 4, Versions: 2, Quota: 100}
+	if diff := cmp.Diff(expect, l.Usage("alice")); diff != "" {
+		t.Errorf("usage mismatch (-want +got):\n%s", diff)
+	}
+	if got := l.Usage("alice").Remaining(); got != 35 {
+		t.Errorf("expected 35 bytes remaining, got %d", got)
+	}
+
+	// blocks alice already stores are free
+	if err := l.Reserve("alice", "e", InfoBlocks(info([]string{"e", "a", "c"}, []uint64{35, 10, 30}))); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	l.Unreserve("alice", "e")
+	err := l.Reserve("alice", "f", InfoBlocks(info([]string{"f"}, []uint64{36})))
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got: %v", err)
+	}
+	if msg := "storage quota exceeded: push needs 36 B, 35 B of 100 B quota remaining"; err.Error() != msg {
+		t.Errorf("error message mismatch.\nwant: %q\ngot:  %q", msg, err.Error())
+	}
+	// other profiles aren't charged for alice's blocks
+	if err := l.Reserve("bob", "a", InfoBlocks(info([]string{"a", "b", "c", "d"}, []uint64{50, 50, 1, 0}))); err == nil {
+		t.Error("expected bob to exceed quota")
+	}
+
+	if err := l.Release("d"); err != nil {
+		t.Fatal(err)
+	}
+	if u := l.Usage("alice"); u.Bytes != 60 || u.Versions != 1 {
+		t.Errorf("expected releasing a version to free unshared blocks, got %+v", u)
+	}
+	if err := l.ReleaseDataset("alice/ds"); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.List(); len(got) != 0 {
+		t.Errorf("expected empty ledger, got %+v", got)
+	}
+}
+
+func TestLedgerQuotas(t *testing.T) {
+	l := NewLedger()
+	if err := l.Reserve("alice", "a", InfoBlocks(info([]string{"a"}, []uint64{1 << 40}))); err != nil {
+		t.Errorf("default quota should be unlimited, got: %s", err)
+	}
+	l.Unreserve("alice", "a")
+
+	if err := l.SetQuota("alice", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reserve("alice", "a", InfoBlocks(info([]string{"a"}, []uint64{1}))); err == nil {
+		t.Error("expected zero quota to reject pushes")
+	}
+	if u := l.Usage("alice"); !u.CustomQuota || u.Quota != 0 {
+		t.Errorf("expected custom quota of 0, got %+v", u)
+	}
+	if got := l.List(); len(got) != 1 {
+		t.Errorf("expected profiles with a quota to be listed, got %+v", got)
+	}
+
+	if err := l.ResetQuota("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if u := l.Usage("alice"); u.CustomQuota || u.Quota != Unlimited {
+		t.Errorf("expected default quota, got %+v", u)
+	}
+	if err := l.SetQuota("alice", -2); err == nil {
+		t.Error("expected invalid quota to error")
+	}
+}
+
+func TestLedgerReservations(t *testing.T) {
+	l := NewLedger()
+	l.SetDefaultQuota(100)
+
+	// concurrent pushes can't both claim the remaining space
+	if err := l.Reserve("alice", "a", map[string]uint64{"a": 60}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reserve("alice", "b", map[string]uint64{"b": 60}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected reserved bytes to count toward the quota, got: %v", err)
+	}
+	// blocks shared with a reservation are only held once
+	if err := l.Reserve("alice", "c", map[string]uint64{"a": 60, "c": 40}); err != nil {
+		t.Errorf("unexpected error reserving shared blocks: %s", err)
+	}
+	if u := l.Usage("alice"); u.Reserved != 100 || u.Bytes != 0 || u.Remaining() != 0 {
+		t.Errorf("unexpected usage with reservations: %+v", u)
+	}
+
+	// charging settles a reservation with the stored sizes
+	if err := l.Charge("alice", "alice/ds", "a", map[string]uint64{"a": 50}); err != nil {
+		t.Fatal(err)
+	}
+	if u := l.Usage("alice"); u.Bytes != 50 || u.Reserved != 40 {
+		t.Errorf("expected charge to replace the reservation, got %+v", u)
+	}
+	l.Unreserve("alice", "c")
+	if u := l.Usage("alice"); u.Reserved != 0 || u.Remaining() != 50 {
+		t.Errorf("expected unreserving to free space, got %+v", u)
+	}
+
+	// expired reservations don't hold space
+	if err := l.Reserve("alice", "d", map[string]uint64{"d": 50}); err != nil {
+		t.Fatal(err)
+	}
+	res := l.reservations["alice"]["d"]
+	res.expires = time.Now().Add(-time.Second)
+	l.reservations["alice"]["d"] = res
+	if u := l.Usage("alice"); u.Reserved != 0 {
+		t.Errorf("expected expired reservation to be dropped, got %+v", u)
+	}
+}
+
+func TestLoadLedger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoadLedger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, DefaultLedgerFilename)
+	l, err := LoadLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := charge(l, "alice", "alice/ds", info([]string{"a", "b"}, []uint64{10, 20})); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetQuota("bob", 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(l.List(), reloaded.List()); diff != "" {
+		t.Errorf("reloaded ledger mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoadLedgerReplaysReleases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoadLedgerReplaysReleases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, DefaultLedgerFilename)
+	l, err := LoadLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	v1 := info([]string{"a", "b"}, []uint64{10, 20})
+	v2 := info([]string{"c", "a"}, []uint64{40, 10})
+	for _, in := range []dag.Info{v1, v2} {
+		if err := charge(l, "alice", "alice/ds", in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := charge(l, "alice", "alice/other", info([]string{"d"}, []uint64{5})); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Release(v1.Manifest.Nodes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.ReleaseDataset("alice/other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetQuota("bob", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.ResetQuota("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Usage{{ProfileID: "alice", Versions: 1, Blocks: 2, Bytes: 50, Quota: Unlimited}}
+	if diff := cmp.Diff(want, l.List()); diff != "" {
+		t.Errorf("usage mismatch (-want +got):\n%s", diff)
+	}
+
+	reloaded, err := LoadLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	if diff := cmp.Diff(want, reloaded.List()); diff != "" {
+		t.Errorf("reloaded ledger mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoadLedgerPartialRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoadLedgerPartialRecord")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, DefaultLedgerFilename)
+	l, err := LoadLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := charge(l, "alice", "alice/ds", info([]string{"a", "b"}, []uint64{10, 20})); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// simulate a write that didn't finish
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"op":"charge","profile":"ali`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	reloaded, err := LoadLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.SetQuota("bob", 1000); err != nil {
+		t.Fatal(err)
+	}
+	reloaded.Close()
+
+	again, err := LoadLedger(path)
+	if err != nil {
+		t.Fatalf("partial record wasn't dropped: %s", err)
+	}
+	defer again.Close()
+	want := []Usage{
+		{ProfileID: "alice", Versions: 1, Blocks: 2, Bytes: 30, Quota: Unlimited},
+		{ProfileID: "bob", Quota: 1000, CustomQuota: true},
+	}
+	if diff := cmp.Diff(want, again.List()); diff != "" {
+		t.Errorf("usage mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoadLedgerInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoadLedgerInvalid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, DefaultLedgerFilename)
+	if err := ioutil.WriteFile(path, []byte("{\"op\":\"charge\"}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLedger(path); err == nil {
+		t.Error("expected loading an invalid record to fail")
+	}
+}
+
+func TestLoadLedgerCompacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoadLedgerCompacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, DefaultLedgerFilename)
+	l, err := LoadLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := info([]string{"a", "b"}, []uint64{10, 20})
+	for i := 0; i <= compactMinRecords; i++ {
+		if err := charge(l, "alice", "alice/ds", in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	reloaded, err := LoadLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	if reloaded.records != 1 {
+		t.Errorf("expected compacted ledger to hold 1 record, got %d", reloaded.records)
+	}
+	want := []Usage{{ProfileID: "alice", Versions: 1, Blocks: 2, Bytes: 30, Quota: Unlimited}}
+	if diff := cmp.Diff(want, reloaded.List()); diff != "" {
+		t.Errorf("usage mismatch (-want +got):\n%s", diff)
+	}
+	if err := reloaded.SetQuota("alice", 100); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("expected 2 lines after appending to a compacted ledger, got %d", lines)
+	}
+}
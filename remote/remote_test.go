@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io/ioutil"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -24,6 +28,7 @@ import (
 	p2ptest "github.com/qri-io/qri/p2p/test"
 	"github.com/qri-io/qri/profile"
 	"github.com/qri-io/qri/remote/access"
+	"github.com/qri-io/qri/remote/quota"
 	"github.com/qri-io/qri/repo"
 	reporef "github.com/qri-io/qri/repo/ref"
 )
@@ -401,6 +406,145 @@ func TestAccess(t *testing.T) {
 	}
 }
 
+func TestQuota(t *testing.T) {
+	tr, cleanup := newTestRunner(t)
+	defer cleanup()
+
+	bRef := writeVideoViewStats(tr.Ctx, t, tr.NodeB.Repo)
+	cli := tr.NodeBClient(t)
+	rem := tr.NodeARemote(t, func(o *Options) { o.Ledger = quota.NewLedger() })
+	server := tr.RemoteTestServer(rem)
+	defer server.Close()
+
+	pid := tr.NodeB.Repo.Profiles().Owner(tr.Ctx).ID.Encode()
+	if err := rem.Ledger().SetQuota(pid, 10); err != nil {
+		t.Fatal(err)
+	}
+	err := cli.PushDataset(tr.Ctx, bRef, server.URL)
+	if err == nil {
+		t.Fatal("expected push over quota to fail")
+	}
+	if !strings.Contains(err.Error(), quota.ErrQuotaExceeded.Error()) || !strings.Contains(err.Error(), "10 B of 10 B quota remaining") {
+		t.Errorf("expected quota exceeded error with remaining space, got: %q", err)
+	}
+
+	if err := rem.Ledger().SetQuota(pid, quota.Unlimited); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.PushDataset(tr.Ctx, bRef, server.URL); err != nil {
+		t.Fatalf("unexpected push error: %s", err)
+	}
+	u := rem.Ledger().Usage(pid)
+	if u.Versions != 1 || u.Bytes == 0 || u.Reserved != 0 {
+		t.Fatalf("expected push to be charged & its reservation settled, got %+v", u)
+	}
+
+	// pushing blocks the profile already stores shouldn't need more space
+	if err := rem.Ledger().SetQuota(pid, u.Bytes); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.PushDataset(tr.Ctx, bRef, server.URL); err != nil {
+		t.Errorf("unexpected error re-pushing stored blocks: %s", err)
+	}
+
+	if err := cli.RemoveDataset(tr.Ctx, bRef, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if u := rem.Ledger().Usage(pid); u.Versions != 0 || u.Bytes != 0 {
+		t.Errorf("expected removing a dataset to release usage, got %+v", u)
+	}
+}
+
+func TestOptLoadLedgerFileError(t *testing.T) {
+	tr, cleanup := newTestRunner(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "TestOptLoadLedgerFileError")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, quota.DefaultLedgerFilename)
+	if err := ioutil.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.RemoteServer{Enabled: true, AcceptSizeMax: -1}
+	if _, err := NewServer(tr.NodeA, cfg, tr.NodeA.Repo.Logbook(), tr.NodeA.Repo.Bus(), OptLoadLedgerFile(path)); err == nil {
+		t.Error("expected an unreadable ledger file to fail creating the server")
+	}
+}
+
+func TestPullSignaturePolicy(t *testing.T) {
+	tr, cleanup := newTestRunner(t)
+	defer cleanup()
+
+	rem := tr.NodeARemote(t)
+	server := tr.RemoteTestServer(rem)
+	defer server.Close()
+
+	wbp := writeWorldBankPopulation(tr.Ctx, t, tr.NodeA.Repo)
+
+	cfg := testcfg.DefaultP2PForTesting()
+	cfg.SignaturePolicy = "reject"
+	r := tr.NodeB.Repo
+	node, err := p2p.NewQriNode(r, cfg, r.Bus(), dsref.SequentialResolver(r.Dscache(), r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli, err := NewClient(tr.Ctx, node, r.Bus())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// node B doesn't know node A's key, and can't check the signature
+	ref := wbp
+	if _, err := cli.PullDataset(tr.Ctx, &ref, server.URL); err == nil {
+		t.Fatal("expected pulling a version signed by an unknown key to fail")
+	}
+	lookup := dsref.Ref{Username: wbp.Username, Name: wbp.Name}
+	if _, err := r.Logbook().ResolveRef(tr.Ctx, &lookup); err == nil {
+		t.Error("expected logs of a rejected dataset to be removed")
+	}
+
+	authorA := tr.NodeA.Repo.Profiles().Owner(tr.Ctx)
+	if err := r.Profiles().PutProfile(tr.Ctx, &profile.Profile{
+		ID:       authorA.ID,
+		Peername: authorA.Peername,
+		PubKey:   authorA.PubKey,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ref = wbp
+	if _, err := cli.PullDataset(tr.Ctx, &ref, server.URL); err != nil {
+		t.Errorf("expected pulling a version signed by a known key to succeed, got: %s", err)
+	}
+
+	// a rejected pull restores the log of a dataset that was already pulled
+	ds := &dataset.Dataset{
+		Name:      wbp.Name,
+		Commit:    &dataset.Commit{Title: "second commit"},
+		Structure: &dataset.Structure{Format: "json", Schema: dataset.BaseSchemaArray},
+	}
+	ds.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte("[200]")))
+	saveDataset(tr.Ctx, tr.NodeA.Repo, tr.NodeA.Repo.Logbook().Owner(), ds)
+	if err := r.Profiles().DeleteProfile(tr.Ctx, authorA.ID); err != nil {
+		t.Fatal(err)
+	}
+	ref = dsref.Ref{Username: wbp.Username, Name: wbp.Name}
+	if _, err := cli.PullDataset(tr.Ctx, &ref, server.URL); err == nil {
+		t.Fatal("expected pulling a version signed by an unknown key to fail")
+	}
+	items, err := r.Logbook().Items(tr.Ctx, lookup, 0, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Path != wbp.Path {
+		t.Errorf("expected rejected pull to restore the log with only the first version, got: %v", items)
+	}
+}
+
 type testRunner struct {
 	Ctx          context.Context
 	NodeA, NodeB *p2p.QriNode
@@ -13,21 +13,28 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/ipfs/go-cid"
 	golog "github.com/ipfs/go-log"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	ipfspath "github.com/ipfs/interface-go-ipfs-core/path"
 	"github.com/qri-io/dag"
 	"github.com/qri-io/dag/dsync"
+	"github.com/qri-io/dataset"
 	apiutil "github.com/qri-io/qri/api/util"
 	"github.com/qri-io/qri/auth/key"
 	"github.com/qri-io/qri/base"
 	"github.com/qri-io/qri/config"
 	"github.com/qri-io/qri/dsref"
 	"github.com/qri-io/qri/event"
+	qhttp "github.com/qri-io/qri/lib/http"
 	"github.com/qri-io/qri/logbook"
 	"github.com/qri-io/qri/logbook/logsync"
 	"github.com/qri-io/qri/logbook/oplog"
 	"github.com/qri-io/qri/p2p"
 	"github.com/qri-io/qri/profile"
 	"github.com/qri-io/qri/remote/access"
+	"github.com/qri-io/qri/remote/quota"
 	"github.com/qri-io/qri/repo"
 	reporef "github.com/qri-io/qri/repo/ref"
 )
@@ -88,6 +95,12 @@ type Options struct {
 	Previews
 	// Policy defines the access control for the remote
 	Policy *access.Policy
+	// Ledger records storage usage for each profile. Default is an in-memory
+	// ledger
+	Ledger *quota.Ledger
+
+	// err records a failure applying an option, returned by NewServer
+	err error
 }
 
 // Server receives requests from other qri nodes to perform actions on their
@@ -120,6 +133,11 @@ type Server struct {
 
 	// policy defines the access control for the remote
 	policy *access.Policy
+	// ledger accounts for storage each profile uses & enforces quotas
+	ledger *quota.Ledger
+	// blocks reads blocks this remote stores, without fetching from the
+	// network
+	blocks coreiface.BlockAPI
 }
 
 // OptPolicy adds a policy to the remote options
@@ -151,6 +169,21 @@ func OptLoadPolicyFileIfExists(filename string) OptionsFunc {
 	}
 }
 
+// OptLoadLedgerFile keeps the storage usage ledger in a file at the given
+// path, reading existing usage if the file exists. NewServer fails if an
+// existing file can't be read, starting with an empty ledger would forget
+// what profiles store
+func OptLoadLedgerFile(filename string) OptionsFunc {
+	return func(o *Options) {
+		l, err := quota.LoadLedger(filename)
+		if err != nil {
+			o.err = fmt.Errorf("loading usage ledger: %w", err)
+			return
+		}
+		o.Ledger = l
+	}
+}
+
 // NewServer creates a remote
 func NewServer(node *p2p.QriNode, cfg *config.RemoteServer, localResolver dsref.Resolver, pub event.Publisher, opts ...OptionsFunc) (*Server, error) {
 	log.Debugf("NewServer cfg=%v len(opts)=%d", cfg, len(opts))
@@ -158,11 +191,23 @@ func NewServer(node *p2p.QriNode, cfg *config.RemoteServer, localResolver dsref.
 	for _, opt := range opts {
 		opt(o)
 	}
+	if o.err != nil {
+		return nil, o.err
+	}
 
 	if node == nil {
 		return nil, fmt.Errorf("remote requires a non-nil node")
 	}
 
+	defaultQuota, err := quota.ParseSize(cfg.DefaultQuota)
+	if err != nil {
+		return nil, fmt.Errorf("remote default quota: %w", err)
+	}
+	if o.Ledger == nil {
+		o.Ledger = quota.NewLedger()
+	}
+	o.Ledger.SetDefaultQuota(defaultQuota)
+
 	r := &Server{
 		node:          node,
 		logbook:       node.Repo.Logbook(),
@@ -180,6 +225,7 @@ func NewServer(node *p2p.QriNode, cfg *config.RemoteServer, localResolver dsref.
 		datasetPullPreCheck:   o.DatasetPullPreCheck,
 		datasetPulled:         o.DatasetPulled,
 		policy:                o.Policy,
+		ledger:                o.Ledger,
 
 		FeedPreCheck:    o.FeedPreCheck,
 		PreviewPreCheck: o.PreviewPreCheck,
@@ -209,6 +255,11 @@ func NewServer(node *p2p.QriNode, cfg *config.RemoteServer, localResolver dsref.
 	if err != nil {
 		return nil, err
 	}
+	localAPI, err := capi.WithOptions(options.Api.FetchBlocks(false))
+	if err != nil {
+		return nil, err
+	}
+	r.blocks = localAPI.Block()
 
 	r.dsync, err = dsync.New(lng, capi.Block(), func(dsyncConfig *dsync.Config) {
 		if host := r.node.Host(); host != nil {
@@ -244,6 +295,11 @@ func NewServer(node *p2p.QriNode, cfg *config.RemoteServer, localResolver dsref.
 	return r, err
 }
 
+// Ledger exposes this remote's storage usage ledger
+func (r *Server) Ledger() *quota.Ledger {
+	return r.ledger
+}
+
 // Node exposes this remote's QriNode
 func (r *Server) Node() *p2p.QriNode {
 	if r == nil {
@@ -336,6 +392,10 @@ func (r *Server) RemoveDataset(ctx context.Context, params map[string]string) er
 		log.Error(err)
 	}
 
+	if err := r.ledger.ReleaseDataset(ref.Alias()); err != nil {
+		log.Errorf("releasing usage for %s: %s", ref, err)
+	}
+
 	// run completed hook
 	if r.datasetRemoved != nil {
 		if err := r.datasetRemoved(ctx, pid, ref); err != nil {
@@ -376,10 +436,18 @@ func (r *Server) dsPushPreCheck(ctx context.Context, info dag.Info, meta map[str
 		}
 	}
 
+	// no blocks have been received yet, hold space using the sizes the client
+	// reports. the final check re-reserves with the sizes actually received
+	root := infoRoot(info)
+	if err := r.ledger.Reserve(pid.Encode(), root, quota.InfoBlocks(info)); err != nil {
+		return err
+	}
+
 	log.Debugf("pid %s pushing ref %s", pid.Encode(), ref.String())
 
 	if r.datasetPushPreCheck != nil {
 		if err := r.datasetPushPreCheck(ctx, pid, ref); err != nil {
+			r.ledger.Unreserve(pid.Encode(), root)
 			return err
 		}
 	}
@@ -388,13 +456,25 @@ func (r *Server) dsPushPreCheck(ctx context.Context, info dag.Info, meta map[str
 }
 
 func (r *Server) dsPushFinalCheck(ctx context.Context, info dag.Info, meta map[string]string) error {
+	subj, ref, err := r.subjAndRefFromMeta(meta)
+	if err != nil {
+		return err
+	}
+	pid := subj.ID
+
+	root := infoRoot(info)
+	blocks, err := r.storedBlocks(ctx, info)
+	if err != nil {
+		r.ledger.Unreserve(pid.Encode(), root)
+		return err
+	}
+	if err := r.ledger.Reserve(pid.Encode(), root, blocks); err != nil {
+		return err
+	}
+
 	if r.datasetPushFinalCheck != nil {
-		subj, ref, err := r.subjAndRefFromMeta(meta)
-		if err != nil {
-			return err
-		}
-		pid := subj.ID
 		if err := r.datasetPushFinalCheck(ctx, pid, ref); err != nil {
+			r.ledger.Unreserve(pid.Encode(), root)
 			return err
 		}
 	}
@@ -402,6 +482,38 @@ func (r *Server) dsPushFinalCheck(ctx context.Context, info dag.Info, meta map[s
 	return nil
 }
 
+// infoRoot returns the root CID of a dag info, the empty string if the info
+// has no manifest
+func infoRoot(info dag.Info) string {
+	if info.Manifest == nil || len(info.Manifest.Nodes) == 0 {
+		return ""
+	}
+	return info.Manifest.Nodes[0]
+}
+
+// storedBlocks maps the CIDs in a pushed manifest to the sizes of the blocks
+// this remote stores. sizes come from the blockstore, never from the client.
+// blocks the remote doesn't have aren't stored, and aren't charged for
+func (r *Server) storedBlocks(ctx context.Context, info dag.Info) (map[string]uint64, error) {
+	blocks := map[string]uint64{}
+	if info.Manifest == nil {
+		return blocks, nil
+	}
+	for _, id := range info.Manifest.Nodes {
+		c, err := cid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block id %q: %w", id, err)
+		}
+		st, err := r.blocks.Stat(ctx, ipfspath.IpfsPath(c))
+		if err != nil {
+			log.Debugw("block not stored", "cid", id, "err", err)
+			continue
+		}
+		blocks[id] = uint64(st.Size())
+	}
+	return blocks, nil
+}
+
 func (r *Server) dsPushComplete(ctx context.Context, info dag.Info, meta map[string]string) error {
 	subj, ref, err := r.subjAndRefFromMeta(meta)
 	if err != nil {
@@ -423,6 +535,14 @@ func (r *Server) dsPushComplete(ctx context.Context, info dag.Info, meta map[str
 		}
 	}
 
+	// usage errors shouldn't fail a push that's already been accepted
+	if blocks, err := r.storedBlocks(ctx, info); err != nil {
+		r.ledger.Unreserve(pid.Encode(), infoRoot(info))
+		log.Errorf("measuring blocks pushed by %s for %s: %s", pid.Encode(), ref, err)
+	} else if err := r.ledger.Charge(pid.Encode(), ref.Alias(), infoRoot(info), blocks); err != nil {
+		log.Errorf("charging %s for %s: %s", pid.Encode(), ref, err)
+	}
+
 	vi := ref.VersionInfo()
 	// mark ref as published b/c someone just published to us
 	vi.Published = true
@@ -577,6 +697,7 @@ func (r *Server) AddDefaultRoutes(m *mux.Router) {
 	if ps := r.Previews; ps != nil {
 		m.Handle("/remote/dataset/preview/{path:.*}", r.PreviewHTTPHandler("/remote/dataset/preview/"))
 		m.Handle("/remote/dataset/component/{path:.*}", r.ComponentHTTPHandler("/remote/dataset/component/"))
+		m.Handle(qhttp.AERemoteBody.String()+"{path:.*}", r.BodyHTTPHandler(qhttp.AERemoteBody.String()))
 	}
 }
 
@@ -671,6 +792,88 @@ func (r *Server) PreviewHTTPHandler(prefix string) http.HandlerFunc {
 	}
 }
 
+// BodyHTTPHandler streams a range of entries from the body of a dataset
+// version, letting clients read part of a dataset without pulling it. Requests
+// are gated by the preview pre check hook, and the remote:pull action when the
+// remote has an access policy. Sorted requests are limited to pages of
+// maxRemoteSortedEntries
+func (r *Server) BodyHTTPHandler(prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		refStr := strings.TrimPrefix(req.URL.Path, prefix)
+		ref, err := dsref.Parse(refStr)
+		if err != nil {
+			apiutil.WriteErrResponse(w, http.StatusBadRequest, err)
+			return
+		}
+
+		id, err := profile.IDB58Decode(req.Header.Get("pid"))
+		if err != nil && (r.PreviewPreCheck != nil || r.policy != nil) {
+			apiutil.WriteErrResponse(w, http.StatusBadRequest, fmt.Errorf("missing signature details"))
+			return
+		}
+		if r.PreviewPreCheck != nil {
+			if err := r.PreviewPreCheck(ctx, id, ref); err != nil {
+				apiutil.WriteErrResponse(w, http.StatusBadRequest, fmt.Errorf("missing signature details"))
+				return
+			}
+		}
+		if r.policy != nil {
+			subj := &profile.Profile{ID: id, Peername: req.Header.Get("subject_username")}
+			if err := r.policy.Enforce(subj, access.ResourceStrFromRef(ref), "remote:pull"); err != nil {
+				apiutil.WriteErrResponse(w, http.StatusForbidden, err)
+				return
+			}
+		}
+
+		q, err := bodyQueryFromRequest(req)
+		if err != nil {
+			apiutil.WriteErrResponse(w, http.StatusBadRequest, err)
+			return
+		}
+		// sorting holds a page of entries in memory while scanning the full
+		// body, bound the page size remote callers can ask for
+		if q.Sort != "" && (q.Limit < 0 || q.Offset+q.Limit > maxRemoteSortedEntries) {
+			apiutil.WriteErrResponse(w, http.StatusBadRequest, fmt.Errorf("sorted body queries are limited to %d entries, use a smaller offset & limit", maxRemoteSortedEntries))
+			return
+		}
+
+		w.Header().Set("Trailer", qhttp.NextTokenTrailer+", "+BodyErrorTrailer)
+		enc := json.NewEncoder(w)
+		started := false
+		start := func(st *dataset.Structure) error {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			started = true
+			return enc.Encode(st)
+		}
+		write := func(ent bodyEntry) error {
+			if err := enc.Encode(ent); err != nil {
+				return err
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			return nil
+		}
+
+		token, err := queryLocalBody(ctx, r.node.Repo.Filesystem(), r.localResolver, refStr, q, start, write)
+		if err != nil {
+			if started {
+				w.Header().Set(BodyErrorTrailer, err.Error())
+				return
+			}
+			if errors.Is(err, dsref.ErrRefNotFound) {
+				apiutil.WriteErrResponse(w, http.StatusNotFound, err)
+				return
+			}
+			apiutil.WriteErrResponse(w, http.StatusBadRequest, err)
+			return
+		}
+		w.Header().Set(qhttp.NextTokenTrailer, token)
+	}
+}
+
 // ComponentHTTPHandler handles dataset component requests over HTTP
 func (r *Server) ComponentHTTPHandler(prefix string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
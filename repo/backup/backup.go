@@ -0,0 +1,266 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	blockservice "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+// Source is the repo state to write to an archive
+type Source struct {
+	// RepoPath is the repo directory Paths are read from
+	RepoPath string
+	// Paths are files & directories relative to RepoPath to store. Paths that
+	// don't exist are skipped
+	Paths []string
+	// Files are generated repo files keyed by path relative to the repo
+	// directory, for state that can't be copied from disk as-is
+	Files map[string][]byte
+	// Keys are private keys to store when keys are encrypted. Keys are ignored
+	// for other key modes, callers include or strip keys from repo files
+	Keys *Keys
+	// Blockstore holds the blocks of every root
+	Blockstore blockstore.Blockstore
+	// Roots are dataset version paths to store. Roots that aren't in the
+	// blockstore are skipped
+	Roots []string
+}
+
+// Options configure writing an archive
+type Options struct {
+	Keys       KeyMode
+	Passphrase string
+	LatestOnly bool
+	// Base is the path to a previous archive. Blocks already stored by the
+	// base archive or its bases are left out
+	Base string
+}
+
+// Create writes an archive of src to path. The archive is written to a
+// temporary file & moved into place once complete
+func Create(ctx context.Context, path string, src Source, opts Options) (*Manifest, error) {
+	if err := opts.Keys.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Keys == KeysEncrypt && opts.Passphrase == "" {
+		return nil, fmt.Errorf("a passphrase is required to encrypt keys")
+	}
+
+	m := &Manifest{
+		Version:    FormatVersion,
+		Created:    time.Now().UTC(),
+		Keys:       opts.Keys,
+		LatestOnly: opts.LatestOnly,
+		Roots:      []string{},
+		Files:      []Entry{},
+		Blocks:     []Entry{},
+	}
+
+	inherited := map[string]struct{}{}
+	if opts.Base != "" {
+		base, err := Open(opts.Base)
+		if err != nil {
+			return nil, fmt.Errorf("opening base archive: %w", err)
+		}
+		defer base.Close()
+		if err := base.Verify(); err != nil {
+			return nil, fmt.Errorf("base archive: %w", err)
+		}
+		m.Base = base.Digest
+		for _, e := range base.Manifest.Blocks {
+			inherited[strings.TrimPrefix(e.Name, blocksDir)] = struct{}{}
+		}
+		for _, id := range base.Manifest.Inherited {
+			inherited[id] = struct{}{}
+		}
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".qri-backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := &writer{zw: zip.NewWriter(f)}
+	if err := writeFiles(w, m, src); err != nil {
+		return nil, err
+	}
+	if opts.Keys == KeysEncrypt && src.Keys != nil {
+		data, salt, err := encryptKeys(src.Keys, opts.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		e, err := w.write(keysFilename, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		m.KeySalt = salt
+		m.Files = append(m.Files, e)
+	}
+	if err := writeBlocks(ctx, w, m, src, inherited); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.write(ManifestFilename, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	if err := w.zw.Close(); err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return m, os.Rename(f.Name(), path)
+}
+
+// writeFiles stores repo files from disk & generated files
+func writeFiles(w *writer, m *Manifest, src Source) error {
+	names := []string{}
+	for _, p := range src.Paths {
+		if _, ok := src.Files[p]; ok {
+			continue
+		}
+		root := filepath.Join(src.RepoPath, p)
+		err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == root {
+					return nil
+				}
+				return err
+			}
+			if fi.IsDir() || strings.HasSuffix(path, ".lock") {
+				return nil
+			}
+			rel, err := filepath.Rel(src.RepoPath, path)
+			if err != nil {
+				return err
+			}
+			names = append(names, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for name := range src.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, ok := src.Files[name]
+		if !ok {
+			var err error
+			if data, err = ioutil.ReadFile(filepath.Join(src.RepoPath, filepath.FromSlash(name))); err != nil {
+				return err
+			}
+		}
+		e, err := w.write(repoDir+name, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, e)
+	}
+	return nil
+}
+
+// writeBlocks stores every block reachable from a root that isn't inherited
+// from a base archive
+func writeBlocks(ctx context.Context, w *writer, m *Manifest, src Source, inherited map[string]struct{}) error {
+	if len(src.Roots) == 0 {
+		return nil
+	}
+	if src.Blockstore == nil {
+		return fmt.Errorf("a blockstore is required to back up datasets")
+	}
+	bs := src.Blockstore
+	ng := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	getLinks := func(ctx context.Context, id cid.Cid) ([]*ipld.Link, error) {
+		links, err := ipld.GetLinks(ctx, ng, id)
+		if errors.Is(err, ipld.ErrNotFound) {
+			return nil, nil
+		}
+		return links, err
+	}
+
+	roots := append([]string{}, src.Roots...)
+	sort.Strings(roots)
+	seen := cid.NewSet()
+	used := map[string]struct{}{}
+	var writeErr error
+	for _, p := range roots {
+		id, err := cid.Decode(pathCid(p))
+		if err != nil {
+			log.Debugw("skipping root", "path", p, "err", err)
+			continue
+		}
+		if has, err := bs.Has(id); err != nil {
+			return err
+		} else if !has {
+			log.Debugw("skipping root that isn't stored locally", "path", p)
+			continue
+		}
+		m.Roots = append(m.Roots, p)
+
+		visit := func(id cid.Cid) bool {
+			if !seen.Visit(id) {
+				return false
+			}
+			if _, ok := inherited[id.String()]; ok {
+				used[id.String()] = struct{}{}
+				return true
+			}
+			blk, err := bs.Get(id)
+			if err != nil {
+				log.Debugw("skipping missing block", "cid", id, "err", err)
+				return true
+			}
+			e, err := w.write(blocksDir+id.String(), bytes.NewReader(blk.RawData()))
+			if err != nil {
+				writeErr = err
+				return false
+			}
+			m.Blocks = append(m.Blocks, e)
+			return true
+		}
+		if err := merkledag.Walk(ctx, getLinks, id, visit); err != nil {
+			return err
+		}
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+
+	for id := range used {
+		m.Inherited = append(m.Inherited, id)
+	}
+	sort.Strings(m.Inherited)
+	return nil
+}
+
+// pathCid trims a dataset path like /ipfs/Qm.../dataset.json to its root CID
+func pathCid(p string) string {
+	p = strings.TrimPrefix(p, "/ipfs/")
+	return strings.Split(p, "/")[0]
+}
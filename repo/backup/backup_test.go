@@ -0,0 +1,213 @@
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func newBlockstore() blockstore.Blockstore {
+	return blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+}
+
+// putDataset adds a two-block DAG to bs, returning its root path
+func putDataset(t *testing.T, bs blockstore.Blockstore, data string) string {
+	t.Helper()
+	child := merkledag.NodeWithData([]byte(data + " body"))
+	root := merkledag.NodeWithData([]byte(data))
+	if err := root.AddNodeLink("body", child); err != nil {
+		t.Fatal(err)
+	}
+	for _, nd := range []*merkledag.ProtoNode{child, root} {
+		if err := bs.Put(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return "/ipfs/" + root.Cid().String()
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "qri_test_backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	repoPath := filepath.Join(dir, "qri")
+	if err := os.MkdirAll(filepath.Join(repoPath, "collections"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(repoPath, "collections", "peer.json"), []byte(`[]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bs := newBlockstore()
+	first := putDataset(t, bs, "first")
+	src := Source{
+		RepoPath:   repoPath,
+		Paths:      []string{"collections", "logbook.qfb"},
+		Files:      map[string][]byte{"config.yaml": []byte("profile: {}")},
+		Keys:       &Keys{ProfileKey: "profile_key", Keystore: []byte(`{}`)},
+		Blockstore: bs,
+		Roots:      []string{first, "/ipfs/QmNotStoredLocally"},
+	}
+
+	fullPath := filepath.Join(dir, "full.zip")
+	full, err := Create(ctx, fullPath, src, Options{Keys: KeysEncrypt, Passphrase: "correct horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{first}, full.Roots); diff != "" {
+		t.Errorf("roots mismatch (-want +got):\n%s", diff)
+	}
+	if len(full.Blocks) != 2 {
+		t.Errorf("expected 2 blocks, got %d", len(full.Blocks))
+	}
+
+	// an incremental archive only stores blocks the base doesn't have
+	second := putDataset(t, bs, "second")
+	src.Roots = []string{first, second}
+	incPath := filepath.Join(dir, "incremental.zip")
+	inc, err := Create(ctx, incPath, src, Options{Keys: KeysExclude, Base: fullPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inc.Blocks) != 2 || len(inc.Inherited) != 2 {
+		t.Errorf("expected 2 stored & 2 inherited blocks, got %d & %d", len(inc.Blocks), len(inc.Inherited))
+	}
+
+	if _, err := OpenChain(incPath, nil); err == nil {
+		t.Error("expected opening an incremental archive without its base to fail")
+	}
+
+	c, err := OpenChain(incPath, []string{fullPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	dest := filepath.Join(dir, "restored")
+	if err := c.ExtractFiles(dest); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dest, "collections", "peer.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "[]" {
+		t.Errorf("restored file mismatch, got %q", data)
+	}
+
+	restored := newBlockstore()
+	added, err := c.PutBlocks(ctx, restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 4 {
+		t.Errorf("expected 4 blocks added, got %d", added)
+	}
+}
+
+func TestEncryptedKeys(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "qri_test_backup_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys := &Keys{ProfileKey: "profile_key", P2PKey: "p2p_key", Keystore: []byte(`{"a":"b"}`)}
+	path := filepath.Join(dir, "backup.zip")
+	src := Source{RepoPath: dir, Keys: keys}
+	if _, err := Create(ctx, path, src, Options{Keys: KeysEncrypt}); err == nil {
+		t.Error("expected encrypting keys without a passphrase to fail")
+	}
+	if _, err := Create(ctx, path, src, Options{Keys: KeysEncrypt, Passphrase: "correct horse"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := OpenChain(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Keys("battery staple"); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("expected ErrBadPassphrase, got: %v", err)
+	}
+	got, err := c.Keys("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(keys, got); diff != "" {
+		t.Errorf("keys mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCorruptArchive(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "qri_test_backup_corrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bs := newBlockstore()
+	src := Source{
+		RepoPath:   dir,
+		Files:      map[string][]byte{"config.yaml": []byte("profile: {}")},
+		Blockstore: bs,
+		Roots:      []string{putDataset(t, bs, "data")},
+	}
+	path := filepath.Join(dir, "backup.zip")
+	if _, err := Create(ctx, path, src, Options{Keys: KeysInclude}); err != nil {
+		t.Fatal(err)
+	}
+
+	// copy the archive, replacing the contents of the config
+	corruptPath := filepath.Join(dir, "corrupt.zip")
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	f, err := os.Create(corruptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, zf := range r.File {
+		w, err := zw.Create(zf.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if zf.Name == repoDir+"config.yaml" {
+			w.Write([]byte("profile: {peername: mallory}"))
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(w, rc)
+		rc.Close()
+	}
+	zw.Close()
+	f.Close()
+
+	if _, err := OpenChain(corruptPath, nil); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt, got: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrBadPassphrase indicates encrypted keys couldn't be decrypted with the
+// given passphrase
+var ErrBadPassphrase = errors.New("incorrect passphrase for encrypted keys")
+
+// Keys are the private keys of a repo
+type Keys struct {
+	// ProfileKey is the base64-encoded private key of the repo's profile
+	ProfileKey string `json:"profileKey,omitempty"`
+	// P2PKey is the base64-encoded private key of the repo's p2p node
+	P2PKey string `json:"p2pKey,omitempty"`
+	// Keystore is the contents of the repo keystore
+	Keystore []byte `json:"keystore,omitempty"`
+}
+
+// scrypt parameters recommended for interactive logins
+const (
+	scryptN      = 32768
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// encryptKeys seals keys with a key derived from passphrase, returning the
+// ciphertext and the base64-encoded salt
+func encryptKeys(keys *Keys, passphrase string) ([]byte, string, error) {
+	plain, err := json.Marshal(keys)
+	if err != nil {
+		return nil, "", err
+	}
+	salt := make([]byte, saltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, "", err
+	}
+	gcm, err := keyCipher(passphrase, salt)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, "", err
+	}
+	// the nonce is stored as a prefix of the ciphertext
+	return gcm.Seal(nonce, nonce, plain, nil), base64.StdEncoding.EncodeToString(salt), nil
+}
+
+// decryptKeys reverses encryptKeys
+func decryptKeys(data []byte, salt, passphrase string) (*Keys, error) {
+	s, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return nil, fmt.Errorf("decoding key salt: %w", err)
+	}
+	gcm, err := keyCipher(passphrase, s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: encrypted keys are truncated", ErrCorrupt)
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	keys := &Keys{}
+	if err := json.Unmarshal(plain, keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func keyCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
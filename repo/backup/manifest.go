@@ -0,0 +1,203 @@
+// Package backup writes & restores archives of an entire qri repo: the
+// logbook, keys, config, collections, workflows, run history & the blocks of
+// every referenced dataset version
+package backup
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	golog "github.com/ipfs/go-log"
+)
+
+var log = golog.Logger("backup")
+
+const (
+	// FormatVersion is the version of the archive layout this package writes
+	FormatVersion = 1
+	// ManifestFilename is the name of the manifest within an archive
+	ManifestFilename = "manifest.json"
+
+	repoDir   = "repo/"
+	blocksDir = "blocks/"
+	// keysFilename holds encrypted keys when keys are encrypted
+	keysFilename = "keys.enc"
+)
+
+// ErrCorrupt indicates an archive doesn't match its manifest
+var ErrCorrupt = errors.New("backup archive is corrupt")
+
+// KeyMode sets how private keys are stored in an archive
+type KeyMode string
+
+const (
+	// KeysInclude stores private keys in plain text
+	KeysInclude KeyMode = "include"
+	// KeysExclude leaves private keys out of the archive. Restoring requires
+	// the profile's private key
+	KeysExclude KeyMode = "exclude"
+	// KeysEncrypt stores private keys encrypted with a passphrase
+	KeysEncrypt KeyMode = "encrypt"
+)
+
+// Validate checks the mode is known
+func (m KeyMode) Validate() error {
+	switch m {
+	case KeysInclude, KeysExclude, KeysEncrypt:
+		return nil
+	}
+	return fmt.Errorf("unknown key mode %q, must be one of include, exclude or encrypt", m)
+}
+
+// Entry describes a single file in an archive
+type Entry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists the contents of an archive, with a checksum of every file
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Keys is how private keys are stored
+	Keys KeyMode `json:"keys"`
+	// KeySalt is the salt used to derive the key encryption key from a
+	// passphrase. Only set when Keys is KeysEncrypt
+	KeySalt string `json:"keySalt,omitempty"`
+	// LatestOnly is true if the archive only holds blocks of the latest
+	// version of each dataset
+	LatestOnly bool `json:"latestOnly,omitempty"`
+	// Base is the digest of the manifest of the archive this archive is
+	// incremental against. Empty for full backups
+	Base string `json:"base,omitempty"`
+	// Roots are the dataset version paths in the archive, pinned on restore
+	Roots []string `json:"roots"`
+	// Files are repo files stored in the archive
+	Files []Entry `json:"files"`
+	// Blocks are content-addressed blocks stored in the archive
+	Blocks []Entry `json:"blocks"`
+	// Inherited are the CIDs of blocks the roots need that are stored in the
+	// base archive or its bases
+	Inherited []string `json:"inherited,omitempty"`
+}
+
+// Size returns the total size of files & blocks stored in the archive
+func (m *Manifest) Size() (size int64) {
+	for _, e := range m.Files {
+		size += e.Size
+	}
+	for _, e := range m.Blocks {
+		size += e.Size
+	}
+	return size
+}
+
+// Archive is an open backup archive
+type Archive struct {
+	r        *zip.ReadCloser
+	files    map[string]*zip.File
+	Manifest *Manifest
+	// Digest identifies the archive, and is the sha256 of its manifest
+	Digest string
+}
+
+// Open opens an archive & reads its manifest. Open doesn't check the contents
+// of the archive match the manifest, use Verify
+func Open(path string) (*Archive, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{r: r, files: map[string]*zip.File{}}
+	for _, f := range r.File {
+		a.files[f.Name] = f
+	}
+
+	data, err := a.read(ManifestFilename)
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	a.Manifest = &Manifest{}
+	if err := json.Unmarshal(data, a.Manifest); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("decoding manifest: %w", err)
+	}
+	if a.Manifest.Version != FormatVersion {
+		r.Close()
+		return nil, fmt.Errorf("unsupported backup version %d", a.Manifest.Version)
+	}
+	sum := sha256.Sum256(data)
+	a.Digest = hex.EncodeToString(sum[:])
+	return a, nil
+}
+
+// Close closes the archive
+func (a *Archive) Close() error {
+	return a.r.Close()
+}
+
+// Verify checks every file listed in the manifest is in the archive & matches
+// its checksum
+func (a *Archive) Verify() error {
+	for _, list := range [][]Entry{a.Manifest.Files, a.Manifest.Blocks} {
+		for _, e := range list {
+			if _, err := a.readEntry(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readEntry reads a file, checking it against its manifest entry
+func (a *Archive) readEntry(e Entry) ([]byte, error) {
+	data, err := a.read(e.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != e.Size || hex.EncodeToString(sum[:]) != e.SHA256 {
+		return nil, fmt.Errorf("%w: checksum mismatch for %s", ErrCorrupt, e.Name)
+	}
+	return data, nil
+}
+
+func (a *Archive) read(name string) ([]byte, error) {
+	f, ok := a.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// writer writes files to a zip archive, recording manifest entries
+type writer struct {
+	zw *zip.Writer
+}
+
+func (w *writer) write(name string, r io.Reader) (Entry, error) {
+	f, err := w.zw.Create(name)
+	if err != nil {
+		return Entry{}, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{Name: name, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
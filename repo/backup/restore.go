@@ -0,0 +1,195 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// Chain is an archive together with the archives it's incremental against
+type Chain struct {
+	// Head is the archive being restored
+	Head *Archive
+	// archives in the chain, head first
+	archives []*Archive
+	// blocks indexes where each block in the chain is stored
+	blocks map[string]blockSource
+}
+
+// OpenChain opens & verifies the archive at path. Incremental archives need
+// every archive in their base chain, given in any order
+func OpenChain(path string, bases []string) (*Chain, error) {
+	head, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Chain{Head: head, archives: []*Archive{head}}
+
+	byDigest := map[string]*Archive{}
+	for _, p := range bases {
+		a, err := Open(p)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("opening base archive %q: %w", p, err)
+		}
+		byDigest[a.Digest] = a
+		c.archives = append(c.archives, a)
+	}
+
+	// order the chain by following base digests from the head
+	chain := []*Archive{head}
+	for a := head; a.Manifest.Base != ""; {
+		base, ok := byDigest[a.Manifest.Base]
+		if !ok {
+			c.Close()
+			return nil, fmt.Errorf("missing base archive %s, pass every archive this backup is incremental against", a.Manifest.Base)
+		}
+		delete(byDigest, a.Manifest.Base)
+		chain = append(chain, base)
+		a = base
+	}
+	for _, a := range byDigest {
+		chain = append(chain, a)
+	}
+	c.archives = chain
+
+	c.blocks = map[string]blockSource{}
+	for i := len(c.archives) - 1; i >= 0; i-- {
+		a := c.archives[i]
+		if err := a.Verify(); err != nil {
+			c.Close()
+			return nil, err
+		}
+		for _, e := range a.Manifest.Blocks {
+			c.blocks[strings.TrimPrefix(e.Name, blocksDir)] = blockSource{archive: a, entry: e}
+		}
+	}
+	for _, id := range head.Manifest.Inherited {
+		if _, ok := c.blocks[id]; !ok {
+			c.Close()
+			return nil, fmt.Errorf("%w: block %s isn't stored in any base archive", ErrCorrupt, id)
+		}
+	}
+	return c, nil
+}
+
+// Close closes every archive in the chain
+func (c *Chain) Close() error {
+	var err error
+	for _, a := range c.archives {
+		if cerr := a.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Roots lists the dataset version paths stored in the chain
+func (c *Chain) Roots() []string {
+	return c.Head.Manifest.Roots
+}
+
+// ExtractFiles writes repo files from the head archive to dest
+func (c *Chain) ExtractFiles(dest string) error {
+	for _, e := range c.Head.Manifest.Files {
+		if !strings.HasPrefix(e.Name, repoDir) {
+			continue
+		}
+		rel := filepath.FromSlash(strings.TrimPrefix(e.Name, repoDir))
+		path := filepath.Join(dest, rel)
+		if rel == "" || !strings.HasPrefix(path, filepath.Clean(dest)+string(filepath.Separator)) {
+			return fmt.Errorf("%w: invalid file path %q", ErrCorrupt, e.Name)
+		}
+		data, err := c.Head.readEntry(e)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keys decrypts keys stored in the head archive. Keys returns nil if the
+// archive doesn't hold encrypted keys
+func (c *Chain) Keys(passphrase string) (*Keys, error) {
+	m := c.Head.Manifest
+	if m.Keys != KeysEncrypt {
+		return nil, nil
+	}
+	for _, e := range m.Files {
+		if e.Name != keysFilename {
+			continue
+		}
+		if passphrase == "" {
+			return nil, fmt.Errorf("a passphrase is required to decrypt keys")
+		}
+		data, err := c.Head.readEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		return decryptKeys(data, m.KeySalt, passphrase)
+	}
+	return nil, nil
+}
+
+// PutBlocks adds every block the head archive needs to bs, checking each
+// block matches its CID. PutBlocks returns the number of blocks added
+func (c *Chain) PutBlocks(ctx context.Context, bs blockstore.Blockstore) (int, error) {
+	ids := make([]string, 0, len(c.Head.Manifest.Blocks)+len(c.Head.Manifest.Inherited))
+	for _, e := range c.Head.Manifest.Blocks {
+		ids = append(ids, strings.TrimPrefix(e.Name, blocksDir))
+	}
+	ids = append(ids, c.Head.Manifest.Inherited...)
+
+	added := 0
+	for _, s := range ids {
+		if err := ctx.Err(); err != nil {
+			return added, err
+		}
+		id, err := cid.Decode(s)
+		if err != nil {
+			return added, fmt.Errorf("%w: invalid block %q", ErrCorrupt, s)
+		}
+		src, ok := c.blocks[s]
+		if !ok {
+			return added, fmt.Errorf("%w: block %s not found", ErrCorrupt, s)
+		}
+		data, err := src.archive.readEntry(src.entry)
+		if err != nil {
+			return added, err
+		}
+		sum, err := id.Prefix().Sum(data)
+		if err != nil {
+			return added, err
+		}
+		if !sum.Equals(id) {
+			return added, fmt.Errorf("%w: block %s doesn't match its content", ErrCorrupt, s)
+		}
+		blk, err := blocks.NewBlockWithCid(data, id)
+		if err != nil {
+			return added, err
+		}
+		if err := bs.Put(blk); err != nil {
+			return added, err
+		}
+		added++
+	}
+	return added, nil
+}
+
+type blockSource struct {
+	archive *Archive
+	entry   Entry
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/qri-io/qri/profile"
 	"github.com/qri-io/qri/repo"
 	fsrepo "github.com/qri-io/qri/repo/fs"
+	sqliterepo "github.com/qri-io/qri/repo/sqlite"
 )
 
 var log = golog.Logger("buildrepo")
@@ -40,7 +41,7 @@ func New(ctx context.Context, path string, cfg *config.Config, opts ...func(o *O
 	}
 
 	// Don't create a localstore with the empty path, this will use the current directory
-	if cfg.Repo.Type == "fs" && cfg.Path() == "" {
+	if (cfg.Repo.Type == "fs" || cfg.Repo.Type == "sqlite") && cfg.Path() == "" {
 		return nil, fmt.Errorf("buildRepo.New using filesystem requires non-empty path")
 	}
 
@@ -74,7 +75,7 @@ func New(ctx context.Context, path string, cfg *config.Config, opts ...func(o *O
 	switch cfg.Repo.Type {
 	case "fs":
 		if o.Logbook == nil {
-			if o.Logbook, err = newLogbook(o.Filesystem, o.Bus, pro, path); err != nil {
+			if o.Logbook, err = newLogbook(o.Filesystem, cfg, o.Bus, pro, path); err != nil {
 				return nil, err
 			}
 		}
@@ -85,6 +86,34 @@ func New(ctx context.Context, path string, cfg *config.Config, opts ...func(o *O
 		}
 
 		return fsrepo.NewRepo(ctx, path, o.Filesystem, o.Logbook, o.Dscache, o.Profiles, o.Bus)
+	case "sqlite":
+		db, err := sqliterepo.Open(filepath.Join(path, sqliterepo.Filename))
+		if err != nil {
+			return nil, err
+		}
+		if err := db.MigrateFSRepo(ctx, path, cfg.Repo.Logstore, pro.PrivKey); err != nil {
+			db.Close()
+			return nil, err
+		}
+		if o.Logbook == nil {
+			store, err := db.Logstore(ctx, pro.PrivKey)
+			if err != nil {
+				db.Close()
+				return nil, err
+			}
+			if o.Logbook, err = logbook.NewBookWithStore(*pro, o.Bus, store); err != nil {
+				db.Close()
+				return nil, err
+			}
+		}
+		if o.Dscache == nil {
+			if o.Dscache, err = newDscache(ctx, o.Filesystem, o.Bus, o.Logbook, pro.Peername, path); err != nil {
+				db.Close()
+				return nil, err
+			}
+		}
+
+		return sqliterepo.NewRepo(ctx, path, db, o.Filesystem, o.Logbook, o.Dscache, o.Profiles, o.Bus)
 	case "mem":
 		return repo.NewMemRepo(ctx, o.Filesystem, o.Logbook, o.Dscache, o.Profiles, o.Bus)
 	default:
@@ -122,8 +151,11 @@ func NewFilesystem(ctx context.Context, cfg *config.Config) (*muxfs.Mux, error)
 	return muxfs.New(ctx, cfg.Filesystems)
 }
 
-func newLogbook(fs qfs.Filesystem, bus event.Bus, pro *profile.Profile, repoPath string) (book *logbook.Book, err error) {
+func newLogbook(fs qfs.Filesystem, cfg *config.Config, bus event.Bus, pro *profile.Profile, repoPath string) (book *logbook.Book, err error) {
 	logbookPath := filepath.Join(repoPath, "logbook.qfb")
+	if cfg.Repo != nil && cfg.Repo.Logstore == "segments" {
+		return logbook.NewSegmentJournal(*pro, bus, fs, logbookPath, filepath.Join(repoPath, "logbook"))
+	}
 	return logbook.NewJournal(*pro, bus, fs, logbookPath)
 }
 
@@ -0,0 +1,256 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/qri-io/qri/base/params"
+	"github.com/qri-io/qri/collection"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/profile"
+)
+
+// CollectionSet is a collection.Set stored in the collections &
+// collection_items tables
+type CollectionSet struct {
+	db *DB
+}
+
+var _ collection.Set = (*CollectionSet)(nil)
+
+// CollectionSet returns the database's collection set
+func (d *DB) CollectionSet() *CollectionSet {
+	return &CollectionSet{db: d}
+}
+
+// List lists a user's collection, ordered by name (ascending) or last update
+// (descending). default is name
+func (s *CollectionSet) List(ctx context.Context, pid profile.ID, lp params.List) ([]dsref.VersionInfo, error) {
+	if err := pid.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.exists(ctx, s.db.db, pid); err != nil {
+		return nil, err
+	}
+
+	order := "username, name"
+	if len(lp.OrderBy) != 0 && lp.OrderBy[0].Key == "updated" {
+		order = "updated DESC"
+	}
+	lim := lp.Limit
+	if lim < 0 {
+		lim = -1
+	}
+
+	rows, err := s.db.db.QueryContext(ctx, `SELECT data FROM collection_items WHERE profile_id = ? ORDER BY `+order+` LIMIT ? OFFSET ?`, pid.Encode(), lim, lp.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []dsref.VersionInfo{}
+	for rows.Next() {
+		vi, err := scanVersionInfo(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *vi)
+	}
+	return results, rows.Err()
+}
+
+// Get fetches a single dataset in a user's collection
+func (s *CollectionSet) Get(ctx context.Context, pid profile.ID, initID string) (*dsref.VersionInfo, error) {
+	if err := pid.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.exists(ctx, s.db.db, pid); err != nil {
+		return nil, err
+	}
+	vi, err := scanVersionInfo(s.db.db.QueryRowContext(ctx, `SELECT data FROM collection_items WHERE profile_id = ? AND init_id = ?`, pid.Encode(), initID))
+	if err == sql.ErrNoRows {
+		return nil, collection.ErrNotFound
+	}
+	return vi, err
+}
+
+// Add adds datasets to a user's collection, replacing items with matching
+// InitIDs
+func (s *CollectionSet) Add(ctx context.Context, pid profile.ID, items ...dsref.VersionInfo) error {
+	if err := pid.Validate(); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := validateItem(item); err != nil {
+			return err
+		}
+	}
+
+	return s.db.update(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO collections (profile_id) VALUES (?) ON CONFLICT DO NOTHING`, pid.Encode()); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := putItem(ctx, tx, pid.Encode(), item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func validateItem(item dsref.VersionInfo) error {
+	if item.ProfileID == "" {
+		return fmt.Errorf("profileID is required")
+	}
+	if item.InitID == "" {
+		return fmt.Errorf("initID is required")
+	}
+	if item.Username == "" {
+		return fmt.Errorf("username is required")
+	}
+	if item.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return nil
+}
+
+// Delete removes a single dataset from a user's collection
+func (s *CollectionSet) Delete(ctx context.Context, pid profile.ID, removeID string) error {
+	if err := pid.Validate(); err != nil {
+		return err
+	}
+
+	return s.db.update(ctx, func(tx *sql.Tx) error {
+		if err := s.exists(ctx, tx, pid); err != nil {
+			return fmt.Errorf("no collection for profile")
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM collection_items WHERE profile_id = ? AND init_id = ?`, pid.Encode(), removeID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("no dataset in collection with initID %q", removeID)
+		}
+		return nil
+	})
+}
+
+// RenameUser changes a user's name in every collection
+func (s *CollectionSet) RenameUser(ctx context.Context, pid profile.ID, newUsername string) error {
+	return s.updateItems(ctx, `item_profile_id = ? AND username != ?`, []interface{}{pid.Encode(), newUsername}, func(vi *dsref.VersionInfo) {
+		vi.Username = newUsername
+	})
+}
+
+// UpdateEverywhere updates a dataset in all collections that contain it
+func (s *CollectionSet) UpdateEverywhere(ctx context.Context, initID string, mutate func(vi *dsref.VersionInfo)) error {
+	return s.updateItems(ctx, `init_id = ?`, []interface{}{initID}, mutate)
+}
+
+// updateItems applies mutate to all items matching a where clause in a single
+// transaction
+func (s *CollectionSet) updateItems(ctx context.Context, where string, args []interface{}, mutate func(vi *dsref.VersionInfo)) error {
+	return s.db.update(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT profile_id, data FROM collection_items WHERE `+where, args...)
+		if err != nil {
+			return err
+		}
+
+		type item struct {
+			pid string
+			vi  *dsref.VersionInfo
+		}
+		var items []item
+		for rows.Next() {
+			var (
+				pid  string
+				data []byte
+			)
+			if err := rows.Scan(&pid, &data); err != nil {
+				rows.Close()
+				return err
+			}
+			vi := &dsref.VersionInfo{}
+			if err := json.Unmarshal(data, vi); err != nil {
+				rows.Close()
+				return err
+			}
+			items = append(items, item{pid: pid, vi: vi})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, it := range items {
+			initID := it.vi.InitID
+			mutate(it.vi)
+			if it.vi.InitID != initID {
+				if _, err := tx.ExecContext(ctx, `DELETE FROM collection_items WHERE profile_id = ? AND init_id = ?`, it.pid, initID); err != nil {
+					return err
+				}
+			}
+			if err := putItem(ctx, tx, it.pid, *it.vi); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func putItem(ctx context.Context, tx *sql.Tx, pid string, vi dsref.VersionInfo) error {
+	data, err := json.Marshal(vi)
+	if err != nil {
+		return fmt.Errorf("serializing collection item: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO collection_items (profile_id, init_id, item_profile_id, username, name, updated, data) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (profile_id, init_id) DO UPDATE SET item_profile_id = excluded.item_profile_id, username = excluded.username, name = excluded.name, updated = excluded.updated, data = excluded.data`,
+		pid, vi.InitID, vi.ProfileID, vi.Username, vi.Name, updatedTime(vi), data)
+	return err
+}
+
+// updatedTime is the time a dataset was last committed to or run in unix
+// nanoseconds
+func updatedTime(vi dsref.VersionInfo) int64 {
+	t := vi.CommitTime
+	if vi.RunStart != nil {
+		t = vi.RunStart.Add(time.Duration(vi.RunDuration))
+	}
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s *CollectionSet) exists(ctx context.Context, q queryer, pid profile.ID) error {
+	var found string
+	if err := q.QueryRowContext(ctx, `SELECT profile_id FROM collections WHERE profile_id = ?`, pid.Encode()).Scan(&found); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: no collection for profile ID %q", collection.ErrNotFound, pid.Encode())
+		}
+		return err
+	}
+	return nil
+}
+
+func scanVersionInfo(row scanner) (*dsref.VersionInfo, error) {
+	var data []byte
+	if err := row.Scan(&data); err != nil {
+		return nil, err
+	}
+	vi := &dsref.VersionInfo{}
+	if err := json.Unmarshal(data, vi); err != nil {
+		return nil, err
+	}
+	return vi, nil
+}
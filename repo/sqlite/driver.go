@@ -0,0 +1,11 @@
+//go:build sqlite
+// +build sqlite
+
+package sqliterepo
+
+// register the "sqlite3" database/sql driver
+import _ "github.com/mattn/go-sqlite3"
+
+// driverName is the database/sql driver sqlite repos open databases with.
+// the driver requires cgo, builds without the "sqlite" tag leave it out
+const driverName = "sqlite3"
@@ -0,0 +1,8 @@
+//go:build !sqlite
+// +build !sqlite
+
+package sqliterepo
+
+// driverName is blank in builds without the "sqlite" tag, Open returns
+// ErrNotBuilt
+const driverName = ""
@@ -0,0 +1,389 @@
+package sqliterepo
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/qri-io/qri/logbook/oplog"
+)
+
+// Logstore is an oplog.Logstore that stores each log as a row of the logs
+// table. Rows hold the log's operations without descendants, encrypted with
+// the owner's private key. Logstore keeps the full log tree in memory, reads
+// never touch the database
+type Logstore struct {
+	db   *DB
+	aead cipher.AEAD
+
+	lk sync.Mutex
+	j  *oplog.Journal
+}
+
+var _ oplog.Logstore = (*Logstore)(nil)
+
+// Logstore loads the database's logstore. Logs are encrypted at rest with pk
+func (d *DB) Logstore(ctx context.Context, pk crypto.PrivKey) (*Logstore, error) {
+	if pk == nil {
+		return nil, fmt.Errorf("sqlite: private key is required")
+	}
+	aead, err := logCipher(pk)
+	if err != nil {
+		return nil, err
+	}
+	s := &Logstore{db: d, aead: aead, j: &oplog.Journal{}}
+	return s, s.load(ctx)
+}
+
+// logCipher derives the same key oplog.Journal uses to encrypt logbooks
+func logCipher(pk crypto.PrivKey) (cipher.AEAD, error) {
+	pkBytes, err := pk.Raw()
+	if err != nil {
+		return nil, err
+	}
+	hasher := md5.New()
+	hasher.Write(pkBytes)
+	block, err := aes.NewCipher([]byte(hex.EncodeToString(hasher.Sum(nil))))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *Logstore) load(ctx context.Context) error {
+	rows, err := s.db.db.QueryContext(ctx, `SELECT id, parent_id, data FROM logs ORDER BY parent_id, position`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type row struct {
+		parentID string
+		l        *oplog.Log
+	}
+	var loaded []row
+	logs := map[string]*oplog.Log{}
+	for rows.Next() {
+		var (
+			id, parentID string
+			data         []byte
+		)
+		if err := rows.Scan(&id, &parentID, &data); err != nil {
+			return err
+		}
+		l, err := s.decode(data)
+		if err != nil {
+			return fmt.Errorf("decoding log %s: %w", id, err)
+		}
+		logs[id] = l
+		loaded = append(loaded, row{parentID: parentID, l: l})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// build the tree bottom up, rows are sorted by position within a parent
+	var top []*oplog.Log
+	for _, r := range loaded {
+		if r.parentID == "" {
+			top = append(top, r.l)
+			continue
+		}
+		parent, ok := logs[r.parentID]
+		if !ok {
+			log.Debugw("dropping log with missing parent", "id", r.l.ID(), "parentID", r.parentID)
+			continue
+		}
+		parent.AddChild(r.l)
+	}
+	for _, l := range top {
+		if err := s.j.MergeLog(ctx, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Logstore) encode(l *oplog.Log) ([]byte, error) {
+	node := oplog.Log{Ops: l.Ops, Signature: l.Signature}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, node.FlatbufferBytes(), nil), nil
+}
+
+func (s *Logstore) decode(data []byte) (*oplog.Log, error) {
+	size := s.aead.NonceSize()
+	if len(data) < size {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	plaintext, err := s.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return nil, err
+	}
+	return oplog.FromFlatbufferBytes(plaintext)
+}
+
+// position finds the index of l among its siblings
+func (s *Logstore) position(ctx context.Context, l *oplog.Log) (int, error) {
+	siblings, err := s.j.Logs(ctx, 0, -1)
+	if err != nil {
+		return 0, err
+	}
+	if l.ParentID != "" {
+		parent, err := s.j.Get(ctx, l.ParentID)
+		if err != nil {
+			return 0, fmt.Errorf("getting parent of log %s: %w", l.ID(), err)
+		}
+		siblings = parent.Logs
+	}
+	for i, sib := range siblings {
+		if sib == l || sib.ID() == l.ID() {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("log %s: %w", l.ID(), oplog.ErrNotFound)
+}
+
+// putRow writes a single log without descendants
+func (s *Logstore) putRow(ctx context.Context, tx *sql.Tx, l *oplog.Log) error {
+	pos, err := s.position(ctx, l)
+	if err != nil {
+		return err
+	}
+	data, err := s.encode(l)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO logs (id, parent_id, position, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET parent_id = excluded.parent_id, position = excluded.position, data = excluded.data`,
+		l.ID(), l.ParentID, pos, data)
+	return err
+}
+
+// putTree writes a log and all descendants
+func (s *Logstore) putTree(ctx context.Context, tx *sql.Tx, l *oplog.Log) error {
+	if err := s.putRow(ctx, tx, l); err != nil {
+		return err
+	}
+	for _, ch := range l.Logs {
+		if err := s.putTree(ctx, tx, ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutLog records the current state of a log already in the store, along
+// with all descendants. Ancestors are written without their descendants
+func (s *Logstore) PutLog(ctx context.Context, l *oplog.Log) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	return s.db.update(ctx, func(tx *sql.Tx) error {
+		for cursor := l; cursor.ParentID != ""; {
+			parent, err := s.j.Get(ctx, cursor.ParentID)
+			if err != nil {
+				return fmt.Errorf("getting parent of log %s: %w", cursor.ID(), err)
+			}
+			if err := s.putRow(ctx, tx, parent); err != nil {
+				return err
+			}
+			cursor = parent
+		}
+		return s.putTree(ctx, tx, l)
+	})
+}
+
+// PutOps records the current operations of a log already in the store,
+// without writing any of its descendants
+func (s *Logstore) PutOps(ctx context.Context, l *oplog.Log) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	return s.db.update(ctx, func(tx *sql.Tx) error {
+		return s.putRow(ctx, tx, l)
+	})
+}
+
+// MergeLog adds a log to the store
+func (s *Logstore) MergeLog(ctx context.Context, l *oplog.Log) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if err := s.j.MergeLog(ctx, l); err != nil {
+		return err
+	}
+
+	// merging may have combined l with an existing user log
+	merged, err := s.j.Get(ctx, l.ID())
+	if err != nil {
+		top, err := s.j.Logs(ctx, 0, -1)
+		if err != nil {
+			return err
+		}
+		for _, tl := range top {
+			if tl.FirstOpAuthorID() == l.FirstOpAuthorID() {
+				merged = tl
+				break
+			}
+		}
+		if merged == nil {
+			return fmt.Errorf("log %s: %w", l.ID(), oplog.ErrNotFound)
+		}
+	}
+	return s.db.update(ctx, func(tx *sql.Tx) error {
+		return s.putTree(ctx, tx, merged)
+	})
+}
+
+// RemoveLog removes a log and all descendants from the store
+func (s *Logstore) RemoveLog(ctx context.Context, names ...string) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if len(names) == 0 {
+		return fmt.Errorf("name is required")
+	}
+
+	siblings, err := s.j.Logs(ctx, 0, -1)
+	if err != nil {
+		return err
+	}
+	if len(names) > 1 {
+		parent, err := s.j.HeadRef(ctx, names[:len(names)-1]...)
+		if err != nil {
+			return err
+		}
+		siblings = parent.Logs
+	}
+	var removed *oplog.Log
+	for _, l := range siblings {
+		if l.Name() == names[len(names)-1] {
+			removed = l
+			break
+		}
+	}
+
+	if err := s.j.RemoveLog(ctx, names...); err != nil {
+		return err
+	}
+
+	return s.db.update(ctx, func(tx *sql.Tx) error {
+		return deleteTree(tx, removed)
+	})
+}
+
+func deleteTree(tx *sql.Tx, l *oplog.Log) error {
+	if _, err := tx.Exec(`DELETE FROM logs WHERE id = ?`, l.ID()); err != nil {
+		return err
+	}
+	for _, ch := range l.Logs {
+		if err := deleteTree(tx, ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceAll replaces the contents of the store with the given log
+func (s *Logstore) ReplaceAll(ctx context.Context, l *oplog.Log) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if err := s.j.ReplaceAll(ctx, l); err != nil {
+		return err
+	}
+	return s.db.update(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM logs`); err != nil {
+			return err
+		}
+		return s.putTree(ctx, tx, l)
+	})
+}
+
+// Clear removes all logs from the store
+func (s *Logstore) Clear(ctx context.Context) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if err := s.db.update(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM logs`)
+		return err
+	}); err != nil {
+		return err
+	}
+	s.j = &oplog.Journal{}
+	return nil
+}
+
+// importJournal writes all logs in a journal to the store, replacing any
+// existing logs
+func (s *Logstore) importJournal(ctx context.Context, tx *sql.Tx, j *oplog.Journal) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	logs, err := j.Logs(ctx, 0, -1)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM logs`); err != nil {
+		return err
+	}
+	s.j = j
+	for _, l := range logs {
+		if err := s.putTree(ctx, tx, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get fetches a log for a given ID
+func (s *Logstore) Get(ctx context.Context, id string) (*oplog.Log, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.j.Get(ctx, id)
+}
+
+// GetAuthorID fetches the first log that matches the given model and authorID
+func (s *Logstore) GetAuthorID(ctx context.Context, model uint32, authorID string) (*oplog.Log, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.j.GetAuthorID(ctx, model, authorID)
+}
+
+// HeadRef traverses the log graph & pulls out a log based on named head
+// references
+func (s *Logstore) HeadRef(ctx context.Context, names ...string) (*oplog.Log, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.j.HeadRef(ctx, names...)
+}
+
+// Logs returns top level logs in the store
+func (s *Logstore) Logs(ctx context.Context, offset, limit int) ([]*oplog.Log, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.j.Logs(ctx, offset, limit)
+}
+
+// Children gets all descentants of a log
+func (s *Logstore) Children(ctx context.Context, l *oplog.Log) error {
+	return s.j.Children(ctx, l)
+}
+
+// Descendants gets all descentants of a log & assigns the results to the
+// given Log parameter, setting only the Logs field
+func (s *Logstore) Descendants(ctx context.Context, l *oplog.Log) error {
+	return s.j.Descendants(ctx, l)
+}
@@ -0,0 +1,235 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/qri-io/qri/automation/run"
+	"github.com/qri-io/qri/automation/workflow"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/logbook/oplog"
+	"github.com/qri-io/qri/profile"
+	"github.com/qri-io/qri/repo"
+	fsrepo "github.com/qri-io/qri/repo/fs"
+)
+
+// metaFSMigrated is set once a filesystem repo has been imported
+const metaFSMigrated = "fs_migrated"
+
+// MigrateFSRepo imports the state of a filesystem repo at repoPath into the
+// database: references, the logbook, runs, workflows & collections. The
+// import runs in a single transaction, and only once. Files are left in place.
+// logstore is the repo's configured logstore, see config.Repo.Logstore. pk
+// decrypts the logbook and must be the key the logbook was written with
+func (d *DB) MigrateFSRepo(ctx context.Context, repoPath, logstore string, pk crypto.PrivKey) error {
+	if done, err := d.getMeta(ctx, metaFSMigrated); err != nil {
+		return err
+	} else if done != "" {
+		return nil
+	}
+
+	return d.update(ctx, func(tx *sql.Tx) error {
+		if err := migrateRefs(tx, filepath.Join(repoPath, fsrepo.Filepath(fsrepo.FileRefs))); err != nil {
+			return fmt.Errorf("migrating refs: %w", err)
+		}
+		if err := d.migrateLogbook(ctx, tx, repoPath, logstore, pk); err != nil {
+			return fmt.Errorf("migrating logbook: %w", err)
+		}
+		if err := migrateRuns(ctx, tx, filepath.Join(repoPath, "runs.json")); err != nil {
+			return fmt.Errorf("migrating runs: %w", err)
+		}
+		if err := migrateWorkflows(ctx, tx, filepath.Join(repoPath, "workflows.json")); err != nil {
+			return fmt.Errorf("migrating workflows: %w", err)
+		}
+		if err := migrateCollections(ctx, tx, filepath.Join(repoPath, "collections")); err != nil {
+			return fmt.Errorf("migrating collections: %w", err)
+		}
+		return setMeta(tx, metaFSMigrated, "true")
+	})
+}
+
+// readFile reads a file, returning nil data if it doesn't exist
+func readFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func migrateRefs(tx *sql.Tx, path string) error {
+	data, err := readFile(path)
+	if err != nil || data == nil {
+		return err
+	}
+	refs, err := repo.UnmarshalRefsFlatbuffer(data)
+	if err != nil {
+		return err
+	}
+	for _, r := range refs {
+		if err := insertRef(tx, r); err != nil {
+			return err
+		}
+	}
+	log.Debugw("migrated refs", "count", len(refs))
+	return nil
+}
+
+func (d *DB) migrateLogbook(ctx context.Context, tx *sql.Tx, repoPath, logstore string, pk crypto.PrivKey) error {
+	j, err := readFSLogbook(ctx, repoPath, logstore, pk)
+	if err != nil || j == nil {
+		return err
+	}
+	aead, err := logCipher(pk)
+	if err != nil {
+		return err
+	}
+	s := &Logstore{db: d, aead: aead}
+	return s.importJournal(ctx, tx, j)
+}
+
+// readFSLogbook reads the logbook of a filesystem repo through the configured
+// logstore. segment stores that hold no logs fall back to the journal file,
+// matching logbook.NewSegmentJournal. returns a nil journal if the repo has
+// no logbook
+func readFSLogbook(ctx context.Context, repoPath, logstore string, pk crypto.PrivKey) (*oplog.Journal, error) {
+	if logstore == "segments" {
+		dir := filepath.Join(repoPath, "logbook")
+		if _, err := os.Stat(dir); err == nil {
+			store, err := oplog.OpenSegmentStore(dir, pk)
+			if err != nil {
+				return nil, err
+			}
+			defer store.Close()
+			if !store.Empty() {
+				logs, err := store.Logs(ctx, 0, -1)
+				if err != nil {
+					return nil, err
+				}
+				j := &oplog.Journal{}
+				for _, l := range logs {
+					if err := j.MergeLog(ctx, l); err != nil {
+						return nil, err
+					}
+				}
+				return j, nil
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	data, err := readFile(filepath.Join(repoPath, "logbook.qfb"))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	j := &oplog.Journal{}
+	if err := j.UnmarshalFlatbufferCipher(ctx, pk, data); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func migrateRuns(ctx context.Context, tx *sql.Tx, path string) error {
+	data, err := readFile(path)
+	if err != nil || data == nil {
+		return err
+	}
+	// runs.json is the serialization of a run.MemStore
+	state := struct {
+		Workflows map[workflow.ID]struct {
+			RunIDs []string `json:"runIDs"`
+		} `json:"workflows"`
+		Runs map[string]*run.State `json:"runs"`
+	}{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	wids := make([]string, 0, len(state.Workflows))
+	for wid := range state.Workflows {
+		wids = append(wids, wid.String())
+	}
+	sort.Strings(wids)
+	for _, wid := range wids {
+		for _, id := range state.Workflows[workflow.ID(wid)].RunIDs {
+			rs, ok := state.Runs[id]
+			if !ok {
+				return fmt.Errorf("run %q missing from the store", id)
+			}
+			data, err := json.Marshal(rs)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO runs (id, workflow_id, status, start_time, data) VALUES (?, ?, ?, ?, ?)`,
+				rs.ID, rs.WorkflowID.String(), string(rs.Status), nullTime(rs.StartTime), data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func migrateWorkflows(ctx context.Context, tx *sql.Tx, path string) error {
+	data, err := readFile(path)
+	if err != nil || data == nil {
+		return err
+	}
+	state := struct {
+		Workflows []*workflow.Workflow
+	}{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	for _, w := range state.Workflows {
+		if err := putWorkflow(ctx, tx, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateCollections(ctx context.Context, tx *sql.Tx, dir string) error {
+	names, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, fi := range names {
+		if !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		pid, err := profile.IDB58Decode(strings.TrimSuffix(fi.Name(), ".json"))
+		if err != nil {
+			return fmt.Errorf("decoding profile ID: %w", err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return err
+		}
+		items := []dsref.VersionInfo{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO collections (profile_id) VALUES (?)`, pid.Encode()); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := putItem(ctx, tx, pid.Encode(), item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/qri-io/qri/profile"
+	"github.com/qri-io/qri/repo"
+	reporef "github.com/qri-io/qri/repo/ref"
+)
+
+// Refstore is a repo.Refstore stored in the refs table. References are
+// ordered by peername and name
+type Refstore struct {
+	db *DB
+}
+
+var _ repo.Refstore = (*Refstore)(nil)
+
+// Refstore returns the database's reference store
+func (d *DB) Refstore() *Refstore {
+	return &Refstore{db: d}
+}
+
+// refMatch is the SQL equivalent of reporef.DatasetRef.Match
+const refMatch = `((? != '' AND path = ?) OR ((profile_id = ? OR peername = ?) AND name = ?))`
+
+func refMatchArgs(r reporef.DatasetRef) []interface{} {
+	return []interface{}{r.Path, r.Path, r.ProfileID.Encode(), r.Peername, r.Name}
+}
+
+// PutRef adds a reference to the store, replacing any matching references
+func (rs *Refstore) PutRef(r reporef.DatasetRef) error {
+	if r.ProfileID == "" {
+		return repo.ErrPeerIDRequired
+	} else if r.Name == "" {
+		return repo.ErrNameRequired
+	} else if r.Path == "" && r.FSIPath == "" {
+		return repo.ErrPathRequired
+	} else if r.Peername == "" {
+		return repo.ErrPeernameRequired
+	}
+
+	return rs.db.update(context.Background(), func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM refs WHERE `+refMatch, refMatchArgs(r)...); err != nil {
+			return err
+		}
+		return insertRef(tx, r)
+	})
+}
+
+func insertRef(tx *sql.Tx, r reporef.DatasetRef) error {
+	_, err := tx.Exec(`INSERT INTO refs (peername, profile_id, name, path, fsi_path, published, is_foreign) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		r.Peername, r.ProfileID.Encode(), r.Name, r.Path, r.FSIPath, r.Published, r.Foreign)
+	return err
+}
+
+// GetRef completes a partially-known reference
+func (rs *Refstore) GetRef(get reporef.DatasetRef) (reporef.DatasetRef, error) {
+	refs, err := rs.query(`SELECT peername, profile_id, name, path, fsi_path, published, is_foreign FROM refs WHERE `+refMatch+` ORDER BY peername || name LIMIT 1`, refMatchArgs(get)...)
+	if err != nil {
+		return reporef.DatasetRef{}, err
+	}
+	if len(refs) == 0 {
+		return reporef.DatasetRef{}, repo.ErrNotFound
+	}
+	return refs[0], nil
+}
+
+// DeleteRef removes the first reference that matches del
+func (rs *Refstore) DeleteRef(del reporef.DatasetRef) error {
+	return rs.db.update(context.Background(), func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM refs WHERE rowid = (SELECT rowid FROM refs WHERE `+refMatch+` ORDER BY peername || name LIMIT 1)`, refMatchArgs(del)...)
+		return err
+	})
+}
+
+// References gives a set of dataset references from the store
+func (rs *Refstore) References(offset, limit int) ([]reporef.DatasetRef, error) {
+	return rs.query(`SELECT peername, profile_id, name, path, fsi_path, published, is_foreign FROM refs ORDER BY peername || name LIMIT ? OFFSET ?`, limit, offset)
+}
+
+// RefCount returns the number of references in the store
+func (rs *Refstore) RefCount() (int, error) {
+	var count int
+	err := rs.db.db.QueryRow(`SELECT COUNT(*) FROM refs`).Scan(&count)
+	return count, err
+}
+
+func (rs *Refstore) query(query string, args ...interface{}) ([]reporef.DatasetRef, error) {
+	rows, err := rs.db.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refs := []reporef.DatasetRef{}
+	for rows.Next() {
+		var (
+			r   reporef.DatasetRef
+			pid string
+		)
+		if err := rows.Scan(&r.Peername, &pid, &r.Name, &r.Path, &r.FSIPath, &r.Published, &r.Foreign); err != nil {
+			return nil, err
+		}
+		if pid != "" {
+			if r.ProfileID, err = profile.IDB58Decode(pid); err != nil {
+				return nil, err
+			}
+		}
+		refs = append(refs, r)
+	}
+	return refs, rows.Err()
+}
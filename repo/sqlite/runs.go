@@ -0,0 +1,234 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qri-io/qri/automation/run"
+	"github.com/qri-io/qri/automation/workflow"
+	"github.com/qri-io/qri/base/params"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/profile"
+)
+
+// RunStore is a run.Store stored in the runs table. Runs are ordered by the
+// sequence they were created in
+type RunStore struct {
+	db *DB
+}
+
+var (
+	_ run.Store      = (*RunStore)(nil)
+	_ run.EventAdder = (*RunStore)(nil)
+)
+
+// RunStore returns the database's run store
+func (d *DB) RunStore() *RunStore {
+	return &RunStore{db: d}
+}
+
+// Create adds a new run.State to the store
+func (s *RunStore) Create(ctx context.Context, r *run.State) (*run.State, error) {
+	if r == nil {
+		return nil, fmt.Errorf("run is nil")
+	}
+	rs := r.Copy()
+	if rs.ID == "" {
+		rs.ID = run.NewID()
+	}
+	if err := rs.Validate(); err != nil {
+		return nil, err
+	}
+
+	err := s.db.update(ctx, func(tx *sql.Tx) error {
+		if _, err := getRun(tx.QueryRowContext(ctx, `SELECT data FROM runs WHERE id = ?`, rs.ID)); !errors.Is(err, run.ErrNotFound) {
+			return fmt.Errorf("run with this ID already exists")
+		}
+		data, err := json.Marshal(rs)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO runs (id, workflow_id, status, start_time, data) VALUES (?, ?, ?, ?, ?)`,
+			rs.ID, rs.WorkflowID.String(), string(rs.Status), nullTime(rs.StartTime), data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Put updates an existing run.State in the store
+func (s *RunStore) Put(ctx context.Context, r *run.State) (*run.State, error) {
+	if r == nil {
+		return nil, fmt.Errorf("run is nil")
+	}
+	rs := r.Copy()
+	if rs.ID == "" {
+		return nil, fmt.Errorf("run has empty ID")
+	}
+
+	err := s.db.update(ctx, func(tx *sql.Tx) error {
+		prev, err := getRun(tx.QueryRowContext(ctx, `SELECT data FROM runs WHERE id = ?`, rs.ID))
+		if err != nil {
+			return run.ErrNotFound
+		}
+		if prev.WorkflowID != rs.WorkflowID {
+			return fmt.Errorf("run.State's WorkflowID does not match the WorkflowID of the associated run.State currently in the store")
+		}
+		if err := rs.Validate(); err != nil {
+			return err
+		}
+		return updateRun(ctx, tx, rs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// AddEvent writes an event to the store, attaching it to an existing stored
+// run state
+func (s *RunStore) AddEvent(id string, e event.Event) error {
+	ctx := context.Background()
+	return s.db.update(ctx, func(tx *sql.Tx) error {
+		rs, err := getRun(tx.QueryRowContext(ctx, `SELECT data FROM runs WHERE id = ?`, id))
+		if err != nil {
+			return err
+		}
+		if err := rs.AddTransformEvent(e); err != nil {
+			return fmt.Errorf("adding transform event to run: %w", err)
+		}
+		return updateRun(ctx, tx, rs)
+	})
+}
+
+func updateRun(ctx context.Context, tx *sql.Tx, rs *run.State) error {
+	data, err := json.Marshal(rs)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE runs SET status = ?, start_time = ?, data = ? WHERE id = ?`,
+		string(rs.Status), nullTime(rs.StartTime), data, rs.ID)
+	return err
+}
+
+// Get fetches a run.State using the associated ID
+func (s *RunStore) Get(ctx context.Context, id string) (*run.State, error) {
+	return getRun(s.db.db.QueryRowContext(ctx, `SELECT data FROM runs WHERE id = ?`, id))
+}
+
+// Count returns the number of runs for a given workflow.ID
+func (s *RunStore) Count(ctx context.Context, wid workflow.ID) (int, error) {
+	var count int
+	if err := s.db.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM runs WHERE workflow_id = ?`, wid.String()).Scan(&count); err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("%w %q", run.ErrUnknownWorkflowID, wid)
+	}
+	return count, nil
+}
+
+// List lists all the runs associated with the workflow.ID in reverse
+// chronological order
+func (s *RunStore) List(ctx context.Context, wid workflow.ID, lp params.List) ([]*run.State, error) {
+	if err := lp.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := s.Count(ctx, wid); err != nil {
+		return nil, err
+	}
+	return s.query(ctx, `SELECT data FROM runs WHERE workflow_id = ? ORDER BY seq DESC LIMIT ? OFFSET ?`, wid.String(), limit(lp), lp.Offset)
+}
+
+// GetLatest returns the most recent run associated with the workflow id
+func (s *RunStore) GetLatest(ctx context.Context, wid workflow.ID) (*run.State, error) {
+	rs, err := getRun(s.db.db.QueryRowContext(ctx, `SELECT data FROM runs WHERE workflow_id = ? ORDER BY seq DESC LIMIT 1`, wid.String()))
+	if errors.Is(err, run.ErrNotFound) {
+		return nil, fmt.Errorf("%w %q", run.ErrUnknownWorkflowID, wid)
+	}
+	return rs, err
+}
+
+// GetStatus returns the status of the latest run based on the
+// workflow.ID
+func (s *RunStore) GetStatus(ctx context.Context, wid workflow.ID) (run.Status, error) {
+	rs, err := s.GetLatest(ctx, wid)
+	if err != nil {
+		return "", err
+	}
+	return rs.Status, nil
+}
+
+// ListByStatus returns a list of run.State entries with a given status
+// looking only at the most recent run of each Workflow
+func (s *RunStore) ListByStatus(ctx context.Context, owner profile.ID, status run.Status, lp params.List) ([]*run.State, error) {
+	if err := lp.Validate(); err != nil {
+		return nil, err
+	}
+	return s.query(ctx, `SELECT data FROM runs
+		WHERE seq IN (SELECT MAX(seq) FROM runs GROUP BY workflow_id) AND status = ?
+		ORDER BY start_time IS NOT NULL, start_time DESC LIMIT ? OFFSET ?`, string(status), limit(lp), lp.Offset)
+}
+
+// Shutdown is a no-op, the database is closed by the repo
+func (s *RunStore) Shutdown() error {
+	return nil
+}
+
+func (s *RunStore) query(ctx context.Context, query string, args ...interface{}) ([]*run.State, error) {
+	rows, err := s.db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*run.State{}
+	for rows.Next() {
+		rs, err := getRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, rs)
+	}
+	return runs, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func getRun(row scanner) (*run.State, error) {
+	var data []byte
+	if err := row.Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, run.ErrNotFound
+		}
+		return nil, err
+	}
+	rs := &run.State{}
+	if err := json.Unmarshal(data, rs); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// limit converts list params to a SQL limit, where -1 is unbounded
+func limit(lp params.List) int {
+	if lp.All() {
+		return -1
+	}
+	return lp.Limit
+}
+
+func nullTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,238 @@
+// Package sqliterepo is an implementation of repo that keeps references,
+// logbook, automation and collection state in a single SQLite database
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	golog "github.com/ipfs/go-log"
+	"github.com/qri-io/qfs/muxfs"
+	"github.com/qri-io/qri/dscache"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/logbook"
+	"github.com/qri-io/qri/profile"
+	"github.com/qri-io/qri/repo"
+	fsrepo "github.com/qri-io/qri/repo/fs"
+)
+
+var log = golog.Logger("sqliterepo")
+
+// Filename is the name of the database file within a repo directory
+const Filename = "repo.sqlite"
+
+// ErrNotBuilt indicates sqlite support was left out of this build. sqlite
+// repos require building with the "sqlite" tag, which requires cgo
+var ErrNotBuilt = errors.New("sqlite repos are not supported by this build, rebuild with the \"sqlite\" tag")
+
+// migrations upgrade the database schema, each entry moves the schema forward
+// one version. never edit an existing migration, only append new ones
+var migrations = []string{
+	`CREATE TABLE meta (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+	CREATE TABLE refs (
+		peername   TEXT NOT NULL,
+		profile_id TEXT NOT NULL,
+		name       TEXT NOT NULL,
+		path       TEXT NOT NULL DEFAULT '',
+		fsi_path   TEXT NOT NULL DEFAULT '',
+		published  INTEGER NOT NULL DEFAULT 0,
+		is_foreign INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX refs_name ON refs (name);
+	CREATE INDEX refs_path ON refs (path);
+	CREATE TABLE logs (
+		id        TEXT PRIMARY KEY,
+		parent_id TEXT NOT NULL,
+		position  INTEGER NOT NULL,
+		data      BLOB NOT NULL
+	);
+	CREATE INDEX logs_parent ON logs (parent_id, position);
+	CREATE TABLE runs (
+		seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+		id          TEXT NOT NULL UNIQUE,
+		workflow_id TEXT NOT NULL,
+		status      TEXT NOT NULL,
+		start_time  INTEGER,
+		data        TEXT NOT NULL
+	);
+	CREATE INDEX runs_workflow ON runs (workflow_id, seq);
+	CREATE TABLE workflows (
+		id       TEXT PRIMARY KEY,
+		init_id  TEXT NOT NULL,
+		owner_id BLOB NOT NULL,
+		active   INTEGER NOT NULL,
+		created  INTEGER,
+		data     TEXT NOT NULL
+	);
+	CREATE INDEX workflows_init_id ON workflows (init_id);
+	CREATE TABLE collections (
+		profile_id TEXT PRIMARY KEY
+	);
+	CREATE TABLE collection_items (
+		profile_id      TEXT NOT NULL REFERENCES collections (profile_id),
+		init_id         TEXT NOT NULL,
+		item_profile_id TEXT NOT NULL,
+		username        TEXT NOT NULL,
+		name            TEXT NOT NULL,
+		updated         INTEGER NOT NULL,
+		data            TEXT NOT NULL,
+		PRIMARY KEY (profile_id, init_id)
+	);
+	CREATE INDEX collection_items_init_id ON collection_items (init_id);`,
+}
+
+// DB is a SQLite database holding repo state. DB is safe for concurrent use,
+// every write is made in a single transaction
+type DB struct {
+	path string
+	db   *sql.DB
+}
+
+// Open opens the database at path, creating it and upgrading its schema as
+// needed
+func Open(path string) (*DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite: path is required")
+	}
+	if driverName == "" {
+		return nil, ErrNotBuilt
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(driverName, dsn(path))
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows a single writer, a single connection serializes access
+	// without SQLITE_BUSY errors
+	db.SetMaxOpenConns(1)
+
+	d := &DB{path: path, db: db}
+	if err := d.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("upgrading sqlite schema: %w", err)
+	}
+	return d, nil
+}
+
+// dsn builds the connection string for the database file at path, escaping
+// characters in the path that would otherwise be read as query parameters
+func dsn(path string) string {
+	u := url.URL{
+		Scheme:   "file",
+		Opaque:   (&url.URL{Path: path}).EscapedPath(),
+		RawQuery: "_foreign_keys=1&_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate",
+	}
+	return u.String()
+}
+
+// Path returns the location of the database file
+func (d *DB) Path() string {
+	return d.path
+}
+
+// Close closes the database
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Snapshot writes a consistent copy of the database to path, which must not
+// exist. Snapshot is safe to call while the database is in use
+func (d *DB) Snapshot(ctx context.Context, path string) error {
+	_, err := d.db.ExecContext(ctx, `VACUUM INTO ?`, path)
+	return err
+}
+
+func (d *DB) migrate() error {
+	var version int
+	if err := d.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		err := d.update(context.Background(), func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migrations[version]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update runs fn in a transaction, committing if fn returns nil
+func (d *DB) update(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DB) getMeta(ctx context.Context, key string) (string, error) {
+	var value string
+	err := d.db.QueryRowContext(ctx, `SELECT value FROM meta WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+func setMeta(tx *sql.Tx, key, value string) error {
+	_, err := tx.Exec(`INSERT INTO meta (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, value)
+	return err
+}
+
+// Repo is a repo.Repo that stores references in a SQLite database. All other
+// repo components behave like a filesystem repo
+type Repo struct {
+	*fsrepo.Repo
+	db *DB
+}
+
+var _ repo.Repo = (*Repo)(nil)
+
+// NewRepo creates a SQLite-backed repo rooted at path. The repo takes
+// ownership of db, closing it when the repo is done
+func NewRepo(ctx context.Context, path string, db *DB, fsys *muxfs.Mux, book *logbook.Book, cache *dscache.Dscache, pro profile.Store, bus event.Bus) (*Repo, error) {
+	r, err := fsrepo.NewRepo(ctx, path, fsys, book, cache, pro, bus)
+	if err != nil {
+		return nil, err
+	}
+	fr := r.(*fsrepo.Repo)
+	fr.Refstore = db.Refstore()
+
+	go func() {
+		// filesystems that hold no resources report done immediately, wait for
+		// the context as well before closing
+		<-ctx.Done()
+		<-fr.Done()
+		if err := db.Close(); err != nil {
+			log.Debugw("closing database", "err", err)
+		}
+	}()
+
+	return &Repo{Repo: fr, db: db}, nil
+}
+
+// DB exposes the database backing the repo
+func (r *Repo) DB() *DB {
+	return r.db
+}
@@ -0,0 +1,507 @@
+//go:build sqlite
+// +build sqlite
+
+package sqliterepo_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qfs/muxfs"
+	"github.com/qri-io/qri/auth/key"
+	"github.com/qri-io/qri/automation/run"
+	"github.com/qri-io/qri/automation/spec"
+	"github.com/qri-io/qri/automation/workflow"
+	"github.com/qri-io/qri/base/params"
+	"github.com/qri-io/qri/collection"
+	testcfg "github.com/qri-io/qri/config/test"
+	"github.com/qri-io/qri/dscache"
+	"github.com/qri-io/qri/dsref"
+	dsrefspec "github.com/qri-io/qri/dsref/spec"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/logbook"
+	"github.com/qri-io/qri/logbook/oplog"
+	"github.com/qri-io/qri/profile"
+	"github.com/qri-io/qri/repo"
+	reporef "github.com/qri-io/qri/repo/ref"
+	sqliterepo "github.com/qri-io/qri/repo/sqlite"
+	repospec "github.com/qri-io/qri/repo/test/spec"
+)
+
+func newTestRepo(t *testing.T, path string) *sqliterepo.Repo {
+	pro, err := profile.NewProfile(testcfg.DefaultProfileForTesting())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	bus := event.NewBus(ctx)
+	fs, err := muxfs.New(ctx, []qfs.Config{
+		{Type: "mem"},
+		{Type: "local"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyStore, err := key.NewMemStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pros, err := profile.NewMemStore(ctx, pro, keyStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqliterepo.Open(filepath.Join(path, sqliterepo.Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := db.Logstore(ctx, pro.PrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book, err := logbook.NewBookWithStore(*pro, bus, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := dscache.NewDscache(ctx, fs, bus, pro.Peername, "")
+	r, err := sqliterepo.NewRepo(ctx, path, db, fs, book, cache, pros, bus)
+	if err != nil {
+		t.Fatalf("error creating repo: %s", err.Error())
+	}
+	return r
+}
+
+func TestOpenEscapesPath(t *testing.T) {
+	path, err := ioutil.TempDir("", "qri_sqlite_open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	// characters that would otherwise end the path & start the query
+	dbPath := filepath.Join(path, "a dir?mode=ro#frag", sqliterepo.Filename)
+	db, err := sqliterepo.Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := os.Stat(dbPath); err != nil {
+		t.Errorf("expected database file at %q: %s", dbPath, err)
+	}
+}
+
+func TestRepo(t *testing.T) {
+	path, err := ioutil.TempDir("", "qri_sqlite_repo_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	rmf := func(t *testing.T) (repo.Repo, func()) {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("error removing files: %q", err)
+		}
+		r := newTestRepo(t, path)
+		return r, func() { r.DB().Close() }
+	}
+
+	repospec.RunRepoTests(t, rmf)
+}
+
+func TestResolveRef(t *testing.T) {
+	path, err := ioutil.TempDir("", "qri_sqlite_repo_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	r := newTestRepo(t, path)
+	defer r.DB().Close()
+	ctx := context.Background()
+
+	dsrefspec.AssertResolverSpec(t, r, func(ref dsref.Ref, author *profile.Profile, log *oplog.Log) error {
+		datasetRef := reporef.RefFromDsref(ref)
+		err := r.PutRef(datasetRef)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.Logbook().MergeLog(ctx, author.PubKey, log)
+	})
+}
+
+func TestRunStore(t *testing.T) {
+	path, err := ioutil.TempDir("", "qri_sqlite_run_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	db, err := sqliterepo.Open(filepath.Join(path, sqliterepo.Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	spec.AssertRunStore(t, db.RunStore())
+}
+
+func TestWorkflowStore(t *testing.T) {
+	path, err := ioutil.TempDir("", "qri_sqlite_workflow_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	db, err := sqliterepo.Open(filepath.Join(path, sqliterepo.Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.AssertWorkflowStore(t, db.WorkflowStore())
+	db.Close()
+
+	os.Remove(filepath.Join(path, sqliterepo.Filename))
+	if db, err = sqliterepo.Open(filepath.Join(path, sqliterepo.Filename)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	assertWorkflowLister(t, db.WorkflowStore())
+}
+
+// assertWorkflowLister checks listing workflows. spec.AssertWorkflowLister
+// activates workflows after putting them, relying on the store to return the
+// pointers it holds, which a database can't do
+func assertWorkflowLister(t *testing.T, store *sqliterepo.WorkflowStore) {
+	ctx := context.Background()
+	// spec tests leave workflow IDs drawing from a finite reader
+	workflow.SetIDRand(nil)
+	all := []workflow.ID{}
+	deployed := []workflow.ID{}
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		created := start.Add(time.Duration(i) * time.Second)
+		wf, err := store.Put(ctx, &workflow.Workflow{
+			InitID:  fmt.Sprintf("dataset_%d", i),
+			OwnerID: "profile_id",
+			Created: &created,
+			Active:  i%2 == 0,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// lists are in reverse chronological order
+		all = append([]workflow.ID{wf.ID}, all...)
+		if wf.Active {
+			deployed = append([]workflow.ID{wf.ID}, deployed...)
+		}
+	}
+
+	ids := func(wfs []*workflow.Workflow) []workflow.ID {
+		res := make([]workflow.ID, 0, len(wfs))
+		for _, wf := range wfs {
+			res = append(res, wf.ID)
+		}
+		return res
+	}
+
+	got, err := store.List(ctx, "", params.ListAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(all, ids(got)); diff != "" {
+		t.Errorf("List mismatch (-want +got):\n%s", diff)
+	}
+	got, err = store.List(ctx, "", params.List{Offset: 2, Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(all[2:5], ids(got)); diff != "" {
+		t.Errorf("List page mismatch (-want +got):\n%s", diff)
+	}
+	got, err = store.ListDeployed(ctx, "", params.ListAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(deployed, ids(got)); diff != "" {
+		t.Errorf("ListDeployed mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := store.List(ctx, "", params.List{Limit: -10}); err == nil {
+		t.Error("expected a negative limit to error")
+	}
+}
+
+func TestLogstorePersistence(t *testing.T) {
+	path, err := ioutil.TempDir("", "qri_sqlite_logstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	ctx := context.Background()
+	pro, err := profile.NewProfile(testcfg.DefaultProfileForTesting())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqliterepo.Open(filepath.Join(path, sqliterepo.Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := db.Logstore(ctx, pro.PrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := oplog.InitLog(oplog.Op{Type: oplog.OpTypeInit, Model: 0x1, AuthorID: "author", Name: "root"})
+	a := oplog.InitLog(oplog.Op{Type: oplog.OpTypeInit, Model: 0x2, AuthorID: "author", Name: "a"})
+	b := oplog.InitLog(oplog.Op{Type: oplog.OpTypeInit, Model: 0x2, AuthorID: "author", Name: "b"})
+	root.AddChild(a)
+	root.AddChild(b)
+	if err := s.MergeLog(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	a.Append(oplog.Op{Type: oplog.OpTypeAmend, Model: 0x2, Name: "a_renamed"})
+	a.AddChild(oplog.InitLog(oplog.Op{Type: oplog.OpTypeInit, Model: 0x3, AuthorID: "author", Name: "main"}))
+	if err := s.PutLog(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveLog(ctx, "root", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	other := oplog.InitLog(oplog.Op{Type: oplog.OpTypeInit, Model: 0x1, AuthorID: "other", Name: "other"})
+	if err := s.MergeLog(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	root.Append(oplog.Op{Type: oplog.OpTypeAmend, Model: 0x1, Name: "root_renamed"})
+	if err := s.PutOps(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := logsBytes(t, s)
+	db.Close()
+
+	if db, err = sqliterepo.Open(filepath.Join(path, sqliterepo.Filename)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if s, err = db.Logstore(ctx, pro.PrivKey); err != nil {
+		t.Fatal(err)
+	}
+	if got := logsBytes(t, s); !bytes.Equal(expect, got) {
+		t.Errorf("reopened logstore doesn't match state before close")
+	}
+	if _, err := s.HeadRef(ctx, "root_renamed", "a_renamed", "main"); err != nil {
+		t.Errorf("expected reopened logstore to contain put log. got: %s", err)
+	}
+	if _, err := s.HeadRef(ctx, "root_renamed", "b"); err == nil {
+		t.Errorf("expected removed log to stay removed after reopening")
+	}
+}
+
+func logsBytes(t *testing.T, s *sqliterepo.Logstore) []byte {
+	logs, err := s.Logs(context.Background(), 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	for _, l := range logs {
+		buf.Write(l.FlatbufferBytes())
+	}
+	return buf.Bytes()
+}
+
+func TestMigrateFSRepo(t *testing.T) {
+	path, err := ioutil.TempDir("", "qri_sqlite_migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	ctx := context.Background()
+	pro, err := profile.NewProfile(testcfg.DefaultProfileForTesting())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// write the state of a filesystem repo
+	refs := repo.RefList{{Peername: "peer", ProfileID: pro.ID, Name: "cities", Path: "/mem/QmCities"}}
+	if err := ioutil.WriteFile(filepath.Join(path, "refs.fbs"), repo.FlatbufferBytes(refs), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	journal := &oplog.Journal{}
+	userLog := oplog.InitLog(oplog.Op{Type: oplog.OpTypeInit, Model: logbook.UserModel, AuthorID: pro.ID.Encode(), Name: "peer"})
+	userLog.AddChild(oplog.InitLog(oplog.Op{Type: oplog.OpTypeInit, Model: logbook.DatasetModel, AuthorID: pro.ID.Encode(), Name: "cities"}))
+	if err := journal.MergeLog(ctx, userLog); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := journal.FlatbufferCipher(pro.PrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, "logbook.qfb"), ciphertext, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := run.NewMemStore()
+	first, err := runs.Create(ctx, &run.State{WorkflowID: "wid", Status: run.RSFailed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := runs.Create(ctx, &run.State{WorkflowID: "wid", Status: run.RSSucceeded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, "runs.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wfs, err := workflow.NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Now()
+	wf, err := wfs.Put(ctx, &workflow.Workflow{InitID: "init_id", OwnerID: pro.ID, Created: &created})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cols, err := collection.NewLocalSet(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := dsref.VersionInfo{InitID: "init_id", ProfileID: pro.ID.Encode(), Username: "peer", Name: "cities"}
+	if err := cols.Add(ctx, pro.ID, item); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqliterepo.Open(filepath.Join(path, sqliterepo.Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.MigrateFSRepo(ctx, path, "", pro.PrivKey); err != nil {
+		t.Fatal(err)
+	}
+	// migrating a second time is a no-op
+	if err := db.MigrateFSRepo(ctx, path, "", pro.PrivKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, err := db.Refstore().RefCount(); err != nil {
+		t.Fatal(err)
+	} else if count != 1 {
+		t.Errorf("expected 1 ref after migration, got %d", count)
+	}
+	if got, err := db.Refstore().GetRef(reporef.DatasetRef{Peername: "peer", Name: "cities"}); err != nil {
+		t.Error(err)
+	} else if got.Path != "/mem/QmCities" {
+		t.Errorf("migrated ref path mismatch. want %q, got %q", "/mem/QmCities", got.Path)
+	}
+
+	store, err := db.Logstore(ctx, pro.PrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.HeadRef(ctx, "peer", "cities"); err != nil {
+		t.Errorf("expected migrated logbook to contain dataset log. got: %s", err)
+	}
+
+	if count, err := db.RunStore().Count(ctx, "wid"); err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Errorf("expected 2 runs after migration, got %d", count)
+	}
+	if got, err := db.RunStore().GetLatest(ctx, "wid"); err != nil {
+		t.Fatal(err)
+	} else if got.ID != latest.ID {
+		t.Errorf("expected latest run to be %q, got %q", latest.ID, got.ID)
+	}
+	if _, err := db.RunStore().Get(ctx, first.ID); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := db.WorkflowStore().Get(ctx, wf.ID); err != nil {
+		t.Errorf("expected migrated workflow. got: %s", err)
+	}
+
+	items, err := db.CollectionSet().List(ctx, pro.ID, params.ListAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].InitID != item.InitID {
+		t.Errorf("expected migrated collection to contain %q, got %v", item.InitID, items)
+	}
+}
+
+func TestMigrateFSRepoSegments(t *testing.T) {
+	path, err := ioutil.TempDir("", "qri_sqlite_migrate_segments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	ctx := context.Background()
+	pro, err := profile.NewProfile(testcfg.DefaultProfileForTesting())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a stale journal file is left in place after a repo moves to segments
+	journal := &oplog.Journal{}
+	if err := journal.MergeLog(ctx, oplog.InitLog(oplog.Op{Type: oplog.OpTypeInit, Model: logbook.UserModel, AuthorID: pro.ID.Encode(), Name: "peer"})); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := journal.FlatbufferCipher(pro.PrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, "logbook.qfb"), ciphertext, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := oplog.OpenSegmentStore(filepath.Join(path, "logbook"), pro.PrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userLog := oplog.InitLog(oplog.Op{Type: oplog.OpTypeInit, Model: logbook.UserModel, AuthorID: pro.ID.Encode(), Name: "peer"})
+	userLog.AddChild(oplog.InitLog(oplog.Op{Type: oplog.OpTypeInit, Model: logbook.DatasetModel, AuthorID: pro.ID.Encode(), Name: "cities"}))
+	if err := segments.MergeLog(ctx, userLog); err != nil {
+		t.Fatal(err)
+	}
+	if err := segments.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqliterepo.Open(filepath.Join(path, sqliterepo.Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.MigrateFSRepo(ctx, path, "segments", pro.PrivKey); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := db.Logstore(ctx, pro.PrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.HeadRef(ctx, "peer", "cities"); err != nil {
+		t.Errorf("expected logbook to be migrated from segments. got: %s", err)
+	}
+}
@@ -0,0 +1,166 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/qri-io/qri/automation/workflow"
+	"github.com/qri-io/qri/base/params"
+	"github.com/qri-io/qri/profile"
+)
+
+// WorkflowStore is a workflow.Store stored in the workflows table
+type WorkflowStore struct {
+	db *DB
+}
+
+var (
+	_ workflow.Store  = (*WorkflowStore)(nil)
+	_ workflow.Lister = (*WorkflowStore)(nil)
+)
+
+// WorkflowStore returns the database's workflow store
+func (d *DB) WorkflowStore() *WorkflowStore {
+	return &WorkflowStore{db: d}
+}
+
+// List lists workflows in reverse chronological order by creation time
+func (s *WorkflowStore) List(ctx context.Context, pid profile.ID, lp params.List) ([]*workflow.Workflow, error) {
+	if err := validateWorkflowList(lp); err != nil {
+		return nil, err
+	}
+	return s.query(ctx, `SELECT owner_id, data FROM workflows ORDER BY created IS NOT NULL, created DESC LIMIT ? OFFSET ?`, limit(lp), lp.Offset)
+}
+
+// ListDeployed lists active workflows in reverse chronological order by
+// creation time
+func (s *WorkflowStore) ListDeployed(ctx context.Context, pid profile.ID, lp params.List) ([]*workflow.Workflow, error) {
+	if err := validateWorkflowList(lp); err != nil {
+		return nil, err
+	}
+	return s.query(ctx, `SELECT owner_id, data FROM workflows WHERE active ORDER BY created IS NOT NULL, created DESC LIMIT ? OFFSET ?`, limit(lp), lp.Offset)
+}
+
+func validateWorkflowList(lp params.List) error {
+	switch {
+	case lp.All():
+		return nil
+	case lp.Limit < 0:
+		return fmt.Errorf("limit of %d is out of bounds", lp.Limit)
+	case lp.Offset < 0:
+		return fmt.Errorf("offset of %d is out of bounds", lp.Offset)
+	}
+	return nil
+}
+
+// GetByInitID gets a workflow with the corresponding InitID field
+func (s *WorkflowStore) GetByInitID(ctx context.Context, initID string) (*workflow.Workflow, error) {
+	return getWorkflow(s.db.db.QueryRowContext(ctx, `SELECT owner_id, data FROM workflows WHERE init_id = ? LIMIT 1`, initID))
+}
+
+// Get gets a workflow by ID
+func (s *WorkflowStore) Get(ctx context.Context, id workflow.ID) (*workflow.Workflow, error) {
+	return getWorkflow(s.db.db.QueryRowContext(ctx, `SELECT owner_id, data FROM workflows WHERE id = ?`, id.String()))
+}
+
+// Put places a workflow in the store, overwriting any workflow with the same
+// ID. Workflows without an ID are assigned one, and must not share an InitID
+// with an existing workflow
+func (s *WorkflowStore) Put(ctx context.Context, wf *workflow.Workflow) (*workflow.Workflow, error) {
+	if wf == nil {
+		return nil, workflow.ErrNilWorkflow
+	}
+	w := wf.Copy()
+
+	err := s.db.update(ctx, func(tx *sql.Tx) error {
+		if w.ID == "" {
+			if _, err := getWorkflow(tx.QueryRowContext(ctx, `SELECT owner_id, data FROM workflows WHERE init_id = ? LIMIT 1`, w.InitID)); !errors.Is(err, workflow.ErrNotFound) {
+				return workflow.ErrWorkflowForDatasetExists
+			}
+			w.ID = workflow.NewID()
+		}
+		if err := w.Validate(); err != nil {
+			return err
+		}
+		return putWorkflow(ctx, tx, w)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Remove removes a workflow from the store
+func (s *WorkflowStore) Remove(ctx context.Context, id workflow.ID) error {
+	res, err := s.db.db.ExecContext(ctx, `DELETE FROM workflows WHERE id = ?`, id.String())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return workflow.ErrNotFound
+	}
+	return nil
+}
+
+// Shutdown is a no-op, the database is closed by the repo
+func (s *WorkflowStore) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (s *WorkflowStore) query(ctx context.Context, query string, args ...interface{}) ([]*workflow.Workflow, error) {
+	rows, err := s.db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wfs := []*workflow.Workflow{}
+	for rows.Next() {
+		wf, err := getWorkflow(rows)
+		if err != nil {
+			return nil, err
+		}
+		wfs = append(wfs, wf)
+	}
+	return wfs, rows.Err()
+}
+
+// workflowData is the JSON stored in the data column. OwnerID is stored as raw
+// bytes in its own column, JSON encoding only round-trips valid profile IDs
+type workflowData struct {
+	*workflow.Workflow
+	OwnerID string `json:"ownerID,omitempty"`
+}
+
+// putWorkflow upserts a workflow
+func putWorkflow(ctx context.Context, tx *sql.Tx, w *workflow.Workflow) error {
+	data, err := json.Marshal(workflowData{Workflow: w})
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO workflows (id, init_id, owner_id, active, created, data) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET init_id = excluded.init_id, owner_id = excluded.owner_id, active = excluded.active, created = excluded.created, data = excluded.data`,
+		w.ID.String(), w.InitID, []byte(w.OwnerID), w.Active, nullTime(w.Created), data)
+	return err
+}
+
+func getWorkflow(row scanner) (*workflow.Workflow, error) {
+	var data, ownerID []byte
+	if err := row.Scan(&ownerID, &data); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, workflow.ErrNotFound
+		}
+		return nil, err
+	}
+	wf := &workflow.Workflow{}
+	if err := json.Unmarshal(data, &workflowData{Workflow: wf}); err != nil {
+		return nil, err
+	}
+	wf.OwnerID = profile.ID(ownerID)
+	return wf, nil
+}
@@ -0,0 +1,133 @@
+// Package trace propagates spans across process boundaries. Spans follow the
+// OpenTelemetry data model, and cross HTTP requests in a W3C trace context
+// "traceparent" header
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPHeader is the W3C trace context header that carries a span over HTTP
+const HTTPHeader = "traceparent"
+
+// SpanContext identifies a span within a trace
+type SpanContext struct {
+	// TraceID is a 16-byte hex-encoded trace identifier
+	TraceID string `json:"traceID"`
+	// SpanID is an 8-byte hex-encoded span identifier
+	SpanID string `json:"spanID"`
+}
+
+// IsValid returns true if both trace & span identifiers are set
+func (sc SpanContext) IsValid() bool {
+	return len(sc.TraceID) == 32 && len(sc.SpanID) == 16
+}
+
+// Traceparent encodes the span context as a traceparent header value
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", sc.TraceID, sc.SpanID)
+}
+
+// ParseTraceparent decodes a traceparent header value
+func ParseTraceparent(s string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", s)
+	}
+	sc := SpanContext{TraceID: parts[1], SpanID: parts[2]}
+	if !sc.IsValid() || !isHex(sc.TraceID) || !isHex(sc.SpanID) {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", s)
+	}
+	return sc, nil
+}
+
+// Span is a timed operation within a trace
+type Span struct {
+	SpanContext
+	// ParentID is the span ID of the parent span, empty for root spans
+	ParentID string        `json:"parentID,omitempty"`
+	Name     string        `json:"name"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// End records the duration of the span & any error it finished with
+func (s *Span) End(err error) {
+	s.Duration = time.Since(s.Start)
+	if err != nil {
+		s.Error = err.Error()
+	}
+}
+
+// ctxKey is a private type for storing span context in a context.Context
+type ctxKey struct{}
+
+// AddToContext sets the span context new spans are children of
+func AddToContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, ctxKey{}, sc)
+}
+
+// FromCtx extracts the current span context, returning false if the context
+// doesn't carry one
+func FromCtx(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(ctxKey{}).(SpanContext)
+	return sc, ok
+}
+
+// Start begins a span named name. The span is a child of the span in ctx, or
+// the root of a new trace. The returned context carries the new span
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	s := &Span{Name: name, Start: time.Now()}
+	if parent, ok := FromCtx(ctx); ok {
+		s.TraceID = parent.TraceID
+		s.ParentID = parent.SpanID
+	} else {
+		s.TraceID = randomID(16)
+	}
+	s.SpanID = randomID(8)
+	return AddToContext(ctx, s.SpanContext), s
+}
+
+// AddContextSpanToRequest writes the span in ctx to a request header, returns
+// true if a span is added
+func AddContextSpanToRequest(ctx context.Context, r *http.Request) (*http.Request, bool) {
+	if sc, ok := FromCtx(ctx); ok {
+		r.Header.Set(HTTPHeader, sc.Traceparent())
+		return r, true
+	}
+	return r, false
+}
+
+// Middleware reads any traceparent header & adds it to the request context,
+// making spans started while handling the request children of the caller's
+// span
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := r.Header.Get(HTTPHeader); h != "" {
+			if sc, err := ParseTraceparent(h); err == nil {
+				r = r.WithContext(AddToContext(r.Context(), sc))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func randomID(n int) string {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(data)
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
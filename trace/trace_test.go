@@ -0,0 +1,79 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStartChildSpans(t *testing.T) {
+	ctx, root := Start(context.Background(), "root")
+	if !root.IsValid() || root.ParentID != "" {
+		t.Fatalf("expected a valid root span, got %#v", root)
+	}
+	_, child := Start(ctx, "child")
+	if child.TraceID != root.TraceID || child.ParentID != root.SpanID || child.SpanID == root.SpanID {
+		t.Errorf("expected child of %#v, got %#v", root, child)
+	}
+
+	child.End(errors.New("oh noes"))
+	if child.Error != "oh noes" {
+		t.Errorf("expected span error to be recorded, got %q", child.Error)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	good := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Traceparent() != good {
+		t.Errorf("round trip mismatch. want %q, got %q", good, sc.Traceparent())
+	}
+
+	bad := []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+		"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+	for _, s := range bad {
+		if _, err := ParseTraceparent(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestPropagateOverHTTP(t *testing.T) {
+	ctx, client := Start(context.Background(), "client")
+
+	var got SpanContext
+	s := httptest.NewServer(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "server")
+		got = span.SpanContext
+		if span.ParentID != client.SpanID {
+			t.Errorf("expected server span parent %q, got %q", client.SpanID, span.ParentID)
+		}
+	})))
+	defer s.Close()
+
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, added := AddContextSpanToRequest(ctx, req); !added {
+		t.Fatal("expected span to be added to request")
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if got.TraceID != client.TraceID {
+		t.Errorf("expected server span in trace %q, got %q", client.TraceID, got.TraceID)
+	}
+}
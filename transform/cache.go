@@ -0,0 +1,228 @@
+package transform
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/transform/startf"
+	"github.com/qri-io/qri/transform/stepcache"
+	"github.com/qri-io/qri/transform/tfstate"
+)
+
+// cacheHTTPClient checks if cached http inputs have changed
+var cacheHTTPClient = http.DefaultClient
+
+// SetStepCache enables step caching. Before running a starlark step the
+// transformer looks for a cached result with the same script, config,
+// secrets & previous step results. If the datasets & http responses the
+// cached step read are unchanged, the step's results are restored instead of
+// running the step. When refresh is true cached results are ignored, every
+// step runs & replaces its cache entry
+func (t *Transformer) SetStepCache(store stepcache.Store, refresh bool) {
+	t.cache = store
+	t.refreshCache = refresh
+}
+
+// cacheSeed is the starting key of a chain of cached steps, fingerprinting
+// the state every step can read: the dataset the transform is bound to,
+// transform config, run parameters, secrets, and state persisted by the
+// previous run
+func cacheSeed(target *dataset.Dataset, secrets map[string]string, params map[string]interface{}, st tfstate.State) (string, error) {
+	head := &dataset.Dataset{}
+	head.Assign(target)
+	// commits include run-specific details, and the transform is hashed one
+	// step at a time
+	head.Commit = nil
+	head.Transform = nil
+
+	var config map[string]interface{}
+	if target.Transform != nil {
+		config = target.Transform.Config
+	}
+	data, err := json.Marshal(struct {
+		Head    *dataset.Dataset       `json:"head"`
+		Config  map[string]interface{} `json:"config"`
+		Params  map[string]interface{} `json:"params"`
+		Secrets map[string]string      `json:"secrets"`
+		State   tfstate.State          `json:"state"`
+	}{head, config, params, secrets, st})
+	if err != nil {
+		return "", err
+	}
+	return startf.HashBytes(data), nil
+}
+
+// stepCacheKey hashes a step with the fingerprint of the steps before it
+func stepCacheKey(prev string, st *dataset.TransformStep, script string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s", prev, st.Syntax, st.Category, script)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// stepFingerprint combines a step key with the inputs the step read, so
+// steps that follow a step with changed inputs get a different key
+func stepFingerprint(key string, inputs startf.StepInputs) string {
+	data, _ := json.Marshal(inputs)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", key)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// runCachedStep runs a starlark step, restoring the step from the cache when
+// possible. It returns the fingerprint of the step for use as the prefix of
+// the next step's key
+func (t *Transformer) runCachedStep(ctx context.Context, r *startf.StepRunner, target *dataset.Dataset, st *dataset.TransformStep, prev string) (fingerprint string, cached bool, err error) {
+	script, ok := st.Script.(string)
+	if t.cache == nil || !ok {
+		return "", false, r.RunStep(ctx, target, st)
+	}
+	key := stepCacheKey(prev, st, script)
+
+	// recorded runs read every response, so no step is restored
+	if !t.refreshCache && !t.recording {
+		if entry, ok := t.cachedStep(ctx, key); ok {
+			// a failed restore may partially assign globals, running the step
+			// overwrites them
+			err := r.Restore(ctx, target, st, entry.Snapshot)
+			if err == nil {
+				log.Debugw("restored cached step", "name", st.Name, "key", key)
+				return stepFingerprint(key, entry.Inputs), true, nil
+			}
+			log.Debugw("restoring cached step", "key", key, "err", err)
+		}
+	}
+
+	if err := r.RunStep(ctx, target, st); err != nil {
+		return "", false, err
+	}
+	return t.cacheStep(ctx, r, target, key), false, nil
+}
+
+// SetRecordResponses records the bodies of http responses read by commit
+// runs in a store, keyed by the run ID the created version records as
+// Commit.RunID. Recorded responses let the version be verified by replaying
+// the run without network access. Recording runs every step, replacing cached
+// results
+func (t *Transformer) SetRecordResponses(store stepcache.ResponseStore) {
+	t.responses = store
+}
+
+// recordResponses stores the bodies of http responses a step read
+func (t *Transformer) recordResponses(ctx context.Context, runID string, r *startf.StepRunner) {
+	now := time.Now()
+	for _, in := range r.StepInputs().Requests {
+		body, ok := r.StepResponse(in.Hash)
+		if !ok {
+			continue
+		}
+		res := &stepcache.Response{
+			Method:   in.Method,
+			URL:      in.URL,
+			Hash:     in.Hash,
+			Body:     body,
+			Recorded: now,
+		}
+		if err := t.responses.PutResponse(ctx, runID, res); err != nil {
+			log.Debugw("recording http response", "url", in.URL, "err", err)
+		}
+	}
+}
+
+// cachedStep gets a cache entry, if one exists with unchanged inputs
+func (t *Transformer) cachedStep(ctx context.Context, key string) (*stepcache.Entry, bool) {
+	entry, err := t.cache.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, stepcache.ErrNotFound) {
+			log.Debugw("reading step cache", "key", key, "err", err)
+		}
+		return nil, false
+	}
+	return entry, t.inputsUnchanged(ctx, entry.Inputs)
+}
+
+// cacheStep records the results of a step that just ran
+func (t *Transformer) cacheStep(ctx context.Context, r *startf.StepRunner, target *dataset.Dataset, key string) string {
+	inputs := r.StepInputs()
+	snap, err := r.Snapshot(target)
+	if err != nil {
+		log.Debugw("not caching step", "key", key, "err", err)
+		return stepFingerprint(key, inputs)
+	}
+	entry := &stepcache.Entry{
+		Key:      key,
+		Inputs:   inputs,
+		Snapshot: snap,
+		Created:  time.Now(),
+	}
+	if err := t.cache.Put(ctx, entry); err != nil {
+		log.Debugw("writing step cache", "key", key, "err", err)
+	}
+	return stepFingerprint(key, inputs)
+}
+
+// inputsUnchanged checks the inputs of a cached step are still the same
+func (t *Transformer) inputsUnchanged(ctx context.Context, inputs startf.StepInputs) bool {
+	for _, in := range inputs.Datasets {
+		ds, err := t.loader.LoadDataset(ctx, in.Ref)
+		if err != nil || ds.Path != in.Path {
+			log.Debugw("cached dataset input changed", "ref", in.Ref, "err", err)
+			return false
+		}
+	}
+	for _, in := range inputs.Requests {
+		changed, err := httpInputChanged(ctx, in)
+		if err != nil || changed {
+			log.Debugw("cached http input changed", "url", in.URL, "err", err)
+			return false
+		}
+	}
+	return true
+}
+
+// httpInputChanged checks if the response to a cached request has changed.
+// Responses with validators are checked with a HEAD request, without
+// downloading the body. Responses without validators are identified by the
+// request alone & treated as unchanged; refreshing the cache fetches them
+// again
+func httpInputChanged(ctx context.Context, in startf.HTTPInput) (bool, error) {
+	if in.Method != http.MethodGet {
+		return true, nil
+	}
+	if in.ETag == "" && in.LastModified == "" {
+		return false, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, in.URL, nil)
+	if err != nil {
+		return true, err
+	}
+	if in.ETag != "" {
+		req.Header.Set("If-None-Match", in.ETag)
+	}
+	if in.LastModified != "" {
+		req.Header.Set("If-Modified-Since", in.LastModified)
+	}
+
+	res, err := cacheHTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotModified:
+		return false, nil
+	case res.StatusCode != http.StatusOK:
+		return true, fmt.Errorf("unexpected status checking %s: %s", in.URL, res.Status)
+	case in.ETag != "":
+		return res.Header.Get("ETag") != in.ETag, nil
+	default:
+		return res.Header.Get("Last-Modified") != in.LastModified, nil
+	}
+}
@@ -0,0 +1,199 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/transform/stepcache"
+)
+
+// cacheServer serves a json body with an ETag, counting requests that
+// return the full body
+type cacheServer struct {
+	lk       sync.Mutex
+	body     string
+	fetches  int
+	revision int
+}
+
+func (s *cacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	etag := fmt.Sprintf(`"%d"`, s.revision)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	s.fetches++
+	w.Header().Set("ETag", etag)
+	w.Write([]byte(s.body))
+}
+
+func (s *cacheServer) setBody(body string) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.body = body
+	s.revision++
+}
+
+// withStepCache runs a transform with a step cache
+func withStepCache(store stepcache.Store, refresh bool) func(*Transformer, event.Bus) {
+	return func(tfr *Transformer, _ event.Bus) {
+		tfr.SetStepCache(store, refresh)
+	}
+}
+
+// cachedSteps lists whether each step of a run restored results from the
+// step cache, failing if any step didn't succeed
+func cachedSteps(t *testing.T, log []event.Event) []bool {
+	t.Helper()
+	cached := []bool{}
+	for _, e := range log {
+		if e.Type == event.ETTransformStepStop {
+			step := e.Payload.(event.TransformStepLifecycle)
+			if step.Status != StatusSucceeded {
+				t.Errorf("step %q status: %s", step.Name, step.Status)
+			}
+			cached = append(cached, step.Cached)
+		}
+	}
+	return cached
+}
+
+// cacheTransform reads the transform that fetches from a cache server
+func cacheTransform(t *testing.T, url string) *dataset.Transform {
+	tf := &dataset.Transform{Config: map[string]interface{}{"url": url}}
+	tf.SetScriptFile(scriptFile(t, "testdata/cache.star"))
+	return tf
+}
+
+func TestApplyStepCache(t *testing.T) {
+	srv := &cacheServer{body: `[["a", 1], ["b", 2]]`}
+	s := httptest.NewServer(srv)
+	defer s.Close()
+
+	store := stepcache.NewMemStore()
+
+	log := applyNoHistoryTransform(t, "", cacheTransform(t, s.URL), "cache_run", "apply", withStepCache(store, false))
+	expect := previewBody(t, log)
+	if diff := cmp.Diff(`[["a",1],["b",2],["total",3]]`, expect); diff != "" {
+		t.Errorf("body mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]bool{false, false, false}, cachedSteps(t, log)); diff != "" {
+		t.Errorf("first run cached steps mismatch (-want +got):\n%s", diff)
+	}
+
+	log = applyNoHistoryTransform(t, "", cacheTransform(t, s.URL), "cache_run", "apply", withStepCache(store, false))
+	if diff := cmp.Diff([]bool{true, true, true}, cachedSteps(t, log)); diff != "" {
+		t.Errorf("second run cached steps mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(expect, previewBody(t, log)); diff != "" {
+		t.Errorf("cached body mismatch (-want +got):\n%s", diff)
+	}
+	if srv.fetches != 1 {
+		t.Errorf("expected cached run to revalidate without fetching, got %d fetches", srv.fetches)
+	}
+
+	// refreshing runs every step
+	log = applyNoHistoryTransform(t, "", cacheTransform(t, s.URL), "cache_run", "apply", withStepCache(store, true))
+	if diff := cmp.Diff([]bool{false, false, false}, cachedSteps(t, log)); diff != "" {
+		t.Errorf("refresh run cached steps mismatch (-want +got):\n%s", diff)
+	}
+
+	// a changed response invalidates the step that read it & every step after
+	srv.setBody(`[["a", 3]]`)
+	log = applyNoHistoryTransform(t, "", cacheTransform(t, s.URL), "cache_run", "apply", withStepCache(store, false))
+	if diff := cmp.Diff([]bool{false, false, false}, cachedSteps(t, log)); diff != "" {
+		t.Errorf("changed input cached steps mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(`[["a",3],["total",3]]`, previewBody(t, log)); diff != "" {
+		t.Errorf("changed input body mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestApplyStepCacheScriptChange(t *testing.T) {
+	store := stepcache.NewMemStore()
+	steps := func(x int) *dataset.Transform {
+		return &dataset.Transform{Steps: []*dataset.TransformStep{
+			{Syntax: "starlark", Script: fmt.Sprintf("x = %d", x)},
+			{Syntax: "starlark", Script: "ds = dataset.latest()\nds.body = [[x]]\ndataset.commit(ds)"},
+		}}
+	}
+	applyNoHistoryTransform(t, "", steps(1), "cache_run", "apply", withStepCache(store, false))
+
+	// changing a step invalidates the steps that follow it
+	log := applyNoHistoryTransform(t, "", steps(2), "cache_run", "apply", withStepCache(store, false))
+	if diff := cmp.Diff([]bool{false, false}, cachedSteps(t, log)); diff != "" {
+		t.Errorf("cached steps mismatch (-want +got):\n%s", diff)
+	}
+
+	log = applyNoHistoryTransform(t, "", steps(2), "cache_run", "apply", withStepCache(store, false))
+	if diff := cmp.Diff([]bool{true, true}, cachedSteps(t, log)); diff != "" {
+		t.Errorf("cached steps mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestApplyHTTPReplay(t *testing.T) {
+	srv := &cacheServer{body: `[["a", 1], ["b", 2]]`}
+	s := httptest.NewServer(srv)
+	store := stepcache.NewMemStore()
+	withRecording := func(tfr *Transformer, _ event.Bus) {
+		tfr.SetStepCache(store, false)
+		tfr.SetRecordResponses(store)
+	}
+
+	// apply runs don't create versions, so responses aren't recorded
+	applyNoHistoryTransform(t, "", cacheTransform(t, s.URL), "apply_run", "apply", withRecording)
+	if runs := mustResponseRuns(t, store); len(runs) != 0 {
+		t.Errorf("expected apply run not to record responses, got: %v", runs)
+	}
+
+	// a cached step still runs when recording, so its responses are read
+	expect := previewBody(t, applyNoHistoryTransform(t, "", cacheTransform(t, s.URL), "commit_run", "commit", withRecording))
+	if diff := cmp.Diff([]string{"commit_run"}, mustResponseRuns(t, store)); diff != "" {
+		t.Errorf("recorded runs mismatch (-want +got):\n%s", diff)
+	}
+	// responses are replayed with the server gone
+	s.Close()
+
+	replay := stepcache.NewReplayer(store, "commit_run")
+	withReplay := func(tfr *Transformer, _ event.Bus) {
+		tfr.SetHTTPReplay(replay)
+	}
+	log := applyNoHistoryTransform(t, "", cacheTransform(t, s.URL), "replay_run", "apply", withReplay)
+	if err := runError(log); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expect, previewBody(t, log)); diff != "" {
+		t.Errorf("replayed body mismatch (-want +got):\n%s", diff)
+	}
+	if missing := replay.Missing(); len(missing) != 0 {
+		t.Errorf("expected no missing responses, got: %v", missing)
+	}
+
+	// responses recorded by other runs aren't used
+	replay = stepcache.NewReplayer(store, "apply_run")
+	log = applyNoHistoryTransform(t, "", cacheTransform(t, s.URL), "replay_run_2", "apply", withReplay)
+	if runError(log) == nil {
+		t.Error("expected replaying without a recorded response to fail")
+	}
+	if diff := cmp.Diff([]string{"GET " + s.URL}, replay.Missing()); diff != "" {
+		t.Errorf("missing responses mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func mustResponseRuns(t *testing.T, store stepcache.ResponseStore) []string {
+	t.Helper()
+	runs, err := store.ResponseRuns(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runs
+}
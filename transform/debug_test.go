@@ -0,0 +1,124 @@
+package transform
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/transform/startf"
+)
+
+// withDebugger runs a transform with a debugger, responding to each pause
+// with the next action. Execution stops once actions run out
+func withDebugger(t *testing.T, d *startf.Debugger, actions ...string) func(*Transformer, event.Bus) {
+	return func(tfr *Transformer, bus event.Bus) {
+		tfr.SetDebugger(d)
+		bus.SubscribeTypes(func(ctx context.Context, e event.Event) error {
+			state := e.Payload.(event.TransformDebugState)
+			cmd := event.TransformDebugCommand{RunID: state.RunID, Action: event.TransformDebugStop}
+			if len(actions) > 0 {
+				cmd.Action, actions = actions[0], actions[1:]
+			}
+			if err := d.Send(cmd); err != nil {
+				t.Errorf("sending debug command: %s", err)
+			}
+			return nil
+		}, event.ETTransformDebugPaused)
+	}
+}
+
+// pausedStates lists the debugger pauses in a run event log
+func pausedStates(log []event.Event) []event.TransformDebugState {
+	states := []event.TransformDebugState{}
+	for _, e := range log {
+		if e.Type == event.ETTransformDebugPaused {
+			states = append(states, e.Payload.(event.TransformDebugState))
+		}
+	}
+	return states
+}
+
+func TestApplyDebugBreakpoints(t *testing.T) {
+	d := startf.NewDebugger("debug_run", []int{2, 8}, false)
+	tf := &dataset.Transform{}
+	tf.SetScriptFile(scriptFile(t, "testdata/debug.star"))
+	log := applyNoHistoryTransform(t, "", tf, "debug_run", "apply", withDebugger(t, d, event.TransformDebugContinue, event.TransformDebugContinue))
+	if err := runError(log); err != nil {
+		t.Fatal(err)
+	}
+	states := pausedStates(log)
+	if len(states) != 2 {
+		t.Fatalf("expected 2 pauses, got: %d", len(states))
+	}
+
+	got := states[0]
+	if got.Line != 2 || got.Function != "double" || got.Reason != "breakpoint" {
+		t.Errorf("unexpected first pause. line: %d function: %q reason: %q", got.Line, got.Function, got.Reason)
+	}
+	if diff := cmp.Diff(map[string]string{"x": "2"}, got.Locals); diff != "" {
+		t.Errorf("locals mismatch (-want +got):\n%s", diff)
+	}
+
+	got = states[1]
+	if got.Line != 8 || got.Step != 1 {
+		t.Errorf("unexpected second pause. line: %d step: %d", got.Line, got.Step)
+	}
+	if got.Globals["count"] != "4" {
+		t.Errorf("expected global count to equal 4, got: %q", got.Globals["count"])
+	}
+	if _, ok := got.Globals["ds"]; !ok {
+		t.Errorf("expected global ds to be set")
+	}
+	if got.Dataset == nil || got.Committed {
+		t.Errorf("expected uncommitted dataset state, got dataset: %v committed: %t", got.Dataset, got.Committed)
+	}
+}
+
+func TestApplyDebugStepping(t *testing.T) {
+	d := startf.NewDebugger("debug_run", nil, false)
+	tf := &dataset.Transform{}
+	tf.SetScriptFile(scriptFile(t, "testdata/debug.star"))
+	log := applyNoHistoryTransform(t, "", tf, "debug_run", "apply", withDebugger(t, d,
+		event.TransformDebugNext,
+		event.TransformDebugStep,
+		event.TransformDebugStop,
+	))
+	if err := runError(log); err == nil || !strings.Contains(err.Error(), startf.ErrDebugStopped.Error()) {
+		t.Errorf("expected stopped error, got: %v", err)
+	}
+
+	lines := []int{}
+	for _, s := range pausedStates(log) {
+		lines = append(lines, s.Line)
+	}
+	// pause before the first statement, next steps over the def, step enters
+	// the function call
+	if diff := cmp.Diff([]int{1, 5, 2}, lines); diff != "" {
+		t.Errorf("paused lines mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestApplyDebugBreakOnError(t *testing.T) {
+	tf := &dataset.Transform{Steps: []*dataset.TransformStep{
+		{Syntax: "starlark", Script: "x = 1\nfail(\"oh no\")"},
+	}}
+	d := startf.NewDebugger("debug_run", []int{100}, true)
+	log := applyNoHistoryTransform(t, "", tf, "debug_run", "apply", withDebugger(t, d, event.TransformDebugContinue))
+	if runError(log) == nil {
+		t.Fatal("expected error")
+	}
+	states := pausedStates(log)
+	if len(states) != 1 {
+		t.Fatalf("expected 1 pause, got: %d", len(states))
+	}
+	got := states[0]
+	if got.Reason != "error" || got.Line != 2 || !strings.Contains(got.Error, "oh no") {
+		t.Errorf("unexpected error pause. reason: %q line: %d error: %q", got.Reason, got.Line, got.Error)
+	}
+	if got.Globals["x"] != "1" {
+		t.Errorf("expected global x to equal 1, got: %q", got.Globals["x"])
+	}
+}
@@ -0,0 +1,138 @@
+package transform
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/transform/startf"
+)
+
+// module version paths
+const (
+	cleaningV1 = "/mem/QmcCcPTqmckdXLBwPQXxfyW2BbFcUT6gqv9oGeWDkrNTyD"
+	cleaningV2 = "/mem/QmcCcPTqmckdXLBwPQXxfyW2BbFcUT6gqv9oGeWDkrNTyE"
+	stringsV1  = "/mem/QmcCcPTqmckdXLBwPQXxfyW2BbFcUT6gqv9oGeWDkrNTyF"
+)
+
+// moduleLoader loads module datasets, each a transform script keyed by
+// version path. References without a path resolve to the latest version
+type moduleLoader struct {
+	latest  map[string]string
+	scripts map[string]string
+}
+
+func (l *moduleLoader) LoadDataset(ctx context.Context, refstr string) (*dataset.Dataset, error) {
+	ref, err := dsref.Parse(refstr)
+	if err != nil {
+		return nil, err
+	}
+	path := ref.Path
+	if path == "" {
+		path = l.latest[ref.Human()]
+	}
+	script, ok := l.scripts[path]
+	if !ok {
+		return nil, dsref.ErrNoHistory
+	}
+	ds := &dataset.Dataset{
+		Peername:  ref.Username,
+		Name:      ref.Name,
+		Path:      path,
+		Transform: &dataset.Transform{},
+	}
+	ds.Transform.SetScriptFile(qfs.NewMemfileBytes("transform.star", []byte(script)))
+	return ds, nil
+}
+
+// withLoader runs a transform with a dataset loader
+func withLoader(loader dsref.Loader) func(*Transformer, event.Bus) {
+	return func(tfr *Transformer, _ event.Bus) {
+		tfr.loader = loader
+	}
+}
+
+func TestApplyDatasetModule(t *testing.T) {
+	loader := &moduleLoader{
+		latest: map[string]string{
+			"team/cleaning": cleaningV2,
+			"team/strings":  stringsV1,
+		},
+		scripts: map[string]string{
+			cleaningV1: "def clean(x):\n  return x.strip()",
+			cleaningV2: "load(\"dataset:team/strings\", \"upper\")\ndef clean(x):\n  return upper(x.strip())\n---\nsuffix = \"!\"",
+			stringsV1:  "def upper(x):\n  return x.upper()",
+		},
+	}
+
+	tf := &dataset.Transform{}
+	tf.SetScriptFile(scriptFile(t, "testdata/module.star"))
+	log := applyNoHistoryTransform(t, "", tf, "module_run", "apply", withLoader(loader))
+	if err := runError(log); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(`[["A!",1]]`, previewBody(t, log)); diff != "" {
+		t.Errorf("body mismatch (-want +got):\n%s", diff)
+	}
+
+	// loaded modules, including modules loaded by modules, are pinned to the
+	// resolved version. modules aren't transform resources
+	expect := map[string]string{
+		"team/cleaning": "team/cleaning@" + cleaningV2,
+		"team/strings":  "team/strings@" + stringsV1,
+	}
+	if diff := cmp.Diff(expect, startf.ModulePins(tf)); diff != "" {
+		t.Errorf("module pins mismatch (-want +got):\n%s", diff)
+	}
+	if len(tf.Resources) != 0 {
+		t.Errorf("expected modules to be left out of transform resources, got: %v", tf.Resources)
+	}
+
+	// modules can be pinned to a version
+	tf = &dataset.Transform{}
+	tf.SetScriptFile(scriptFile(t, "testdata/module_pinned.star"))
+	log = applyNoHistoryTransform(t, "", tf, "module_run", "apply", withLoader(loader))
+	if err := runError(log); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(`[["a",1]]`, previewBody(t, log)); diff != "" {
+		t.Errorf("pinned body mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestApplyDatasetModuleErrors(t *testing.T) {
+	loader := &moduleLoader{
+		latest: map[string]string{
+			"team/a": "/mem/a",
+			"team/b": "/mem/b",
+		},
+		scripts: map[string]string{
+			"/mem/a": "load(\"dataset:team/b\", \"b\")\na = 1",
+			"/mem/b": "load(\"dataset:team/a\", \"a\")\nb = 1",
+		},
+	}
+
+	loadScript := func(script string) *dataset.Transform {
+		return &dataset.Transform{Steps: []*dataset.TransformStep{{Syntax: "starlark", Script: script}}}
+	}
+	err := runError(applyNoHistoryTransform(t, "", loadScript(`load("dataset:team/a", "a")`), "module_run", "apply", withLoader(loader)))
+	if err == nil || !strings.Contains(err.Error(), startf.ErrModuleCycle.Error()) {
+		t.Errorf("expected cycle error, got: %v", err)
+	}
+
+	err = runError(applyNoHistoryTransform(t, "", loadScript(`load("dataset:team/missing", "a")`), "module_run", "apply", withLoader(loader)))
+	if err == nil || !strings.Contains(err.Error(), dsref.ErrNoHistory.Error()) {
+		t.Errorf("expected missing module error, got: %v", err)
+	}
+
+	// dataset modules must be named with the dataset prefix
+	err = runError(applyNoHistoryTransform(t, "", loadScript(`load("team/a", "a")`), "module_run", "apply", withLoader(loader)))
+	if err == nil || strings.Contains(err.Error(), startf.ErrModuleCycle.Error()) {
+		t.Errorf("expected unprefixed module to not load as a dataset, got: %v", err)
+	}
+}
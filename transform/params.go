@@ -0,0 +1,197 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ParamsConfigKey is the transform config key that declares run parameters.
+// Parameters are declared by name with a type & optional default:
+//
+//	params:
+//	  date:
+//	    type: date
+//	    default: "2021-01-01"
+//
+// Resolved parameter values are readable in starlark with config.get
+const ParamsConfigKey = "params"
+
+// DateParamLayout is the format of date parameter values
+const DateParamLayout = "2006-01-02"
+
+// MaxRangeSize is the largest number of values a parameter range can list,
+// capping the number of runs a single backfill enqueues
+const MaxRangeSize = 1000
+
+// ParamType enumerates the types a run parameter can have
+type ParamType string
+
+const (
+	// ParamString is a string parameter
+	ParamString = ParamType("string")
+	// ParamInt is an integer parameter
+	ParamInt = ParamType("int")
+	// ParamFloat is a floating point parameter
+	ParamFloat = ParamType("float")
+	// ParamBool is a boolean parameter
+	ParamBool = ParamType("bool")
+	// ParamDate is a calendar date parameter, formatted as DateParamLayout.
+	// Dates are strings in starlark
+	ParamDate = ParamType("date")
+)
+
+// ParamSpec declares a run parameter
+type ParamSpec struct {
+	Name    string
+	Type    ParamType
+	Default interface{}
+}
+
+// ParamSpecs reads the run parameters declared in transform config, sorted
+// by name
+func ParamSpecs(config map[string]interface{}) ([]ParamSpec, error) {
+	raw, ok := config[ParamsConfigKey]
+	if !ok {
+		return nil, nil
+	}
+	decls, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("transform config %q must be a map of parameter names to declarations", ParamsConfigKey)
+	}
+
+	specs := make([]ParamSpec, 0, len(decls))
+	for name, d := range decls {
+		decl, ok := d.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("param %q: declaration must be a map", name)
+		}
+		spec := ParamSpec{Name: name, Type: ParamString, Default: decl["default"]}
+		if t, ok := decl["type"]; ok {
+			s, ok := t.(string)
+			if !ok {
+				return nil, fmt.Errorf("param %q: type must be a string", name)
+			}
+			spec.Type = ParamType(s)
+		}
+		switch spec.Type {
+		case ParamString, ParamInt, ParamFloat, ParamBool, ParamDate:
+		default:
+			return nil, fmt.Errorf("param %q: unknown type %q", name, spec.Type)
+		}
+		if spec.Default != nil {
+			v, err := spec.Parse(fmt.Sprintf("%v", spec.Default))
+			if err != nil {
+				return nil, fmt.Errorf("param %q: invalid default: %w", name, err)
+			}
+			spec.Default = v
+		}
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs, nil
+}
+
+// Parse converts a string to a value of the parameter type
+func (s ParamSpec) Parse(str string) (interface{}, error) {
+	switch s.Type {
+	case ParamInt:
+		return strconv.ParseInt(str, 10, 64)
+	case ParamFloat:
+		return strconv.ParseFloat(str, 64)
+	case ParamBool:
+		return strconv.ParseBool(str)
+	case ParamDate:
+		if _, err := time.Parse(DateParamLayout, str); err != nil {
+			return nil, fmt.Errorf("dates must be formatted as YYYY-MM-DD, got %q", str)
+		}
+		return str, nil
+	}
+	return str, nil
+}
+
+// Range lists the values of the parameter from start to stop, inclusive.
+// Only date & int parameters have ranges. Dates increment by one day. It's an
+// error for a range to have more than MaxRangeSize values
+func (s ParamSpec) Range(start, stop string) ([]string, error) {
+	switch s.Type {
+	case ParamDate:
+		from, err := time.Parse(DateParamLayout, start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start date %q", start)
+		}
+		to, err := time.Parse(DateParamLayout, stop)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stop date %q", stop)
+		}
+		if to.Before(from) {
+			return nil, fmt.Errorf("range stop %s is before start %s", stop, start)
+		}
+		if days := to.Sub(from).Hours() / 24; days >= MaxRangeSize {
+			return nil, fmt.Errorf("range from %s to %s has more than %d values", start, stop, MaxRangeSize)
+		}
+		var vals []string
+		for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+			vals = append(vals, d.Format(DateParamLayout))
+		}
+		return vals, nil
+	case ParamInt:
+		from, err := strconv.ParseInt(start, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start %q", start)
+		}
+		to, err := strconv.ParseInt(stop, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stop %q", stop)
+		}
+		if to < from {
+			return nil, fmt.Errorf("range stop %d is before start %d", to, from)
+		}
+		// compare unsigned, the difference of distant values overflows int64
+		if uint64(to-from) >= MaxRangeSize {
+			return nil, fmt.Errorf("range from %d to %d has more than %d values", from, to, MaxRangeSize)
+		}
+		var vals []string
+		for i := from; i <= to; i++ {
+			vals = append(vals, strconv.FormatInt(i, 10))
+		}
+		return vals, nil
+	}
+	return nil, fmt.Errorf("param %q: can't make a range of %s values", s.Name, s.Type)
+}
+
+// ResolveParams combines the defaults of parameters declared in config with
+// values set for a single run. It's an error to set an undeclared parameter,
+// or to leave a parameter without a default unset
+func ResolveParams(config map[string]interface{}, set map[string]string) (map[string]interface{}, error) {
+	specs, err := ParamSpecs(config)
+	if err != nil {
+		return nil, err
+	}
+
+	declared := map[string]bool{}
+	resolved := map[string]interface{}{}
+	for _, spec := range specs {
+		declared[spec.Name] = true
+		str, ok := set[spec.Name]
+		if !ok {
+			if spec.Default == nil {
+				return nil, fmt.Errorf("param %q is required", spec.Name)
+			}
+			resolved[spec.Name] = spec.Default
+			continue
+		}
+		v, err := spec.Parse(str)
+		if err != nil {
+			return nil, fmt.Errorf("param %q: %w", spec.Name, err)
+		}
+		resolved[spec.Name] = v
+	}
+	for name := range set {
+		if !declared[name] {
+			return nil, fmt.Errorf("param %q is not declared in transform config", name)
+		}
+	}
+	return resolved, nil
+}
@@ -0,0 +1,156 @@
+package transform
+
+import (
+	"context"
+	"io/ioutil"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qri/event"
+)
+
+func TestResolveParams(t *testing.T) {
+	config := map[string]interface{}{
+		"params": map[string]interface{}{
+			"date":  map[string]interface{}{"type": "date", "default": "2021-01-01"},
+			"limit": map[string]interface{}{"type": "int", "default": 10},
+			"ratio": map[string]interface{}{"type": "float", "default": 0.5},
+			"dry":   map[string]interface{}{"type": "bool", "default": false},
+			"city":  map[string]interface{}{},
+		},
+	}
+
+	got, err := ResolveParams(config, map[string]string{"city": "Berlin", "limit": "20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]interface{}{
+		"date":  "2021-01-01",
+		"limit": int64(20),
+		"ratio": 0.5,
+		"dry":   false,
+		"city":  "Berlin",
+	}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("resolved params mismatch (-want +got):\n%s", diff)
+	}
+
+	bad := []struct {
+		description string
+		config      map[string]interface{}
+		set         map[string]string
+		err         string
+	}{
+		{"missing required param", config, nil, `param "city" is required`},
+		{"undeclared param", config, map[string]string{"city": "a", "nope": "1"}, `param "nope" is not declared in transform config`},
+		{"invalid int", config, map[string]string{"city": "a", "limit": "ten"}, `param "limit": strconv.ParseInt: parsing "ten": invalid syntax`},
+		{"invalid date", config, map[string]string{"city": "a", "date": "03/01/2021"}, `param "date": dates must be formatted as YYYY-MM-DD, got "03/01/2021"`},
+		{"unknown type", map[string]interface{}{"params": map[string]interface{}{"x": map[string]interface{}{"type": "duration"}}}, nil, `param "x": unknown type "duration"`},
+		{"invalid default", map[string]interface{}{"params": map[string]interface{}{"x": map[string]interface{}{"type": "int", "default": "a"}}}, nil, `param "x": invalid default: strconv.ParseInt: parsing "a": invalid syntax`},
+		{"params not a map", map[string]interface{}{"params": "date"}, nil, `transform config "params" must be a map of parameter names to declarations`},
+	}
+	for _, c := range bad {
+		t.Run(c.description, func(t *testing.T) {
+			_, err := ResolveParams(c.config, c.set)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if c.err != err.Error() {
+				t.Errorf("error mismatch.\nwant: %s\ngot:  %s", c.err, err)
+			}
+		})
+	}
+}
+
+func TestParamRange(t *testing.T) {
+	date := ParamSpec{Name: "date", Type: ParamDate}
+	got, err := date.Range("2021-02-27", "2021-03-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"2021-02-27", "2021-02-28", "2021-03-01", "2021-03-02"}, got); diff != "" {
+		t.Errorf("date range mismatch (-want +got):\n%s", diff)
+	}
+
+	page := ParamSpec{Name: "page", Type: ParamInt}
+	got, err = page.Range("-1", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"-1", "0", "1"}, got); diff != "" {
+		t.Errorf("int range mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := date.Range("2021-03-02", "2021-03-01"); err == nil {
+		t.Error("expected error for a range that ends before it starts")
+	}
+	if _, err := (ParamSpec{Name: "city", Type: ParamString}).Range("a", "b"); err == nil {
+		t.Error("expected error for a range of string values")
+	}
+	if _, err := page.Range("1", strconv.Itoa(MaxRangeSize+1)); err == nil {
+		t.Error("expected error for an int range larger than MaxRangeSize")
+	}
+	if _, err := page.Range("-9223372036854775808", "9223372036854775807"); err == nil {
+		t.Error("expected error for an int range spanning every int")
+	}
+	if _, err := date.Range("1900-01-01", "2021-01-01"); err == nil {
+		t.Error("expected error for a date range larger than MaxRangeSize")
+	}
+	got, err = page.Range("1", strconv.Itoa(MaxRangeSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != MaxRangeSize {
+		t.Errorf("expected %d values, got %d", MaxRangeSize, len(got))
+	}
+}
+
+func TestApplyParams(t *testing.T) {
+	ctx := context.Background()
+	script := `ds = dataset.latest()
+ds.body = [[config.get("date"), config.get("limit"), config.get("other")]]
+dataset.commit(ds)`
+
+	apply := func(set map[string]string) (string, error) {
+		transformer := NewTransformer(ctx, qfs.NewMemFS(), &noHistoryLoader{}, event.NilBus, SizeInfo{})
+		transformer.SetParams(set)
+		ds := &dataset.Dataset{Transform: &dataset.Transform{
+			Config: map[string]interface{}{
+				"other": 1,
+				"params": map[string]interface{}{
+					"date":  map[string]interface{}{"type": "date", "default": "2021-01-01"},
+					"limit": map[string]interface{}{"type": "int", "default": 5},
+				},
+			},
+		}}
+		ds.Transform.SetScriptFile(qfs.NewMemfileBytes("tf.star", []byte(script)))
+		if err := transformer.Apply(ctx, ds, "params_run", true, nil); err != nil {
+			return "", err
+		}
+		body, err := ioutil.ReadAll(ds.BodyFile())
+		return string(body), err
+	}
+
+	body, err := apply(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("2021-01-01,5,1\n", body); diff != "" {
+		t.Errorf("default params body mismatch (-want +got):\n%s", diff)
+	}
+
+	body, err = apply(map[string]string{"date": "2021-03-01", "limit": "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("2021-03-01,7,1\n", body); diff != "" {
+		t.Errorf("set params body mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := apply(map[string]string{"limit": "lots"}); err == nil {
+		t.Error("expected error applying with an invalid param")
+	}
+}
@@ -0,0 +1,659 @@
+package startf
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/preview"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qri/event"
+	stards "github.com/qri-io/qri/transform/startf/ds"
+	"github.com/qri-io/starlib/dataframe"
+	starhttp "github.com/qri-io/starlib/http"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// ErrUncacheable is returned when the effects of a step can't be recorded
+var ErrUncacheable = fmt.Errorf("step is not cacheable")
+
+// ErrNotRecorded is returned by http requests made while replaying recorded
+// responses, when no response was recorded
+var ErrNotRecorded = fmt.Errorf("network use is disabled & no response was recorded")
+
+const (
+	// inputsRecorderKey is the thread local key for recording step inputs
+	inputsRecorderKey = "qri.inputsRecorder"
+	// httpReplayKey is the thread local key for replaying http responses
+	httpReplayKey = "qri.httpReplay"
+)
+
+// DatasetInput is a dataset version a transform step loaded
+type DatasetInput struct {
+	// Ref is the reference string passed to load_dataset
+	Ref string `json:"ref"`
+	// Path is the version the reference resolved to
+	Path string `json:"path"`
+}
+
+// HTTPInput is an http response a transform step read
+type HTTPInput struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Hash is the hex-encoded sha256 sum of the response body
+	Hash         string `json:"hash"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// StepInputs are the external inputs a step read while running
+type StepInputs struct {
+	Datasets []DatasetInput `json:"datasets,omitempty"`
+	Requests []HTTPInput    `json:"requests,omitempty"`
+}
+
+// TrackInputs records the datasets & http responses each step reads
+func TrackInputs() func(o *ExecOpts) {
+	return func(o *ExecOpts) {
+		o.TrackInputs = true
+	}
+}
+
+// HTTPReplayer provides recorded http response bodies
+type HTTPReplayer interface {
+	// RecordedResponse returns the body of a recorded response to a request,
+	// or an error if no response was recorded
+	RecordedResponse(ctx context.Context, method, url string) ([]byte, error)
+}
+
+// ReplayHTTP disables network access, answering http requests with recorded
+// responses instead
+func ReplayHTTP(rp HTTPReplayer) func(o *ExecOpts) {
+	return func(o *ExecOpts) {
+		o.HTTPReplay = rp
+	}
+}
+
+// inputsRecorder collects inputs while a step runs. http requests are
+// recorded from other goroutines
+type inputsRecorder struct {
+	lk     sync.Mutex
+	inputs StepInputs
+	// response bodies, keyed by hash
+	bodies map[string][]byte
+}
+
+func (rec *inputsRecorder) addDataset(in DatasetInput) {
+	rec.lk.Lock()
+	defer rec.lk.Unlock()
+	rec.inputs.Datasets = append(rec.inputs.Datasets, in)
+}
+
+func (rec *inputsRecorder) addRequest(in HTTPInput, body []byte) {
+	rec.lk.Lock()
+	defer rec.lk.Unlock()
+	rec.inputs.Requests = append(rec.inputs.Requests, in)
+	if rec.bodies == nil {
+		rec.bodies = map[string][]byte{}
+	}
+	rec.bodies[in.Hash] = body
+}
+
+type (
+	inputsRecorderCtxKey struct{}
+	httpReplayCtxKey     struct{}
+)
+
+// recordingTransport hashes the bodies of responses to requests made by a
+// step that tracks inputs, and answers requests made by steps that replay
+// recorded responses
+type recordingTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rp, ok := req.Context().Value(httpReplayCtxKey{}).(HTTPReplayer); ok {
+		return replayResponse(req, rp)
+	}
+	res, err := t.base.RoundTrip(req)
+	rec, ok := req.Context().Value(inputsRecorderCtxKey{}).(*inputsRecorder)
+	if err != nil || !ok {
+		return res, err
+	}
+	// redirects are followed by the client, only the final response is input
+	if res.StatusCode >= 300 && res.StatusCode < 400 {
+		return res, nil
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(data))
+	rec.addRequest(HTTPInput{
+		Method:       req.Method,
+		URL:          req.URL.String(),
+		Hash:         HashBytes(data),
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}, data)
+	return res, nil
+}
+
+// httpModuleLk serializes loading http modules with a client other than the
+// starlib default
+var httpModuleLk sync.Mutex
+
+// loadRecordingHTTPModule loads the starlib http module, sending requests
+// through a recording transport. starlib binds the package-level client when
+// the module loads, so the client is swapped only for the duration of the
+// load
+func loadRecordingHTTPModule() (starlark.StringDict, error) {
+	cli := &http.Client{Transport: &recordingTransport{base: http.DefaultTransport}}
+
+	httpModuleLk.Lock()
+	defer httpModuleLk.Unlock()
+	prev := starhttp.Client
+	starhttp.Client = cli
+	defer func() { starhttp.Client = prev }()
+	return starhttp.LoadModule()
+}
+
+// recordsHTTP reports if http requests made on a thread need to pass through
+// a recording transport
+func (r *StepRunner) recordsHTTP(thread *starlark.Thread) bool {
+	_, replay := thread.Local(httpReplayKey).(HTTPReplayer)
+	return r.trackInputs || replay
+}
+
+// replayResponse answers a request with a recorded response, without making
+// a network request
+func replayResponse(req *http.Request, rp HTTPReplayer) (*http.Response, error) {
+	data, err := rp.RecordedResponse(req.Context(), req.Method, req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
+
+// HashBytes returns the hex-encoded sha256 sum of a byte slice
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// StepInputs returns the inputs read by the most recently run step. Inputs
+// are only recorded when the runner is created with the TrackInputs option
+func (r *StepRunner) StepInputs() StepInputs {
+	if r.inputs == nil {
+		return StepInputs{}
+	}
+	r.inputs.lk.Lock()
+	defer r.inputs.lk.Unlock()
+	return r.inputs.inputs
+}
+
+// StepResponse returns the body of an http response read by the most
+// recently run step, by hash. Bodies are only recorded when the runner is
+// created with the TrackInputs option
+func (r *StepRunner) StepResponse(hash string) ([]byte, bool) {
+	if r.inputs == nil {
+		return nil, false
+	}
+	r.inputs.lk.Lock()
+	defer r.inputs.lk.Unlock()
+	data, ok := r.inputs.bodies[hash]
+	return data, ok
+}
+
+// beginStep records state needed to snapshot the step that's about to run
+func (r *StepRunner) beginStep(script string) {
+	r.stepScript = script
+	r.stepCommitted = r.commitCalled
+	r.stepStateChanges = r.state.changes
+	r.stepGlobals = make(starlark.StringDict, len(r.globals))
+	for name, v := range r.globals {
+		r.stepGlobals[name] = v
+	}
+	if r.trackInputs {
+		r.inputs = &inputsRecorder{}
+		r.thread.SetLocal(inputsRecorderKey, r.inputs)
+	}
+}
+
+// StepSnapshot records the effects of running a step, so they can be
+// restored without running the step again
+type StepSnapshot struct {
+	// Globals are the values of global variables after the step ran.
+	// Variables bound by load statements aren't included
+	Globals map[string]*EncodedValue `json:"globals"`
+	// Dataset is the state of the bound dataset, set if the step called
+	// dataset.commit
+	Dataset *dataset.Dataset `json:"dataset,omitempty"`
+	// Body is the body the step committed
+	Body []byte `json:"body,omitempty"`
+	// Changes are the components the step committed
+	Changes []string `json:"changes,omitempty"`
+	// Resources are the transform resources of datasets the step loaded
+	Resources map[string]*dataset.TransformResource `json:"resources,omitempty"`
+	// Modules are the versions of dataset modules the step loaded
+	Modules map[string]string `json:"modules,omitempty"`
+}
+
+// Snapshot records the effects of the most recently run step. Snapshot
+// returns ErrUncacheable if the step has effects that can't be recorded,
+// like http requests that aren't GETs, writes to transform state, or global
+// values that can't be serialized
+func (r *StepRunner) Snapshot(target *dataset.Dataset) (*StepSnapshot, error) {
+	if r.state.changes != r.stepStateChanges {
+		return nil, fmt.Errorf("%w: step modifies transform state", ErrUncacheable)
+	}
+	inputs := r.StepInputs()
+	for _, req := range inputs.Requests {
+		if req.Method != http.MethodGet {
+			return nil, fmt.Errorf("%w: step makes %s requests", ErrUncacheable, req.Method)
+		}
+	}
+
+	loaded, err := loadStmtNames(r.stepScript)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &StepSnapshot{Globals: map[string]*EncodedValue{}}
+	for name, v := range r.globals {
+		if _, ok := loaded[name]; ok || isRunnerGlobal(name) {
+			continue
+		}
+		enc, err := r.encodeValue(v)
+		if err == nil {
+			// snapshots are written to disk, secret values must never be
+			if r.holdsSecret(enc) {
+				return nil, fmt.Errorf("%w: global %q holds a secret value", ErrUncacheable, name)
+			}
+			snap.Globals[name] = enc
+			continue
+		}
+		// values that can't be serialized can be left in place if they were
+		// set by a previous step & can't be modified
+		if prev, ok := r.stepGlobals[name]; ok && isImmutable(v) && prev == v {
+			continue
+		}
+		return nil, fmt.Errorf("%w: global %q: %s", ErrUncacheable, name, err)
+	}
+
+	pins := ModulePins(target.Transform)
+	for _, in := range inputs.Datasets {
+		if pinned, ok := pins[in.Ref]; ok {
+			if snap.Modules == nil {
+				snap.Modules = map[string]string{}
+			}
+			snap.Modules[in.Ref] = pinned
+		}
+		if target.Transform == nil || target.Transform.Resources[in.Path] == nil {
+			continue
+		}
+		if snap.Resources == nil {
+			snap.Resources = map[string]*dataset.TransformResource{}
+		}
+		snap.Resources[in.Path] = target.Transform.Resources[in.Path]
+	}
+
+	if r.commitCalled && !r.stepCommitted {
+		if err := r.snapshotCommit(target, snap); err != nil {
+			return nil, err
+		}
+	}
+	return snap, nil
+}
+
+func (r *StepRunner) snapshotCommit(target *dataset.Dataset, snap *StepSnapshot) error {
+	ds := &dataset.Dataset{}
+	ds.Assign(target)
+	ds.Transform = nil
+	ds.Body = nil
+	ds.BodyBytes = nil
+	if target.Commit != nil {
+		// run-specific commit details are set by the run restoring a snapshot
+		cm := *target.Commit
+		cm.RunID = ""
+		cm.Timestamp = time.Time{}
+		ds.Commit = &cm
+	}
+	snap.Dataset = ds
+
+	for comp := range r.changeSet {
+		snap.Changes = append(snap.Changes, comp)
+	}
+	sort.Strings(snap.Changes)
+
+	if _, changed := r.changeSet["body"]; changed && target.BodyFile() != nil {
+		f := target.BodyFile()
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		target.SetBodyFile(qfs.NewMemfileBytes(f.FullPath(), data))
+		snap.Body = data
+	}
+	return nil
+}
+
+// Restore applies the effects of a step from a snapshot, instead of running
+// the step
+func (r *StepRunner) Restore(ctx context.Context, target *dataset.Dataset, st *dataset.TransformStep, snap *StepSnapshot) error {
+	script, ok := st.Script.(string)
+	if !ok {
+		return fmt.Errorf("starlark step Script must be a string. got %T", st.Script)
+	}
+	r.beginStep(script)
+	r.thread.Load = r.moduleLoader(ctx, target)
+
+	// load statements are cheap to run & bind values that can't be serialized
+	if err := r.restoreLoads(script); err != nil {
+		return err
+	}
+
+	for name, enc := range snap.Globals {
+		v, err := r.decodeValue(ctx, enc)
+		if err != nil {
+			return fmt.Errorf("restoring global %q: %w", name, err)
+		}
+		r.globals[name] = v
+	}
+
+	if len(snap.Resources) > 0 && target.Transform != nil {
+		if target.Transform.Resources == nil {
+			target.Transform.Resources = map[string]*dataset.TransformResource{}
+		}
+		for path, res := range snap.Resources {
+			target.Transform.Resources[path] = res
+		}
+	}
+
+	if target.Transform != nil {
+		for refstr, pinned := range snap.Modules {
+			pinModule(target.Transform, refstr, pinned)
+		}
+	}
+
+	if snap.Dataset != nil {
+		target.Assign(snap.Dataset)
+		if snap.Body != nil {
+			name := "body"
+			if target.Structure != nil && target.Structure.Format != "" {
+				name = "body." + target.Structure.Format
+			}
+			target.SetBodyFile(qfs.NewMemfileBytes(name, snap.Body))
+		}
+		for _, comp := range snap.Changes {
+			if r.changeSet != nil {
+				r.changeSet[comp] = struct{}{}
+			}
+		}
+		r.stards.SetCommitCalled()
+		r.commitCalled = true
+
+		if r.eventsCh != nil {
+			pview, err := preview.Create(ctx, target)
+			if err != nil {
+				return err
+			}
+			r.eventsCh <- event.Event{Type: event.ETTransformDatasetPreview, Payload: pview}
+		}
+	}
+	return nil
+}
+
+func (r *StepRunner) restoreLoads(script string) error {
+	f, err := syntax.Parse("", script, 0)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range f.Stmts {
+		load, ok := stmt.(*syntax.LoadStmt)
+		if !ok {
+			continue
+		}
+		if r.thread.Load == nil {
+			return fmt.Errorf("load not implemented")
+		}
+		dict, err := r.thread.Load(r.thread, load.ModuleName())
+		if err != nil {
+			return err
+		}
+		for i, from := range load.From {
+			v, ok := dict[from.Name]
+			if !ok {
+				return fmt.Errorf("load: name %s not found in module %s", from.Name, load.ModuleName())
+			}
+			r.globals[load.To[i].Name] = v
+		}
+	}
+	return nil
+}
+
+// loadStmtNames returns the names a script binds with load statements
+func loadStmtNames(script string) (map[string]struct{}, error) {
+	f, err := syntax.Parse("", script, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]struct{}{}
+	for _, stmt := range f.Stmts {
+		if load, ok := stmt.(*syntax.LoadStmt); ok {
+			for _, to := range load.To {
+				names[to.Name] = struct{}{}
+			}
+		}
+	}
+	return names, nil
+}
+
+// holdsSecret reports if an encoded value contains the value of a secret
+func (r *StepRunner) holdsSecret(enc *EncodedValue) bool {
+	if enc.Value != "" {
+		for _, v := range r.secrets {
+			if s, ok := v.(string); ok && s != "" && strings.Contains(enc.Value, s) {
+				return true
+			}
+		}
+	}
+	for _, item := range enc.Items {
+		if r.holdsSecret(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRunnerGlobal reports if a global is set by the step runner
+func isRunnerGlobal(name string) bool {
+	switch name {
+	case "load_dataset", "dataset", "config", "secrets", "state", debugHookName:
+		return true
+	}
+	return false
+}
+
+// isImmutable reports if a value can't be changed by a script
+func isImmutable(v starlark.Value) bool {
+	switch v.(type) {
+	case *starlark.Function, *starlark.Builtin, *starlarkstruct.Struct, *starlarkstruct.Module:
+		return true
+	}
+	return false
+}
+
+// EncodedValue is a serialized starlark value
+type EncodedValue struct {
+	Type  string          `json:"type"`
+	Value string          `json:"value,omitempty"`
+	Items []*EncodedValue `json:"items,omitempty"`
+}
+
+const (
+	encodedBoundDataset  = "boundDataset"
+	encodedLoadedDataset = "loadedDataset"
+)
+
+func (r *StepRunner) encodeValue(v starlark.Value) (*EncodedValue, error) {
+	switch x := v.(type) {
+	case starlark.NoneType:
+		return &EncodedValue{Type: "NoneType"}, nil
+	case starlark.Bool:
+		return &EncodedValue{Type: "bool", Value: x.String()}, nil
+	case starlark.Int:
+		return &EncodedValue{Type: "int", Value: x.String()}, nil
+	case starlark.Float:
+		return &EncodedValue{Type: "float", Value: strconv.FormatFloat(float64(x), 'g', -1, 64)}, nil
+	case starlark.String:
+		return &EncodedValue{Type: "string", Value: string(x)}, nil
+	case starlark.Bytes:
+		return &EncodedValue{Type: "bytes", Value: string(x)}, nil
+	case *starlark.List:
+		return r.encodeItems("list", starlark.Iterate(x))
+	case starlark.Tuple:
+		return r.encodeItems("tuple", starlark.Iterate(x))
+	case *starlark.Dict:
+		// dicts encode as alternating keys & values
+		enc := &EncodedValue{Type: "dict"}
+		for _, item := range x.Items() {
+			for _, el := range item {
+				e, err := r.encodeValue(el)
+				if err != nil {
+					return nil, err
+				}
+				enc.Items = append(enc.Items, e)
+			}
+		}
+		return enc, nil
+	case *stards.Dataset:
+		if x.Dataset() == r.stards.Latest() {
+			if len(x.Changes()) > 0 && !r.commitCalled {
+				return nil, fmt.Errorf("dataset has uncommitted changes")
+			}
+			return &EncodedValue{Type: encodedBoundDataset}, nil
+		}
+		if ref, ok := r.loaded[x]; ok && len(x.Changes()) == 0 {
+			return &EncodedValue{Type: encodedLoadedDataset, Value: ref}, nil
+		}
+		return nil, fmt.Errorf("dataset can't be serialized")
+	}
+	return nil, fmt.Errorf("values of type %s can't be serialized", v.Type())
+}
+
+func (r *StepRunner) encodeItems(typ string, it starlark.Iterator) (*EncodedValue, error) {
+	defer it.Done()
+	enc := &EncodedValue{Type: typ}
+	var el starlark.Value
+	for it.Next(&el) {
+		e, err := r.encodeValue(el)
+		if err != nil {
+			return nil, err
+		}
+		enc.Items = append(enc.Items, e)
+	}
+	return enc, nil
+}
+
+func (r *StepRunner) decodeValue(ctx context.Context, enc *EncodedValue) (starlark.Value, error) {
+	switch enc.Type {
+	case "NoneType":
+		return starlark.None, nil
+	case "bool":
+		return starlark.Bool(enc.Value == "True"), nil
+	case "int":
+		i, ok := new(big.Int).SetString(enc.Value, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid int %q", enc.Value)
+		}
+		return starlark.MakeBigInt(i), nil
+	case "float":
+		f, err := strconv.ParseFloat(enc.Value, 64)
+		if err != nil {
+			return nil, err
+		}
+		return starlark.Float(f), nil
+	case "string":
+		return starlark.String(enc.Value), nil
+	case "bytes":
+		return starlark.Bytes(enc.Value), nil
+	case "list", "tuple":
+		items := make([]starlark.Value, len(enc.Items))
+		for i, e := range enc.Items {
+			v, err := r.decodeValue(ctx, e)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		if enc.Type == "tuple" {
+			return starlark.Tuple(items), nil
+		}
+		return starlark.NewList(items), nil
+	case "dict":
+		if len(enc.Items)%2 != 0 {
+			return nil, fmt.Errorf("invalid dict encoding")
+		}
+		d := starlark.NewDict(len(enc.Items) / 2)
+		for i := 0; i < len(enc.Items); i += 2 {
+			k, err := r.decodeValue(ctx, enc.Items[i])
+			if err != nil {
+				return nil, err
+			}
+			v, err := r.decodeValue(ctx, enc.Items[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if err := d.SetKey(k, v); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	case encodedBoundDataset:
+		return stards.NewDataset(r.stards.Latest(), r.outputConfig()), nil
+	case encodedLoadedDataset:
+		if r.dsLoader == nil {
+			return nil, fmt.Errorf("load_datset function is not enabled")
+		}
+		ds, err := r.dsLoader.LoadDataset(ctx, enc.Value)
+		if err != nil {
+			return nil, err
+		}
+		v := stards.NewDataset(ds, r.outputConfig())
+		r.loaded[v] = enc.Value
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown value type %q", enc.Type)
+}
+
+func (r *StepRunner) outputConfig() *dataframe.OutputConfig {
+	outconf, _ := r.thread.Local("OutputConfig").(*dataframe.OutputConfig)
+	return outconf
+}
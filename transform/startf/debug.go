@@ -0,0 +1,392 @@
+package startf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/event"
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// debugHookName is the builtin a debugger calls before each statement
+const debugHookName = "__debug__"
+
+// maxDebugValueLen caps the length of variable values in debug state
+const maxDebugValueLen = 1000
+
+var (
+	// ErrDebugStopped is returned when a debug command stops a transform
+	ErrDebugStopped = fmt.Errorf("transform stopped by debugger")
+	// ErrNotPaused is returned when sending a command to a debugger that
+	// isn't paused
+	ErrNotPaused = fmt.Errorf("debugger is not paused")
+)
+
+// Debugger pauses transform execution at line breakpoints & errors. A paused
+// debugger emits an ETTransformDebugPaused event on the step runner events
+// channel, and waits for a command to resume. A Debugger with no breakpoints
+// pauses before the first statement
+type Debugger struct {
+	// BreakOnError pauses execution when a step fails, showing the state
+	// before the failing statement
+	BreakOnError bool
+
+	lk          sync.Mutex
+	breakpoints map[int]struct{}
+	action      string
+	pauseDepth  int
+	paused      bool
+	cmds        chan event.TransformDebugCommand
+	runID       string
+}
+
+// NewDebugger creates a debugger. breakpoints are script line numbers
+func NewDebugger(runID string, breakpoints []int, breakOnError bool) *Debugger {
+	d := &Debugger{
+		BreakOnError: breakOnError,
+		action:       event.TransformDebugContinue,
+		cmds:         make(chan event.TransformDebugCommand, 1),
+		runID:        runID,
+	}
+	d.setBreakpoints(breakpoints)
+	if len(breakpoints) == 0 {
+		d.action = event.TransformDebugStep
+	}
+	return d
+}
+
+// SetDebugger runs transform steps with a debugger
+func SetDebugger(d *Debugger) func(o *ExecOpts) {
+	return func(o *ExecOpts) {
+		o.Debugger = d
+	}
+}
+
+// Send delivers a command to a paused debugger
+func (d *Debugger) Send(cmd event.TransformDebugCommand) error {
+	switch cmd.Action {
+	case event.TransformDebugStep, event.TransformDebugNext, event.TransformDebugContinue, event.TransformDebugStop:
+	default:
+		return fmt.Errorf("unknown debug action %q", cmd.Action)
+	}
+
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if !d.paused {
+		return ErrNotPaused
+	}
+	select {
+	case d.cmds <- cmd:
+		return nil
+	default:
+		return fmt.Errorf("debugger already has a pending command")
+	}
+}
+
+func (d *Debugger) setBreakpoints(lines []int) {
+	d.breakpoints = make(map[int]struct{}, len(lines))
+	for _, l := range lines {
+		d.breakpoints[l] = struct{}{}
+	}
+}
+
+// shouldPause decides if execution pauses before a line, returning the
+// reason for pausing
+func (d *Debugger) shouldPause(line, depth int) (reason string, pause bool) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if _, ok := d.breakpoints[line]; ok {
+		return "breakpoint", true
+	}
+	switch d.action {
+	case event.TransformDebugStep:
+		return "step", true
+	case event.TransformDebugNext:
+		return "step", depth <= d.pauseDepth
+	}
+	return "", false
+}
+
+// pause emits state & blocks until a command arrives
+func (d *Debugger) pause(ctx context.Context, eventsCh chan event.Event, state *event.TransformDebugState, depth int) error {
+	d.lk.Lock()
+	d.paused = true
+	d.lk.Unlock()
+	defer func() {
+		d.lk.Lock()
+		d.paused = false
+		d.lk.Unlock()
+	}()
+
+	state.RunID = d.runID
+	if eventsCh != nil {
+		eventsCh <- event.Event{Type: event.ETTransformDebugPaused, Payload: *state}
+	}
+
+	select {
+	case cmd := <-d.cmds:
+		d.lk.Lock()
+		defer d.lk.Unlock()
+		if cmd.Breakpoints != nil {
+			d.setBreakpoints(cmd.Breakpoints)
+		}
+		if cmd.Action == event.TransformDebugStop {
+			return ErrDebugStopped
+		}
+		d.action = cmd.Action
+		d.pauseDepth = depth
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// debugFrame is a snapshot of execution, taken before each statement
+type debugFrame struct {
+	step     int
+	line     int
+	function string
+	locals   map[string]starlark.Value
+	globals  starlark.StringDict
+}
+
+// compileDebug compiles a parsed step script, inserting a call to the debug hook
+// before each statement. It returns a compiled program & the names of local
+// variables for each function, keyed by function position
+func compileDebug(f *syntax.File, isPredeclared func(string) bool) (*starlark.Program, map[string][]string, error) {
+	f.Stmts = instrumentStmts(f.Stmts)
+
+	prog, err := starlark.FileProgram(f, func(name string) bool {
+		return name == debugHookName || isPredeclared(name)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	localNames := map[string][]string{}
+	if mod, ok := f.Module.(*resolve.Module); ok {
+		localNames[toplevelFuncKey] = bindingNames(mod.Locals)
+	}
+	syntax.Walk(f, func(n syntax.Node) bool {
+		var fn interface{}
+		switch x := n.(type) {
+		case *syntax.DefStmt:
+			fn = x.Function
+		case *syntax.LambdaExpr:
+			fn = x.Function
+		}
+		if rf, ok := fn.(*resolve.Function); ok {
+			localNames[funcKey(rf.Pos)] = bindingNames(rf.Locals)
+		}
+		return true
+	})
+
+	return prog, localNames, nil
+}
+
+// toplevelFuncKey identifies the top level of a script in local name maps
+const toplevelFuncKey = "<toplevel>"
+
+func funcKey(pos syntax.Position) string {
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Col)
+}
+
+func bindingNames(bindings []*resolve.Binding) []string {
+	names := make([]string, len(bindings))
+	for i, b := range bindings {
+		if b.First != nil {
+			names[i] = b.First.Name
+		}
+	}
+	return names
+}
+
+// instrumentStmts prefixes each statement with a call to the debug hook,
+// recursing into statement bodies
+func instrumentStmts(stmts []syntax.Stmt) []syntax.Stmt {
+	res := make([]syntax.Stmt, 0, len(stmts)*2)
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *syntax.DefStmt:
+			s.Body = instrumentStmts(s.Body)
+		case *syntax.ForStmt:
+			s.Body = instrumentStmts(s.Body)
+		case *syntax.WhileStmt:
+			s.Body = instrumentStmts(s.Body)
+		case *syntax.IfStmt:
+			s.True = instrumentStmts(s.True)
+			s.False = instrumentStmts(s.False)
+		case *syntax.LoadStmt:
+			// load statements bind names when the module is initialized, there's
+			// nothing to pause for
+			res = append(res, stmt)
+			continue
+		}
+		start, _ := stmt.Span()
+		res = append(res, debugHookCall(start), stmt)
+	}
+	return res
+}
+
+func debugHookCall(pos syntax.Position) syntax.Stmt {
+	return &syntax.ExprStmt{X: &syntax.CallExpr{
+		Fn:     &syntax.Ident{NamePos: pos, Name: debugHookName},
+		Lparen: pos,
+		Args: []syntax.Expr{&syntax.Literal{
+			Token:    syntax.INT,
+			TokenPos: pos,
+			Raw:      strconv.Itoa(int(pos.Line)),
+			Value:    int64(pos.Line),
+		}},
+		Rparen: pos,
+	}}
+}
+
+// runDebugStep executes a step with debugging hooks
+func (r *StepRunner) runDebugStep(ctx context.Context, st *dataset.TransformStep, script string) error {
+	r.lastFrame = nil
+	f, err := syntax.Parse(fmt.Sprintf("%s.star", st.Name), script, 0)
+	if err != nil {
+		return err
+	}
+	r.printFinalStatement(f)
+
+	prog, localNames, err := compileDebug(f, r.globals.Has)
+	if err != nil {
+		return err
+	}
+
+	r.globals[debugHookName] = r.debugHook(ctx, localNames)
+	defer delete(r.globals, debugHookName)
+
+	globals, err := prog.Init(r.thread, r.globals)
+	if err != nil {
+		if errors.Is(err, ErrDebugStopped) {
+			return ErrDebugStopped
+		}
+		if r.debugger.BreakOnError && ctx.Err() == nil {
+			r.pauseOnError(ctx, err)
+		}
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			return fmt.Errorf(evalErr.Backtrace())
+		}
+		return err
+	}
+	for key, val := range globals {
+		r.globals[key] = val
+	}
+	return nil
+}
+
+// debugHook returns the builtin called before each statement of a step
+func (r *StepRunner) debugHook(ctx context.Context, localNames map[string][]string) *starlark.Builtin {
+	return starlark.NewBuiltin(debugHookName, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var line int
+		if err := starlark.UnpackPositionalArgs(debugHookName, args, kwargs, 1, &line); err != nil {
+			return nil, err
+		}
+		// depth of the calling frame, excluding this builtin
+		depth := thread.CallStackDepth() - 1
+		r.lastFrame = r.captureFrame(thread.DebugFrame(1), r.lineOffset+line, localNames)
+
+		reason, pause := r.debugger.shouldPause(r.lastFrame.line, depth)
+		if !pause {
+			return starlark.None, nil
+		}
+		state := r.debugState(r.lastFrame, reason)
+		if err := r.debugger.pause(ctx, r.eventsCh, state, depth); err != nil {
+			return nil, err
+		}
+		return starlark.None, nil
+	})
+}
+
+// captureFrame records the variables in scope of a frame
+func (r *StepRunner) captureFrame(fr starlark.DebugFrame, line int, localNames map[string][]string) *debugFrame {
+	df := &debugFrame{
+		step:    r.stepIndex,
+		line:    line,
+		locals:  map[string]starlark.Value{},
+		globals: starlark.StringDict{},
+	}
+	fn, ok := fr.Callable().(*starlark.Function)
+	if !ok {
+		return df
+	}
+	df.function = fn.Name()
+
+	key := toplevelFuncKey
+	if fn.Name() != toplevelFuncKey {
+		key = funcKey(fn.Position())
+	}
+	for i, name := range localNames[key] {
+		if v := fr.Local(i); v != nil && name != "" && v.Type() != "cell" {
+			df.locals[name] = v
+		}
+	}
+
+	// globals from previous steps, without builtins
+	for name, v := range r.globals {
+		if _, isBuiltin := v.(*starlark.Builtin); !isBuiltin && name != "dataset" && name != "config" && name != "secrets" && name != "state" {
+			df.globals[name] = v
+		}
+	}
+	for name, v := range fn.Globals() {
+		df.globals[name] = v
+	}
+	return df
+}
+
+// debugState converts a frame snapshot to a debug event payload
+func (r *StepRunner) debugState(fr *debugFrame, reason string) *event.TransformDebugState {
+	state := &event.TransformDebugState{
+		Reason:   reason,
+		Step:     fr.step,
+		Line:     fr.line,
+		Function: fr.function,
+		Locals:   debugValueStrings(fr.locals),
+		Globals:  debugValueStrings(fr.globals),
+	}
+	if r.stards != nil {
+		if latest := r.stards.Latest(); latest != nil {
+			ds := &dataset.Dataset{}
+			ds.Assign(latest)
+			// the transform component is the script being debugged
+			ds.Transform = nil
+			state.Dataset = ds
+		}
+		state.Committed = r.stards.CommitCalled() || r.commitCalled
+	}
+	return state
+}
+
+// pauseOnError pauses at the last statement a failing step executed
+func (r *StepRunner) pauseOnError(ctx context.Context, runErr error) {
+	if r.lastFrame == nil {
+		return
+	}
+	state := r.debugState(r.lastFrame, "error")
+	state.Error = runErr.Error()
+	// any command resumes, letting the error stop the transform
+	if err := r.debugger.pause(ctx, r.eventsCh, state, 0); err != nil {
+		log.Debugw("debugger paused on error", "err", err)
+	}
+}
+
+func debugValueStrings(vals map[string]starlark.Value) map[string]string {
+	strs := make(map[string]string, len(vals))
+	for name, v := range vals {
+		s := v.String()
+		if len(s) > maxDebugValueLen {
+			s = s[:maxDebugValueLen] + "..."
+		}
+		strs[name] = s
+	}
+	return strs
+}
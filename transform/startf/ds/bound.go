@@ -56,6 +56,16 @@ func (b *BoundDataset) AttrNames() []string {
 	return builtinAttrNames(boundDatasetMethods)
 }
 
+// Latest returns the dataset the transform is bound to
+func (b *BoundDataset) Latest() *dataset.Dataset { return b.latest }
+
+// CommitCalled returns true if the script has called dataset.commit
+func (b *BoundDataset) CommitCalled() bool { return b.commitCalled }
+
+// SetCommitCalled marks the dataset as committed, for restoring the results
+// of a transform without running the script
+func (b *BoundDataset) SetCommitCalled() { b.commitCalled = true }
+
 func (b *BoundDataset) stringify() string { return "<BoundDataset>" }
 
 // methods defined on the history object
@@ -0,0 +1,183 @@
+package startf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/stepfile"
+	"github.com/qri-io/qri/dsref"
+	starhttp "github.com/qri-io/starlib/http"
+	"go.starlark.net/starlark"
+)
+
+// ErrModuleCycle is returned when dataset modules load each other
+var ErrModuleCycle = fmt.Errorf("cycle in dataset module loads")
+
+// DatasetModulePrefix marks a load statement module name as a dataset
+// reference, eg: load("dataset:username/dataset_name", "fn")
+const DatasetModulePrefix = "dataset:"
+
+// modulePinPrefix namespaces module pins in transform syntaxes
+const modulePinPrefix = "module:"
+
+// IsDatasetModule reports if a load statement module name refers to a
+// dataset
+func IsDatasetModule(module string) bool {
+	return strings.HasPrefix(module, DatasetModulePrefix)
+}
+
+// ModulePins lists the dataset modules a transform loaded, mapping module
+// references to the version each resolved to. Pins are kept apart from
+// transform resources, which list the datasets a transform reads
+func ModulePins(tf *dataset.Transform) map[string]string {
+	pins := map[string]string{}
+	if tf == nil {
+		return pins
+	}
+	for key, pinned := range tf.Syntaxes {
+		if strings.HasPrefix(key, modulePinPrefix) {
+			pins[strings.TrimPrefix(key, modulePinPrefix)] = pinned
+		}
+	}
+	return pins
+}
+
+// pinModule records the version a module reference resolved to
+func pinModule(tf *dataset.Transform, refstr, pinned string) {
+	if tf.Syntaxes == nil {
+		tf.Syntaxes = map[string]string{}
+	}
+	tf.Syntaxes[modulePinPrefix+refstr] = pinned
+}
+
+// datasetModule is a dataset module loaded by a step runner
+type datasetModule struct {
+	globals starlark.StringDict
+	// loading is true while the module is initializing, used to detect cycles
+	loading bool
+}
+
+// moduleLoader returns the thread load function for a step. Dataset modules
+// are loaded with the step runner's dataset loader, all other modules are
+// passed to the configured module loader
+func (r *StepRunner) moduleLoader(ctx context.Context, target *dataset.Dataset) func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	return func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+		if module == starhttp.ModuleName && r.recordsHTTP(thread) {
+			return loadRecordingHTTPModule()
+		}
+		if !IsDatasetModule(module) {
+			if r.baseLoader == nil {
+				return nil, fmt.Errorf("load not implemented")
+			}
+			return r.baseLoader(thread, module)
+		}
+		return r.loadDatasetModule(ctx, thread, target, strings.TrimPrefix(module, DatasetModulePrefix))
+	}
+}
+
+// loadDatasetModule resolves a dataset reference & executes the dataset's
+// transform script as a module, returning the globals it defines. A module
+// reference without a version path resolves to the latest version. The
+// resolved version is pinned in the target transform, recording the module
+// version in the commit
+func (r *StepRunner) loadDatasetModule(ctx context.Context, thread *starlark.Thread, target *dataset.Dataset, refstr string) (starlark.StringDict, error) {
+	if r.dsLoader == nil {
+		return nil, fmt.Errorf("loading dataset modules is not enabled")
+	}
+	ref, err := dsref.Parse(refstr)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid module reference: %w", refstr, err)
+	}
+
+	ds, err := r.dsLoader.LoadDataset(ctx, refstr)
+	if err != nil {
+		return nil, fmt.Errorf("loading module %q: %w", refstr, err)
+	}
+	if ref.Path != "" && ds.Path != ref.Path {
+		return nil, fmt.Errorf("loading module %q: resolved to version %q", refstr, ds.Path)
+	}
+
+	if mod, ok := r.modules[ds.Path]; ok {
+		if mod.loading {
+			return nil, fmt.Errorf("%w: %q", ErrModuleCycle, refstr)
+		}
+		return mod.globals, nil
+	}
+
+	script, err := moduleScript(ds)
+	if err != nil {
+		return nil, fmt.Errorf("loading module %q: %w", refstr, err)
+	}
+
+	pinned := dsref.Ref{InitID: ds.ID, Username: ds.Peername, Name: ds.Name, Path: ds.Path}
+	pinModule(target.Transform, refstr, pinned.String())
+	if r.inputs != nil {
+		r.inputs.addDataset(DatasetInput{Ref: refstr, Path: ds.Path})
+	}
+
+	mod := &datasetModule{loading: true}
+	r.modules[ds.Path] = mod
+	defer func() {
+		if mod.loading {
+			delete(r.modules, ds.Path)
+		}
+	}()
+
+	// modules run in their own thread, with access to builtins & other
+	// modules, but not the dataset being transformed
+	modThread := &starlark.Thread{
+		Name:  pinned.String(),
+		Load:  thread.Load,
+		Print: thread.Print,
+	}
+	modThread.SetLocal("OutputConfig", thread.Local("OutputConfig"))
+	// modules make network requests under the same rules as the transform
+	modThread.SetLocal(offlineKey, thread.Local(offlineKey))
+	modThread.SetLocal(httpReplayKey, thread.Local(httpReplayKey))
+	modThread.SetLocal(inputsRecorderKey, thread.Local(inputsRecorderKey))
+
+	globals, err := starlark.ExecFile(modThread, fmt.Sprintf("%s.star", pinned.Human()), script, nil)
+	if err != nil {
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			return nil, fmt.Errorf("module %q: %s", refstr, evalErr.Backtrace())
+		}
+		return nil, fmt.Errorf("module %q: %w", refstr, err)
+	}
+	globals.Freeze()
+
+	mod.globals = globals
+	mod.loading = false
+	return globals, nil
+}
+
+// moduleScript reads the transform script of a module dataset. Step
+// separators are replaced with blank lines, keeping line numbers in errors
+// aligned with the script
+func moduleScript(ds *dataset.Dataset) (string, error) {
+	if ds.Transform == nil {
+		return "", fmt.Errorf("dataset has no transform component")
+	}
+
+	var data []byte
+	if f := ds.Transform.ScriptFile(); f != nil {
+		defer f.Close()
+		var err error
+		if data, err = ioutil.ReadAll(f); err != nil {
+			return "", err
+		}
+	} else if len(ds.Transform.Steps) > 0 {
+		buf := &bytes.Buffer{}
+		if err := stepfile.Write(ds.Transform.Steps, buf); err != nil {
+			return "", err
+		}
+		data = buf.Bytes()
+	} else {
+		return "", fmt.Errorf("dataset transform has no script")
+	}
+
+	return strings.Replace(string(data), "\n---\n", "\n\n", -1), nil
+}
@@ -1,6 +1,7 @@
 package startf
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
@@ -14,18 +15,38 @@ var (
 	httpGuard = &HTTPGuard{NetworkEnabled: true}
 	// ErrNtwkDisabled is returned whenever a network call is attempted but h.NetworkEnabled is false
 	ErrNtwkDisabled = fmt.Errorf("network use is disabled. http can only be used during download step")
+	// ErrOffline is returned when a transform running offline makes a network
+	// call
+	ErrOffline = fmt.Errorf("network access is disabled while running offline")
 )
 
+// offlineKey is the thread local key marking a thread as offline
+const offlineKey = "qri.offline"
+
 // HTTPGuard protects network requests, only allowing when network is enabled
 type HTTPGuard struct {
 	NetworkEnabled bool
 }
 
 // Allowed implements starlib/http RequestGuard
-func (h *HTTPGuard) Allowed(_ *starlark.Thread, req *http.Request) (*http.Request, error) {
+func (h *HTTPGuard) Allowed(thread *starlark.Thread, req *http.Request) (*http.Request, error) {
 	if !h.NetworkEnabled {
 		return nil, ErrNtwkDisabled
 	}
+	if thread != nil {
+		if offline, _ := thread.Local(offlineKey).(bool); offline {
+			return nil, ErrOffline
+		}
+	}
+	// pass the step input recorder & response replayer to the http transport
+	if thread != nil {
+		if rec, ok := thread.Local(inputsRecorderKey).(*inputsRecorder); ok {
+			req = req.WithContext(context.WithValue(req.Context(), inputsRecorderCtxKey{}, rec))
+		}
+		if rp, ok := thread.Local(httpReplayKey).(HTTPReplayer); ok {
+			req = req.WithContext(context.WithValue(req.Context(), httpReplayCtxKey{}, rp))
+		}
+	}
 	return req, nil
 }
 
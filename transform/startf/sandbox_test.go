@@ -1,6 +1,7 @@
 package startf
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/qri-io/starlib/testdata"
@@ -53,3 +54,18 @@ assert.eq(secrets.get("c"), "string")
 		t.Fatal(err)
 	}
 }
+
+func TestHTTPGuardOffline(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thread := &starlark.Thread{}
+	if _, err := httpGuard.Allowed(thread, req); err != nil {
+		t.Errorf("expected online thread to be allowed, got: %s", err)
+	}
+	thread.SetLocal(offlineKey, true)
+	if _, err := httpGuard.Allowed(thread, req); err != ErrOffline {
+		t.Errorf("expected ErrOffline, got: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package startf
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/qri-io/qri/transform/tfstate"
+	"github.com/qri-io/starlib/util"
+	"go.starlark.net/starlark"
+)
+
+// SetState provides the state a transform persisted in a previous run. Steps
+// read & write state with the "state" global
+func SetState(st tfstate.State) func(o *ExecOpts) {
+	return func(o *ExecOpts) {
+		o.State = st
+	}
+}
+
+// transformState is the starlark "state" global, a set of JSON-serializable
+// values that persist between transform runs
+type transformState struct {
+	values tfstate.State
+	// changes counts writes, used to detect steps that modify state
+	changes int
+}
+
+var (
+	_ starlark.Value    = (*transformState)(nil)
+	_ starlark.HasAttrs = (*transformState)(nil)
+)
+
+func newTransformState(st tfstate.State) *transformState {
+	values, err := st.Copy()
+	if err != nil || values == nil {
+		values = tfstate.State{}
+	}
+	return &transformState{values: values}
+}
+
+func (s *transformState) Type() string          { return "state" }
+func (s *transformState) String() string        { return mapStringRepr(s.values) }
+func (s *transformState) Freeze()               {} // noop
+func (s *transformState) Truth() starlark.Bool  { return starlark.True }
+func (s *transformState) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable: %s", s.Type()) }
+
+func (s *transformState) AttrNames() []string { return []string{"delete", "get", "keys", "set"} }
+func (s *transformState) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "get":
+		return starlark.NewBuiltin("get", s.get), nil
+	case "set":
+		return starlark.NewBuiltin("set", s.set), nil
+	case "delete":
+		return starlark.NewBuiltin("delete", s.delete), nil
+	case "keys":
+		return starlark.NewBuiltin("keys", s.keys), nil
+	}
+	return nil, nil
+}
+
+func (s *transformState) get(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		key string
+		def starlark.Value = starlark.None
+	)
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &key, &def); err != nil {
+		return starlark.None, err
+	}
+	v, ok := s.values[key]
+	if !ok {
+		return def, nil
+	}
+	return util.Marshal(fromJSONNumbers(v))
+}
+
+// fromJSONNumbers converts json.Number values to ints & floats
+func fromJSONNumbers(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		f, _ := x.Float64()
+		return f
+	case []interface{}:
+		res := make([]interface{}, len(x))
+		for i, item := range x {
+			res[i] = fromJSONNumbers(item)
+		}
+		return res
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(x))
+		for k, item := range x {
+			res[k] = fromJSONNumbers(item)
+		}
+		return res
+	}
+	return v
+}
+
+func (s *transformState) set(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		key string
+		val starlark.Value
+	)
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &key, &val); err != nil {
+		return starlark.None, err
+	}
+	v, err := util.Unmarshal(val)
+	if err != nil {
+		return starlark.None, fmt.Errorf("state.set: %w", err)
+	}
+
+	prev, existed := s.values[key]
+	s.values[key] = v
+	if err := s.values.Validate(); err != nil {
+		if existed {
+			s.values[key] = prev
+		} else {
+			delete(s.values, key)
+		}
+		return starlark.None, fmt.Errorf("state.set %q: %w", key, err)
+	}
+	s.changes++
+	return starlark.None, nil
+}
+
+func (s *transformState) delete(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &key); err != nil {
+		return starlark.None, err
+	}
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.changes++
+	}
+	return starlark.None, nil
+}
+
+func (s *transformState) keys(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return starlark.None, err
+	}
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	vals := make([]starlark.Value, len(keys))
+	for i, k := range keys {
+		vals[i] = starlark.String(k)
+	}
+	return starlark.NewList(vals), nil
+}
+
+// State returns a copy of transform state, including changes made by steps
+func (r *StepRunner) State() tfstate.State {
+	st, err := r.state.values.Copy()
+	if err != nil {
+		log.Debugw("copying transform state", "err", err)
+	}
+	return st
+}
+
+// StateChanged reports if any step has modified transform state
+func (r *StepRunner) StateChanged() bool {
+	return r.state.changes > 0
+}
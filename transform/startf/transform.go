@@ -16,6 +16,7 @@ import (
 	"github.com/qri-io/qri/event"
 	"github.com/qri-io/qri/repo"
 	stards "github.com/qri-io/qri/transform/startf/ds"
+	"github.com/qri-io/qri/transform/tfstate"
 	"github.com/qri-io/qri/version"
 	"github.com/qri-io/starlib"
 	"github.com/qri-io/starlib/dataframe"
@@ -64,6 +65,18 @@ type ExecOpts struct {
 	// the size of the output area, for stringifying large objects
 	OutputWidth  int
 	OutputHeight int
+	// debugger to pause execution with, nil runs without debugging
+	Debugger *Debugger
+	// record the datasets & http responses each step reads
+	TrackInputs bool
+	// answer http requests with recorded responses, disabling network access
+	HTTPReplay HTTPReplayer
+	// refuse all network requests
+	Offline bool
+	// state persisted by a previous run of the transform
+	State tfstate.State
+	// resolved run parameters, readable with config.get
+	Params map[string]interface{}
 }
 
 // AddDatasetLoader is required to enable the load_dataset starlark builtin
@@ -125,6 +138,21 @@ func TrackChanges(changes map[string]struct{}) func(o *ExecOpts) {
 	}
 }
 
+// SetParams provides resolved run parameter values. Parameters are read with
+// config.get, taking precedence over transform config values of the same name
+func SetParams(params map[string]interface{}) func(o *ExecOpts) {
+	return func(o *ExecOpts) {
+		o.Params = params
+	}
+}
+
+// DisableNetwork refuses every network request the transform makes
+func DisableNetwork() func(o *ExecOpts) {
+	return func(o *ExecOpts) {
+		o.Offline = true
+	}
+}
+
 // SizeInfo sets the size of the area that will display output
 func SizeInfo(outWidth, outHeight int) func(o *ExecOpts) {
 	return func(o *ExecOpts) {
@@ -156,6 +184,23 @@ type StepRunner struct {
 	thread       *starlark.Thread
 	changeSet    map[string]struct{}
 	commitCalled bool
+	baseLoader   ModuleLoader
+	modules      map[string]*datasetModule
+	state        *transformState
+
+	debugger   *Debugger
+	stepIndex  int
+	lineOffset int
+	lastFrame  *debugFrame
+
+	trackInputs   bool
+	inputs        *inputsRecorder
+	loaded        map[*stards.Dataset]string
+	stepScript    string
+	stepCommitted bool
+	// number of state changes when the current step began
+	stepStateChanges int
+	stepGlobals      starlark.StringDict
 }
 
 // NewStepRunner returns a new StepRunner for the given dataset
@@ -195,12 +240,19 @@ func NewStepRunner(target *dataset.Dataset, opts ...func(o *ExecOpts)) *StepRunn
 		},
 	}
 
+	if o.HTTPReplay != nil {
+		thread.SetLocal(httpReplayKey, o.HTTPReplay)
+	}
+	if o.Offline {
+		thread.SetLocal(offlineKey, true)
+	}
+
 	// Store the OutputConfig on the starlark thread. This allows functions
 	// such as the DataFrame constructor to get this configuration
 	outconf := dataframe.SetOutputSize(thread, o.OutputWidth, o.OutputHeight)
 
 	r := &StepRunner{
-		config:    target.Transform.Config,
+		config:    configWithParams(target.Transform.Config, o.Params),
 		secrets:   o.Secrets,
 		fs:        o.Filesystem,
 		dsLoader:  o.DatasetLoader,
@@ -209,23 +261,50 @@ func NewStepRunner(target *dataset.Dataset, opts ...func(o *ExecOpts)) *StepRunn
 		thread:    thread,
 		globals:   starlark.StringDict{},
 		changeSet: o.ChangeSet,
+		debugger:  o.Debugger,
+
+		baseLoader: o.ModuleLoader,
+		modules:    map[string]*datasetModule{},
+		state:      newTransformState(o.State),
+
+		trackInputs: o.TrackInputs,
+		loaded:      map[*stards.Dataset]string{},
 	}
 	r.stards = stards.NewBoundDataset(target, outconf, r.onCommit)
 
 	return r
 }
 
+// configWithParams overlays run parameters on transform config, leaving
+// config unmodified
+func configWithParams(cfg, params map[string]interface{}) map[string]interface{} {
+	if len(params) == 0 {
+		return cfg
+	}
+	merged := make(map[string]interface{}, len(cfg)+len(params))
+	for k, v := range cfg {
+		merged[k] = v
+	}
+	for k, v := range params {
+		merged[k] = v
+	}
+	return merged
+}
+
 // RunStep runs the single transform step using the dataset
 func (r *StepRunner) RunStep(ctx context.Context, ds *dataset.Dataset, st *dataset.TransformStep) (err error) {
 	r.globals["load_dataset"] = starlark.NewBuiltin("load_dataset", r.loadDatasetFunc(ctx, ds))
 	r.globals["dataset"] = r.stards
 	r.globals["config"] = config(r.config)
 	r.globals["secrets"] = secrets(r.secrets)
+	r.globals["state"] = r.state
+	r.thread.Load = r.moduleLoader(ctx, ds)
 
 	script, ok := st.Script.(string)
 	if !ok {
 		return fmt.Errorf("starlark step Script must be a string. got %T", st.Script)
 	}
+	r.beginStep(script)
 
 	// Recover from errors.
 	defer func() {
@@ -237,6 +316,15 @@ func (r *StepRunner) RunStep(ctx context.Context, ds *dataset.Dataset, st *datas
 		}
 	}()
 
+	if r.debugger != nil {
+		defer func() {
+			// steps are separated by a "---" line in transform scripts
+			r.lineOffset += strings.Count(script, "\n") + 2
+			r.stepIndex++
+		}()
+		return r.runDebugStep(ctx, st, script)
+	}
+
 	// Parse, resolve, and compile a Starlark source file.
 	file, mod, err := starlark.SourceProgram(fmt.Sprintf("%s.star", st.Name), strings.NewReader(script), r.globals.Has)
 	if err != nil {
@@ -327,8 +415,14 @@ func (r *StepRunner) loadDatasetFunc(ctx context.Context, target *dataset.Datase
 			Path: fmt.Sprintf("%s/%s@%s", ds.Peername, ds.Name, ds.Path),
 		}
 
+		if r.inputs != nil {
+			r.inputs.addDataset(DatasetInput{Ref: refstr.GoString(), Path: ds.Path})
+		}
+
 		outconf, _ := thread.Local("OutputConfig").(*dataframe.OutputConfig)
-		return stards.NewDataset(ds, outconf), nil
+		v := stards.NewDataset(ds, outconf)
+		r.loaded[v] = refstr.GoString()
+		return v, nil
 	}
 }
 
@@ -2,6 +2,7 @@ package startf
 
 import (
 	"context"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -262,6 +263,27 @@ func testRepo(t *testing.T) repo.Repo {
 	}
 	return mr
 }
+func TestSnapshotSecrets(t *testing.T) {
+	ctx := context.Background()
+	ds := &dataset.Dataset{Transform: &dataset.Transform{}}
+	runner := NewStepRunner(ds, SetSecrets(map[string]string{"token": "hunter2"}), TrackInputs())
+
+	step := &dataset.TransformStep{Syntax: "starlark", Script: "x = 1\ny = ['Bearer ' + secrets.get('token')]"}
+	if err := runner.RunStep(ctx, ds, step); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Snapshot(ds); !errors.Is(err, ErrUncacheable) {
+		t.Errorf("expected a step holding a secret to be uncacheable, got: %v", err)
+	}
+
+	step = &dataset.TransformStep{Syntax: "starlark", Script: "y = None"}
+	if err := runner.RunStep(ctx, ds, step); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Snapshot(ds); err != nil {
+		t.Errorf("expected step without secrets to be cacheable, got: %v", err)
+	}
+}
 
 func testModuleLoader(t *testing.T) func(thread *starlark.Thread, module string) (dict starlark.StringDict, err error) {
 	assertLoader := testdata.NewLoader(nil, "")
@@ -0,0 +1,97 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/transform/stepcache"
+	"github.com/qri-io/qri/transform/tfstate"
+)
+
+// withState runs a transform with state from a previous run, setting tfr to
+// the transformer so state changes can be read after the run
+func withState(st tfstate.State, tfr **Transformer) func(*Transformer, event.Bus) {
+	return func(t *Transformer, _ event.Bus) {
+		t.SetState(st)
+		*tfr = t
+	}
+}
+
+// stateTransform reads the transform that pages through state
+func stateTransform(t *testing.T) *dataset.Transform {
+	tf := &dataset.Transform{}
+	tf.SetScriptFile(scriptFile(t, "testdata/state.star"))
+	return tf
+}
+
+func TestApplyState(t *testing.T) {
+	var transformer *Transformer
+	if err := runError(applyNoHistoryTransform(t, "", stateTransform(t), "state_run", "apply", withState(nil, &transformer))); err != nil {
+		t.Fatal(err)
+	}
+	st, changed := transformer.State()
+	if !changed {
+		t.Errorf("expected state to change")
+	}
+	expect := tfstate.State{"page": json.Number("1"), "seen": []interface{}{"p1"}}
+	if diff := cmp.Diff(expect, st); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+
+	// the next run reads state from the previous run
+	if err := runError(applyNoHistoryTransform(t, "", stateTransform(t), "state_run", "apply", withState(st, &transformer))); err != nil {
+		t.Fatal(err)
+	}
+	st, _ = transformer.State()
+	expect = tfstate.State{"page": json.Number("2"), "seen": []interface{}{"p1", "p2"}}
+	if diff := cmp.Diff(expect, st); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+
+	// failed runs leave state unchanged
+	prev := st
+	fail := &dataset.Transform{Steps: []*dataset.TransformStep{
+		{Syntax: "starlark", Script: "state.set(\"page\", 100)\nstate.delete(\"seen\")\nerror(\"oh no\")"},
+	}}
+	if runError(applyNoHistoryTransform(t, "", fail, "state_run", "apply", withState(st, &transformer))) == nil {
+		t.Fatal("expected error")
+	}
+	st, _ = transformer.State()
+	if diff := cmp.Diff(prev, st); diff != "" {
+		t.Errorf("failed run changed state (-want +got):\n%s", diff)
+	}
+
+	// state must be JSON-serializable
+	unserializable := &dataset.Transform{Steps: []*dataset.TransformStep{
+		{Syntax: "starlark", Script: `state.set("fn", len)`},
+	}}
+	if runError(applyNoHistoryTransform(t, "", unserializable, "state_run", "apply", withState(st, &transformer))) == nil {
+		t.Errorf("expected error setting unserializable state")
+	}
+}
+
+func TestApplyStateStepCache(t *testing.T) {
+	store := stepcache.NewMemStore()
+	var (
+		st          tfstate.State
+		transformer *Transformer
+	)
+	for i := 0; i < 2; i++ {
+		log := applyNoHistoryTransform(t, "", stateTransform(t), "state_run", "apply", withState(st, &transformer), withStepCache(store, false))
+		if err := runError(log); err != nil {
+			t.Fatal(err)
+		}
+		st, _ = transformer.State()
+
+		// state changes between runs, so steps never restore stale results
+		if diff := cmp.Diff([]bool{false, false}, cachedSteps(t, log)); diff != "" {
+			t.Errorf("run %d cached steps mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+	if st["page"] != json.Number("2") {
+		t.Errorf("expected page 2, got: %v", st["page"])
+	}
+}
@@ -1,6 +1,8 @@
 package staticlark
 
 import (
+	"fmt"
+
 	golog "github.com/ipfs/go-log"
 	"go.starlark.net/starlark"
 	"go.starlark.net/syntax"
@@ -10,8 +12,26 @@ var log = golog.Logger("staticlark")
 
 // AnalyzeFile performs static analysis and returns diagnostic results
 func AnalyzeFile(filename string) ([]Diagnostic, error) {
+	return AnalyzeScript(filename, nil, "")
+}
+
+// AnalyzeScript performs static analysis of a script and returns diagnostic
+// results. src is the script source, and is read from filename if nil.
+// category is the transform step category the script runs in, like
+// "download". An empty category analyzes the script as a whole transform file
+func AnalyzeScript(filename string, src interface{}, category string) ([]Diagnostic, error) {
+	return analyzeScript(filename, src, category, false)
+}
+
+// AnalyzeScriptStrict is AnalyzeScript, returning an error when sensitive
+// dataflow can't be traced instead of skipping dataflow analysis
+func AnalyzeScriptStrict(filename string, src interface{}, category string) ([]Diagnostic, error) {
+	return analyzeScript(filename, src, category, true)
+}
+
+func analyzeScript(filename string, src interface{}, category string, strict bool) ([]Diagnostic, error) {
 	// Parse the script to abstract syntax
-	f, err := syntax.Parse(filename, nil, 0)
+	f, err := syntax.Parse(filename, src, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -26,25 +46,67 @@ func AnalyzeFile(filename string) ([]Diagnostic, error) {
 	callGraph := buildCallGraph(funcs, topLevel, globals)
 
 	// Trace sensitive data using dataflow analysis
+	// dataflow analysis doesn't support all syntax yet, so failing to trace is
+	// only fatal to other analysis in strict mode
 	dataflowDiags, err := analyzeSensitiveDataflow(callGraph, nil)
 	if err != nil {
-		return nil, err
+		if strict {
+			return nil, fmt.Errorf("tracing sensitive dataflow: %w", err)
+		}
+		log.Debugw("tracing sensitive dataflow", "err", err)
+		dataflowDiags = nil
 	}
 
 	// Return any unused functions
 	// TODO(dustmop): As more analysis steps are introduced, refactor this
 	// into a generic interface that creates Diagnostics
 	unusedDiags := callGraph.findUnusedFuncs()
-	return append(dataflowDiags, unusedDiags...), nil
+	diags := append(dataflowDiags, unusedDiags...)
+
+	// Report network I/O, leaked secrets, and non-determinism
+	return append(diags, analyzeEffects(f, category)...), nil
 }
 
+// Severity ranks how serious a diagnostic is
+type Severity string
+
+const (
+	// SeverityInfo describes code, without suggesting a problem
+	SeverityInfo = Severity("info")
+	// SeverityWarning is a likely problem that won't stop a transform from
+	// running
+	SeverityWarning = Severity("warning")
+	// SeverityError is a problem that will cause a transform to fail, or do
+	// something it shouldn't
+	SeverityError = Severity("error")
+)
+
 // Diagnostic represents a diagnostic message describing an issue with the code
 type Diagnostic struct {
 	Pos      syntax.Position
 	Category string
+	Severity Severity
 	Message  string
 }
 
+// String formats a diagnostic as a single line
+func (d Diagnostic) String() string {
+	if d.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s: %s: %s", d.Pos, d.Severity, d.Category, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Severity, d.Category, d.Message)
+}
+
+// HasErrors reports if any diagnostic has error severity
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
 func newSymtable(symbols starlark.StringDict) map[string]*funcNode {
 	table := make(map[string]*funcNode)
 	for name := range symbols {
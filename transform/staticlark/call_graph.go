@@ -102,6 +102,7 @@ func (cg *callGraph) findUnusedFuncs() []Diagnostic {
 	for fname := range unusedNames {
 		results = append(results, Diagnostic{
 			Category: "unused",
+			Severity: SeverityWarning,
 			Message:  fname,
 		})
 	}
@@ -80,9 +80,9 @@ func TestUnusedFunctions(t *testing.T) {
 
 	unused := callGraph.findUnusedFuncs()
 	expectUnused := []Diagnostic{
-		{Category: "unused", Message: "func_c"},
-		{Category: "unused", Message: "func_e"},
-		{Category: "unused", Message: "func_f"},
+		{Category: "unused", Severity: SeverityWarning, Message: "func_c"},
+		{Category: "unused", Severity: SeverityWarning, Message: "func_e"},
+		{Category: "unused", Severity: SeverityWarning, Message: "func_f"},
 	}
 	if diff := cmp.Diff(expectUnused, unused, cmpopts.IgnoreFields(Diagnostic{}, "Pos")); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
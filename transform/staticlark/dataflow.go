@@ -2,6 +2,7 @@ package staticlark
 
 import (
 	"fmt"
+	"strings"
 )
 
 // analyze the call graph to detect sensitive data being used incorrectly.
@@ -202,6 +203,11 @@ func (da *dataflowAnalyzer) analyzeBlock(block *codeBlock, env *environment, fn
 
 			fn, ok := da.graph.lookup[inv.Name]
 			if !ok {
+				// methods & module functions without an axiom have no
+				// definition to trace
+				if strings.Contains(inv.Name, ".") {
+					continue
+				}
 				return fmt.Errorf("invoked function %s not found", inv.Name)
 			}
 
@@ -216,6 +222,7 @@ func (da *dataflowAnalyzer) analyzeBlock(block *codeBlock, env *environment, fn
 						d := Diagnostic{
 							Pos:      unit.where,
 							Category: "leak",
+							Severity: SeverityError,
 							Message:  msg,
 						}
 						da.diags = append(da.diags, d)
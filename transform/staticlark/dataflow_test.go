@@ -38,6 +38,7 @@ func TestSingleFunctionDataflow(t *testing.T) {
 		Diagnostic{
 			Pos:      syntax.MakePosition(&filename, 22, 3),
 			Category: "leak",
+			Severity: SeverityError,
 			Message:  "secrets may leak, variable c is secret\nassume it is dangerous",
 		},
 	}
@@ -82,6 +83,7 @@ func TestCallTraceDataflow(t *testing.T) {
 		Diagnostic{
 			Pos:      syntax.MakePosition(&filename, 33, 3),
 			Category: "leak",
+			Severity: SeverityError,
 			Message: `secrets may leak, variable i is secret
 call_trace.star:26: middle passes f to bottom argument m
 call_trace.star:17: bottom passes b to dangerous argument s
@@ -90,6 +92,7 @@ assume it is dangerous`,
 		Diagnostic{
 			Pos:      syntax.MakePosition(&filename, 33, 3),
 			Category: "leak",
+			Severity: SeverityError,
 			Message: `secrets may leak, variable k is secret
 call_trace.star:26: middle passes g to bottom argument n
 call_trace.star:18: bottom passes n to dangerous argument s
@@ -132,6 +135,7 @@ func TestIfStatementDataflow(t *testing.T) {
 		Diagnostic{
 			Pos:      syntax.MakePosition(&filename, 33, 3),
 			Category: "leak",
+			Severity: SeverityError,
 			Message: `secrets may leak, variable z is secret
 control_funcs.star:27: something passes m to dangerous argument s
 assume it is dangerous`,
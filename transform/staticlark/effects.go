@@ -0,0 +1,622 @@
+package staticlark
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.starlark.net/syntax"
+)
+
+const (
+	// downloadCategory is the category of the transform step that is allowed
+	// to make network requests
+	downloadCategory = "download"
+	// secretLabel marks values derived from secrets
+	secretLabel = "$secret"
+	// maxSummaryPasses limits the passes taken to compute function summaries
+	// for recursive scripts
+	maxSummaryPasses = 10
+)
+
+var (
+	// outputAttrs are dataset fields that become dataset output when assigned
+	outputAttrs = map[string]bool{
+		"body":      true,
+		"meta":      true,
+		"structure": true,
+		"readme":    true,
+	}
+	// outputMethods are dataset methods that set dataset output
+	outputMethods = map[string]bool{
+		"set_body":      true,
+		"set_meta":      true,
+		"set_structure": true,
+		"set_readme":    true,
+	}
+	// iterMethods return dict contents in insertion order
+	iterMethods = map[string]bool{
+		"keys":   true,
+		"values": true,
+		"items":  true,
+	}
+)
+
+// effectAnalyzer finds the side effects of a script: network I/O, secrets
+// that reach output, and calls that make output non-deterministic
+type effectAnalyzer struct {
+	category string
+	defs     map[string]*syntax.DefStmt
+	order    []string
+	topLevel []syntax.Stmt
+
+	// local names of loaded modules
+	httpNames   map[string]bool
+	timeNames   map[string]bool
+	randomNames map[string]bool
+
+	summaries map[string]*effectSummary
+	diags     []Diagnostic
+	seen      map[string]bool
+}
+
+// effectSummary describes how a function passes values through
+type effectSummary struct {
+	// labels of values the function returns
+	returns labels
+	// sinks of parameters, by parameter index
+	sinks map[int]string
+}
+
+// labels is a set of the sources a value is derived from. Sources are either
+// the secretLabel, or a function parameter
+type labels map[string]bool
+
+func (l labels) add(other labels) bool {
+	changed := false
+	for k := range other {
+		if !l[k] {
+			l[k] = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+// effectParamName returns the name of a parameter, including parameters with
+// default values & variadic parameters
+func effectParamName(e syntax.Expr) string {
+	switch p := e.(type) {
+	case *syntax.BinaryExpr:
+		return effectParamName(p.X)
+	case *syntax.UnaryExpr:
+		if p.X != nil {
+			return effectParamName(p.X)
+		}
+	}
+	return parameterName(e)
+}
+
+func paramLabel(i int) string {
+	return fmt.Sprintf("$param%d", i)
+}
+
+// analyzeEffects reports the effects of a parsed script. category is the
+// transform step category of the script, an empty category treats the script
+// as a whole transform file
+func analyzeEffects(f *syntax.File, category string) []Diagnostic {
+	ea := &effectAnalyzer{
+		category:    category,
+		defs:        map[string]*syntax.DefStmt{},
+		httpNames:   map[string]bool{},
+		timeNames:   map[string]bool{},
+		randomNames: map[string]bool{},
+		summaries:   map[string]*effectSummary{},
+		seen:        map[string]bool{},
+	}
+	for _, stmt := range f.Stmts {
+		switch s := stmt.(type) {
+		case *syntax.DefStmt:
+			ea.defs[s.Name.Name] = s
+			ea.order = append(ea.order, s.Name.Name)
+		case *syntax.LoadStmt:
+			ea.addLoad(s)
+			ea.topLevel = append(ea.topLevel, s)
+		default:
+			ea.topLevel = append(ea.topLevel, s)
+		}
+	}
+
+	ea.analyzeNetwork()
+	ea.analyzeSecrets()
+	ea.analyzeDeterminism(f)
+
+	sort.SliceStable(ea.diags, func(i, j int) bool {
+		a, b := ea.diags[i].Pos, ea.diags[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+	return ea.diags
+}
+
+func (ea *effectAnalyzer) addLoad(s *syntax.LoadStmt) {
+	module, _ := s.Module.Value.(string)
+	for i, from := range s.From {
+		local := s.To[i].Name
+		switch {
+		case module == "http.star" && from.Name == "http":
+			ea.httpNames[local] = true
+		case module == "time.star" && from.Name == "time":
+			ea.timeNames[local] = true
+		case module == "random.star":
+			ea.randomNames[local] = true
+		}
+	}
+}
+
+func (ea *effectAnalyzer) report(pos syntax.Position, sev Severity, category, msg string) {
+	key := fmt.Sprintf("%s:%s:%s", pos, category, msg)
+	if ea.seen[key] {
+		return
+	}
+	ea.seen[key] = true
+	ea.diags = append(ea.diags, Diagnostic{
+		Pos:      pos,
+		Category: category,
+		Severity: sev,
+		Message:  msg,
+	})
+}
+
+// moduleCall returns the local module name & function name of calls like
+// http.get(), or empty strings for any other call
+func moduleCall(call *syntax.CallExpr) (string, string) {
+	dot, ok := call.Fn.(*syntax.DotExpr)
+	if !ok {
+		return "", ""
+	}
+	id, ok := dot.X.(*syntax.Ident)
+	if !ok {
+		return "", ""
+	}
+	return id.Name, dot.Name.Name
+}
+
+// calledDef returns the name of the function defined in the script that a
+// call invokes, if any
+func (ea *effectAnalyzer) calledDef(call *syntax.CallExpr) string {
+	if id, ok := call.Fn.(*syntax.Ident); ok {
+		if _, ok := ea.defs[id.Name]; ok {
+			return id.Name
+		}
+	}
+	return ""
+}
+
+func (ea *effectAnalyzer) isHTTPCall(call *syntax.CallExpr) bool {
+	mod, _ := moduleCall(call)
+	return ea.httpNames[mod]
+}
+
+// eachCall calls fn for every call expression in a list of statements,
+// without descending into nested function definitions
+func eachCall(stmts []syntax.Stmt, fn func(call *syntax.CallExpr)) {
+	for _, stmt := range stmts {
+		syntax.Walk(stmt, func(n syntax.Node) bool {
+			switch item := n.(type) {
+			case *syntax.DefStmt:
+				return false
+			case *syntax.CallExpr:
+				fn(item)
+			}
+			return true
+		})
+	}
+}
+
+// analyzeNetwork reports functions that perform network I/O, and network I/O
+// that happens outside of the download step
+func (ea *effectAnalyzer) analyzeNetwork() {
+	if len(ea.httpNames) == 0 {
+		return
+	}
+
+	// via maps functions that perform network I/O to the call that does it
+	via := map[string]string{}
+	for changed := true; changed; {
+		changed = false
+		for _, name := range ea.order {
+			if _, ok := via[name]; ok {
+				continue
+			}
+			eachCall(ea.defs[name].Body, func(call *syntax.CallExpr) {
+				if _, ok := via[name]; ok {
+					return
+				}
+				if ea.isHTTPCall(call) {
+					via[name] = simpleExprToFuncName(call.Fn)
+					changed = true
+				} else if callee := ea.calledDef(call); callee != "" && callee != name {
+					if _, ok := via[callee]; ok {
+						via[name] = callee
+						changed = true
+					}
+				}
+			})
+		}
+	}
+
+	for _, name := range ea.order {
+		if v, ok := via[name]; ok {
+			ea.report(ea.defs[name].Def, SeverityInfo, "network", fmt.Sprintf("function %s performs network I/O, calling %s", name, v))
+		}
+	}
+
+	// network I/O is allowed anywhere in a download step. Whole transform
+	// files can only use the network in the download function
+	if ea.category == downloadCategory {
+		return
+	}
+	sev := SeverityError
+	if ea.category == "" {
+		sev = SeverityWarning
+	}
+	step := "a download step"
+	if ea.category != "" {
+		step = fmt.Sprintf("the download step, this is a %s step", ea.category)
+	}
+	checkEntry := func(stmts []syntax.Stmt) {
+		eachCall(stmts, func(call *syntax.CallExpr) {
+			name := simpleExprToFuncName(call.Fn)
+			if ea.isHTTPCall(call) {
+				start, _ := call.Span()
+				ea.report(start, sev, "network", fmt.Sprintf("%s performs network I/O outside of %s", name, step))
+			} else if callee := ea.calledDef(call); callee != "" {
+				if _, ok := via[callee]; ok {
+					start, _ := call.Span()
+					ea.report(start, sev, "network", fmt.Sprintf("%s performs network I/O outside of %s", name, step))
+				}
+			}
+		})
+	}
+	checkEntry(ea.topLevel)
+	if ea.category == "" {
+		// the transform function is an entry point of whole transform files
+		if def, ok := ea.defs["transform"]; ok {
+			checkEntry(def.Body)
+		}
+	}
+}
+
+// scope holds the labels of variables in a function or at the top level
+type scope struct {
+	vars   map[string]labels
+	global *scope
+}
+
+func (s *scope) lookup(name string) labels {
+	if l, ok := s.vars[name]; ok {
+		return l
+	}
+	if s.global != nil {
+		return s.global.lookup(name)
+	}
+	return nil
+}
+
+func (s *scope) assign(name string, l labels) bool {
+	if len(l) == 0 {
+		return false
+	}
+	if s.vars[name] == nil {
+		s.vars[name] = labels{}
+	}
+	return s.vars[name].add(l)
+}
+
+// analyzeSecrets reports secrets that reach print or dataset output
+func (ea *effectAnalyzer) analyzeSecrets() {
+	// the secrets global is itself a secret, aliases & reads of it are too
+	global := &scope{vars: map[string]labels{"secrets": {secretLabel: true}}}
+	for _, name := range ea.order {
+		ea.summaries[name] = &effectSummary{returns: labels{}, sinks: map[int]string{}}
+	}
+
+	// compute function summaries & globals until they stop changing
+	scopes := map[string]*scope{}
+	for pass := 0; pass < maxSummaryPasses; pass++ {
+		changed := ea.bindAll(ea.topLevel, global)
+		for _, name := range ea.order {
+			def := ea.defs[name]
+			s := scopes[name]
+			if s == nil {
+				s = &scope{vars: map[string]labels{}, global: global}
+				for i, p := range def.Params {
+					s.vars[effectParamName(p)] = labels{paramLabel(i): true}
+				}
+				scopes[name] = s
+			}
+			if ea.bindAll(def.Body, s) {
+				changed = true
+			}
+			if ea.summarize(name, def, s) {
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	ea.checkSinks(ea.topLevel, global)
+	for _, name := range ea.order {
+		ea.checkSinks(ea.defs[name].Body, scopes[name])
+	}
+}
+
+// bindAll assigns labels to the variables of a list of statements, reporting
+// if any labels changed
+func (ea *effectAnalyzer) bindAll(stmts []syntax.Stmt, s *scope) bool {
+	changed := false
+	for _, stmt := range stmts {
+		switch item := stmt.(type) {
+		case *syntax.AssignStmt:
+			l := ea.exprLabels(item.RHS, s)
+			if item.Op != syntax.EQ {
+				l.add(ea.exprLabels(item.LHS, s))
+			}
+			if ea.bindTarget(item.LHS, l, s) {
+				changed = true
+			}
+		case *syntax.ForStmt:
+			if ea.bindTarget(item.Vars, ea.exprLabels(item.X, s), s) {
+				changed = true
+			}
+			if ea.bindAll(item.Body, s) {
+				changed = true
+			}
+		case *syntax.WhileStmt:
+			if ea.bindAll(item.Body, s) {
+				changed = true
+			}
+		case *syntax.IfStmt:
+			if ea.bindAll(item.True, s) {
+				changed = true
+			}
+			if ea.bindAll(item.False, s) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// bindTarget assigns labels to the target of an assignment. Assigning to a
+// field or index of a variable taints the variable
+func (ea *effectAnalyzer) bindTarget(target syntax.Expr, l labels, s *scope) bool {
+	switch t := target.(type) {
+	case *syntax.Ident:
+		return s.assign(t.Name, l)
+	case *syntax.ParenExpr:
+		return ea.bindTarget(t.X, l, s)
+	case *syntax.TupleExpr:
+		changed := false
+		for _, x := range t.List {
+			if ea.bindTarget(x, l, s) {
+				changed = true
+			}
+		}
+		return changed
+	case *syntax.ListExpr:
+		changed := false
+		for _, x := range t.List {
+			if ea.bindTarget(x, l, s) {
+				changed = true
+			}
+		}
+		return changed
+	case *syntax.DotExpr:
+		return ea.bindTarget(t.X, l, s)
+	case *syntax.IndexExpr:
+		return ea.bindTarget(t.X, l, s)
+	}
+	return false
+}
+
+// summarize records the labels a function returns & the sinks its parameters
+// reach, reporting if the summary changed
+func (ea *effectAnalyzer) summarize(name string, def *syntax.DefStmt, s *scope) bool {
+	sum := ea.summaries[name]
+	changed := false
+	walkStmts(def.Body, func(stmt syntax.Stmt) {
+		if ret, ok := stmt.(*syntax.ReturnStmt); ok && ret.Result != nil {
+			if sum.returns.add(ea.exprLabels(ret.Result, s)) {
+				changed = true
+			}
+		}
+	})
+	ea.eachSink(def.Body, s, func(_ syntax.Position, sink string, l labels) {
+		for i := range def.Params {
+			if _, ok := sum.sinks[i]; !ok && l[paramLabel(i)] {
+				sum.sinks[i] = sink
+				changed = true
+			}
+		}
+	})
+	return changed
+}
+
+// checkSinks reports secrets that reach sinks in a list of statements
+func (ea *effectAnalyzer) checkSinks(stmts []syntax.Stmt, s *scope) {
+	ea.eachSink(stmts, s, func(pos syntax.Position, sink string, l labels) {
+		if l[secretLabel] {
+			ea.report(pos, SeverityError, "secret", fmt.Sprintf("secret value reaches %s", sink))
+		}
+	})
+}
+
+// eachSink calls fn for each value that reaches a sink: print, dataset output,
+// or a function parameter that reaches a sink
+func (ea *effectAnalyzer) eachSink(stmts []syntax.Stmt, s *scope, fn func(pos syntax.Position, sink string, l labels)) {
+	walkStmts(stmts, func(stmt syntax.Stmt) {
+		if assign, ok := stmt.(*syntax.AssignStmt); ok {
+			if dot, ok := assign.LHS.(*syntax.DotExpr); ok && outputAttrs[dot.Name.Name] {
+				start, _ := assign.Span()
+				fn(start, "dataset output "+simpleExprToFuncName(dot), ea.exprLabels(assign.RHS, s))
+			}
+		}
+	})
+	eachCall(stmts, func(call *syntax.CallExpr) {
+		start, _ := call.Span()
+		name := simpleExprToFuncName(call.Fn)
+		switch {
+		case name == "print":
+			fn(start, "print", ea.argLabels(call.Args, s))
+			return
+		case name == "dataset.commit":
+			fn(start, "dataset output "+name, ea.argLabels(call.Args, s))
+			return
+		}
+		if dot, ok := call.Fn.(*syntax.DotExpr); ok && outputMethods[dot.Name.Name] {
+			fn(start, "dataset output "+name, ea.argLabels(call.Args, s))
+			return
+		}
+		if callee := ea.calledDef(call); callee != "" {
+			sum := ea.summaries[callee]
+			for i, arg := range call.Args {
+				if sink, ok := sum.sinks[i]; ok {
+					fn(start, fmt.Sprintf("%s through %s", sink, callee), ea.exprLabels(arg, s))
+				}
+			}
+		}
+	})
+}
+
+func (ea *effectAnalyzer) argLabels(args []syntax.Expr, s *scope) labels {
+	l := labels{}
+	for _, arg := range args {
+		l.add(ea.exprLabels(arg, s))
+	}
+	return l
+}
+
+// isSecretSource reports if a call reads a secret
+func isSecretSource(call *syntax.CallExpr) bool {
+	name := simpleExprToFuncName(call.Fn)
+	return name == "secrets.get" || strings.HasSuffix(name, ".get_secret")
+}
+
+// exprLabels returns the labels of the sources an expression's value is
+// derived from
+func (ea *effectAnalyzer) exprLabels(expr syntax.Expr, s *scope) labels {
+	l := labels{}
+	if expr == nil {
+		return l
+	}
+	switch e := expr.(type) {
+	case *syntax.Ident:
+		l.add(s.lookup(e.Name))
+	case *syntax.Literal:
+	case *syntax.LambdaExpr:
+	case *syntax.CallExpr:
+		if isSecretSource(e) {
+			l[secretLabel] = true
+			return l
+		}
+		if callee := ea.calledDef(e); callee != "" {
+			sum := ea.summaries[callee]
+			for k := range sum.returns {
+				if k == secretLabel {
+					l[secretLabel] = true
+					continue
+				}
+				for i := range e.Args {
+					if k == paramLabel(i) {
+						l.add(ea.exprLabels(e.Args[i], s))
+					}
+				}
+			}
+			return l
+		}
+		// values returned by builtins & methods are derived from their
+		// receiver & arguments
+		if dot, ok := e.Fn.(*syntax.DotExpr); ok {
+			l.add(ea.exprLabels(dot.X, s))
+		}
+		l.add(ea.argLabels(e.Args, s))
+	case *syntax.BinaryExpr:
+		if e.Op == syntax.EQ {
+			// keyword arguments
+			l.add(ea.exprLabels(e.Y, s))
+		} else {
+			l.add(ea.exprLabels(e.X, s))
+			l.add(ea.exprLabels(e.Y, s))
+		}
+	default:
+		syntax.Walk(expr, func(n syntax.Node) bool {
+			if n == expr {
+				return true
+			}
+			if x, ok := n.(syntax.Expr); ok {
+				l.add(ea.exprLabels(x, s))
+				return false
+			}
+			return true
+		})
+	}
+	return l
+}
+
+// walkStmts calls fn for each statement in a list, including statements in
+// nested control structures, but not nested function definitions
+func walkStmts(stmts []syntax.Stmt, fn func(stmt syntax.Stmt)) {
+	for _, stmt := range stmts {
+		fn(stmt)
+		switch item := stmt.(type) {
+		case *syntax.ForStmt:
+			walkStmts(item.Body, fn)
+		case *syntax.WhileStmt:
+			walkStmts(item.Body, fn)
+		case *syntax.IfStmt:
+			walkStmts(item.True, fn)
+			walkStmts(item.False, fn)
+		}
+	}
+}
+
+// analyzeDeterminism reports calls & iteration that can make the output of a
+// transform differ between runs with the same input
+func (ea *effectAnalyzer) analyzeDeterminism(f *syntax.File) {
+	checkIter := func(x syntax.Expr) {
+		call, ok := x.(*syntax.CallExpr)
+		if !ok {
+			return
+		}
+		dot, ok := call.Fn.(*syntax.DotExpr)
+		if !ok || !iterMethods[dot.Name.Name] || len(call.Args) != 0 {
+			return
+		}
+		start, _ := call.Span()
+		ea.report(start, SeverityWarning, "nondeterministic", fmt.Sprintf("iterating %s() follows dict insertion order, which can differ between runs. use sorted() for reproducible output", simpleExprToFuncName(call.Fn)))
+	}
+
+	syntax.Walk(f, func(n syntax.Node) bool {
+		switch item := n.(type) {
+		case *syntax.ForStmt:
+			checkIter(item.X)
+		case *syntax.ForClause:
+			checkIter(item.X)
+		case *syntax.CallExpr:
+			mod, fn := moduleCall(item)
+			start, _ := item.Span()
+			if ea.timeNames[mod] && fn == "now" {
+				ea.report(start, SeverityWarning, "nondeterministic", fmt.Sprintf("%s.now() depends on when the transform runs", mod))
+			} else if ea.randomNames[mod] {
+				ea.report(start, SeverityWarning, "nondeterministic", fmt.Sprintf("%s.%s() returns random values", mod, fn))
+			}
+		}
+		return true
+	})
+}
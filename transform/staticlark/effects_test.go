@@ -0,0 +1,92 @@
+package staticlark
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"go.starlark.net/syntax"
+)
+
+func TestAnalyzeEffects(t *testing.T) {
+	filename := "testdata/effects.star"
+	f, err := syntax.Parse(filename, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ignoreCmp := cmpopts.IgnoreUnexported(syntax.Position{})
+	diags := analyzeEffects(f, "")
+	expect := []Diagnostic{
+		{Pos: syntax.MakePosition(&filename, 4, 1), Category: "network", Severity: SeverityInfo, Message: "function fetch performs network I/O, calling http.get"},
+		{Pos: syntax.MakePosition(&filename, 7, 1), Category: "network", Severity: SeverityInfo, Message: "function fetch_all performs network I/O, calling fetch"},
+		{Pos: syntax.MakePosition(&filename, 10, 1), Category: "network", Severity: SeverityInfo, Message: "function download performs network I/O, calling fetch_all"},
+		{Pos: syntax.MakePosition(&filename, 19, 1), Category: "network", Severity: SeverityInfo, Message: "function transform performs network I/O, calling fetch"},
+		{Pos: syntax.MakePosition(&filename, 21, 3), Category: "secret", Severity: SeverityError, Message: "secret value reaches print through log_value"},
+		{Pos: syntax.MakePosition(&filename, 23, 11), Category: "network", Severity: SeverityWarning, Message: "fetch performs network I/O outside of a download step"},
+		{Pos: syntax.MakePosition(&filename, 25, 15), Category: "nondeterministic", Severity: SeverityWarning, Message: "iterating ctx.download.items() follows dict insertion order, which can differ between runs. use sorted() for reproducible output"},
+		{Pos: syntax.MakePosition(&filename, 29, 16), Category: "nondeterministic", Severity: SeverityWarning, Message: "time.now() depends on when the transform runs"},
+		{Pos: syntax.MakePosition(&filename, 30, 3), Category: "secret", Severity: SeverityError, Message: "secret value reaches dataset output ds.body"},
+	}
+	if diff := cmp.Diff(expect, diags, ignoreCmp); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnalyzeScriptCategory(t *testing.T) {
+	filename := "testdata/effects_step.star"
+	ignoreCmp := cmpopts.IgnoreUnexported(syntax.Position{})
+
+	diags, err := AnalyzeScript(filename, nil, "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Diagnostic{
+		{Pos: syntax.MakePosition(&filename, 4, 1), Category: "secret", Severity: SeverityError, Message: "secret value reaches print"},
+	}
+	if diff := cmp.Diff(expect, diags, ignoreCmp); diff != "" {
+		t.Errorf("download step mismatch (-want +got):\n%s", diff)
+	}
+
+	diags, err = AnalyzeScript(filename, nil, "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = []Diagnostic{
+		{Pos: syntax.MakePosition(&filename, 3, 8), Category: "network", Severity: SeverityError, Message: "http.get performs network I/O outside of the download step, this is a transform step"},
+		{Pos: syntax.MakePosition(&filename, 4, 1), Category: "secret", Severity: SeverityError, Message: "secret value reaches print"},
+	}
+	if diff := cmp.Diff(expect, diags, ignoreCmp); diff != "" {
+		t.Errorf("transform step mismatch (-want +got):\n%s", diff)
+	}
+	if !HasErrors(diags) {
+		t.Error("expected HasErrors to be true")
+	}
+}
+
+func TestAnalyzeSecretsAlias(t *testing.T) {
+	filename := "testdata/secrets_alias.star"
+	ignoreCmp := cmpopts.IgnoreUnexported(syntax.Position{})
+
+	diags, err := AnalyzeScriptStrict(filename, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Diagnostic{
+		{Pos: syntax.MakePosition(&filename, 2, 1), Category: "secret", Severity: SeverityError, Message: "secret value reaches print"},
+		{Pos: syntax.MakePosition(&filename, 3, 1), Category: "secret", Severity: SeverityError, Message: "secret value reaches print"},
+	}
+	if diff := cmp.Diff(expect, diags, ignoreCmp); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnalyzeScriptStrict(t *testing.T) {
+	// dataflow analysis can't trace for loops yet
+	if _, err := AnalyzeScript("testdata/loop_funcs.star", nil, ""); err != nil {
+		t.Errorf("expected analysis to skip dataflow it can't trace, got: %s", err)
+	}
+	if _, err := AnalyzeScriptStrict("testdata/loop_funcs.star", nil, ""); err == nil {
+		t.Error("expected strict analysis to fail when dataflow can't be traced")
+	}
+}
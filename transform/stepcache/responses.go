@@ -0,0 +1,276 @@
+package stepcache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/qri-io/qri/transform/startf"
+)
+
+// Response is a recorded http response body
+type Response struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Hash is the hex-encoded sha256 sum of Body
+	Hash     string    `json:"hash"`
+	Body     []byte    `json:"-"`
+	Recorded time.Time `json:"recorded"`
+}
+
+// ResponseStore records the bodies of http responses read by transform runs
+// that create dataset versions, so versions can be verified by replaying the
+// run without network access. Responses are keyed by run ID, which versions
+// record as Commit.RunID. Stores returned by NewMemStore & NewFileStore
+// implement ResponseStore
+type ResponseStore interface {
+	// PutResponse records a response read by a run, replacing any response
+	// the run recorded for the same request
+	PutResponse(ctx context.Context, runID string, r *Response) error
+	// GetResponse fetches the response to a request recorded by a run,
+	// returning ErrNotFound if none exists
+	GetResponse(ctx context.Context, runID, method, url string) (*Response, error)
+	// ResponseRuns lists the IDs of runs with recorded responses
+	ResponseRuns(ctx context.Context) ([]string, error)
+	// DeleteResponses removes all responses recorded by a run
+	DeleteResponses(ctx context.Context, runID string) error
+}
+
+// requestKey hashes a request method & url
+func requestKey(method, url string) string {
+	return startf.HashBytes([]byte(method + " " + url))
+}
+
+// CollectResponses deletes responses recorded by runs that aren't in the
+// live set of run IDs, returning the number of runs with responses that are
+// deleted, or would be deleted in a dry run
+func CollectResponses(ctx context.Context, s ResponseStore, live map[string]struct{}, dryRun bool) (int, error) {
+	runIDs, err := s.ResponseRuns(ctx)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, id := range runIDs {
+		if _, ok := live[id]; ok {
+			continue
+		}
+		if !dryRun {
+			if err := s.DeleteResponses(ctx, id); err != nil {
+				return removed, err
+			}
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// compile-time assertion that MemStore is a ResponseStore
+var _ ResponseStore = (*MemStore)(nil)
+
+// PutResponse records a response read by a run
+func (s *MemStore) PutResponse(ctx context.Context, runID string, r *Response) error {
+	if runID == "" {
+		return fmt.Errorf("run ID is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.responses == nil {
+		s.responses = map[string]map[string]*Response{}
+	}
+	if s.responses[runID] == nil {
+		s.responses[runID] = map[string]*Response{}
+	}
+	s.responses[runID][requestKey(r.Method, r.URL)] = r
+	return nil
+}
+
+// GetResponse fetches a response recorded by a run
+func (s *MemStore) GetResponse(ctx context.Context, runID, method, url string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.responses[runID][requestKey(method, url)]; ok {
+		return r, nil
+	}
+	return nil, ErrNotFound
+}
+
+// ResponseRuns lists the IDs of runs with recorded responses
+func (s *MemStore) ResponseRuns(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.responses))
+	for id := range s.responses {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// DeleteResponses removes the responses recorded by a run
+func (s *MemStore) DeleteResponses(ctx context.Context, runID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.responses, runID)
+	return nil
+}
+
+// compile-time assertion that fileStore is a ResponseStore
+var _ ResponseStore = (*fileStore)(nil)
+
+// responseDir holds a directory for each run with recorded responses,
+// containing an index of the run's requests & bodies named by hash.
+// Responses can include private data, so files are only readable by the owner
+func (s *fileStore) responseDir(runID string) (string, error) {
+	if runID == "" || runID != filepath.Base(runID) || runID == "." || runID == ".." {
+		return "", fmt.Errorf("invalid run ID %q", runID)
+	}
+	return filepath.Join(s.dir, "responses", runID), nil
+}
+
+func readResponseIndex(dir string) (map[string]*Response, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	if os.IsNotExist(err) {
+		return map[string]*Response{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	idx := map[string]*Response{}
+	err = json.Unmarshal(data, &idx)
+	return idx, err
+}
+
+// PutResponse records a response read by a run
+func (s *fileStore) PutResponse(ctx context.Context, runID string, r *Response) error {
+	if r.Hash == "" {
+		return fmt.Errorf("response hash is required")
+	}
+	dir, err := s.responseDir(runID)
+	if err != nil {
+		return err
+	}
+	s.responsesLk.Lock()
+	defer s.responsesLk.Unlock()
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, r.Hash), r.Body, 0600); err != nil {
+		return err
+	}
+
+	idx, err := readResponseIndex(dir)
+	if err != nil {
+		return err
+	}
+	idx[requestKey(r.Method, r.URL)] = r
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "index.json")
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// GetResponse fetches a response recorded by a run
+func (s *fileStore) GetResponse(ctx context.Context, runID, method, url string) (*Response, error) {
+	dir, err := s.responseDir(runID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	idx, err := readResponseIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := idx[requestKey(method, url)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if r.Body, err = ioutil.ReadFile(filepath.Join(dir, r.Hash)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// ResponseRuns lists the IDs of runs with recorded responses
+func (s *fileStore) ResponseRuns(ctx context.Context) ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(s.dir, "responses"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, fi := range infos {
+		if fi.IsDir() {
+			ids = append(ids, fi.Name())
+		}
+	}
+	return ids, nil
+}
+
+// DeleteResponses removes the responses recorded by a run
+func (s *fileStore) DeleteResponses(ctx context.Context, runID string) error {
+	dir, err := s.responseDir(runID)
+	if err != nil {
+		return err
+	}
+	s.responsesLk.Lock()
+	defer s.responsesLk.Unlock()
+	return os.RemoveAll(dir)
+}
+
+// Replayer serves responses recorded by a run to transforms running with the
+// network disabled, keeping track of requests that have no recorded response
+type Replayer struct {
+	store ResponseStore
+	runID string
+
+	lk      sync.Mutex
+	missing []string
+}
+
+// compile-time assertion that Replayer is an HTTPReplayer
+var _ startf.HTTPReplayer = (*Replayer)(nil)
+
+// NewReplayer creates a replayer for the responses recorded by a run. store
+// may be nil, in which case every request is missing
+func NewReplayer(store ResponseStore, runID string) *Replayer {
+	return &Replayer{store: store, runID: runID}
+}
+
+// RecordedResponse returns the body of a recorded response
+func (rp *Replayer) RecordedResponse(ctx context.Context, method, url string) ([]byte, error) {
+	if rp.store != nil && rp.runID != "" {
+		r, err := rp.store.GetResponse(ctx, rp.runID, method, url)
+		if err == nil {
+			return r.Body, nil
+		}
+		if err != ErrNotFound {
+			return nil, err
+		}
+	}
+	rp.lk.Lock()
+	rp.missing = append(rp.missing, method+" "+url)
+	rp.lk.Unlock()
+	return nil, fmt.Errorf("%w: %s %s", startf.ErrNotRecorded, method, url)
+}
+
+// Missing lists requests that had no recorded response
+func (rp *Replayer) Missing() []string {
+	rp.lk.Lock()
+	defer rp.lk.Unlock()
+	return append([]string(nil), rp.missing...)
+}
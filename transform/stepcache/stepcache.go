@@ -0,0 +1,135 @@
+// Package stepcache stores the results of transform steps. A step with a
+// cached result & unchanged inputs is restored from the cache instead of
+// running again
+package stepcache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/qri-io/qri/transform/startf"
+)
+
+// ErrNotFound indicates there's no cache entry for a key
+var ErrNotFound = fmt.Errorf("step cache entry not found")
+
+// Entry is the cached result of running a transform step
+type Entry struct {
+	// Key is a hash of the step script, the transform configuration & the
+	// results of previous steps
+	Key string `json:"key"`
+	// Inputs are the datasets & http responses the step read. A cached entry
+	// is only valid while inputs are unchanged
+	Inputs startf.StepInputs `json:"inputs"`
+	// Snapshot records the effects of running the step
+	Snapshot *startf.StepSnapshot `json:"snapshot"`
+	Created  time.Time            `json:"created"`
+}
+
+// Store persists cache entries
+type Store interface {
+	// Get fetches the entry for a key, returning ErrNotFound if none exists
+	Get(ctx context.Context, key string) (*Entry, error)
+	// Put adds an entry to the store, replacing any entry with the same key
+	Put(ctx context.Context, e *Entry) error
+}
+
+// MemStore is an in-memory implementation of Store
+type MemStore struct {
+	mu        sync.Mutex
+	entries   map[string]*Entry
+	responses map[string]map[string]*Response
+}
+
+// compile-time assertion that MemStore is a Store
+var _ Store = (*MemStore)(nil)
+
+// NewMemStore creates an empty in-memory store
+func NewMemStore() *MemStore {
+	return &MemStore{entries: map[string]*Entry{}}
+}
+
+// Get fetches the entry for a key
+func (s *MemStore) Get(ctx context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return e, nil
+}
+
+// Put adds an entry to the store
+func (s *MemStore) Put(ctx context.Context, e *Entry) error {
+	if e.Key == "" {
+		return fmt.Errorf("entry key is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[e.Key] = e
+	return nil
+}
+
+// fileStore writes each entry to a JSON file in a directory
+type fileStore struct {
+	dir string
+	// responsesLk serializes writes to recorded responses
+	responsesLk sync.Mutex
+}
+
+// compile-time assertion that fileStore is a Store
+var _ Store = (*fileStore)(nil)
+
+// NewFileStore creates a store that persists entries to a directory,
+// creating the directory if it doesn't exist. Entries hold values read from
+// the network, so files are only readable by the owner
+func NewFileStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
+
+// Get fetches the entry for a key
+func (s *fileStore) Get(ctx context.Context, key string) (*Entry, error) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	e := &Entry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Put adds an entry to the store
+func (s *fileStore) Put(ctx context.Context, e *Entry) error {
+	if e.Key == "" {
+		return fmt.Errorf("entry key is required")
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// write to a temp file & rename, so readers never see partial entries
+	tmp := s.path(e.Key) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(e.Key))
+}
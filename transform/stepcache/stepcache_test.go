@@ -0,0 +1,193 @@
+package stepcache
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/qri/transform/startf"
+)
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stepcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]Store{
+		"mem":  NewMemStore(),
+		"file": fs,
+	}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, s)
+		})
+	}
+
+	fi, err := os.Stat(fs.(*fileStore).path("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("expected entry file permissions 0600, got %o", perm)
+	}
+}
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+	if err := s.Put(ctx, &Entry{}); err == nil {
+		t.Errorf("expected error putting an entry without a key")
+	}
+
+	e := &Entry{
+		Key: "key",
+		Inputs: startf.StepInputs{
+			Requests: []startf.HTTPInput{{Method: "GET", URL: "https://example.com", Hash: "abc", ETag: `"1"`}},
+		},
+		Snapshot: &startf.StepSnapshot{
+			Globals: map[string]*startf.EncodedValue{"x": {Type: "int", Value: "1"}},
+		},
+		Created: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := s.Put(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(e, got); diff != "" {
+		t.Errorf("entry mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestResponseStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stepcache_responses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]ResponseStore{
+		"mem":  NewMemStore(),
+		"file": fs.(ResponseStore),
+	}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			testResponseStore(t, s)
+		})
+	}
+
+	if err := fs.(ResponseStore).PutResponse(context.Background(), "run_a", &Response{Method: "GET", URL: "https://example.com", Hash: startf.HashBytes([]byte("a")), Body: []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	runDir, err := fs.(*fileStore).responseDir("run_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = filepath.Walk(runDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		expect := os.FileMode(0600)
+		if fi.IsDir() {
+			expect = 0700
+		}
+		if perm := fi.Mode().Perm(); perm != expect {
+			t.Errorf("expected %s permissions %o, got %o", path, expect, perm)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.(ResponseStore).PutResponse(context.Background(), "../escape", &Response{Hash: "x"}); err == nil {
+		t.Error("expected a run ID with a path separator to fail")
+	}
+}
+
+func testResponseStore(t *testing.T, s ResponseStore) {
+	ctx := context.Background()
+	url := "https://example.com/data.json"
+	response := func(body string) *Response {
+		return &Response{Method: "GET", URL: url, Hash: startf.HashBytes([]byte(body)), Body: []byte(body), Recorded: time.Now()}
+	}
+
+	if _, err := s.GetResponse(ctx, "run_a", "GET", url); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+	for runID, r := range map[string]*Response{
+		"run_a": response("one"),
+		"run_b": response("two"),
+	} {
+		if err := s.PutResponse(ctx, runID, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a later response to the same request in a run replaces the earlier one
+	if err := s.PutResponse(ctx, "run_a", response("three")); err != nil {
+		t.Fatal(err)
+	}
+
+	for runID, expect := range map[string]string{"run_a": "three", "run_b": "two"} {
+		got, err := s.GetResponse(ctx, runID, "GET", url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Body) != expect {
+			t.Errorf("response of %s: want %q, got %q", runID, expect, got.Body)
+		}
+	}
+	if _, err := s.GetResponse(ctx, "run_a", "POST", url); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a different method, got: %v", err)
+	}
+
+	// collection removes responses of runs that aren't live
+	live := map[string]struct{}{"run_b": {}}
+	removed, err := CollectResponses(ctx, s, live, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("expected dry run to report 1 removed run, got %d", removed)
+	}
+	if _, err := s.GetResponse(ctx, "run_a", "GET", url); err != nil {
+		t.Errorf("expected dry run to keep responses, got: %v", err)
+	}
+	if removed, err = CollectResponses(ctx, s, live, false); err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 removed run, got %d", removed)
+	}
+	runs, err := s.ResponseRuns(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"run_b"}, runs); diff != "" {
+		t.Errorf("runs mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := s.GetResponse(ctx, "run_a", "GET", url); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after collection, got: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+// Package tfstate persists values a transform carries from one run to the
+// next, like the cursor of a paginated API or a watermark timestamp. State is
+// keyed by dataset initID
+package tfstate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MaxSize is the largest state a dataset can store, in bytes of encoded JSON
+const MaxSize = 64 * 1024
+
+var (
+	// ErrNotFound indicates a dataset has no stored state
+	ErrNotFound = fmt.Errorf("transform state not found")
+	// ErrTooLarge indicates state exceeds MaxSize when encoded
+	ErrTooLarge = fmt.Errorf("transform state exceeds %d bytes", MaxSize)
+)
+
+// State is a set of JSON-serializable values. Numbers in state read from a
+// store are json.Number values, keeping integers distinct from floats
+type State map[string]interface{}
+
+// Copy returns a deep copy of the state
+func (s State) Copy() (State, error) {
+	if s == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	cp := State{}
+	err = decode(data, &cp)
+	return cp, err
+}
+
+func decode(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// Validate errors if state can't be encoded as JSON, or is too large
+func (s State) Validate() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("invalid transform state: %w", err)
+	}
+	if len(data) > MaxSize {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// Store persists transform state
+type Store interface {
+	// Get fetches the state of a dataset, returning ErrNotFound if the dataset
+	// has no stored state
+	Get(ctx context.Context, initID string) (State, error)
+	// Put replaces the state of a dataset
+	Put(ctx context.Context, initID string, s State) error
+	// Delete removes the state of a dataset
+	Delete(ctx context.Context, initID string) error
+}
+
+// MemStore is an in-memory implementation of Store
+type MemStore struct {
+	lock   sync.Mutex
+	states map[string]State
+}
+
+// compile-time assertion that MemStore is a Store
+var _ Store = (*MemStore)(nil)
+
+// NewMemStore creates an empty in-memory store
+func NewMemStore() *MemStore {
+	return &MemStore{states: map[string]State{}}
+}
+
+// Get fetches the state of a dataset
+func (s *MemStore) Get(ctx context.Context, initID string) (State, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	st, ok := s.states[initID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return st.Copy()
+}
+
+// Put replaces the state of a dataset
+func (s *MemStore) Put(ctx context.Context, initID string, st State) error {
+	if initID == "" {
+		return fmt.Errorf("initID is required")
+	}
+	if err := st.Validate(); err != nil {
+		return err
+	}
+	cp, err := st.Copy()
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.states[initID] = cp
+	return nil
+}
+
+// Delete removes the state of a dataset
+func (s *MemStore) Delete(ctx context.Context, initID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.states[initID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.states, initID)
+	return nil
+}
+
+// fileStore keeps state in memory, writing all state to a JSON file on
+// every change. fileStore is safe for concurrent use
+type fileStore struct {
+	*MemStore
+	path string
+	// writeLock serializes changes & file writes
+	writeLock sync.Mutex
+}
+
+// compile-time assertion that fileStore is a Store
+var _ Store = (*fileStore)(nil)
+
+// NewFileStore creates a store that persists to a file in repoPath
+func NewFileStore(repoPath string) (Store, error) {
+	s := &fileStore{
+		MemStore: NewMemStore(),
+		path:     filepath.Join(repoPath, "transform_state.json"),
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("reading transform state: %w", err)
+	}
+	if err := decode(data, &s.states); err != nil {
+		return nil, fmt.Errorf("reading transform state: %w", err)
+	}
+	return s, nil
+}
+
+// Put replaces the state of a dataset
+func (s *fileStore) Put(ctx context.Context, initID string, st State) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	if err := s.MemStore.Put(ctx, initID, st); err != nil {
+		return err
+	}
+	return s.write()
+}
+
+// Delete removes the state of a dataset
+func (s *fileStore) Delete(ctx context.Context, initID string) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	if err := s.MemStore.Delete(ctx, initID); err != nil {
+		return err
+	}
+	return s.write()
+}
+
+// write saves all state to a temp file & renames it into place, so readers
+// never see a partial file. callers must hold the write lock, which keeps
+// writes in the order changes were made
+func (s *fileStore) write() error {
+	s.lock.Lock()
+	data, err := json.Marshal(s.states)
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
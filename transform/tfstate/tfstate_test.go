@@ -0,0 +1,138 @@
+package tfstate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]Store{
+		"mem":  NewMemStore(),
+		"file": fs,
+	}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, s)
+		})
+	}
+
+	// file stores read state written by previous stores
+	ctx := context.Background()
+	if err := fs.Put(ctx, "persisted", State{"cursor": 10}); err != nil {
+		t.Fatal(err)
+	}
+	fs, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fs.Get(ctx, "persisted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(State{"cursor": json.Number("10")}, got); diff != "" {
+		t.Errorf("persisted state mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFileStoreConcurrentWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := fs.Put(ctx, fmt.Sprintf("init_%d", i), State{"cursor": i}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// the last write holds every change
+	fs, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := fs.Get(ctx, fmt.Sprintf("init_%d", i)); err != nil {
+			t.Errorf("state %d: %s", i, err)
+		}
+	}
+}
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	if _, err := s.Get(ctx, "init_id"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+
+	st := State{
+		"cursor":    "abc",
+		"page":      3,
+		"watermark": 1.5,
+		"seen":      []interface{}{"a", "b"},
+	}
+	if err := s.Put(ctx, "init_id", st); err != nil {
+		t.Fatal(err)
+	}
+	// changes to state after it's stored don't modify the store
+	st["cursor"] = "changed"
+
+	got, err := s.Get(ctx, "init_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := State{
+		"cursor":    "abc",
+		"page":      json.Number("3"),
+		"watermark": json.Number("1.5"),
+		"seen":      []interface{}{"a", "b"},
+	}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+
+	big := State{"big": strings.Repeat("a", MaxSize)}
+	if err := s.Put(ctx, "init_id", big); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got: %v", err)
+	}
+
+	if err := s.Delete(ctx, "init_id"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "init_id"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got: %v", err)
+	}
+	if err := s.Delete(ctx, "init_id"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting missing state, got: %v", err)
+	}
+}
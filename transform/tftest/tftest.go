@@ -0,0 +1,486 @@
+// Package tftest runs tests for starlark transform scripts. A test is a
+// starlark file named NAME_test.star that sits next to the transform script
+// NAME.star. Test files declare fixture datasets for the transform to load
+// and the components the transform is expected to produce:
+//
+//	fixture("me/population", body=[["usa", 331]], meta={"title": "population"})
+//	expect(body=[["usa", 331000000]], meta={"title": "population in people"})
+//
+// Transforms run against fixtures only. load_dataset can't reach datasets
+// outside the test file, and the network is disabled
+package tftest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	golog "github.com/ipfs/go-log"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+	"github.com/qri-io/dataset/stepfile"
+	"github.com/qri-io/deepdiff"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/transform/startf"
+	"github.com/qri-io/starlib/util"
+	"go.starlark.net/starlark"
+)
+
+var log = golog.Logger("tftest")
+
+// TestFileSuffix identifies transform test files
+const TestFileSuffix = "_test.star"
+
+// ErrNetworkDisabled is returned when a transform under test makes a network
+// request
+var ErrNetworkDisabled = startf.ErrOffline
+
+// Case is a single transform test, read from a test file
+type Case struct {
+	// path to the test file
+	Path string
+	// path to the transform script under test
+	TransformPath string
+	// datasets available to load_dataset, keyed by initID
+	Fixtures *FixtureLoader
+	// expected output components, keyed by component name. only components
+	// present in Expect are checked
+	Expect map[string]interface{}
+}
+
+// Result is the outcome of running a Case
+type Result struct {
+	// path to the test file
+	Path string `json:"path"`
+	// path to the transform script under test
+	TransformPath string `json:"transformPath"`
+	// Passed is true when the transform ran and produced all expected
+	// components
+	Passed bool `json:"passed"`
+	// Error describes a failure to load the test or run the transform
+	Error string `json:"error,omitempty"`
+	// Failures lists components that didn't match expectations
+	Failures []Failure `json:"failures,omitempty"`
+	// Output is the print output of the transform
+	Output string `json:"output,omitempty"`
+}
+
+// Failure describes a dataset component that didn't match expectations
+type Failure struct {
+	Component string `json:"component"`
+	// Diff is a human-readable description of the difference between the
+	// expected & actual component
+	Diff string `json:"diff"`
+}
+
+// FindTests lists the test files at path. If path is a directory all test
+// files within it are returned, sorted by path
+func FindTests(path string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		if !strings.HasSuffix(path, TestFileSuffix) {
+			return nil, fmt.Errorf("%q is not a transform test file. test files end in %q", path, TestFileSuffix)
+		}
+		return []string{path}, nil
+	}
+
+	var paths []string
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && p != path && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && strings.HasSuffix(p, TestFileSuffix) {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	return paths, err
+}
+
+// Run loads & runs every test file at path
+func Run(ctx context.Context, path string) ([]*Result, error) {
+	paths, err := FindTests(path)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*Result, 0, len(paths))
+	for _, p := range paths {
+		c, err := LoadCase(p)
+		if err != nil {
+			results = append(results, &Result{Path: p, Error: err.Error()})
+			continue
+		}
+		results = append(results, c.Run(ctx))
+	}
+	return results, nil
+}
+
+// LoadCase reads a test file. The transform under test defaults to the
+// script next to the test file with the "_test" suffix removed. Test files
+// can name a different script with the transform builtin
+func LoadCase(path string) (*Case, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(path)
+	c := &Case{
+		Path:          path,
+		TransformPath: strings.TrimSuffix(path, TestFileSuffix) + ".star",
+		Fixtures:      NewFixtureLoader(),
+		Expect:        map[string]interface{}{},
+	}
+
+	predeclared := starlark.StringDict{
+		"fixture": starlark.NewBuiltin("fixture", c.fixture),
+		"expect":  starlark.NewBuiltin("expect", c.expect),
+		"transform": starlark.NewBuiltin("transform", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var p starlark.String
+			if err := starlark.UnpackArgs("transform", args, kwargs, "path", &p); err != nil {
+				return nil, err
+			}
+			c.TransformPath = filepath.Join(dir, p.GoString())
+			return starlark.None, nil
+		}),
+	}
+
+	thread := &starlark.Thread{Name: path}
+	if _, err := starlark.ExecFile(thread, path, src, predeclared); err != nil {
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			return nil, fmt.Errorf(evalErr.Backtrace())
+		}
+		return nil, err
+	}
+	if len(c.Expect) == 0 {
+		return nil, fmt.Errorf("test file %q doesn't expect anything. call expect() to declare expected output", path)
+	}
+	return c, nil
+}
+
+// fixture implements the fixture(ref, body=None, meta=None, structure=None)
+// starlark builtin
+func (c *Case) fixture(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		refstr                starlark.String
+		body, meta, structure starlark.Value
+	)
+	if err := starlark.UnpackArgs("fixture", args, kwargs, "ref", &refstr, "body?", &body, "meta?", &meta, "structure?", &structure); err != nil {
+		return nil, err
+	}
+
+	ds := &dataset.Dataset{}
+	if err := assignComponent(&ds.Meta, meta); err != nil {
+		return nil, fmt.Errorf("fixture %s meta: %w", refstr.GoString(), err)
+	}
+	if err := assignComponent(&ds.Structure, structure); err != nil {
+		return nil, fmt.Errorf("fixture %s structure: %w", refstr.GoString(), err)
+	}
+	bodyVal, err := unmarshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s body: %w", refstr.GoString(), err)
+	}
+	if err := c.Fixtures.Put(refstr.GoString(), ds, bodyVal); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+// expect implements the expect(body=None, meta=None, structure=None) starlark
+// builtin
+func (c *Case) expect(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var body, meta, structure starlark.Value
+	if err := starlark.UnpackArgs("expect", args, kwargs, "body?", &body, "meta?", &meta, "structure?", &structure); err != nil {
+		return nil, err
+	}
+	for name, v := range map[string]starlark.Value{"body": body, "meta": meta, "structure": structure} {
+		if v == nil {
+			continue
+		}
+		val, err := unmarshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("expected %s: %w", name, err)
+		}
+		c.Expect[name] = val
+	}
+	return starlark.None, nil
+}
+
+// Run executes the transform under test against fixtures & compares results
+// to expectations
+func (c *Case) Run(ctx context.Context) *Result {
+	res := &Result{Path: c.Path, TransformPath: c.TransformPath}
+	output := &bytes.Buffer{}
+
+	target, err := c.runTransform(ctx, output)
+	res.Output = output.String()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	for _, name := range []string{"meta", "structure", "body"} {
+		expect, ok := c.Expect[name]
+		if !ok {
+			continue
+		}
+		got, err := componentValue(target, name)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		if name != "body" {
+			// only check the fields of a component the test file specifies
+			got = subset(expect, got)
+		}
+		diff, err := diffValues(ctx, expect, got)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		if diff != "" {
+			res.Failures = append(res.Failures, Failure{Component: name, Diff: diff})
+		}
+	}
+
+	res.Passed = len(res.Failures) == 0
+	return res
+}
+
+func (c *Case) runTransform(ctx context.Context, output *bytes.Buffer) (*dataset.Dataset, error) {
+	script, err := ioutil.ReadFile(c.TransformPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading transform: %w", err)
+	}
+	steps, err := stepfile.Read(qfs.NewMemfileBytes(filepath.Base(c.TransformPath), script))
+	if err != nil {
+		return nil, fmt.Errorf("reading transform: %w", err)
+	}
+	for i := range steps {
+		steps[i].Syntax = "starlark"
+	}
+
+	target := &dataset.Dataset{Transform: &dataset.Transform{Steps: steps}}
+	runner := startf.NewStepRunner(target,
+		startf.AddDatasetLoader(c.Fixtures),
+		startf.SetErrWriter(output),
+		startf.DisableNetwork(),
+	)
+	for _, step := range steps {
+		if err := runner.RunStep(ctx, target, step); err != nil {
+			return nil, err
+		}
+	}
+	if !runner.CommitCalled() {
+		return nil, fmt.Errorf("transform didn't call dataset.commit")
+	}
+	return target, nil
+}
+
+// FixtureLoader is a dsref.Loader for fixture datasets, resolving references
+// with a dsref.MemResolver
+type FixtureLoader struct {
+	resolver *dsref.MemResolver
+	datasets map[string]*dataset.Dataset
+	bodies   map[string][]byte
+}
+
+// assert at compile time that FixtureLoader is a dsref.Loader
+var _ dsref.Loader = (*FixtureLoader)(nil)
+
+// NewFixtureLoader creates an empty FixtureLoader
+func NewFixtureLoader() *FixtureLoader {
+	return &FixtureLoader{
+		resolver: dsref.NewMemResolver(""),
+		datasets: map[string]*dataset.Dataset{},
+		bodies:   map[string][]byte{},
+	}
+}
+
+// Put adds a fixture dataset with a body to the loader. fixture bodies are
+// stored as JSON
+func (l *FixtureLoader) Put(refstr string, ds *dataset.Dataset, body interface{}) error {
+	ref, err := dsref.Parse(refstr)
+	if err != nil {
+		return fmt.Errorf("fixture %q: %w", refstr, err)
+	}
+	initID := ref.Alias()
+	if _, exists := l.datasets[initID]; exists {
+		return fmt.Errorf("fixture %q is declared more than once", refstr)
+	}
+
+	ds.ID = initID
+	ds.Peername = ref.Username
+	ds.Name = ref.Name
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("fixture %q body: %w", refstr, err)
+		}
+		l.bodies[initID] = data
+		if ds.Structure == nil {
+			ds.Structure = &dataset.Structure{}
+		}
+		ds.Structure.Format = dataset.JSONDataFormat.String()
+		if ds.Structure.Schema == nil {
+			ds.Structure.Schema = dataset.BaseSchemaArray
+			if _, ok := body.(map[string]interface{}); ok {
+				ds.Structure.Schema = dataset.BaseSchemaObject
+			}
+		}
+	}
+
+	l.datasets[initID] = ds
+	l.resolver.Put(dsref.VersionInfo{InitID: initID, Username: ref.Username, Name: ref.Name})
+	return nil
+}
+
+// LoadDataset implements the dsref.Loader interface. Each call returns a new
+// copy of the fixture, with an unread body file
+func (l *FixtureLoader) LoadDataset(ctx context.Context, refstr string) (*dataset.Dataset, error) {
+	ref, err := dsref.Parse(refstr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.resolver.ResolveRef(ctx, &ref); err != nil {
+		log.Debugw("resolving fixture", "ref", refstr, "err", err)
+		return nil, fmt.Errorf("%w: no fixture for %q", dsref.ErrRefNotFound, refstr)
+	}
+
+	ds := &dataset.Dataset{}
+	ds.Assign(l.datasets[ref.InitID])
+	if data, ok := l.bodies[ref.InitID]; ok {
+		ds.SetBodyFile(qfs.NewMemfileBytes("body.json", data))
+	}
+	return ds, nil
+}
+
+// componentValue returns a component of a dataset as JSON-compatible values
+func componentValue(ds *dataset.Dataset, name string) (interface{}, error) {
+	switch name {
+	case "body":
+		if ds.BodyFile() == nil || ds.Structure == nil {
+			return nil, nil
+		}
+		rdr, err := dsio.NewEntryReader(ds.Structure, ds.BodyFile())
+		if err != nil {
+			return nil, fmt.Errorf("reading transform body: %w", err)
+		}
+		body, err := dsio.ReadAll(rdr)
+		if err != nil {
+			return nil, fmt.Errorf("reading transform body: %w", err)
+		}
+		return normalize(body)
+	case "meta":
+		if ds.Meta == nil {
+			return nil, nil
+		}
+		return normalize(ds.Meta)
+	case "structure":
+		if ds.Structure == nil {
+			return nil, nil
+		}
+		return normalize(ds.Structure)
+	}
+	return nil, fmt.Errorf("unknown component %q", name)
+}
+
+// subset drops the fields of got that aren't in expect, for object values
+func subset(expect, got interface{}) interface{} {
+	e, ok := expect.(map[string]interface{})
+	if !ok {
+		return got
+	}
+	g, ok := got.(map[string]interface{})
+	if !ok {
+		return got
+	}
+	sub := map[string]interface{}{}
+	for key := range e {
+		if val, ok := g[key]; ok {
+			sub[key] = val
+		}
+	}
+	return sub
+}
+
+// diffValues returns a readable diff of two values, or the empty string if
+// the values are equal
+func diffValues(ctx context.Context, expect, got interface{}) (string, error) {
+	expect, err := normalize(expect)
+	if err != nil {
+		return "", err
+	}
+	if expect == nil || got == nil {
+		if expect == nil && got == nil {
+			return "", nil
+		}
+		return fmt.Sprintf("want: %v\ngot:  %v\n", expect, got), nil
+	}
+
+	deltas, err := deepdiff.New().Diff(ctx, expect, got)
+	if err != nil {
+		return "", err
+	}
+	if !hasChanges(deltas) {
+		return "", nil
+	}
+	return deepdiff.FormatPrettyString(deltas, false)
+}
+
+// hasChanges checks deltas for operations other than context
+func hasChanges(deltas deepdiff.Deltas) bool {
+	for _, d := range deltas {
+		if d.Type != deepdiff.DTContext || hasChanges(d.Deltas) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize round-trips a value through JSON so values of different go types
+// that encode the same way compare as equal
+func normalize(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var norm interface{}
+	err = json.Unmarshal(data, &norm)
+	return norm, err
+}
+
+// unmarshal converts a starlark value to go, treating a missing value as nil
+func unmarshal(v starlark.Value) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return util.Unmarshal(v)
+}
+
+// assignComponent decodes a starlark dict into a dataset component
+func assignComponent(dst interface{}, v starlark.Value) error {
+	val, err := unmarshal(v)
+	if err != nil || val == nil {
+		return err
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
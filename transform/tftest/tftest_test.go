@@ -0,0 +1,69 @@
+package tftest
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	results, err := Run(context.Background(), "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]*Result{}
+	for _, res := range results {
+		got[res.Path] = res
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(got))
+	}
+
+	pass := got["testdata/population_test.star"]
+	if !pass.Passed {
+		t.Errorf("expected population_test to pass. error: %q failures: %v", pass.Error, pass.Failures)
+	}
+
+	fail := got["testdata/population_wrong_test.star"]
+	if fail.Passed || fail.Error != "" {
+		t.Errorf("expected population_wrong_test to fail with a diff. error: %q", fail.Error)
+	}
+	if fail.TransformPath != "testdata/population.star" {
+		t.Errorf("expected transform path to be set by the test file, got %q", fail.TransformPath)
+	}
+	if len(fail.Failures) != 1 || fail.Failures[0].Component != "body" || !strings.Contains(fail.Failures[0].Diff, "canada") {
+		t.Errorf("expected a single body failure mentioning the missing row, got: %v", fail.Failures)
+	}
+
+	offline := got["testdata/fetch_test.star"]
+	if offline.Passed || !strings.Contains(offline.Error, ErrNetworkDisabled.Error()) {
+		t.Errorf("expected fetch_test to fail with network disabled, got error: %q", offline.Error)
+	}
+}
+
+func TestFixtureLoader(t *testing.T) {
+	ctx := context.Background()
+	c, err := LoadCase("testdata/population_test.star")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Fixtures.LoadDataset(ctx, "me/not_a_fixture"); err == nil {
+		t.Error("expected loading a missing fixture to error")
+	}
+
+	// each load gets a fresh body file
+	for i := 0; i < 2; i++ {
+		ds, err := c.Fixtures.LoadDataset(ctx, "me/population")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := componentValue(ds, "body")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows, ok := body.([]interface{}); !ok || len(rows) != 2 {
+			t.Errorf("load %d: expected 2 body rows, got %v", i, body)
+		}
+	}
+}
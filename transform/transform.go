@@ -13,6 +13,8 @@ import (
 	"github.com/qri-io/qri/event"
 	"github.com/qri-io/qri/profile"
 	"github.com/qri-io/qri/transform/startf"
+	"github.com/qri-io/qri/transform/stepcache"
+	"github.com/qri-io/qri/transform/tfstate"
 )
 
 var log = golog.Logger("transform")
@@ -57,6 +59,18 @@ type Transformer struct {
 	pub      event.Publisher
 	sizeInfo SizeInfo
 	changes  map[string]struct{}
+	debugger *startf.Debugger
+
+	cache        stepcache.Store
+	refreshCache bool
+	replay       startf.HTTPReplayer
+	responses    stepcache.ResponseStore
+	recording    bool
+
+	state        tfstate.State
+	stateChanged bool
+
+	params map[string]string
 }
 
 // SizeInfo is info about the size of the area that output is displayed on
@@ -76,6 +90,35 @@ func NewTransformer(appCtx context.Context, fs qfs.Filesystem, loader dsref.Load
 	}
 }
 
+// SetDebugger runs transforms with a debugger, pausing execution at
+// breakpoints. Paused state is published as ETTransformDebugPaused events
+func (t *Transformer) SetDebugger(d *startf.Debugger) {
+	t.debugger = d
+}
+
+// SetHTTPReplay disables network access, answering http requests made by the
+// transform with recorded responses
+func (t *Transformer) SetHTTPReplay(rp startf.HTTPReplayer) {
+	t.replay = rp
+}
+
+// SetState provides state persisted by a previous run of the transform
+func (t *Transformer) SetState(st tfstate.State) {
+	t.state = st
+}
+
+// SetParams sets run parameter values, overriding the defaults declared in
+// transform config
+func (t *Transformer) SetParams(params map[string]string) {
+	t.params = params
+}
+
+// State returns transform state after the most recent run, and whether the
+// run changed state. State is only updated by runs that succeed
+func (t *Transformer) State() (st tfstate.State, changed bool) {
+	return t.state, t.stateChanged
+}
+
 // Apply applies the transform script to a target dataset
 func (t *Transformer) Apply(
 	ctx context.Context,
@@ -147,6 +190,11 @@ func (t *Transformer) apply(
 		target.Assign(head)
 	}
 
+	params, err := ResolveParams(target.Transform.Config, t.params)
+	if err != nil {
+		return err
+	}
+
 	t.changes = make(map[string]struct{})
 	eventsCh := make(chan event.Event)
 
@@ -157,6 +205,21 @@ func (t *Transformer) apply(
 		startf.AddEventsChannel(eventsCh),
 		startf.TrackChanges(t.changes),
 		startf.SizeInfo(t.sizeInfo.OutputWidth, t.sizeInfo.OutputHeight),
+		startf.SetState(t.state),
+		startf.SetParams(params),
+	}
+	if t.debugger != nil {
+		opts = append(opts, startf.SetDebugger(t.debugger))
+	}
+	if t.replay != nil {
+		opts = append(opts, startf.ReplayHTTP(t.replay))
+	}
+	// debugging requires running every step
+	useCache := t.cache != nil && t.debugger == nil
+	// only runs that create versions record responses
+	t.recording = t.responses != nil && runMode == RMCommit
+	if useCache || t.recording {
+		opts = append(opts, startf.TrackInputs())
 	}
 
 	doneCh := make(chan error)
@@ -261,8 +324,20 @@ func (t *Transformer) apply(
 			target.Transform.Steps = steps
 		}
 
+		// resources record the datasets loaded by a single run. clear any left
+		// over from the transform of a previous version
+		target.Transform.Resources = nil
+
 		// Run each step using a StepRunner
 		stepRunner := startf.NewStepRunner(target, opts...)
+		fingerprint := ""
+		if useCache {
+			if fingerprint, runErr = cacheSeed(target, secrets, params, t.state); runErr != nil {
+				log.Debugw("fingerprinting transform, disabling step cache", "err", runErr)
+				runErr = nil
+				useCache = false
+			}
+		}
 		for i, step := range target.Transform.Steps {
 			// If the transform has failed at some step, emit skip events for remaining steps.
 			if status != StatusSucceeded {
@@ -286,9 +361,17 @@ func (t *Transformer) apply(
 				},
 			}
 
+			cached := false
 			switch step.Syntax {
 			case SyntaxStarlark:
-				runErr = stepRunner.RunStep(ctx, target, step)
+				if useCache {
+					fingerprint, cached, runErr = t.runCachedStep(ctx, stepRunner, target, step, fingerprint)
+				} else {
+					runErr = stepRunner.RunStep(ctx, target, step)
+				}
+				if runErr == nil && t.recording && !cached {
+					t.recordResponses(ctx, runID, stepRunner)
+				}
 				if runErr != nil {
 					log.Debugw("error running transform step", "runID", runID, "index", i, "err", runErr)
 					eventsCh <- event.Event{
@@ -326,10 +409,16 @@ func (t *Transformer) apply(
 					Category: step.Category,
 					Status:   status,
 					Mode:     runMode,
+					Cached:   cached,
 				},
 			}
 		}
 
+		if status == StatusSucceeded {
+			t.state = stepRunner.State()
+			t.stateChanged = stepRunner.StateChanged()
+		}
+
 		// warn user if commit wasn't called
 		if status != StatusFailed && !stepRunner.CommitCalled() {
 			eventsCh <- event.Event{
@@ -3,6 +3,7 @@ package transform
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"testing"
 
@@ -167,8 +168,9 @@ func TestCommit(t *testing.T) {
 }
 
 // run a transform script & capture the event log. transform runs against an
-// empty dataset history
-func applyNoHistoryTransform(t *testing.T, initID string, tf *dataset.Transform, runID, runMode string) []event.Event {
+// empty dataset history. opts configure the transformer, and can subscribe to
+// run events before the transform starts
+func applyNoHistoryTransform(t *testing.T, initID string, tf *dataset.Transform, runID, runMode string, opts ...func(tfr *Transformer, bus event.Bus)) []event.Event {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -189,6 +191,9 @@ func applyNoHistoryTransform(t *testing.T, initID string, tf *dataset.Transform,
 
 	fs := qfs.NewMemFS()
 	transformer := NewTransformer(ctx, fs, loader, bus, SizeInfo{})
+	for _, opt := range opts {
+		opt(transformer, bus)
+	}
 	if runMode == "apply" {
 		if err := transformer.Apply(ctx, target, runID, false, nil); err != nil {
 			t.Fatal(err)
@@ -203,6 +208,33 @@ func applyNoHistoryTransform(t *testing.T, initID string, tf *dataset.Transform,
 	return log
 }
 
+// runError returns the error a run failed with, read from the run event log
+func runError(log []event.Event) error {
+	for _, e := range log {
+		if e.Type == event.ETTransformError {
+			return errors.New(e.Payload.(event.TransformMessage).Msg)
+		}
+	}
+	return nil
+}
+
+// previewBody returns the body of the dataset a run committed, read from the
+// run event log
+func previewBody(t *testing.T, log []event.Event) string {
+	t.Helper()
+	for _, e := range log {
+		if e.Type == event.ETTransformDatasetPreview {
+			data, err := json.Marshal(e.Payload.(*dataset.Dataset).Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(data)
+		}
+	}
+	t.Fatal("run didn't commit a dataset")
+	return ""
+}
+
 type noHistoryLoader struct{}
 
 // LoadDataset fails and returns that the reference has no history
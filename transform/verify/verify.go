@@ -0,0 +1,438 @@
+// Package verify checks that committed dataset versions are reproducible.
+// Verification re-runs the transform recorded in a version against the
+// versions of the datasets it loaded at the time, with the network disabled,
+// and compares the result to the recorded body & structure.
+//
+// Transforms that read http responses can only be verified if the responses
+// were recorded in the step cache when the version was created
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	golog "github.com/ipfs/go-log"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/detect"
+	"github.com/qri-io/dataset/dsio"
+	"github.com/qri-io/dataset/stepfile"
+	"github.com/qri-io/deepdiff"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qri/base"
+	"github.com/qri-io/qri/base/dsfs"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/event"
+	"github.com/qri-io/qri/transform"
+	"github.com/qri-io/qri/transform/staticlark"
+	"github.com/qri-io/qri/transform/stepcache"
+	"go.starlark.net/resolve"
+	"go.starlark.net/syntax"
+)
+
+var log = golog.Logger("verify")
+
+// Status is the outcome of verifying a version
+type Status string
+
+const (
+	// StatusReproducible means re-running the transform produced the recorded
+	// body & structure
+	StatusReproducible = Status("reproducible")
+	// StatusDiverged means re-running the transform produced a different body
+	// or structure
+	StatusDiverged = Status("diverged")
+	// StatusUnverifiable means the transform couldn't be re-run with the
+	// inputs it originally read
+	StatusUnverifiable = Status("unverifiable")
+)
+
+// Result is the outcome of verifying a dataset version
+type Result struct {
+	Ref    string `json:"ref"`
+	Status Status `json:"status"`
+	// Reason explains why a version is unverifiable
+	Reason string `json:"reason,omitempty"`
+	// hashes of the recorded version
+	BodyHash      string `json:"bodyHash,omitempty"`
+	StructureHash string `json:"structureHash,omitempty"`
+	// hashes of the re-run transform output
+	RerunBodyHash      string `json:"rerunBodyHash,omitempty"`
+	RerunStructureHash string `json:"rerunStructureHash,omitempty"`
+	// Diff describes how the re-run output differs from the recorded version,
+	// from recorded to re-run
+	Diff string `json:"diff,omitempty"`
+	// Warnings point out parts of the transform that can cause divergence,
+	// like reading the current time
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Verifier re-runs the transforms of dataset versions
+type Verifier struct {
+	appCtx    context.Context
+	fs        qfs.Filesystem
+	loader    dsref.Loader
+	resolver  dsref.Resolver
+	pub       event.Publisher
+	responses stepcache.ResponseStore
+}
+
+// New creates a verifier. loader & resolver are used to load the datasets a
+// transform reads, which are pinned to the versions recorded with the
+// transform. responses is the store of recorded http responses, and may be
+// nil
+func New(appCtx context.Context, fs qfs.Filesystem, loader dsref.Loader, resolver dsref.Resolver, pub event.Publisher, responses stepcache.ResponseStore) *Verifier {
+	return &Verifier{
+		appCtx:    appCtx,
+		fs:        fs,
+		loader:    loader,
+		resolver:  resolver,
+		pub:       pub,
+		responses: responses,
+	}
+}
+
+// Verify re-runs the transform of a dataset version. ref must be resolved,
+// with a path. runID identifies the re-run, and params are the run parameter
+// values the version was created with
+func (v *Verifier) Verify(ctx context.Context, ref dsref.Ref, runID string, params map[string]string) (*Result, error) {
+	if ref.Path == "" {
+		return nil, dsref.ErrPathRequired
+	}
+	res := &Result{Ref: ref.String()}
+
+	ds, err := dsfs.LoadDataset(ctx, v.fs, ref.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := base.OpenDataset(ctx, v.fs, ds); err != nil {
+		return nil, err
+	}
+	if ds.Transform == nil {
+		return res.unverifiable("version has no transform"), nil
+	}
+	if ds.Commit == nil {
+		return res.unverifiable("version has no commit"), nil
+	}
+
+	expect, err := readBody(ds)
+	if err != nil {
+		return nil, err
+	}
+	res.BodyHash = hashValue(expect)
+	res.StructureHash = hashValue(structureValue(ds.Structure))
+
+	steps, err := transformSteps(ds.Transform)
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return res.unverifiable("transform has no steps"), nil
+	}
+	ds.Transform.Steps = steps
+	ds.Transform.SetScriptFile(nil)
+	for _, st := range steps {
+		script, ok := st.Script.(string)
+		if !ok {
+			continue
+		}
+		if readsState(script) {
+			return res.unverifiable("transform reads persisted state, which isn't recorded with versions"), nil
+		}
+		res.Warnings = append(res.Warnings, nondeterminismWarnings(st, script)...)
+	}
+
+	target, err := v.rerunTarget(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := &pinnedLoader{
+		loader:   v.loader,
+		resolver: v.resolver,
+		inputs:   base.TransformInputs(ds.Transform),
+	}
+	replay := stepcache.NewReplayer(v.responses, ds.Commit.RunID)
+	tf := transform.NewTransformer(v.appCtx, v.fs, loader, v.pub, transform.SizeInfo{})
+	tf.SetHTTPReplay(replay)
+	tf.SetParams(params)
+
+	if err := tf.Apply(ctx, target, runID, true, nil); err != nil {
+		if missing := replay.Missing(); len(missing) > 0 {
+			return res.unverifiable(fmt.Sprintf("no recorded http response for %s", strings.Join(missing, ", "))), nil
+		}
+		if missing := loader.Missing(); len(missing) > 0 {
+			return res.unverifiable(fmt.Sprintf("transform loads %s, which isn't a recorded input of this version", strings.Join(missing, ", "))), nil
+		}
+		return res.unverifiable(fmt.Sprintf("re-running transform: %s", err)), nil
+	}
+
+	got, err := readBody(target)
+	if err != nil {
+		return nil, err
+	}
+	if target.Structure == nil || target.Structure.Schema == nil {
+		if err := detect.Structure(target); err != nil && !errors.Is(err, dataset.ErrNoBody) {
+			return nil, err
+		}
+		// detection consumes the body file
+		if _, err := readBody(target); err != nil {
+			return nil, err
+		}
+	}
+	res.RerunBodyHash = hashValue(got)
+	res.RerunStructureHash = hashValue(structureValue(target.Structure))
+
+	if res.BodyHash == res.RerunBodyHash && res.StructureHash == res.RerunStructureHash {
+		res.Status = StatusReproducible
+		return res, nil
+	}
+
+	res.Status = StatusDiverged
+	diff, err := diffValues(ctx, map[string]interface{}{
+		"body":      expect,
+		"structure": structureValue(ds.Structure),
+	}, map[string]interface{}{
+		"body":      got,
+		"structure": structureValue(target.Structure),
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.Diff = diff
+	return res, nil
+}
+
+func (res *Result) unverifiable(reason string) *Result {
+	res.Status = StatusUnverifiable
+	res.Reason = reason
+	return res
+}
+
+// rerunTarget creates the dataset a transform is re-run against: the version
+// before the one being verified, with the recorded transform
+func (v *Verifier) rerunTarget(ctx context.Context, ds *dataset.Dataset) (*dataset.Dataset, error) {
+	target := &dataset.Dataset{}
+	if ds.PreviousPath != "" {
+		prev, err := dsfs.LoadDataset(ctx, v.fs, ds.PreviousPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading previous version: %w", err)
+		}
+		if err := base.OpenDataset(ctx, v.fs, prev); err != nil {
+			return nil, fmt.Errorf("loading previous version: %w", err)
+		}
+		prev.DropTransientValues()
+		prev.DropDerivedValues()
+		prev.ID = ""
+		prev.Commit = nil
+		prev.Transform = nil
+		target.Assign(prev)
+		target.SetBodyFile(prev.BodyFile())
+	}
+	target.Transform = ds.Transform
+	// names are left empty, so the transformer doesn't replace the previous
+	// version with the latest version of the dataset
+	target.Name = ""
+	target.Peername = ""
+	return target, nil
+}
+
+// transformSteps returns the steps of a transform, reading single-file
+// scripts as steps
+func transformSteps(tf *dataset.Transform) ([]*dataset.TransformStep, error) {
+	if len(tf.Steps) > 0 {
+		return tf.Steps, nil
+	}
+	if tf.ScriptFile() == nil {
+		return nil, nil
+	}
+	steps, err := stepfile.Read(tf.ScriptFile())
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range steps {
+		st.Syntax = transform.SyntaxStarlark
+	}
+	return steps, nil
+}
+
+// readsState reports if a script uses persisted transform state. Only
+// references to the predeclared state module count, names bound in the script
+// that shadow it don't
+func readsState(script string) bool {
+	f, err := syntax.Parse("", script, 0)
+	if err != nil {
+		return false
+	}
+	// names the script doesn't bind resolve as predeclared. resolution
+	// errors, like disallowed language features, still leave bindings set
+	anyName := func(string) bool { return true }
+	_ = resolve.File(f, anyName, anyName)
+	found := false
+	syntax.Walk(f, func(n syntax.Node) bool {
+		if dot, ok := n.(*syntax.DotExpr); ok {
+			if id, ok := dot.X.(*syntax.Ident); ok && id.Name == "state" {
+				if b, ok := id.Binding.(*resolve.Binding); ok && b.Scope == resolve.Predeclared {
+					found = true
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// nondeterminismWarnings lists calls in a step that can make output differ
+// between runs
+func nondeterminismWarnings(st *dataset.TransformStep, script string) []string {
+	name := st.Name
+	if name == "" {
+		name = "transform.star"
+	}
+	diags, err := staticlark.AnalyzeScript(name, script, st.Category)
+	if err != nil {
+		log.Debugw("analyzing transform step", "name", name, "err", err)
+		return nil
+	}
+	var warnings []string
+	for _, d := range diags {
+		if d.Category == "nondeterministic" {
+			warnings = append(warnings, d.String())
+		}
+	}
+	return warnings
+}
+
+// readBody reads the entries of a dataset body as JSON-compatible values,
+// replacing the body file so it can be read again
+func readBody(ds *dataset.Dataset) (interface{}, error) {
+	f := ds.BodyFile()
+	if f == nil || ds.Structure == nil {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	name := f.FullPath()
+	if name == "" {
+		name = f.FileName()
+	}
+	ds.SetBodyFile(qfs.NewMemfileBytes(name, data))
+
+	rdr, err := dsio.NewEntryReader(ds.Structure, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+	body, err := base.ReadEntries(rdr)
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+	return normalize(body)
+}
+
+// structureValue is the part of a structure that's compared, leaving out
+// values derived from the body, like checksums & entry counts
+func structureValue(st *dataset.Structure) interface{} {
+	if st == nil {
+		return nil
+	}
+	v, err := normalize(map[string]interface{}{
+		"format": st.Format,
+		"schema": st.Schema,
+	})
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// normalize round-trips a value through JSON so values of different go types
+// that encode the same way compare as equal
+func normalize(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var norm interface{}
+	err = json.Unmarshal(data, &norm)
+	return norm, err
+}
+
+// hashValue returns the hex-encoded sha256 sum of a value encoded as JSON.
+// encoding/json sorts object keys, making the encoding canonical
+func hashValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// diffValues returns a readable diff of two values
+func diffValues(ctx context.Context, expect, got interface{}) (string, error) {
+	deltas, err := deepdiff.New().Diff(ctx, expect, got)
+	if err != nil {
+		return "", err
+	}
+	return deepdiff.FormatPrettyString(deltas, false)
+}
+
+// pinnedLoader loads the versions of datasets a transform originally read,
+// instead of the latest versions
+type pinnedLoader struct {
+	loader   dsref.Loader
+	resolver dsref.Resolver
+	inputs   []dsref.Ref
+
+	lk      sync.Mutex
+	missing []string
+}
+
+// compile-time assertion that pinnedLoader is a dsref.Loader
+var _ dsref.Loader = (*pinnedLoader)(nil)
+
+// LoadDataset loads the recorded version of a dataset
+func (l *pinnedLoader) LoadDataset(ctx context.Context, refstr string) (*dataset.Dataset, error) {
+	ref, err := dsref.Parse(refstr)
+	if err != nil {
+		return nil, err
+	}
+	if l.resolver != nil {
+		resolved := ref.Copy()
+		resolved.Path = ""
+		if _, err := l.resolver.ResolveRef(ctx, &resolved); err == nil {
+			ref.InitID = resolved.InitID
+			ref.Username = resolved.Username
+		}
+	}
+
+	for _, in := range l.inputs {
+		if (ref.InitID != "" && in.InitID == ref.InitID) || (in.Username == ref.Username && in.Name == ref.Name) {
+			pinned := dsref.Ref{Username: in.Username, Name: in.Name, Path: in.Path}
+			return l.loader.LoadDataset(ctx, pinned.String())
+		}
+	}
+
+	l.lk.Lock()
+	l.missing = append(l.missing, refstr)
+	sort.Strings(l.missing)
+	l.lk.Unlock()
+	return nil, fmt.Errorf("dataset %s isn't a recorded input of this version", refstr)
+}
+
+// Missing lists datasets the transform loaded that weren't recorded inputs
+func (l *pinnedLoader) Missing() []string {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	return append([]string(nil), l.missing...)
+}
@@ -0,0 +1,22 @@
+package verify
+
+import "testing"
+
+func TestReadsState(t *testing.T) {
+	cases := []struct {
+		script string
+		expect bool
+	}{
+		{"x = state.get('x')", true},
+		{"def f():\n  return state.get('x')\n", true},
+		{"def f(state):\n  return state.get('x')\n", false},
+		{"def f():\n  state = {}\n  return state.get('x')\n", false},
+		{"state = {}\nx = state.get('x')", false},
+		{"x = [state.get('x') for state in []]", false},
+	}
+	for _, c := range cases {
+		if got := readsState(c.script); got != c.expect {
+			t.Errorf("readsState(%q): want %t, got %t", c.script, c.expect, got)
+		}
+	}
+}